@@ -4,6 +4,7 @@ import (
 	"flag"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert"
@@ -12,6 +13,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
@@ -33,15 +35,21 @@ func main() {
 	buildinfo.Init()
 	logger.Init()
 	cgroup.UpdateGOMAXPROCSToCPUQuota()
+	flagutil.InitReloadableFlags()
 	logger.Infof("starting VictoriaMetrics at %q...", *httpListenAddr)
 	startTime := time.Now()
 	storage.SetMinScrapeIntervalForDeduplication(*minScrapeInterval)
+
+	// Start http server before opening the storage, since opening big storage may take a lot of time.
+	// /health and /ready pages are available during this time, while the remaining requests are rejected
+	// until the initialization is complete.
+	go httpserver.Serve(*httpListenAddr, requestHandler)
+
 	vmstorage.Init()
 	vmselect.Init()
 	vminsert.Init()
 	startSelfScraper()
-
-	go httpserver.Serve(*httpListenAddr, requestHandler)
+	atomic.StoreUint32(&initialized, 1)
 	logger.Infof("started VictoriaMetrics in %.3f seconds", time.Since(startTime).Seconds())
 
 	sig := procutil.WaitForSigterm()
@@ -65,7 +73,15 @@ func main() {
 	logger.Infof("the VictoriaMetrics has been stopped in %.3f seconds", time.Since(startTime).Seconds())
 }
 
+// initialized is set to 1 when all the VictoriaMetrics components are initialized.
+var initialized uint32
+
 func requestHandler(w http.ResponseWriter, r *http.Request) bool {
+	if atomic.LoadUint32(&initialized) == 0 {
+		// Do not log these errors, since clients may send many requests during startup.
+		http.Error(w, "VictoriaMetrics is starting; see /ready page for details", http.StatusServiceUnavailable)
+		return true
+	}
 	if vminsert.RequestHandler(w, r) {
 		return true
 	}
@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -132,6 +133,7 @@ func setUp() {
 	vmstorage.InitWithoutMetrics()
 	vmselect.Init()
 	vminsert.Init()
+	atomic.StoreUint32(&initialized, 1)
 	go httpserver.Serve(*httpListenAddr, requestHandler)
 	readyStorageCheckFunc := func() bool {
 		resp, err := http.Get(testHealthHTTPPath)
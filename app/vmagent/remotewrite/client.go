@@ -41,6 +41,13 @@ var (
 		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
 	bearerToken = flagutil.NewArray("remoteWrite.bearerToken", "Optional bearer auth token to use for -remoteWrite.url. "+
 		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
+
+	maxSampleAge = flagutil.NewArray("remoteWrite.maxSampleAge", "Optional maximum age of samples to send to -remoteWrite.url, for example 1h. "+
+		"Older samples are dropped before sending, so recent data is sent first after long unavailability of remote storage. "+
+		"By default samples of any age are sent. If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
+	maxRetryDuration = flagutil.NewArray("remoteWrite.maxRetryDuration", "Optional maximum duration for retrying to send a block of data to -remoteWrite.url, for example 30m. "+
+		"The block is dropped if it couldn't be sent during this duration. By default the block is retried until it is sent. "+
+		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
 )
 
 type client struct {
@@ -50,10 +57,15 @@ type client struct {
 	fq             *persistentqueue.FastQueue
 	hc             *http.Client
 
-	requestDuration *metrics.Histogram
-	requestsOKCount *metrics.Counter
-	errorsCount     *metrics.Counter
-	retriesCount    *metrics.Counter
+	maxSampleAge     time.Duration
+	maxRetryDuration time.Duration
+
+	requestDuration   *metrics.Histogram
+	requestsOKCount   *metrics.Counter
+	errorsCount       *metrics.Counter
+	retriesCount      *metrics.Counter
+	oldSamplesDropped *metrics.Counter
+	blocksDropped     *metrics.Counter
 
 	wg     sync.WaitGroup
 	stopCh chan struct{}
@@ -100,6 +112,14 @@ func newClient(argIdx int, remoteWriteURL, urlLabelValue string, fq *persistentq
 		}
 		authHeader = "Bearer " + token
 	}
+	sampleAge, err := getOptionalDuration(maxSampleAge, argIdx)
+	if err != nil {
+		logger.Fatalf("cannot parse -remoteWrite.maxSampleAge: %s", err)
+	}
+	retryDuration, err := getOptionalDuration(maxRetryDuration, argIdx)
+	if err != nil {
+		logger.Fatalf("cannot parse -remoteWrite.maxRetryDuration: %s", err)
+	}
 	c := &client{
 		urlLabelValue:  urlLabelValue,
 		remoteWriteURL: remoteWriteURL,
@@ -109,12 +129,16 @@ func newClient(argIdx int, remoteWriteURL, urlLabelValue string, fq *persistentq
 			Transport: tr,
 			Timeout:   *sendTimeout,
 		},
-		stopCh: make(chan struct{}),
+		maxSampleAge:     sampleAge,
+		maxRetryDuration: retryDuration,
+		stopCh:           make(chan struct{}),
 	}
 	c.requestDuration = metrics.GetOrCreateHistogram(fmt.Sprintf(`vmagent_remotewrite_duration_seconds{url=%q}`, c.urlLabelValue))
 	c.requestsOKCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_requests_total{url=%q, status_code="2XX"}`, c.urlLabelValue))
 	c.errorsCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_errors_total{url=%q}`, c.urlLabelValue))
 	c.retriesCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_retries_count_total{url=%q}`, c.urlLabelValue))
+	c.oldSamplesDropped = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_old_samples_dropped_total{url=%q}`, c.urlLabelValue))
+	c.blocksDropped = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_blocks_dropped_total{url=%q}`, c.urlLabelValue))
 	for i := 0; i < concurrency; i++ {
 		c.wg.Add(1)
 		go func() {
@@ -132,6 +156,21 @@ func (c *client) MustStop() {
 	logger.Infof("stopped client for -remoteWrite.url=%q", c.remoteWriteURL)
 }
 
+func getOptionalDuration(a *flagutil.Array, argIdx int) (time.Duration, error) {
+	s := a.GetOptionalArg(argIdx)
+	if len(s) == 0 {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration cannot be negative; got %s", d)
+	}
+	return d, nil
+}
+
 func getTLSConfig(argIdx int) (*tls.Config, error) {
 	c := &promauth.TLSConfig{
 		CAFile:             tlsCAFile.GetOptionalArg(argIdx),
@@ -186,8 +225,30 @@ func (c *client) runWorker() {
 func (c *client) sendBlock(block []byte) {
 	retryDuration := time.Second
 	retriesCount := 0
+	firstAttemptTime := time.Now()
+	var sd *samplesDropper
+	if c.maxSampleAge > 0 {
+		sd = getSamplesDropper()
+		defer putSamplesDropper(sd)
+	}
 
 again:
+	if sd != nil {
+		// Drop old samples before every attempt, since the block may become too old during retries.
+		minTimestamp := time.Now().Add(-c.maxSampleAge).UnixNano() / 1e6
+		blockNew, n, err := sd.dropOldSamples(block, minTimestamp)
+		if err != nil {
+			logger.Errorf("cannot drop samples older than -remoteWrite.maxSampleAge=%s from the block for %q; sending the block as is; error: %s",
+				c.maxSampleAge, c.remoteWriteURL, err)
+		} else {
+			c.oldSamplesDropped.Add(n)
+			if len(blockNew) == 0 {
+				// All the samples in the block are too old.
+				return
+			}
+			block = blockNew
+		}
+	}
 	req, err := http.NewRequest("POST", c.remoteWriteURL, bytes.NewBuffer(block))
 	if err != nil {
 		logger.Panicf("BUG: unexected error from http.NewRequest(%q): %s", c.remoteWriteURL, err)
@@ -210,6 +271,9 @@ again:
 		if retryDuration > time.Minute {
 			retryDuration = time.Minute
 		}
+		if c.mustDropBlock(block, firstAttemptTime, retryDuration) {
+			return
+		}
 		logger.Errorf("couldn't send a block with size %d bytes to %q: %s; re-sending the block in %.3f seconds",
 			len(block), c.remoteWriteURL, err, retryDuration.Seconds())
 		t := time.NewTimer(retryDuration)
@@ -238,6 +302,9 @@ again:
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	_ = resp.Body.Close()
+	if c.mustDropBlock(block, firstAttemptTime, retryDuration) {
+		return
+	}
 	if err != nil {
 		logger.Errorf("cannot read response body from %q during retry #%d: %s", c.remoteWriteURL, retriesCount, err)
 	} else {
@@ -254,3 +321,14 @@ again:
 	c.retriesCount.Inc()
 	goto again
 }
+
+// mustDropBlock returns true if the block cannot be re-sent in retryDuration according to -remoteWrite.maxRetryDuration.
+func (c *client) mustDropBlock(block []byte, firstAttemptTime time.Time, retryDuration time.Duration) bool {
+	if c.maxRetryDuration <= 0 || time.Since(firstAttemptTime)+retryDuration <= c.maxRetryDuration {
+		return false
+	}
+	logger.Errorf("dropping a block with size %d bytes for %q, since it couldn't be sent during -remoteWrite.maxRetryDuration=%s",
+		len(block), c.remoteWriteURL, c.maxRetryDuration)
+	c.blocksDropped.Inc()
+	return true
+}
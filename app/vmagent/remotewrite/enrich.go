@@ -0,0 +1,188 @@
+package remotewrite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
+)
+
+var (
+	addExternalLabels = flagutil.NewArray("remoteWrite.addExternalLabels", "Whether to add labels from `global -> external_labels` section of -promscrape.config "+
+		"to all the metrics before sending them to the corresponding -remoteWrite.url, including metrics received via push protocols. "+
+		"By default these labels are added only to metrics scraped from targets in -promscrape.config. "+
+		"A single value applies to all the -remoteWrite.url args")
+	enrichLabels = flagutil.NewArray("remoteWrite.enrichLabel", "Optional label in the form 'name=source' to add to all the metrics before sending them to -remoteWrite.url. "+
+		"Supported sources: hostname - the hostname of vmagent; ec2_instance_id - EC2 instance id obtained from AWS metadata server; "+
+		"gce_instance_id - GCE instance id obtained from GCE metadata server. The values are obtained once at vmagent start. "+
+		"These labels may be disabled for the particular -remoteWrite.url via -remoteWrite.urlSkipEnrichLabels")
+	skipEnrichLabels = flagutil.NewArray("remoteWrite.urlSkipEnrichLabels", "Whether to skip labels set via -remoteWrite.enrichLabel for the corresponding -remoteWrite.url")
+)
+
+// Labels obtained from -remoteWrite.enrichLabel sources at Init.
+var enrichLabelsGlobal []prompbmarshal.Label
+
+// initEnrichLabelsGlobal must be called after parsing command-line flags.
+func initEnrichLabelsGlobal() {
+	labels, err := getEnrichLabels(*enrichLabels)
+	if err != nil {
+		logger.Fatalf("cannot initialize `-remoteWrite.enrichLabel`: %s", err)
+	}
+	enrichLabelsGlobal = labels
+}
+
+func getEnrichLabels(args []string) ([]prompbmarshal.Label, error) {
+	var labels []prompbmarshal.Label
+	for _, s := range args {
+		n := strings.IndexByte(s, '=')
+		if n < 0 {
+			return nil, fmt.Errorf("missing '=' in %q; it must contain label in the form `name=source`", s)
+		}
+		name, source := s[:n], s[n+1:]
+		value, err := getEnrichLabelValue(source)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain value for label %q from source %q: %w", name, source, err)
+		}
+		labels = append(labels, prompbmarshal.Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	return labels, nil
+}
+
+func getEnrichLabelValue(source string) (string, error) {
+	switch source {
+	case "hostname":
+		return os.Hostname()
+	case "ec2_instance_id":
+		data, err := getEC2Metadata("meta-data/instance-id")
+		return string(data), err
+	case "gce_instance_id":
+		data, err := getGCEMetadata("instance/id")
+		return string(data), err
+	default:
+		return "", fmt.Errorf("unsupported source; supported sources: hostname, ec2_instance_id, gce_instance_id")
+	}
+}
+
+var metadataClient = &http.Client{
+	Timeout: 5 * time.Second,
+}
+
+func getEC2Metadata(path string) ([]byte, error) {
+	// See https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-service.html
+	sessionTokenURL := "http://169.254.169.254/latest/api/token"
+	req, err := http.NewRequest("PUT", sessionTokenURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request for IMDSv2 session token at url %q: %w", sessionTokenURL, err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := readMetadataResponse(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain IMDSv2 session token: %w", err)
+	}
+	metadataURL := "http://169.254.169.254/latest/" + path
+	req, err = http.NewRequest("GET", metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request to %q: %w", metadataURL, err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	return readMetadataResponse(req)
+}
+
+func getGCEMetadata(path string) ([]byte, error) {
+	// See https://cloud.google.com/compute/docs/storing-retrieving-metadata#default
+	metadataURL := "http://metadata.google.internal/computeMetadata/v1/" + path
+	req, err := http.NewRequest("GET", metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create http request for %q: %w", metadataURL, err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return readMetadataResponse(req)
+}
+
+func readMetadataResponse(req *http.Request) ([]byte, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain response from %q: %w", req.URL, err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response from %q: %w", req.URL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code for %q; got %d; want %d; response body: %q", req.URL, resp.StatusCode, http.StatusOK, data)
+	}
+	return data, nil
+}
+
+// getURLExtraLabels returns labels, which must be added to metrics before sending them to -remoteWrite.url with the given argIdx.
+//
+// externalLabels must contain labels from `global -> external_labels` section of -promscrape.config.
+func getURLExtraLabels(argIdx int, externalLabels []prompbmarshal.Label) ([]prompbmarshal.Label, error) {
+	var labels []prompbmarshal.Label
+	addExternal, err := getArrayBool(*addExternalLabels, argIdx, "-remoteWrite.addExternalLabels", true)
+	if err != nil {
+		return nil, err
+	}
+	if addExternal {
+		labels = append(labels, externalLabels...)
+	}
+	skipEnrich, err := getArrayBool(*skipEnrichLabels, argIdx, "-remoteWrite.urlSkipEnrichLabels", false)
+	if err != nil {
+		return nil, err
+	}
+	if !skipEnrich {
+		for _, label := range enrichLabelsGlobal {
+			if tmp := promrelabel.GetLabelByName(labels, label.Name); tmp != nil {
+				tmp.Value = label.Value
+			} else {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels, nil
+}
+
+// getArrayBool returns the boolean value for argIdx from a.
+//
+// A single value in a applies to all the indexes if applyToAll is set.
+func getArrayBool(a []string, argIdx int, flagName string, applyToAll bool) (bool, error) {
+	var s string
+	switch {
+	case applyToAll && len(a) == 1:
+		s = a[0]
+	case argIdx < len(a):
+		s = a[argIdx]
+	}
+	if s == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse `%s=%q`: %w", flagName, s, err)
+	}
+	return v, nil
+}
+
+func loadExternalLabels() ([]prompbmarshal.Label, error) {
+	if len(*addExternalLabels) == 0 {
+		return nil, nil
+	}
+	labels, err := promscrape.GetExternalLabels()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load external labels from -promscrape.config: %w", err)
+	}
+	return labels, nil
+}
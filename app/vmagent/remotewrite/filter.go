@@ -0,0 +1,155 @@
+package remotewrite
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+var (
+	keepSeries = flagutil.NewSelectorArray("remoteWrite.urlKeepSeries", "Optional series selector for the corresponding -remoteWrite.url. "+
+		"Only metrics matching the selector are sent to the -remoteWrite.url. For example, {__name__=~\"slo:.*\"} . "+
+		"The selector is applied after -remoteWrite.urlRelabelConfig")
+	dropSeries = flagutil.NewSelectorArray("remoteWrite.urlDropSeries", "Optional series selector for the corresponding -remoteWrite.url. "+
+		"Metrics matching the selector aren't sent to the -remoteWrite.url. For example, {env=\"dev\"} . "+
+		"The selector is applied after -remoteWrite.urlRelabelConfig")
+)
+
+// seriesFilter filters time series by keep and drop series selectors.
+type seriesFilter struct {
+	keep []labelFilter
+	drop []labelFilter
+}
+
+type labelFilter struct {
+	label      string
+	value      string
+	re         *regexp.Regexp
+	isNegative bool
+}
+
+func (lf *labelFilter) match(labels []prompbmarshal.Label) bool {
+	v := promrelabel.GetLabelValueByName(labels, lf.label)
+	var ok bool
+	if lf.re != nil {
+		ok = lf.re.MatchString(v)
+	} else {
+		ok = v == lf.value
+	}
+	return ok != lf.isNegative
+}
+
+func matchLabelFilters(lfs []labelFilter, labels []prompbmarshal.Label) bool {
+	for i := range lfs {
+		if !lfs[i].match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// filter removes time series, which don't match sf, from tss and returns the result.
+//
+// tss is modified in place.
+func (sf *seriesFilter) filter(tss []prompbmarshal.TimeSeries) []prompbmarshal.TimeSeries {
+	tssDst := tss[:0]
+	for i := range tss {
+		ts := &tss[i]
+		if len(sf.keep) > 0 && !matchLabelFilters(sf.keep, ts.Labels) {
+			continue
+		}
+		if len(sf.drop) > 0 && matchLabelFilters(sf.drop, ts.Labels) {
+			continue
+		}
+		tssDst = append(tssDst, *ts)
+	}
+	return tssDst
+}
+
+func loadSeriesFilters() ([]*seriesFilter, error) {
+	if len(*keepSeries) > len(*remoteWriteURLs) {
+		return nil, fmt.Errorf("too many -remoteWrite.urlKeepSeries args: %d; it mustn't exceed the number of -remoteWrite.url args: %d",
+			len(*keepSeries), len(*remoteWriteURLs))
+	}
+	if len(*dropSeries) > len(*remoteWriteURLs) {
+		return nil, fmt.Errorf("too many -remoteWrite.urlDropSeries args: %d; it mustn't exceed the number of -remoteWrite.url args: %d",
+			len(*dropSeries), len(*remoteWriteURLs))
+	}
+	sfs := make([]*seriesFilter, len(*remoteWriteURLs))
+	for i := range sfs {
+		var keep, drop string
+		if i < len(*keepSeries) {
+			keep = (*keepSeries)[i]
+		}
+		if i < len(*dropSeries) {
+			drop = (*dropSeries)[i]
+		}
+		sf, err := newSeriesFilter(keep, drop)
+		if err != nil {
+			return nil, err
+		}
+		sfs[i] = sf
+	}
+	return sfs, nil
+}
+
+// newSeriesFilter returns seriesFilter for the given keep and drop series selectors.
+//
+// Nil is returned if both selectors are empty.
+func newSeriesFilter(keep, drop string) (*seriesFilter, error) {
+	if len(keep) == 0 && len(drop) == 0 {
+		return nil, nil
+	}
+	var sf seriesFilter
+	if len(keep) > 0 {
+		lfs, err := parseSeriesSelector(keep)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse -remoteWrite.urlKeepSeries=%q: %w", keep, err)
+		}
+		sf.keep = lfs
+	}
+	if len(drop) > 0 {
+		lfs, err := parseSeriesSelector(drop)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse -remoteWrite.urlDropSeries=%q: %w", drop, err)
+		}
+		sf.drop = lfs
+	}
+	return &sf, nil
+}
+
+func parseSeriesSelector(s string) ([]labelFilter, error) {
+	expr, err := metricsql.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	me, ok := expr.(*metricsql.MetricExpr)
+	if !ok {
+		return nil, fmt.Errorf("expecting series selector; got %q", expr.AppendString(nil))
+	}
+	if len(me.LabelFilters) == 0 {
+		return nil, fmt.Errorf("series selector cannot be empty")
+	}
+	var lfs []labelFilter
+	for _, f := range me.LabelFilters {
+		lf := labelFilter{
+			label:      f.Label,
+			value:      f.Value,
+			isNegative: f.IsNegative,
+		}
+		if f.IsRegexp {
+			// Anchor the regexp in the same way as Prometheus does.
+			re, err := regexp.Compile("^(?:" + f.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse regexp for label %q: %w", f.Label, err)
+			}
+			lf.re = re
+		}
+		lfs = append(lfs, lf)
+	}
+	return lfs, nil
+}
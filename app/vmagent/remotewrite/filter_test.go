@@ -0,0 +1,74 @@
+package remotewrite
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestSeriesFilter(t *testing.T) {
+	newTimeSeries := func(name, env string) prompbmarshal.TimeSeries {
+		return prompbmarshal.TimeSeries{
+			Labels: []prompbmarshal.Label{
+				{
+					Name:  "__name__",
+					Value: name,
+				},
+				{
+					Name:  "env",
+					Value: env,
+				},
+			},
+		}
+	}
+	f := func(keep, drop string, namesExpected []string) {
+		t.Helper()
+		sf, err := newSeriesFilter(keep, drop)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		tss := []prompbmarshal.TimeSeries{
+			newTimeSeries("slo:errors:rate5m", "prod"),
+			newTimeSeries("http_requests_total", "prod"),
+			newTimeSeries("slo:latency:p99", "dev"),
+		}
+		tss = sf.filter(tss)
+		var names []string
+		for _, ts := range tss {
+			names = append(names, ts.Labels[0].Value)
+		}
+		if !reflect.DeepEqual(names, namesExpected) {
+			t.Fatalf("unexpected series left;\ngot\n%q\nwant\n%q", names, namesExpected)
+		}
+	}
+	f(`{__name__=~"slo:.*"}`, "", []string{"slo:errors:rate5m", "slo:latency:p99"})
+	f(`{__name__=~"slo"}`, "", nil)
+	f(`http_requests_total`, "", []string{"http_requests_total"})
+	f(`{env!="dev",__name__=~"slo:.+"}`, "", []string{"slo:errors:rate5m"})
+	f("", `{env="dev"}`, []string{"slo:errors:rate5m", "http_requests_total"})
+	f("", `{__name__!~"slo:.*"}`, []string{"slo:errors:rate5m", "slo:latency:p99"})
+	f(`{__name__=~"slo:.*"}`, `{env="prod"}`, []string{"slo:latency:p99"})
+	f(`{missing_label=""}`, "", []string{"slo:errors:rate5m", "http_requests_total", "slo:latency:p99"})
+}
+
+func TestNewSeriesFilter(t *testing.T) {
+	sf, err := newSeriesFilter("", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sf != nil {
+		t.Fatalf("expecting nil filter for empty selectors")
+	}
+
+	f := func(keep, drop string) {
+		t.Helper()
+		if _, err := newSeriesFilter(keep, drop); err == nil {
+			t.Fatalf("expecting non-nil error for keep=%q, drop=%q", keep, drop)
+		}
+	}
+	f(`{foo`, "")
+	f("", `sum(foo)`)
+	f(`{foo=~"("}`, "")
+	f("", `{}`)
+}
@@ -22,7 +22,7 @@ var (
 
 var labelsGlobal []prompbmarshal.Label
 
-// CheckRelabelConfigs checks -remoteWrite.relabelConfig and -remoteWrite.urlRelabelConfig.
+// CheckRelabelConfigs checks -remoteWrite.relabelConfig, -remoteWrite.urlRelabelConfig, labels and series filters for each -remoteWrite.url.
 func CheckRelabelConfigs() error {
 	_, err := loadRelabelConfigs()
 	return err
@@ -53,12 +53,43 @@ func loadRelabelConfigs() (*relabelConfigs, error) {
 		}
 		rcs.perURL[i] = prc
 	}
+	if len(*addExternalLabels) > len(*remoteWriteURLs) {
+		return nil, fmt.Errorf("too many -remoteWrite.addExternalLabels args: %d; it mustn't exceed the number of -remoteWrite.url args: %d",
+			len(*addExternalLabels), len(*remoteWriteURLs))
+	}
+	if len(*skipEnrichLabels) > len(*remoteWriteURLs) {
+		return nil, fmt.Errorf("too many -remoteWrite.urlSkipEnrichLabels args: %d; it mustn't exceed the number of -remoteWrite.url args: %d",
+			len(*skipEnrichLabels), len(*remoteWriteURLs))
+	}
+	externalLabels, err := loadExternalLabels()
+	if err != nil {
+		return nil, err
+	}
+	rcs.perURLLabels = make([][]prompbmarshal.Label, len(*remoteWriteURLs))
+	for i := range rcs.perURLLabels {
+		labels, err := getURLExtraLabels(i, externalLabels)
+		if err != nil {
+			return nil, err
+		}
+		rcs.perURLLabels[i] = labels
+	}
+	sfs, err := loadSeriesFilters()
+	if err != nil {
+		return nil, err
+	}
+	rcs.perURLFilters = sfs
 	return &rcs, nil
 }
 
 type relabelConfigs struct {
 	global []promrelabel.ParsedRelabelConfig
 	perURL [][]promrelabel.ParsedRelabelConfig
+
+	// perURLLabels contains external and enrichment labels to add to metrics for each -remoteWrite.url.
+	perURLLabels [][]prompbmarshal.Label
+
+	// perURLFilters contains series filters for each -remoteWrite.url. It contains nil if the filter isn't set.
+	perURLFilters []*seriesFilter
 }
 
 // initLabelsGlobal must be called after parsing command-line flags.
@@ -76,7 +107,12 @@ func initLabelsGlobal() {
 	}
 }
 
-func (rctx *relabelCtx) applyRelabeling(tss []prompbmarshal.TimeSeries, extraLabels []prompbmarshal.Label, prcs []promrelabel.ParsedRelabelConfig) []prompbmarshal.TimeSeries {
+// applyRelabeling adds extraLabels to tss and then applies prcs to them.
+//
+// Existing labels with the same names are overwritten by extraLabels if overwriteExtraLabels is set.
+// Otherwise extraLabels are added only to series without such labels.
+func (rctx *relabelCtx) applyRelabeling(tss []prompbmarshal.TimeSeries, extraLabels []prompbmarshal.Label, overwriteExtraLabels bool,
+	prcs []promrelabel.ParsedRelabelConfig) []prompbmarshal.TimeSeries {
 	if len(extraLabels) == 0 && len(prcs) == 0 {
 		// Nothing to change.
 		return tss
@@ -92,7 +128,9 @@ func (rctx *relabelCtx) applyRelabeling(tss []prompbmarshal.TimeSeries, extraLab
 			extraLabel := &extraLabels[j]
 			tmp := promrelabel.GetLabelByName(labels[labelsLen:], extraLabel.Name)
 			if tmp != nil {
-				tmp.Value = extraLabel.Value
+				if overwriteExtraLabels {
+					tmp.Value = extraLabel.Value
+				}
 			} else {
 				labels = append(labels, *extraLabel)
 			}
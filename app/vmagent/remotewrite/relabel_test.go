@@ -0,0 +1,48 @@
+package remotewrite
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestApplyRelabelingExtraLabels(t *testing.T) {
+	f := func(labels, extraLabels []prompbmarshal.Label, overwriteExtraLabels bool, labelsExpected []prompbmarshal.Label) {
+		t.Helper()
+		tss := []prompbmarshal.TimeSeries{{
+			Labels: append([]prompbmarshal.Label{}, labels...),
+		}}
+		rctx := getRelabelCtx()
+		defer putRelabelCtx(rctx)
+		tss = rctx.applyRelabeling(tss, extraLabels, overwriteExtraLabels, nil)
+		if len(tss) != 1 {
+			t.Fatalf("unexpected number of series; got %d; want 1", len(tss))
+		}
+		if !reflect.DeepEqual(tss[0].Labels, labelsExpected) {
+			t.Fatalf("unexpected labels;\ngot\n%v\nwant\n%v", tss[0].Labels, labelsExpected)
+		}
+	}
+	labels := []prompbmarshal.Label{
+		{Name: "__name__", Value: "up"},
+		{Name: "instance", Value: "foo"},
+	}
+	extraLabels := []prompbmarshal.Label{
+		{Name: "instance", Value: "bar"},
+		{Name: "host", Value: "baz"},
+	}
+
+	// External and enrichment labels mustn't overwrite the existing labels.
+	f(labels, extraLabels, false, []prompbmarshal.Label{
+		{Name: "__name__", Value: "up"},
+		{Name: "host", Value: "baz"},
+		{Name: "instance", Value: "foo"},
+	})
+
+	// Global labels overwrite the existing labels.
+	f(labels, extraLabels, true, []prompbmarshal.Label{
+		{Name: "__name__", Value: "up"},
+		{Name: "host", Value: "baz"},
+		{Name: "instance", Value: "bar"},
+	})
+}
@@ -66,6 +66,7 @@ func Init() {
 		httpserver.RegisterSecretFlag("remoteWrite.url")
 	}
 	initLabelsGlobal()
+	initEnrichLabelsGlobal()
 	rcs, err := loadRelabelConfigs()
 	if err != nil {
 		logger.Fatalf("cannot load relabel configs: %s", err)
@@ -102,7 +103,8 @@ func Init() {
 			case <-stopCh:
 				return
 			}
-			logger.Infof("SIGHUP received; reloading relabel configs pointed by -remoteWrite.relabelConfig and -remoteWrite.urlRelabelConfig")
+			logger.Infof("SIGHUP received; reloading relabel configs pointed by -remoteWrite.relabelConfig and -remoteWrite.urlRelabelConfig " +
+				"and external labels from -promscrape.config")
 			rcs, err := loadRelabelConfigs()
 			if err != nil {
 				logger.Errorf("cannot reload relabel configs; preserving the previous configs; error: %s", err)
@@ -163,7 +165,7 @@ func Push(wr *prompbmarshal.WriteRequest) {
 		}
 		if rctx != nil {
 			tssBlockLen := len(tssBlock)
-			tssBlock = rctx.applyRelabeling(tssBlock, labelsGlobal, prcsGlobal)
+			tssBlock = rctx.applyRelabeling(tssBlock, labelsGlobal, true, prcsGlobal)
 			globalRelabelMetricsDropped.Add(tssBlockLen - len(tssBlock))
 		}
 		for _, rwctx := range rwctxs {
@@ -187,7 +189,8 @@ type remoteWriteCtx struct {
 	pss        []*pendingSeries
 	pssNextIdx uint64
 
-	relabelMetricsDropped *metrics.Counter
+	relabelMetricsDropped  *metrics.Counter
+	filteredMetricsDropped *metrics.Counter
 }
 
 func newRemoteWriteCtx(argIdx int, remoteWriteURL string, maxInmemoryBlocks int, urlLabelValue string) *remoteWriteCtx {
@@ -211,7 +214,8 @@ func newRemoteWriteCtx(argIdx int, remoteWriteURL string, maxInmemoryBlocks int,
 		c:   c,
 		pss: pss,
 
-		relabelMetricsDropped: metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_relabel_metrics_dropped_total{path=%q, url=%q}`, path, urlLabelValue)),
+		relabelMetricsDropped:  metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_relabel_metrics_dropped_total{path=%q, url=%q}`, path, urlLabelValue)),
+		filteredMetricsDropped: metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_filtered_metrics_dropped_total{path=%q, url=%q}`, path, urlLabelValue)),
 	}
 }
 
@@ -227,6 +231,7 @@ func (rwctx *remoteWriteCtx) MustStop() {
 	rwctx.c = nil
 
 	rwctx.relabelMetricsDropped = nil
+	rwctx.filteredMetricsDropped = nil
 }
 
 func (rwctx *remoteWriteCtx) Push(tss []prompbmarshal.TimeSeries) {
@@ -234,7 +239,9 @@ func (rwctx *remoteWriteCtx) Push(tss []prompbmarshal.TimeSeries) {
 	var v *[]prompbmarshal.TimeSeries
 	rcs := allRelabelConfigs.Load().(*relabelConfigs)
 	prcs := rcs.perURL[rwctx.idx]
-	if len(prcs) > 0 {
+	extraLabels := rcs.perURLLabels[rwctx.idx]
+	sf := rcs.perURLFilters[rwctx.idx]
+	if len(prcs) > 0 || len(extraLabels) > 0 || sf != nil {
 		rctx = getRelabelCtx()
 		// Make a copy of tss before applying relabeling in order to prevent
 		// from affecting time series for other remoteWrite.url configs.
@@ -243,8 +250,14 @@ func (rwctx *remoteWriteCtx) Push(tss []prompbmarshal.TimeSeries) {
 		v = tssRelabelPool.Get().(*[]prompbmarshal.TimeSeries)
 		tss = append(*v, tss...)
 		tssLen := len(tss)
-		tss = rctx.applyRelabeling(tss, nil, prcs)
+		// External and enrichment labels mustn't overwrite the existing labels.
+		tss = rctx.applyRelabeling(tss, extraLabels, false, prcs)
 		rwctx.relabelMetricsDropped.Add(tssLen - len(tss))
+		if sf != nil {
+			tssLen = len(tss)
+			tss = sf.filter(tss)
+			rwctx.filteredMetricsDropped.Add(tssLen - len(tss))
+		}
 	}
 	pss := rwctx.pss
 	idx := atomic.AddUint64(&rwctx.pssNextIdx, 1) % uint64(len(pss))
@@ -0,0 +1,119 @@
+package remotewrite
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/golang/snappy"
+)
+
+// samplesDropper drops old samples from blocks read from the persistent queue.
+//
+// samplesDropper isn't safe for concurrent use.
+type samplesDropper struct {
+	wr  prompb.WriteRequest
+	wrm prompbmarshal.WriteRequest
+
+	tss     []prompbmarshal.TimeSeries
+	labels  []prompbmarshal.Label
+	samples []prompbmarshal.Sample
+
+	buf  []byte
+	mbuf []byte
+	zbuf []byte
+}
+
+func (sd *samplesDropper) reset() {
+	sd.wr.Reset()
+	sd.wrm.Timeseries = nil
+	sd.tss = prompbmarshal.ResetTimeSeries(sd.tss)
+	for i := range sd.labels {
+		label := &sd.labels[i]
+		label.Name = ""
+		label.Value = ""
+	}
+	sd.labels = sd.labels[:0]
+	sd.samples = sd.samples[:0]
+}
+
+// dropOldSamples drops samples with timestamps smaller than minTimestamp from the snappy-compressed block.
+//
+// It returns the block itself if there is nothing to drop and an empty block if all the samples have been dropped.
+// Otherwise the returned block is valid until the next call to dropOldSamples.
+// The number of dropped samples is returned as well.
+func (sd *samplesDropper) dropOldSamples(block []byte, minTimestamp int64) ([]byte, int, error) {
+	defer sd.reset()
+
+	buf, err := snappy.Decode(sd.buf[:cap(sd.buf)], block)
+	if err != nil {
+		return block, 0, fmt.Errorf("cannot decompress block with size %d bytes: %w", len(block), err)
+	}
+	sd.buf = buf
+	if err := sd.wr.Unmarshal(buf); err != nil {
+		return block, 0, fmt.Errorf("cannot unmarshal block with size %d bytes: %w", len(buf), err)
+	}
+	droppedSamples := 0
+	tss := sd.tss[:0]
+	labels := sd.labels[:0]
+	samples := sd.samples[:0]
+	for i := range sd.wr.Timeseries {
+		ts := &sd.wr.Timeseries[i]
+		samplesLen := len(samples)
+		for _, s := range ts.Samples {
+			if s.Timestamp < minTimestamp {
+				droppedSamples++
+				continue
+			}
+			samples = append(samples, prompbmarshal.Sample{
+				Value:     s.Value,
+				Timestamp: s.Timestamp,
+			})
+		}
+		if len(samples) == samplesLen {
+			// All the samples for the given time series have been dropped.
+			continue
+		}
+		labelsLen := len(labels)
+		for _, label := range ts.Labels {
+			labels = append(labels, prompbmarshal.Label{
+				Name:  bytesutil.ToUnsafeString(label.Name),
+				Value: bytesutil.ToUnsafeString(label.Value),
+			})
+		}
+		tss = append(tss, prompbmarshal.TimeSeries{
+			Labels:  labels[labelsLen:],
+			Samples: samples[samplesLen:],
+		})
+	}
+	sd.tss = tss
+	sd.labels = labels
+	sd.samples = samples
+	if droppedSamples == 0 {
+		// Fast path - nothing to drop.
+		return block, 0, nil
+	}
+	if len(tss) == 0 {
+		return nil, droppedSamples, nil
+	}
+	sd.wrm.Timeseries = tss
+	sd.mbuf = prompbmarshal.MarshalWriteRequest(sd.mbuf[:0], &sd.wrm)
+	sd.zbuf = snappy.Encode(sd.zbuf[:cap(sd.zbuf)], sd.mbuf)
+	return sd.zbuf, droppedSamples, nil
+}
+
+func getSamplesDropper() *samplesDropper {
+	v := samplesDropperPool.Get()
+	if v == nil {
+		return &samplesDropper{}
+	}
+	return v.(*samplesDropper)
+}
+
+func putSamplesDropper(sd *samplesDropper) {
+	samplesDropperPool.Put(sd)
+}
+
+var samplesDropperPool sync.Pool
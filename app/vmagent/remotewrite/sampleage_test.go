@@ -0,0 +1,106 @@
+package remotewrite
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/golang/snappy"
+)
+
+func TestSamplesDropperDropOldSamples(t *testing.T) {
+	marshalBlock := func(tss []prompbmarshal.TimeSeries) []byte {
+		wr := &prompbmarshal.WriteRequest{
+			Timeseries: tss,
+		}
+		return snappy.Encode(nil, prompbmarshal.MarshalWriteRequest(nil, wr))
+	}
+	unmarshalTimestamps := func(block []byte) map[string][]int64 {
+		data, err := snappy.Decode(nil, block)
+		if err != nil {
+			t.Fatalf("cannot decompress block: %s", err)
+		}
+		var wr prompb.WriteRequest
+		if err := wr.Unmarshal(data); err != nil {
+			t.Fatalf("cannot unmarshal block: %s", err)
+		}
+		m := make(map[string][]int64)
+		for _, ts := range wr.Timeseries {
+			name := string(ts.Labels[0].Value)
+			for _, s := range ts.Samples {
+				m[name] = append(m[name], s.Timestamp)
+			}
+		}
+		return m
+	}
+	newTimeSeries := func(name string, timestamps ...int64) prompbmarshal.TimeSeries {
+		var samples []prompbmarshal.Sample
+		for _, timestamp := range timestamps {
+			samples = append(samples, prompbmarshal.Sample{
+				Value:     1,
+				Timestamp: timestamp,
+			})
+		}
+		return prompbmarshal.TimeSeries{
+			Labels: []prompbmarshal.Label{
+				{
+					Name:  "__name__",
+					Value: name,
+				},
+			},
+			Samples: samples,
+		}
+	}
+	block := marshalBlock([]prompbmarshal.TimeSeries{
+		newTimeSeries("foo", 10, 20, 30),
+		newTimeSeries("bar", 5, 15),
+	})
+
+	sd := &samplesDropper{}
+
+	// Nothing to drop
+	blockNew, n, err := sd.dropOldSamples(block, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("unexpected number of dropped samples; got %d; want 0", n)
+	}
+	if &blockNew[0] != &block[0] {
+		t.Fatalf("expecting the original block")
+	}
+
+	// Drop some samples
+	blockNew, n, err = sd.dropOldSamples(block, 16)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("unexpected number of dropped samples; got %d; want 3", n)
+	}
+	m := unmarshalTimestamps(blockNew)
+	mExpected := map[string][]int64{
+		"foo": {20, 30},
+	}
+	if !reflect.DeepEqual(m, mExpected) {
+		t.Fatalf("unexpected samples left;\ngot\n%v\nwant\n%v", m, mExpected)
+	}
+
+	// Drop the remaining samples from the previously returned block
+	blockNew, n, err = sd.dropOldSamples(blockNew, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("unexpected number of dropped samples; got %d; want 2", n)
+	}
+	if len(blockNew) != 0 {
+		t.Fatalf("expecting empty block; got %d bytes", len(blockNew))
+	}
+
+	// Invalid block
+	if _, _, err := sd.dropOldSamples([]byte("foobar"), 16); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// CompatibilityIssue describes a rule expression, which may return different results
+// in MetricsQL comparing to Prometheus.
+type CompatibilityIssue struct {
+	File  string
+	Group string
+	Rule  string
+
+	// Expr is the part of the rule expression, which behaves differently.
+	Expr string
+
+	// Description explains the difference.
+	Description string
+}
+
+// String returns human-readable representation of ci.
+func (ci *CompatibilityIssue) String() string {
+	return fmt.Sprintf("%s: group %q: rule %q: `%s`: %s", ci.File, ci.Group, ci.Rule, ci.Expr, ci.Description)
+}
+
+// CheckCompatibility returns rule expressions from groups, which may behave differently in MetricsQL comparing to Prometheus.
+//
+// See https://github.com/VictoriaMetrics/VictoriaMetrics/blob/master/docs/MetricsQL.md for the list of differences.
+func CheckCompatibility(groups []Group) ([]CompatibilityIssue, error) {
+	var issues []CompatibilityIssue
+	for _, g := range groups {
+		for _, r := range g.Rules {
+			ruleName := r.Name()
+			descs, err := checkExprCompatibility(r.Expr)
+			if err != nil {
+				return nil, fmt.Errorf("cannot check expression for rule %q.%q: %w", g.Name, ruleName, err)
+			}
+			for _, d := range descs {
+				issues = append(issues, CompatibilityIssue{
+					File:        g.File,
+					Group:       g.Name,
+					Rule:        ruleName,
+					Expr:        d.expr,
+					Description: d.description,
+				})
+			}
+		}
+	}
+	return issues, nil
+}
+
+type exprIncompatibility struct {
+	expr        string
+	description string
+}
+
+func checkExprCompatibility(expr string) ([]exprIncompatibility, error) {
+	e, err := metricsql.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	var result []exprIncompatibility
+	metricsql.VisitAll(e, func(e metricsql.Expr) {
+		switch t := e.(type) {
+		case *metricsql.BinaryOpExpr:
+			if !metricsql.IsBinaryOpCmp(t.Op) {
+				return
+			}
+			if desc := getThresholdIncompatibility(t.Left, t.Right); desc != "" {
+				result = append(result, exprIncompatibility{
+					expr:        string(t.AppendString(nil)),
+					description: desc,
+				})
+			} else if desc := getThresholdIncompatibility(t.Right, t.Left); desc != "" {
+				result = append(result, exprIncompatibility{
+					expr:        string(t.AppendString(nil)),
+					description: desc,
+				})
+			}
+		case *metricsql.FuncExpr:
+			if desc := getFuncIncompatibility(t); desc != "" {
+				result = append(result, exprIncompatibility{
+					expr:        string(t.AppendString(nil)),
+					description: desc,
+				})
+			}
+		case *metricsql.RollupExpr:
+			if t.Step != "" || t.InheritStep {
+				result = append(result, exprIncompatibility{
+					expr: string(t.AppendString(nil)),
+					description: "subquery results may differ, since MetricsQL doesn't align the inner query timestamps to multiples of the subquery step " +
+						"and takes into account the previous point before the window when applying range functions to subquery results",
+				})
+			}
+		}
+	})
+	return result, nil
+}
+
+func getFuncIncompatibility(fe *metricsql.FuncExpr) string {
+	if strings.ToLower(fe.Name) == "absent" && len(fe.Args) == 1 {
+		if _, ok := fe.Args[0].(*metricsql.MetricExpr); ok {
+			return "absent() may fire at a different time, since MetricsQL detects stale series by the gap exceeding the scrape interval " +
+				"instead of staleness markers and the fixed 5m lookback delta used by Prometheus"
+		}
+	}
+	return ""
+}
+
+// getThresholdIncompatibility returns the description of the incompatibility if e is compared with the threshold.
+//
+// Range functions return close results in MetricsQL and Prometheus, so only comparisons with thresholds are affected,
+// since the threshold may be crossed at a different time. Comparisons of rate(), irate(), increase() and delta() with zero
+// aren't reported, since zero values remain zero in both MetricsQL and Prometheus.
+func getThresholdIncompatibility(e, threshold metricsql.Expr) string {
+	ne, ok := threshold.(*metricsql.NumberExpr)
+	if !ok {
+		return ""
+	}
+	if ae, ok := e.(*metricsql.AggrFuncExpr); ok && len(ae.Args) == 1 {
+		e = ae.Args[0]
+	}
+	fe, ok := e.(*metricsql.FuncExpr)
+	if !ok || !hasRangeSelectorArg(fe) {
+		return ""
+	}
+	switch strings.ToLower(fe.Name) {
+	case "increase", "delta", "rate":
+		if ne.N != 0 {
+			return fmt.Sprintf("%s() may cross the threshold at a different time, since MetricsQL doesn't extrapolate its results to the window boundaries "+
+				"and takes into account the previous point before the window", fe.Name)
+		}
+	case "irate":
+		if ne.N != 0 {
+			return fmt.Sprintf("%s() may cross the threshold at a different time, since MetricsQL takes into account the previous point before the window", fe.Name)
+		}
+	case "changes", "resets":
+		return fmt.Sprintf("%s() may cross the threshold at a different time, since MetricsQL takes into account the previous point before the window", fe.Name)
+	}
+	return ""
+}
+
+func hasRangeSelectorArg(fe *metricsql.FuncExpr) bool {
+	for _, arg := range fe.Args {
+		re, ok := arg.(*metricsql.RollupExpr)
+		if !ok || re.Step != "" || re.InheritStep {
+			// Subqueries are reported separately.
+			continue
+		}
+		if _, ok := re.Expr.(*metricsql.MetricExpr); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCheckExprCompatibility(t *testing.T) {
+	f := func(expr string, exprsExpected []string) {
+		t.Helper()
+		result, err := checkExprCompatibility(expr)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var exprs []string
+		for _, r := range result {
+			exprs = append(exprs, r.expr)
+		}
+		if !reflect.DeepEqual(exprs, exprsExpected) {
+			t.Fatalf("unexpected incompatible expressions for %q\ngot\n%q\nwant\n%q", expr, exprs, exprsExpected)
+		}
+	}
+
+	// Compatible expressions
+	f(`up == 0`, nil)
+	f(`sum(irate(http_requests_total[5m])) by (job) > 0`, nil)
+	f(`max_over_time(foo[1h])`, nil)
+	f(`absent(sum(foo))`, nil)
+	f(`rate(http_requests_total[5m]) != 0`, nil)
+	f(`sum(rate(http_requests_total[5m])) by (job)`, nil)
+	f(`increase(foo[1h])`, nil)
+	f(`increase(foo[1h]) > 0`, nil)
+	f(`sum(delta(foo[1h])) by (job) != 0`, nil)
+	f(`increase(foo[1h]) > bar`, nil)
+	f(`changes(foo[10m]) + resets(bar[10m])`, nil)
+
+	// Comparisons with thresholds
+	f(`increase(errors_total[1h]) > 10`, []string{`increase(errors_total[1h]) > 10`})
+	f(`5 < sum(delta(foo[1h])) by (job)`, []string{`5 < sum(delta(foo[1h])) by (job)`})
+	f(`changes(foo[10m]) > 0`, []string{`changes(foo[10m]) > 0`})
+	f(`rate(http_requests_total[5m]) > 10`, []string{`rate(http_requests_total[5m]) > 10`})
+	f(`0.5 <= sum(irate(http_requests_total[5m])) by (job)`, []string{`0.5 <= sum(irate(http_requests_total[5m])) by (job)`})
+	f(`resets(foo[1h]) >= 1 and increase(bar[5m]) == 3`, []string{`resets(foo[1h]) >= 1`, `increase(bar[5m]) == 3`})
+
+	// Staleness
+	f(`absent(up{job="foo"})`, []string{`absent(up{job="foo"})`})
+
+	// Subqueries
+	f(`max_over_time(rate(foo[5m])[1h:1m])`, []string{`rate(foo[5m])[1h:1m]`})
+	f(`min_over_time(sum(foo)[1h:])`, []string{`sum(foo)[1h:]`})
+}
+
+func TestCheckExprCompatibilityFailure(t *testing.T) {
+	if _, err := checkExprCompatibility(`rate(foo[5m]`); err == nil {
+		t.Fatalf("expecting non-nil error for invalid expression")
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	f := func(path string, issuesExpected []string) {
+		t.Helper()
+		groups, err := Parse([]string{path}, false, true)
+		if err != nil {
+			t.Fatalf("cannot parse rules: %s", err)
+		}
+		issues, err := CheckCompatibility(groups)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var result []string
+		for i := range issues {
+			ci := &issues[i]
+			if ci.File != path {
+				t.Fatalf("unexpected file for %q; got %q; want %q", ci.Expr, ci.File, path)
+			}
+			if ci.Description == "" {
+				t.Fatalf("missing description for %q", ci.Expr)
+			}
+			result = append(result, fmt.Sprintf("%s/%s: %s", ci.Group, ci.Rule, ci.Expr))
+		}
+		if !reflect.DeepEqual(result, issuesExpected) {
+			t.Fatalf("unexpected issues for %q\ngot\n%q\nwant\n%q", path, result, issuesExpected)
+		}
+	}
+	f("testdata/rules0-good.rules", nil)
+	f("testdata/rules-compat.rules", []string{
+		`incompatible/TooManyRequests: rate(http_requests_total[5m]) > 10`,
+		`incompatible/TooManyErrors: increase(errors_total[1h]) > 10`,
+		`incompatible/Flapping: sum(changes(up[10m])) by (instance) >= 3`,
+		`incompatible/TargetMissing: absent(up{job="foo"})`,
+	})
+}
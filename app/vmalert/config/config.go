@@ -24,6 +24,9 @@ type Group struct {
 	Interval    time.Duration `yaml:"interval,omitempty"`
 	Rules       []Rule        `yaml:"rules"`
 	Concurrency int           `yaml:"concurrency"`
+	// EvalOffset is the offset inside the Interval when the group rules are evaluated.
+	// The group rules are evaluated at random offset if EvalOffset isn't set.
+	EvalOffset *time.Duration `yaml:"eval_offset,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline"`
@@ -37,6 +40,17 @@ func (g *Group) Validate(validateAnnotations, validateExpressions bool) error {
 	if len(g.Rules) == 0 {
 		return fmt.Errorf("group %q can't contain no rules", g.Name)
 	}
+	if g.Interval < 0 {
+		return fmt.Errorf("interval for group %q can't be negative", g.Name)
+	}
+	if g.EvalOffset != nil {
+		if *g.EvalOffset < 0 {
+			return fmt.Errorf("eval_offset for group %q can't be negative", g.Name)
+		}
+		if g.Interval > 0 && *g.EvalOffset >= g.Interval {
+			return fmt.Errorf("eval_offset=%s for group %q must be smaller than interval=%s", *g.EvalOffset, g.Name, g.Interval)
+		}
+	}
 	uniqueRules := map[uint64]struct{}{}
 	for _, r := range g.Rules {
 		ruleName := r.Record
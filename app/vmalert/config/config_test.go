@@ -211,6 +211,44 @@ func TestGroup_Validate(t *testing.T) {
 			},
 			expErr: "",
 		},
+		{
+			group: &Group{Name: "test",
+				Interval:   time.Minute,
+				EvalOffset: durationPtr(30 * time.Second),
+				Rules: []Rule{
+					{Record: "record", Expr: "up == 1"},
+				},
+			},
+			expErr: "",
+		},
+		{
+			group: &Group{Name: "test",
+				Interval:   time.Minute,
+				EvalOffset: durationPtr(time.Minute),
+				Rules: []Rule{
+					{Record: "record", Expr: "up == 1"},
+				},
+			},
+			expErr: "must be smaller than interval",
+		},
+		{
+			group: &Group{Name: "test",
+				EvalOffset: durationPtr(-time.Second),
+				Rules: []Rule{
+					{Record: "record", Expr: "up == 1"},
+				},
+			},
+			expErr: "eval_offset for group \"test\" can't be negative",
+		},
+		{
+			group: &Group{Name: "test",
+				Interval: -time.Minute,
+				Rules: []Rule{
+					{Record: "record", Expr: "up == 1"},
+				},
+			},
+			expErr: "interval for group \"test\" can't be negative",
+		},
 	}
 	for _, tc := range testCases {
 		err := tc.group.Validate(tc.validateAnnotations, tc.validateExpressions)
@@ -320,3 +358,7 @@ func TestHashRule(t *testing.T) {
 		}
 	}
 }
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
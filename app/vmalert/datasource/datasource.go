@@ -1,6 +1,9 @@
 package datasource
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Querier interface wraps Query method which
 // executes given query and returns list of Metrics
@@ -9,6 +12,13 @@ type Querier interface {
 	Query(ctx context.Context, query string) ([]Metric, error)
 }
 
+// RangeQuerier interface wraps QueryRange method which
+// executes given query on the time range with the given step
+// and returns list of Metrics with a single data point each
+type RangeQuerier interface {
+	QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]Metric, error)
+}
+
 // Metric is the basic entity which should be return by datasource
 // It represents single data point with full list of labels
 type Metric struct {
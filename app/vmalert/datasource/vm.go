@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type response struct {
@@ -18,6 +19,7 @@ type response struct {
 		Result     []struct {
 			Labels map[string]string `json:"metric"`
 			TV     [2]interface{}    `json:"value"`
+			Values [][2]interface{}  `json:"values"`
 		} `json:"result"`
 	} `json:"data"`
 	ErrorType string `json:"errorType"`
@@ -45,12 +47,50 @@ func (r response) metrics() ([]Metric, error) {
 	return ms, nil
 }
 
-const queryPath = "/api/v1/query?query="
+func (r response) rangeMetrics() ([]Metric, error) {
+	var ms []Metric
+	var m Metric
+	for i, res := range r.Data.Result {
+		var labels []Label
+		for k, v := range r.Data.Result[i].Labels {
+			labels = append(labels, Label{Name: k, Value: v})
+		}
+		for _, tv := range res.Values {
+			s, ok := tv[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("metric %v, unexpected value %v; expecting string", res.Labels, tv[1])
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("metric %v, unable to parse float64 from %s: %w", res.Labels, s, err)
+			}
+			ts, ok := tv[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("metric %v, unexpected timestamp %v; expecting number", res.Labels, tv[0])
+			}
+			m.Labels = labels
+			m.Timestamp = int64(ts)
+			m.Value = f
+			ms = append(ms, m)
+		}
+	}
+	return ms, nil
+}
+
+const (
+	queryPath      = "/api/v1/query?query="
+	queryRangePath = "/api/v1/query_range?query="
+)
+
+const (
+	statusSuccess, statusError, rtVector, rtMatrix = "success", "error", "vector", "matrix"
+)
 
 // VMStorage represents vmstorage entity with ability to read and write metrics
 type VMStorage struct {
 	c             *http.Client
 	queryURL      string
+	queryRangeURL string
 	basicAuthUser string
 	basicAuthPass string
 }
@@ -62,15 +102,41 @@ func NewVMStorage(baseURL, basicAuthUser, basicAuthPass string, c *http.Client)
 		basicAuthUser: basicAuthUser,
 		basicAuthPass: basicAuthPass,
 		queryURL:      strings.TrimSuffix(baseURL, "/") + queryPath,
+		queryRangeURL: strings.TrimSuffix(baseURL, "/") + queryRangePath,
 	}
 }
 
 // Query reads metrics from datasource by given query
 func (s *VMStorage) Query(ctx context.Context, query string) ([]Metric, error) {
-	const (
-		statusSuccess, statusError, rtVector = "success", "error", "vector"
-	)
-	req, err := http.NewRequest("POST", s.queryURL+url.QueryEscape(query), nil)
+	r, err := s.do(ctx, s.queryURL+url.QueryEscape(query))
+	if err != nil {
+		return nil, err
+	}
+	if r.Data.ResultType != rtVector {
+		return nil, fmt.Errorf("unknown restul type:%s. Expected vector", r.Data.ResultType)
+	}
+	return r.metrics()
+}
+
+// QueryRange reads metrics from datasource by given query on the time range from start to end with the given step.
+//
+// Every returned Metric contains a single data point, so time series with multiple data points are returned as multiple Metrics.
+func (s *VMStorage) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]Metric, error) {
+	// Response cache is disabled, so the returned data points are located exactly at start+N*step.
+	queryURL := fmt.Sprintf("%s%s&start=%d&end=%d&step=%ds&nocache=1", s.queryRangeURL, url.QueryEscape(query),
+		start.Unix(), end.Unix(), int64(step.Seconds()))
+	r, err := s.do(ctx, queryURL)
+	if err != nil {
+		return nil, err
+	}
+	if r.Data.ResultType != rtMatrix {
+		return nil, fmt.Errorf("unknown result type:%s. Expected matrix", r.Data.ResultType)
+	}
+	return r.rangeMetrics()
+}
+
+func (s *VMStorage) do(ctx context.Context, queryURL string) (*response, error) {
+	req, err := http.NewRequest("POST", queryURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -97,8 +163,5 @@ func (s *VMStorage) Query(ctx context.Context, query string) ([]Metric, error) {
 	if r.Status != statusSuccess {
 		return nil, fmt.Errorf("unknown status: %s, Expected success or error ", r.Status)
 	}
-	if r.Data.ResultType != rtVector {
-		return nil, fmt.Errorf("unknown restul type:%s. Expected vector", r.Data.ResultType)
-	}
-	return r.metrics()
+	return r, nil
 }
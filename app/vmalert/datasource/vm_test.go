@@ -4,7 +4,9 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 )
 
 var (
@@ -91,3 +93,58 @@ func TestVMSelectQuery(t *testing.T) {
 	}
 
 }
+
+func TestVMSelectQueryRange(t *testing.T) {
+	start := time.Unix(1583786100, 0)
+	end := time.Unix(1583786160, 0)
+	step := 30 * time.Second
+	c := -1
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		c++
+		q := r.URL.Query()
+		if q.Get("query") != query {
+			t.Errorf("expected %s in query param, got %s", query, q.Get("query"))
+		}
+		if q.Get("start") != "1583786100" || q.Get("end") != "1583786160" || q.Get("step") != "30s" {
+			t.Errorf("unexpected start=%q, end=%q, step=%q", q.Get("start"), q.Get("end"), q.Get("step"))
+		}
+		switch c {
+		case 0:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector"}}`))
+		case 1:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"vm_rows"},"values":[[1583786100,"1"],[1583786130,"foo"]]}]}}`))
+		case 2:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"vm_rows"},"values":[[1583786100,"1"],[1583786160,"3"]]}]}}`))
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	am := NewVMStorage(srv.URL, "", "", srv.Client())
+	if _, err := am.QueryRange(ctx, query, start, end, step); err == nil {
+		t.Fatalf("expected non-matrix resultType error got nil")
+	}
+	if _, err := am.QueryRange(ctx, query, start, end, step); err == nil {
+		t.Fatalf("expected invalid value error got nil")
+	}
+	m, err := am.QueryRange(ctx, query, start, end, step)
+	if err != nil {
+		t.Fatalf("unexpected %s", err)
+	}
+	expected := []Metric{
+		{
+			Labels:    []Label{{Name: "__name__", Value: "vm_rows"}},
+			Timestamp: 1583786100,
+			Value:     1,
+		},
+		{
+			Labels:    []Label{{Name: "__name__", Value: "vm_rows"}},
+			Timestamp: 1583786160,
+			Value:     3,
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("unexpected metrics;\ngot\n%+v\nwant\n%+v", m, expected)
+	}
+}
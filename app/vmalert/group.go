@@ -24,6 +24,9 @@ type Group struct {
 	Rules       []Rule
 	Interval    time.Duration
 	Concurrency int
+	// EvalOffset is the offset inside the Interval when rules are evaluated.
+	// Rules are evaluated at random offset derived from the group ID if EvalOffset is nil.
+	EvalOffset *time.Duration
 
 	doneCh     chan struct{}
 	finishedCh chan struct{}
@@ -53,6 +56,7 @@ func newGroup(cfg config.Group, defaultInterval time.Duration, labels map[string
 		File:        cfg.File,
 		Interval:    cfg.Interval,
 		Concurrency: cfg.Concurrency,
+		EvalOffset:  cfg.EvalOffset,
 		doneCh:      make(chan struct{}),
 		finishedCh:  make(chan struct{}),
 		updateCh:    make(chan *Group),
@@ -64,6 +68,12 @@ func newGroup(cfg config.Group, defaultInterval time.Duration, labels map[string
 	if g.Concurrency < 1 {
 		g.Concurrency = 1
 	}
+	if g.EvalOffset != nil && *g.EvalOffset >= g.Interval {
+		offset := *g.EvalOffset % g.Interval
+		logger.Warnf("eval_offset=%s for group %q exceeds interval=%s; using eval_offset=%s instead",
+			*g.EvalOffset, g.Name, g.Interval, offset)
+		g.EvalOffset = &offset
+	}
 	rules := make([]Rule, len(cfg.Rules))
 	for i, r := range cfg.Rules {
 		// override rule labels with external labels
@@ -185,30 +195,21 @@ var skipRandSleepOnGroupStart bool
 func (g *Group) start(ctx context.Context, querier datasource.Querier, nts []notifier.Notifier, rw *remotewrite.Client) {
 	defer func() { close(g.finishedCh) }()
 
+	logger.Infof("group %q started; interval=%v; concurrency=%d%s", g.Name, g.Interval, g.Concurrency, g.evalOffsetString())
+	e := &executor{querier, nts, rw}
+
 	// Spread group rules evaluation over time in order to reduce load on VictoriaMetrics.
-	if !skipRandSleepOnGroupStart {
-		randSleep := uint64(float64(g.Interval) * (float64(uint32(g.ID())) / (1 << 32)))
-		sleepOffset := uint64(time.Now().UnixNano()) % uint64(g.Interval)
-		if randSleep < sleepOffset {
-			randSleep += uint64(g.Interval)
-		}
-		randSleep -= sleepOffset
-		sleepTimer := time.NewTimer(time.Duration(randSleep))
-		select {
-		case <-ctx.Done():
-			sleepTimer.Stop()
-			return
-		case <-g.doneCh:
-			sleepTimer.Stop()
-			return
-		case <-sleepTimer.C:
+	// The ticker for evaluations is started when startTimer fires instead of sleeping before the start,
+	// so the group may be updated or stopped while waiting for the first evaluation.
+	var t *time.Ticker
+	var tickerCh <-chan time.Time
+	startTimer := time.NewTimer(g.startDelay(time.Now(), true))
+	defer func() {
+		startTimer.Stop()
+		if t != nil {
+			t.Stop()
 		}
-	}
-
-	logger.Infof("group %q started; interval=%v; concurrency=%d", g.Name, g.Interval, g.Concurrency)
-	e := &executor{querier, nts, rw}
-	t := time.NewTicker(g.Interval)
-	defer t.Stop()
+	}()
 	for {
 		select {
 		case <-ctx.Done():
@@ -225,14 +226,28 @@ func (g *Group) start(ctx context.Context, querier datasource.Querier, nts []not
 				g.mu.Unlock()
 				continue
 			}
-			if g.Interval != ng.Interval {
+			scheduleChanged := g.Interval != ng.Interval || !equalDurationPtrs(g.EvalOffset, ng.EvalOffset)
+			if scheduleChanged {
 				g.Interval = ng.Interval
-				t.Stop()
-				t = time.NewTicker(g.Interval)
+				g.EvalOffset = ng.EvalOffset
 			}
 			g.mu.Unlock()
-			logger.Infof("group %q re-started; interval=%v; concurrency=%d", g.Name, g.Interval, g.Concurrency)
-		case <-t.C:
+			if scheduleChanged {
+				// Re-start the ticker for evaluations with the new schedule.
+				// Evaluations are aligned to the new eval_offset if it is set.
+				if t != nil {
+					t.Stop()
+					t = nil
+					tickerCh = nil
+				}
+				startTimer.Stop()
+				startTimer = time.NewTimer(g.startDelay(time.Now(), false))
+			}
+			logger.Infof("group %q re-started; interval=%v; concurrency=%d%s", g.Name, g.Interval, g.Concurrency, g.evalOffsetString())
+		case <-startTimer.C:
+			t = time.NewTicker(g.Interval)
+			tickerCh = t.C
+		case <-tickerCh:
 			g.metrics.iterationTotal.Inc()
 			iterationStart := time.Now()
 
@@ -248,6 +263,49 @@ func (g *Group) start(ctx context.Context, querier datasource.Querier, nts []not
 	}
 }
 
+// startDelay returns the delay since ts before starting the ticker for evaluations of g.
+//
+// The delay is applied on schedule change only if EvalOffset is set, since evaluations must be aligned to it.
+func (g *Group) startDelay(ts time.Time, isGroupStart bool) time.Duration {
+	if skipRandSleepOnGroupStart || (!isGroupStart && g.EvalOffset == nil) {
+		return 0
+	}
+	return g.delayBeforeStart(ts)
+}
+
+// delayBeforeStart returns the delay since ts before the first evaluation of g.
+//
+// Rules are evaluated at EvalOffset inside the Interval if EvalOffset is set.
+// Otherwise the offset is derived from the group ID, so evaluations of distinct groups are spread over the Interval.
+func (g *Group) delayBeforeStart(ts time.Time) time.Duration {
+	var randSleep uint64
+	if g.EvalOffset != nil {
+		randSleep = uint64(*g.EvalOffset)
+	} else {
+		randSleep = uint64(float64(g.Interval) * (float64(uint32(g.ID())) / (1 << 32)))
+	}
+	sleepOffset := uint64(ts.UnixNano()) % uint64(g.Interval)
+	if randSleep < sleepOffset {
+		randSleep += uint64(g.Interval)
+	}
+	randSleep -= sleepOffset
+	return time.Duration(randSleep)
+}
+
+func (g *Group) evalOffsetString() string {
+	if g.EvalOffset == nil {
+		return ""
+	}
+	return fmt.Sprintf("; eval_offset=%v", *g.EvalOffset)
+}
+
+func equalDurationPtrs(a, b *time.Duration) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 type executor struct {
 	querier   datasource.Querier
 	notifiers []notifier.Notifier
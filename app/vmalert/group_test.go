@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"testing"
 	"time"
@@ -211,3 +212,93 @@ func TestGroupStart(t *testing.T) {
 	g.close()
 	<-finished
 }
+
+func TestGroupUpdateDuringStartDelay(t *testing.T) {
+	// Enable the delay before the first evaluation.
+	skipRandSleepOnGroupStart = false
+	defer func() {
+		skipRandSleepOnGroupStart = true
+	}()
+
+	newTestGroup := func(evalOffset time.Duration) *Group {
+		return newGroup(config.Group{
+			Name:       "test",
+			Interval:   time.Hour,
+			EvalOffset: &evalOffset,
+			Rules:      []config.Rule{{Record: "foo", Expr: "bar"}},
+		}, time.Minute, nil)
+	}
+	// Choose eval_offset, which results in the delay close to the interval.
+	evalOffset := time.Duration(time.Now().UnixNano())%time.Hour - time.Minute
+	if evalOffset < 0 {
+		evalOffset += time.Hour
+	}
+	g := newTestGroup(evalOffset)
+	finished := make(chan struct{})
+	go func() {
+		g.start(context.Background(), &fakeQuerier{}, nil, nil)
+		close(finished)
+	}()
+
+	// Updates must be accepted while the group waits for the first evaluation or for the alignment to the new eval_offset.
+	for i := 0; i < 3; i++ {
+		select {
+		case g.updateCh <- newTestGroup(evalOffset + time.Duration(i)*time.Second):
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout when updating the group #%d", i)
+		}
+	}
+
+	g.close()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when stopping the group")
+	}
+}
+
+func TestGroupDelayBeforeStart(t *testing.T) {
+	f := func(interval time.Duration, evalOffset *time.Duration, ts time.Time, delayExpected time.Duration) {
+		t.Helper()
+		g := newGroup(config.Group{
+			Name:       "test",
+			Interval:   interval,
+			EvalOffset: evalOffset,
+			Rules:      []config.Rule{{Record: "foo", Expr: "bar"}},
+		}, time.Minute, nil)
+		delay := g.delayBeforeStart(ts)
+		if delay != delayExpected {
+			t.Fatalf("unexpected delay; got %s; want %s", delay, delayExpected)
+		}
+	}
+	offset := func(d time.Duration) *time.Duration {
+		return &d
+	}
+	ts := time.Unix(1600000000, 0)
+
+	// 1600000000 % 60 = 40
+	f(time.Minute, offset(0), ts, 20*time.Second)
+	f(time.Minute, offset(30*time.Second), ts, 50*time.Second)
+	f(time.Minute, offset(40*time.Second), ts, 0)
+	f(time.Minute, offset(50*time.Second), ts, 10*time.Second)
+	f(time.Minute, offset(time.Second), ts.Add(500*time.Millisecond), 20*time.Second+500*time.Millisecond)
+
+	// eval_offset exceeding the interval
+	f(time.Minute, offset(90*time.Second), ts, 50*time.Second)
+
+	// 1600000000 % 3600 = 1600
+	f(time.Hour, offset(30*time.Minute), ts, 200*time.Second)
+
+	// the delay without eval_offset must be smaller than interval
+	for i := 0; i < 10; i++ {
+		g := newGroup(config.Group{
+			Name:     fmt.Sprintf("group-%d", i),
+			Interval: time.Minute,
+			Rules:    []config.Rule{{Record: "foo", Expr: "bar"}},
+		}, time.Minute, nil)
+		delay := g.delayBeforeStart(ts)
+		if delay < 0 || delay >= time.Minute {
+			t.Fatalf("unexpected delay for group %q: %s", g.Name, delay)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remoteread"
@@ -39,6 +40,9 @@ Rule files may contain %{ENV_VAR} placeholders, which are substituted by the cor
 
 	validateTemplates   = flag.Bool("rule.validateTemplates", true, "Whether to validate annotation and label templates")
 	validateExpressions = flag.Bool("rule.validateExpressions", true, "Whether to validate rules expressions via MetricsQL engine")
+	checkCompatibility  = flag.Bool("rule.checkCompatibility", false, "Whether to print rules expressions from -rule files, which may return different results "+
+		"in MetricsQL comparing to Prometheus, and exit. The exit code is non-zero if such expressions are found. "+
+		"This may be useful when migrating Prometheus rules to vmalert")
 	externalURL         = flag.String("external.url", "", "External URL is used as alert's source for sent alerts to the notifier")
 	externalAlertSource = flag.String("external.alert.source", "", `External Alert Source allows to override the Source link for alerts sent to AlertManager for cases where you want to build a custom link to Grafana, Prometheus or any other service.
 eg. 'explore?orgId=1&left=[\"now-1h\",\"now\",\"VictoriaMetrics\",{\"expr\": \"{{$expr|quotesEscape|pathEscape}}\"},{\"mode\":\"Metrics\"},{\"ui\":[true,true,true,\"none\"]}]'.If empty '/api/v1/:groupID/alertID/status' is used`)
@@ -58,6 +62,16 @@ func main() {
 	logger.Init()
 	cgroup.UpdateGOMAXPROCSToCPUQuota()
 
+	if *checkCompatibility {
+		os.Exit(checkRulesCompatibility())
+	}
+	if *replayFrom != "" || *replayTo != "" {
+		if err := replayRules(); err != nil {
+			logger.Fatalf("replay failed: %s", err)
+		}
+		return
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	manager, err := newManager(ctx)
 	if err != nil {
@@ -107,6 +121,30 @@ var (
 	configTimestamp    = metrics.NewCounter(`vmalert_config_last_reload_success_timestamp_seconds`)
 )
 
+// checkRulesCompatibility prints rules expressions, which behave differently in MetricsQL, and returns the exit code for vmalert.
+func checkRulesCompatibility() int {
+	// Templates are not validated, since only expressions are checked.
+	groups, err := config.Parse(*rulePath, false, true)
+	if err != nil {
+		logger.Errorf("cannot parse rules: %s", err)
+		return 1
+	}
+	issues, err := config.CheckCompatibility(groups)
+	if err != nil {
+		logger.Errorf("cannot check rules compatibility: %s", err)
+		return 1
+	}
+	for i := range issues {
+		fmt.Println(issues[i].String())
+	}
+	if len(issues) > 0 {
+		logger.Infof("found %d expressions in %d groups, which may return different results in MetricsQL comparing to Prometheus", len(issues), len(groups))
+		return 1
+	}
+	logger.Infof("all the expressions in %d groups are compatible with Prometheus", len(groups))
+	return 0
+}
+
 func newManager(ctx context.Context) (*manager, error) {
 	q, err := datasource.Init()
 	if err != nil {
@@ -130,7 +168,6 @@ func newManager(ctx context.Context) (*manager, error) {
 		groups:    make(map[uint64]*Group),
 		querier:   q,
 		notifiers: nts,
-		labels:    map[string]string{},
 	}
 	rw, err := remotewrite.Init(ctx)
 	if err != nil {
@@ -144,14 +181,25 @@ func newManager(ctx context.Context) (*manager, error) {
 	}
 	manager.rr = rr
 
+	labels, err := parseExternalLabels()
+	if err != nil {
+		return nil, err
+	}
+	manager.labels = labels
+	return manager, nil
+}
+
+// parseExternalLabels returns labels from -external.label flags.
+func parseExternalLabels() (map[string]string, error) {
+	labels := map[string]string{}
 	for _, s := range *externalLabels {
 		n := strings.IndexByte(s, '=')
 		if n < 0 {
 			return nil, fmt.Errorf("missing '=' in `-label`. It must contain label in the form `name=value`; got %q", s)
 		}
-		manager.labels[s[:n]] = s[n+1:]
+		labels[s[:n]] = s[n+1:]
 	}
-	return manager, nil
+	return labels, nil
 }
 
 func getExternalURL(externalURL, httpListenAddr string, isSecure bool) (*url.URL, error) {
@@ -124,6 +124,9 @@ func (g *Group) toAPI() APIGroup {
 		Interval:    g.Interval.String(),
 		Concurrency: g.Concurrency,
 	}
+	if g.EvalOffset != nil {
+		ag.EvalOffset = g.EvalOffset.String()
+	}
 	for _, r := range g.Rules {
 		switch v := r.(type) {
 		case *AlertingRule:
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/utils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 )
 
 // Alert the triggered alert
@@ -107,3 +110,50 @@ func templateAnnotation(dst io.Writer, text string, data alertTplData) error {
 	}
 	return nil
 }
+
+// alertNameLabel is the label holding alert name
+// during the relabeling.
+const alertNameLabel = "alertname"
+
+// relabelAlerts applies prcs to labels of alerts, including the alert name,
+// and returns the resulting alerts. Alerts without labels after the relabeling are dropped.
+//
+// alerts aren't modified, since they may be shared among notifiers.
+func relabelAlerts(alerts []Alert, prcs []promrelabel.ParsedRelabelConfig) []Alert {
+	var labels []prompbmarshal.Label
+	result := make([]Alert, 0, len(alerts))
+	for _, a := range alerts {
+		labels = append(labels[:0], prompbmarshal.Label{
+			Name:  alertNameLabel,
+			Value: a.Name,
+		})
+		keys := make([]string, 0, len(a.Labels))
+		for k := range a.Labels {
+			if k != alertNameLabel {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			labels = append(labels, prompbmarshal.Label{
+				Name:  k,
+				Value: a.Labels[k],
+			})
+		}
+		labels = promrelabel.ApplyRelabelConfigs(labels, 0, prcs, false)
+		if len(labels) == 0 {
+			continue
+		}
+		a.Name = ""
+		a.Labels = make(map[string]string, len(labels))
+		for _, label := range labels {
+			if label.Name == alertNameLabel {
+				a.Name = label.Value
+				continue
+			}
+			a.Labels[label.Name] = label.Value
+		}
+		result = append(result, a)
+	}
+	return result
+}
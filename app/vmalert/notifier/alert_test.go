@@ -1,7 +1,11 @@
 package notifier
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"gopkg.in/yaml.v2"
 )
 
 func TestAlert_ExecTemplate(t *testing.T) {
@@ -80,3 +84,97 @@ func TestAlert_ExecTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestRelabelAlerts(t *testing.T) {
+	f := func(config string, alerts, alertsExpected []Alert) {
+		t.Helper()
+		var rcs []promrelabel.RelabelConfig
+		if err := yaml.UnmarshalStrict([]byte(config), &rcs); err != nil {
+			t.Fatalf("cannot unmarshal relabel configs: %s", err)
+		}
+		prcs, err := promrelabel.ParseRelabelConfigs(nil, rcs)
+		if err != nil {
+			t.Fatalf("cannot parse relabel configs: %s", err)
+		}
+		result := relabelAlerts(alerts, prcs)
+		if len(result) == 0 && len(alertsExpected) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(result, alertsExpected) {
+			t.Fatalf("unexpected alerts;\ngot\n%+v\nwant\n%+v", result, alertsExpected)
+		}
+	}
+
+	alerts := []Alert{
+		{
+			ID:     1,
+			Name:   "HighLatency",
+			Labels: map[string]string{"env": "dev", "instance": "foo:80"},
+		},
+		{
+			ID:     2,
+			Name:   "DiskFull",
+			Labels: map[string]string{"env": "prod", "instance": "bar:80"},
+		},
+	}
+
+	// drop alerts by label
+	f(`
+- action: drop
+  source_labels: [env]
+  regex: dev
+`, alerts, []Alert{
+		{
+			ID:     2,
+			Name:   "DiskFull",
+			Labels: map[string]string{"env": "prod", "instance": "bar:80"},
+		},
+	})
+
+	// drop alerts by name
+	f(`
+- action: keep
+  source_labels: [alertname]
+  regex: High.+
+`, alerts, []Alert{
+		{
+			ID:     1,
+			Name:   "HighLatency",
+			Labels: map[string]string{"env": "dev", "instance": "foo:80"},
+		},
+	})
+
+	// drop all the alerts
+	f(`
+- action: drop
+  regex: .*
+  source_labels: [alertname]
+`, alerts, nil)
+
+	// modify labels and the alert name
+	f(`
+- action: labeldrop
+  regex: instance
+- target_label: alertname
+  source_labels: [alertname, env]
+  separator: "_"
+- target_label: team
+  replacement: ops
+`, alerts, []Alert{
+		{
+			ID:     1,
+			Name:   "HighLatency_dev",
+			Labels: map[string]string{"env": "dev", "team": "ops"},
+		},
+		{
+			ID:     2,
+			Name:   "DiskFull_prod",
+			Labels: map[string]string{"env": "prod", "team": "ops"},
+		},
+	})
+
+	// source alerts must remain unchanged
+	if alerts[0].Name != "HighLatency" || len(alerts[0].Labels) != 2 || alerts[0].Labels["instance"] != "foo:80" {
+		t.Fatalf("unexpected modification of the source alert: %+v", alerts[0])
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 )
 
 // AlertManager represents integration provider with Prometheus alert manager
@@ -17,10 +19,20 @@ type AlertManager struct {
 	basicAuthPass string
 	argFunc       AlertURLGenerator
 	client        *http.Client
+
+	// relabelConfigs are applied to alert labels before sending alerts
+	relabelConfigs []promrelabel.ParsedRelabelConfig
 }
 
 // Send an alert or resolve message
 func (am *AlertManager) Send(ctx context.Context, alerts []Alert) error {
+	if len(am.relabelConfigs) > 0 && len(alerts) > 0 {
+		alerts = relabelAlerts(alerts, am.relabelConfigs)
+		if len(alerts) == 0 {
+			// All the alerts have been dropped by relabeling.
+			return nil
+		}
+	}
 	b := &bytes.Buffer{}
 	writeamRequest(b, alerts, am.argFunc)
 
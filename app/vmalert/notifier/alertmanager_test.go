@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"testing"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 )
 
 func TestAlertManager_Send(t *testing.T) {
@@ -85,6 +87,18 @@ func TestAlertManager_Send(t *testing.T) {
 	}}); err != nil {
 		t.Errorf("unexpected error %s", err)
 	}
+	// alerts dropped by relabeling mustn't be sent
+	prcs, err := promrelabel.ParseRelabelConfigs(nil, []promrelabel.RelabelConfig{{
+		Action:       "drop",
+		SourceLabels: []string{"alertname"},
+	}})
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+	am.relabelConfigs = prcs
+	if err := am.Send(context.Background(), []Alert{{Name: "alert0"}}); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
 	if c != 2 {
 		t.Errorf("expected 2 calls(count from zero) to server got %d", c)
 	}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/utils"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 )
 
 var (
@@ -21,6 +22,10 @@ var (
 		"By default system CA is used")
 	tlsServerName = flagutil.NewArray("notifier.tlsServerName", "Optional TLS server name to use for connections to -notifier.url. "+
 		"By default the server name from -notifier.url is used")
+
+	alertRelabelConfig = flag.String("notifier.alertRelabelConfig", "", "Optional path to a file with relabeling rules, which are applied to alert labels "+
+		"before sending alerts to -notifier.url. See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#alert_relabel_configs . "+
+		"Labels from -external.label are already added to alerts at this stage. Alerts without labels after the relabeling are dropped")
 )
 
 // Init creates a Notifier object based on provided flags.
@@ -30,6 +35,15 @@ func Init(gen AlertURLGenerator) ([]Notifier, error) {
 		return nil, fmt.Errorf("at least one `-notifier.url` must be set")
 	}
 
+	var relabelConfigs []promrelabel.ParsedRelabelConfig
+	if *alertRelabelConfig != "" {
+		prcs, err := promrelabel.LoadRelabelConfigs(*alertRelabelConfig)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load -notifier.alertRelabelConfig=%q: %w", *alertRelabelConfig, err)
+		}
+		relabelConfigs = prcs
+	}
+
 	var notifiers []Notifier
 	for i, addr := range *addrs {
 		cert, key := tlsCertFile.GetOptionalArg(i), tlsKeyFile.GetOptionalArg(i)
@@ -40,6 +54,7 @@ func Init(gen AlertURLGenerator) ([]Notifier, error) {
 		}
 		user, pass := basicAuthUsername.GetOptionalArg(i), basicAuthPassword.GetOptionalArg(i)
 		am := NewAlertManager(addr, user, pass, gen, &http.Client{Transport: tr})
+		am.relabelConfigs = relabelConfigs
 		notifiers = append(notifiers, am)
 	}
 
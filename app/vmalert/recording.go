@@ -113,6 +113,35 @@ func (rr *RecordingRule) Exec(ctx context.Context, q datasource.Querier, series
 	return tss, nil
 }
 
+// ExecRange executes RecordingRule expression via the given RangeQuerier
+// on the time range from start to end with the given step.
+// It doesn't update the rule state, since it is used for replaying the rule on historical data.
+func (rr *RecordingRule) ExecRange(ctx context.Context, q datasource.RangeQuerier, start, end time.Time, step time.Duration) ([]prompbmarshal.TimeSeries, error) {
+	qMetrics, err := q.QueryRange(ctx, rr.Expr, start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query %q: %w", rr.Expr, err)
+	}
+	type seriesKey struct {
+		hash      uint64
+		timestamp int64
+	}
+	duplicates := make(map[seriesKey]struct{}, len(qMetrics))
+	var tss []prompbmarshal.TimeSeries
+	for _, r := range qMetrics {
+		ts := rr.toTimeSeries(r, time.Unix(r.Timestamp, 0))
+		key := seriesKey{
+			hash:      hashTimeSeries(ts),
+			timestamp: r.Timestamp,
+		}
+		if _, ok := duplicates[key]; ok {
+			return nil, errDuplicate
+		}
+		duplicates[key] = struct{}{}
+		tss = append(tss, ts)
+	}
+	return tss, nil
+}
+
 func hashTimeSeries(ts prompbmarshal.TimeSeries) uint64 {
 	hash := fnv.New64a()
 	labels := ts.Labels
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+var (
+	replayFrom = flag.String("replay.timeFrom", "", "The time filter in RFC3339 format to start the replay from. E.g. '2020-01-01T20:07:00Z'. "+
+		"If set, vmalert evaluates recording rules from -rule files on the time range from -replay.timeFrom to -replay.timeTo, "+
+		"writes the results to -remoteWrite.url and exits")
+	replayTo = flag.String("replay.timeTo", "", "The time filter in RFC3339 format to finish the replay by. E.g. '2020-01-01T20:07:00Z'. "+
+		"By default the current time is used")
+	replayStep          = flag.Duration("replay.step", 0, "The interval between evaluations during the replay. By default the interval of every group is used")
+	replayMaxDatapoints = flag.Int("replay.maxDatapointsPerQuery", 1e3, "The maximum number of data points expected in one range query during the replay. "+
+		"The replay time range is split into smaller ranges according to this limit")
+	replayRulesDelay = flag.Duration("replay.rulesDelay", time.Second, "Delay between rules evaluations during the replay. "+
+		"It may be used for reducing the load on the datasource")
+)
+
+// remoteWriter is used for writing time series during the replay.
+type remoteWriter interface {
+	Push(ts prompbmarshal.TimeSeries) error
+}
+
+// replayRules evaluates recording rules from -rule files on the time range from -replay.timeFrom to -replay.timeTo
+// and writes the results to -remoteWrite.url.
+func replayRules() error {
+	start, end, err := parseReplayTimeRange(*replayFrom, *replayTo)
+	if err != nil {
+		return err
+	}
+	groups, err := config.Parse(*rulePath, *validateTemplates, *validateExpressions)
+	if err != nil {
+		return fmt.Errorf("cannot parse rules: %w", err)
+	}
+	q, err := datasource.Init()
+	if err != nil {
+		return fmt.Errorf("failed to init datasource: %w", err)
+	}
+	rq, ok := q.(datasource.RangeQuerier)
+	if !ok {
+		return fmt.Errorf("datasource doesn't support range queries")
+	}
+	rw, err := remotewrite.Init(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to init remoteWrite: %w", err)
+	}
+	if rw == nil {
+		return fmt.Errorf("-remoteWrite.url must be set in replay mode")
+	}
+	labels, err := parseExternalLabels()
+	if err != nil {
+		return err
+	}
+	logger.Infof("replaying %d groups on the time range %s - %s", len(groups), start.Format(time.RFC3339), end.Format(time.RFC3339))
+	total := 0
+	for _, cfg := range groups {
+		g := newGroup(cfg, *evaluationInterval, labels)
+		n, err := g.replay(context.Background(), start, end, *replayStep, *replayMaxDatapoints, rq, rw)
+		if err != nil {
+			_ = rw.Close()
+			return fmt.Errorf("cannot replay group %q: %w", g.Name, err)
+		}
+		total += n
+	}
+	// Close flushes the pending time series to -remoteWrite.url.
+	if err := rw.Close(); err != nil {
+		return fmt.Errorf("cannot close remoteWrite client: %w", err)
+	}
+	logger.Infof("replay finished; %d samples written to -remoteWrite.url", total)
+	return nil
+}
+
+func parseReplayTimeRange(from, to string) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("cannot parse -replay.timeFrom=%q: %w", from, err)
+	}
+	end := time.Now()
+	if to != "" {
+		end, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("cannot parse -replay.timeTo=%q: %w", to, err)
+		}
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("-replay.timeFrom=%q must be smaller than -replay.timeTo=%q", from, end.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
+
+// replay evaluates recording rules of g on the time range from start to end with the given step
+// and pushes the results to rw. It returns the number of pushed samples.
+//
+// The time range is split into smaller ranges, so every range query returns up to maxDatapoints points per series.
+// Alerting rules are skipped.
+func (g *Group) replay(ctx context.Context, start, end time.Time, step time.Duration, maxDatapoints int, rq datasource.RangeQuerier, rw remoteWriter) (int, error) {
+	if step <= 0 {
+		step = g.Interval
+	}
+	if maxDatapoints < 1 {
+		maxDatapoints = 1
+	}
+	total := 0
+	for _, rule := range g.Rules {
+		rr, ok := rule.(*RecordingRule)
+		if !ok {
+			logger.Infof("skipping alerting rule %q in group %q, since only recording rules are replayed", rule, g.Name)
+			continue
+		}
+		n := 0
+		for _, r := range getReplayRanges(start, end, step, maxDatapoints) {
+			tss, err := rr.ExecRange(ctx, rq, r.start, r.end, step)
+			if err != nil {
+				return total, fmt.Errorf("cannot evaluate rule %q on the time range %s - %s: %w",
+					rr.Name, r.start.Format(time.RFC3339), r.end.Format(time.RFC3339), err)
+			}
+			for _, ts := range tss {
+				if err := pushWithRetries(rw, ts); err != nil {
+					return total, err
+				}
+				n += len(ts.Samples)
+			}
+			if *replayRulesDelay > 0 {
+				time.Sleep(*replayRulesDelay)
+			}
+		}
+		logger.Infof("replayed rule %q in group %q; %d samples written", rr.Name, g.Name, n)
+		total += n
+	}
+	return total, nil
+}
+
+// pushWithRetries pushes ts to rw with retries, since rw may have full queue during the replay.
+func pushWithRetries(rw remoteWriter, ts prompbmarshal.TimeSeries) error {
+	const attempts = 30
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = rw.Push(ts); err == nil {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("cannot push time series after %d attempts: %w", attempts, err)
+}
+
+type replayRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// getReplayRanges splits the time range from start to end into non-overlapping ranges with up to maxDatapoints points each.
+func getReplayRanges(start, end time.Time, step time.Duration, maxDatapoints int) []replayRange {
+	var rs []replayRange
+	rangeLen := step * time.Duration(maxDatapoints-1)
+	for !start.After(end) {
+		rEnd := start.Add(rangeLen)
+		if rEnd.After(end) {
+			rEnd = end
+		}
+		rs = append(rs, replayRange{
+			start: start,
+			end:   rEnd,
+		})
+		start = rEnd.Add(step)
+	}
+	return rs
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+type fakeRangeQuerier struct {
+	sync.Mutex
+	ranges [][2]int64
+}
+
+// QueryRange returns a single data point per step with the value equal to the timestamp.
+func (fq *fakeRangeQuerier) QueryRange(_ context.Context, _ string, start, end time.Time, step time.Duration) ([]datasource.Metric, error) {
+	fq.Lock()
+	fq.ranges = append(fq.ranges, [2]int64{start.Unix(), end.Unix()})
+	fq.Unlock()
+	var ms []datasource.Metric
+	for t := start; !t.After(end); t = t.Add(step) {
+		ms = append(ms, datasource.Metric{
+			Labels:    []datasource.Label{{Name: "job", Value: "foo"}},
+			Timestamp: t.Unix(),
+			Value:     float64(t.Unix()),
+		})
+	}
+	return ms, nil
+}
+
+type fakeRemoteWriter struct {
+	tss []prompbmarshal.TimeSeries
+}
+
+func (fw *fakeRemoteWriter) Push(ts prompbmarshal.TimeSeries) error {
+	fw.tss = append(fw.tss, ts)
+	return nil
+}
+
+func TestGetReplayRanges(t *testing.T) {
+	f := func(start, end int64, step time.Duration, maxDatapoints int, rangesExpected [][2]int64) {
+		t.Helper()
+		rs := getReplayRanges(time.Unix(start, 0), time.Unix(end, 0), step, maxDatapoints)
+		var ranges [][2]int64
+		for _, r := range rs {
+			ranges = append(ranges, [2]int64{r.start.Unix(), r.end.Unix()})
+		}
+		if !reflect.DeepEqual(ranges, rangesExpected) {
+			t.Fatalf("unexpected ranges;\ngot\n%v\nwant\n%v", ranges, rangesExpected)
+		}
+	}
+	f(0, 100, 10*time.Second, 100, [][2]int64{{0, 100}})
+	f(0, 100, 10*time.Second, 5, [][2]int64{{0, 40}, {50, 90}, {100, 100}})
+	f(0, 95, 10*time.Second, 5, [][2]int64{{0, 40}, {50, 90}})
+	f(0, 100, 10*time.Second, 1, [][2]int64{{0, 0}, {10, 10}, {20, 20}, {30, 30}, {40, 40}, {50, 50}, {60, 60}, {70, 70}, {80, 80}, {90, 90}, {100, 100}})
+}
+
+func TestGroupReplay(t *testing.T) {
+	defer func(d time.Duration) {
+		*replayRulesDelay = d
+	}(*replayRulesDelay)
+	*replayRulesDelay = 0
+
+	g := newGroup(config.Group{
+		Name:     "replay",
+		Interval: 10 * time.Second,
+		Rules: []config.Rule{
+			{
+				Record: "job:foo",
+				Expr:   "sum(foo) by (job)",
+				Labels: map[string]string{"source": "replay"},
+			},
+			{
+				Alert: "FooAlert",
+				Expr:  "foo > 0",
+			},
+		},
+	}, time.Minute, map[string]string{"env": "test"})
+
+	fq := &fakeRangeQuerier{}
+	fw := &fakeRemoteWriter{}
+	n, err := g.replay(context.Background(), time.Unix(0, 0), time.Unix(100, 0), 0, 5, fq, fw)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 11 {
+		t.Fatalf("unexpected number of samples; got %d; want 11", n)
+	}
+	if samples := getSamplesCount(fw.tss); samples != n {
+		t.Fatalf("unexpected number of pushed samples; got %d; want %d", samples, n)
+	}
+	rangesExpected := [][2]int64{{0, 40}, {50, 90}, {100, 100}}
+	if !reflect.DeepEqual(fq.ranges, rangesExpected) {
+		t.Fatalf("unexpected query ranges;\ngot\n%v\nwant\n%v", fq.ranges, rangesExpected)
+	}
+	for i, ts := range fw.tss {
+		tsExpected := newTimeSeries(float64(i*10), map[string]string{
+			"__name__": "job:foo",
+			"job":      "foo",
+			"source":   "replay",
+			"env":      "test",
+		}, time.Unix(int64(i*10), 0))
+		if !reflect.DeepEqual(ts, tsExpected) {
+			t.Fatalf("unexpected time series #%d;\ngot\n%+v\nwant\n%+v", i, ts, tsExpected)
+		}
+	}
+
+	// Custom step
+	fq = &fakeRangeQuerier{}
+	fw = &fakeRemoteWriter{}
+	n, err = g.replay(context.Background(), time.Unix(0, 0), time.Unix(100, 0), 50*time.Second, 5, fq, fw)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("unexpected number of samples; got %d; want 3", n)
+	}
+	if samples := getSamplesCount(fw.tss); samples != n {
+		t.Fatalf("unexpected number of pushed samples; got %d; want %d", samples, n)
+	}
+}
+
+func getSamplesCount(tss []prompbmarshal.TimeSeries) int {
+	n := 0
+	for _, ts := range tss {
+		n += len(ts.Samples)
+	}
+	return n
+}
+
+func TestParseReplayTimeRange(t *testing.T) {
+	start, end, err := parseReplayTimeRange("2020-01-01T00:00:00Z", "2020-01-02T00:00:00Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if end.Sub(start) != 24*time.Hour {
+		t.Fatalf("unexpected time range: %s - %s", start, end)
+	}
+	if _, end, err = parseReplayTimeRange("2020-01-01T00:00:00Z", ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if time.Since(end) > time.Minute {
+		t.Fatalf("expecting the current time as the end of the range; got %s", end)
+	}
+
+	f := func(from, to string) {
+		t.Helper()
+		if _, _, err := parseReplayTimeRange(from, to); err == nil {
+			t.Fatalf("expecting non-nil error for from=%q, to=%q", from, to)
+		}
+	}
+	f("", "")
+	f("foo", "")
+	f("2020-01-01T00:00:00Z", "bar")
+	f("2020-01-02T00:00:00Z", "2020-01-01T00:00:00Z")
+	f("2020-01-01T00:00:00Z", "2020-01-01T00:00:00Z")
+}
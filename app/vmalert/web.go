@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auditlog"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
@@ -54,6 +55,7 @@ func (rh *requestHandler) handler(w http.ResponseWriter, r *http.Request) bool {
 		return true
 	case "/-/reload":
 		logger.Infof("api config reload was called, sending sighup")
+		auditlog.LogRequest(r, "config_reload", nil)
 		procutil.SelfSIGHUP()
 		w.WriteHeader(http.StatusOK)
 		return true
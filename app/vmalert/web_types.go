@@ -25,6 +25,7 @@ type APIGroup struct {
 	File           string             `json:"file"`
 	Interval       string             `json:"interval"`
 	Concurrency    int                `json:"concurrency"`
+	EvalOffset     string             `json:"eval_offset,omitempty"`
 	AlertingRules  []APIAlertingRule  `json:"alerting_rules"`
 	RecordingRules []APIRecordingRule `json:"recording_rules"`
 }
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"path"
+	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
@@ -19,6 +23,8 @@ import (
 var (
 	authConfigPath = flag.String("auth.config", "", "Path to auth config. See https://github.com/VictoriaMetrics/VictoriaMetrics/blob/master/app/vmauth/README.md "+
 		"for details on the format of this auth config")
+	configCheckInterval = flag.Duration("configCheckInterval", 0, "Interval for checking for changes in -auth.config file. "+
+		"By default the checking is disabled. Send SIGHUP signal in order to force config check for changes")
 )
 
 // AuthConfig represents auth config.
@@ -28,22 +34,78 @@ type AuthConfig struct {
 
 // UserInfo is user information read from authConfigPath
 type UserInfo struct {
-	Username  string `yaml:"username"`
-	Password  string `yaml:"password"`
-	URLPrefix string `yaml:"url_prefix"`
+	Username              string   `yaml:"username"`
+	Password              string   `yaml:"password"`
+	BearerToken           string   `yaml:"bearer_token"`
+	URLPrefix             string   `yaml:"url_prefix"`
+	URLMap                []URLMap `yaml:"url_map"`
+	MaxConcurrentRequests int      `yaml:"max_concurrent_requests"`
 
-	requests *metrics.Counter
+	concurrencyLimitCh      chan struct{}
+	requests                *metrics.Counter
+	concurrencyLimitReached *metrics.Counter
+}
+
+// URLMap is a mapping from source paths to target url prefix.
+type URLMap struct {
+	SrcPaths  []string `yaml:"src_paths"`
+	URLPrefix string   `yaml:"url_prefix"`
+
+	srcPathRes []*regexp.Regexp
+}
+
+// getURLPrefix returns url prefix for the given u.
+//
+// The first url_map entry with matching src_paths is used. Otherwise url_prefix is used.
+// An empty string is returned if u doesn't match any route for ui.
+func (ui *UserInfo) getURLPrefix(u *url.URL) string {
+	p := path.Clean(u.Path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	for _, um := range ui.URLMap {
+		for _, re := range um.srcPathRes {
+			if re.MatchString(p) {
+				return um.URLPrefix
+			}
+		}
+	}
+	return ui.URLPrefix
+}
+
+// beginConcurrencyLimit reserves a slot for a request from ui.
+//
+// It returns false if the number of concurrent requests from ui reaches max_concurrent_requests.
+// endConcurrencyLimit must be called after the request is processed if true is returned.
+func (ui *UserInfo) beginConcurrencyLimit() bool {
+	if ui.concurrencyLimitCh == nil {
+		return true
+	}
+	select {
+	case ui.concurrencyLimitCh <- struct{}{}:
+		return true
+	default:
+		ui.concurrencyLimitReached.Inc()
+		return false
+	}
+}
+
+func (ui *UserInfo) endConcurrencyLimit() {
+	if ui.concurrencyLimitCh != nil {
+		<-ui.concurrencyLimitCh
+	}
 }
 
 func initAuthConfig() {
 	if len(*authConfigPath) == 0 {
 		logger.Fatalf("missing required `-auth.config` command-line flag")
 	}
-	m, err := readAuthConfig(*authConfigPath)
+	m, data, err := readAuthConfig(*authConfigPath)
 	if err != nil {
 		logger.Fatalf("cannot load auth config from `-auth.config=%s`: %s", *authConfigPath, err)
 	}
 	authConfig.Store(m)
+	authConfigData = data
 	stopCh = make(chan struct{})
 	authConfigWG.Add(1)
 	go func() {
@@ -59,40 +121,71 @@ func stopAuthConfig() {
 
 func authConfigReloader() {
 	sighupCh := procutil.NewSighupChan()
+
+	var tickerCh <-chan time.Time
+	if *configCheckInterval > 0 {
+		ticker := time.NewTicker(*configCheckInterval)
+		tickerCh = ticker.C
+		defer ticker.Stop()
+	}
 	for {
 		select {
 		case <-stopCh:
 			return
 		case <-sighupCh:
 			logger.Infof("SIGHUP received; loading -auth.config=%q", *authConfigPath)
-			m, err := readAuthConfig(*authConfigPath)
-			if err != nil {
-				logger.Errorf("failed to load -auth.config=%q; using the last successfully loaded config; error: %s", *authConfigPath, err)
-				continue
-			}
-			authConfig.Store(m)
-			logger.Infof("Successfully reloaded -auth.config=%q", *authConfigPath)
+		case <-tickerCh:
 		}
+		data, err := ioutil.ReadFile(*authConfigPath)
+		if err != nil {
+			logger.Errorf("failed to read -auth.config=%q; using the last successfully loaded config; error: %s", *authConfigPath, err)
+			continue
+		}
+		if bytes.Equal(data, authConfigData) {
+			// Nothing changed since the previous load.
+			continue
+		}
+		m, err := parseAuthConfig(data)
+		if err != nil {
+			logger.Errorf("failed to load -auth.config=%q; using the last successfully loaded config; error: %s", *authConfigPath, err)
+			continue
+		}
+		authConfig.Store(m)
+		authConfigData = data
+		configReloads.Inc()
+		logger.Infof("Successfully reloaded -auth.config=%q with %d users", *authConfigPath, len(m))
 	}
 }
 
+// authConfig contains the currently used auth config. It holds map[string]*UserInfo returned from parseAuthConfig.
 var authConfig atomic.Value
+
+// authConfigData contains the data the currently used auth config was parsed from.
+//
+// It is accessed only by initAuthConfig and authConfigReloader.
+var authConfigData []byte
+
+var configReloads = metrics.NewCounter(`vmauth_config_reloads_total`)
+
 var authConfigWG sync.WaitGroup
 var stopCh chan struct{}
 
-func readAuthConfig(path string) (map[string]*UserInfo, error) {
+func readAuthConfig(path string) (map[string]*UserInfo, []byte, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read %q: %w", path, err)
+		return nil, nil, fmt.Errorf("cannot read %q: %w", path, err)
 	}
 	m, err := parseAuthConfig(data)
 	if err != nil {
-		return nil, fmt.Errorf("cannot parse %q: %w", path, err)
+		return nil, nil, fmt.Errorf("cannot parse %q: %w", path, err)
 	}
 	logger.Infof("Loaded information about %d users from %q", len(m), path)
-	return m, nil
+	return m, data, nil
 }
 
+// parseAuthConfig parses auth config from data.
+//
+// It returns users keyed by auth tokens. See getBasicAuthToken and getBearerAuthToken.
 func parseAuthConfig(data []byte) (map[string]*UserInfo, error) {
 	data = envtemplate.Replace(data)
 	var ac AuthConfig
@@ -104,28 +197,86 @@ func parseAuthConfig(data []byte) (map[string]*UserInfo, error) {
 		return nil, fmt.Errorf("`users` section cannot be empty in AuthConfig")
 	}
 	m := make(map[string]*UserInfo, len(uis))
+	usernames := make(map[string]bool, len(uis))
 	for i := range uis {
 		ui := &uis[i]
-		if m[ui.Username] != nil {
+		if usernames[ui.Username] {
 			return nil, fmt.Errorf("duplicate username found; username: %q", ui.Username)
 		}
-		urlPrefix := ui.URLPrefix
-		// Remove trailing '/' from urlPrefix
-		for strings.HasSuffix(urlPrefix, "/") {
-			urlPrefix = urlPrefix[:len(urlPrefix)-1]
+		usernames[ui.Username] = true
+		authToken := getBasicAuthToken(ui.Username)
+		if len(ui.BearerToken) > 0 {
+			if len(ui.Password) > 0 {
+				return nil, fmt.Errorf("`password` cannot be set together with `bearer_token` for username %q", ui.Username)
+			}
+			authToken = getBearerAuthToken(ui.BearerToken)
+			if m[authToken] != nil {
+				return nil, fmt.Errorf("duplicate bearer_token found for username %q", ui.Username)
+			}
 		}
-		// Validate urlPrefix
-		target, err := url.Parse(urlPrefix)
-		if err != nil {
-			return nil, fmt.Errorf("invalid `url_prefix: %q`: %w", urlPrefix, err)
+		if len(ui.URLPrefix) == 0 && len(ui.URLMap) == 0 {
+			return nil, fmt.Errorf("missing `url_prefix` and `url_map` for username %q; at least one of them must be set", ui.Username)
 		}
-		if target.Scheme != "http" && target.Scheme != "https" {
-			return nil, fmt.Errorf("unsupported scheme for `url_prefix: %q`: %q; must be `http` or `https`", urlPrefix, target.Scheme)
+		if len(ui.URLPrefix) > 0 {
+			urlPrefix, err := sanitizeURLPrefix(ui.URLPrefix)
+			if err != nil {
+				return nil, err
+			}
+			ui.URLPrefix = urlPrefix
+		}
+		for j := range ui.URLMap {
+			um := &ui.URLMap[j]
+			if len(um.SrcPaths) == 0 {
+				return nil, fmt.Errorf("missing `src_paths` in `url_map` for username %q", ui.Username)
+			}
+			urlPrefix, err := sanitizeURLPrefix(um.URLPrefix)
+			if err != nil {
+				return nil, err
+			}
+			um.URLPrefix = urlPrefix
+			um.srcPathRes = make([]*regexp.Regexp, 0, len(um.SrcPaths))
+			for _, srcPath := range um.SrcPaths {
+				// Anchor the regexp, so it matches the whole path.
+				re, err := regexp.Compile("^(?:" + srcPath + ")$")
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse `src_paths` item %q for username %q: %w", srcPath, ui.Username, err)
+				}
+				um.srcPathRes = append(um.srcPathRes, re)
+			}
+		}
+		if ui.MaxConcurrentRequests < 0 {
+			return nil, fmt.Errorf("`max_concurrent_requests` cannot be negative for username %q; got %d", ui.Username, ui.MaxConcurrentRequests)
+		}
+		if ui.MaxConcurrentRequests > 0 {
+			ui.concurrencyLimitCh = make(chan struct{}, ui.MaxConcurrentRequests)
 		}
-
-		ui.URLPrefix = urlPrefix
 		ui.requests = metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_user_requests_total{username=%q}`, ui.Username))
-		m[ui.Username] = ui
+		ui.concurrencyLimitReached = metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_user_concurrent_requests_limit_reached_total{username=%q}`, ui.Username))
+		m[authToken] = ui
 	}
 	return m, nil
 }
+
+func sanitizeURLPrefix(urlPrefix string) (string, error) {
+	// Remove trailing '/' from urlPrefix
+	for strings.HasSuffix(urlPrefix, "/") {
+		urlPrefix = urlPrefix[:len(urlPrefix)-1]
+	}
+	// Validate urlPrefix
+	target, err := url.Parse(urlPrefix)
+	if err != nil {
+		return "", fmt.Errorf("invalid `url_prefix: %q`: %w", urlPrefix, err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme for `url_prefix: %q`: %q; must be `http` or `https`", urlPrefix, target.Scheme)
+	}
+	return urlPrefix, nil
+}
+
+func getBasicAuthToken(username string) string {
+	return "basic:" + username
+}
+
+func getBearerAuthToken(bearerToken string) string {
+	return "bearer:" + bearerToken
+}
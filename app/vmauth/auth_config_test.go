@@ -1,6 +1,7 @@
 package main
 
 import (
+	"net/url"
 	"reflect"
 	"testing"
 )
@@ -47,6 +48,55 @@ users:
   url_prefix: //bar
 `)
 
+	// Invalid url_map
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/write"]
+`)
+	f(`
+users:
+- username: foo
+  url_map:
+  - url_prefix: http://foo.bar
+`)
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/write", "fo[o"]
+    url_prefix: http://foo.bar
+`)
+
+	// Negative max_concurrent_requests
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  max_concurrent_requests: -1
+`)
+
+	// Password together with bearer_token
+	f(`
+users:
+- username: foo
+  password: bar
+  bearer_token: baz
+  url_prefix: http://foo.bar
+`)
+
+	// Duplicate bearer tokens
+	f(`
+users:
+- username: foo
+  bearer_token: baz
+  url_prefix: http://foo.bar
+- username: bar
+  bearer_token: baz
+  url_prefix: http://foo.bar
+`)
+
 	// Duplicate users
 	f(`
 users:
@@ -79,7 +129,7 @@ users:
   password: bar
   url_prefix: http://aaa:343/bbb
 `, map[string]*UserInfo{
-		"foo": {
+		getBasicAuthToken("foo"): {
 			Username:  "foo",
 			Password:  "bar",
 			URLPrefix: "http://aaa:343/bbb",
@@ -94,19 +144,120 @@ users:
 - username: bar
   url_prefix: https://bar/x///
 `, map[string]*UserInfo{
-		"foo": {
+		getBasicAuthToken("foo"): {
 			Username:  "foo",
 			URLPrefix: "http://foo",
 		},
-		"bar": {
+		getBasicAuthToken("bar"): {
 			Username:  "bar",
 			URLPrefix: "https://bar/x",
 		},
 	})
+
+	// Bearer token with url_map and concurrency limit
+	f(`
+users:
+- username: foo
+  bearer_token: secret
+  max_concurrent_requests: 5
+  url_map:
+  - src_paths: ["/api/v1/query", "/api/v1/query_range"]
+    url_prefix: http://vmselect:8481/select/42/prometheus/
+  - src_paths: ["/api/v1/write"]
+    url_prefix: http://vminsert:8480/insert/42/prometheus
+`, map[string]*UserInfo{
+		getBearerAuthToken("secret"): {
+			Username:              "foo",
+			BearerToken:           "secret",
+			MaxConcurrentRequests: 5,
+			URLMap: []URLMap{
+				{
+					SrcPaths:  []string{"/api/v1/query", "/api/v1/query_range"},
+					URLPrefix: "http://vmselect:8481/select/42/prometheus",
+				},
+				{
+					SrcPaths:  []string{"/api/v1/write"},
+					URLPrefix: "http://vminsert:8480/insert/42/prometheus",
+				},
+			},
+		},
+	})
+}
+
+func TestUserInfoGetURLPrefix(t *testing.T) {
+	m, err := parseAuthConfig([]byte(`
+users:
+- username: foo
+  url_prefix: http://default
+  url_map:
+  - src_paths: ["/api/v1/query", "/api/v1/label/[^/]+/values"]
+    url_prefix: http://select
+  - src_paths: ["/api/v1/write"]
+    url_prefix: http://insert
+- username: bar
+  url_map:
+  - src_paths: ["/api/v1/query"]
+    url_prefix: http://select
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := func(username, requestURI, urlPrefixExpected string) {
+		t.Helper()
+		u, err := url.Parse(requestURI)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", requestURI, err)
+		}
+		ui := m[getBasicAuthToken(username)]
+		urlPrefix := ui.getURLPrefix(u)
+		if urlPrefix != urlPrefixExpected {
+			t.Fatalf("unexpected url prefix for username=%q, requestURI=%q; got %q; want %q", username, requestURI, urlPrefix, urlPrefixExpected)
+		}
+	}
+	f("foo", "/api/v1/query?query=up", "http://select")
+	f("foo", "/api/v1/label/job/values", "http://select")
+	f("foo", "/api/v1/label/job/values/foo", "http://default")
+	f("foo", "/api/v1/write", "http://insert")
+	f("foo", "/api/v1/write/../query", "http://select")
+	f("foo", "/api/v1/query_range", "http://default")
+	f("bar", "/api/v1/query", "http://select")
+	f("bar", "/api/v1/queryx", "")
+	f("bar", "/api/v1/write", "")
+	f("bar", "/../api/v1/query", "http://select")
+}
+
+func TestUserInfoConcurrencyLimit(t *testing.T) {
+	m, err := parseAuthConfig([]byte(`
+users:
+- username: foo
+  url_prefix: http://foo
+  max_concurrent_requests: 2
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ui := m[getBasicAuthToken("foo")]
+	for i := 0; i < 2; i++ {
+		if !ui.beginConcurrencyLimit() {
+			t.Fatalf("unexpected concurrency limit reached at request #%d", i)
+		}
+	}
+	if ui.beginConcurrencyLimit() {
+		t.Fatalf("expecting concurrency limit to be reached")
+	}
+	ui.endConcurrencyLimit()
+	if !ui.beginConcurrencyLimit() {
+		t.Fatalf("unexpected concurrency limit reached after the request is finished")
+	}
 }
 
 func removeMetrics(m map[string]*UserInfo) {
 	for _, info := range m {
 		info.requests = nil
+		info.concurrencyLimitReached = nil
+		info.concurrencyLimitCh = nil
+		for i := range info.URLMap {
+			info.URLMap[i].srcPathRes = nil
+		}
 	}
 }
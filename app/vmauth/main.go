@@ -7,6 +7,7 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
@@ -15,10 +16,13 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 var (
-	httpListenAddr = flag.String("httpListenAddr", ":8427", "TCP address to listen for http connections")
+	httpListenAddr        = flag.String("httpListenAddr", ":8427", "TCP address to listen for http connections")
+	maxConcurrentRequests = flag.Int("maxConcurrentRequests", 1000, "The maximum number of concurrent requests vmauth can process. Other requests are rejected with "+
+		"'429 Too Many Requests' http status code. See also max_concurrent_requests option for per-user limits in -auth.config")
 )
 
 func main() {
@@ -32,6 +36,7 @@ func main() {
 	logger.Infof("starting vmauth at %q...", *httpListenAddr)
 	startTime := time.Now()
 	initAuthConfig()
+	concurrencyLimitCh = make(chan struct{}, *maxConcurrentRequests)
 	go httpserver.Serve(*httpListenAddr, requestHandler)
 	logger.Infof("started vmauth in %.3f seconds", time.Since(startTime).Seconds())
 
@@ -49,30 +54,89 @@ func main() {
 }
 
 func requestHandler(w http.ResponseWriter, r *http.Request) bool {
-	username, password, ok := r.BasicAuth()
+	authToken, username, password, ok := getAuthToken(r)
 	if !ok {
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		http.Error(w, "missing `Authorization: Basic *` header", http.StatusUnauthorized)
+		http.Error(w, "missing `Authorization: Basic *` or `Authorization: Bearer *` header", http.StatusUnauthorized)
 		return true
 	}
 	ac := authConfig.Load().(map[string]*UserInfo)
-	info := ac[username]
-	if info == nil || info.Password != password {
-		httpserver.Errorf(w, r, "cannot find the provided username %q or password in config", username)
+	ui := ac[authToken]
+	if ui == nil || ui.Password != password {
+		if len(username) > 0 {
+			httpserver.Errorf(w, r, "cannot find the provided username %q or password in config", username)
+		} else {
+			httpserver.Errorf(w, r, "cannot find the provided bearer token in config")
+		}
 		return true
 	}
-	info.requests.Inc()
+	ui.requests.Inc()
 
-	targetURL := createTargetURL(info.URLPrefix, r.URL)
+	urlPrefix := ui.getURLPrefix(r.URL)
+	if len(urlPrefix) == 0 {
+		err := &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("username %q isn't allowed to access %q; see `url_prefix` and `url_map` in -auth.config", ui.Username, r.URL.Path),
+			StatusCode: http.StatusForbidden,
+		}
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+	targetURL := createTargetURL(urlPrefix, r.URL)
 	if _, err := url.Parse(targetURL); err != nil {
 		httpserver.Errorf(w, r, "invalid targetURL=%q: %s", targetURL, err)
 		return true
 	}
+
+	// Limit the number of concurrent requests.
+	select {
+	case concurrencyLimitCh <- struct{}{}:
+		defer func() { <-concurrencyLimitCh }()
+	default:
+		concurrencyLimitReached.Inc()
+		err := &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot serve more than -maxConcurrentRequests=%d concurrent requests", *maxConcurrentRequests),
+			StatusCode: http.StatusTooManyRequests,
+		}
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+	if !ui.beginConcurrencyLimit() {
+		err := &httpserver.ErrorWithStatusCode{
+			Err: fmt.Errorf("cannot serve more than max_concurrent_requests=%d concurrent requests for username %q",
+				ui.MaxConcurrentRequests, ui.Username),
+			StatusCode: http.StatusTooManyRequests,
+		}
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+	defer ui.endConcurrencyLimit()
+
 	r.Header.Set("vm-target-url", targetURL)
 	reverseProxy.ServeHTTP(w, r)
 	return true
 }
 
+// getAuthToken returns auth token for r, which can be used for looking up UserInfo in the map returned from parseAuthConfig.
+//
+// username and password are returned for Basic Auth.
+func getAuthToken(r *http.Request) (authToken, username, password string, ok bool) {
+	auth := r.Header.Get("Authorization")
+	const bearerPrefix = "Bearer "
+	if len(auth) > len(bearerPrefix) && strings.EqualFold(auth[:len(bearerPrefix)], bearerPrefix) {
+		return getBearerAuthToken(auth[len(bearerPrefix):]), "", "", true
+	}
+	username, password, ok = r.BasicAuth()
+	if !ok {
+		return "", "", "", false
+	}
+	return getBasicAuthToken(username), username, password, true
+}
+
+var (
+	concurrencyLimitCh      chan struct{}
+	concurrencyLimitReached = metrics.NewCounter(`vmauth_concurrent_requests_limit_reached_total`)
+)
+
 var reverseProxy = &httputil.ReverseProxy{
 	Director: func(r *http.Request) {
 		targetURL := r.Header.Get("vm-target-url")
@@ -25,22 +25,38 @@ var (
 	snapshotDeleteURL = flag.String("snapshot.deleteURL", "", "VictoriaMetrics delete snapshot url. Optional. Will be generated from snapshotCreateURL if not provided. All created snaphosts will be automatically deleted."+
 		"Example: http://victoriametrics:8428/snaphsot/delete")
 	dst = flag.String("dst", "", "Where to put the backup on the remote storage. "+
-		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir or fs:///path/to/local/backup/dir\n"+
+		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir, swift://container/path/to/backup/dir or fs:///path/to/local/backup/dir\n"+
 		"-dst can point to the previous backup. In this case incremental backup is performed, i.e. only changed data is uploaded")
 	origin            = flag.String("origin", "", "Optional origin directory on the remote storage with old backup for server-side copying when performing full backup. This speeds up full backups")
 	concurrency       = flag.Int("concurrency", 10, "The number of concurrent workers. Higher concurrency may reduce backup duration")
 	maxBytesPerSecond = flagutil.NewBytes("maxBytesPerSecond", 0, "The maximum upload speed. There is no limit if it is set to 0")
+
+	verifyChecksumPercent = flag.Float64("verifyChecksumPercent", 1, "The percentage of randomly selected parts to download for checksum verification in 'verify' command. "+
+		"At least a single part is downloaded if the value is greater than 0. Set it to 100 for verifying checksums for all the parts. "+
+		"Set it to 0 for verifying the backup without downloading its data")
 )
 
 func main() {
 	// Write flags and help message to stdout, since it is easier to grep or pipe.
 	flag.CommandLine.SetOutput(os.Stdout)
 	flag.Usage = usage
+	isVerify := len(os.Args) > 1 && os.Args[1] == "verify"
+	if isVerify {
+		// Remove the command from args, so flags after it could be parsed.
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 	envflag.Parse()
 	buildinfo.Init()
 	logger.Init()
 	cgroup.UpdateGOMAXPROCSToCPUQuota()
 
+	if isVerify {
+		if err := runVerify(); err != nil {
+			logger.Fatalf("cannot verify backup: %s", err)
+		}
+		return
+	}
+
 	if len(*snapshotCreateURL) > 0 {
 		logger.Infof("%s", "Snapshots enabled")
 		logger.Infof("Snapshot create url %s", *snapshotCreateURL)
@@ -92,11 +108,26 @@ func main() {
 	}
 }
 
+func runVerify() error {
+	dstFS, err := newDstFS()
+	if err != nil {
+		return err
+	}
+	a := &actions.Verify{
+		Concurrency:     *concurrency,
+		Src:             dstFS,
+		ChecksumPercent: *verifyChecksumPercent,
+	}
+	return a.Run()
+}
+
 func usage() {
 	const s = `
 vmbackup performs backups for VictoriaMetrics data from instant snapshots to gcs, s3
 or local filesystem. Backed up data can be restored with vmrestore.
 
+Run 'vmbackup verify -dst=...' for verifying the backup at -dst without downloading all its data.
+
 See the docs at https://github.com/VictoriaMetrics/VictoriaMetrics/blob/master/app/vmbackup/README.md .
 `
 
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+)
+
+var (
+	httpListenAddr    = flag.String("httpListenAddr", ":8300", "TCP address for exporting metrics at /metrics page")
+	storageDataPath   = flag.String("storageDataPath", "victoria-metrics-data", "Path to VictoriaMetrics data. Must match -storageDataPath from VictoriaMetrics or vmstorage")
+	snapshotCreateURL = flag.String("snapshot.createURL", "", "VictoriaMetrics create snapshot url. Example: http://victoriametrics:8428/snapshot/create")
+	snapshotDeleteURL = flag.String("snapshot.deleteURL", "", "VictoriaMetrics delete snapshot url. Optional. Will be generated from -snapshot.createURL if not provided. "+
+		"Example: http://victoriametrics:8428/snapshot/delete")
+	dst = flag.String("dst", "", "Where to put the backups on the remote storage. "+
+		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir, swift://container/path/to/backup/dir or fs:///path/to/local/backup/dir")
+	backupInterval    = flag.Duration("backupInterval", time.Hour, "Interval between backups. The latest backup at -dst/latest is updated with this interval")
+	keepLastHourly    = flag.Int("keepLastHourly", 0, "The number of the most recent hourly backups to keep. Hourly backups are disabled if set to 0")
+	keepLastDaily     = flag.Int("keepLastDaily", 0, "The number of the most recent daily backups to keep. Daily backups are disabled if set to 0")
+	keepLastWeekly    = flag.Int("keepLastWeekly", 0, "The number of the most recent weekly backups to keep. Weekly backups are disabled if set to 0")
+	keepLastMonthly   = flag.Int("keepLastMonthly", 0, "The number of the most recent monthly backups to keep. Monthly backups are disabled if set to 0")
+	concurrency       = flag.Int("concurrency", 10, "The number of concurrent workers. Higher concurrency may reduce backup duration")
+	maxBytesPerSecond = flagutil.NewBytes("maxBytesPerSecond", 0, "The maximum upload speed. There is no limit if it is set to 0")
+)
+
+func main() {
+	// Write flags and help message to stdout, since it is easier to grep or pipe.
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.Usage = usage
+	envflag.Parse()
+	buildinfo.Init()
+	logger.Init()
+	cgroup.UpdateGOMAXPROCSToCPUQuota()
+
+	if len(*snapshotCreateURL) == 0 {
+		logger.Fatalf("missing `-snapshot.createURL`")
+	}
+	if len(*snapshotDeleteURL) == 0 {
+		if err := flag.Set("snapshot.deleteURL", strings.Replace(*snapshotCreateURL, "/create", "/delete", 1)); err != nil {
+			logger.Fatalf("cannot set snapshot.deleteURL flag: %s", err)
+		}
+	}
+	if len(*dst) == 0 {
+		logger.Fatalf("missing `-dst`")
+	}
+	if *backupInterval <= 0 {
+		logger.Fatalf("`-backupInterval` must be positive; got %s", *backupInterval)
+	}
+
+	logger.Infof("starting vmbackupmanager at %q...", *httpListenAddr)
+	startTime := time.Now()
+	tiers := newTiers()
+	go httpserver.Serve(*httpListenAddr, requestHandler)
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		runScheduler(tiers, stopCh)
+		close(doneCh)
+	}()
+	logger.Infof("started vmbackupmanager in %.3f seconds", time.Since(startTime).Seconds())
+
+	sig := procutil.WaitForSigterm()
+	logger.Infof("received signal %s", sig)
+
+	startTime = time.Now()
+	logger.Infof("gracefully shutting down webservice at %q", *httpListenAddr)
+	if err := httpserver.Stop(*httpListenAddr); err != nil {
+		logger.Fatalf("cannot stop the webservice: %s", err)
+	}
+	logger.Infof("successfully shut down the webservice in %.3f seconds", time.Since(startTime).Seconds())
+	logger.Infof("waiting for the current backup to complete...")
+	close(stopCh)
+	<-doneCh
+	logger.Infof("successfully stopped vmbackupmanager in %.3f seconds", time.Since(startTime).Seconds())
+}
+
+func requestHandler(w http.ResponseWriter, r *http.Request) bool {
+	// vmbackupmanager exposes only the standard /metrics, /health and /debug/pprof/* endpoints.
+	return false
+}
+
+func usage() {
+	const s = `
+vmbackupmanager performs scheduled backups for VictoriaMetrics data to gcs, s3 or local filesystem
+and applies retention policies to hourly, daily, weekly and monthly backups.
+
+See the docs at https://github.com/VictoriaMetrics/VictoriaMetrics/blob/master/app/vmbackupmanager/README.md .
+`
+
+	f := flag.CommandLine.Output()
+	fmt.Fprintf(f, "%s\n", s)
+	flag.PrintDefaults()
+}
+
+func newSrcFS(snapshotName string) (*fslocal.FS, error) {
+	snapshotPath := *storageDataPath + "/snapshots/" + snapshotName
+	fi, err := os.Stat(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat snapshot at %q: %w", snapshotPath, err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("snapshot %q must be a directory", snapshotPath)
+	}
+	fs := &fslocal.FS{
+		Dir:               snapshotPath,
+		MaxBytesPerSecond: maxBytesPerSecond.N,
+	}
+	if err := fs.Init(); err != nil {
+		return nil, fmt.Errorf("cannot initialize fs: %w", err)
+	}
+	return fs, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmbackup/snapshot"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// tier is a backup schedule tier such as hourly, daily, weekly or monthly.
+type tier struct {
+	// name is the tier name. It is used as a directory name for the tier backups at -dst.
+	name string
+
+	// keepLast is the number of the most recent backups to keep for the tier.
+	keepLast int
+
+	// backupName must return backup name for the given time.
+	//
+	// Backup names must be sorted in lexicographical order by their creation time.
+	backupName func(t time.Time) string
+
+	backupsCount uint64
+}
+
+func newTiers() []*tier {
+	tiers := []*tier{
+		{
+			name:     "hourly",
+			keepLast: *keepLastHourly,
+			backupName: func(t time.Time) string {
+				return t.Format("2006-01-02T15")
+			},
+		},
+		{
+			name:     "daily",
+			keepLast: *keepLastDaily,
+			backupName: func(t time.Time) string {
+				return t.Format("2006-01-02")
+			},
+		},
+		{
+			name:     "weekly",
+			keepLast: *keepLastWeekly,
+			backupName: func(t time.Time) string {
+				year, week := t.ISOWeek()
+				return fmt.Sprintf("%04d-W%02d", year, week)
+			},
+		},
+		{
+			name:     "monthly",
+			keepLast: *keepLastMonthly,
+			backupName: func(t time.Time) string {
+				return t.Format("2006-01")
+			},
+		},
+	}
+	for _, t := range tiers {
+		t := t
+		metrics.NewGauge(fmt.Sprintf(`vm_backups{type=%q}`, t.name), func() float64 {
+			return float64(atomic.LoadUint64(&t.backupsCount))
+		})
+	}
+	return tiers
+}
+
+var (
+	backupRuns   = metrics.NewCounter(`vm_backup_runs_total`)
+	backupErrors = metrics.NewCounter(`vm_backup_errors_total`)
+
+	lastBackupDuration         uint64
+	lastBackupSuccessTimestamp uint64
+	lastBackupFailed           uint64
+
+	_ = metrics.NewGauge(`vm_backup_last_duration_seconds`, func() float64 {
+		return float64(atomic.LoadUint64(&lastBackupDuration)) / 1e3
+	})
+	_ = metrics.NewGauge(`vm_backup_last_success_timestamp_seconds`, func() float64 {
+		return float64(atomic.LoadUint64(&lastBackupSuccessTimestamp))
+	})
+	_ = metrics.NewGauge(`vm_backup_last_run_failed`, func() float64 {
+		return float64(atomic.LoadUint64(&lastBackupFailed))
+	})
+)
+
+// runScheduler runs backups every -backupInterval until stopCh is closed.
+func runScheduler(tiers []*tier, stopCh <-chan struct{}) {
+	t := time.NewTicker(*backupInterval)
+	defer t.Stop()
+	for {
+		runBackupOnce(tiers)
+		select {
+		case <-stopCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func runBackupOnce(tiers []*tier) {
+	startTime := time.Now()
+	backupRuns.Inc()
+	if err := runBackup(tiers, startTime.UTC()); err != nil {
+		backupErrors.Inc()
+		atomic.StoreUint64(&lastBackupFailed, 1)
+		logger.Errorf("cannot perform backup: %s", err)
+		return
+	}
+	d := time.Since(startTime)
+	atomic.StoreUint64(&lastBackupDuration, uint64(d.Milliseconds()))
+	atomic.StoreUint64(&lastBackupSuccessTimestamp, uint64(startTime.Unix()))
+	atomic.StoreUint64(&lastBackupFailed, 0)
+	logger.Infof("backup has been successfully completed in %.3f seconds", d.Seconds())
+}
+
+func runBackup(tiers []*tier, now time.Time) error {
+	snapshotName, err := snapshot.Create(*snapshotCreateURL)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := snapshot.Delete(*snapshotDeleteURL, snapshotName); err != nil {
+			logger.Errorf("%s", err)
+		}
+	}()
+	srcFS, err := newSrcFS(snapshotName)
+	if err != nil {
+		return err
+	}
+
+	// Update the latest backup. It is used as an origin for server-side copying to tier backups.
+	latestFS, err := actions.NewRemoteFS(joinPath(*dst, "latest"))
+	if err != nil {
+		return fmt.Errorf("cannot initialize latest backup fs: %w", err)
+	}
+	a := &actions.Backup{
+		Concurrency: *concurrency,
+		Src:         srcFS,
+		Dst:         latestFS,
+	}
+	if err := a.Run(); err != nil {
+		return fmt.Errorf("cannot update latest backup at %s: %w", latestFS, err)
+	}
+
+	for _, t := range tiers {
+		if t.keepLast <= 0 {
+			continue
+		}
+		if err := t.backup(srcFS, latestFS, now); err != nil {
+			return fmt.Errorf("cannot create %s backup: %w", t.name, err)
+		}
+		if err := t.applyRetention(); err != nil {
+			return fmt.Errorf("cannot apply retention to %s backups: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+func (t *tier) backup(srcFS *fslocal.FS, latestFS common.RemoteFS, now time.Time) error {
+	name := t.backupName(now)
+	dstFS, err := actions.NewRemoteFS(joinPath(*dst, t.name, name))
+	if err != nil {
+		return err
+	}
+	ok, err := dstFS.HasFile(fscommon.BackupCompleteFilename)
+	if err != nil {
+		return err
+	}
+	if ok {
+		// The backup for the current period already exists.
+		return nil
+	}
+	logger.Infof("creating %s backup %q", t.name, name)
+	a := &actions.Backup{
+		Concurrency: *concurrency,
+		Src:         srcFS,
+		Dst:         dstFS,
+		Origin:      latestFS,
+	}
+	return a.Run()
+}
+
+func (t *tier) applyRetention() error {
+	tierFS, err := actions.NewRemoteFS(joinPath(*dst, t.name))
+	if err != nil {
+		return err
+	}
+	parts, err := tierFS.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list parts at %s: %w", tierFS, err)
+	}
+	names := getBackupNames(parts)
+	for len(names) > t.keepLast {
+		name := names[0]
+		logger.Infof("deleting %s backup %q, since only %d last backups must be kept", t.name, name, t.keepLast)
+		if err := deleteBackup(joinPath(*dst, t.name, name)); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	atomic.StoreUint64(&t.backupsCount, uint64(len(names)))
+	return nil
+}
+
+// getBackupNames returns sorted backup names for the given parts obtained from tier dir.
+func getBackupNames(parts []common.Part) []string {
+	m := make(map[string]bool)
+	for _, p := range parts {
+		n := strings.IndexByte(p.Path, '/')
+		if n <= 0 {
+			continue
+		}
+		m[p.Path[:n]] = true
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func deleteBackup(path string) error {
+	fs, err := actions.NewRemoteFS(path)
+	if err != nil {
+		return err
+	}
+	// Delete `backup complete` file at first, so the backup isn't used if the deletion is interrupted.
+	if err := fs.DeleteFile(fscommon.BackupCompleteFilename); err != nil {
+		return fmt.Errorf("cannot delete `backup complete` file at %s: %w", fs, err)
+	}
+	parts, err := fs.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list parts at %s: %w", fs, err)
+	}
+	for _, p := range parts {
+		if err := fs.DeletePart(p); err != nil {
+			return fmt.Errorf("cannot delete %s from %s: %w", &p, fs, err)
+		}
+	}
+	if err := fs.DeleteFile(fscommon.BackupManifestFilename); err != nil {
+		return fmt.Errorf("cannot delete manifest file at %s: %w", fs, err)
+	}
+	if err := fs.RemoveEmptyDirs(); err != nil {
+		return fmt.Errorf("cannot remove empty directories at %s: %w", fs, err)
+	}
+	return nil
+}
+
+func joinPath(prefix string, names ...string) string {
+	for strings.HasSuffix(prefix, "/") {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix + "/" + strings.Join(names, "/")
+}
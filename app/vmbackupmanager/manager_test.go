@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+)
+
+func TestGetBackupNames(t *testing.T) {
+	f := func(paths []string, namesExpected []string) {
+		t.Helper()
+		var parts []common.Part
+		for _, path := range paths {
+			parts = append(parts, common.Part{
+				Path: path,
+			})
+		}
+		names := getBackupNames(parts)
+		if !reflect.DeepEqual(names, namesExpected) {
+			t.Fatalf("unexpected backup names for paths %q; got %q; want %q", paths, names, namesExpected)
+		}
+	}
+	f(nil, []string{})
+	f([]string{"foo"}, []string{})
+	f([]string{"2020-08-02/data/small/2020_08/foo", "2020-08-01/indexdb/123/bar", "2020-08-02/indexdb/123/bar"}, []string{"2020-08-01", "2020-08-02"})
+}
+
+func TestTierBackupNames(t *testing.T) {
+	tiers := newTiers()
+	f := func(tierName string, ts time.Time, nameExpected string) {
+		t.Helper()
+		for _, tr := range tiers {
+			if tr.name != tierName {
+				continue
+			}
+			name := tr.backupName(ts)
+			if name != nameExpected {
+				t.Fatalf("unexpected %s backup name for %s; got %q; want %q", tierName, ts, name, nameExpected)
+			}
+			return
+		}
+		t.Fatalf("cannot find %s tier", tierName)
+	}
+	ts := time.Date(2021, 1, 3, 14, 25, 0, 0, time.UTC)
+	f("hourly", ts, "2021-01-03T14")
+	f("daily", ts, "2021-01-03")
+	f("weekly", ts, "2020-W53")
+	f("monthly", ts, "2021-01")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/influx"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	influxAddr            = flag.String("influx.addr", "http://localhost:8086", "InfluxDB address to migrate data from")
+	influxUser            = flag.String("influx.user", "", "Optional basic auth username for InfluxDB 1.x")
+	influxPassword        = flag.String("influx.password", "", "Optional basic auth password for InfluxDB 1.x")
+	influxToken           = flag.String("influx.token", "", "Optional auth token for InfluxDB 2.x. InfluxDB 2.x is queried via v1-compatible API, so DBRP mapping must exist for -influx.database")
+	influxDatabase        = flag.String("influx.database", "", "InfluxDB database to migrate data from")
+	influxRetentionPolicy = flag.String("influx.retentionPolicy", "", "Optional InfluxDB retention policy to migrate data from. The default retention policy is used if not set")
+	influxFilterSeries    = flag.String("influx.filterSeries", "", "Optional filter for 'SHOW SERIES' statement in order to migrate only the matching series. "+
+		"Example: \"FROM cpu WHERE host='a'\"")
+	influxFilterTimeStart = flag.String("influx.filterTimeStart", "", "Optional start time for the data to migrate. It may be either RFC3339 time or unix timestamp in seconds")
+	influxFilterTimeEnd   = flag.String("influx.filterTimeEnd", "", "Optional end time for the data to migrate. It may be either RFC3339 time or unix timestamp in seconds")
+	influxChunkSize       = flag.Int("influx.chunkSize", 10000, "The number of points per chunk in chunked responses from InfluxDB")
+	influxConcurrency     = flag.Int("influx.concurrency", 1, "The number of series to read concurrently from InfluxDB")
+
+	influxMeasurementFieldSeparator = flag.String("influx.measurementFieldSeparator", "_", "Separator for '{measurement}{separator}{field_name}' metric name")
+	influxSkipSingleField           = flag.Bool("influx.skipSingleField", false, "Uses '{measurement}' instead of '{measurement}{separator}{field_name}' for metric name "+
+		"if the measurement contains only a single numeric field")
+	influxSkipDatabaseLabel = flag.Bool("influx.skipDatabaseLabel", false, "Whether to skip adding 'db' label with -influx.database value to the imported time series")
+)
+
+func runInflux() error {
+	minTime, err := parseTime(*influxFilterTimeStart, 0)
+	if err != nil {
+		return fmt.Errorf("cannot parse `-influx.filterTimeStart`: %w", err)
+	}
+	maxTime, err := parseTime(*influxFilterTimeEnd, 0)
+	if err != nil {
+		return fmt.Errorf("cannot parse `-influx.filterTimeEnd`: %w", err)
+	}
+	cfg := influx.Config{
+		Addr:            *influxAddr,
+		User:            *influxUser,
+		Password:        *influxPassword,
+		Token:           *influxToken,
+		Database:        *influxDatabase,
+		RetentionPolicy: *influxRetentionPolicy,
+		FilterSeries:    *influxFilterSeries,
+		MinTime:         minTime,
+		MaxTime:         maxTime,
+		ChunkSize:       *influxChunkSize,
+	}
+	c, err := influx.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	sss, err := c.Explore()
+	if err != nil {
+		return fmt.Errorf("cannot explore InfluxDB series: %w", err)
+	}
+	logger.Infof("found %d series with numeric fields in -influx.database=%q", len(sss), *influxDatabase)
+	if len(sss) == 0 {
+		return nil
+	}
+
+	im, err := newImporter()
+	if err != nil {
+		return err
+	}
+	return migrateSeries(im, len(sss), *influxConcurrency, func(idx int, bt *batcher) error {
+		s := sss[idx]
+		name := influxMetricName(s)
+		var labels []vm.Label
+		for _, tag := range s.Tags {
+			labels = append(labels, vm.Label{
+				Name:  tag.Key,
+				Value: tag.Value,
+			})
+		}
+		if !*influxSkipDatabaseLabel {
+			labels = append(labels, vm.Label{
+				Name:  "db",
+				Value: *influxDatabase,
+			})
+		}
+		err := c.FetchSeries(s, func(timestamps []int64, values []float64) error {
+			return bt.add(&vm.TimeSeries{
+				Name:       name,
+				Labels:     labels,
+				Timestamps: append([]int64{}, timestamps...),
+				Values:     append([]float64{}, values...),
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("cannot fetch %s: %w", s, err)
+		}
+		return nil
+	})
+}
+
+func influxMetricName(s *influx.Series) string {
+	if s.FieldsCount == 1 && *influxSkipSingleField {
+		return s.Measurement
+	}
+	return s.Measurement + *influxMeasurementFieldSeparator + s.Field
+}
@@ -0,0 +1,446 @@
+package influx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the configuration for Client.
+type Config struct {
+	// Addr is InfluxDB address. For example, http://influxdb:8086
+	Addr string
+
+	// User and Password are optional basic auth credentials for InfluxDB 1.x.
+	User     string
+	Password string
+
+	// Token is optional auth token for InfluxDB 2.x.
+	//
+	// InfluxDB 2.x is queried via v1-compatible /query API, so DBRP mapping must exist for the Database.
+	Token string
+
+	// Database is the database to read data from.
+	Database string
+
+	// RetentionPolicy is optional retention policy to read data from.
+	RetentionPolicy string
+
+	// FilterSeries is optional filter for `SHOW SERIES` statement. For example, `FROM cpu WHERE host='a'`.
+	FilterSeries string
+
+	// MinTime and MaxTime limit the time range for the data to read in milliseconds.
+	MinTime int64
+	MaxTime int64
+
+	// ChunkSize is the number of points per chunk in the response for chunked queries.
+	ChunkSize int
+}
+
+// Series is a single InfluxDB series for a single numeric field.
+type Series struct {
+	Measurement string
+	Field       string
+	Tags        []Tag
+
+	// FieldsCount is the number of numeric fields for the Measurement.
+	FieldsCount int
+
+	// allTagKeys contains all the tag keys for the Measurement.
+	//
+	// It is used for excluding series with additional tags from query results.
+	allTagKeys []string
+}
+
+// Tag is a single InfluxDB tag.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// String returns human-readable representation for s.
+func (s *Series) String() string {
+	return fmt.Sprintf("series{measurement: %q, field: %q, tags: %v}", s.Measurement, s.Field, s.Tags)
+}
+
+// Client reads data from InfluxDB via /query API.
+type Client struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewClient returns new Client for the given cfg.
+func NewClient(cfg Config) (*Client, error) {
+	if len(cfg.Addr) == 0 {
+		return nil, fmt.Errorf("InfluxDB address cannot be empty")
+	}
+	if len(cfg.Database) == 0 {
+		return nil, fmt.Errorf("InfluxDB database cannot be empty")
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 10000
+	}
+	cfg.Addr = strings.TrimSuffix(cfg.Addr, "/")
+	return &Client{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}, nil
+}
+
+// Explore returns all the series with numeric fields matching Config.FilterSeries.
+func (c *Client) Explore() ([]*Series, error) {
+	fields, err := c.getNumericFields()
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain field keys: %w", err)
+	}
+	tagKeys, err := c.getTagKeys()
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain tag keys: %w", err)
+	}
+	q := "SHOW SERIES"
+	if len(c.cfg.FilterSeries) > 0 {
+		q += " " + c.cfg.FilterSeries
+	}
+	values, err := c.queryValues(q)
+	if err != nil {
+		return nil, err
+	}
+	var sss []*Series
+	for _, row := range values {
+		if len(row) == 0 {
+			continue
+		}
+		key, ok := row[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected series key type %T in response to %q", row[0], q)
+		}
+		measurement, tags, err := parseSeriesKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse series key %q: %w", key, err)
+		}
+		measurementFields := fields[measurement]
+		for _, field := range measurementFields {
+			sss = append(sss, &Series{
+				Measurement: measurement,
+				Field:       field,
+				Tags:        tags,
+				FieldsCount: len(measurementFields),
+				allTagKeys:  tagKeys[measurement],
+			})
+		}
+	}
+	return sss, nil
+}
+
+// FetchSeries reads data for s and calls f for each chunk of data.
+//
+// f mustn't hold timestamps and values after returning.
+func (c *Client) FetchSeries(s *Series, f func(timestamps []int64, values []float64) error) error {
+	q := c.selectQuery(s)
+	resp, err := c.do(q, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Close()
+	}()
+	d := json.NewDecoder(resp)
+	d.UseNumber()
+	var timestamps []int64
+	var values []float64
+	for {
+		var r response
+		if err := d.Decode(&r); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("cannot parse response for %q: %w", q, err)
+		}
+		if err := r.error(); err != nil {
+			return fmt.Errorf("error when executing %q: %w", q, err)
+		}
+		timestamps = timestamps[:0]
+		values = values[:0]
+		for _, res := range r.Results {
+			for _, rs := range res.Series {
+				for _, row := range rs.Values {
+					if len(row) < 2 || row[1] == nil {
+						continue
+					}
+					ts, err := parseTimestamp(row[0])
+					if err != nil {
+						return fmt.Errorf("cannot parse timestamp in response for %q: %w", q, err)
+					}
+					v, err := parseValue(row[1])
+					if err != nil {
+						return fmt.Errorf("cannot parse value in response for %q: %w", q, err)
+					}
+					timestamps = append(timestamps, ts)
+					values = append(values, v)
+				}
+			}
+		}
+		if len(timestamps) == 0 {
+			continue
+		}
+		if err := f(timestamps, values); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) selectQuery(s *Series) string {
+	var conds []string
+	tagValues := make(map[string]string, len(s.Tags))
+	for _, tag := range s.Tags {
+		tagValues[tag.Key] = tag.Value
+	}
+	for _, key := range s.allTagKeys {
+		// Empty value matches series without the given tag.
+		conds = append(conds, fmt.Sprintf("%s=%s", quoteIdent(key), quoteString(tagValues[key])))
+	}
+	if c.cfg.MinTime > 0 {
+		conds = append(conds, fmt.Sprintf("time >= %dms", c.cfg.MinTime))
+	}
+	if c.cfg.MaxTime > 0 {
+		conds = append(conds, fmt.Sprintf("time <= %dms", c.cfg.MaxTime))
+	}
+	q := fmt.Sprintf("SELECT %s FROM %s", quoteIdent(s.Field), c.measurementIdent(s.Measurement))
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return q
+}
+
+func (c *Client) measurementIdent(measurement string) string {
+	if len(c.cfg.RetentionPolicy) == 0 {
+		return quoteIdent(measurement)
+	}
+	return quoteIdent(c.cfg.RetentionPolicy) + "." + quoteIdent(measurement)
+}
+
+// getNumericFields returns numeric field keys per each measurement.
+func (c *Client) getNumericFields() (map[string][]string, error) {
+	rss, err := c.querySeries("SHOW FIELD KEYS")
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]string)
+	for _, rs := range rss {
+		for _, row := range rs.Values {
+			if len(row) < 2 {
+				continue
+			}
+			field, _ := row[0].(string)
+			fieldType, _ := row[1].(string)
+			switch fieldType {
+			case "float", "integer", "unsigned", "boolean":
+				m[rs.Name] = append(m[rs.Name], field)
+			}
+		}
+	}
+	return m, nil
+}
+
+// getTagKeys returns tag keys per each measurement.
+func (c *Client) getTagKeys() (map[string][]string, error) {
+	rss, err := c.querySeries("SHOW TAG KEYS")
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]string)
+	for _, rs := range rss {
+		for _, row := range rs.Values {
+			if len(row) < 1 {
+				continue
+			}
+			key, _ := row[0].(string)
+			m[rs.Name] = append(m[rs.Name], key)
+		}
+	}
+	for _, keys := range m {
+		sort.Strings(keys)
+	}
+	return m, nil
+}
+
+func (c *Client) queryValues(q string) ([][]interface{}, error) {
+	rss, err := c.querySeries(q)
+	if err != nil {
+		return nil, err
+	}
+	var values [][]interface{}
+	for _, rs := range rss {
+		values = append(values, rs.Values...)
+	}
+	return values, nil
+}
+
+func (c *Client) querySeries(q string) ([]responseSeries, error) {
+	resp, err := c.do(q, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Close()
+	}()
+	d := json.NewDecoder(resp)
+	d.UseNumber()
+	var r response
+	if err := d.Decode(&r); err != nil {
+		return nil, fmt.Errorf("cannot parse response for %q: %w", q, err)
+	}
+	if err := r.error(); err != nil {
+		return nil, fmt.Errorf("error when executing %q: %w", q, err)
+	}
+	var rss []responseSeries
+	for _, res := range r.Results {
+		rss = append(rss, res.Series...)
+	}
+	return rss, nil
+}
+
+func (c *Client) do(q string, chunked bool) (io.ReadCloser, error) {
+	args := url.Values{}
+	args.Set("db", c.cfg.Database)
+	if len(c.cfg.RetentionPolicy) > 0 {
+		args.Set("rp", c.cfg.RetentionPolicy)
+	}
+	args.Set("q", q)
+	args.Set("epoch", "ms")
+	if chunked {
+		args.Set("chunked", "true")
+		args.Set("chunk_size", strconv.Itoa(c.cfg.ChunkSize))
+	}
+	req, err := http.NewRequest("POST", c.cfg.Addr+"/query", strings.NewReader(args.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(c.cfg.Token) > 0 {
+		req.Header.Set("Authorization", "Token "+c.cfg.Token)
+	} else if len(c.cfg.User) > 0 || len(c.cfg.Password) > 0 {
+		req.SetBasicAuth(c.cfg.User, c.cfg.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute %q at %q: %w", q, c.cfg.Addr, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response code %d when executing %q at %q; response body: %q", resp.StatusCode, q, c.cfg.Addr, body)
+	}
+	return resp.Body, nil
+}
+
+type response struct {
+	Results []struct {
+		Series []responseSeries `json:"series"`
+		Error  string           `json:"error"`
+	} `json:"results"`
+	Error string `json:"error"`
+}
+
+type responseSeries struct {
+	Name    string          `json:"name"`
+	Columns []string        `json:"columns"`
+	Values  [][]interface{} `json:"values"`
+}
+
+func (r *response) error() error {
+	if len(r.Error) > 0 {
+		return fmt.Errorf("%s", r.Error)
+	}
+	for _, res := range r.Results {
+		if len(res.Error) > 0 {
+			return fmt.Errorf("%s", res.Error)
+		}
+	}
+	return nil
+}
+
+func parseTimestamp(v interface{}) (int64, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("unexpected timestamp type %T; want number", v)
+	}
+	return n.Int64()
+}
+
+func parseValue(v interface{}) (float64, error) {
+	switch t := v.(type) {
+	case json.Number:
+		return t.Float64()
+	case bool:
+		if t {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unexpected value type %T; want number or bool", v)
+	}
+}
+
+// parseSeriesKey parses InfluxDB series key such as `cpu,host=a,region=b`.
+func parseSeriesKey(key string) (string, []Tag, error) {
+	measurement, tail := splitUnescaped(key, ',')
+	var tags []Tag
+	for len(tail) > 0 {
+		var s string
+		s, tail = splitUnescaped(tail, ',')
+		k, v := splitUnescaped(s, '=')
+		if len(k) == 0 {
+			return "", nil, fmt.Errorf("missing tag key in %q", s)
+		}
+		tags = append(tags, Tag{
+			Key:   unescape(k),
+			Value: unescape(v),
+		})
+	}
+	return unescape(measurement), tags, nil
+}
+
+// splitUnescaped splits s by the first unescaped ch.
+func splitUnescaped(s string, ch byte) (string, string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ch:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func quoteString(s string) string {
+	return `'` + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + `'`
+}
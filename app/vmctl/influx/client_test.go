@@ -0,0 +1,53 @@
+package influx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSeriesKey(t *testing.T) {
+	f := func(key, measurementExpected string, tagsExpected []Tag) {
+		t.Helper()
+		measurement, tags, err := parseSeriesKey(key)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", key, err)
+		}
+		if measurement != measurementExpected {
+			t.Fatalf("unexpected measurement for %q; got %q; want %q", key, measurement, measurementExpected)
+		}
+		if !reflect.DeepEqual(tags, tagsExpected) {
+			t.Fatalf("unexpected tags for %q; got %v; want %v", key, tags, tagsExpected)
+		}
+	}
+	f("cpu", "cpu", nil)
+	f("cpu,host=a", "cpu", []Tag{{"host", "a"}})
+	f("cpu,host=a,region=us-west", "cpu", []Tag{{"host", "a"}, {"region", "us-west"}})
+	f(`cpu\,load,host\ name=a\=b\,c`, "cpu,load", []Tag{{"host name", "a=b,c"}})
+}
+
+func TestSelectQuery(t *testing.T) {
+	f := func(cfg Config, s *Series, qExpected string) {
+		t.Helper()
+		c := &Client{
+			cfg: cfg,
+		}
+		q := c.selectQuery(s)
+		if q != qExpected {
+			t.Fatalf("unexpected query\ngot\n%s\nwant\n%s", q, qExpected)
+		}
+	}
+	f(Config{}, &Series{
+		Measurement: "cpu",
+		Field:       "usage",
+	}, `SELECT "usage" FROM "cpu"`)
+	f(Config{
+		RetentionPolicy: "autogen",
+		MinTime:         1000,
+		MaxTime:         2000,
+	}, &Series{
+		Measurement: "cpu",
+		Field:       "usage",
+		Tags:        []Tag{{"host", "a'b"}},
+		allTagKeys:  []string{"host", "region"},
+	}, `SELECT "usage" FROM "autogen"."cpu" WHERE "host"='a\'b' AND "region"='' AND time >= 1000ms AND time <= 2000ms`)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+var (
+	vmAddr = flag.String("vm.addr", "http://localhost:8428", "VictoriaMetrics address to import data to. "+
+		"Data is imported via /api/v1/import/native endpoint")
+	vmUser          = flag.String("vm.user", "", "Optional basic auth username for -vm.addr")
+	vmPassword      = flag.String("vm.password", "", "Optional basic auth password for -vm.addr")
+	vmExtraLabels   = flagutil.NewArray("vm.extraLabel", "Extra label in the form label=value to add to all the imported time series")
+	vmConcurrency   = flag.Int("vm.concurrency", 2, "The number of concurrent import requests to -vm.addr")
+	vmBatchSize     = flag.Int("vm.batchSize", 1000, "The maximum number of time series to send to -vm.addr in a single import request")
+	vmMaxRetries    = flag.Int("vm.maxRetries", 10, "The maximum number of retries for each failed import request to -vm.addr")
+	vmRelabelConfig = flag.String("vm.relabelConfig", "", "Optional path to a file with relabeling rules in Prometheus relabel_config format, "+
+		"which are applied to all the imported time series before adding -vm.extraLabel. This may be used for renaming metrics and labels in historical data. "+
+		"Time series are dropped if relabeling removes all their labels")
+)
+
+func main() {
+	// Write flags and help message to stdout, since it is easier to grep or pipe.
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.Usage = usage
+	mode := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		mode = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	envflag.Parse()
+	buildinfo.Init()
+	logger.Init()
+	cgroup.UpdateGOMAXPROCSToCPUQuota()
+
+	var err error
+	startTime := time.Now()
+	switch mode {
+	case "prometheus":
+		err = runPrometheus()
+	case "influx":
+		err = runInflux()
+	case "opentsdb":
+		err = runOpenTSDB()
+	case "vm-native":
+		err = runVMNative()
+	case "":
+		flag.Usage()
+		logger.Fatalf("missing migration mode")
+	default:
+		flag.Usage()
+		logger.Fatalf("unsupported migration mode %q", mode)
+	}
+	if err != nil {
+		logger.Fatalf("cannot migrate data in %q mode: %s", mode, err)
+	}
+	logger.Infof("successfully migrated data in %q mode in %.3f seconds", mode, time.Since(startTime).Seconds())
+}
+
+func usage() {
+	const s = `
+vmctl migrates data from other time series databases to VictoriaMetrics.
+
+Usage: vmctl <mode> [flags]
+
+Supported modes:
+
+  prometheus - migrate data from Prometheus snapshot. See -prom.* flags.
+  influx     - migrate data from InfluxDB 1.x or 2.x. See -influx.* flags.
+  opentsdb   - migrate data from OpenTSDB. See -otsdb.* flags.
+  vm-native  - migrate data from another VictoriaMetrics via native export. See -vmnative.* flags.
+
+See the docs at https://github.com/VictoriaMetrics/VictoriaMetrics/blob/master/app/vmctl/README.md .
+`
+
+	f := flag.CommandLine.Output()
+	fmt.Fprintf(f, "%s\n", s)
+	flag.PrintDefaults()
+}
+
+func newImporter() (*vm.Importer, error) {
+	var extraLabels []vm.Label
+	for _, s := range *vmExtraLabels {
+		n := strings.IndexByte(s, '=')
+		if n < 0 {
+			return nil, fmt.Errorf("missing '=' in `-vm.extraLabel`=%q; it must have the form label=value", s)
+		}
+		extraLabels = append(extraLabels, vm.Label{
+			Name:  s[:n],
+			Value: s[n+1:],
+		})
+	}
+	var prcs []promrelabel.ParsedRelabelConfig
+	if len(*vmRelabelConfig) > 0 {
+		var err error
+		prcs, err = promrelabel.LoadRelabelConfigs(*vmRelabelConfig)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load `-vm.relabelConfig`: %w", err)
+		}
+	}
+	cfg := vm.Config{
+		Addr:           *vmAddr,
+		User:           *vmUser,
+		Password:       *vmPassword,
+		ExtraLabels:    extraLabels,
+		RelabelConfigs: prcs,
+		MaxRetries:     *vmMaxRetries,
+	}
+	return vm.NewImporter(cfg)
+}
+
+// parseTime parses s in RFC3339 format or as unix timestamp in seconds and returns timestamp in milliseconds.
+//
+// defaultValue is returned if s is empty.
+func parseTime(s string, defaultValue int64) (int64, error) {
+	if len(s) == 0 {
+		return defaultValue, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t.UnixNano() / 1e6, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q as RFC3339 time or unix timestamp", s)
+	}
+	if math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return int64(secs * 1e3), nil
+}
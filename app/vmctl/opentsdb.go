@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/opentsdb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	otsdbAddr            = flag.String("otsdb.addr", "http://localhost:4242", "OpenTSDB address to migrate data from")
+	otsdbMetricPrefix    = flagutil.NewArray("otsdb.metricPrefix", "Prefix for metric names to migrate. Metric names are obtained via /api/suggest. All the metrics are migrated if not set")
+	otsdbMaxMetrics      = flag.Int("otsdb.maxMetrics", 100000, "The maximum number of metric names to obtain via /api/suggest per each -otsdb.metricPrefix")
+	otsdbMaxSeries       = flag.Int("otsdb.maxSeriesPerMetric", 100000, "The maximum number of series to obtain via /api/search/lookup per each metric")
+	otsdbFilterTimeStart = flag.String("otsdb.filterTimeStart", "", "Start time for the data to migrate. It may be either RFC3339 time or unix timestamp in seconds. Required")
+	otsdbFilterTimeEnd   = flag.String("otsdb.filterTimeEnd", "", "Optional end time for the data to migrate. It may be either RFC3339 time or unix timestamp in seconds. "+
+		"The current time is used if not set")
+	otsdbQueryChunk  = flag.Duration("otsdb.queryChunk", 24*time.Hour, "The maximum time range for a single /api/query request to OpenTSDB")
+	otsdbConcurrency = flag.Int("otsdb.concurrency", 1, "The number of series to read concurrently from OpenTSDB")
+)
+
+func runOpenTSDB() error {
+	if len(*otsdbFilterTimeStart) == 0 {
+		return fmt.Errorf("missing `-otsdb.filterTimeStart`")
+	}
+	minTime, err := parseTime(*otsdbFilterTimeStart, 0)
+	if err != nil {
+		return fmt.Errorf("cannot parse `-otsdb.filterTimeStart`: %w", err)
+	}
+	maxTime, err := parseTime(*otsdbFilterTimeEnd, time.Now().UnixNano()/1e6)
+	if err != nil {
+		return fmt.Errorf("cannot parse `-otsdb.filterTimeEnd`: %w", err)
+	}
+	cfg := opentsdb.Config{
+		Addr:               *otsdbAddr,
+		MaxSeriesPerMetric: *otsdbMaxSeries,
+		MinTime:            minTime,
+		MaxTime:            maxTime,
+		QueryChunk:         *otsdbQueryChunk,
+	}
+	c, err := opentsdb.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	prefixes := *otsdbMetricPrefix
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	m := make(map[string]bool)
+	for _, prefix := range prefixes {
+		metrics, err := c.FindMetrics(prefix, *otsdbMaxMetrics)
+		if err != nil {
+			return fmt.Errorf("cannot find metrics with prefix %q: %w", prefix, err)
+		}
+		for _, metric := range metrics {
+			m[metric] = true
+		}
+	}
+	metrics := make([]string, 0, len(m))
+	for metric := range m {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	var sss []*opentsdb.Series
+	for _, metric := range metrics {
+		ss, err := c.FindSeries(metric)
+		if err != nil {
+			return fmt.Errorf("cannot find series for metric %q: %w", metric, err)
+		}
+		sss = append(sss, ss...)
+	}
+	logger.Infof("found %d metrics with %d series in -otsdb.addr=%q", len(metrics), len(sss), *otsdbAddr)
+	if len(sss) == 0 {
+		return nil
+	}
+
+	im, err := newImporter()
+	if err != nil {
+		return err
+	}
+	return migrateSeries(im, len(sss), *otsdbConcurrency, func(idx int, bt *batcher) error {
+		s := sss[idx]
+		var labels []vm.Label
+		for k, v := range s.Tags {
+			labels = append(labels, vm.Label{
+				Name:  k,
+				Value: v,
+			})
+		}
+		err := c.FetchSeries(s, func(timestamps []int64, values []float64) error {
+			return bt.add(&vm.TimeSeries{
+				Name:       s.Metric,
+				Labels:     labels,
+				Timestamps: append([]int64{}, timestamps...),
+				Values:     append([]float64{}, values...),
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("cannot fetch %s: %w", s, err)
+		}
+		return nil
+	})
+}
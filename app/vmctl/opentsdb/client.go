@@ -0,0 +1,247 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the configuration for Client.
+type Config struct {
+	// Addr is OpenTSDB address. For example, http://opentsdb:4242
+	Addr string
+
+	// MaxSeriesPerMetric is the maximum number of series to return from /api/search/lookup per each metric.
+	MaxSeriesPerMetric int
+
+	// MinTime and MaxTime limit the time range for the data to read in milliseconds.
+	MinTime int64
+	MaxTime int64
+
+	// QueryChunk is the maximum time range for a single /api/query request.
+	QueryChunk time.Duration
+}
+
+// Series is a single OpenTSDB series.
+type Series struct {
+	Metric string
+	Tags   map[string]string
+}
+
+// String returns human-readable representation for s.
+func (s *Series) String() string {
+	return fmt.Sprintf("series{metric: %q, tags: %v}", s.Metric, s.Tags)
+}
+
+// Client reads data from OpenTSDB via HTTP API.
+type Client struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewClient returns new Client for the given cfg.
+func NewClient(cfg Config) (*Client, error) {
+	if len(cfg.Addr) == 0 {
+		return nil, fmt.Errorf("OpenTSDB address cannot be empty")
+	}
+	if cfg.MinTime <= 0 {
+		return nil, fmt.Errorf("start time must be set")
+	}
+	if cfg.MaxTime < cfg.MinTime {
+		return nil, fmt.Errorf("end time cannot be smaller than start time")
+	}
+	if cfg.MaxSeriesPerMetric <= 0 {
+		cfg.MaxSeriesPerMetric = 100000
+	}
+	if cfg.QueryChunk <= 0 {
+		cfg.QueryChunk = 24 * time.Hour
+	}
+	cfg.Addr = strings.TrimSuffix(cfg.Addr, "/")
+	return &Client{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}, nil
+}
+
+// FindMetrics returns metric names starting with the given prefix via /api/suggest.
+func (c *Client) FindMetrics(prefix string, maxMetrics int) ([]string, error) {
+	args := url.Values{}
+	args.Set("type", "metrics")
+	args.Set("q", prefix)
+	args.Set("max", strconv.Itoa(maxMetrics))
+	var metrics []string
+	if err := c.getJSON("/api/suggest", args, &metrics); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// FindSeries returns series for the given metric via /api/search/lookup.
+func (c *Client) FindSeries(metric string) ([]*Series, error) {
+	args := url.Values{}
+	args.Set("m", metric)
+	args.Set("limit", strconv.Itoa(c.cfg.MaxSeriesPerMetric))
+	var r struct {
+		Results []struct {
+			Metric string            `json:"metric"`
+			Tags   map[string]string `json:"tags"`
+		} `json:"results"`
+	}
+	if err := c.getJSON("/api/search/lookup", args, &r); err != nil {
+		return nil, err
+	}
+	var sss []*Series
+	for _, res := range r.Results {
+		sss = append(sss, &Series{
+			Metric: res.Metric,
+			Tags:   res.Tags,
+		})
+	}
+	return sss, nil
+}
+
+// FetchSeries reads data for s on the configured time range and calls f for each chunk of data.
+//
+// The time range is split into Config.QueryChunk chunks in order to reduce load on OpenTSDB.
+// f mustn't hold timestamps and values after returning.
+func (c *Client) FetchSeries(s *Series, f func(timestamps []int64, values []float64) error) error {
+	chunkMsecs := c.cfg.QueryChunk.Milliseconds()
+	var timestamps []int64
+	var values []float64
+	for start := c.cfg.MinTime; start <= c.cfg.MaxTime; start += chunkMsecs {
+		end := start + chunkMsecs - 1
+		if end > c.cfg.MaxTime {
+			end = c.cfg.MaxTime
+		}
+		var err error
+		timestamps, values, err = c.query(timestamps[:0], values[:0], s, start, end)
+		if err != nil {
+			return err
+		}
+		if len(timestamps) == 0 {
+			continue
+		}
+		if err := f(timestamps, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) query(dstTimestamps []int64, dstValues []float64, s *Series, start, end int64) ([]int64, []float64, error) {
+	args := url.Values{}
+	args.Set("start", strconv.FormatInt(start, 10))
+	args.Set("end", strconv.FormatInt(end, 10))
+	args.Set("ms", "true")
+	args.Set("m", "none:"+seriesFilter(s))
+	var r []struct {
+		Tags map[string]string      `json:"tags"`
+		Dps  map[string]json.Number `json:"dps"`
+	}
+	if err := c.getJSON("/api/query", args, &r); err != nil {
+		return dstTimestamps, dstValues, err
+	}
+	dstLen := len(dstTimestamps)
+	for _, res := range r {
+		// The query may return series with additional tags. Skip them.
+		if !equalTags(res.Tags, s.Tags) {
+			continue
+		}
+		for k, n := range res.Dps {
+			ts, err := strconv.ParseInt(k, 10, 64)
+			if err != nil {
+				return dstTimestamps, dstValues, fmt.Errorf("cannot parse timestamp %q for %s: %w", k, s, err)
+			}
+			v, err := n.Float64()
+			if err != nil {
+				return dstTimestamps, dstValues, fmt.Errorf("cannot parse value %q for %s: %w", n, s, err)
+			}
+			dstTimestamps = append(dstTimestamps, ts)
+			dstValues = append(dstValues, v)
+		}
+	}
+	// Map iteration order is random, so sort the returned samples by timestamp.
+	ss := &samples{
+		timestamps: dstTimestamps[dstLen:],
+		values:     dstValues[dstLen:],
+	}
+	sort.Sort(ss)
+	return dstTimestamps, dstValues, nil
+}
+
+func (c *Client) getJSON(path string, args url.Values, dst interface{}) error {
+	u := c.cfg.Addr + path + "?" + args.Encode()
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return fmt.Errorf("cannot query %q: %w", u, err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read response from %q: %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response code %d for %q; response body: %q", resp.StatusCode, u, body)
+	}
+	if err := json.Unmarshal(body, dst); err != nil {
+		return fmt.Errorf("cannot parse response from %q: %w", u, err)
+	}
+	return nil
+}
+
+// seriesFilter returns OpenTSDB metric filter for s such as `metric{tag1=value1,tag2=value2}`.
+func seriesFilter(s *Series) string {
+	if len(s.Tags) == 0 {
+		return s.Metric
+	}
+	keys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(s.Metric)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(s.Tags[k])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func equalTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+type samples struct {
+	timestamps []int64
+	values     []float64
+}
+
+func (s *samples) Len() int           { return len(s.timestamps) }
+func (s *samples) Less(i, j int) bool { return s.timestamps[i] < s.timestamps[j] }
+func (s *samples) Swap(i, j int) {
+	s.timestamps[i], s.timestamps[j] = s.timestamps[j], s.timestamps[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
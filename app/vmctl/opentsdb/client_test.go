@@ -0,0 +1,76 @@
+package opentsdb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSeriesFilter(t *testing.T) {
+	f := func(s *Series, resultExpected string) {
+		t.Helper()
+		result := seriesFilter(s)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+	f(&Series{Metric: "foo"}, "foo")
+	f(&Series{Metric: "foo", Tags: map[string]string{"host": "a"}}, "foo{host=a}")
+	f(&Series{Metric: "foo.bar", Tags: map[string]string{"host": "a", "dc": "x"}}, "foo.bar{dc=x,host=a}")
+}
+
+func TestClientFetchSeries(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/query" {
+			http.Error(w, "unexpected path", http.StatusBadRequest)
+			return
+		}
+		start := r.FormValue("start")
+		queries = append(queries, fmt.Sprintf("%s-%s %s", start, r.FormValue("end"), r.FormValue("m")))
+		fmt.Fprintf(w, `[{"tags":{"host":"a"},"dps":{"%s":2,"%s0":1.5}},{"tags":{"host":"a","dc":"x"},"dps":{"%s":3}}]`, start+"5", start, start)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(Config{
+		Addr:       srv.URL,
+		MinTime:    1000,
+		MaxTime:    2500,
+		QueryChunk: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+	s := &Series{
+		Metric: "foo",
+		Tags:   map[string]string{"host": "a"},
+	}
+	var timestamps []int64
+	var values []float64
+	err = c.FetchSeries(s, func(tss []int64, vs []float64) error {
+		timestamps = append(timestamps, tss...)
+		values = append(values, vs...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	queriesExpected := []string{
+		"1000-1999 none:foo{host=a}",
+		"2000-2500 none:foo{host=a}",
+	}
+	if !reflect.DeepEqual(queries, queriesExpected) {
+		t.Fatalf("unexpected queries; got %q; want %q", queries, queriesExpected)
+	}
+	timestampsExpected := []int64{10000, 10005, 20000, 20005}
+	if !reflect.DeepEqual(timestamps, timestampsExpected) {
+		t.Fatalf("unexpected timestamps; got %d; want %d", timestamps, timestampsExpected)
+	}
+	valuesExpected := []float64{1.5, 2, 1.5, 2}
+	if !reflect.DeepEqual(values, valuesExpected) {
+		t.Fatalf("unexpected values; got %v; want %v", values, valuesExpected)
+	}
+}
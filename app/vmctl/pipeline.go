@@ -0,0 +1,178 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+)
+
+// importPipeline imports batches of time series into VictoriaMetrics via -vm.concurrency workers.
+type importPipeline struct {
+	im *vm.Importer
+
+	batchCh chan []*vm.TimeSeries
+	wg      sync.WaitGroup
+
+	stopCh   chan struct{}
+	errLock  sync.Mutex
+	firstErr error
+}
+
+func newImportPipeline(im *vm.Importer) *importPipeline {
+	concurrency := *vmConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ip := &importPipeline{
+		im:      im,
+		batchCh: make(chan []*vm.TimeSeries, concurrency),
+		stopCh:  make(chan struct{}),
+	}
+	for i := 0; i < concurrency; i++ {
+		ip.wg.Add(1)
+		go func() {
+			defer ip.wg.Done()
+			for tss := range ip.batchCh {
+				if err := ip.err(); err != nil {
+					// Drain batchCh after the error.
+					continue
+				}
+				if err := im.Import(tss); err != nil {
+					ip.setErr(err)
+				}
+			}
+		}()
+	}
+	return ip
+}
+
+// push pushes tss to ip for the import.
+//
+// It returns the first import error if it occurred.
+func (ip *importPipeline) push(tss []*vm.TimeSeries) error {
+	if err := ip.err(); err != nil {
+		return err
+	}
+	select {
+	case ip.batchCh <- tss:
+		return nil
+	case <-ip.stopCh:
+		return ip.err()
+	}
+}
+
+// close waits until all the pushed batches are imported and returns the first import error if any.
+func (ip *importPipeline) close() error {
+	close(ip.batchCh)
+	ip.wg.Wait()
+	return ip.err()
+}
+
+func (ip *importPipeline) setErr(err error) {
+	ip.errLock.Lock()
+	if ip.firstErr == nil {
+		ip.firstErr = err
+		close(ip.stopCh)
+	}
+	ip.errLock.Unlock()
+}
+
+func (ip *importPipeline) err() error {
+	ip.errLock.Lock()
+	err := ip.firstErr
+	ip.errLock.Unlock()
+	return err
+}
+
+// batcher collects time series into batches with up to -vm.batchSize time series and pushes them to importPipeline.
+type batcher struct {
+	ip  *importPipeline
+	tss []*vm.TimeSeries
+}
+
+func (b *batcher) add(ts *vm.TimeSeries) error {
+	b.tss = append(b.tss, ts)
+	if len(b.tss) < *vmBatchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+func (b *batcher) flush() error {
+	if len(b.tss) == 0 {
+		return nil
+	}
+	tss := b.tss
+	b.tss = nil
+	return b.ip.push(tss)
+}
+
+// migrateSeries calls f for seriesCount series indexes using the given concurrency and imports the collected time series into VictoriaMetrics.
+//
+// The migration progress is logged periodically.
+func migrateSeries(im *vm.Importer, seriesCount, concurrency int, f func(idx int, bt *batcher) error) error {
+	return migrateItems(im, "series", seriesCount, concurrency, f)
+}
+
+// migrateItems calls f for itemsCount item indexes using the given concurrency and imports the collected time series into VictoriaMetrics.
+//
+// The remaining items are skipped after the first error. The migration progress is logged periodically.
+func migrateItems(im *vm.Importer, itemsName string, itemsCount, concurrency int, f func(idx int, bt *batcher) error) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ip := newImportPipeline(im)
+	var itemsProcessed uint64
+	stopProgress := startProgress(im, itemsName, itemsCount, func() int {
+		return int(atomic.LoadUint64(&itemsProcessed))
+	})
+	workCh := make(chan int, itemsCount)
+	for i := 0; i < itemsCount; i++ {
+		workCh <- i
+	}
+	close(workCh)
+	errCh := make(chan error, concurrency)
+	stopCh := make(chan struct{})
+	var stopOnce sync.Once
+	reportErr := func(err error) {
+		errCh <- err
+		stopOnce.Do(func() {
+			close(stopCh)
+		})
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bt := &batcher{
+				ip: ip,
+			}
+			for idx := range workCh {
+				select {
+				case <-stopCh:
+					// Another worker failed, so there is no sense in processing the remaining items.
+					return
+				default:
+				}
+				if err := f(idx, bt); err != nil {
+					reportErr(err)
+					return
+				}
+				atomic.AddUint64(&itemsProcessed, 1)
+			}
+			if err := bt.flush(); err != nil {
+				reportErr(err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	err := <-errCh
+	if errImport := ip.close(); err == nil {
+		err = errImport
+	}
+	stopProgress()
+	return err
+}
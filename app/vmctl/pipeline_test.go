@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+)
+
+func TestMigrateItemsStopsOnError(t *testing.T) {
+	im, err := vm.NewImporter(vm.Config{
+		Addr: "http://localhost:8428",
+	})
+	if err != nil {
+		t.Fatalf("cannot create importer: %s", err)
+	}
+	const itemsCount = 1000
+	var calls uint64
+	failedCh := make(chan struct{})
+	err = migrateItems(im, "items", itemsCount, 2, func(idx int, bt *batcher) error {
+		atomic.AddUint64(&calls, 1)
+		if idx == 0 {
+			close(failedCh)
+			return fmt.Errorf("error for item %d", idx)
+		}
+		<-failedCh
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if n := atomic.LoadUint64(&calls); n >= itemsCount {
+		t.Fatalf("remaining items must be skipped after the error; got %d processed items out of %d", n, itemsCount)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// progressInterval is the interval between progress messages.
+const progressInterval = 10 * time.Second
+
+// startProgress starts logging migration progress every progressInterval.
+//
+// processed must return the number of processed items out of total items.
+// Call the returned func in order to stop logging the progress. It logs the final progress message.
+func startProgress(im *vm.Importer, itemsName string, total int, processed func() int) func() {
+	startTime := time.Now()
+	logProgress := func() {
+		n := processed()
+		series, samples, requests, retries := im.Stats()
+		percent := 100.0
+		if total > 0 {
+			percent = 100 * float64(n) / float64(total)
+		}
+		elapsed := time.Since(startTime).Seconds()
+		samplesPerSec := 0.0
+		if elapsed > 0 {
+			samplesPerSec = float64(samples) / elapsed
+		}
+		logger.Infof("processed %d out of %d %s (%.1f%%) in %.3f seconds; imported %d series and %d samples (%.0f samples/sec) via %d requests with %d retries",
+			n, total, itemsName, percent, elapsed, series, samples, samplesPerSec, requests, retries)
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-t.C:
+				logProgress()
+			}
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-doneCh
+		logProgress()
+	}
+}
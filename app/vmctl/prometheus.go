@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/prometheus"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	promSnapshot = flag.String("prom.snapshot", "", "Path to Prometheus snapshot dir. "+
+		"See https://www.robustperception.io/taking-snapshots-of-prometheus-data on how to create a snapshot")
+	promFilterTimeStart = flag.String("prom.filterTimeStart", "", "Optional start time for the data to migrate from -prom.snapshot. "+
+		"It may be either RFC3339 time or unix timestamp in seconds. Blocks and samples before the given time are skipped")
+	promFilterTimeEnd = flag.String("prom.filterTimeEnd", "", "Optional end time for the data to migrate from -prom.snapshot. "+
+		"It may be either RFC3339 time or unix timestamp in seconds. Blocks and samples after the given time are skipped")
+	promConcurrency = flag.Int("prom.concurrency", 1, "The number of Prometheus blocks to read concurrently from -prom.snapshot")
+)
+
+func runPrometheus() error {
+	if len(*promSnapshot) == 0 {
+		return fmt.Errorf("missing `-prom.snapshot`")
+	}
+	minTime, err := parseTime(*promFilterTimeStart, math.MinInt64)
+	if err != nil {
+		return fmt.Errorf("cannot parse `-prom.filterTimeStart`: %w", err)
+	}
+	maxTime, err := parseTime(*promFilterTimeEnd, math.MaxInt64)
+	if err != nil {
+		return fmt.Errorf("cannot parse `-prom.filterTimeEnd`: %w", err)
+	}
+	allBlocks, err := prometheus.FindBlocks(*promSnapshot)
+	if err != nil {
+		return err
+	}
+	var blocks []*prometheus.Block
+	for _, b := range allBlocks {
+		// Prometheus block time range is half-open: [MinTime ... MaxTime)
+		if b.Meta.MaxTime <= minTime || b.Meta.MinTime > maxTime {
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	logger.Infof("found %d blocks in -prom.snapshot=%q; %d blocks match the time range from -prom.filterTimeStart and -prom.filterTimeEnd",
+		len(allBlocks), *promSnapshot, len(blocks))
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	im, err := newImporter()
+	if err != nil {
+		return err
+	}
+	return migrateItems(im, "blocks", len(blocks), *promConcurrency, func(idx int, bt *batcher) error {
+		b := blocks[idx]
+		if err := processPrometheusBlock(bt, b, minTime, maxTime); err != nil {
+			return fmt.Errorf("cannot process %s: %w", b, err)
+		}
+		return nil
+	})
+}
+
+func processPrometheusBlock(bt *batcher, b *prometheus.Block, minTime, maxTime int64) error {
+	return b.ForEachSeries(minTime, maxTime, func(s *prometheus.Series) error {
+		ts := &vm.TimeSeries{
+			Timestamps: append([]int64{}, s.Timestamps...),
+			Values:     append([]float64{}, s.Values...),
+		}
+		for _, label := range s.Labels {
+			if label.Name == "__name__" {
+				ts.Name = label.Value
+				continue
+			}
+			ts.Labels = append(ts.Labels, vm.Label{
+				Name:  label.Name,
+				Value: label.Value,
+			})
+		}
+		return bt.add(ts)
+	})
+}
@@ -0,0 +1,147 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Label is a single label for Series.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Series is a single time series read from Prometheus block.
+type Series struct {
+	// Labels contains all the series labels including __name__.
+	Labels []Label
+
+	Timestamps []int64
+	Values     []float64
+}
+
+// BlockMeta is meta information for Prometheus block.
+//
+// It is read from meta.json file in the block dir.
+type BlockMeta struct {
+	ULID    string `json:"ulid"`
+	MinTime int64  `json:"minTime"`
+	MaxTime int64  `json:"maxTime"`
+	Stats   struct {
+		NumSamples uint64 `json:"numSamples"`
+		NumSeries  uint64 `json:"numSeries"`
+		NumChunks  uint64 `json:"numChunks"`
+	} `json:"stats"`
+}
+
+// Block is Prometheus block stored in a dir.
+type Block struct {
+	Dir  string
+	Meta BlockMeta
+}
+
+// String returns human-readable representation for b.
+func (b *Block) String() string {
+	return fmt.Sprintf("block %q", b.Dir)
+}
+
+// FindBlocks returns Prometheus blocks from snapshotDir sorted by MinTime.
+//
+// Every subdirectory with meta.json file in snapshotDir is considered as a block.
+func FindBlocks(snapshotDir string) ([]*Block, error) {
+	fis, err := ioutil.ReadDir(snapshotDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read Prometheus snapshot dir: %w", err)
+	}
+	var blocks []*Block
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		dir := filepath.Join(snapshotDir, fi.Name())
+		data, err := ioutil.ReadFile(filepath.Join(dir, "meta.json"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Skip dirs without meta.json such as wal or chunks_head.
+				continue
+			}
+			return nil, err
+		}
+		b := &Block{
+			Dir: dir,
+		}
+		if err := json.Unmarshal(data, &b.Meta); err != nil {
+			return nil, fmt.Errorf("cannot parse meta.json for %s: %w", b, err)
+		}
+		blocks = append(blocks, b)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Meta.MinTime < blocks[j].Meta.MinTime
+	})
+	return blocks, nil
+}
+
+// ForEachSeries calls f for each series in b with samples on the time range [minTime ... maxTime].
+//
+// Deleted samples and staleness markers are skipped.
+// f mustn't hold s after returning.
+func (b *Block) ForEachSeries(minTime, maxTime int64, f func(s *Series) error) error {
+	ts, err := readTombstones(filepath.Join(b.Dir, "tombstones"))
+	if err != nil {
+		return err
+	}
+	ir, err := openIndex(filepath.Join(b.Dir, "index"))
+	if err != nil {
+		return err
+	}
+	defer ir.close()
+	cr, err := openChunks(filepath.Join(b.Dir, "chunks"))
+	if err != nil {
+		return fmt.Errorf("cannot open chunks for %s: %w", b, err)
+	}
+	defer cr.close()
+
+	var s Series
+	var chunkBuf []byte
+	return ir.forEachSeries(func(se *seriesEntry) error {
+		s.Labels = se.labels
+		s.Timestamps = s.Timestamps[:0]
+		s.Values = s.Values[:0]
+		for _, cm := range se.chunks {
+			if cm.maxTime < minTime || cm.minTime > maxTime {
+				continue
+			}
+			chunkBuf, err = cr.readChunk(chunkBuf[:0], cm.ref)
+			if err != nil {
+				return fmt.Errorf("cannot read chunk for series %v from %s: %w", se.labels, b, err)
+			}
+			s.Timestamps, s.Values, err = appendXORChunk(s.Timestamps, s.Values, chunkBuf)
+			if err != nil {
+				return fmt.Errorf("cannot decode chunk for series %v from %s: %w", se.labels, b, err)
+			}
+		}
+		s.filter(minTime, maxTime, ts[se.ref])
+		if len(s.Timestamps) == 0 {
+			return nil
+		}
+		return f(&s)
+	})
+}
+
+func (s *Series) filter(minTime, maxTime int64, deleted []interval) {
+	timestamps := s.Timestamps[:0]
+	values := s.Values[:0]
+	for i, t := range s.Timestamps {
+		if t < minTime || t > maxTime || isDeleted(deleted, t) {
+			continue
+		}
+		timestamps = append(timestamps, t)
+		values = append(values, s.Values[i])
+	}
+	s.Timestamps = timestamps
+	s.Values = values
+}
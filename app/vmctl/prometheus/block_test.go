@@ -0,0 +1,392 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testSeries is a series for writing into a test block.
+type testSeries struct {
+	labels []Label
+
+	// chunks contains samples per each chunk.
+	chunks [][]int64
+}
+
+// writeTestBlock writes Prometheus block with the given series and tombstones to dir in the same format as Prometheus does.
+//
+// Sample values are equal to sample timestamps.
+func writeTestBlock(t *testing.T, dir string, series []testSeries, deleted map[int][]interval) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, "chunks"), 0755); err != nil {
+		t.Fatalf("cannot create block dir: %s", err)
+	}
+	minTime, maxTime := int64(1<<63-1), int64(-1<<63)
+	numSamples := 0
+
+	// Write chunks.
+	chunks := make([]byte, chunksHeaderSize)
+	binary.BigEndian.PutUint32(chunks, chunksMagic)
+	chunks[4] = 1
+	chunkMetas := make([][]chunkMeta, len(series))
+	for i, s := range series {
+		for _, timestamps := range s.chunks {
+			values := make([]float64, len(timestamps))
+			for j, ts := range timestamps {
+				values[j] = float64(ts)
+			}
+			data := marshalXORChunk(timestamps, values)
+			cm := chunkMeta{
+				ref:     uint64(len(chunks)),
+				minTime: timestamps[0],
+				maxTime: timestamps[len(timestamps)-1],
+			}
+			chunkMetas[i] = append(chunkMetas[i], cm)
+			chunks = appendUvarint(chunks, uint64(len(data)))
+			start := len(chunks)
+			chunks = append(chunks, chunkEncodingXOR)
+			chunks = append(chunks, data...)
+			chunks = appendCRC32(chunks, chunks[start:])
+			if cm.minTime < minTime {
+				minTime = cm.minTime
+			}
+			if cm.maxTime > maxTime {
+				maxTime = cm.maxTime
+			}
+			numSamples += len(timestamps)
+		}
+	}
+	writeTestFile(t, filepath.Join(dir, "chunks", "000001"), chunks)
+
+	// Write index.
+	symbolsMap := make(map[string]struct{})
+	for _, s := range series {
+		for _, label := range s.labels {
+			symbolsMap[label.Name] = struct{}{}
+			symbolsMap[label.Value] = struct{}{}
+		}
+	}
+	var symbols []string
+	for symbol := range symbolsMap {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	symbolRefs := make(map[string]uint64, len(symbols))
+	for i, symbol := range symbols {
+		symbolRefs[symbol] = uint64(i)
+	}
+	index := make([]byte, 5)
+	binary.BigEndian.PutUint32(index, indexMagic)
+	index[4] = indexVersionV2
+	symbolsOffset := uint64(len(index))
+	var symbolsData []byte
+	symbolsData = appendUint32(symbolsData, uint32(len(symbols)))
+	for _, symbol := range symbols {
+		symbolsData = appendUvarint(symbolsData, uint64(len(symbol)))
+		symbolsData = append(symbolsData, symbol...)
+	}
+	index = appendUint32(index, uint32(len(symbolsData)))
+	index = append(index, symbolsData...)
+	index = appendCRC32(index, symbolsData)
+
+	seriesOffset := uint64(0)
+	seriesRefs := make([]uint64, len(series))
+	for i, s := range series {
+		for len(index)%seriesAlignment != 0 {
+			index = append(index, 0)
+		}
+		if i == 0 {
+			seriesOffset = uint64(len(index))
+		}
+		seriesRefs[i] = uint64(len(index) / seriesAlignment)
+		var entry []byte
+		entry = appendUvarint(entry, uint64(len(s.labels)))
+		for _, label := range s.labels {
+			entry = appendUvarint(entry, symbolRefs[label.Name])
+			entry = appendUvarint(entry, symbolRefs[label.Value])
+		}
+		entry = appendUvarint(entry, uint64(len(chunkMetas[i])))
+		var prev chunkMeta
+		for j, cm := range chunkMetas[i] {
+			if j == 0 {
+				entry = appendVarint(entry, cm.minTime)
+				entry = appendUvarint(entry, uint64(cm.maxTime-cm.minTime))
+				entry = appendUvarint(entry, cm.ref)
+			} else {
+				entry = appendUvarint(entry, uint64(cm.minTime-prev.maxTime))
+				entry = appendUvarint(entry, uint64(cm.maxTime-cm.minTime))
+				entry = appendVarint(entry, int64(cm.ref)-int64(prev.ref))
+			}
+			prev = cm
+		}
+		index = appendUvarint(index, uint64(len(entry)))
+		index = append(index, entry...)
+		index = appendCRC32(index, entry)
+	}
+	if len(series) == 0 {
+		seriesOffset = uint64(len(index))
+	}
+
+	// Label indices and postings aren't used by the reader, so they are left empty.
+	var toc []byte
+	for _, offset := range []uint64{symbolsOffset, seriesOffset, 0, 0, 0, 0} {
+		toc = appendUint64(toc, offset)
+	}
+	index = append(index, toc...)
+	index = appendCRC32(index, toc)
+	writeTestFile(t, filepath.Join(dir, "index"), index)
+
+	// Write tombstones.
+	tombstones := make([]byte, 5)
+	binary.BigEndian.PutUint32(tombstones, tombstonesMagic)
+	tombstones[4] = tombstonesVersion
+	var tombstonesData []byte
+	for i, intervals := range deleted {
+		for _, iv := range intervals {
+			tombstonesData = appendUvarint(tombstonesData, seriesRefs[i])
+			tombstonesData = appendVarint(tombstonesData, iv.minTime)
+			tombstonesData = appendVarint(tombstonesData, iv.maxTime)
+		}
+	}
+	tombstones = append(tombstones, tombstonesData...)
+	tombstones = appendCRC32(tombstones, tombstonesData)
+	writeTestFile(t, filepath.Join(dir, "tombstones"), tombstones)
+
+	// Write meta.json.
+	meta := fmt.Sprintf(`{"ulid":%q,"minTime":%d,"maxTime":%d,"stats":{"numSamples":%d,"numSeries":%d},"version":1}`,
+		filepath.Base(dir), minTime, maxTime+1, numSamples, len(series))
+	writeTestFile(t, filepath.Join(dir, "meta.json"), []byte(meta))
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("cannot write %q: %s", path, err)
+	}
+}
+
+func appendUvarint(dst []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(dst, buf[:n]...)
+}
+
+func appendVarint(dst []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(dst, buf[:n]...)
+}
+
+func appendUint32(dst []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(dst, buf[:]...)
+}
+
+func appendUint64(dst []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(dst, buf[:]...)
+}
+
+func appendCRC32(dst, data []byte) []byte {
+	return appendUint32(dst, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+}
+
+func newTestSnapshot(t *testing.T) string {
+	t.Helper()
+	snapshotDir, err := ioutil.TempDir("", "vmctl-prometheus-snapshot")
+	if err != nil {
+		t.Fatalf("cannot create snapshot dir: %s", err)
+	}
+	return snapshotDir
+}
+
+func readTestBlock(b *Block, minTime, maxTime int64) ([]string, error) {
+	var result []string
+	err := b.ForEachSeries(minTime, maxTime, func(s *Series) error {
+		var labels []string
+		for _, label := range s.Labels {
+			labels = append(labels, label.Name+"="+label.Value)
+		}
+		for i, ts := range s.Timestamps {
+			if s.Values[i] != float64(ts) {
+				return fmt.Errorf("unexpected value for timestamp %d; got %v; want %v", ts, s.Values[i], float64(ts))
+			}
+		}
+		result = append(result, fmt.Sprintf("{%s} %v", strings.Join(labels, ","), s.Timestamps))
+		return nil
+	})
+	return result, err
+}
+
+func TestBlockForEachSeries(t *testing.T) {
+	snapshotDir := newTestSnapshot(t)
+	defer func() {
+		_ = os.RemoveAll(snapshotDir)
+	}()
+	series := []testSeries{
+		{
+			labels: []Label{{"__name__", "up"}, {"job", "foo"}},
+			chunks: [][]int64{{1000, 2000, 3000}, {4000, 5000}},
+		},
+		{
+			labels: []Label{{"__name__", "up"}, {"job", "bar"}},
+			chunks: [][]int64{{1500, 2500, 3500, 4500}},
+		},
+		{
+			labels: []Label{{"__name__", "deleted"}},
+			chunks: [][]int64{{1000, 2000}},
+		},
+	}
+	deleted := map[int][]interval{
+		1: {{minTime: 2000, maxTime: 3000}},
+		2: {{minTime: 0, maxTime: 10000}},
+	}
+	laterSeries := []testSeries{
+		{
+			labels: []Label{{"__name__", "up"}, {"job", "foo"}},
+			chunks: [][]int64{{6000, 7000}},
+		},
+	}
+	writeTestBlock(t, filepath.Join(snapshotDir, "block2"), laterSeries, nil)
+	writeTestBlock(t, filepath.Join(snapshotDir, "block1"), series, deleted)
+	if err := os.MkdirAll(filepath.Join(snapshotDir, "wal"), 0755); err != nil {
+		t.Fatalf("cannot create wal dir: %s", err)
+	}
+
+	blocks, err := FindBlocks(snapshotDir)
+	if err != nil {
+		t.Fatalf("cannot find blocks: %s", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("unexpected number of blocks; got %d; want 2", len(blocks))
+	}
+	b := blocks[0]
+	if b.Meta.MinTime != 1000 || b.Meta.MaxTime != 5001 || b.Meta.Stats.NumSeries != 3 {
+		t.Fatalf("unexpected meta for the first block: %+v", b.Meta)
+	}
+	if blocks[1].Meta.MinTime != 6000 {
+		t.Fatalf("unexpected meta for the second block: %+v", blocks[1].Meta)
+	}
+
+	f := func(minTime, maxTime int64, resultExpected []string) {
+		t.Helper()
+		result, err := readTestBlock(b, minTime, maxTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected series on the time range [%d..%d]\ngot\n%q\nwant\n%q", minTime, maxTime, result, resultExpected)
+		}
+	}
+	f(0, 10000, []string{
+		"{__name__=up,job=foo} [1000 2000 3000 4000 5000]",
+		"{__name__=up,job=bar} [1500 3500 4500]",
+	})
+	f(2000, 4000, []string{
+		"{__name__=up,job=foo} [2000 3000 4000]",
+		"{__name__=up,job=bar} [3500]",
+	})
+	f(4600, 10000, []string{
+		"{__name__=up,job=foo} [5000]",
+	})
+	f(6000, 10000, nil)
+}
+
+func TestBlockForEachSeriesCorrupted(t *testing.T) {
+	snapshotDir := newTestSnapshot(t)
+	defer func() {
+		_ = os.RemoveAll(snapshotDir)
+	}()
+	series := []testSeries{
+		{
+			labels: []Label{{"__name__", "up"}, {"job", "foo"}},
+			chunks: [][]int64{{1000, 2000, 3000}},
+		},
+	}
+	dir := filepath.Join(snapshotDir, "block")
+	f := func(name string, corrupt func(data []byte) []byte) {
+		t.Helper()
+		writeTestBlock(t, dir, series, nil)
+		path := filepath.Join(dir, name)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read %q: %s", path, err)
+		}
+		writeTestFile(t, path, corrupt(data))
+		b := &Block{
+			Dir: dir,
+		}
+		if _, err := readTestBlock(b, 0, 10000); err == nil {
+			t.Fatalf("expecting non-nil error for corrupted %s", name)
+		}
+	}
+	putUvarint := func(data []byte, offset int, v uint64) []byte {
+		var buf [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(buf[:], v)
+		dst := append([]byte{}, data[:offset]...)
+		dst = append(dst, buf[:n]...)
+		return append(dst, data[offset+1:]...)
+	}
+
+	// Too big chunk length.
+	f("chunks/000001", func(data []byte) []byte {
+		return putUvarint(data, chunksHeaderSize, 1<<40)
+	})
+
+	// Truncated chunk.
+	f("chunks/000001", func(data []byte) []byte {
+		return data[:len(data)-6]
+	})
+
+	// Invalid magic for chunks.
+	f("chunks/000001", func(data []byte) []byte {
+		data[0] = 0
+		return data
+	})
+
+	// Too big symbols count.
+	f("index", func(data []byte) []byte {
+		binary.BigEndian.PutUint32(data[9:], 1<<31)
+		return data
+	})
+
+	// Too big symbols table size.
+	f("index", func(data []byte) []byte {
+		binary.BigEndian.PutUint32(data[5:], 1<<31)
+		return data
+	})
+
+	// Too big series entry length.
+	f("index", func(data []byte) []byte {
+		seriesOffset := binary.BigEndian.Uint64(data[len(data)-indexTOCSize+8:])
+		return putUvarint(data, int(seriesOffset), 1<<40)
+	})
+
+	// Series offset outside the index.
+	f("index", func(data []byte) []byte {
+		binary.BigEndian.PutUint64(data[len(data)-indexTOCSize+8:], 1<<40)
+		return data
+	})
+
+	// Invalid magic for index.
+	f("index", func(data []byte) []byte {
+		data[0] = 0
+		return data
+	})
+
+	// Invalid magic for tombstones.
+	f("tombstones", func(data []byte) []byte {
+		data[0] = 0
+		return data
+	})
+}
@@ -0,0 +1,111 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	chunksMagic         = 0x85BD40DD
+	chunksHeaderSize    = 8
+	chunkEncodingXOR    = 1
+	maxChunkLengthBytes = binary.MaxVarintLen32
+)
+
+// chunksReader reads chunks from Prometheus chunks dir.
+//
+// See https://github.com/prometheus/prometheus/blob/master/tsdb/docs/format/chunks.md
+type chunksReader struct {
+	files []*os.File
+	sizes []int64
+}
+
+func openChunks(dir string) (*chunksReader, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	cr := &chunksReader{}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		f, err := os.Open(path)
+		if err != nil {
+			cr.close()
+			return nil, err
+		}
+		cr.files = append(cr.files, f)
+		fi, err := f.Stat()
+		if err != nil {
+			cr.close()
+			return nil, err
+		}
+		cr.sizes = append(cr.sizes, fi.Size())
+		var header [chunksHeaderSize]byte
+		if _, err := f.ReadAt(header[:], 0); err != nil {
+			cr.close()
+			return nil, fmt.Errorf("cannot read header for %q: %w", path, err)
+		}
+		if magic := binary.BigEndian.Uint32(header[:]); magic != chunksMagic {
+			cr.close()
+			return nil, fmt.Errorf("invalid magic number 0x%X in %q; want 0x%X", magic, path, chunksMagic)
+		}
+	}
+	return cr, nil
+}
+
+func (cr *chunksReader) close() {
+	for _, f := range cr.files {
+		_ = f.Close()
+	}
+}
+
+// readChunk reads chunk data for the given ref into dst and returns the result.
+func (cr *chunksReader) readChunk(dst []byte, ref uint64) ([]byte, error) {
+	seq := int(ref >> 32)
+	offset := int64(ref & 0xFFFFFFFF)
+	if seq >= len(cr.files) {
+		return dst, fmt.Errorf("chunk segment #%d doesn't exist; segments count: %d", seq, len(cr.files))
+	}
+	f := cr.files[seq]
+	fileSize := cr.sizes[seq]
+	if offset < chunksHeaderSize || offset >= fileSize {
+		return dst, fmt.Errorf("chunk offset %d is out of the range [%d..%d) in %q", offset, chunksHeaderSize, fileSize, f.Name())
+	}
+	var lenBuf [maxChunkLengthBytes]byte
+	n, err := f.ReadAt(lenBuf[:], offset)
+	if n == 0 {
+		return dst, fmt.Errorf("cannot read chunk length at offset %d in %q: %w", offset, f.Name(), err)
+	}
+	size, k := binary.Uvarint(lenBuf[:n])
+	if k <= 0 {
+		return dst, fmt.Errorf("cannot decode chunk length at offset %d in %q", offset, f.Name())
+	}
+	// The chunk length is read from the file, so it must be checked before the allocation.
+	// The chunk is followed by the encoding byte and CRC32.
+	if maxSize := fileSize - offset - int64(k) - 1; size > uint64(maxSize) {
+		return dst, fmt.Errorf("chunk length %d at offset %d exceeds the remaining size %d bytes in %q", size, offset, maxSize, f.Name())
+	}
+	// Read encoding byte together with chunk data.
+	if uint64(cap(dst)) < size+1 {
+		dst = make([]byte, size+1)
+	}
+	dst = dst[:size+1]
+	if _, err := f.ReadAt(dst, offset+int64(k)); err != nil {
+		return dst, fmt.Errorf("cannot read chunk with size %d bytes at offset %d in %q: %w", size, offset, f.Name(), err)
+	}
+	if dst[0] != chunkEncodingXOR {
+		return dst, fmt.Errorf("unsupported chunk encoding %d at offset %d in %q; only XOR encoding is supported", dst[0], offset, f.Name())
+	}
+	return dst[1:], nil
+}
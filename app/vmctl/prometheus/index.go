@@ -0,0 +1,319 @@
+package prometheus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	indexMagic      = 0xBAAAD700
+	indexVersionV2  = 2
+	indexTOCSize    = 6*8 + 4
+	seriesAlignment = 16
+)
+
+// indexTOC is table of contents for Prometheus index file.
+type indexTOC struct {
+	symbols           uint64
+	series            uint64
+	labelIndices      uint64
+	labelIndicesTable uint64
+	postings          uint64
+	postingsTable     uint64
+}
+
+// chunkMeta is a reference to chunk data in chunks dir.
+type chunkMeta struct {
+	ref     uint64
+	minTime int64
+	maxTime int64
+}
+
+// seriesEntry is a series entry in Prometheus index file.
+type seriesEntry struct {
+	// ref is series reference, which is used in tombstones.
+	ref    uint64
+	labels []Label
+	chunks []chunkMeta
+}
+
+// indexReader reads Prometheus index file in v2 format.
+//
+// See https://github.com/prometheus/prometheus/blob/master/tsdb/docs/format/index.md
+type indexReader struct {
+	f       *os.File
+	size    int64
+	toc     indexTOC
+	symbols []string
+}
+
+func openIndex(path string) (*indexReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	ir, err := newIndexReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("cannot read index %q: %w", path, err)
+	}
+	return ir, nil
+}
+
+func newIndexReader(f *os.File) (*indexReader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < 5+indexTOCSize {
+		return nil, fmt.Errorf("too small index size: %d bytes", size)
+	}
+	var header [5]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+	if magic := binary.BigEndian.Uint32(header[:]); magic != indexMagic {
+		return nil, fmt.Errorf("invalid magic number 0x%X; want 0x%X", magic, indexMagic)
+	}
+	if header[4] != indexVersionV2 {
+		return nil, fmt.Errorf("unsupported index version %d; only version %d is supported", header[4], indexVersionV2)
+	}
+	var tocBuf [indexTOCSize]byte
+	if _, err := f.ReadAt(tocBuf[:], size-indexTOCSize); err != nil {
+		return nil, fmt.Errorf("cannot read TOC: %w", err)
+	}
+	ir := &indexReader{
+		f:    f,
+		size: size,
+		toc: indexTOC{
+			symbols:           binary.BigEndian.Uint64(tocBuf[0:]),
+			series:            binary.BigEndian.Uint64(tocBuf[8:]),
+			labelIndices:      binary.BigEndian.Uint64(tocBuf[16:]),
+			labelIndicesTable: binary.BigEndian.Uint64(tocBuf[24:]),
+			postings:          binary.BigEndian.Uint64(tocBuf[32:]),
+			postingsTable:     binary.BigEndian.Uint64(tocBuf[40:]),
+		},
+	}
+	tocOffset := uint64(size - indexTOCSize)
+	if ir.toc.symbols < 5 || ir.toc.symbols >= tocOffset {
+		return nil, fmt.Errorf("symbols table offset %d is out of the range [5..%d)", ir.toc.symbols, tocOffset)
+	}
+	if ir.toc.series < 5 || ir.toc.series > tocOffset {
+		return nil, fmt.Errorf("series offset %d is out of the range [5..%d]", ir.toc.series, tocOffset)
+	}
+	if err := ir.readSymbols(); err != nil {
+		return nil, fmt.Errorf("cannot read symbols: %w", err)
+	}
+	return ir, nil
+}
+
+func (ir *indexReader) close() {
+	_ = ir.f.Close()
+}
+
+func (ir *indexReader) readSymbols() error {
+	var buf [8]byte
+	if _, err := ir.f.ReadAt(buf[:], int64(ir.toc.symbols)); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(buf[:])
+	count := binary.BigEndian.Uint32(buf[4:])
+	if size < 4 || int64(ir.toc.symbols)+4+int64(size) > ir.size {
+		return fmt.Errorf("invalid symbols table size %d for index size %d", size, ir.size)
+	}
+	// Every symbol occupies at least a byte, so the number of symbols cannot exceed the table size.
+	// This prevents from big allocations for corrupted count.
+	if count > size-4 {
+		return fmt.Errorf("symbols count %d exceeds symbols table size %d", count, size)
+	}
+	br := bufio.NewReaderSize(io.NewSectionReader(ir.f, int64(ir.toc.symbols)+8, int64(size)-4), 64*1024)
+	symbols := make([]string, 0, count)
+	var b []byte
+	for i := uint32(0); i < count; i++ {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return fmt.Errorf("cannot read symbol #%d length: %w", i, err)
+		}
+		if n > uint64(size) {
+			return fmt.Errorf("symbol #%d length %d exceeds symbols table size %d", i, n, size)
+		}
+		if uint64(cap(b)) < n {
+			b = make([]byte, n)
+		}
+		b = b[:n]
+		if _, err := io.ReadFull(br, b); err != nil {
+			return fmt.Errorf("cannot read symbol #%d: %w", i, err)
+		}
+		symbols = append(symbols, string(b))
+	}
+	ir.symbols = symbols
+	return nil
+}
+
+func (ir *indexReader) symbol(ref uint64) (string, error) {
+	if ref >= uint64(len(ir.symbols)) {
+		return "", fmt.Errorf("symbol reference %d exceeds symbols count %d", ref, len(ir.symbols))
+	}
+	return ir.symbols[ref], nil
+}
+
+// seriesEnd returns the end offset for the series section.
+func (ir *indexReader) seriesEnd() int64 {
+	end := ir.size - indexTOCSize
+	for _, offset := range []uint64{ir.toc.labelIndices, ir.toc.labelIndicesTable, ir.toc.postings, ir.toc.postingsTable} {
+		if offset > ir.toc.series && int64(offset) < end {
+			end = int64(offset)
+		}
+	}
+	return end
+}
+
+// forEachSeries calls f for each series in the index.
+func (ir *indexReader) forEachSeries(f func(se *seriesEntry) error) error {
+	start := int64(ir.toc.series)
+	end := ir.seriesEnd()
+	br := bufio.NewReaderSize(io.NewSectionReader(ir.f, start, end-start), 64*1024)
+	cr := &countingReader{
+		br: br,
+	}
+	pos := start
+	var se seriesEntry
+	var b []byte
+	for {
+		// Series entries are aligned to 16 bytes.
+		if padding := (seriesAlignment - pos%seriesAlignment) % seriesAlignment; padding > 0 {
+			if _, err := br.Discard(int(padding)); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			pos += padding
+		}
+		if pos >= end {
+			return nil
+		}
+		cr.n = 0
+		n, err := binary.ReadUvarint(cr)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("cannot read series entry length at offset %d: %w", pos, err)
+		}
+		if n == 0 {
+			// Zero padding at the end of series section.
+			return nil
+		}
+		// The series entry is followed by CRC32.
+		if maxSize := end - pos - int64(cr.n) - 4; n > uint64(maxSize) {
+			return fmt.Errorf("series entry length %d at offset %d exceeds the remaining size %d bytes of series section", n, pos, maxSize)
+		}
+		if uint64(cap(b)) < n+4 {
+			b = make([]byte, n+4)
+		}
+		b = b[:n+4]
+		if _, err := io.ReadFull(br, b); err != nil {
+			return fmt.Errorf("cannot read series entry at offset %d: %w", pos, err)
+		}
+		if err := ir.unmarshalSeries(&se, b[:n]); err != nil {
+			return fmt.Errorf("cannot unmarshal series entry at offset %d: %w", pos, err)
+		}
+		se.ref = uint64(pos / seriesAlignment)
+		if err := f(&se); err != nil {
+			return err
+		}
+		pos += int64(cr.n) + int64(n) + 4
+	}
+}
+
+func (ir *indexReader) unmarshalSeries(se *seriesEntry, b []byte) error {
+	d := &decbuf{
+		b: b,
+	}
+	labelsCount := d.uvarint()
+	se.labels = se.labels[:0]
+	for i := uint64(0); i < labelsCount && d.err == nil; i++ {
+		name, err := ir.symbol(d.uvarint())
+		if err != nil {
+			return err
+		}
+		value, err := ir.symbol(d.uvarint())
+		if err != nil {
+			return err
+		}
+		se.labels = append(se.labels, Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	chunksCount := d.uvarint()
+	se.chunks = se.chunks[:0]
+	var prev chunkMeta
+	for i := uint64(0); i < chunksCount && d.err == nil; i++ {
+		var cm chunkMeta
+		if i == 0 {
+			cm.minTime = d.varint()
+			cm.maxTime = cm.minTime + int64(d.uvarint())
+			cm.ref = d.uvarint()
+		} else {
+			cm.minTime = prev.maxTime + int64(d.uvarint())
+			cm.maxTime = cm.minTime + int64(d.uvarint())
+			cm.ref = uint64(int64(prev.ref) + d.varint())
+		}
+		se.chunks = append(se.chunks, cm)
+		prev = cm
+	}
+	return d.err
+}
+
+type countingReader struct {
+	br *bufio.Reader
+	n  int
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.br.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
+
+// decbuf decodes varints from b.
+//
+// The first error is stored in err, while the subsequent calls return zero values.
+type decbuf struct {
+	b   []byte
+	err error
+}
+
+func (d *decbuf) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = fmt.Errorf("cannot decode uvarint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decbuf) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = fmt.Errorf("cannot decode varint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
@@ -0,0 +1,71 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	tombstonesMagic   = 0x0130BA30
+	tombstonesVersion = 1
+)
+
+// interval is a time range with deleted samples.
+type interval struct {
+	minTime int64
+	maxTime int64
+}
+
+// tombstones contains deleted intervals per each series ref.
+type tombstones map[uint64][]interval
+
+// readTombstones reads Prometheus tombstones file at path.
+//
+// Empty tombstones are returned if the file doesn't exist.
+func readTombstones(path string) (tombstones, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(data) < 5+4 {
+		return nil, fmt.Errorf("too small tombstones file %q: %d bytes", path, len(data))
+	}
+	if magic := binary.BigEndian.Uint32(data); magic != tombstonesMagic {
+		return nil, fmt.Errorf("invalid magic number 0x%X in %q; want 0x%X", magic, path, tombstonesMagic)
+	}
+	if data[4] != tombstonesVersion {
+		return nil, fmt.Errorf("unsupported tombstones version %d in %q", data[4], path)
+	}
+	// Skip the header and the trailing CRC32.
+	d := &decbuf{
+		b: data[5 : len(data)-4],
+	}
+	ts := make(tombstones)
+	for len(d.b) > 0 && d.err == nil {
+		ref := d.uvarint()
+		minTime := d.varint()
+		maxTime := d.varint()
+		ts[ref] = append(ts[ref], interval{
+			minTime: minTime,
+			maxTime: maxTime,
+		})
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("cannot parse tombstones from %q: %w", path, d.err)
+	}
+	return ts, nil
+}
+
+func isDeleted(intervals []interval, t int64) bool {
+	for _, iv := range intervals {
+		if t >= iv.minTime && t <= iv.maxTime {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// staleNaNBits is the bit representation of Prometheus staleness marker.
+const staleNaNBits = 0x7ff0000000000002
+
+// bstreamReader reads bits from Prometheus bit stream.
+type bstreamReader struct {
+	b      []byte
+	bitPos int
+}
+
+func (br *bstreamReader) readBit() (uint64, error) {
+	n := br.bitPos >> 3
+	if n >= len(br.b) {
+		return 0, io.EOF
+	}
+	bit := uint64(br.b[n]>>(7-uint(br.bitPos&7))) & 1
+	br.bitPos++
+	return bit, nil
+}
+
+func (br *bstreamReader) readBits(nbits int) (uint64, error) {
+	var u uint64
+	for nbits > 0 {
+		n := br.bitPos >> 3
+		if n >= len(br.b) {
+			return 0, io.EOF
+		}
+		// Read up to the end of the current byte at once.
+		bitsLeft := 8 - br.bitPos&7
+		if bitsLeft > nbits {
+			bitsLeft = nbits
+		}
+		shift := uint(8 - br.bitPos&7 - bitsLeft)
+		bits := uint64(br.b[n]>>shift) & (1<<uint(bitsLeft) - 1)
+		u = u<<uint(bitsLeft) | bits
+		br.bitPos += bitsLeft
+		nbits -= bitsLeft
+	}
+	return u, nil
+}
+
+// ReadByte implements io.ByteReader.
+func (br *bstreamReader) ReadByte() (byte, error) {
+	u, err := br.readBits(8)
+	return byte(u), err
+}
+
+// appendXORChunk decodes samples from Prometheus XOR-encoded chunk data and appends them to dstTimestamps and dstValues.
+//
+// Prometheus staleness markers are skipped.
+func appendXORChunk(dstTimestamps []int64, dstValues []float64, data []byte) ([]int64, []float64, error) {
+	if len(data) < 2 {
+		return dstTimestamps, dstValues, fmt.Errorf("too short XOR chunk; got %d bytes; want at least 2 bytes", len(data))
+	}
+	samplesCount := int(binary.BigEndian.Uint16(data))
+	br := &bstreamReader{
+		b: data[2:],
+	}
+	var t, tDelta int64
+	var vBits uint64
+	var leading, trailing uint64
+	for i := 0; i < samplesCount; i++ {
+		switch i {
+		case 0:
+			ts, err := binary.ReadVarint(br)
+			if err != nil {
+				return dstTimestamps, dstValues, fmt.Errorf("cannot read the first timestamp: %w", err)
+			}
+			v, err := br.readBits(64)
+			if err != nil {
+				return dstTimestamps, dstValues, fmt.Errorf("cannot read the first value: %w", err)
+			}
+			t = ts
+			vBits = v
+		case 1:
+			d, err := binary.ReadUvarint(br)
+			if err != nil {
+				return dstTimestamps, dstValues, fmt.Errorf("cannot read the second timestamp delta: %w", err)
+			}
+			tDelta = int64(d)
+			t += tDelta
+			if err := readXORValue(br, &vBits, &leading, &trailing); err != nil {
+				return dstTimestamps, dstValues, fmt.Errorf("cannot read value #%d: %w", i, err)
+			}
+		default:
+			dod, err := readDeltaOfDelta(br)
+			if err != nil {
+				return dstTimestamps, dstValues, fmt.Errorf("cannot read timestamp #%d: %w", i, err)
+			}
+			tDelta += dod
+			t += tDelta
+			if err := readXORValue(br, &vBits, &leading, &trailing); err != nil {
+				return dstTimestamps, dstValues, fmt.Errorf("cannot read value #%d: %w", i, err)
+			}
+		}
+		if vBits == staleNaNBits {
+			continue
+		}
+		dstTimestamps = append(dstTimestamps, t)
+		dstValues = append(dstValues, math.Float64frombits(vBits))
+	}
+	return dstTimestamps, dstValues, nil
+}
+
+func readDeltaOfDelta(br *bstreamReader) (int64, error) {
+	var d byte
+	for i := 0; i < 4; i++ {
+		d <<= 1
+		bit, err := br.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			break
+		}
+		d |= 1
+	}
+	var nbits int
+	switch d {
+	case 0x00:
+		return 0, nil
+	case 0x02:
+		nbits = 14
+	case 0x06:
+		nbits = 17
+	case 0x0e:
+		nbits = 20
+	case 0x0f:
+		bits, err := br.readBits(64)
+		if err != nil {
+			return 0, err
+		}
+		return int64(bits), nil
+	}
+	bits, err := br.readBits(nbits)
+	if err != nil {
+		return 0, err
+	}
+	if bits > 1<<uint(nbits-1) {
+		// Negative delta of delta.
+		bits -= 1 << uint(nbits)
+	}
+	return int64(bits), nil
+}
+
+func readXORValue(br *bstreamReader, vBits, leading, trailing *uint64) error {
+	bit, err := br.readBit()
+	if err != nil {
+		return err
+	}
+	if bit == 0 {
+		// The value didn't change.
+		return nil
+	}
+	bit, err = br.readBit()
+	if err != nil {
+		return err
+	}
+	if bit != 0 {
+		// New leading and trailing zeros.
+		l, err := br.readBits(5)
+		if err != nil {
+			return err
+		}
+		sigBits, err := br.readBits(6)
+		if err != nil {
+			return err
+		}
+		if sigBits == 0 {
+			// 64 significant bits are encoded as 0, since they do not fit 6 bits.
+			sigBits = 64
+		}
+		if l+sigBits > 64 {
+			return fmt.Errorf("invalid number of leading zeros %d and significant bits %d; their sum mustn't exceed 64", l, sigBits)
+		}
+		*leading = l
+		*trailing = 64 - l - sigBits
+	}
+	sigBits := 64 - *leading - *trailing
+	bits, err := br.readBits(int(sigBits))
+	if err != nil {
+		return err
+	}
+	*vBits ^= bits << *trailing
+	return nil
+}
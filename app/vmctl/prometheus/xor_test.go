@@ -0,0 +1,178 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestAppendXORChunk(t *testing.T) {
+	f := func(timestamps []int64, values []float64) {
+		t.Helper()
+		data := marshalXORChunk(timestamps, values)
+		timestampsGot, valuesGot, err := appendXORChunk(nil, nil, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var timestampsExpected []int64
+		var valuesExpected []float64
+		for i, v := range values {
+			if math.Float64bits(v) == staleNaNBits {
+				continue
+			}
+			timestampsExpected = append(timestampsExpected, timestamps[i])
+			valuesExpected = append(valuesExpected, v)
+		}
+		if !reflect.DeepEqual(timestampsGot, timestampsExpected) {
+			t.Fatalf("unexpected timestamps\ngot\n%v\nwant\n%v", timestampsGot, timestampsExpected)
+		}
+		if !reflect.DeepEqual(valuesGot, valuesExpected) {
+			t.Fatalf("unexpected values\ngot\n%v\nwant\n%v", valuesGot, valuesExpected)
+		}
+	}
+
+	f([]int64{1600000000000}, []float64{1.5})
+	f([]int64{1600000000000, 1600000015000}, []float64{1.5, -2.25})
+	f([]int64{1, 2, 3, 4}, []float64{0, 0, 0, 0})
+	f([]int64{-100, 0, 1e6, 1e6 + 1, 1e12}, []float64{1, math.Inf(1), math.Inf(-1), 3, 1e300})
+	f([]int64{10, 20, 30}, []float64{1, math.Float64frombits(staleNaNBits), 2})
+
+	// Random data with various timestamp deltas and values.
+	r := rand.New(rand.NewSource(1))
+	var timestamps []int64
+	var values []float64
+	ts := int64(1600000000000)
+	for i := 0; i < 1000; i++ {
+		switch r.Intn(4) {
+		case 0:
+			ts += 15000
+		case 1:
+			ts += 15000 + int64(r.Intn(100000)) - 50000
+		case 2:
+			ts += int64(r.Intn(1 << 20))
+		default:
+			ts += int64(r.Intn(1 << 40))
+		}
+		timestamps = append(timestamps, ts)
+		switch r.Intn(3) {
+		case 0:
+			values = append(values, float64(r.Intn(100)))
+		case 1:
+			values = append(values, r.NormFloat64()*1e6)
+		default:
+			if len(values) > 0 {
+				values = append(values, values[len(values)-1])
+			} else {
+				values = append(values, 0)
+			}
+		}
+	}
+	f(timestamps, values)
+}
+
+// marshalXORChunk encodes timestamps and values in the same way as Prometheus XOR chunk encoder does.
+func marshalXORChunk(timestamps []int64, values []float64) []byte {
+	bw := &bstreamWriter{}
+	var t, tDelta int64
+	var v float64
+	leading := uint8(0xff)
+	trailing := uint8(0)
+	writeValue := func(vNew float64) {
+		delta := math.Float64bits(vNew) ^ math.Float64bits(v)
+		if delta == 0 {
+			bw.writeBit(0)
+			return
+		}
+		bw.writeBit(1)
+		l := uint8(bits.LeadingZeros64(delta))
+		tr := uint8(bits.TrailingZeros64(delta))
+		if l >= 32 {
+			l = 31
+		}
+		if leading != 0xff && l >= leading && tr >= trailing {
+			bw.writeBit(0)
+			bw.writeBits(delta>>trailing, 64-int(leading)-int(trailing))
+			return
+		}
+		leading, trailing = l, tr
+		bw.writeBit(1)
+		bw.writeBits(uint64(l), 5)
+		sigBits := 64 - l - tr
+		bw.writeBits(uint64(sigBits), 6)
+		bw.writeBits(delta>>tr, int(sigBits))
+	}
+	var buf [binary.MaxVarintLen64]byte
+	for i := range timestamps {
+		tNew := timestamps[i]
+		vNew := values[i]
+		switch i {
+		case 0:
+			n := binary.PutVarint(buf[:], tNew)
+			for _, b := range buf[:n] {
+				bw.writeBits(uint64(b), 8)
+			}
+			bw.writeBits(math.Float64bits(vNew), 64)
+		case 1:
+			tDelta = tNew - t
+			n := binary.PutUvarint(buf[:], uint64(tDelta))
+			for _, b := range buf[:n] {
+				bw.writeBits(uint64(b), 8)
+			}
+			writeValue(vNew)
+		default:
+			tDeltaNew := tNew - t
+			dod := tDeltaNew - tDelta
+			switch {
+			case dod == 0:
+				bw.writeBit(0)
+			case bitRange(dod, 14):
+				bw.writeBits(0x02, 2)
+				bw.writeBits(uint64(dod), 14)
+			case bitRange(dod, 17):
+				bw.writeBits(0x06, 3)
+				bw.writeBits(uint64(dod), 17)
+			case bitRange(dod, 20):
+				bw.writeBits(0x0e, 4)
+				bw.writeBits(uint64(dod), 20)
+			default:
+				bw.writeBits(0x0f, 4)
+				bw.writeBits(uint64(dod), 64)
+			}
+			tDelta = tDeltaNew
+			writeValue(vNew)
+		}
+		t = tNew
+		v = vNew
+	}
+	data := make([]byte, 2, 2+len(bw.b))
+	binary.BigEndian.PutUint16(data, uint16(len(timestamps)))
+	return append(data, bw.b...)
+}
+
+func bitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+type bstreamWriter struct {
+	b      []byte
+	bitPos int
+}
+
+func (bw *bstreamWriter) writeBit(bit uint64) {
+	if bw.bitPos&7 == 0 {
+		bw.b = append(bw.b, 0)
+	}
+	if bit != 0 {
+		bw.b[len(bw.b)-1] |= 1 << (7 - uint(bw.bitPos&7))
+	}
+	bw.bitPos++
+}
+
+func (bw *bstreamWriter) writeBits(u uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		bw.writeBit((u >> uint(i)) & 1)
+	}
+}
@@ -0,0 +1,272 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// maxRowsPerBlock is the maximum number of rows per native block accepted by /api/v1/import/native.
+const maxRowsPerBlock = 8 * 1024
+
+// Label is a single label for TimeSeries.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// TimeSeries is a time series to import into VictoriaMetrics.
+type TimeSeries struct {
+	// Name is the metric name.
+	Name string
+
+	// Labels contains labels for the time series except of the metric name.
+	Labels []Label
+
+	Timestamps []int64
+	Values     []float64
+}
+
+// Config is the configuration for Importer.
+type Config struct {
+	// Addr is VictoriaMetrics address to import data to. For example, http://victoriametrics:8428
+	Addr string
+
+	// User and Password are optional basic auth credentials for Addr.
+	User     string
+	Password string
+
+	// ExtraLabels are added to all the imported time series.
+	ExtraLabels []Label
+
+	// RelabelConfigs are applied to all the imported time series before adding ExtraLabels.
+	//
+	// Time series are dropped if relabeling removes all their labels.
+	RelabelConfigs []promrelabel.ParsedRelabelConfig
+
+	// MaxRetries is the maximum number of retries for each import request.
+	MaxRetries int
+}
+
+// Importer imports time series into VictoriaMetrics via /api/v1/import/native.
+//
+// Importer is safe for concurrent use.
+type Importer struct {
+	cfg       Config
+	importURL string
+	client    *http.Client
+
+	// streamClient is used for streaming imports, which may take long time.
+	streamClient *http.Client
+
+	samplesImported uint64
+	seriesImported  uint64
+	requests        uint64
+	retries         uint64
+}
+
+// NewImporter returns new Importer for the given cfg.
+func NewImporter(cfg Config) (*Importer, error) {
+	if len(cfg.Addr) == 0 {
+		return nil, fmt.Errorf("VictoriaMetrics address cannot be empty")
+	}
+	if !strings.HasPrefix(cfg.Addr, "http://") && !strings.HasPrefix(cfg.Addr, "https://") {
+		return nil, fmt.Errorf("VictoriaMetrics address must start with `http://` or `https://`; got %q", cfg.Addr)
+	}
+	return &Importer{
+		cfg:       cfg,
+		importURL: strings.TrimSuffix(cfg.Addr, "/") + "/api/v1/import/native",
+		client: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+		streamClient: &http.Client{},
+	}, nil
+}
+
+// Stats returns the number of imported series, samples, import requests and retries.
+func (im *Importer) Stats() (series, samples, requests, retries uint64) {
+	return atomic.LoadUint64(&im.seriesImported), atomic.LoadUint64(&im.samplesImported),
+		atomic.LoadUint64(&im.requests), atomic.LoadUint64(&im.retries)
+}
+
+// Import imports tss into VictoriaMetrics.
+//
+// The import request is retried up to Config.MaxRetries times on errors.
+func (im *Importer) Import(tss []*TimeSeries) error {
+	samples := 0
+	for _, ts := range tss {
+		samples += len(ts.Timestamps)
+	}
+	if samples == 0 {
+		return nil
+	}
+	data := im.marshalNative(nil, tss)
+	retryDuration := time.Second
+	for i := 0; ; i++ {
+		err := im.send(data)
+		if err == nil {
+			break
+		}
+		if i >= im.cfg.MaxRetries {
+			return fmt.Errorf("cannot import %d series with %d samples after %d retries: %w", len(tss), samples, i, err)
+		}
+		atomic.AddUint64(&im.retries, 1)
+		logger.Warnf("cannot import %d series with %d samples: %s; retrying in %.3f seconds", len(tss), samples, err, retryDuration.Seconds())
+		time.Sleep(retryDuration)
+		retryDuration *= 2
+		if retryDuration > time.Minute {
+			retryDuration = time.Minute
+		}
+	}
+	atomic.AddUint64(&im.seriesImported, uint64(len(tss)))
+	atomic.AddUint64(&im.samplesImported, uint64(samples))
+	return nil
+}
+
+func (im *Importer) send(data []byte) error {
+	return im.doRequest(im.client, im.importURL, bytes.NewReader(data))
+}
+
+// ImportNative imports data in native format from r into VictoriaMetrics.
+//
+// r must contain data obtained from /api/v1/export/native. Config.RelabelConfigs are applied to metric names from r
+// while streaming the data. Config.ExtraLabels are passed via `extra_label` query args.
+// The import isn't retried, since r cannot be re-read. It is up to the caller to re-open r and to retry the import.
+func (im *Importer) ImportNative(r io.Reader) error {
+	if len(im.cfg.RelabelConfigs) > 0 {
+		rr := newRelabelNativeReader(r, im.cfg.RelabelConfigs)
+		defer func() {
+			_ = rr.Close()
+		}()
+		r = rr
+	}
+	u := im.importURL
+	if len(im.cfg.ExtraLabels) > 0 {
+		args := url.Values{}
+		for _, label := range im.cfg.ExtraLabels {
+			args.Add("extra_label", label.Name+"="+label.Value)
+		}
+		u += "?" + args.Encode()
+	}
+	return im.doRequest(im.streamClient, u, r)
+}
+
+// AddRetry registers a retry for import request, which was performed by the caller.
+func (im *Importer) AddRetry() {
+	atomic.AddUint64(&im.retries, 1)
+}
+
+func (im *Importer) doRequest(c *http.Client, u string, body io.Reader) error {
+	atomic.AddUint64(&im.requests, 1)
+	req, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return fmt.Errorf("cannot create request to %q: %w", u, err)
+	}
+	if len(im.cfg.User) > 0 || len(im.cfg.Password) > 0 {
+		req.SetBasicAuth(im.cfg.User, im.cfg.Password)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request to %q: %w", u, err)
+	}
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response code from %q: %d; response body: %q", u, resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// marshalNative appends tss in the format accepted by /api/v1/import/native to dst and returns the result.
+func (im *Importer) marshalNative(dst []byte, tss []*TimeSeries) []byte {
+	tr := storage.TimeRange{
+		MinTimestamp: math.MaxInt64,
+		MaxTimestamp: math.MinInt64,
+	}
+	for _, ts := range tss {
+		if !sort.IsSorted(ts) {
+			sort.Stable(ts)
+		}
+		if len(ts.Timestamps) == 0 {
+			continue
+		}
+		if ts.Timestamps[0] < tr.MinTimestamp {
+			tr.MinTimestamp = ts.Timestamps[0]
+		}
+		if ts.Timestamps[len(ts.Timestamps)-1] > tr.MaxTimestamp {
+			tr.MaxTimestamp = ts.Timestamps[len(ts.Timestamps)-1]
+		}
+	}
+	dst = encoding.MarshalInt64(dst, tr.MinTimestamp)
+	dst = encoding.MarshalInt64(dst, tr.MaxTimestamp)
+
+	var mn storage.MetricName
+	var b storage.Block
+	var tsid storage.TSID
+	var mnBuf, blockBuf []byte
+	var va []int64
+	rl := &relabeler{
+		prcs: im.cfg.RelabelConfigs,
+	}
+	for _, ts := range tss {
+		mn.Reset()
+		mn.MetricGroup = append(mn.MetricGroup[:0], ts.Name...)
+		for _, label := range ts.Labels {
+			mn.AddTag(label.Name, label.Value)
+		}
+		if len(rl.prcs) > 0 && !rl.relabel(&mn) {
+			continue
+		}
+		for _, label := range im.cfg.ExtraLabels {
+			mn.AddTag(label.Name, label.Value)
+		}
+		mnBuf = mn.Marshal(mnBuf[:0])
+		timestamps := ts.Timestamps
+		values := ts.Values
+		for len(timestamps) > 0 {
+			n := maxRowsPerBlock
+			if n > len(timestamps) {
+				n = len(timestamps)
+			}
+			var scale int16
+			va, scale = decimal.AppendFloatToDecimal(va[:0], values[:n])
+			b.Init(&tsid, timestamps[:n], va, scale, 64)
+			blockBuf = b.MarshalPortable(blockBuf[:0])
+
+			dst = encoding.MarshalUint32(dst, uint32(len(mnBuf)))
+			dst = append(dst, mnBuf...)
+			dst = encoding.MarshalUint32(dst, uint32(len(blockBuf)))
+			dst = append(dst, blockBuf...)
+
+			timestamps = timestamps[n:]
+			values = values[n:]
+		}
+	}
+	return dst
+}
+
+// Len implements sort.Interface
+func (ts *TimeSeries) Len() int { return len(ts.Timestamps) }
+
+// Less implements sort.Interface
+func (ts *TimeSeries) Less(i, j int) bool { return ts.Timestamps[i] < ts.Timestamps[j] }
+
+// Swap implements sort.Interface
+func (ts *TimeSeries) Swap(i, j int) {
+	ts.Timestamps[i], ts.Timestamps[j] = ts.Timestamps[j], ts.Timestamps[i]
+	ts.Values[i], ts.Values[j] = ts.Values[j], ts.Values[i]
+}
@@ -0,0 +1,148 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// The maximum sizes for metric name and block in the native format. They must match the limits in lib/protoparser/native.
+const (
+	maxNativeMetricNameSize = 1024 * 1024
+	maxNativeBlockSize      = 16 * 1024 * 1024
+)
+
+// relabeler applies relabeling to metric names.
+//
+// relabeler isn't safe for concurrent use.
+type relabeler struct {
+	prcs   []promrelabel.ParsedRelabelConfig
+	labels []prompbmarshal.Label
+}
+
+// relabel applies rl.prcs to mn.
+//
+// It returns false if mn must be dropped.
+func (rl *relabeler) relabel(mn *storage.MetricName) bool {
+	labels := rl.labels[:0]
+	if len(mn.MetricGroup) > 0 {
+		labels = append(labels, prompbmarshal.Label{
+			Name:  "__name__",
+			Value: string(mn.MetricGroup),
+		})
+	}
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		labels = append(labels, prompbmarshal.Label{
+			Name:  string(tag.Key),
+			Value: string(tag.Value),
+		})
+	}
+	labels = promrelabel.ApplyRelabelConfigs(labels, 0, rl.prcs, true)
+	rl.labels = labels
+	if len(labels) == 0 {
+		return false
+	}
+	mn.Reset()
+	for _, label := range labels {
+		if label.Name == "__name__" {
+			mn.MetricGroup = append(mn.MetricGroup[:0], label.Value...)
+		} else {
+			mn.AddTag(label.Name, label.Value)
+		}
+	}
+	return true
+}
+
+// relabelNative reads data in native format from r, applies prcs to metric names and writes the result to w.
+//
+// Blocks for dropped metric names are skipped. Data blocks are copied as is.
+func relabelNative(w io.Writer, r io.Reader, prcs []promrelabel.ParsedRelabelConfig) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	bw := bufio.NewWriterSize(w, 64*1024)
+	rl := &relabeler{
+		prcs: prcs,
+	}
+
+	// Copy time range
+	trBuf := make([]byte, 16)
+	if _, err := io.ReadFull(br, trBuf); err != nil {
+		return fmt.Errorf("cannot read time range: %w", err)
+	}
+	if _, err := bw.Write(trBuf); err != nil {
+		return err
+	}
+
+	var mn storage.MetricName
+	var mnBuf, blockBuf []byte
+	sizeBuf := make([]byte, 4)
+	for {
+		// Read metricName
+		if _, err := io.ReadFull(br, sizeBuf); err != nil {
+			if err == io.EOF {
+				// End of stream
+				return bw.Flush()
+			}
+			return fmt.Errorf("cannot read metricName size: %w", err)
+		}
+		bufSize := encoding.UnmarshalUint32(sizeBuf)
+		if bufSize > maxNativeMetricNameSize {
+			return fmt.Errorf("too big metricName size; got %d; shouldn't exceed %d", bufSize, maxNativeMetricNameSize)
+		}
+		mnBuf = bytesutil.Resize(mnBuf, int(bufSize))
+		if _, err := io.ReadFull(br, mnBuf); err != nil {
+			return fmt.Errorf("cannot read metricName with size %d bytes: %w", bufSize, err)
+		}
+		if err := mn.Unmarshal(mnBuf); err != nil {
+			return fmt.Errorf("cannot unmarshal metricName from %d bytes: %w", bufSize, err)
+		}
+
+		// Read block
+		if _, err := io.ReadFull(br, sizeBuf); err != nil {
+			return fmt.Errorf("cannot read native block size: %w", err)
+		}
+		bufSize = encoding.UnmarshalUint32(sizeBuf)
+		if bufSize > maxNativeBlockSize {
+			return fmt.Errorf("too big native block size; got %d; shouldn't exceed %d", bufSize, maxNativeBlockSize)
+		}
+		blockBuf = bytesutil.Resize(blockBuf, int(bufSize))
+		if _, err := io.ReadFull(br, blockBuf); err != nil {
+			return fmt.Errorf("cannot read native block with size %d bytes: %w", bufSize, err)
+		}
+
+		if !rl.relabel(&mn) {
+			continue
+		}
+		mnBuf = mn.Marshal(mnBuf[:0])
+		if _, err := bw.Write(encoding.MarshalUint32(sizeBuf[:0], uint32(len(mnBuf)))); err != nil {
+			return err
+		}
+		if _, err := bw.Write(mnBuf); err != nil {
+			return err
+		}
+		if _, err := bw.Write(encoding.MarshalUint32(sizeBuf[:0], uint32(len(blockBuf)))); err != nil {
+			return err
+		}
+		if _, err := bw.Write(blockBuf); err != nil {
+			return err
+		}
+	}
+}
+
+// newRelabelNativeReader returns a reader with the data from r relabeled with prcs.
+//
+// The caller must close the returned reader.
+func newRelabelNativeReader(r io.Reader, prcs []promrelabel.ParsedRelabelConfig) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		err := relabelNative(pw, r, prcs)
+		_ = pw.CloseWithError(err)
+	}()
+	return pr
+}
@@ -0,0 +1,89 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/native"
+)
+
+func TestRelabelNative(t *testing.T) {
+	regex := "old_(.+)"
+	replacement := "new_$1"
+	dropRegex := "drop_me"
+	prcs, err := promrelabel.ParseRelabelConfigs(nil, []promrelabel.RelabelConfig{
+		{
+			SourceLabels: []string{"__name__"},
+			Regex:        &regex,
+			TargetLabel:  "__name__",
+			Replacement:  &replacement,
+		},
+		{
+			SourceLabels: []string{"job"},
+			Regex:        &dropRegex,
+			Action:       "drop",
+		},
+		{
+			Regex:  &regex,
+			Action: "labelmap",
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+
+	im := &Importer{}
+	data := im.marshalNative(nil, []*TimeSeries{
+		{
+			Name:       "old_metric",
+			Labels:     []Label{{Name: "job", Value: "foo"}, {Name: "old_label", Value: "bar"}},
+			Timestamps: []int64{1000, 2000},
+			Values:     []float64{1, 2},
+		},
+		{
+			Name:       "other_metric",
+			Labels:     []Label{{Name: "job", Value: "drop_me"}},
+			Timestamps: []int64{1000},
+			Values:     []float64{3},
+		},
+		{
+			Name:       "unchanged",
+			Timestamps: []int64{1500},
+			Values:     []float64{4.5},
+		},
+	})
+	var bb bytes.Buffer
+	if err := relabelNative(&bb, bytes.NewReader(data), prcs); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req, err := http.NewRequest("POST", "/api/v1/import/native", &bb)
+	if err != nil {
+		t.Fatalf("cannot create request: %s", err)
+	}
+	var result []string
+	err = native.ParseStream(req, func(block *native.Block) error {
+		result = append(result, block.MetricName.String())
+		for i, ts := range block.Timestamps {
+			result = append(result, fmt.Sprintf("%d %g", ts, block.Values[i]))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cannot parse relabeled data: %s", err)
+	}
+	resultExpected := []string{
+		`MetricGroup="new_metric", tags=["job"="foo", "label"="bar"]`,
+		"1000 1",
+		"2000 2",
+		`MetricGroup="unchanged", tags=[]`,
+		"1500 4.5",
+	}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected result;\ngot\n%q\nwant\n%q", result, resultExpected)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	vmnativeSrcAddr = flag.String("vmnative.srcAddr", "", "VictoriaMetrics address to migrate data from. "+
+		"Data is read via /api/v1/export/native endpoint. For example, http://old-victoriametrics:8428")
+	vmnativeSrcUser         = flag.String("vmnative.srcUser", "", "Optional basic auth username for -vmnative.srcAddr")
+	vmnativeSrcPassword     = flag.String("vmnative.srcPassword", "", "Optional basic auth password for -vmnative.srcAddr")
+	vmnativeFilterMatch     = flag.String("vmnative.filterMatch", `{__name__!=""}`, "Series selector for the time series to migrate. All the time series are migrated by default")
+	vmnativeFilterTimeStart = flag.String("vmnative.filterTimeStart", "", "Start time for the data to migrate. It may be either RFC3339 time or unix timestamp in seconds. Required")
+	vmnativeFilterTimeEnd   = flag.String("vmnative.filterTimeEnd", "", "Optional end time for the data to migrate. It may be either RFC3339 time or unix timestamp in seconds. "+
+		"The current time is used if not set")
+)
+
+func runVMNative() error {
+	if len(*vmnativeSrcAddr) == 0 {
+		return fmt.Errorf("missing `-vmnative.srcAddr`")
+	}
+	if len(*vmnativeFilterTimeStart) == 0 {
+		return fmt.Errorf("missing `-vmnative.filterTimeStart`")
+	}
+	minTime, err := parseTime(*vmnativeFilterTimeStart, 0)
+	if err != nil {
+		return fmt.Errorf("cannot parse `-vmnative.filterTimeStart`: %w", err)
+	}
+	maxTime, err := parseTime(*vmnativeFilterTimeEnd, time.Now().UnixNano()/1e6)
+	if err != nil {
+		return fmt.Errorf("cannot parse `-vmnative.filterTimeEnd`: %w", err)
+	}
+	if maxTime < minTime {
+		return fmt.Errorf("`-vmnative.filterTimeEnd` cannot be smaller than `-vmnative.filterTimeStart`")
+	}
+	im, err := newImporter()
+	if err != nil {
+		return err
+	}
+	ex := &nativeExporter{
+		exportURL: strings.TrimSuffix(*vmnativeSrcAddr, "/") + "/api/v1/export/native",
+		user:      *vmnativeSrcUser,
+		password:  *vmnativeSrcPassword,
+		match:     *vmnativeFilterMatch,
+		client:    &http.Client{},
+	}
+	chunks := splitTimeRangeByMonths(minTime, maxTime)
+	logger.Infof("migrating series matching %s on the time range [%s..%s] in %d monthly chunks",
+		*vmnativeFilterMatch, formatTime(minTime), formatTime(maxTime), len(chunks))
+	var bytesTotal uint64
+	for i, tr := range chunks {
+		startTime := time.Now()
+		n, err := migrateNativeChunk(im, ex, tr)
+		if err != nil {
+			return fmt.Errorf("cannot migrate data on the time range [%s..%s]: %w", formatTime(tr[0]), formatTime(tr[1]), err)
+		}
+		bytesTotal += n
+		logger.Infof("migrated chunk %d out of %d on the time range [%s..%s]: %d bytes in %.3f seconds",
+			i+1, len(chunks), formatTime(tr[0]), formatTime(tr[1]), n, time.Since(startTime).Seconds())
+	}
+	_, _, requests, retries := im.Stats()
+	logger.Infof("migrated %d bytes via %d requests with %d retries", bytesTotal, requests, retries)
+	return nil
+}
+
+// migrateNativeChunk streams data on the given time range from ex to im.
+//
+// The whole chunk is re-read from ex on import errors, since the stream cannot be rewound.
+// It returns the number of bytes streamed on the last attempt.
+func migrateNativeChunk(im *vm.Importer, ex *nativeExporter, tr [2]int64) (uint64, error) {
+	retryDuration := time.Second
+	for i := 0; ; i++ {
+		n, err := streamNativeChunk(im, ex, tr)
+		if err == nil {
+			return n, nil
+		}
+		if i >= *vmMaxRetries {
+			return 0, fmt.Errorf("cannot stream data after %d retries: %w", i, err)
+		}
+		im.AddRetry()
+		logger.Warnf("cannot stream data on the time range [%s..%s]: %s; retrying in %.3f seconds",
+			formatTime(tr[0]), formatTime(tr[1]), err, retryDuration.Seconds())
+		time.Sleep(retryDuration)
+		retryDuration *= 2
+		if retryDuration > time.Minute {
+			retryDuration = time.Minute
+		}
+	}
+}
+
+func streamNativeChunk(im *vm.Importer, ex *nativeExporter, tr [2]int64) (uint64, error) {
+	r, err := ex.export(tr[0], tr[1])
+	if err != nil {
+		return 0, err
+	}
+	cr := &countingReader{
+		r: r,
+	}
+	err = im.ImportNative(cr)
+	_ = r.Close()
+	return atomic.LoadUint64(&cr.n), err
+}
+
+// nativeExporter reads data from VictoriaMetrics via /api/v1/export/native.
+type nativeExporter struct {
+	exportURL string
+	user      string
+	password  string
+	match     string
+	client    *http.Client
+}
+
+// export returns a stream with data in native format for ex.match on the time range [start..end] in milliseconds.
+//
+// The caller must close the returned stream.
+func (ex *nativeExporter) export(start, end int64) (io.ReadCloser, error) {
+	args := url.Values{}
+	args.Set("match[]", ex.match)
+	args.Set("start", formatUnixMsecs(start))
+	args.Set("end", formatUnixMsecs(end))
+	u := ex.exportURL + "?" + args.Encode()
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request to %q: %w", u, err)
+	}
+	if len(ex.user) > 0 || len(ex.password) > 0 {
+		req.SetBasicAuth(ex.user, ex.password)
+	}
+	resp, err := ex.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send request to %q: %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response code from %q: %d; response body: %q", u, resp.StatusCode, body)
+	}
+	return resp.Body, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddUint64(&cr.n, uint64(n))
+	return n, err
+}
+
+// splitTimeRangeByMonths splits the time range [minTime..maxTime] in milliseconds into per-month chunks.
+//
+// Each returned chunk contains inclusive [start..end] time range in milliseconds.
+func splitTimeRangeByMonths(minTime, maxTime int64) [][2]int64 {
+	var chunks [][2]int64
+	start := minTime
+	for start <= maxTime {
+		t := time.Unix(0, start*1e6).UTC()
+		nextMonth := time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		end := nextMonth.UnixNano()/1e6 - 1
+		if end > maxTime {
+			end = maxTime
+		}
+		chunks = append(chunks, [2]int64{start, end})
+		start = end + 1
+	}
+	return chunks
+}
+
+// formatUnixMsecs formats msecs as unix timestamp in seconds with millisecond precision.
+func formatUnixMsecs(msecs int64) string {
+	return fmt.Sprintf("%d.%03d", msecs/1e3, msecs%1e3)
+}
+
+func formatTime(msecs int64) string {
+	return time.Unix(0, msecs*1e6).UTC().Format(time.RFC3339)
+}
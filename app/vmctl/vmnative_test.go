@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitTimeRangeByMonths(t *testing.T) {
+	f := func(minTime, maxTime string, chunksExpected [][2]string) {
+		t.Helper()
+		chunks := splitTimeRangeByMonths(mustParseMsecs(t, minTime), mustParseMsecs(t, maxTime))
+		var result [][2]string
+		for _, tr := range chunks {
+			result = append(result, [2]string{
+				time.Unix(0, tr[0]*1e6).UTC().Format(time.RFC3339Nano),
+				time.Unix(0, tr[1]*1e6).UTC().Format(time.RFC3339Nano),
+			})
+		}
+		if !reflect.DeepEqual(result, chunksExpected) {
+			t.Fatalf("unexpected chunks; got\n%q\nwant\n%q", result, chunksExpected)
+		}
+	}
+
+	// Single chunk
+	f("2020-01-05T10:00:00Z", "2020-01-20T00:00:00Z", [][2]string{
+		{"2020-01-05T10:00:00Z", "2020-01-20T00:00:00Z"},
+	})
+	f("2020-01-05T10:00:00Z", "2020-01-05T10:00:00Z", [][2]string{
+		{"2020-01-05T10:00:00Z", "2020-01-05T10:00:00Z"},
+	})
+
+	// Multiple chunks
+	f("2019-11-15T00:00:00Z", "2020-02-01T00:00:00Z", [][2]string{
+		{"2019-11-15T00:00:00Z", "2019-11-30T23:59:59.999Z"},
+		{"2019-12-01T00:00:00Z", "2019-12-31T23:59:59.999Z"},
+		{"2020-01-01T00:00:00Z", "2020-01-31T23:59:59.999Z"},
+		{"2020-02-01T00:00:00Z", "2020-02-01T00:00:00Z"},
+	})
+}
+
+func TestFormatUnixMsecs(t *testing.T) {
+	f := func(msecs int64, resultExpected string) {
+		t.Helper()
+		result := formatUnixMsecs(msecs)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+	f(0, "0.000")
+	f(1, "0.001")
+	f(1580515199999, "1580515199.999")
+	f(1580515200000, "1580515200.000")
+}
+
+func mustParseMsecs(t *testing.T, s string) int64 {
+	t.Helper()
+	msecs, err := parseTime(s, 0)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", s, err)
+	}
+	return msecs
+}
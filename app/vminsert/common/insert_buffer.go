@@ -0,0 +1,179 @@
+package common
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	insertBufferPath = flag.String("insert.bufferPath", "", "Optional path to directory for buffering ingested samples on disk when the storage cannot accept them "+
+		"in a timely manner because it is overloaded. Buffered samples are added to the storage in background when it catches up, so clients don't receive errors "+
+		"during short overloads. By default such samples are rejected with '503 Service Unavailable' error. See also -insert.maxBufferSize")
+	maxInsertBufferSize = flagutil.NewBytes("insert.maxBufferSize", 1024*1024*1024, "The maximum size in bytes of the on-disk buffer at -insert.bufferPath. "+
+		"The oldest buffered samples are dropped when the buffer size exceeds this value")
+)
+
+var (
+	insertBuffer       *persistentqueue.Queue
+	insertBufferStopCh chan struct{}
+	insertBufferWG     sync.WaitGroup
+)
+
+// InitInsertBuffer opens on-disk buffer at -insert.bufferPath if it is set.
+//
+// The buffered rows remaining from the previous run are added to the storage in background.
+func InitInsertBuffer() {
+	if len(*insertBufferPath) == 0 {
+		return
+	}
+	insertBuffer = persistentqueue.MustOpen(*insertBufferPath, "vminsert", maxInsertBufferSize.N)
+	insertBufferStopCh = make(chan struct{})
+	insertBufferWG.Add(1)
+	go func() {
+		defer insertBufferWG.Done()
+		runInsertBufferReplayer(vmstorage.AddRows)
+	}()
+}
+
+// StopInsertBuffer closes on-disk buffer opened via InitInsertBuffer.
+//
+// It is expected that there are no concurrent inserts during and after the call.
+func StopInsertBuffer() {
+	if insertBuffer == nil {
+		return
+	}
+	// Stop the replayer before closing the buffer, so it could put back the rows it couldn't add to the storage.
+	close(insertBufferStopCh)
+	insertBuffer.UnblockAllReaders()
+	insertBufferWG.Wait()
+	insertBuffer.MustClose()
+	insertBuffer = nil
+}
+
+// addRows adds mrs to the storage.
+//
+// mrs are put to on-disk buffer if the storage is overloaded and -insert.bufferPath is set.
+func addRows(mrs []storage.MetricRow) error {
+	err := vmstorage.AddRows(mrs)
+	if err == nil || insertBuffer == nil || !errors.Is(err, storage.ErrOverloaded) {
+		return err
+	}
+	writeToInsertBuffer(mrs)
+	return nil
+}
+
+// maxInsertBufferBlockSize is the maximum size of a block written to insertBuffer.
+const maxInsertBufferBlockSize = 8 * 1024 * 1024
+
+func writeToInsertBuffer(mrs []storage.MetricRow) {
+	// Each block has the following format:
+	//
+	//	<rowsCount:varuint64> <MetricRow>*rowsCount
+	bb := insertBufferBlockPool.Get()
+	var rowsBuf []byte
+	for len(mrs) > 0 {
+		n := 0
+		rowsBuf = rowsBuf[:0]
+		for n < len(mrs) && len(rowsBuf) < maxInsertBufferBlockSize {
+			rowsBuf = mrs[n].Marshal(rowsBuf)
+			n++
+		}
+		bb.B = encoding.MarshalVarUint64(bb.B[:0], uint64(n))
+		bb.B = append(bb.B, rowsBuf...)
+		insertBuffer.MustWriteBlock(bb.B)
+		insertBufferRowsWritten.Add(n)
+		mrs = mrs[n:]
+	}
+	insertBufferBlockPool.Put(bb)
+}
+
+func runInsertBufferReplayer(addRowsFunc func(mrs []storage.MetricRow) error) {
+	var block []byte
+	var mrs []storage.MetricRow
+	for {
+		var ok bool
+		block, ok = insertBuffer.MustReadBlock(block[:0])
+		if !ok {
+			return
+		}
+		var err error
+		mrs, err = unmarshalInsertBufferBlock(mrs[:0], block)
+		if err != nil {
+			logger.Errorf("skipping corrupted block with size %d bytes in -insert.bufferPath=%q: %s", len(block), *insertBufferPath, err)
+			continue
+		}
+		if !addRowsWithRetries(addRowsFunc, mrs) {
+			// Put the block back to the buffer, so its rows are added to the storage after the restart.
+			insertBuffer.MustWriteBlock(block)
+			logger.Infof("couldn't add %d buffered rows to the storage before the shutdown; they will be added after the restart", len(mrs))
+			return
+		}
+		insertBufferRowsReplayed.Add(len(mrs))
+	}
+}
+
+// addRowsWithRetries adds mrs to the storage via addRowsFunc until it accepts them.
+//
+// It returns false if insertBufferStopCh is closed before the rows are added.
+func addRowsWithRetries(addRowsFunc func(mrs []storage.MetricRow) error, mrs []storage.MetricRow) bool {
+	retryDuration := 100 * time.Millisecond
+	for {
+		err := addRowsFunc(mrs)
+		if err == nil {
+			return true
+		}
+		if !errors.Is(err, storage.ErrOverloaded) {
+			// There is no sense in retrying, since the error is permanent.
+			logger.Errorf("cannot add %d buffered rows to the storage: %s", len(mrs), err)
+			return true
+		}
+		t := time.NewTimer(retryDuration)
+		select {
+		case <-insertBufferStopCh:
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+		retryDuration *= 2
+		if retryDuration > 5*time.Second {
+			retryDuration = 5 * time.Second
+		}
+	}
+}
+
+func unmarshalInsertBufferBlock(dst []storage.MetricRow, src []byte) ([]storage.MetricRow, error) {
+	tail, rowsCount, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return dst, fmt.Errorf("cannot unmarshal rows count: %w", err)
+	}
+	for i := uint64(0); i < rowsCount; i++ {
+		dst = append(dst, storage.MetricRow{})
+		tail, err = dst[len(dst)-1].Unmarshal(tail)
+		if err != nil {
+			return dst, fmt.Errorf("cannot unmarshal row #%d: %w", i, err)
+		}
+	}
+	if len(tail) > 0 {
+		return dst, fmt.Errorf("unexpected non-empty tail left after unmarshaling %d rows; len(tail)=%d", rowsCount, len(tail))
+	}
+	return dst, nil
+}
+
+var insertBufferBlockPool bytesutil.ByteBufferPool
+
+var (
+	insertBufferRowsWritten  = metrics.NewCounter(`vm_insert_buffer_rows_written_total`)
+	insertBufferRowsReplayed = metrics.NewCounter(`vm_insert_buffer_rows_replayed_total`)
+)
@@ -0,0 +1,197 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func newTestMetricRows(rowsCount int) []storage.MetricRow {
+	var mrs []storage.MetricRow
+	for i := 0; i < rowsCount; i++ {
+		labels := []prompb.Label{
+			{Name: []byte("__name__"), Value: []byte(fmt.Sprintf("metric_%d", i))},
+			{Name: []byte("job"), Value: []byte("foobar")},
+		}
+		mrs = append(mrs, storage.MetricRow{
+			MetricNameRaw: storage.MarshalMetricNameRaw(nil, labels),
+			Timestamp:     int64(i) * 1000,
+			Value:         float64(i) / 10,
+		})
+	}
+	return mrs
+}
+
+func TestInsertBufferMarshalUnmarshal(t *testing.T) {
+	const path = "insert-buffer-test"
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+	insertBuffer = persistentqueue.MustOpen(path, "test", 0)
+	defer func() {
+		insertBuffer.MustClose()
+		insertBuffer = nil
+	}()
+
+	f := func(rowsCount int) {
+		t.Helper()
+		mrs := newTestMetricRows(rowsCount)
+		writeToInsertBuffer(mrs)
+
+		var result []storage.MetricRow
+		var block []byte
+		for len(result) < rowsCount {
+			var ok bool
+			block, ok = insertBuffer.MustReadBlock(block[:0])
+			if !ok {
+				t.Fatalf("unexpected end of insert buffer after reading %d rows out of %d", len(result), rowsCount)
+			}
+			var err error
+			result, err = unmarshalInsertBufferBlock(result, block)
+			if err != nil {
+				t.Fatalf("cannot unmarshal block: %s", err)
+			}
+		}
+		if !reflect.DeepEqual(result, mrs) {
+			t.Fatalf("unexpected rows read from insert buffer\ngot\n%v\nwant\n%v", result, mrs)
+		}
+	}
+
+	f(1)
+	f(10)
+	f(1000)
+
+	// Rows exceeding maxInsertBufferBlockSize must be split into multiple blocks.
+	f(300000)
+}
+
+// startTestInsertBufferReplayer opens insert buffer at path and starts the replayer, which adds rows via addRowsFunc.
+func startTestInsertBufferReplayer(path string, addRowsFunc func(mrs []storage.MetricRow) error) {
+	insertBuffer = persistentqueue.MustOpen(path, "test", 0)
+	insertBufferStopCh = make(chan struct{})
+	insertBufferWG.Add(1)
+	go func() {
+		defer insertBufferWG.Done()
+		runInsertBufferReplayer(addRowsFunc)
+	}()
+}
+
+func TestInsertBufferReplay(t *testing.T) {
+	const path = "insert-buffer-replay-test"
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	// Rows left in the buffer from the previous run must be replayed on start.
+	insertBuffer = persistentqueue.MustOpen(path, "test", 0)
+	mrsPrev := newTestMetricRows(10)
+	writeToInsertBuffer(mrsPrev)
+	insertBuffer.MustClose()
+
+	var mu sync.Mutex
+	var result []storage.MetricRow
+	calls := 0
+	addRowsFunc := func(mrs []storage.MetricRow) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			// The storage is overloaded at first, so the rows must be retried.
+			return storage.ErrOverloaded
+		}
+		for _, mr := range mrs {
+			result = append(result, storage.MetricRow{
+				MetricNameRaw: append([]byte{}, mr.MetricNameRaw...),
+				Timestamp:     mr.Timestamp,
+				Value:         mr.Value,
+			})
+		}
+		return nil
+	}
+	startTestInsertBufferReplayer(path, addRowsFunc)
+	defer StopInsertBuffer()
+
+	// Rows buffered at runtime must be replayed too.
+	mrsNew := newTestMetricRows(20)
+	writeToInsertBuffer(mrsNew)
+	mrsExpected := append(mrsPrev, mrsNew...)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(result)
+		mu.Unlock()
+		if n >= len(mrsExpected) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for %d replayed rows; got %d rows", len(mrsExpected), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(result, mrsExpected) {
+		t.Fatalf("unexpected rows replayed\ngot\n%v\nwant\n%v", result, mrsExpected)
+	}
+}
+
+func TestInsertBufferReplayStop(t *testing.T) {
+	const path = "insert-buffer-replay-stop-test"
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	// The storage stays overloaded, so the replayer is stopped in the middle of retries.
+	callCh := make(chan struct{}, 1)
+	addRowsFunc := func(mrs []storage.MetricRow) error {
+		select {
+		case callCh <- struct{}{}:
+		default:
+		}
+		return storage.ErrOverloaded
+	}
+	startTestInsertBufferReplayer(path, addRowsFunc)
+	mrs := newTestMetricRows(10)
+	writeToInsertBuffer(mrs)
+	select {
+	case <-callCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for the replayer")
+	}
+	StopInsertBuffer()
+
+	// The rows the replayer couldn't add to the storage must remain in the buffer.
+	insertBuffer = persistentqueue.MustOpen(path, "test", 0)
+	defer func() {
+		insertBuffer.MustClose()
+		insertBuffer = nil
+	}()
+	if n := insertBuffer.GetPendingBytes(); n == 0 {
+		t.Fatalf("expecting non-empty insert buffer after the shutdown")
+	}
+	block, ok := insertBuffer.MustReadBlock(nil)
+	if !ok {
+		t.Fatalf("unexpected end of insert buffer")
+	}
+	result, err := unmarshalInsertBufferBlock(nil, block)
+	if err != nil {
+		t.Fatalf("cannot unmarshal block: %s", err)
+	}
+	if !reflect.DeepEqual(result, mrs) {
+		t.Fatalf("unexpected rows left in insert buffer\ngot\n%v\nwant\n%v", result, mrs)
+	}
+}
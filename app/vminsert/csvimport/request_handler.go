@@ -30,6 +30,19 @@ func InsertHandler(req *http.Request) error {
 	})
 }
 
+// InsertHandlerWithReport is like InsertHandler, but registers per-chunk stats and parse errors in ir.
+func InsertHandlerWithReport(req *http.Request, ir *parserCommon.ImportReport) error {
+	extraLabels, err := parserCommon.GetExtraLabels(req)
+	if err != nil {
+		return err
+	}
+	return writeconcurrencylimiter.Do(func() error {
+		return parser.ParseStreamWithReport(req, func(rows []parser.Row) error {
+			return insertRows(rows, extraLabels)
+		}, ir)
+	})
+}
+
 func insertRows(rows []parser.Row, extraLabels []prompbmarshal.Label) error {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
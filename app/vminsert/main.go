@@ -7,23 +7,30 @@ import (
 	"strings"
 	"sync/atomic"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/csvimport"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/graphite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/influx"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/native"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/opentsdb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/opentsdbhttp"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/prometheusimport"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/prompush"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/promremotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/registerseries"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/vmimport"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auditlog"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	graphiteserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/graphite"
 	influxserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/influx"
 	opentsdbserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/opentsdb"
 	opentsdbhttpserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/opentsdbhttp"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
+	parserCommon "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
 	"github.com/VictoriaMetrics/metrics"
@@ -37,7 +44,12 @@ var (
 		"Telnet put messages and HTTP /api/put messages are simultaneously served on TCP port. "+
 		"Usually :4242 must be set. Doesn't work if empty")
 	opentsdbHTTPListenAddr = flag.String("opentsdbHTTPListenAddr", "", "TCP address to listen for OpentTSDB HTTP put requests. Usually :4242 must be set. Doesn't work if empty")
-	maxLabelsPerTimeseries = flag.Int("maxLabelsPerTimeseries", 30, "The maximum number of labels accepted per time series. Superflouos labels are dropped")
+	maxLabelsPerTimeseries = flagutil.NewReloadableInt("maxLabelsPerTimeseries", 30, "The maximum number of labels accepted per time series. Superflouos labels are dropped")
+	invalidLabelNamePolicy = flag.String("invalidLabelNamePolicy", "accept", "The policy for ingested label names, which don't match Prometheus charset [a-zA-Z_][a-zA-Z0-9_]*. "+
+		"Supported values: accept - store label names as is; sanitize - replace invalid chars with _; reject - drop samples with such label names. "+
+		"Such label names may be hard to query via PromQL. Metric names aren't checked")
+	invalidUTF8LabelValuePolicy = flag.String("invalidUTF8LabelValuePolicy", "accept", "The policy for ingested metric names and label values with invalid UTF-8. "+
+		"Supported values: accept - store them as is; sanitize - replace invalid UTF-8 sequences with U+FFFD char; reject - drop samples with such values")
 )
 
 var (
@@ -50,9 +62,25 @@ var (
 // Init initializes vminsert.
 func Init() {
 	relabel.Init()
-	storage.SetMaxLabelsPerTimeseries(*maxLabelsPerTimeseries)
+	storage.SetMaxLabelsPerTimeseries(maxLabelsPerTimeseries.Get())
+	flagutil.OnReload(func() {
+		n := maxLabelsPerTimeseries.Get()
+		if n <= 0 {
+			logger.Errorf("ignoring non-positive -maxLabelsPerTimeseries=%d; preserving the previous value", n)
+			return
+		}
+		storage.SetMaxLabelsPerTimeseries(n)
+	})
+	if err := storage.SetInvalidLabelNamePolicy(*invalidLabelNamePolicy); err != nil {
+		logger.Fatalf("invalid -invalidLabelNamePolicy: %s", err)
+	}
+	if err := storage.SetInvalidUTF8LabelValuePolicy(*invalidUTF8LabelValuePolicy); err != nil {
+		logger.Fatalf("invalid -invalidUTF8LabelValuePolicy: %s", err)
+	}
 
 	writeconcurrencylimiter.Init()
+	common.InitInsertBuffer()
+	promremotewrite.InitMirror()
 	if len(*influxListenAddr) > 0 {
 		influxServer = influxserver.MustStart(*influxListenAddr, influx.InsertHandlerForReader)
 	}
@@ -83,6 +111,8 @@ func Stop() {
 	if len(*opentsdbHTTPListenAddr) > 0 {
 		opentsdbhttpServer.MustStop()
 	}
+	promremotewrite.StopMirror()
+	common.StopInsertBuffer()
 }
 
 // RequestHandler is a handler for Prometheus remote storage write API
@@ -100,6 +130,15 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return true
 	case "/api/v1/import":
 		vmimportRequests.Inc()
+		if parserCommon.IsImportReportRequested(r) {
+			ir := parserCommon.NewImportReport(w)
+			err := vmimport.InsertHandlerWithReport(r, ir)
+			if err != nil {
+				vmimportErrors.Inc()
+			}
+			ir.Finish(err)
+			return true
+		}
 		if err := vmimport.InsertHandler(r); err != nil {
 			vmimportErrors.Inc()
 			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
@@ -107,8 +146,26 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		}
 		w.WriteHeader(http.StatusNoContent)
 		return true
+	case "/api/v1/import/native":
+		nativeimportRequests.Inc()
+		if err := native.InsertHandler(r); err != nil {
+			nativeimportErrors.Inc()
+			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
+			return true
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return true
 	case "/api/v1/import/csv":
 		csvimportRequests.Inc()
+		if parserCommon.IsImportReportRequested(r) {
+			ir := parserCommon.NewImportReport(w)
+			err := csvimport.InsertHandlerWithReport(r, ir)
+			if err != nil {
+				csvimportErrors.Inc()
+			}
+			ir.Finish(err)
+			return true
+		}
 		if err := csvimport.InsertHandler(r); err != nil {
 			csvimportErrors.Inc()
 			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
@@ -125,6 +182,15 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		}
 		w.WriteHeader(http.StatusNoContent)
 		return true
+	case "/api/v1/register_series":
+		registerSeriesRequests.Inc()
+		if err := registerseries.RegisterHandler(r); err != nil {
+			registerSeriesErrors.Inc()
+			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
+			return true
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return true
 	case "/write", "/api/v2/write":
 		influxWriteRequests.Inc()
 		if err := influx.InsertHandlerForHTTP(r); err != nil {
@@ -147,6 +213,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return true
 	case "/-/reload":
 		promscrapeConfigReloadRequests.Inc()
+		auditlog.LogRequest(r, "config_reload", nil)
 		procutil.SelfSIGHUP()
 		w.WriteHeader(http.StatusNoContent)
 		return true
@@ -163,12 +230,18 @@ var (
 	vmimportRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/import", protocol="vmimport"}`)
 	vmimportErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/import", protocol="vmimport"}`)
 
+	nativeimportRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/import/native", protocol="nativeimport"}`)
+	nativeimportErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/import/native", protocol="nativeimport"}`)
+
 	csvimportRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/import/csv", protocol="csvimport"}`)
 	csvimportErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/import/csv", protocol="csvimport"}`)
 
 	prometheusimportRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/import/prometheus", protocol="prometheusimport"}`)
 	prometheusimportErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/import/prometheus", protocol="prometheusimport"}`)
 
+	registerSeriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/register_series"}`)
+	registerSeriesErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/register_series"}`)
+
 	influxWriteRequests = metrics.NewCounter(`vm_http_requests_total{path="/write", protocol="influx"}`)
 	influxWriteErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/write", protocol="influx"}`)
 
@@ -187,4 +260,10 @@ var (
 	_ = metrics.NewGauge(`vm_too_long_label_values_total`, func() float64 {
 		return float64(atomic.LoadUint64(&storage.TooLongLabelValues))
 	})
+	_ = metrics.NewGauge(`vm_invalid_label_names_total`, func() float64 {
+		return float64(atomic.LoadUint64(&storage.InvalidLabelNames))
+	})
+	_ = metrics.NewGauge(`vm_invalid_utf8_label_values_total`, func() float64 {
+		return float64(atomic.LoadUint64(&storage.InvalidUTF8LabelValues))
+	})
 )
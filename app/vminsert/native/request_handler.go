@@ -0,0 +1,112 @@
+package native
+
+import (
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	parserCommon "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/native"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	rowsInserted  = metrics.NewCounter(`vm_rows_inserted_total{type="native"}`)
+	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="native"}`)
+)
+
+// InsertHandler processes `/api/v1/import/native` request.
+//
+// The request body must contain data exported via `/api/v1/export/native`.
+func InsertHandler(req *http.Request) error {
+	extraLabels, err := parserCommon.GetExtraLabels(req)
+	if err != nil {
+		return err
+	}
+	return writeconcurrencylimiter.Do(func() error {
+		ctx := getPushCtx()
+		defer putPushCtx(ctx)
+		err := parser.ParseStream(req, func(block *parser.Block) error {
+			return insertBlock(ctx, block, extraLabels)
+		})
+		if err != nil {
+			return err
+		}
+		return ctx.Common.FlushBufs()
+	})
+}
+
+func insertBlock(ctx *pushCtx, block *parser.Block, extraLabels []prompbmarshal.Label) error {
+	ic := &ctx.Common
+	ic.Labels = ic.Labels[:0]
+	mn := &block.MetricName
+	ic.AddLabelBytes(nil, mn.MetricGroup)
+	for j := range mn.Tags {
+		tag := &mn.Tags[j]
+		ic.AddLabelBytes(tag.Key, tag.Value)
+	}
+	for j := range extraLabels {
+		label := &extraLabels[j]
+		ic.AddLabel(label.Name, label.Value)
+	}
+	if relabel.HasRelabeling() {
+		ic.ApplyRelabeling()
+	}
+	if len(ic.Labels) == 0 {
+		// Skip metric without labels.
+		return nil
+	}
+	ctx.metricNameBuf = storage.MarshalMetricNameRaw(ctx.metricNameBuf[:0], ic.Labels)
+	values := block.Values
+	timestamps := block.Timestamps
+	_ = timestamps[len(values)-1]
+	for j, value := range values {
+		timestamp := timestamps[j]
+		if err := ic.WriteDataPoint(ctx.metricNameBuf, nil, timestamp, value); err != nil {
+			return err
+		}
+	}
+	rowsTotal := len(values)
+	rowsInserted.Add(rowsTotal)
+	rowsPerInsert.Update(float64(rowsTotal))
+	return nil
+}
+
+type pushCtx struct {
+	Common        common.InsertCtx
+	metricNameBuf []byte
+}
+
+func (ctx *pushCtx) reset() {
+	ctx.Common.Reset(0)
+	ctx.metricNameBuf = ctx.metricNameBuf[:0]
+}
+
+func getPushCtx() *pushCtx {
+	select {
+	case ctx := <-pushCtxPoolCh:
+		return ctx
+	default:
+		if v := pushCtxPool.Get(); v != nil {
+			return v.(*pushCtx)
+		}
+		return &pushCtx{}
+	}
+}
+
+func putPushCtx(ctx *pushCtx) {
+	ctx.reset()
+	select {
+	case pushCtxPoolCh <- ctx:
+	default:
+		pushCtxPool.Put(ctx)
+	}
+}
+
+var pushCtxPool sync.Pool
+var pushCtxPoolCh = make(chan *pushCtx, runtime.GOMAXPROCS(-1))
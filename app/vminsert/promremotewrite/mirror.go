@@ -0,0 +1,222 @@
+package promremotewrite
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
+	"github.com/VictoriaMetrics/metrics"
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+var (
+	mirrorURL = flag.String("remoteWriteMirror.url", "", "Optional URL for mirroring incoming Prometheus remote write requests to /api/v1/write, "+
+		"for example, 'http://test-victoriametrics:8428/api/v1/write'. This may be used for validating upgrades against production traffic. "+
+		"Mirrored requests are buffered independently, so the mirror URL doesn't slow down data ingestion. See also -remoteWriteMirror.percent")
+	mirrorPercent = flag.Float64("remoteWriteMirror.percent", 100, "The percentage of incoming Prometheus remote write requests to mirror to -remoteWriteMirror.url. "+
+		"The requests are sampled randomly")
+	mirrorTmpDataPath = flag.String("remoteWriteMirror.tmpDataPath", "", "Path to directory for buffering requests, which couldn't be sent to -remoteWriteMirror.url yet. "+
+		"By default <-storageDataPath>/remote-write-mirror is used")
+	mirrorMaxPendingBytes = flagutil.NewBytes("remoteWriteMirror.maxDiskUsage", 1024*1024*1024, "The maximum size in bytes of buffered requests for -remoteWriteMirror.url. "+
+		"The oldest requests are dropped when the buffer size exceeds this value")
+	mirrorConcurrency = flag.Int("remoteWriteMirror.concurrency", 2, "The number of concurrent connections to -remoteWriteMirror.url")
+	mirrorSendTimeout = flag.Duration("remoteWriteMirror.sendTimeout", time.Minute, "Timeout for sending a single request to -remoteWriteMirror.url")
+)
+
+var (
+	mirrorQueue  *persistentqueue.FastQueue
+	mirrorClient *http.Client
+	mirrorCtx    context.Context
+	mirrorCancel func()
+	mirrorWG     sync.WaitGroup
+
+	// mirrorURLForLogs is -remoteWriteMirror.url without credentials, which is safe to put into logs.
+	mirrorURLForLogs string
+)
+
+// InitMirror starts mirroring of incoming requests to -remoteWriteMirror.url if it is set.
+func InitMirror() {
+	if len(*mirrorURL) == 0 {
+		return
+	}
+	if *mirrorPercent <= 0 || *mirrorPercent > 100 {
+		logger.Fatalf("-remoteWriteMirror.percent must be in the range (0..100]; got %g", *mirrorPercent)
+	}
+	path := *mirrorTmpDataPath
+	if len(path) == 0 {
+		path = *vmstorage.DataPath + "/remote-write-mirror"
+	}
+	mirrorURLForLogs = getURLWithoutCredentials(*mirrorURL)
+	// Do not use the url as the queue name, since the name is stored on disk and the url may contain credentials.
+	queueName := fmt.Sprintf("%016X", xxhash.Sum64([]byte(*mirrorURL)))
+	mirrorQueue = persistentqueue.MustOpenFastQueue(path, queueName, 16, mirrorMaxPendingBytes.N)
+	mirrorClient = &http.Client{
+		Timeout: *mirrorSendTimeout,
+	}
+	mirrorCtx, mirrorCancel = context.WithCancel(context.Background())
+	for i := 0; i < *mirrorConcurrency; i++ {
+		mirrorWG.Add(1)
+		go func() {
+			defer mirrorWG.Done()
+			runMirrorWorker()
+		}()
+	}
+	_ = metrics.GetOrCreateGauge(`vm_remote_write_mirror_pending_bytes`, func() float64 {
+		return float64(mirrorQueue.GetPendingBytes())
+	})
+	logger.Infof("mirroring %g%% of incoming Prometheus remote write requests to -remoteWriteMirror.url=%q", *mirrorPercent, mirrorURLForLogs)
+}
+
+func getURLWithoutCredentials(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	u.User = nil
+	return u.String()
+}
+
+// StopMirror stops mirroring started via InitMirror.
+//
+// It is expected that there are no concurrent calls to InsertHandler during and after the call.
+func StopMirror() {
+	if mirrorQueue == nil {
+		return
+	}
+	// Stop the workers before closing the queue, so they could put back the blocks, which couldn't be sent.
+	mirrorCancel()
+	mirrorQueue.UnblockAllReaders()
+	mirrorWG.Wait()
+	mirrorQueue.MustClose()
+	mirrorQueue = nil
+}
+
+// startMirroring makes a copy of req.Body into the returned buffer while the body is read
+// if the request must be mirrored to -remoteWriteMirror.url.
+//
+// nil is returned if the request mustn't be mirrored.
+func startMirroring(req *http.Request) *bytesutil.ByteBuffer {
+	if mirrorQueue == nil || (*mirrorPercent < 100 && rand.Float64()*100 >= *mirrorPercent) {
+		return nil
+	}
+	bb := mirrorBufPool.Get()
+	req.Body = &mirrorBody{
+		Reader: io.TeeReader(req.Body, bb),
+		Closer: req.Body,
+	}
+	return bb
+}
+
+type mirrorBody struct {
+	io.Reader
+	io.Closer
+}
+
+// finishMirroring buffers the request body from bb for sending to -remoteWriteMirror.url if the request has been successfully parsed.
+//
+// Requests bigger than persistentqueue.MaxBlockSize aren't mirrored, since they cannot be buffered.
+func finishMirroring(bb *bytesutil.ByteBuffer, err error) {
+	if err == nil && len(bb.B) > 0 {
+		if len(bb.B) > persistentqueue.MaxBlockSize {
+			mirrorRequestsDropped.Inc()
+			logger.Warnf("skipping mirroring of request with size %d bytes to -remoteWriteMirror.url=%q, since it exceeds %d bytes",
+				len(bb.B), mirrorURLForLogs, persistentqueue.MaxBlockSize)
+		} else {
+			mirrorQueue.MustWriteBlock(bb.B)
+			mirrorRequestsBuffered.Inc()
+		}
+	}
+	mirrorBufPool.Put(bb)
+}
+
+var mirrorBufPool bytesutil.ByteBufferPool
+
+func runMirrorWorker() {
+	var block []byte
+	for {
+		var ok bool
+		block, ok = mirrorQueue.MustReadBlock(block[:0])
+		if !ok {
+			return
+		}
+		if !sendMirrorBlock(block) {
+			// Put the block back to the queue, so it is sent after the restart.
+			mirrorQueue.MustWriteBlock(block)
+			return
+		}
+	}
+}
+
+// sendMirrorBlock sends the block to -remoteWriteMirror.url until it is accepted.
+//
+// false is returned if the mirroring is stopped before the block is sent.
+func sendMirrorBlock(block []byte) bool {
+	retryDuration := time.Second
+	for {
+		err := trySendMirrorBlock(block)
+		if err == nil {
+			mirrorRequestsSent.Inc()
+			return true
+		}
+		if mirrorCtx.Err() != nil {
+			return false
+		}
+		mirrorRequestErrors.Inc()
+		logger.Errorf("cannot send request with size %d bytes to -remoteWriteMirror.url=%q: %s; re-sending the request in %.3f seconds",
+			len(block), mirrorURLForLogs, err, retryDuration.Seconds())
+		t := time.NewTimer(retryDuration)
+		select {
+		case <-mirrorCtx.Done():
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+		retryDuration *= 2
+		if retryDuration > time.Minute {
+			retryDuration = time.Minute
+		}
+	}
+}
+
+func trySendMirrorBlock(block []byte) error {
+	req, err := http.NewRequestWithContext(mirrorCtx, "POST", *mirrorURL, bytes.NewReader(block))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	h := req.Header
+	h.Set("Content-Type", "application/x-protobuf")
+	h.Set("Content-Encoding", "snappy")
+	h.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := mirrorClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d; response body: %q", resp.StatusCode, body)
+	}
+	return nil
+}
+
+var (
+	mirrorRequestsBuffered = metrics.NewCounter(`vm_remote_write_mirror_requests_buffered_total`)
+	mirrorRequestsSent     = metrics.NewCounter(`vm_remote_write_mirror_requests_sent_total`)
+	mirrorRequestErrors    = metrics.NewCounter(`vm_remote_write_mirror_request_errors_total`)
+	mirrorRequestsDropped  = metrics.NewCounter(`vm_remote_write_mirror_requests_dropped_total`)
+)
@@ -19,7 +19,12 @@ var (
 // InsertHandler processes remote write for prometheus.
 func InsertHandler(req *http.Request) error {
 	return writeconcurrencylimiter.Do(func() error {
-		return parser.ParseStream(req, insertRows)
+		bb := startMirroring(req)
+		err := parser.ParseStream(req, insertRows)
+		if bb != nil {
+			finishMirroring(bb, err)
+		}
+		return err
 	})
 }
 
@@ -0,0 +1,134 @@
+package registerseries
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	parserCommon "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastjson"
+)
+
+var seriesRegistered = metrics.NewCounter(`vm_series_registered_total`)
+
+// RegisterHandler processes `/api/v1/register_series` request.
+//
+// The request body must contain JSON lines with `metric` objects in the format used by `/api/v1/import`.
+// Other fields such as `values` and `timestamps` are ignored, so the output of `/api/v1/export` may be passed as is.
+// The series are registered for the current time unless `timestamp` query arg is set.
+func RegisterHandler(req *http.Request) error {
+	extraLabels, err := parserCommon.GetExtraLabels(req)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().UnixNano() / 1e6
+	if s := req.URL.Query().Get("timestamp"); len(s) > 0 {
+		t, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("cannot parse `timestamp` query arg %q: %w", s, err)
+		}
+		timestamp = int64(t * 1e3)
+	}
+	r := parserCommon.LimitImportRequestBody(req.Body)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := parserCommon.GetGzipReader(r)
+		if err != nil {
+			return fmt.Errorf("cannot read gzipped series: %w", err)
+		}
+		defer parserCommon.PutGzipReader(zr)
+		r = zr
+	}
+	return writeconcurrencylimiter.Do(func() error {
+		return registerSeries(r, timestamp, extraLabels)
+	})
+}
+
+func registerSeries(r io.Reader, timestamp int64, extraLabels []prompbmarshal.Label) error {
+	var ic common.InsertCtx
+	var p fastjson.Parser
+	var mrs []storage.MetricRow
+	var reqBuf, tailBuf, metricNamesBuf []byte
+	var err error
+	hasRelabeling := relabel.HasRelabeling()
+	for {
+		reqBuf, tailBuf, err = parserCommon.ReadLinesBlock(r, reqBuf, tailBuf)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("cannot read series: %w", err)
+		}
+		mrs = mrs[:0]
+		metricNamesBuf = metricNamesBuf[:0]
+		b := reqBuf
+		for len(b) > 0 {
+			var line []byte
+			if n := bytes.IndexByte(b, '\n'); n >= 0 {
+				line, b = b[:n], b[n+1:]
+			} else {
+				line, b = b, nil
+			}
+			if len(line) == 0 {
+				continue
+			}
+			v, err := p.ParseBytes(line)
+			if err != nil {
+				return fmt.Errorf("cannot parse json line %q: %w", line, err)
+			}
+			metric := v.GetObject("metric")
+			if metric == nil {
+				return fmt.Errorf("missing `metric` object in json line %q", line)
+			}
+			ic.Reset(0)
+			metric.Visit(func(key []byte, v *fastjson.Value) {
+				if err != nil {
+					return
+				}
+				value, e := v.StringBytes()
+				if e != nil {
+					err = fmt.Errorf("cannot parse value for label %q: %w", key, e)
+					return
+				}
+				ic.AddLabelBytes(key, value)
+			})
+			if err != nil {
+				return fmt.Errorf("cannot parse `metric` object in json line %q: %w", line, err)
+			}
+			for j := range extraLabels {
+				label := &extraLabels[j]
+				ic.AddLabel(label.Name, label.Value)
+			}
+			if hasRelabeling {
+				ic.ApplyRelabeling()
+			}
+			if len(ic.Labels) == 0 {
+				// Skip metric without labels.
+				continue
+			}
+			metricNamesBufLen := len(metricNamesBuf)
+			metricNamesBuf = storage.MarshalMetricNameRaw(metricNamesBuf, ic.Labels)
+			mrs = append(mrs, storage.MetricRow{
+				MetricNameRaw: metricNamesBuf[metricNamesBufLen:],
+				Timestamp:     timestamp,
+			})
+		}
+		if err := vmstorage.RegisterMetricNames(mrs); err != nil {
+			return &httpserver.ErrorWithStatusCode{
+				Err:        fmt.Errorf("cannot register series: %w", err),
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		seriesRegistered.Add(len(mrs))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
@@ -17,12 +18,14 @@ import (
 
 var (
 	src = flag.String("src", "", "Source path with backup on the remote storage. "+
-		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir or fs:///path/to/local/backup/dir")
+		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir, swift://container/path/to/backup/dir or fs:///path/to/local/backup/dir")
 	storageDataPath = flag.String("storageDataPath", "victoria-metrics-data", "Destination path where backup must be restored. "+
 		"VictoriaMetrics must be stopped when restoring from backup. -storageDataPath dir can be non-empty. In this case the contents of -storageDataPath dir "+
 		"is synchronized with -src contents, i.e. it works like 'rsync --delete'")
-	concurrency             = flag.Int("concurrency", 10, "The number of concurrent workers. Higher concurrency may reduce restore duration")
-	maxBytesPerSecond       = flagutil.NewBytes("maxBytesPerSecond", 0, "The maximum download speed. There is no limit if it is set to 0")
+	concurrency       = flag.Int("concurrency", 10, "The number of concurrent workers. Higher concurrency may reduce restore duration")
+	maxBytesPerSecond = flagutil.NewBytes("maxBytesPerSecond", 0, "The maximum download speed. There is no limit if it is set to 0")
+	partitions        = flagutil.NewArray("partition", "Monthly partition to restore in the form YYYY_MM. All the partitions are restored if not set. "+
+		"indexdb is restored in full regardless of this flag")
 	skipBackupCompleteCheck = flag.Bool("skipBackupCompleteCheck", false, "Whether to skip checking for 'backup complete' file in -src. This may be useful for restoring from old backups, which were created without 'backup complete' file")
 )
 
@@ -35,6 +38,9 @@ func main() {
 	logger.Init()
 	cgroup.UpdateGOMAXPROCSToCPUQuota()
 
+	if err := checkPartitions(*partitions); err != nil {
+		logger.Fatalf("%s", err)
+	}
 	srcFS, err := newSrcFS()
 	if err != nil {
 		logger.Fatalf("%s", err)
@@ -48,6 +54,7 @@ func main() {
 		Src:                     srcFS,
 		Dst:                     dstFS,
 		SkipBackupCompleteCheck: *skipBackupCompleteCheck,
+		Partitions:              *partitions,
 	}
 	if err := a.Run(); err != nil {
 		logger.Fatalf("cannot restore from backup: %s", err)
@@ -66,6 +73,15 @@ See the docs at https://github.com/VictoriaMetrics/VictoriaMetrics/blob/master/a
 	flag.PrintDefaults()
 }
 
+func checkPartitions(partitions []string) error {
+	for _, partition := range partitions {
+		if _, err := time.Parse("2006_01", partition); err != nil {
+			return fmt.Errorf("invalid `-partition`=%q; it must be in the form YYYY_MM", partition)
+		}
+	}
+	return nil
+}
+
 func newDstFS() (*fslocal.FS, error) {
 	if len(*storageDataPath) == 0 {
 		return nil, fmt.Errorf("`-storageDataPath` cannot be empty")
@@ -1,6 +1,7 @@
 package vmselect
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,12 +10,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/prometheus"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/vmui"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auditlog"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/metrics"
 )
 
@@ -23,7 +28,13 @@ var (
 	maxConcurrentRequests = flag.Int("search.maxConcurrentRequests", getDefaultMaxConcurrentRequests(), "The maximum number of concurrent search requests. "+
 		"It shouldn't be high, since a single request can saturate all the CPU cores. See also -search.maxQueueDuration")
 	maxQueueDuration  = flag.Duration("search.maxQueueDuration", 10*time.Second, "The maximum time the request waits for execution when -search.maxConcurrentRequests limit is reached")
-	resetCacheAuthKey = flag.String("search.resetCacheAuthKey", "", "Optional authKey for resetting rollup cache via /internal/resetRollupResultCache call")
+	resetCacheAuthKey = flag.String("search.resetCacheAuthKey", "", "Optional authKey for resetting caches via /internal/resetRollupResultCache, "+
+		"/internal/resetTagFiltersCache and /internal/resetMetricNameCache calls")
+
+	maxRequestsPerSecondPerIP = flag.Float64("search.maxRequestsPerSecondPerIP", 0, "The maximum average rate of search requests per second from a single client IP. "+
+		"Requests exceeding the rate are rejected with '429 Too Many Requests'. There is no limit if set to 0. See also -search.maxRequestsBurstPerIP")
+	maxRequestsBurstPerIP = flag.Int("search.maxRequestsBurstPerIP", 10, "The maximum number of search requests a single client IP may send at once "+
+		"before being limited by -search.maxRequestsPerSecondPerIP")
 )
 
 func getDefaultMaxConcurrentRequests() int {
@@ -43,8 +54,12 @@ func getDefaultMaxConcurrentRequests() int {
 // Init initializes vmselect
 func Init() {
 	promql.InitRollupResultCache(*vmstorage.DataPath + "/cache/rollupResult")
+	prometheus.InitResultLabels()
 
 	concurrencyCh = make(chan struct{}, *maxConcurrentRequests)
+	if *maxRequestsPerSecondPerIP > 0 {
+		ipRateLimiter = httpserver.NewIPRateLimiter(*maxRequestsPerSecondPerIP, *maxRequestsBurstPerIP)
+	}
 }
 
 // Stop stops vmselect
@@ -54,6 +69,9 @@ func Stop() {
 
 var concurrencyCh chan struct{}
 
+// ipRateLimiter is non-nil if -search.maxRequestsPerSecondPerIP is set.
+var ipRateLimiter *httpserver.IPRateLimiter
+
 var (
 	concurrencyLimitReached = metrics.NewCounter(`vm_concurrent_select_limit_reached_total`)
 	concurrencyLimitTimeout = metrics.NewCounter(`vm_concurrent_select_limit_timeout_total`)
@@ -64,10 +82,31 @@ var (
 	_ = metrics.NewGauge(`vm_concurrent_select_current`, func() float64 {
 		return float64(len(concurrencyCh))
 	})
+
+	ipRateLimitReached = metrics.NewCounter(`vm_select_ip_rate_limit_reached_total`)
 )
 
 // RequestHandler handles remote read API requests for Prometheus
 func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
+	if vmui.RequestHandler(w, r) {
+		// Static UI pages do not need concurrency limiting.
+		return true
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/v1/") && httpserver.HandleCORSPreflight(w, r) {
+		// CORS preflight requests do not need concurrency limiting.
+		return true
+	}
+	if ipRateLimiter != nil && !ipRateLimiter.Allow(r) {
+		ipRateLimitReached.Inc()
+		err := &httpserver.ErrorWithStatusCode{
+			Err: fmt.Errorf("cannot handle more than %g search requests per second from %s; possible solutions: "+
+				"reduce request rate, increase `-search.maxRequestsPerSecondPerIP`, increase `-search.maxRequestsBurstPerIP`",
+				*maxRequestsPerSecondPerIP, httpserver.GetClientIP(r)),
+			StatusCode: http.StatusTooManyRequests,
+		}
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
 	startTime := time.Now()
 	// Limit the number of concurrent queries.
 	select {
@@ -96,12 +135,14 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 
 	path := strings.Replace(r.URL.Path, "//", "/", -1)
-	if path == "/internal/resetRollupResultCache" {
+	if rc, ok := cacheResetters[path]; ok {
 		if len(*resetCacheAuthKey) > 0 && r.FormValue("authKey") != *resetCacheAuthKey {
+			auditlog.LogRequest(r, rc.action, fmt.Errorf("invalid authKey"))
 			sendPrometheusError(w, r, fmt.Errorf("invalid authKey=%q for %q", r.FormValue("authKey"), path))
 			return true
 		}
-		promql.ResetRollupResultCache()
+		rc.reset()
+		auditlog.LogRequest(r, rc.action, nil)
 		return true
 	}
 
@@ -111,20 +152,37 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			labelValuesRequests.Inc()
 			labelName := s[:len(s)-len("/values")]
 			httpserver.EnableCORS(w, r)
-			if err := prometheus.LabelValuesHandler(startTime, labelName, w, r); err != nil {
+			err := prometheus.LabelValuesHandler(startTime, labelName, w, r)
+			updateRequestDurationMetrics("/api/v1/label/{}/values", startTime, r, err)
+			if err != nil {
 				labelValuesErrors.Inc()
 				sendPrometheusError(w, r, err)
 				return true
 			}
 			return true
 		}
+		if strings.HasSuffix(s, "/suggest") {
+			labelValueSuggestionsRequests.Inc()
+			labelName := s[:len(s)-len("/suggest")]
+			httpserver.EnableCORS(w, r)
+			err := prometheus.LabelValueSuggestionsHandler(startTime, labelName, w, r)
+			updateRequestDurationMetrics("/api/v1/label/{}/suggest", startTime, r, err)
+			if err != nil {
+				labelValueSuggestionsErrors.Inc()
+				sendPrometheusError(w, r, err)
+				return true
+			}
+			return true
+		}
 	}
 
 	switch path {
 	case "/api/v1/query":
 		queryRequests.Inc()
 		httpserver.EnableCORS(w, r)
-		if err := prometheus.QueryHandler(startTime, w, r); err != nil {
+		err := prometheus.QueryHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/query", startTime, r, err)
+		if err != nil {
 			queryErrors.Inc()
 			sendPrometheusError(w, r, err)
 			return true
@@ -133,7 +191,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	case "/api/v1/query_range":
 		queryRangeRequests.Inc()
 		httpserver.EnableCORS(w, r)
-		if err := prometheus.QueryRangeHandler(startTime, w, r); err != nil {
+		err := prometheus.QueryRangeHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/query_range", startTime, r, err)
+		if err != nil {
 			queryRangeErrors.Inc()
 			sendPrometheusError(w, r, err)
 			return true
@@ -142,7 +202,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	case "/api/v1/series":
 		seriesRequests.Inc()
 		httpserver.EnableCORS(w, r)
-		if err := prometheus.SeriesHandler(startTime, w, r); err != nil {
+		err := prometheus.SeriesHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/series", startTime, r, err)
+		if err != nil {
 			seriesErrors.Inc()
 			sendPrometheusError(w, r, err)
 			return true
@@ -151,7 +213,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	case "/api/v1/series/count":
 		seriesCountRequests.Inc()
 		httpserver.EnableCORS(w, r)
-		if err := prometheus.SeriesCountHandler(startTime, w, r); err != nil {
+		err := prometheus.SeriesCountHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/series/count", startTime, r, err)
+		if err != nil {
 			seriesCountErrors.Inc()
 			sendPrometheusError(w, r, err)
 			return true
@@ -160,7 +224,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	case "/api/v1/labels":
 		labelsRequests.Inc()
 		httpserver.EnableCORS(w, r)
-		if err := prometheus.LabelsHandler(startTime, w, r); err != nil {
+		err := prometheus.LabelsHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/labels", startTime, r, err)
+		if err != nil {
 			labelsErrors.Inc()
 			sendPrometheusError(w, r, err)
 			return true
@@ -169,7 +235,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	case "/api/v1/labels/count":
 		labelsCountRequests.Inc()
 		httpserver.EnableCORS(w, r)
-		if err := prometheus.LabelsCountHandler(startTime, w, r); err != nil {
+		err := prometheus.LabelsCountHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/labels/count", startTime, r, err)
+		if err != nil {
 			labelsCountErrors.Inc()
 			sendPrometheusError(w, r, err)
 			return true
@@ -177,27 +245,53 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return true
 	case "/api/v1/status/tsdb":
 		statusTSDBRequests.Inc()
-		if err := prometheus.TSDBStatusHandler(startTime, w, r); err != nil {
+		err := prometheus.TSDBStatusHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/status/tsdb", startTime, r, err)
+		if err != nil {
 			statusTSDBErrors.Inc()
 			sendPrometheusError(w, r, err)
 			return true
 		}
 		return true
+	case "/api/v1/status/metric_usage":
+		statusMetricUsageRequests.Inc()
+		err := prometheus.MetricUsageHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/status/metric_usage", startTime, r, err)
+		if err != nil {
+			statusMetricUsageErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "/api/v1/status/active_queries":
 		statusActiveQueriesRequests.Inc()
 		promql.WriteActiveQueries(w)
 		return true
 	case "/api/v1/export":
 		exportRequests.Inc()
-		if err := prometheus.ExportHandler(startTime, w, r); err != nil {
+		err := prometheus.ExportHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/export", startTime, r, err)
+		if err != nil {
 			exportErrors.Inc()
 			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
 			return true
 		}
 		return true
+	case "/api/v1/export/native":
+		exportNativeRequests.Inc()
+		err := prometheus.ExportNativeHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/export/native", startTime, r, err)
+		if err != nil {
+			exportNativeErrors.Inc()
+			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
+			return true
+		}
+		return true
 	case "/federate":
 		federateRequests.Inc()
-		if err := prometheus.FederateHandler(startTime, w, r); err != nil {
+		err := prometheus.FederateHandler(startTime, w, r)
+		updateRequestDurationMetrics("/federate", startTime, r, err)
+		if err != nil {
 			federateErrors.Inc()
 			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
 			return true
@@ -225,23 +319,74 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		deleteRequests.Inc()
 		authKey := r.FormValue("authKey")
 		if authKey != *deleteAuthKey {
+			auditlog.LogRequest(r, "delete_series", fmt.Errorf("invalid authKey"))
 			httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -deleteAuthKey command line flag", authKey)
 			return true
 		}
-		if err := prometheus.DeleteHandler(startTime, r); err != nil {
+		err := prometheus.DeleteHandler(startTime, w, r)
+		updateRequestDurationMetrics("/api/v1/admin/tsdb/delete_series", startTime, r, err)
+		auditlog.LogRequest(r, "delete_series", err)
+		if err != nil {
 			deleteErrors.Inc()
 			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
 			return true
 		}
-		w.WriteHeader(http.StatusNoContent)
 		return true
 	default:
 		return false
 	}
 }
 
+// updateRequestDurationMetrics updates vm_http_request_duration_seconds histogram for the given path
+// and the request outcome determined by err.
+func updateRequestDurationMetrics(path string, startTime time.Time, r *http.Request, err error) {
+	outcome := getRequestOutcome(r, err)
+	name := fmt.Sprintf(`vm_http_request_duration_seconds{path=%q,outcome=%q}`, path, outcome)
+	metrics.GetOrCreateHistogram(name).UpdateDuration(startTime)
+}
+
+func getRequestOutcome(r *http.Request, err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.Canceled) || errors.Is(err, netstorage.ErrCanceled) || r.Context().Err() == context.Canceled:
+		return "canceled"
+	case errors.Is(err, netstorage.ErrTimeout):
+		return "timeout"
+	case netstorage.IsLimitExceededError(err):
+		return "limit_exceeded"
+	default:
+		return "error"
+	}
+}
+
+type cacheResetter struct {
+	// action is the name of the action in the audit log.
+	action string
+	reset  func()
+}
+
+// cacheResetters contains handlers for resetting individual caches.
+//
+// These caches may contain stale data after backfilling or after changing relabeling rules.
+var cacheResetters = map[string]cacheResetter{
+	"/internal/resetRollupResultCache": {
+		action: "reset_rollup_result_cache",
+		reset:  promql.ResetRollupResultCache,
+	},
+	"/internal/resetTagFiltersCache": {
+		action: "reset_tag_filters_cache",
+		reset:  vmstorage.ResetTagFiltersCache,
+	},
+	"/internal/resetMetricNameCache": {
+		action: "reset_metric_name_cache",
+		reset:  vmstorage.ResetMetricNameCache,
+	},
+}
+
 func sendPrometheusError(w http.ResponseWriter, r *http.Request, err error) {
 	logger.Warnf("error in %q: %s", r.RequestURI, err)
+	tracing.SpanFromContext(r.Context()).SetError(err)
 
 	w.Header().Set("Content-Type", "application/json")
 	statusCode := http.StatusUnprocessableEntity
@@ -257,6 +402,9 @@ var (
 	labelValuesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/label/{}/values"}`)
 	labelValuesErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/label/{}/values"}`)
 
+	labelValueSuggestionsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/label/{}/suggest"}`)
+	labelValueSuggestionsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/label/{}/suggest"}`)
+
 	queryRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query"}`)
 	queryErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query"}`)
 
@@ -278,6 +426,9 @@ var (
 	statusTSDBRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/tsdb"}`)
 	statusTSDBErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/tsdb"}`)
 
+	statusMetricUsageRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/metric_usage"}`)
+	statusMetricUsageErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/metric_usage"}`)
+
 	statusActiveQueriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/active_queries"}`)
 
 	deleteRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/admin/tsdb/delete_series"}`)
@@ -286,6 +437,9 @@ var (
 	exportRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/export"}`)
 	exportErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/export"}`)
 
+	exportNativeRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/export/native"}`)
+	exportNativeErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/export/native"}`)
+
 	federateRequests = metrics.NewCounter(`vm_http_requests_total{path="/federate"}`)
 	federateErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/federate"}`)
 
@@ -0,0 +1,37 @@
+package vmselect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+)
+
+func TestGetRequestOutcome(t *testing.T) {
+	f := func(ctx context.Context, err error, outcomeExpected string) {
+		t.Helper()
+		r, reqErr := http.NewRequestWithContext(ctx, "GET", "http://localhost/api/v1/query", nil)
+		if reqErr != nil {
+			t.Fatalf("cannot create request: %s", reqErr)
+		}
+		outcome := getRequestOutcome(r, err)
+		if outcome != outcomeExpected {
+			t.Fatalf("unexpected outcome for err=%v; got %q; want %q", err, outcome, outcomeExpected)
+		}
+	}
+
+	f(context.Background(), nil, "ok")
+	f(context.Background(), fmt.Errorf("some error"), "error")
+	f(context.Background(), fmt.Errorf("%w during the query: foo", netstorage.ErrTimeout), "timeout")
+	f(context.Background(), fmt.Errorf("cannot evaluate query: %w", &netstorage.LimitExceededError{
+		Err: fmt.Errorf("too many points"),
+	}), "limit_exceeded")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f(ctx, fmt.Errorf("cannot write response: broken pipe"), "canceled")
+	f(context.Background(), fmt.Errorf("foo: %w", context.Canceled), "canceled")
+	f(context.Background(), fmt.Errorf("%w during the query: foo", netstorage.ErrCanceled), "canceled")
+}
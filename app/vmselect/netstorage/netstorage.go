@@ -8,21 +8,39 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/quicktemplate"
 )
 
 var (
-	maxTagKeysPerSearch   = flag.Int("search.maxTagKeys", 100e3, "The maximum number of tag keys returned per search")
-	maxTagValuesPerSearch = flag.Int("search.maxTagValues", 100e3, "The maximum number of tag values returned per search")
-	maxMetricsPerSearch   = flag.Int("search.maxUniqueTimeseries", 300e3, "The maximum number of unique time series each search can scan")
+	maxTagKeysPerSearch   = flagutil.NewReloadableInt("search.maxTagKeys", 100e3, "The maximum number of tag keys returned per search")
+	maxTagValuesPerSearch = flagutil.NewReloadableInt("search.maxTagValues", 100e3, "The maximum number of tag values returned per search")
+	maxMetricsPerSearch   = flagutil.NewReloadableInt("search.maxUniqueTimeseries", 300e3, "The maximum number of unique time series each search can scan")
+	maxSamplesPerSeries   = flagutil.NewReloadableInt("search.maxSamplesPerSeries", 0, "The maximum number of raw samples a single query can scan per each time series. "+
+		"This allows limiting memory usage. Zero means no limit")
+	maxSamplesPerQuery = flagutil.NewReloadableInt("search.maxSamplesPerQuery", 0, "The maximum number of raw samples a single query can process across all the time series. "+
+		"This protects from heavy queries, which select unexpectedly high number of raw samples. Zero means no limit")
+
+	replicaLabels = flagutil.NewArray("dedup.replicaLabel", "Optional label names identifying replicas in HA pairs of Prometheus instances, which write identical data. "+
+		"Time series differing only by these labels are merged into a single time series without these labels at query time. "+
+		"It is recommended to set -dedup.minScrapeInterval to scrape interval, so samples from replicas are de-duplicated after merging. "+
+		"See https://victoriametrics.github.io/#deduplication")
+
+	exportPrefetchBlocks = flag.Int("search.exportPrefetchBlocks", 16, "The number of data blocks to read ahead in background per each export request. "+
+		"This allows exports to saturate disk bandwidth on disks with high read latency. Prefetching is disabled if set to 0. "+
+		"See also -search.maxExportPrefetchBlocks")
+	maxExportPrefetchBlocks = flag.Int("search.maxExportPrefetchBlocks", 1024, "The maximum number of data blocks, which may be read ahead across all the concurrently executed export requests. "+
+		"Export requests read blocks without prefetching when the limit is reached. See also -search.exportPrefetchBlocks")
 )
 
 // Result is a single timeseries result.
@@ -50,14 +68,36 @@ func (r *Result) reset() {
 
 // Results holds results returned from ProcessSearchQuery.
 type Results struct {
+	// samplesScanned must go at the top of the structure in order to properly align by 8 bytes on 32-bit archs.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212 .
+	samplesScanned uint64
+
 	tr        storage.TimeRange
 	fetchData bool
 	deadline  Deadline
 
+	// blocksRead is the number of data blocks read from the storage.
+	blocksRead int
+
 	packedTimeseries []packedTimeseries
 	sr               *storage.Search
 }
 
+// BlocksRead returns the number of data blocks read from the storage for rss.
+func (rss *Results) BlocksRead() int {
+	return rss.blocksRead
+}
+
+// SamplesScanned returns the number of raw samples scanned during RunParallel call.
+func (rss *Results) SamplesScanned() uint64 {
+	return atomic.LoadUint64(&rss.samplesScanned)
+}
+
+// PruneStats returns statistics on partitions and parts pruned by the search time range.
+func (rss *Results) PruneStats() storage.PruneStats {
+	return rss.sr.PruneStats()
+}
+
 // Len returns the number of results in rss.
 func (rss *Results) Len() int {
 	return len(rss.packedTimeseries)
@@ -96,10 +136,10 @@ func timeseriesWorker(workerID uint) {
 	for tsw := range timeseriesWorkCh {
 		rss := tsw.rss
 		if rss.deadline.Exceeded() {
-			tsw.doneCh <- fmt.Errorf("timeout exceeded during query execution: %s", rss.deadline.String())
+			tsw.doneCh <- fmt.Errorf("%w during query execution: %s", rss.deadline.Err(), rss.deadline.String())
 			continue
 		}
-		if err := tsw.pts.Unpack(&rs, rss.tr, rss.fetchData); err != nil {
+		if err := tsw.pts.Unpack(&rs, rss); err != nil {
 			tsw.doneCh <- fmt.Errorf("error during time series unpacking: %w", err)
 			continue
 		}
@@ -158,6 +198,76 @@ func (rss *Results) RunParallel(f func(rs *Result, workerID uint)) error {
 	return firstErr
 }
 
+// RunParallelSorted runs f in parallel for all the results from rss and sends the data written by f to resultsCh
+// in the order of metric names, so the results for the same metric name are sent together.
+//
+// f must write the data for rs to bb and shouldn't hold references to rs after returning.
+// Only a limited number of results is processed ahead of the results sent to resultsCh,
+// so the whole response isn't buffered in memory when resultsCh is consumed slowly.
+//
+// rss becomes unusable after the call to RunParallelSorted.
+func (rss *Results) RunParallelSorted(f func(rs *Result, workerID uint, bb *quicktemplate.ByteBuffer), resultsCh chan<- *quicktemplate.ByteBuffer) error {
+	defer rss.mustClose()
+
+	// Marshaled metric names start with the metric group, so the results for the same metric group
+	// are adjacent after sorting by marshaled metric names.
+	pts := rss.packedTimeseries
+	sort.Slice(pts, func(i, j int) bool {
+		return pts[i].metricName < pts[j].metricName
+	})
+
+	// Feed workers with work in a separate goroutine, so the results could be sent to resultsCh in order
+	// while the remaining work is in progress.
+	tsws := make([]*timeseriesWork, len(pts))
+	bbs := make([]*quicktemplate.ByteBuffer, len(pts))
+	for i := range pts {
+		i := i
+		tsws[i] = &timeseriesWork{
+			rss: rss,
+			pts: &pts[i],
+			f: func(rs *Result, workerID uint) {
+				bb := quicktemplate.AcquireByteBuffer()
+				f(rs, workerID, bb)
+				bbs[i] = bb
+			},
+			doneCh: make(chan error, 1),
+		}
+	}
+	limiterCh := make(chan struct{}, gomaxprocs*16)
+	go func() {
+		for _, tsw := range tsws {
+			limiterCh <- struct{}{}
+			timeseriesWorkCh <- tsw
+		}
+	}()
+
+	// Wait until work is complete and send the results in order.
+	var firstErr error
+	rowsProcessedTotal := 0
+	for i, tsw := range tsws {
+		if err := <-tsw.doneCh; err != nil && firstErr == nil {
+			// Return just the first error, since other errors
+			// are likely duplicate the first error.
+			firstErr = err
+		}
+		<-limiterCh
+		rowsProcessedTotal += tsw.rowsProcessed
+		if bb := bbs[i]; bb != nil {
+			bbs[i] = nil
+			if firstErr == nil {
+				resultsCh <- bb
+			} else {
+				quicktemplate.ReleaseByteBuffer(bb)
+			}
+		}
+	}
+	rss.packedTimeseries = rss.packedTimeseries[:0]
+
+	perQueryRowsProcessed.Update(float64(rowsProcessedTotal))
+	perQuerySeriesProcessed.Update(float64(len(tsws)))
+	return firstErr
+}
+
 var perQueryRowsProcessed = metrics.NewHistogram(`vm_per_query_rows_processed_count`)
 var perQuerySeriesProcessed = metrics.NewHistogram(`vm_per_query_series_processed_count`)
 
@@ -180,6 +290,11 @@ type unpackWork struct {
 	fetchData bool
 	sbs       []*sortBlock
 	doneCh    chan error
+
+	// seriesSamples and querySamples point to the number of samples unpacked
+	// for the current time series and for the whole query.
+	seriesSamples *uint64
+	querySamples  *uint64
 }
 
 func (upw *unpackWork) reset() {
@@ -196,6 +311,8 @@ func (upw *unpackWork) reset() {
 		sbs[i] = nil
 	}
 	upw.sbs = upw.sbs[:0]
+	upw.seriesSamples = nil
+	upw.querySamples = nil
 	if n := len(upw.doneCh); n > 0 {
 		logger.Panicf("BUG: upw.doneCh must be empty; it contains %d items now", n)
 	}
@@ -210,10 +327,35 @@ func (upw *unpackWork) unpack() {
 			return
 		}
 		upw.sbs = append(upw.sbs, sb)
+		n := uint64(len(sb.Timestamps))
+		if err := checkSamplesLimits(atomic.AddUint64(upw.seriesSamples, n), atomic.AddUint64(upw.querySamples, n)); err != nil {
+			upw.doneCh <- err
+			return
+		}
 	}
 	upw.doneCh <- nil
 }
 
+func checkSamplesLimits(seriesSamples, querySamples uint64) error {
+	if n := maxSamplesPerSeries.Get(); n > 0 && seriesSamples > uint64(n) {
+		samplesLimitExceeded.Inc()
+		return &LimitExceededError{
+			Err: fmt.Errorf("cannot select more than -search.maxSamplesPerSeries=%d samples per time series; "+
+				"possible solutions: to reduce the time range for the query; to increase -search.maxSamplesPerSeries", n),
+		}
+	}
+	if n := maxSamplesPerQuery.Get(); n > 0 && querySamples > uint64(n) {
+		samplesLimitExceeded.Inc()
+		return &LimitExceededError{
+			Err: fmt.Errorf("cannot select more than -search.maxSamplesPerQuery=%d samples; possible solutions: to reduce the time range for the query; "+
+				"to use more specific label filters in order to select lower number of time series; to increase -search.maxSamplesPerQuery", n),
+		}
+	}
+	return nil
+}
+
+var samplesLimitExceeded = metrics.NewCounter(`vm_search_samples_limit_exceeded_total`)
+
 func getUnpackWork() *unpackWork {
 	v := unpackWorkPool.Get()
 	if v != nil {
@@ -248,8 +390,30 @@ func unpackWorker() {
 // This batch is needed in order to reduce contention for upackWorkCh in multi-CPU system.
 var unpackBatchSize = 8 * runtime.GOMAXPROCS(-1)
 
+// minUnpackBatchSize is the minimum number of blocks that may be unpacked at once by a single goroutine.
+//
+// Smaller batches increase the overhead on passing them to unpack workers.
+const minUnpackBatchSize = 4
+
+// getUnpackBatchSize returns the batch size for unpacking the given number of blocks for a single time series.
+//
+// The blocks are spread among all the unpack workers, so a single time series with many blocks
+// is unpacked on all the available CPU cores instead of a single CPU core.
+func getUnpackBatchSize(blocksCount int) int {
+	n := (blocksCount + gomaxprocs - 1) / gomaxprocs
+	if n < minUnpackBatchSize {
+		return minUnpackBatchSize
+	}
+	if n > unpackBatchSize {
+		return unpackBatchSize
+	}
+	return n
+}
+
 // Unpack unpacks pts to dst.
-func (pts *packedTimeseries) Unpack(dst *Result, tr storage.TimeRange, fetchData bool) error {
+//
+// The number of unpacked samples is limited by -search.maxSamplesPerSeries and -search.maxSamplesPerQuery.
+func (pts *packedTimeseries) Unpack(dst *Result, rss *Results) error {
 	dst.reset()
 
 	if err := dst.MetricName.Unmarshal(bytesutil.ToUnsafeBytes(pts.metricName)); err != nil {
@@ -257,15 +421,22 @@ func (pts *packedTimeseries) Unpack(dst *Result, tr storage.TimeRange, fetchData
 	}
 
 	// Feed workers with work
-	upws := make([]*unpackWork, 0, 1+len(pts.brs)/unpackBatchSize)
+	var seriesSamples uint64
+	tr := rss.tr
+	batchSize := getUnpackBatchSize(len(pts.brs))
+	upws := make([]*unpackWork, 0, 1+len(pts.brs)/batchSize)
 	upw := getUnpackWork()
-	upw.fetchData = fetchData
+	upw.fetchData = rss.fetchData
+	upw.seriesSamples = &seriesSamples
+	upw.querySamples = &rss.samplesScanned
 	for _, br := range pts.brs {
-		if len(upw.ws) >= unpackBatchSize {
+		if len(upw.ws) >= batchSize {
 			unpackWorkCh <- upw
 			upws = append(upws, upw)
 			upw = getUnpackWork()
-			upw.fetchData = fetchData
+			upw.fetchData = rss.fetchData
+			upw.seriesSamples = &seriesSamples
+			upw.querySamples = &rss.samplesScanned
 		}
 		upw.ws = append(upw.ws, unpackWorkItem{
 			br: br,
@@ -456,12 +627,22 @@ func DeleteSeries(sq *storage.SearchQuery) (int, error) {
 	return vmstorage.DeleteMetrics(tfss)
 }
 
+// DeleteSeriesDryRun returns the number of series, which would be deleted by DeleteSeries(sq),
+// together with up to maxMetricNames names of these series.
+func DeleteSeriesDryRun(sq *storage.SearchQuery, maxMetricNames int) (int, []storage.MetricName, error) {
+	tfss, err := setupTfss(sq.TagFilterss)
+	if err != nil {
+		return 0, nil, err
+	}
+	return vmstorage.DeleteMetricsDryRun(tfss, maxMetricNames)
+}
+
 // GetLabels returns labels until the given deadline.
 func GetLabels(deadline Deadline) ([]string, error) {
 	if deadline.Exceeded() {
-		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+		return nil, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
 	}
-	labels, err := vmstorage.SearchTagKeys(*maxTagKeysPerSearch, deadline.deadline)
+	labels, err := vmstorage.SearchTagKeys(maxTagKeysPerSearch.Get(), deadline.deadline)
 	if err != nil {
 		return nil, fmt.Errorf("error during labels search: %w", err)
 	}
@@ -483,14 +664,14 @@ func GetLabels(deadline Deadline) ([]string, error) {
 // until the given deadline.
 func GetLabelValues(labelName string, deadline Deadline) ([]string, error) {
 	if deadline.Exceeded() {
-		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+		return nil, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
 	}
 	if labelName == "__name__" {
 		labelName = ""
 	}
 
 	// Search for tag values
-	labelValues, err := vmstorage.SearchTagValues([]byte(labelName), *maxTagValuesPerSearch, deadline.deadline)
+	labelValues, err := vmstorage.SearchTagValues([]byte(labelName), maxTagValuesPerSearch.Get(), deadline.deadline)
 	if err != nil {
 		return nil, fmt.Errorf("error during label values search for labelName=%q: %w", labelName, err)
 	}
@@ -501,12 +682,30 @@ func GetLabelValues(labelName string, deadline Deadline) ([]string, error) {
 	return labelValues, nil
 }
 
+// GetLabelValueSuggestions returns label values for the given labelName matching the given query until the given deadline.
+//
+// Values starting with query are returned if substring is false. Otherwise values containing query are returned.
+// The returned values aren't sorted.
+func GetLabelValueSuggestions(labelName, query string, substring bool, deadline Deadline) ([]storage.TagValueSuggestion, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
+	}
+	if labelName == "__name__" {
+		labelName = ""
+	}
+	tvss, err := vmstorage.SearchTagValueSuggestions([]byte(labelName), []byte(query), substring, maxTagValuesPerSearch.Get(), deadline.deadline)
+	if err != nil {
+		return nil, fmt.Errorf("error during label value suggestions search for labelName=%q, query=%q: %w", labelName, query, err)
+	}
+	return tvss, nil
+}
+
 // GetLabelEntries returns all the label entries until the given deadline.
 func GetLabelEntries(deadline Deadline) ([]storage.TagEntry, error) {
 	if deadline.Exceeded() {
-		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+		return nil, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
 	}
-	labelEntries, err := vmstorage.SearchTagEntries(*maxTagKeysPerSearch, *maxTagValuesPerSearch, deadline.deadline)
+	labelEntries, err := vmstorage.SearchTagEntries(maxTagKeysPerSearch.Get(), maxTagValuesPerSearch.Get(), deadline.deadline)
 	if err != nil {
 		return nil, fmt.Errorf("error during label entries request: %w", err)
 	}
@@ -534,7 +733,7 @@ func GetLabelEntries(deadline Deadline) ([]storage.TagEntry, error) {
 // GetTSDBStatusForDate returns tsdb status according to https://prometheus.io/docs/prometheus/latest/querying/api/#tsdb-stats
 func GetTSDBStatusForDate(deadline Deadline, date uint64, topN int) (*storage.TSDBStatus, error) {
 	if deadline.Exceeded() {
-		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+		return nil, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
 	}
 	status, err := vmstorage.GetTSDBStatusForDate(date, topN, deadline.deadline)
 	if err != nil {
@@ -543,10 +742,28 @@ func GetTSDBStatusForDate(deadline Deadline, date uint64, topN int) (*storage.TS
 	return status, nil
 }
 
+// GetTSDBStatusWithFilters returns tsdb status for series matching sq.TagFilterss on the given date.
+//
+// Series counts by values for focusLabel are returned if focusLabel isn't empty.
+func GetTSDBStatusWithFilters(deadline Deadline, sq *storage.SearchQuery, date uint64, topN int, focusLabel string) (*storage.TSDBStatus, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
+	}
+	tfss, err := setupTfss(sq.TagFilterss)
+	if err != nil {
+		return nil, err
+	}
+	status, err := vmstorage.GetTSDBStatusWithFiltersForDate(tfss, date, topN, focusLabel, maxMetricsPerSearch.Get(), deadline.deadline)
+	if err != nil {
+		return nil, fmt.Errorf("error during tsdb status with filters request: %w", err)
+	}
+	return status, nil
+}
+
 // GetSeriesCount returns the number of unique series.
 func GetSeriesCount(deadline Deadline) (uint64, error) {
 	if deadline.Exceeded() {
-		return 0, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+		return 0, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
 	}
 	n, err := vmstorage.GetSeriesCount(deadline.deadline)
 	if err != nil {
@@ -555,6 +772,82 @@ func GetSeriesCount(deadline Deadline) (uint64, error) {
 	return n, nil
 }
 
+// GetSeriesCountWithFilters returns the number of unique series matching sq.
+func GetSeriesCountWithFilters(sq *storage.SearchQuery, deadline Deadline) (uint64, error) {
+	if deadline.Exceeded() {
+		return 0, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
+	}
+	tfss, err := setupTfss(sq.TagFilterss)
+	if err != nil {
+		return 0, err
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	if err := vmstorage.CheckTimeRange(tr); err != nil {
+		return 0, err
+	}
+	n, err := vmstorage.GetSeriesCountWithFilters(tfss, tr, maxMetricsPerSearch.Get(), deadline.deadline)
+	if err != nil {
+		return 0, fmt.Errorf("error during series count request for %q: %w", sq, err)
+	}
+	return n, nil
+}
+
+// SearchMetricNamesPage returns up to limit marshaled metric names matching sq, which follow the series with afterMetricID.
+//
+// -search.maxUniqueTimeseries is used as limit if it isn't positive.
+// The returned nextAfterMetricID must be passed to afterMetricID for obtaining the next page. It is zero if there are no more pages.
+func SearchMetricNamesPage(sq *storage.SearchQuery, afterMetricID uint64, limit int, deadline Deadline) ([][]byte, uint64, error) {
+	if deadline.Exceeded() {
+		return nil, 0, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
+	}
+	tfss, err := setupTfss(sq.TagFilterss)
+	if err != nil {
+		return nil, 0, err
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	if err := vmstorage.CheckTimeRange(tr); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = maxMetricsPerSearch.Get()
+	}
+	// Request an additional metric name in order to determine whether there are more pages.
+	metricIDs, metricNames, err := vmstorage.SearchMetricNamesPage(tfss, tr, afterMetricID, limit+1, maxMetricsPerSearch.Get(), deadline.deadline)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error during metric names search for %q: %w", sq, err)
+	}
+	nextAfterMetricID := uint64(0)
+	if len(metricNames) > limit {
+		metricNames = metricNames[:limit]
+		nextAfterMetricID = metricIDs[limit-1]
+	}
+	if len(*replicaLabels) > 0 {
+		// Series from distinct replicas may be spread among pages, so they are merged only inside a page.
+		var mn storage.MetricName
+		m := make(map[string]struct{}, len(metricNames))
+		dst := metricNames[:0]
+		for _, metricName := range metricNames {
+			metricNameDedup, err := removeReplicaLabels(nil, &mn, metricName)
+			if err != nil {
+				return nil, 0, err
+			}
+			if _, ok := m[string(metricNameDedup)]; ok {
+				continue
+			}
+			m[string(metricNameDedup)] = struct{}{}
+			dst = append(dst, metricNameDedup)
+		}
+		metricNames = dst
+	}
+	return metricNames, nextAfterMetricID, nil
+}
+
 func getStorageSearch() *storage.Search {
 	v := ssPool.Get()
 	if v == nil {
@@ -575,7 +868,7 @@ var ssPool sync.Pool
 // Results.RunParallel or Results.Cancel must be called on the returned Results.
 func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline Deadline) (*Results, error) {
 	if deadline.Exceeded() {
-		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+		return nil, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
 	}
 
 	// Setup search.
@@ -595,17 +888,21 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline Deadli
 	defer vmstorage.WG.Done()
 
 	sr := getStorageSearch()
-	maxSeriesCount := sr.Init(vmstorage.Storage, tfss, tr, *maxMetricsPerSearch, deadline.deadline)
+	maxSeriesCount := sr.Init(vmstorage.Storage, tfss, tr, maxMetricsPerSearch.Get(), deadline.deadline, deadline.stopCh)
 
 	m := make(map[string][]storage.BlockRef, maxSeriesCount)
 	orderedMetricNames := make([]string, 0, maxSeriesCount)
 	blocksRead := 0
+	var rd replicaDeduper
 	for sr.NextMetricBlock() {
 		blocksRead++
 		if deadline.Exceeded() {
-			return nil, fmt.Errorf("timeout exceeded while fetching data block #%d from storage: %s", blocksRead, deadline.String())
+			return nil, fmt.Errorf("%w while fetching data block #%d from storage: %s", deadline.Err(), blocksRead, deadline.String())
+		}
+		metricName, err := rd.dedupMetricName(sr.MetricBlockRef.MetricName)
+		if err != nil {
+			return nil, err
 		}
-		metricName := sr.MetricBlockRef.MetricName
 		brs := m[string(metricName)]
 		brs = append(brs, *sr.MetricBlockRef.BlockRef)
 		if len(brs) > 1 {
@@ -619,8 +916,8 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline Deadli
 		}
 	}
 	if err := sr.Error(); err != nil {
-		if errors.Is(err, storage.ErrDeadlineExceeded) {
-			return nil, fmt.Errorf("timeout exceeded during the query: %s", deadline.String())
+		if errors.Is(err, storage.ErrDeadlineExceeded) || errors.Is(err, storage.ErrSearchCanceled) {
+			return nil, fmt.Errorf("%w during the query: %s", deadline.Err(), deadline.String())
 		}
 		return nil, fmt.Errorf("search error after reading %d data blocks: %w", blocksRead, err)
 	}
@@ -629,6 +926,7 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline Deadli
 	rss.tr = tr
 	rss.fetchData = fetchData
 	rss.deadline = deadline
+	rss.blocksRead = blocksRead
 	pts := make([]packedTimeseries, len(orderedMetricNames))
 	for i, metricName := range orderedMetricNames {
 		pts[i] = packedTimeseries{
@@ -641,6 +939,281 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline Deadli
 	return &rss, nil
 }
 
+// GetFirstTimestamp returns a lower bound for the first timestamp of samples matching sq.
+//
+// false is returned if there are no samples matching sq.
+// Only block headers are read, so this is much cheaper than fetching the data with ProcessSearchQuery.
+func GetFirstTimestamp(sq *storage.SearchQuery, deadline Deadline) (int64, bool, error) {
+	if deadline.Exceeded() {
+		return 0, false, fmt.Errorf("%w before starting the query processing: %s", deadline.Err(), deadline.String())
+	}
+	tfss, err := setupTfss(sq.TagFilterss)
+	if err != nil {
+		return 0, false, err
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	if err := vmstorage.CheckTimeRange(tr); err != nil {
+		return 0, false, err
+	}
+
+	vmstorage.WG.Add(1)
+	defer vmstorage.WG.Done()
+
+	sr := getStorageSearch()
+	defer putStorageSearch(sr)
+	sr.Init(vmstorage.Storage, tfss, tr, maxMetricsPerSearch.Get(), deadline.deadline, deadline.stopCh)
+	minTimestamp := int64(0)
+	found := false
+	for sr.NextMetricBlock() {
+		ts := sr.MetricBlockRef.BlockRef.MinTimestamp()
+		if ts < tr.MinTimestamp {
+			// The block overlaps the start of the time range.
+			ts = tr.MinTimestamp
+		}
+		if !found || ts < minTimestamp {
+			minTimestamp = ts
+			found = true
+		}
+		if minTimestamp == tr.MinTimestamp {
+			// Fast path - there is no need in reading the remaining blocks.
+			break
+		}
+	}
+	if err := sr.Error(); err != nil {
+		if errors.Is(err, storage.ErrDeadlineExceeded) || errors.Is(err, storage.ErrSearchCanceled) {
+			return 0, false, fmt.Errorf("%w during the query: %s", deadline.Err(), deadline.String())
+		}
+		return 0, false, fmt.Errorf("search error: %w", err)
+	}
+	return minTimestamp, found, nil
+}
+
+// replicaDeduper maps metric names from HA replicas to a single metric name without -dedup.replicaLabel labels.
+//
+// Blocks for the same metric name go in a row during the search, so the last metric name is cached.
+type replicaDeduper struct {
+	lastMetricName      []byte
+	lastMetricNameDedup []byte
+	mn                  storage.MetricName
+}
+
+// dedupMetricName returns metricName without -dedup.replicaLabel labels.
+//
+// The returned metric name is valid until the next call to dedupMetricName.
+func (rd *replicaDeduper) dedupMetricName(metricName []byte) ([]byte, error) {
+	if len(*replicaLabels) == 0 {
+		return metricName, nil
+	}
+	if string(metricName) != string(rd.lastMetricName) {
+		metricNameDedup, err := removeReplicaLabels(rd.lastMetricNameDedup[:0], &rd.mn, metricName)
+		if err != nil {
+			return nil, err
+		}
+		rd.lastMetricName = append(rd.lastMetricName[:0], metricName...)
+		rd.lastMetricNameDedup = metricNameDedup
+	}
+	return rd.lastMetricNameDedup, nil
+}
+
+// removeReplicaLabels appends marshaled metricName without -dedup.replicaLabel labels to dst.
+//
+// This allows merging time series from HA replicas into a single time series.
+func removeReplicaLabels(dst []byte, mn *storage.MetricName, metricName []byte) ([]byte, error) {
+	if err := mn.Unmarshal(metricName); err != nil {
+		return dst, fmt.Errorf("cannot unmarshal metricName %q: %w", metricName, err)
+	}
+	mn.RemoveTagsIgnoring(*replicaLabels)
+	return mn.Marshal(dst), nil
+}
+
+// ExportBlocks searches for time series matching sq and calls f for each found block.
+//
+// f is called in parallel from multiple goroutines.
+// The process is stopped if f returns non-nil error.
+// It is the responsibility of f to filter block rows according to the given tr,
+// since the block may contain rows outside tr.
+func ExportBlocks(sq *storage.SearchQuery, deadline Deadline, f func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange) error) error {
+	if deadline.Exceeded() {
+		return fmt.Errorf("%w before starting data export: %s", deadline.Err(), deadline.String())
+	}
+	tfss, err := setupTfss(sq.TagFilterss)
+	if err != nil {
+		return err
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	if err := vmstorage.CheckTimeRange(tr); err != nil {
+		return err
+	}
+
+	vmstorage.WG.Add(1)
+	defer vmstorage.WG.Done()
+
+	sr := getStorageSearch()
+	defer putStorageSearch(sr)
+	sr.Init(vmstorage.Storage, tfss, tr, maxMetricsPerSearch.Get(), deadline.deadline, deadline.stopCh)
+
+	// Start workers that call f in parallel on available CPU cores.
+	workCh := make(chan *exportWork, gomaxprocs*8)
+	var (
+		errGlobal     error
+		errGlobalLock sync.Mutex
+		mustStop      uint32
+	)
+	var wg sync.WaitGroup
+	wg.Add(gomaxprocs)
+	for i := 0; i < gomaxprocs; i++ {
+		go func() {
+			defer wg.Done()
+			for xw := range workCh {
+				if err := f(&xw.mn, &xw.b, tr); err != nil {
+					errGlobalLock.Lock()
+					if errGlobal == nil {
+						errGlobal = err
+						atomic.StoreUint32(&mustStop, 1)
+					}
+					errGlobalLock.Unlock()
+				}
+				putExportWork(xw)
+			}
+		}()
+	}
+
+	// Start prefetchers, which read the next blocks in background, so the export isn't bound by disk read latency.
+	var prefetchCh chan *exportWork
+	var prefetchWG sync.WaitGroup
+	if n := *exportPrefetchBlocks; n > 0 {
+		prefetchCh = make(chan *exportWork)
+		prefetchWG.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer prefetchWG.Done()
+				for xw := range prefetchCh {
+					xw.br.MustReadBlock(&xw.b, true)
+					releaseExportPrefetchBudget()
+					exportPrefetchedBlocks.Inc()
+					workCh <- xw
+				}
+			}()
+		}
+	}
+
+	// Feed workers with work
+	blocksRead := 0
+	for sr.NextMetricBlock() {
+		blocksRead++
+		if deadline.Exceeded() {
+			err = fmt.Errorf("%w while fetching data block #%d from storage: %s", deadline.Err(), blocksRead, deadline.String())
+			break
+		}
+		if atomic.LoadUint32(&mustStop) != 0 {
+			break
+		}
+		xw := getExportWork()
+		if err = xw.mn.Unmarshal(sr.MetricBlockRef.MetricName); err != nil {
+			putExportWork(xw)
+			err = fmt.Errorf("cannot unmarshal metricName for block #%d: %w", blocksRead, err)
+			break
+		}
+		if prefetchCh != nil && tryAcquireExportPrefetchBudget() {
+			// Copy the block reference, since sr.MetricBlockRef.BlockRef is overwritten on the next iteration.
+			xw.br = *sr.MetricBlockRef.BlockRef
+			prefetchCh <- xw
+			continue
+		}
+		sr.MetricBlockRef.BlockRef.MustReadBlock(&xw.b, true)
+		workCh <- xw
+	}
+	if prefetchCh != nil {
+		close(prefetchCh)
+		prefetchWG.Wait()
+	}
+	close(workCh)
+
+	// Wait for workers to finish.
+	wg.Wait()
+
+	// Check errors.
+	if err != nil {
+		return err
+	}
+	if err := sr.Error(); err != nil {
+		if errors.Is(err, storage.ErrDeadlineExceeded) || errors.Is(err, storage.ErrSearchCanceled) {
+			return fmt.Errorf("%w during the query: %s", deadline.Err(), deadline.String())
+		}
+		return fmt.Errorf("search error after reading %d data blocks: %w", blocksRead, err)
+	}
+	return errGlobal
+}
+
+type exportWork struct {
+	mn storage.MetricName
+	b  storage.Block
+
+	// br is set only for blocks read by prefetchers.
+	br storage.BlockRef
+}
+
+func (xw *exportWork) reset() {
+	xw.mn.Reset()
+	xw.b.Reset()
+	xw.br = storage.BlockRef{}
+}
+
+// tryAcquireExportPrefetchBudget returns true if one more block may be read ahead according to -search.maxExportPrefetchBlocks.
+//
+// releaseExportPrefetchBudget must be called after the block is read if true is returned.
+func tryAcquireExportPrefetchBudget() bool {
+	select {
+	case getExportPrefetchBudgetCh() <- struct{}{}:
+		return true
+	default:
+		exportPrefetchBudgetExhausted.Inc()
+		return false
+	}
+}
+
+func releaseExportPrefetchBudget() {
+	<-getExportPrefetchBudgetCh()
+}
+
+func getExportPrefetchBudgetCh() chan struct{} {
+	exportPrefetchBudgetChOnce.Do(func() {
+		exportPrefetchBudgetCh = make(chan struct{}, *maxExportPrefetchBlocks)
+	})
+	return exportPrefetchBudgetCh
+}
+
+var (
+	exportPrefetchBudgetCh     chan struct{}
+	exportPrefetchBudgetChOnce sync.Once
+)
+
+var (
+	exportPrefetchedBlocks        = metrics.NewCounter(`vm_export_prefetched_blocks_total`)
+	exportPrefetchBudgetExhausted = metrics.NewCounter(`vm_export_prefetch_budget_exhausted_total`)
+)
+
+func getExportWork() *exportWork {
+	v := exportWorkPool.Get()
+	if v == nil {
+		return &exportWork{}
+	}
+	return v.(*exportWork)
+}
+
+func putExportWork(xw *exportWork) {
+	xw.reset()
+	exportWorkPool.Put(xw)
+}
+
+var exportWorkPool sync.Pool
+
 func setupTfss(tagFilterss [][]storage.TagFilter) ([]*storage.TagFilters, error) {
 	tfss := make([]*storage.TagFilters, 0, len(tagFilterss))
 	for _, tagFilters := range tagFilterss {
@@ -657,10 +1230,40 @@ func setupTfss(tagFilterss [][]storage.TagFilter) ([]*storage.TagFilters, error)
 	return tfss, nil
 }
 
+// ErrTimeout is returned when the query exceeds its deadline.
+var ErrTimeout = errors.New("timeout exceeded")
+
+// ErrCanceled is returned when the query is canceled via stopCh passed to Deadline.WithStopCh.
+var ErrCanceled = errors.New("query canceled")
+
+// LimitExceededError is returned when the query exceeds one of -search.max* limits.
+type LimitExceededError struct {
+	Err error
+}
+
+// Error implements error interface.
+func (e *LimitExceededError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *LimitExceededError) Unwrap() error {
+	return e.Err
+}
+
+// IsLimitExceededError returns true if err is caused by exceeding one of -search.max* limits.
+func IsLimitExceededError(err error) bool {
+	var lee *LimitExceededError
+	return errors.As(err, &lee) || storage.IsLimitExceededError(err)
+}
+
 // Deadline contains deadline with the corresponding timeout for pretty error messages.
 type Deadline struct {
 	deadline uint64
 
+	// stopCh is closed when the query must be canceled. It may be nil.
+	stopCh <-chan struct{}
+
 	timeout  time.Duration
 	flagHint string
 }
@@ -677,12 +1280,42 @@ func NewDeadline(startTime time.Time, timeout time.Duration, flagHint string) De
 	}
 }
 
-// Exceeded returns true if deadline is exceeded.
+// WithStopCh returns a copy of d, which is additionally exceeded when stopCh is closed.
+//
+// This allows freeing resources occupied by the query when the client closes the connection.
+func (d Deadline) WithStopCh(stopCh <-chan struct{}) Deadline {
+	d.stopCh = stopCh
+	return d
+}
+
+// Exceeded returns true if deadline is exceeded or the query is canceled.
 func (d *Deadline) Exceeded() bool {
-	return fasttime.UnixTimestamp() > d.deadline
+	return fasttime.UnixTimestamp() > d.deadline || d.canceled()
+}
+
+func (d *Deadline) canceled() bool {
+	select {
+	case <-d.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Err returns ErrCanceled if the query is canceled. Otherwise it returns ErrTimeout.
+//
+// Err must be called only if Exceeded returns true.
+func (d *Deadline) Err() error {
+	if d.canceled() {
+		return ErrCanceled
+	}
+	return ErrTimeout
 }
 
 // String returns human-readable string representation for d.
 func (d *Deadline) String() string {
+	if d.canceled() {
+		return "the client has closed the connection"
+	}
 	return fmt.Sprintf("%.3f seconds; the timeout can be adjusted with `%s` command-line flag", d.timeout.Seconds(), d.flagHint)
 }
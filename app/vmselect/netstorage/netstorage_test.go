@@ -0,0 +1,208 @@
+package netstorage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// testReplicaSeries is a series with labels sorted by name.
+type testReplicaSeries struct {
+	labels     []string
+	timestamps []int64
+}
+
+// mergeReplicaSeries merges series in the same way as ProcessSearchQuery and Results.RunParallel do.
+//
+// It returns timestamps per each merged series.
+func mergeReplicaSeries(t *testing.T, series []testReplicaSeries) map[string][]int64 {
+	t.Helper()
+	var rd replicaDeduper
+	m := make(map[string]sortBlocksHeap)
+	var mn storage.MetricName
+	for _, s := range series {
+		mn.Reset()
+		mn.MetricGroup = append(mn.MetricGroup[:0], "up"...)
+		for i := 0; i < len(s.labels); i += 2 {
+			mn.AddTag(s.labels[i], s.labels[i+1])
+		}
+		metricName, err := rd.dedupMetricName(mn.Marshal(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		sb := &sortBlock{
+			Timestamps: s.timestamps,
+			Values:     make([]float64, len(s.timestamps)),
+		}
+		m[string(metricName)] = append(m[string(metricName)], sb)
+	}
+	result := make(map[string][]int64)
+	for metricName, sbh := range m {
+		if err := mn.Unmarshal([]byte(metricName)); err != nil {
+			t.Fatalf("cannot unmarshal metric name: %s", err)
+		}
+		var r Result
+		mergeSortBlocks(&r, sbh)
+		result[mn.String()] = r.Timestamps
+	}
+	return result
+}
+
+func TestReplicaDedup(t *testing.T) {
+	defer func() {
+		*replicaLabels = nil
+		storage.SetMinScrapeIntervalForDeduplication(0)
+	}()
+	f := func(labels []string, dedupInterval time.Duration, series []testReplicaSeries, resultExpected map[string][]int64) {
+		t.Helper()
+		*replicaLabels = flagutil.Array(labels)
+		storage.SetMinScrapeIntervalForDeduplication(dedupInterval)
+		result := mergeReplicaSeries(t, series)
+		if !reflect.DeepEqual(result, resultExpected) {
+			var keys []string
+			for k := range result {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			t.Fatalf("unexpected result for series with keys %q\ngot\n%v\nwant\n%v", keys, result, resultExpected)
+		}
+	}
+
+	// Replica labels aren't set - series from replicas are returned as is.
+	f(nil, 10*time.Second, []testReplicaSeries{
+		{[]string{"replica", "r1"}, []int64{0, 10e3, 20e3}},
+		{[]string{"replica", "r2"}, []int64{5e3, 15e3, 25e3}},
+	}, map[string][]int64{
+		`MetricGroup="up", tags=["replica"="r1"]`: {0, 10e3, 20e3},
+		`MetricGroup="up", tags=["replica"="r2"]`: {5e3, 15e3, 25e3},
+	})
+
+	// Samples from both replicas are returned without de-duplication.
+	f([]string{"replica"}, 0, []testReplicaSeries{
+		{[]string{"replica", "r1"}, []int64{0, 10e3, 20e3}},
+		{[]string{"replica", "r2"}, []int64{5e3, 15e3, 25e3}},
+	}, map[string][]int64{
+		`MetricGroup="up", tags=[]`: {0, 5e3, 10e3, 15e3, 20e3, 25e3},
+	})
+
+	// A single sample per de-duplication interval is selected among replicas.
+	f([]string{"replica"}, 10*time.Second, []testReplicaSeries{
+		{[]string{"replica", "r1"}, []int64{1e3, 11e3, 21e3}},
+		{[]string{"replica", "r2"}, []int64{3e3, 13e3, 23e3}},
+	}, map[string][]int64{
+		`MetricGroup="up", tags=[]`: {1e3, 11e3, 21e3},
+	})
+
+	// The sample from the other replica is selected if it is scraped earlier in the interval.
+	f([]string{"replica"}, 10*time.Second, []testReplicaSeries{
+		{[]string{"replica", "r1"}, []int64{1e3, 14e3, 21e3}},
+		{[]string{"replica", "r2"}, []int64{3e3, 13e3, 23e3}},
+	}, map[string][]int64{
+		`MetricGroup="up", tags=[]`: {1e3, 13e3, 21e3},
+	})
+
+	// Failover - r1 stops at 21s, while r2 continues, so there are no gaps.
+	f([]string{"replica"}, 10*time.Second, []testReplicaSeries{
+		{[]string{"replica", "r1"}, []int64{1e3, 11e3, 21e3}},
+		{[]string{"replica", "r2"}, []int64{3e3, 13e3, 23e3, 33e3, 43e3}},
+	}, map[string][]int64{
+		`MetricGroup="up", tags=[]`: {1e3, 11e3, 21e3, 33e3, 43e3},
+	})
+
+	// Failback - r2 is down in the middle, while r1 is back after restart.
+	f([]string{"replica"}, 10*time.Second, []testReplicaSeries{
+		{[]string{"replica", "r1"}, []int64{1e3, 11e3, 41e3, 51e3}},
+		{[]string{"replica", "r2"}, []int64{3e3, 13e3, 23e3, 33e3}},
+	}, map[string][]int64{
+		`MetricGroup="up", tags=[]`: {1e3, 11e3, 23e3, 33e3, 41e3, 51e3},
+	})
+
+	// Series with distinct non-replica labels aren't merged.
+	f([]string{"replica"}, 10*time.Second, []testReplicaSeries{
+		{[]string{"job", "a", "replica", "r1"}, []int64{1e3, 11e3}},
+		{[]string{"job", "a", "replica", "r2"}, []int64{3e3, 13e3}},
+		{[]string{"job", "b", "replica", "r2"}, []int64{3e3, 13e3}},
+	}, map[string][]int64{
+		`MetricGroup="up", tags=["job"="a"]`: {1e3, 11e3},
+		`MetricGroup="up", tags=["job"="b"]`: {3e3, 13e3},
+	})
+
+	// Multiple replica labels.
+	f([]string{"replica", "dc"}, 10*time.Second, []testReplicaSeries{
+		{[]string{"dc", "east", "job", "a", "replica", "r1"}, []int64{1e3, 11e3}},
+		{[]string{"dc", "west", "job", "a", "replica", "r2"}, []int64{3e3, 13e3, 23e3}},
+	}, map[string][]int64{
+		`MetricGroup="up", tags=["job"="a"]`: {1e3, 11e3, 23e3},
+	})
+}
+
+func TestCheckSamplesLimits(t *testing.T) {
+	defer func() {
+		if err := maxSamplesPerSeries.Set("0"); err != nil {
+			t.Fatalf("cannot reset -search.maxSamplesPerSeries: %s", err)
+		}
+		if err := maxSamplesPerQuery.Set("0"); err != nil {
+			t.Fatalf("cannot reset -search.maxSamplesPerQuery: %s", err)
+		}
+	}()
+	f := func(seriesLimit, queryLimit int, seriesSamples, querySamples uint64, isErrorExpected bool) {
+		t.Helper()
+		if err := maxSamplesPerSeries.Set(fmt.Sprintf("%d", seriesLimit)); err != nil {
+			t.Fatalf("cannot set -search.maxSamplesPerSeries: %s", err)
+		}
+		if err := maxSamplesPerQuery.Set(fmt.Sprintf("%d", queryLimit)); err != nil {
+			t.Fatalf("cannot set -search.maxSamplesPerQuery: %s", err)
+		}
+		limitExceededPrev := samplesLimitExceeded.Get()
+		err := checkSamplesLimits(seriesSamples, querySamples)
+		limitExceeded := samplesLimitExceeded.Get() - limitExceededPrev
+		if !isErrorExpected {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if limitExceeded != 0 {
+				t.Fatalf("unexpected vm_search_samples_limit_exceeded_total increase; got %d; want 0", limitExceeded)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		var e *LimitExceededError
+		if !errors.As(err, &e) {
+			t.Fatalf("expecting LimitExceededError; got %T: %s", err, err)
+		}
+		if limitExceeded != 1 {
+			t.Fatalf("unexpected vm_search_samples_limit_exceeded_total increase; got %d; want 1", limitExceeded)
+		}
+	}
+
+	// Limits are disabled
+	f(0, 0, 0, 0, false)
+	f(0, 0, 1<<40, 1<<50, false)
+
+	// The limit per series
+	f(100, 0, 99, 1<<50, false)
+	f(100, 0, 100, 1<<50, false)
+	f(100, 0, 101, 1<<50, true)
+
+	// The limit per query
+	f(0, 1000, 1<<40, 999, false)
+	f(0, 1000, 1<<40, 1000, false)
+	f(0, 1000, 1<<40, 1001, true)
+
+	// Both limits
+	f(100, 1000, 100, 1000, false)
+	f(100, 1000, 101, 1000, true)
+	f(100, 1000, 100, 1001, true)
+	f(100, 1000, 101, 1001, true)
+
+	// Negative limits are ignored
+	f(-1, -1, 1<<40, 1<<50, false)
+}
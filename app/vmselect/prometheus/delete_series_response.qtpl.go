@@ -0,0 +1,74 @@
+// Code generated by qtc from "delete_series_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vmselect/prometheus/delete_series_response.qtpl:1
+package prometheus
+
+//line app/vmselect/prometheus/delete_series_response.qtpl:1
+import "github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+
+// DeleteSeriesDryRunResponse generates response for /api/v1/admin/tsdb/delete_series?dry_run=1 .
+
+//line app/vmselect/prometheus/delete_series_response.qtpl:5
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vmselect/prometheus/delete_series_response.qtpl:5
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vmselect/prometheus/delete_series_response.qtpl:5
+func StreamDeleteSeriesDryRunResponse(qw422016 *qt422016.Writer, seriesCount int, mns []storage.MetricName) {
+//line app/vmselect/prometheus/delete_series_response.qtpl:5
+	qw422016.N().S(`{"status":"success","data":{"seriesCount":`)
+//line app/vmselect/prometheus/delete_series_response.qtpl:9
+	qw422016.N().D(seriesCount)
+//line app/vmselect/prometheus/delete_series_response.qtpl:9
+	qw422016.N().S(`,"sample":[`)
+//line app/vmselect/prometheus/delete_series_response.qtpl:11
+	for i := range mns {
+//line app/vmselect/prometheus/delete_series_response.qtpl:12
+		streammetricNameObject(qw422016, &mns[i])
+//line app/vmselect/prometheus/delete_series_response.qtpl:13
+		if i+1 < len(mns) {
+//line app/vmselect/prometheus/delete_series_response.qtpl:13
+			qw422016.N().S(`,`)
+//line app/vmselect/prometheus/delete_series_response.qtpl:13
+		}
+//line app/vmselect/prometheus/delete_series_response.qtpl:14
+	}
+//line app/vmselect/prometheus/delete_series_response.qtpl:14
+	qw422016.N().S(`]}}`)
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+}
+
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+func WriteDeleteSeriesDryRunResponse(qq422016 qtio422016.Writer, seriesCount int, mns []storage.MetricName) {
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+	StreamDeleteSeriesDryRunResponse(qw422016, seriesCount, mns)
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+}
+
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+func DeleteSeriesDryRunResponse(seriesCount int, mns []storage.MetricName) string {
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+	WriteDeleteSeriesDryRunResponse(qb422016, seriesCount, mns)
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+	return qs422016
+//line app/vmselect/prometheus/delete_series_response.qtpl:18
+}
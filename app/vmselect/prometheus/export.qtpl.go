@@ -87,299 +87,518 @@ func ExportPrometheusLine(rs *netstorage.Result) string {
 //line app/vmselect/prometheus/export.qtpl:19
 }
 
-//line app/vmselect/prometheus/export.qtpl:21
+// ExportOpenMetricsLine writes rs in OpenMetrics text format.// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md
+
+//line app/vmselect/prometheus/export.qtpl:23
+func StreamExportOpenMetricsLine(qw422016 *qt422016.Writer, rs *netstorage.Result) {
+//line app/vmselect/prometheus/export.qtpl:24
+	if len(rs.Timestamps) == 0 || !isValidOpenMetricsMetricName(&rs.MetricName) {
+//line app/vmselect/prometheus/export.qtpl:24
+		return
+//line app/vmselect/prometheus/export.qtpl:24
+	}
+//line app/vmselect/prometheus/export.qtpl:25
+	bb := quicktemplate.AcquireByteBuffer()
+
+//line app/vmselect/prometheus/export.qtpl:26
+	writeopenMetricsMetricName(bb, &rs.MetricName)
+
+//line app/vmselect/prometheus/export.qtpl:27
+	for i, ts := range rs.Timestamps {
+//line app/vmselect/prometheus/export.qtpl:28
+		qw422016.N().Z(bb.B)
+//line app/vmselect/prometheus/export.qtpl:28
+		qw422016.N().S(` `)
+//line app/vmselect/prometheus/export.qtpl:29
+		qw422016.N().F(rs.Values[i])
+//line app/vmselect/prometheus/export.qtpl:29
+		qw422016.N().S(` `)
+//line app/vmselect/prometheus/export.qtpl:30
+		streamopenMetricsTimestamp(qw422016, ts)
+//line app/vmselect/prometheus/export.qtpl:30
+		qw422016.N().S(`
+`)
+//line app/vmselect/prometheus/export.qtpl:31
+	}
+//line app/vmselect/prometheus/export.qtpl:32
+	quicktemplate.ReleaseByteBuffer(bb)
+
+//line app/vmselect/prometheus/export.qtpl:33
+}
+
+//line app/vmselect/prometheus/export.qtpl:33
+func WriteExportOpenMetricsLine(qq422016 qtio422016.Writer, rs *netstorage.Result) {
+//line app/vmselect/prometheus/export.qtpl:33
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/export.qtpl:33
+	StreamExportOpenMetricsLine(qw422016, rs)
+//line app/vmselect/prometheus/export.qtpl:33
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/export.qtpl:33
+}
+
+//line app/vmselect/prometheus/export.qtpl:33
+func ExportOpenMetricsLine(rs *netstorage.Result) string {
+//line app/vmselect/prometheus/export.qtpl:33
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/export.qtpl:33
+	WriteExportOpenMetricsLine(qb422016, rs)
+//line app/vmselect/prometheus/export.qtpl:33
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/export.qtpl:33
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/export.qtpl:33
+	return qs422016
+//line app/vmselect/prometheus/export.qtpl:33
+}
+
+// ExportOpenMetricsResponse writes lines from resultsCh in OpenMetrics text format.// Lines in resultsCh must be grouped by metric family. They are followed by `# EOF` line as OpenMetrics requires.
+
+//line app/vmselect/prometheus/export.qtpl:37
+func StreamExportOpenMetricsResponse(qw422016 *qt422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
+//line app/vmselect/prometheus/export.qtpl:38
+	for bb := range resultsCh {
+//line app/vmselect/prometheus/export.qtpl:39
+		qw422016.N().Z(bb.B)
+//line app/vmselect/prometheus/export.qtpl:40
+		quicktemplate.ReleaseByteBuffer(bb)
+
+//line app/vmselect/prometheus/export.qtpl:41
+	}
+//line app/vmselect/prometheus/export.qtpl:41
+	qw422016.N().S(`# EOF`)
+//line app/vmselect/prometheus/export.qtpl:42
+	qw422016.N().S(`
+`)
+//line app/vmselect/prometheus/export.qtpl:43
+}
+
+//line app/vmselect/prometheus/export.qtpl:43
+func WriteExportOpenMetricsResponse(qq422016 qtio422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
+//line app/vmselect/prometheus/export.qtpl:43
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/export.qtpl:43
+	StreamExportOpenMetricsResponse(qw422016, resultsCh)
+//line app/vmselect/prometheus/export.qtpl:43
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/export.qtpl:43
+}
+
+//line app/vmselect/prometheus/export.qtpl:43
+func ExportOpenMetricsResponse(resultsCh <-chan *quicktemplate.ByteBuffer) string {
+//line app/vmselect/prometheus/export.qtpl:43
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/export.qtpl:43
+	WriteExportOpenMetricsResponse(qb422016, resultsCh)
+//line app/vmselect/prometheus/export.qtpl:43
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/export.qtpl:43
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/export.qtpl:43
+	return qs422016
+//line app/vmselect/prometheus/export.qtpl:43
+}
+
+//line app/vmselect/prometheus/export.qtpl:45
 func StreamExportJSONLine(qw422016 *qt422016.Writer, rs *netstorage.Result) {
-//line app/vmselect/prometheus/export.qtpl:22
+//line app/vmselect/prometheus/export.qtpl:46
 	if len(rs.Timestamps) == 0 {
-//line app/vmselect/prometheus/export.qtpl:22
+//line app/vmselect/prometheus/export.qtpl:46
 		return
-//line app/vmselect/prometheus/export.qtpl:22
+//line app/vmselect/prometheus/export.qtpl:46
 	}
-//line app/vmselect/prometheus/export.qtpl:22
+//line app/vmselect/prometheus/export.qtpl:46
 	qw422016.N().S(`{"metric":`)
-//line app/vmselect/prometheus/export.qtpl:24
+//line app/vmselect/prometheus/export.qtpl:48
 	streammetricNameObject(qw422016, &rs.MetricName)
-//line app/vmselect/prometheus/export.qtpl:24
+//line app/vmselect/prometheus/export.qtpl:48
 	qw422016.N().S(`,"values":[`)
-//line app/vmselect/prometheus/export.qtpl:26
+//line app/vmselect/prometheus/export.qtpl:50
 	if len(rs.Values) > 0 {
-//line app/vmselect/prometheus/export.qtpl:27
+//line app/vmselect/prometheus/export.qtpl:51
 		values := rs.Values
 
-//line app/vmselect/prometheus/export.qtpl:28
+//line app/vmselect/prometheus/export.qtpl:52
 		qw422016.N().F(values[0])
-//line app/vmselect/prometheus/export.qtpl:29
+//line app/vmselect/prometheus/export.qtpl:53
 		values = values[1:]
 
-//line app/vmselect/prometheus/export.qtpl:30
+//line app/vmselect/prometheus/export.qtpl:54
 		for _, v := range values {
-//line app/vmselect/prometheus/export.qtpl:30
+//line app/vmselect/prometheus/export.qtpl:54
 			qw422016.N().S(`,`)
-//line app/vmselect/prometheus/export.qtpl:31
+//line app/vmselect/prometheus/export.qtpl:55
 			qw422016.N().F(v)
-//line app/vmselect/prometheus/export.qtpl:32
+//line app/vmselect/prometheus/export.qtpl:56
 		}
-//line app/vmselect/prometheus/export.qtpl:33
+//line app/vmselect/prometheus/export.qtpl:57
 	}
-//line app/vmselect/prometheus/export.qtpl:33
+//line app/vmselect/prometheus/export.qtpl:57
 	qw422016.N().S(`],"timestamps":[`)
-//line app/vmselect/prometheus/export.qtpl:36
+//line app/vmselect/prometheus/export.qtpl:60
 	if len(rs.Timestamps) > 0 {
-//line app/vmselect/prometheus/export.qtpl:37
+//line app/vmselect/prometheus/export.qtpl:61
 		timestamps := rs.Timestamps
 
-//line app/vmselect/prometheus/export.qtpl:38
+//line app/vmselect/prometheus/export.qtpl:62
 		qw422016.N().DL(timestamps[0])
-//line app/vmselect/prometheus/export.qtpl:39
+//line app/vmselect/prometheus/export.qtpl:63
 		timestamps = timestamps[1:]
 
-//line app/vmselect/prometheus/export.qtpl:40
+//line app/vmselect/prometheus/export.qtpl:64
 		for _, ts := range timestamps {
-//line app/vmselect/prometheus/export.qtpl:40
+//line app/vmselect/prometheus/export.qtpl:64
 			qw422016.N().S(`,`)
-//line app/vmselect/prometheus/export.qtpl:41
+//line app/vmselect/prometheus/export.qtpl:65
 			qw422016.N().DL(ts)
-//line app/vmselect/prometheus/export.qtpl:42
+//line app/vmselect/prometheus/export.qtpl:66
 		}
-//line app/vmselect/prometheus/export.qtpl:43
+//line app/vmselect/prometheus/export.qtpl:67
 	}
-//line app/vmselect/prometheus/export.qtpl:43
+//line app/vmselect/prometheus/export.qtpl:67
 	qw422016.N().S(`]}`)
-//line app/vmselect/prometheus/export.qtpl:45
+//line app/vmselect/prometheus/export.qtpl:69
 	qw422016.N().S(`
 `)
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 }
 
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 func WriteExportJSONLine(qq422016 qtio422016.Writer, rs *netstorage.Result) {
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 	StreamExportJSONLine(qw422016, rs)
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 }
 
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 func ExportJSONLine(rs *netstorage.Result) string {
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 	WriteExportJSONLine(qb422016, rs)
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 	return qs422016
-//line app/vmselect/prometheus/export.qtpl:46
+//line app/vmselect/prometheus/export.qtpl:70
 }
 
-//line app/vmselect/prometheus/export.qtpl:48
+//line app/vmselect/prometheus/export.qtpl:72
 func StreamExportPromAPILine(qw422016 *qt422016.Writer, rs *netstorage.Result) {
-//line app/vmselect/prometheus/export.qtpl:48
+//line app/vmselect/prometheus/export.qtpl:72
 	qw422016.N().S(`{"metric":`)
-//line app/vmselect/prometheus/export.qtpl:50
+//line app/vmselect/prometheus/export.qtpl:74
 	streammetricNameObject(qw422016, &rs.MetricName)
-//line app/vmselect/prometheus/export.qtpl:50
+//line app/vmselect/prometheus/export.qtpl:74
 	qw422016.N().S(`,"values":`)
-//line app/vmselect/prometheus/export.qtpl:51
+//line app/vmselect/prometheus/export.qtpl:75
 	streamvaluesWithTimestamps(qw422016, rs.Values, rs.Timestamps)
-//line app/vmselect/prometheus/export.qtpl:51
+//line app/vmselect/prometheus/export.qtpl:75
 	qw422016.N().S(`}`)
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 }
 
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 func WriteExportPromAPILine(qq422016 qtio422016.Writer, rs *netstorage.Result) {
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 	StreamExportPromAPILine(qw422016, rs)
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 }
 
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 func ExportPromAPILine(rs *netstorage.Result) string {
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 	WriteExportPromAPILine(qb422016, rs)
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 	return qs422016
-//line app/vmselect/prometheus/export.qtpl:53
+//line app/vmselect/prometheus/export.qtpl:77
 }
 
-//line app/vmselect/prometheus/export.qtpl:55
+//line app/vmselect/prometheus/export.qtpl:79
 func StreamExportPromAPIResponse(qw422016 *qt422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
-//line app/vmselect/prometheus/export.qtpl:55
+//line app/vmselect/prometheus/export.qtpl:79
 	qw422016.N().S(`{"status":"success","data":{"resultType":"matrix","result":[`)
-//line app/vmselect/prometheus/export.qtpl:61
+//line app/vmselect/prometheus/export.qtpl:85
 	bb, ok := <-resultsCh
 
-//line app/vmselect/prometheus/export.qtpl:62
+//line app/vmselect/prometheus/export.qtpl:86
 	if ok {
-//line app/vmselect/prometheus/export.qtpl:63
+//line app/vmselect/prometheus/export.qtpl:87
 		qw422016.N().Z(bb.B)
-//line app/vmselect/prometheus/export.qtpl:64
+//line app/vmselect/prometheus/export.qtpl:88
 		quicktemplate.ReleaseByteBuffer(bb)
 
-//line app/vmselect/prometheus/export.qtpl:65
+//line app/vmselect/prometheus/export.qtpl:89
 		for bb := range resultsCh {
-//line app/vmselect/prometheus/export.qtpl:65
+//line app/vmselect/prometheus/export.qtpl:89
 			qw422016.N().S(`,`)
-//line app/vmselect/prometheus/export.qtpl:66
+//line app/vmselect/prometheus/export.qtpl:90
 			qw422016.N().Z(bb.B)
-//line app/vmselect/prometheus/export.qtpl:67
+//line app/vmselect/prometheus/export.qtpl:91
 			quicktemplate.ReleaseByteBuffer(bb)
 
-//line app/vmselect/prometheus/export.qtpl:68
+//line app/vmselect/prometheus/export.qtpl:92
 		}
-//line app/vmselect/prometheus/export.qtpl:69
+//line app/vmselect/prometheus/export.qtpl:93
 	}
-//line app/vmselect/prometheus/export.qtpl:69
+//line app/vmselect/prometheus/export.qtpl:93
 	qw422016.N().S(`]}}`)
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 }
 
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 func WriteExportPromAPIResponse(qq422016 qtio422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 	StreamExportPromAPIResponse(qw422016, resultsCh)
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 }
 
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 func ExportPromAPIResponse(resultsCh <-chan *quicktemplate.ByteBuffer) string {
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 	WriteExportPromAPIResponse(qb422016, resultsCh)
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 	return qs422016
-//line app/vmselect/prometheus/export.qtpl:73
+//line app/vmselect/prometheus/export.qtpl:97
 }
 
-//line app/vmselect/prometheus/export.qtpl:75
+//line app/vmselect/prometheus/export.qtpl:99
 func StreamExportStdResponse(qw422016 *qt422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
-//line app/vmselect/prometheus/export.qtpl:76
+//line app/vmselect/prometheus/export.qtpl:100
 	for bb := range resultsCh {
-//line app/vmselect/prometheus/export.qtpl:77
+//line app/vmselect/prometheus/export.qtpl:101
 		qw422016.N().Z(bb.B)
-//line app/vmselect/prometheus/export.qtpl:78
+//line app/vmselect/prometheus/export.qtpl:102
 		quicktemplate.ReleaseByteBuffer(bb)
 
-//line app/vmselect/prometheus/export.qtpl:79
+//line app/vmselect/prometheus/export.qtpl:103
 	}
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 }
 
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 func WriteExportStdResponse(qq422016 qtio422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 	StreamExportStdResponse(qw422016, resultsCh)
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 }
 
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 func ExportStdResponse(resultsCh <-chan *quicktemplate.ByteBuffer) string {
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 	WriteExportStdResponse(qb422016, resultsCh)
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 	return qs422016
-//line app/vmselect/prometheus/export.qtpl:80
+//line app/vmselect/prometheus/export.qtpl:104
 }
 
-//line app/vmselect/prometheus/export.qtpl:82
+//line app/vmselect/prometheus/export.qtpl:106
 func streamprometheusMetricName(qw422016 *qt422016.Writer, mn *storage.MetricName) {
-//line app/vmselect/prometheus/export.qtpl:83
+//line app/vmselect/prometheus/export.qtpl:107
 	qw422016.N().Z(mn.MetricGroup)
-//line app/vmselect/prometheus/export.qtpl:84
+//line app/vmselect/prometheus/export.qtpl:108
 	if len(mn.Tags) > 0 {
-//line app/vmselect/prometheus/export.qtpl:84
+//line app/vmselect/prometheus/export.qtpl:108
 		qw422016.N().S(`{`)
-//line app/vmselect/prometheus/export.qtpl:86
+//line app/vmselect/prometheus/export.qtpl:110
 		tags := mn.Tags
 
-//line app/vmselect/prometheus/export.qtpl:87
+//line app/vmselect/prometheus/export.qtpl:111
 		qw422016.N().Z(tags[0].Key)
-//line app/vmselect/prometheus/export.qtpl:87
+//line app/vmselect/prometheus/export.qtpl:111
 		qw422016.N().S(`=`)
-//line app/vmselect/prometheus/export.qtpl:87
+//line app/vmselect/prometheus/export.qtpl:111
 		qw422016.N().QZ(tags[0].Value)
-//line app/vmselect/prometheus/export.qtpl:88
+//line app/vmselect/prometheus/export.qtpl:112
 		tags = tags[1:]
 
-//line app/vmselect/prometheus/export.qtpl:89
+//line app/vmselect/prometheus/export.qtpl:113
 		for i := range tags {
-//line app/vmselect/prometheus/export.qtpl:90
+//line app/vmselect/prometheus/export.qtpl:114
 			tag := &tags[i]
 
-//line app/vmselect/prometheus/export.qtpl:90
+//line app/vmselect/prometheus/export.qtpl:114
 			qw422016.N().S(`,`)
-//line app/vmselect/prometheus/export.qtpl:91
+//line app/vmselect/prometheus/export.qtpl:115
 			qw422016.N().Z(tag.Key)
-//line app/vmselect/prometheus/export.qtpl:91
+//line app/vmselect/prometheus/export.qtpl:115
 			qw422016.N().S(`=`)
-//line app/vmselect/prometheus/export.qtpl:91
+//line app/vmselect/prometheus/export.qtpl:115
 			qw422016.N().QZ(tag.Value)
-//line app/vmselect/prometheus/export.qtpl:92
+//line app/vmselect/prometheus/export.qtpl:116
 		}
-//line app/vmselect/prometheus/export.qtpl:92
+//line app/vmselect/prometheus/export.qtpl:116
 		qw422016.N().S(`}`)
-//line app/vmselect/prometheus/export.qtpl:94
+//line app/vmselect/prometheus/export.qtpl:118
 	}
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 }
 
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 func writeprometheusMetricName(qq422016 qtio422016.Writer, mn *storage.MetricName) {
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 	streamprometheusMetricName(qw422016, mn)
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 }
 
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 func prometheusMetricName(mn *storage.MetricName) string {
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
 	writeprometheusMetricName(qb422016, mn)
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:119
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/export.qtpl:119
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/export.qtpl:119
+	return qs422016
+//line app/vmselect/prometheus/export.qtpl:119
+}
+
+//line app/vmselect/prometheus/export.qtpl:121
+func streamopenMetricsMetricName(qw422016 *qt422016.Writer, mn *storage.MetricName) {
+//line app/vmselect/prometheus/export.qtpl:122
+	qw422016.N().Z(mn.MetricGroup)
+//line app/vmselect/prometheus/export.qtpl:123
+	if len(mn.Tags) > 0 {
+//line app/vmselect/prometheus/export.qtpl:123
+		qw422016.N().S(`{`)
+//line app/vmselect/prometheus/export.qtpl:125
+		tags := mn.Tags
+
+//line app/vmselect/prometheus/export.qtpl:126
+		qw422016.N().Z(tags[0].Key)
+//line app/vmselect/prometheus/export.qtpl:126
+		qw422016.N().S(`="`)
+//line app/vmselect/prometheus/export.qtpl:126
+		qw422016.N().Z(escapeOpenMetricsLabelValue(tags[0].Value))
+//line app/vmselect/prometheus/export.qtpl:126
+		qw422016.N().S(`"`)
+//line app/vmselect/prometheus/export.qtpl:127
+		tags = tags[1:]
+
+//line app/vmselect/prometheus/export.qtpl:128
+		for i := range tags {
+//line app/vmselect/prometheus/export.qtpl:129
+			tag := &tags[i]
+
+//line app/vmselect/prometheus/export.qtpl:129
+			qw422016.N().S(`,`)
+//line app/vmselect/prometheus/export.qtpl:130
+			qw422016.N().Z(tag.Key)
+//line app/vmselect/prometheus/export.qtpl:130
+			qw422016.N().S(`="`)
+//line app/vmselect/prometheus/export.qtpl:130
+			qw422016.N().Z(escapeOpenMetricsLabelValue(tag.Value))
+//line app/vmselect/prometheus/export.qtpl:130
+			qw422016.N().S(`"`)
+//line app/vmselect/prometheus/export.qtpl:131
+		}
+//line app/vmselect/prometheus/export.qtpl:131
+		qw422016.N().S(`}`)
+//line app/vmselect/prometheus/export.qtpl:133
+	}
+//line app/vmselect/prometheus/export.qtpl:134
+}
+
+//line app/vmselect/prometheus/export.qtpl:134
+func writeopenMetricsMetricName(qq422016 qtio422016.Writer, mn *storage.MetricName) {
+//line app/vmselect/prometheus/export.qtpl:134
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/export.qtpl:134
+	streamopenMetricsMetricName(qw422016, mn)
+//line app/vmselect/prometheus/export.qtpl:134
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/export.qtpl:134
+}
+
+//line app/vmselect/prometheus/export.qtpl:134
+func openMetricsMetricName(mn *storage.MetricName) string {
+//line app/vmselect/prometheus/export.qtpl:134
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/export.qtpl:134
+	writeopenMetricsMetricName(qb422016, mn)
+//line app/vmselect/prometheus/export.qtpl:134
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/export.qtpl:134
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/export.qtpl:134
+	return qs422016
+//line app/vmselect/prometheus/export.qtpl:134
+}
+
+// openMetricsTimestamp writes timestamp in milliseconds as seconds, since OpenMetrics timestamps are in seconds.
+
+//line app/vmselect/prometheus/export.qtpl:137
+func streamopenMetricsTimestamp(qw422016 *qt422016.Writer, timestamp int64) {
+//line app/vmselect/prometheus/export.qtpl:138
+	qw422016.N().F(float64(timestamp) / 1e3)
+//line app/vmselect/prometheus/export.qtpl:139
+}
+
+//line app/vmselect/prometheus/export.qtpl:139
+func writeopenMetricsTimestamp(qq422016 qtio422016.Writer, timestamp int64) {
+//line app/vmselect/prometheus/export.qtpl:139
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/export.qtpl:139
+	streamopenMetricsTimestamp(qw422016, timestamp)
+//line app/vmselect/prometheus/export.qtpl:139
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/export.qtpl:139
+}
+
+//line app/vmselect/prometheus/export.qtpl:139
+func openMetricsTimestamp(timestamp int64) string {
+//line app/vmselect/prometheus/export.qtpl:139
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/export.qtpl:139
+	writeopenMetricsTimestamp(qb422016, timestamp)
+//line app/vmselect/prometheus/export.qtpl:139
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:139
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:139
 	return qs422016
-//line app/vmselect/prometheus/export.qtpl:95
+//line app/vmselect/prometheus/export.qtpl:139
 }
@@ -73,3 +73,55 @@ func Federate(rs *netstorage.Result) string {
 	return qs422016
 //line app/vmselect/prometheus/federate.qtpl:14
 }
+
+// FederateOpenMetrics writes rs in /federate format for OpenMetrics text output.// The response must be written with ExportOpenMetricsResponse.
+
+//line app/vmselect/prometheus/federate.qtpl:18
+func StreamFederateOpenMetrics(qw422016 *qt422016.Writer, rs *netstorage.Result) {
+//line app/vmselect/prometheus/federate.qtpl:19
+	if len(rs.Timestamps) == 0 || len(rs.Values) == 0 || !isValidOpenMetricsMetricName(&rs.MetricName) {
+//line app/vmselect/prometheus/federate.qtpl:19
+		return
+//line app/vmselect/prometheus/federate.qtpl:19
+	}
+//line app/vmselect/prometheus/federate.qtpl:20
+	streamopenMetricsMetricName(qw422016, &rs.MetricName)
+//line app/vmselect/prometheus/federate.qtpl:20
+	qw422016.N().S(` `)
+//line app/vmselect/prometheus/federate.qtpl:21
+	qw422016.N().F(rs.Values[len(rs.Values)-1])
+//line app/vmselect/prometheus/federate.qtpl:21
+	qw422016.N().S(` `)
+//line app/vmselect/prometheus/federate.qtpl:22
+	streamopenMetricsTimestamp(qw422016, rs.Timestamps[len(rs.Timestamps)-1])
+//line app/vmselect/prometheus/federate.qtpl:22
+	qw422016.N().S(`
+`)
+//line app/vmselect/prometheus/federate.qtpl:23
+}
+
+//line app/vmselect/prometheus/federate.qtpl:23
+func WriteFederateOpenMetrics(qq422016 qtio422016.Writer, rs *netstorage.Result) {
+//line app/vmselect/prometheus/federate.qtpl:23
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/federate.qtpl:23
+	StreamFederateOpenMetrics(qw422016, rs)
+//line app/vmselect/prometheus/federate.qtpl:23
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/federate.qtpl:23
+}
+
+//line app/vmselect/prometheus/federate.qtpl:23
+func FederateOpenMetrics(rs *netstorage.Result) string {
+//line app/vmselect/prometheus/federate.qtpl:23
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/federate.qtpl:23
+	WriteFederateOpenMetrics(qb422016, rs)
+//line app/vmselect/prometheus/federate.qtpl:23
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/federate.qtpl:23
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/federate.qtpl:23
+	return qs422016
+//line app/vmselect/prometheus/federate.qtpl:23
+}
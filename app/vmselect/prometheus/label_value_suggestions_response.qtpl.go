@@ -0,0 +1,78 @@
+// Code generated by qtc from "label_value_suggestions_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:1
+package prometheus
+
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:1
+import "github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+
+// LabelValueSuggestionsResponse generates response for /api/v1/label/<labelName>/suggest .
+
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:5
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:5
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:5
+func StreamLabelValueSuggestionsResponse(qw422016 *qt422016.Writer, tvss []storage.TagValueSuggestion) {
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:5
+	qw422016.N().S(`{"status":"success","data":[`)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:9
+	for i, tvs := range tvss {
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:9
+		qw422016.N().S(`{"value":`)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:11
+		qw422016.N().Q(tvs.Value)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:11
+		qw422016.N().S(`,"seriesCount":`)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:12
+		qw422016.N().DUL(tvs.SeriesCount)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:12
+		qw422016.N().S(`}`)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:14
+		if i+1 < len(tvss) {
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:14
+			qw422016.N().S(`,`)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:14
+		}
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:15
+	}
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:15
+	qw422016.N().S(`]}`)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+}
+
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+func WriteLabelValueSuggestionsResponse(qq422016 qtio422016.Writer, tvss []storage.TagValueSuggestion) {
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+	StreamLabelValueSuggestionsResponse(qw422016, tvss)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+}
+
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+func LabelValueSuggestionsResponse(tvss []storage.TagValueSuggestion) string {
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+	WriteLabelValueSuggestionsResponse(qb422016, tvss)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+	return qs422016
+//line app/vmselect/prometheus/label_value_suggestions_response.qtpl:18
+}
@@ -0,0 +1,104 @@
+// Code generated by qtc from "metric_usage_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vmselect/prometheus/metric_usage_response.qtpl:1
+package prometheus
+
+//line app/vmselect/prometheus/metric_usage_response.qtpl:1
+import "github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+
+// MetricUsageResponse generates response for /api/v1/status/metric_usage .
+
+//line app/vmselect/prometheus/metric_usage_response.qtpl:5
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vmselect/prometheus/metric_usage_response.qtpl:5
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vmselect/prometheus/metric_usage_response.qtpl:5
+func StreamMetricUsageResponse(qw422016 *qt422016.Writer, mus []promql.MetricUsage, trackingStartTime uint64) {
+//line app/vmselect/prometheus/metric_usage_response.qtpl:5
+	qw422016.N().S(`{"status":"success","data":{"trackingStartTime":`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:9
+	qw422016.N().DUL(trackingStartTime)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:9
+	qw422016.N().S(`,`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:11
+	n := 0
+	for n < len(mus) && mus[n].LastQueryTime == 0 {
+		n++
+	}
+
+//line app/vmselect/prometheus/metric_usage_response.qtpl:15
+	qw422016.N().S(`"unusedMetricNames":[`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:17
+	for i, mu := range mus[:n] {
+//line app/vmselect/prometheus/metric_usage_response.qtpl:18
+		qw422016.N().Q(mu.Name)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:19
+		if i+1 < n {
+//line app/vmselect/prometheus/metric_usage_response.qtpl:19
+			qw422016.N().S(`,`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:19
+		}
+//line app/vmselect/prometheus/metric_usage_response.qtpl:20
+	}
+//line app/vmselect/prometheus/metric_usage_response.qtpl:20
+	qw422016.N().S(`],"usedMetrics":[`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:23
+	for i, mu := range mus[n:] {
+//line app/vmselect/prometheus/metric_usage_response.qtpl:23
+		qw422016.N().S(`{"name":`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:25
+		qw422016.N().Q(mu.Name)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:25
+		qw422016.N().S(`,"lastQueryTime":`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:26
+		qw422016.N().DUL(mu.LastQueryTime)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:26
+		qw422016.N().S(`}`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:28
+		if n+i+1 < len(mus) {
+//line app/vmselect/prometheus/metric_usage_response.qtpl:28
+			qw422016.N().S(`,`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:28
+		}
+//line app/vmselect/prometheus/metric_usage_response.qtpl:29
+	}
+//line app/vmselect/prometheus/metric_usage_response.qtpl:29
+	qw422016.N().S(`]}}`)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+}
+
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+func WriteMetricUsageResponse(qq422016 qtio422016.Writer, mus []promql.MetricUsage, trackingStartTime uint64) {
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+	StreamMetricUsageResponse(qw422016, mus, trackingStartTime)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+}
+
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+func MetricUsageResponse(mus []promql.MetricUsage, trackingStartTime uint64) string {
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+	WriteMetricUsageResponse(qb422016, mus, trackingStartTime)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+	return qs422016
+//line app/vmselect/prometheus/metric_usage_response.qtpl:33
+}
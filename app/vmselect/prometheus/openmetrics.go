@@ -0,0 +1,114 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/quicktemplate"
+)
+
+// openMetricsContentType is the Content-Type for responses in OpenMetrics text format.
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// isOpenMetricsRequested returns true if the response for r must be written in OpenMetrics text format.
+//
+// The format must be requested explicitly via `format=openmetrics` query arg. `Accept` request header isn't taken into account,
+// since Prometheus sends `application/openmetrics-text` in it by default, while it expects Prometheus text exposition format from /federate.
+func isOpenMetricsRequested(r *http.Request) bool {
+	return r.FormValue("format") == "openmetrics"
+}
+
+// writeOpenMetricsData writes rss to w in OpenMetrics text format, using writeLine for every time series.
+//
+// Time series are written in the order of metric names, since OpenMetrics requires
+// that lines for the same metric family aren't interleaved with other metric families.
+func writeOpenMetricsData(w io.Writer, rss *netstorage.Results, writeLine func(w io.Writer, rs *netstorage.Result)) (int, error) {
+	var rowsCount uint64
+	resultsCh := make(chan *quicktemplate.ByteBuffer, runtime.GOMAXPROCS(-1))
+	doneCh := make(chan error)
+	go func() {
+		err := rss.RunParallelSorted(func(rs *netstorage.Result, workerID uint, bb *quicktemplate.ByteBuffer) {
+			atomic.AddUint64(&rowsCount, uint64(len(rs.Timestamps)))
+			writeLine(bb, rs)
+		}, resultsCh)
+		close(resultsCh)
+		doneCh <- err
+	}()
+
+	WriteExportOpenMetricsResponse(w, resultsCh)
+
+	// Consume all the data from resultsCh in the event WriteExportOpenMetricsResponse
+	// fails to consume all the data.
+	for bb := range resultsCh {
+		quicktemplate.ReleaseByteBuffer(bb)
+	}
+	if err := <-doneCh; err != nil {
+		return 0, fmt.Errorf("error during data fetching: %w", err)
+	}
+	return int(rowsCount), nil
+}
+
+// isValidOpenMetricsMetricName returns true if the metric name and label names in mn match OpenMetrics charset.
+//
+// Time series with invalid names are skipped, since a single invalid line makes the whole response unparsable.
+func isValidOpenMetricsMetricName(mn *storage.MetricName) bool {
+	if !isValidOpenMetricsName(mn.MetricGroup, true) {
+		openMetricsSkippedSeries.Inc()
+		return false
+	}
+	for i := range mn.Tags {
+		if !isValidOpenMetricsName(mn.Tags[i].Key, false) {
+			openMetricsSkippedSeries.Inc()
+			return false
+		}
+	}
+	return true
+}
+
+// isValidOpenMetricsName returns true if s matches `[a-zA-Z_:][a-zA-Z0-9_:]*` for metric names
+// and `[a-zA-Z_][a-zA-Z0-9_]*` for label names.
+func isValidOpenMetricsName(s []byte, isMetricName bool) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i, c := range s {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' && isMetricName || c >= '0' && c <= '9' && i > 0 {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+var openMetricsSkippedSeries = metrics.NewCounter(`vm_openmetrics_skipped_series_total`)
+
+// escapeOpenMetricsLabelValue escapes s according to OpenMetrics rules for label values.
+//
+// OpenMetrics allows only `\\`, `\"` and `\n` escape sequences in label values.
+func escapeOpenMetricsLabelValue(s []byte) []byte {
+	if bytes.IndexAny(s, "\\\"\n") < 0 {
+		// Fast path - nothing to escape.
+		return s
+	}
+	dst := make([]byte, 0, len(s)+8)
+	for _, c := range s {
+		switch c {
+		case '\\':
+			dst = append(dst, `\\`...)
+		case '"':
+			dst = append(dst, `\"`...)
+		case '\n':
+			dst = append(dst, `\n`...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
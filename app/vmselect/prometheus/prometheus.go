@@ -1,8 +1,11 @@
 package prometheus
 
 import (
+	"bufio"
+	"encoding/base64"
 	"flag"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"runtime"
@@ -10,15 +13,19 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/VictoriaMetrics/metricsql"
 	"github.com/valyala/fastjson/fastfloat"
@@ -29,7 +36,7 @@ var (
 	latencyOffset = flag.Duration("search.latencyOffset", time.Second*30, "The time when data points become visible in query results after the colection. "+
 		"Too small value can result in incomplete last points for query results")
 	maxExportDuration = flag.Duration("search.maxExportDuration", time.Hour*24*30, "The maximum duration for /api/v1/export call")
-	maxQueryDuration  = flag.Duration("search.maxQueryDuration", time.Second*30, "The maximum duration for search query execution")
+	maxQueryDuration  = flagutil.NewReloadableDuration("search.maxQueryDuration", time.Second*30, "The maximum duration for search query execution")
 	maxQueryLen       = flagutil.NewBytes("search.maxQueryLen", 16*1024, "The maximum search query length in bytes")
 	maxLookback       = flag.Duration("search.maxLookback", 0, "Synonim to -search.lookback-delta from Prometheus. "+
 		"The value is dynamically detected from interval between time series datapoints if not set. It can be overridden on per-query basis via max_lookback arg. "+
@@ -38,6 +45,12 @@ var (
 		"By default it is automatically calculated from the median interval between samples. This flag could be useful for tuning "+
 		"Prometheus data model closer to Influx-style data model. See https://prometheus.io/docs/prometheus/latest/querying/basics/#staleness for details. "+
 		"See also '-search.maxLookback' flag, which has the same meanining due to historical reasons")
+	counterResetJitterRatio = flag.Float64("search.counterResetJitterRatio", 0.125, "Counter decreases smaller than the given ratio of the previous value aren't considered as counter resets "+
+		"by rate(), increase() and similar functions. This prevents from big spikes for non-monotonic counters. Set it to 0 in order to consider every decrease as counter reset. "+
+		"It can be overridden on per-query basis via counter_reset_jitter_ratio arg")
+	alignRangeQueries = flag.Bool("search.alignRangeQueries", false, "Whether to align start and end args of /api/v1/query_range to step boundaries regardless of the number of points. "+
+		"This improves response cache hit ratio for dashboards, which send the current time in end arg. It can be enabled on per-query basis via align=1 arg. "+
+		"The effective time range is returned in X-VM-Effective-Start and X-VM-Effective-End response headers")
 )
 
 // Default step used if not set.
@@ -86,6 +99,15 @@ func FederateHandler(startTime time.Time, w http.ResponseWriter, r *http.Request
 		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
 
+	if isOpenMetricsRequested(r) {
+		w.Header().Set("Content-Type", openMetricsContentType)
+		if _, err := writeOpenMetricsData(w, rss, WriteFederateOpenMetrics); err != nil {
+			return err
+		}
+		federateDuration.UpdateDuration(startTime)
+		return nil
+	}
+
 	resultsCh := make(chan *quicktemplate.ByteBuffer)
 	doneCh := make(chan error)
 	go func() {
@@ -143,6 +165,17 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	if start >= end {
 		end = start + defaultStep
 	}
+	maxRowsPerChunk, err := getPositiveInt(r, "max_rows_per_chunk")
+	if err != nil {
+		return err
+	}
+	if maxRowsPerChunk > 0 {
+		if err := exportChunkHandler(w, r, matches, start, end, format, maxRowsPerLine, maxRowsPerChunk, deadline); err != nil {
+			return fmt.Errorf("error when exporting data chunk for queries=%q on the time range (start=%d, end=%d): %w", matches, start, end, err)
+		}
+		exportDuration.UpdateDuration(startTime)
+		return nil
+	}
 	if err := exportHandler(w, matches, start, end, format, maxRowsPerLine, deadline); err != nil {
 		return fmt.Errorf("error when exporting data for queries=%q on the time range (start=%d, end=%d): %w", matches, start, end, err)
 	}
@@ -152,9 +185,213 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 
 var exportDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/export"}`)
 
+// ExportNativeHandler exports data in native format from /api/v1/export/native.
+//
+// The exported data may be imported into another VictoriaMetrics instance via /api/v1/import/native.
+func ExportNativeHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	ct := startTime.UnixNano() / 1e6
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse request form values: %w", err)
+	}
+	matches := r.Form["match[]"]
+	if len(matches) == 0 {
+		// Maintain backwards compatibility
+		match := r.FormValue("match")
+		if len(match) == 0 {
+			return fmt.Errorf("missing `match[]` arg")
+		}
+		matches = []string{match}
+	}
+	start, err := getTime(r, "start", 0)
+	if err != nil {
+		return err
+	}
+	end, err := getTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	deadline := getDeadlineForExport(r, startTime)
+	if start >= end {
+		end = start + defaultStep
+	}
+	maxRowsPerChunk, err := getPositiveInt(r, "max_rows_per_chunk")
+	if err != nil {
+		return err
+	}
+	if maxRowsPerChunk > 0 {
+		if err := exportNativeChunkHandler(w, r, matches, start, end, maxRowsPerChunk, deadline); err != nil {
+			return fmt.Errorf("error when exporting data chunk in native format for queries=%q on the time range (start=%d, end=%d): %w", matches, start, end, err)
+		}
+		exportNativeDuration.UpdateDuration(startTime)
+		return nil
+	}
+	if err := exportNativeHandler(w, matches, start, end, deadline); err != nil {
+		return fmt.Errorf("error when exporting data in native format for queries=%q on the time range (start=%d, end=%d): %w", matches, start, end, err)
+	}
+	exportNativeDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var exportNativeDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/export/native"}`)
+
+func exportNativeHandler(w http.ResponseWriter, matches []string, start, end int64, deadline netstorage.Deadline) error {
+	tagFilterss, err := getTagFilterssFromMatches(matches)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "VictoriaMetrics/native")
+	bw := bufio.NewWriterSize(w, 64*1024)
+	if _, err := bw.Write(marshalNativeTimeRange(nil, start, end)); err != nil {
+		return err
+	}
+	if _, err := writeNativeBlocks(bw, tagFilterss, start, end, false, deadline); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func exportNativeChunkHandler(w http.ResponseWriter, r *http.Request, matches []string, start, end int64, maxRowsPerChunk int, deadline netstorage.Deadline) error {
+	tagFilterss, err := getTagFilterssFromMatches(matches)
+	if err != nil {
+		return err
+	}
+	return writeExportChunk(w, r, start, end, maxRowsPerChunk, "VictoriaMetrics/native", marshalNativeTimeRange,
+		getExportFirstTimestampFunc(tagFilterss, deadline),
+		func(w io.Writer, start, end int64) (int, error) {
+			// Blocks must be trimmed to bucket time range, since they may span multiple buckets in the chunk.
+			return writeNativeBlocks(w, tagFilterss, start, end, true, deadline)
+		})
+}
+
+func marshalNativeTimeRange(dst []byte, start, end int64) []byte {
+	dst = encoding.MarshalInt64(dst, start)
+	dst = encoding.MarshalInt64(dst, end)
+	return dst
+}
+
+// writeNativeBlocks writes blocks in native format for the given tagFilterss on the given time range to w.
+//
+// Rows outside the time range are dropped from blocks if keepRowsInTimeRange is set.
+// Otherwise blocks are written as is, since the importer drops rows outside the time range.
+//
+// It returns the number of written rows.
+func writeNativeBlocks(w io.Writer, tagFilterss [][]storage.TagFilter, start, end int64, keepRowsInTimeRange bool, deadline netstorage.Deadline) (int, error) {
+	sq := &storage.SearchQuery{
+		MinTimestamp: start,
+		MaxTimestamp: end,
+		TagFilterss:  tagFilterss,
+	}
+	// ExportBlocks calls the callback from concurrent goroutines,
+	// so writes to w must be serialized.
+	var wLock sync.Mutex
+	var rowsCount uint64
+	err := netstorage.ExportBlocks(sq, deadline, func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange) error {
+		n := b.RowsCount()
+		if keepRowsInTimeRange {
+			var err error
+			n, err = b.KeepRowsInTimeRange(tr)
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal block: %w", err)
+			}
+			if n == 0 {
+				return nil
+			}
+		}
+		dstBuf := bbPool.Get()
+		tmpBuf := bbPool.Get()
+		dst := dstBuf.B
+		tmp := tmpBuf.B
+
+		// Marshal mn
+		tmp = mn.Marshal(tmp[:0])
+		dst = encoding.MarshalUint32(dst, uint32(len(tmp)))
+		dst = append(dst, tmp...)
+
+		// Marshal b
+		tmp = b.MarshalPortable(tmp[:0])
+		dst = encoding.MarshalUint32(dst, uint32(len(tmp)))
+		dst = append(dst, tmp...)
+
+		tmpBuf.B = tmp
+		bbPool.Put(tmpBuf)
+
+		atomic.AddUint64(&rowsCount, uint64(n))
+		wLock.Lock()
+		_, err := w.Write(dst)
+		wLock.Unlock()
+
+		dstBuf.B = dst
+		bbPool.Put(dstBuf)
+		return err
+	})
+	return int(rowsCount), err
+}
+
+var bbPool bytesutil.ByteBufferPool
+
 func exportHandler(w http.ResponseWriter, matches []string, start, end int64, format string, maxRowsPerLine int, deadline netstorage.Deadline) error {
-	writeResponseFunc := WriteExportStdResponse
-	writeLineFunc := func(rs *netstorage.Result, resultsCh chan<- *quicktemplate.ByteBuffer) {
+	contentType, writeResponseFunc, writeLineFunc := getExportFuncs(format, maxRowsPerLine)
+	tagFilterss, err := getTagFilterssFromMatches(matches)
+	if err != nil {
+		return err
+	}
+	if format == "openmetrics" {
+		sq := &storage.SearchQuery{
+			MinTimestamp: start,
+			MaxTimestamp: end,
+			TagFilterss:  tagFilterss,
+		}
+		rss, err := netstorage.ProcessSearchQuery(sq, true, deadline)
+		if err != nil {
+			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+		}
+		w.Header().Set("Content-Type", openMetricsContentType)
+		_, err = writeOpenMetricsData(w, rss, WriteExportOpenMetricsLine)
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, err = writeExportData(w, tagFilterss, start, end, writeResponseFunc, writeLineFunc, deadline)
+	return err
+}
+
+func exportChunkHandler(w http.ResponseWriter, r *http.Request, matches []string, start, end int64, format string, maxRowsPerLine, maxRowsPerChunk int,
+	deadline netstorage.Deadline) error {
+	if format == "promapi" || format == "openmetrics" {
+		return fmt.Errorf("max_rows_per_chunk cannot be used with format=%s", format)
+	}
+	contentType, writeResponseFunc, writeLineFunc := getExportFuncs(format, maxRowsPerLine)
+	tagFilterss, err := getTagFilterssFromMatches(matches)
+	if err != nil {
+		return err
+	}
+	return writeExportChunk(w, r, start, end, maxRowsPerChunk, contentType, nil, getExportFirstTimestampFunc(tagFilterss, deadline),
+		func(w io.Writer, start, end int64) (int, error) {
+			return writeExportData(w, tagFilterss, start, end, writeResponseFunc, writeLineFunc, deadline)
+		})
+}
+
+func getExportFirstTimestampFunc(tagFilterss [][]storage.TagFilter, deadline netstorage.Deadline) func(start, end int64) (int64, bool, error) {
+	return func(start, end int64) (int64, bool, error) {
+		sq := &storage.SearchQuery{
+			MinTimestamp: start,
+			MaxTimestamp: end,
+			TagFilterss:  tagFilterss,
+		}
+		ts, ok, err := netstorage.GetFirstTimestamp(sq, deadline)
+		if err != nil {
+			return 0, false, fmt.Errorf("cannot find the first timestamp for %q: %w", sq, err)
+		}
+		return ts, ok, nil
+	}
+}
+
+type exportWriteResponseFunc func(w io.Writer, resultsCh <-chan *quicktemplate.ByteBuffer)
+
+type exportWriteLineFunc func(rs *netstorage.Result, resultsCh chan<- *quicktemplate.ByteBuffer)
+
+func getExportFuncs(format string, maxRowsPerLine int) (string, exportWriteResponseFunc, exportWriteLineFunc) {
+	var writeResponseFunc exportWriteResponseFunc = WriteExportStdResponse
+	var writeLineFunc exportWriteLineFunc = func(rs *netstorage.Result, resultsCh chan<- *quicktemplate.ByteBuffer) {
 		bb := quicktemplate.AcquireByteBuffer()
 		WriteExportJSONLine(bb, rs)
 		resultsCh <- bb
@@ -201,15 +438,22 @@ func exportHandler(w http.ResponseWriter, matches []string, start, end int64, fo
 		writeResponseFunc = WriteExportPromAPIResponse
 		writeLineFunc = func(rs *netstorage.Result, resultsCh chan<- *quicktemplate.ByteBuffer) {
 			bb := quicktemplate.AcquireByteBuffer()
+			// The "promapi" format is used for serving instant queries with metric selectors,
+			// so the result labels must be added here.
+			addResultLabels(&rs.MetricName)
 			WriteExportPromAPILine(bb, rs)
 			resultsCh <- bb
 		}
 	}
 
-	tagFilterss, err := getTagFilterssFromMatches(matches)
-	if err != nil {
-		return err
-	}
+	return contentType, writeResponseFunc, writeLineFunc
+}
+
+// writeExportData writes data for the given tagFilterss on the given time range to w.
+//
+// It returns the number of written rows.
+func writeExportData(w io.Writer, tagFilterss [][]storage.TagFilter, start, end int64,
+	writeResponseFunc exportWriteResponseFunc, writeLineFunc exportWriteLineFunc, deadline netstorage.Deadline) (int, error) {
 	sq := &storage.SearchQuery{
 		MinTimestamp: start,
 		MaxTimestamp: end,
@@ -217,20 +461,21 @@ func exportHandler(w http.ResponseWriter, matches []string, start, end int64, fo
 	}
 	rss, err := netstorage.ProcessSearchQuery(sq, true, deadline)
 	if err != nil {
-		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+		return 0, fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
 
+	var rowsCount uint64
 	resultsCh := make(chan *quicktemplate.ByteBuffer, runtime.GOMAXPROCS(-1))
 	doneCh := make(chan error)
 	go func() {
 		err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) {
+			atomic.AddUint64(&rowsCount, uint64(len(rs.Timestamps)))
 			writeLineFunc(rs, resultsCh)
 		})
 		close(resultsCh)
 		doneCh <- err
 	}()
 
-	w.Header().Set("Content-Type", contentType)
 	writeResponseFunc(w, resultsCh)
 
 	// Consume all the data from resultsCh in the event writeResponseFunc
@@ -240,15 +485,126 @@ func exportHandler(w http.ResponseWriter, matches []string, start, end int64, fo
 	}
 	err = <-doneCh
 	if err != nil {
-		return fmt.Errorf("error during data fetching: %w", err)
+		return 0, fmt.Errorf("error during data fetching: %w", err)
+	}
+	return int(rowsCount), nil
+}
+
+// writeExportChunk writes a chunk of exported data on the [start...end] time range to w.
+//
+// The time range is split into buckets with `chunk_duration` duration. The chunk contains whole buckets
+// until the number of rows in the chunk reaches maxRowsPerChunk. The chunk starts from `cursor` if it is set.
+// The cursor for the next chunk is returned in X-VM-Export-Cursor response trailer. The trailer is missing
+// for the last chunk.
+//
+// The chunk is streamed to w, so the cursor is sent in the trailer after the chunk data.
+//
+// Time ranges without data are skipped with the help of firstTimestamp, which must return a lower bound
+// for the first timestamp of the exported data on the given time range.
+func writeExportChunk(w http.ResponseWriter, r *http.Request, start, end int64, maxRowsPerChunk int, contentType string,
+	marshalHeader func(dst []byte, start, end int64) []byte, firstTimestamp func(start, end int64) (int64, bool, error),
+	writeBucket func(w io.Writer, start, end int64) (int, error)) error {
+	chunkDuration, err := getDuration(r, "chunk_duration", defaultExportChunkDuration)
+	if err != nil {
+		return err
+	}
+	if cursor := r.FormValue("cursor"); len(cursor) > 0 {
+		n, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || n < start || n > end {
+			return fmt.Errorf("invalid cursor=%q; it must be obtained from X-VM-Export-Cursor response trailer for the previous chunk", cursor)
+		}
+		start = n
+	}
+
+	// The trailer must be declared before writing the response body.
+	w.Header().Set("Trailer", "X-VM-Export-Cursor")
+	w.Header().Set("Content-Type", contentType)
+	bw := bufio.NewWriterSize(w, 64*1024)
+	if marshalHeader != nil {
+		// The end of the chunk is unknown beforehand, so the whole time range is written in the header.
+		// This is OK, since the chunk contains only rows from its buckets.
+		if _, err := bw.Write(marshalHeader(nil, start, end)); err != nil {
+			return err
+		}
+	}
+	rowsCount := 0
+	bucketStart := start
+	needSeek := true
+	for bucketStart <= end {
+		if needSeek {
+			// Skip buckets without data, so exports with missing start arg or with big gaps in data
+			// don't query every empty bucket.
+			ts, ok, err := seekExportData(firstTimestamp, bucketStart, end, chunkDuration)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				bucketStart = end + 1
+				break
+			}
+			bucketStart = ts
+		}
+		bucketEnd := bucketStart - bucketStart%chunkDuration + chunkDuration - 1
+		if bucketEnd > end {
+			bucketEnd = end
+		}
+		n, err := writeBucket(bw, bucketStart, bucketEnd)
+		if err != nil {
+			return err
+		}
+		rowsCount += n
+		bucketStart = bucketEnd + 1
+		if rowsCount >= maxRowsPerChunk {
+			break
+		}
+		needSeek = n == 0
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if bucketStart <= end {
+		w.Header().Set("X-VM-Export-Cursor", strconv.FormatInt(bucketStart, 10))
 	}
 	return nil
 }
 
+// seekExportData returns a lower bound for the first timestamp of data on the [start...end] time range.
+//
+// The time range is searched with exponentially growing windows starting from chunkDuration,
+// so the search cost is proportional to the distance to the data instead of the whole time range.
+// false is returned if there is no data on the time range.
+func seekExportData(firstTimestamp func(start, end int64) (int64, bool, error), start, end, chunkDuration int64) (int64, bool, error) {
+	window := chunkDuration
+	for start <= end {
+		windowEnd := end
+		if window <= end-start {
+			windowEnd = start + window - 1
+		}
+		ts, ok, err := firstTimestamp(start, windowEnd)
+		if err != nil || ok {
+			return ts, ok, err
+		}
+		if windowEnd == end {
+			break
+		}
+		start = windowEnd + 1
+		if window < end-start {
+			window *= 2
+		}
+	}
+	return 0, false, nil
+}
+
+// defaultExportChunkDuration is the default duration in milliseconds for time buckets used in writeExportChunk.
+const defaultExportChunkDuration = 3600 * 1000
+
 // DeleteHandler processes /api/v1/admin/tsdb/delete_series prometheus API request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#delete-series
-func DeleteHandler(startTime time.Time, r *http.Request) error {
+//
+// If `dry_run=1` arg is passed, then nothing is deleted. The number of matching series
+// and up to `limit` names of these series are returned instead.
+func DeleteHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
 	if err := r.ParseForm(); err != nil {
 		return fmt.Errorf("cannot parse request form values: %w", err)
 	}
@@ -266,6 +622,23 @@ func DeleteHandler(startTime time.Time, r *http.Request) error {
 	sq := &storage.SearchQuery{
 		TagFilterss: tagFilterss,
 	}
+	if getBool(r, "dry_run") {
+		limit, err := getPositiveInt(r, "limit")
+		if err != nil {
+			return err
+		}
+		if limit == 0 {
+			limit = defaultDeleteDryRunLimit
+		}
+		seriesCount, mns, err := netstorage.DeleteSeriesDryRun(sq, limit)
+		if err != nil {
+			return fmt.Errorf("cannot count time series matching %q: %w", matches, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		WriteDeleteSeriesDryRunResponse(w, seriesCount, mns)
+		deleteDuration.UpdateDuration(startTime)
+		return nil
+	}
 	deletedCount, err := netstorage.DeleteSeries(sq)
 	if err != nil {
 		return fmt.Errorf("cannot delete time series matching %q: %w", matches, err)
@@ -273,10 +646,14 @@ func DeleteHandler(startTime time.Time, r *http.Request) error {
 	if deletedCount > 0 {
 		promql.ResetRollupResultCache()
 	}
+	w.WriteHeader(http.StatusNoContent)
 	deleteDuration.UpdateDuration(startTime)
 	return nil
 }
 
+// defaultDeleteDryRunLimit is the default number of series names returned from /api/v1/admin/tsdb/delete_series?dry_run=1
+const defaultDeleteDryRunLimit = 10
+
 var deleteDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/admin/tsdb/delete_series"}`)
 
 // LabelValuesHandler processes /api/v1/label/<labelName>/values request.
@@ -319,12 +696,47 @@ func LabelValuesHandler(startTime time.Time, labelName string, w http.ResponseWr
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	WriteLabelValuesResponse(w, labelValues)
+	if getBool(r, "count") {
+		// The response format is the same as for /api/v1/series/count.
+		WriteSeriesCountResponse(w, uint64(len(labelValues)))
+	} else {
+		WriteLabelValuesResponse(w, labelValues)
+	}
 	labelValuesDuration.UpdateDuration(startTime)
 	return nil
 }
 
 func labelValuesWithMatches(labelName string, matches []string, start, end int64, deadline netstorage.Deadline) ([]string, error) {
+	rss, err := searchSeriesWithLabel(labelName, matches, start, end, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]struct{})
+	var mLock sync.Mutex
+	err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) {
+		labelValue := rs.MetricName.GetTagValue(labelName)
+		if len(labelValue) == 0 {
+			return
+		}
+		mLock.Lock()
+		m[string(labelValue)] = struct{}{}
+		mLock.Unlock()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error when data fetching: %w", err)
+	}
+
+	labelValues := make([]string, 0, len(m))
+	for labelValue := range m {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+	return labelValues, nil
+}
+
+// searchSeriesWithLabel returns series with non-empty labelName matching the given matches on the given time range.
+func searchSeriesWithLabel(labelName string, matches []string, start, end int64, deadline netstorage.Deadline) (*netstorage.Results, error) {
 	if len(matches) == 0 {
 		logger.Panicf("BUG: matches must be non-empty")
 	}
@@ -357,31 +769,127 @@ func labelValuesWithMatches(labelName string, matches []string, start, end int64
 	if err != nil {
 		return nil, fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
+	return rss, nil
+}
 
-	m := make(map[string]struct{})
+var labelValuesDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/label/{}/values"}`)
+
+// defaultLabelValueSuggestionsLimit is the default number of values returned from /api/v1/label/<labelName>/suggest.
+const defaultLabelValueSuggestionsLimit = 20
+
+// LabelValueSuggestionsHandler processes /api/v1/label/<labelName>/suggest request.
+//
+// It returns up to `limit` values for the given labelName starting with `q` ordered by the number of series containing them.
+// Values containing `q` in case-insensitive manner are returned if `substring=1` arg is passed.
+// Optional `match[]`, `start` and `end` args limit the search to series matching the given selectors on the given time range.
+func LabelValueSuggestionsHandler(startTime time.Time, labelName string, w http.ResponseWriter, r *http.Request) error {
+	deadline := getDeadlineForQuery(r, startTime)
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	query := r.FormValue("q")
+	substring := getBool(r, "substring")
+	limit, err := getPositiveInt(r, "limit")
+	if err != nil {
+		return err
+	}
+	if limit == 0 {
+		limit = defaultLabelValueSuggestionsLimit
+	}
+	var tvss []storage.TagValueSuggestion
+	if len(r.Form["match[]"]) == 0 && len(r.Form["start"]) == 0 && len(r.Form["end"]) == 0 {
+		tvss, err = netstorage.GetLabelValueSuggestions(labelName, query, substring, deadline)
+		if err != nil {
+			return fmt.Errorf(`cannot obtain label value suggestions for %q, q=%q: %w`, labelName, query, err)
+		}
+	} else {
+		matches := r.Form["match[]"]
+		if len(matches) == 0 {
+			matches = []string{fmt.Sprintf("{%s!=''}", labelName)}
+		}
+		ct := startTime.UnixNano() / 1e6
+		end, err := getTime(r, "end", ct)
+		if err != nil {
+			return err
+		}
+		start, err := getTime(r, "start", end-defaultStep)
+		if err != nil {
+			return err
+		}
+		tvss, err = labelValueSuggestionsWithMatches(labelName, query, substring, matches, start, end, deadline)
+		if err != nil {
+			return fmt.Errorf("cannot obtain label value suggestions for %q, q=%q, match[]=%q, start=%d, end=%d: %w",
+				labelName, query, matches, start, end, err)
+		}
+	}
+	sortTagValueSuggestions(tvss)
+	if len(tvss) > limit {
+		tvss = tvss[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	WriteLabelValueSuggestionsResponse(w, tvss)
+	labelValueSuggestionsDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var labelValueSuggestionsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/label/{}/suggest"}`)
+
+func labelValueSuggestionsWithMatches(labelName, query string, substring bool, matches []string, start, end int64,
+	deadline netstorage.Deadline) ([]storage.TagValueSuggestion, error) {
+	rss, err := searchSeriesWithLabel(labelName, matches, start, end, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	queryLower := strings.ToLower(query)
+	m := make(map[string]uint64)
 	var mLock sync.Mutex
 	err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) {
 		labelValue := rs.MetricName.GetTagValue(labelName)
-		if len(labelValue) == 0 {
+		if len(labelValue) == 0 || !matchLabelValueSuggestion(string(labelValue), query, queryLower, substring) {
 			return
 		}
 		mLock.Lock()
-		m[string(labelValue)] = struct{}{}
+		m[string(labelValue)]++
 		mLock.Unlock()
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error when data fetching: %w", err)
 	}
 
-	labelValues := make([]string, 0, len(m))
-	for labelValue := range m {
-		labelValues = append(labelValues, labelValue)
+	tvss := make([]storage.TagValueSuggestion, 0, len(m))
+	for labelValue, n := range m {
+		tvss = append(tvss, storage.TagValueSuggestion{
+			Value:       labelValue,
+			SeriesCount: n,
+		})
 	}
-	sort.Strings(labelValues)
-	return labelValues, nil
+	return tvss, nil
 }
 
-var labelValuesDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/label/{}/values"}`)
+// matchLabelValueSuggestion returns true if labelValue matches the query passed to /api/v1/label/<labelName>/suggest.
+//
+// queryLower must contain lowercase query.
+func matchLabelValueSuggestion(labelValue, query, queryLower string, substring bool) bool {
+	if !substring {
+		return strings.HasPrefix(labelValue, query)
+	}
+	return strings.Contains(strings.ToLower(labelValue), queryLower)
+}
+
+// sortTagValueSuggestions sorts tvss by the number of series in descending order.
+//
+// Values with the same number of series are sorted alphabetically.
+func sortTagValueSuggestions(tvss []storage.TagValueSuggestion) {
+	sort.Slice(tvss, func(i, j int) bool {
+		a, b := &tvss[i], &tvss[j]
+		if a.SeriesCount != b.SeriesCount {
+			return a.SeriesCount > b.SeriesCount
+		}
+		return a.Value < b.Value
+	})
+}
 
 // LabelsCountHandler processes /api/v1/labels/count request.
 func LabelsCountHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
@@ -398,6 +906,24 @@ func LabelsCountHandler(startTime time.Time, w http.ResponseWriter, r *http.Requ
 
 var labelsCountDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/labels/count"}`)
 
+// MetricUsageHandler processes /api/v1/status/metric_usage request.
+//
+// It returns metric names, which are stored in the database, together with the last time they were queried.
+func MetricUsageHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	deadline := getDeadlineForQuery(r, startTime)
+	metricNames, err := netstorage.GetLabelValues("__name__", deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain metric names: %w", err)
+	}
+	mus, trackingStartTime := promql.GetMetricUsage(metricNames)
+	w.Header().Set("Content-Type", "application/json")
+	WriteMetricUsageResponse(w, mus, trackingStartTime)
+	metricUsageDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var metricUsageDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/status/metric_usage"}`)
+
 const secsPerDay = 3600 * 24
 
 // TSDBStatusHandler processes /api/v1/status/tsdb request.
@@ -432,9 +958,30 @@ func TSDBStatusHandler(startTime time.Time, w http.ResponseWriter, r *http.Reque
 		}
 		topN = n
 	}
-	status, err := netstorage.GetTSDBStatusForDate(deadline, date, topN)
-	if err != nil {
-		return fmt.Errorf(`cannot obtain tsdb status for date=%d, topN=%d: %w`, date, topN, err)
+	matches := r.Form["match[]"]
+	focusLabel := r.FormValue("focusLabel")
+	var status *storage.TSDBStatus
+	var err error
+	if len(matches) == 0 && len(focusLabel) == 0 {
+		status, err = netstorage.GetTSDBStatusForDate(deadline, date, topN)
+		if err != nil {
+			return fmt.Errorf(`cannot obtain tsdb status for date=%d, topN=%d: %w`, date, topN, err)
+		}
+	} else {
+		var tagFilterss [][]storage.TagFilter
+		tagFilterss, err = getTagFilterssFromMatches(matches)
+		if err != nil {
+			return err
+		}
+		sq := &storage.SearchQuery{
+			MinTimestamp: int64(date) * secsPerDay * 1000,
+			MaxTimestamp: int64(date+1)*secsPerDay*1000 - 1,
+			TagFilterss:  tagFilterss,
+		}
+		status, err = netstorage.GetTSDBStatusWithFilters(deadline, sq, date, topN, focusLabel)
+		if err != nil {
+			return fmt.Errorf(`cannot obtain tsdb status for match[]=%q, focusLabel=%q, date=%d, topN=%d: %w`, matches, focusLabel, date, topN, err)
+		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	WriteTSDBStatusResponse(w, status)
@@ -482,7 +1029,12 @@ func LabelsHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	WriteLabelsResponse(w, labels)
+	if getBool(r, "count") {
+		// The response format is the same as for /api/v1/series/count.
+		WriteSeriesCountResponse(w, uint64(len(labels)))
+	} else {
+		WriteLabelsResponse(w, labels)
+	}
 	labelsDuration.UpdateDuration(startTime)
 	return nil
 }
@@ -588,6 +1140,28 @@ func SeriesHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 		MaxTimestamp: end,
 		TagFilterss:  tagFilterss,
 	}
+	if getBool(r, "count") {
+		// Count the matching series inside the index without fetching their names.
+		n, err := netstorage.GetSeriesCountWithFilters(sq, deadline)
+		if err != nil {
+			return fmt.Errorf("cannot obtain series count for %q: %w", sq, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		WriteSeriesCountResponse(w, n)
+		seriesDuration.UpdateDuration(startTime)
+		return nil
+	}
+	limit, err := getPositiveInt(r, "limit")
+	if err != nil {
+		return err
+	}
+	afterMetricID, err := getSeriesPageToken(r)
+	if err != nil {
+		return err
+	}
+	if limit > 0 || afterMetricID > 0 {
+		return seriesPageHandler(startTime, w, sq, limit, afterMetricID, deadline)
+	}
 	rss, err := netstorage.ProcessSearchQuery(sq, false, deadline)
 	if err != nil {
 		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
@@ -606,7 +1180,7 @@ func SeriesHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	}()
 
 	w.Header().Set("Content-Type", "application/json")
-	WriteSeriesResponse(w, resultsCh)
+	WriteSeriesResponse(w, resultsCh, "")
 
 	// Consume all the data from resultsCh in the event WriteSeriesResponse
 	// fails to consume all the data.
@@ -623,6 +1197,55 @@ func SeriesHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 
 var seriesDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/series"}`)
 
+// seriesPageHandler writes up to limit series matching sq, which follow the series identified by pageToken, to w.
+//
+// Series are returned in a stable order, so every page resumes right after the last series from the previous page.
+// The number of matching series is limited by -search.maxUniqueTimeseries.
+// Up to -search.maxUniqueTimeseries series are returned if limit isn't set.
+// The response contains nextPageToken if there are more series to return.
+func seriesPageHandler(startTime time.Time, w http.ResponseWriter, sq *storage.SearchQuery, limit int, afterMetricID uint64, deadline netstorage.Deadline) error {
+	metricNames, nextAfterMetricID, err := netstorage.SearchMetricNamesPage(sq, afterMetricID, limit, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot fetch series for %q: %w", sq, err)
+	}
+	nextPageToken := ""
+	if nextAfterMetricID > 0 {
+		nextPageToken = base64.RawURLEncoding.EncodeToString(encoding.MarshalUint64(nil, nextAfterMetricID))
+	}
+
+	resultsCh := make(chan *quicktemplate.ByteBuffer, len(metricNames))
+	var mn storage.MetricName
+	for _, metricName := range metricNames {
+		if err := mn.Unmarshal(metricName); err != nil {
+			return fmt.Errorf("cannot unmarshal metricName %q: %w", metricName, err)
+		}
+		bb := quicktemplate.AcquireByteBuffer()
+		writemetricNameObject(bb, &mn)
+		resultsCh <- bb
+	}
+	close(resultsCh)
+
+	w.Header().Set("Content-Type", "application/json")
+	WriteSeriesResponse(w, resultsCh, nextPageToken)
+	seriesDuration.UpdateDuration(startTime)
+	return nil
+}
+
+// getSeriesPageToken returns metricID for the last series from the previous page identified by `pageToken` arg.
+//
+// Zero is returned if `pageToken` arg is missing.
+func getSeriesPageToken(r *http.Request) (uint64, error) {
+	s := r.FormValue("pageToken")
+	if len(s) == 0 {
+		return 0, nil
+	}
+	pageToken, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(pageToken) != 8 {
+		return 0, fmt.Errorf("cannot decode `pageToken` arg %q; it must be obtained from `nextPageToken` field of the previous page", s)
+	}
+	return encoding.UnmarshalUint64(pageToken), nil
+}
+
 // QueryHandler processes /api/v1/query request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#instant-queries
@@ -640,6 +1263,10 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 	if err != nil {
 		return err
 	}
+	jitterRatio, err := getCounterResetJitterRatio(r)
+	if err != nil {
+		return err
+	}
 	step, err := getDuration(r, "step", lookbackDelta)
 	if err != nil {
 		return err
@@ -650,7 +1277,9 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 	deadline := getDeadlineForQuery(r, startTime)
 
 	if len(query) > maxQueryLen.N {
-		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+		return &netstorage.LimitExceededError{
+			Err: fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N),
+		}
 	}
 	queryOffset := getLatencyOffsetMilliseconds()
 	if !getBool(r, "nocache") && ct-start < queryOffset {
@@ -702,6 +1331,7 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		return nil
 	}
 
+	var qs promql.QueryStats
 	ec := promql.EvalConfig{
 		Start:            start,
 		End:              start,
@@ -709,12 +1339,23 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
 		Deadline:         deadline,
 		LookbackDelta:    lookbackDelta,
+		QueryStats:       &qs,
+
+		CounterResetJitterRatio: jitterRatio,
 	}
+	span := tracing.StartChildSpan(r.Context(), "promql.Exec")
+	span.SetAttribute("query", query)
+	ec.Span = span
 	result, err := promql.Exec(&ec, query, true)
+	span.SetError(err)
+	span.End()
 	if err != nil {
 		return fmt.Errorf("error when executing query=%q for (time=%d, step=%d): %w", query, start, step, err)
 	}
 
+	addResultLabelsToResults(result)
+
+	setQueryStatsHeaders(w, &qs)
 	w.Header().Set("Content-Type", "application/json")
 	WriteQueryResponse(w, result)
 	queryDuration.UpdateDuration(startTime)
@@ -772,10 +1413,16 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 	if err != nil {
 		return err
 	}
+	jitterRatio, err := getCounterResetJitterRatio(r)
+	if err != nil {
+		return err
+	}
 
 	// Validate input args.
 	if len(query) > maxQueryLen.N {
-		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+		return &netstorage.LimitExceededError{
+			Err: fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N),
+		}
 	}
 	if start > end {
 		end = start + defaultStep
@@ -783,10 +1430,13 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 	if err := promql.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
 		return err
 	}
-	if mayCache {
+	if *alignRangeQueries || getBool(r, "align") {
+		start, end = promql.AlignStartEnd(start, end, step)
+	} else if mayCache {
 		start, end = promql.AdjustStartEnd(start, end, step)
 	}
 
+	var qs promql.QueryStats
 	ec := promql.EvalConfig{
 		Start:            start,
 		End:              end,
@@ -795,8 +1445,16 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 		Deadline:         deadline,
 		MayCache:         mayCache,
 		LookbackDelta:    lookbackDelta,
+		QueryStats:       &qs,
+
+		CounterResetJitterRatio: jitterRatio,
 	}
+	span := tracing.StartChildSpan(r.Context(), "promql.Exec")
+	span.SetAttribute("query", query)
+	ec.Span = span
 	result, err := promql.Exec(&ec, query, false)
+	span.SetError(err)
+	span.End()
 	if err != nil {
 		return fmt.Errorf("cannot execute query: %w", err)
 	}
@@ -808,12 +1466,34 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 	// Remove NaN values as Prometheus does.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/153
 	result = removeEmptyValuesAndTimeseries(result)
+	addResultLabelsToResults(result)
 
+	setQueryStatsHeaders(w, &qs)
+	setEffectiveRangeHeaders(w, start, end)
 	w.Header().Set("Content-Type", "application/json")
 	WriteQueryRangeResponse(w, result)
 	return nil
 }
 
+// setEffectiveRangeHeaders sets response headers with the time range actually used for query evaluation.
+//
+// The range may differ from the requested one after aligning start and end to step.
+func setEffectiveRangeHeaders(w http.ResponseWriter, start, end int64) {
+	h := w.Header()
+	h.Set("X-VM-Effective-Start", strconv.FormatFloat(float64(start)/1e3, 'f', -1, 64))
+	h.Set("X-VM-Effective-End", strconv.FormatFloat(float64(end)/1e3, 'f', -1, 64))
+}
+
+// setQueryStatsHeaders sets response headers with query execution statistics from qs,
+// so API clients can log the query cost without enabling tracing.
+func setQueryStatsHeaders(w http.ResponseWriter, qs *promql.QueryStats) {
+	h := w.Header()
+	h.Set("X-VM-Series-Fetched", strconv.FormatUint(atomic.LoadUint64(&qs.SeriesFetched), 10))
+	h.Set("X-VM-Samples-Scanned", strconv.FormatUint(atomic.LoadUint64(&qs.SamplesScanned), 10))
+	h.Set("X-VM-Blocks-Read", strconv.FormatUint(atomic.LoadUint64(&qs.BlocksRead), 10))
+	h.Set("X-VM-Cache-Hit", strconv.FormatBool(atomic.LoadUint64(&qs.CacheHits) > 0))
+}
+
 func removeEmptyValuesAndTimeseries(tss []netstorage.Result) []netstorage.Result {
 	dst := tss[:0]
 	for i := range tss {
@@ -971,8 +1651,23 @@ func getMaxLookback(r *http.Request) (int64, error) {
 	return getDuration(r, "max_lookback", d)
 }
 
+func getCounterResetJitterRatio(r *http.Request) (float64, error) {
+	argValue := r.FormValue("counter_reset_jitter_ratio")
+	if len(argValue) == 0 {
+		return *counterResetJitterRatio, nil
+	}
+	ratio, err := strconv.ParseFloat(argValue, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse counter_reset_jitter_ratio=%q: %w", argValue, err)
+	}
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("counter_reset_jitter_ratio=%v is out of allowed range [0 ... 1]", ratio)
+	}
+	return ratio, nil
+}
+
 func getDeadlineForQuery(r *http.Request, startTime time.Time) netstorage.Deadline {
-	dMax := maxQueryDuration.Milliseconds()
+	dMax := maxQueryDuration.Get().Milliseconds()
 	return getDeadlineWithMaxDuration(r, startTime, dMax, "-search.maxQueryDuration")
 }
 
@@ -990,7 +1685,23 @@ func getDeadlineWithMaxDuration(r *http.Request, startTime time.Time, dMax int64
 		d = dMax
 	}
 	timeout := time.Duration(d) * time.Millisecond
-	return netstorage.NewDeadline(startTime, timeout, flagHint)
+	// Cancel the query when the client closes the connection, so it doesn't waste resources.
+	return netstorage.NewDeadline(startTime, timeout, flagHint).WithStopCh(r.Context().Done())
+}
+
+func getPositiveInt(r *http.Request, argKey string) (int, error) {
+	s := r.FormValue(argKey)
+	if len(s) == 0 {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse `%s` arg %q: %w", argKey, s, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("`%s` arg cannot be negative; got %d", argKey, n)
+	}
+	return n, nil
 }
 
 func getBool(r *http.Request, argKey string) bool {
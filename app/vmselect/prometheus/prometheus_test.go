@@ -2,13 +2,21 @@ package prometheus
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/valyala/quicktemplate"
 )
 
 func TestRemoveEmptyValuesAndTimeseries(t *testing.T) {
@@ -120,6 +128,241 @@ func TestGetTimeError(t *testing.T) {
 	f("292277025-08-18T07:12:54.999999998Z")
 }
 
+func TestGetPositiveInt(t *testing.T) {
+	f := func(s string, nExpected int, isErrorExpected bool) {
+		t.Helper()
+		urlStr := fmt.Sprintf("http://foo.bar/baz?limit=%s", url.QueryEscape(s))
+		r, err := http.NewRequest("GET", urlStr, nil)
+		if err != nil {
+			t.Fatalf("unexpected error in NewRequest: %s", err)
+		}
+		n, err := getPositiveInt(r, "limit")
+		if isErrorExpected {
+			if err == nil {
+				t.Fatalf("expecting non-nil error in getPositiveInt(%q)", s)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error in getPositiveInt(%q): %s", s, err)
+		}
+		if n != nExpected {
+			t.Fatalf("unexpected value for getPositiveInt(%q); got %d; want %d", s, n, nExpected)
+		}
+	}
+
+	f("", 0, false)
+	f("0", 0, false)
+	f("100", 100, false)
+	f("-1", 0, true)
+	f("foo", 0, true)
+}
+
+func TestGetDeadlineWithMaxDuration(t *testing.T) {
+	f := func(timeout string, timeoutExpected string) {
+		t.Helper()
+		urlStr := fmt.Sprintf("http://foo.bar/baz?timeout=%s", url.QueryEscape(timeout))
+		r, err := http.NewRequest("GET", urlStr, nil)
+		if err != nil {
+			t.Fatalf("unexpected error in NewRequest: %s", err)
+		}
+		deadline := getDeadlineWithMaxDuration(r, time.Now(), 30e3, "-search.maxQueryDuration")
+		s := deadline.String()
+		if !strings.HasPrefix(s, timeoutExpected+" seconds;") {
+			t.Fatalf("unexpected deadline for timeout=%q; got %q; want %s seconds", timeout, s, timeoutExpected)
+		}
+	}
+
+	// Missing or invalid timeout
+	f("", "30.000")
+	f("foobar", "30.000")
+	f("-5s", "30.000")
+
+	// Timeout smaller than the max duration
+	f("5", "5.000")
+	f("1.5", "1.500")
+	f("10s", "10.000")
+
+	// Timeout bigger than the max duration
+	f("1m", "30.000")
+	f("3600", "30.000")
+}
+
+func TestSeriesResponse(t *testing.T) {
+	f := func(items []string, nextPageToken, responseExpected string) {
+		t.Helper()
+		resultsCh := make(chan *quicktemplate.ByteBuffer, len(items))
+		for _, item := range items {
+			bb := quicktemplate.AcquireByteBuffer()
+			bb.B = append(bb.B, item...)
+			resultsCh <- bb
+		}
+		close(resultsCh)
+		response := SeriesResponse(resultsCh, nextPageToken)
+		if response != responseExpected {
+			t.Fatalf("unexpected response; got\n%s\nwant\n%s", response, responseExpected)
+		}
+	}
+
+	f(nil, "", `{"status":"success","data":[]}`)
+	f([]string{`{"__name__":"foo"}`, `{"__name__":"bar"}`}, "", `{"status":"success","data":[{"__name__":"foo"},{"__name__":"bar"}]}`)
+	f([]string{`{"__name__":"foo"}`}, "Zm9v", `{"status":"success","data":[{"__name__":"foo"}],"nextPageToken":"Zm9v"}`)
+}
+
+func TestExportOpenMetricsResponse(t *testing.T) {
+	f := func(rss []netstorage.Result, responseExpected string) {
+		t.Helper()
+		resultsCh := make(chan *quicktemplate.ByteBuffer, len(rss))
+		for i := range rss {
+			bb := quicktemplate.AcquireByteBuffer()
+			WriteExportOpenMetricsLine(bb, &rss[i])
+			resultsCh <- bb
+		}
+		close(resultsCh)
+		response := ExportOpenMetricsResponse(resultsCh)
+		if response != responseExpected {
+			t.Fatalf("unexpected response; got\n%s\nwant\n%s", response, responseExpected)
+		}
+	}
+
+	f(nil, "# EOF\n")
+	newResult := func(name string, tags []storage.Tag, values []float64, timestamps []int64) netstorage.Result {
+		var rs netstorage.Result
+		rs.MetricName.MetricGroup = []byte(name)
+		rs.MetricName.Tags = tags
+		rs.Values = values
+		rs.Timestamps = timestamps
+		return rs
+	}
+	f([]netstorage.Result{
+		newResult("bar", nil, []float64{3}, []int64{-1500}),
+		newResult("foo", []storage.Tag{{Key: []byte("a"), Value: []byte("x\"y\\z\n<>")}}, []float64{math.Inf(1), math.NaN()}, []int64{1000, 2001}),
+		newResult("foo", nil, []float64{2}, []int64{1234567890123}),
+		newResult("foo_bar", nil, []float64{1.5}, []int64{1000}),
+	}, `bar 3 -1.5
+foo{a="x\"y\\z\n<>"} +Inf 1
+foo{a="x\"y\\z\n<>"} NaN 2.001
+foo 2 1234567890.123
+foo_bar 1.5 1
+# EOF
+`)
+
+	// Time series with names outside OpenMetrics charset must be skipped.
+	f([]netstorage.Result{
+		newResult("", []storage.Tag{{Key: []byte("a"), Value: []byte("b")}}, []float64{1}, []int64{1000}),
+		newResult("foo.bar", nil, []float64{1}, []int64{1000}),
+		newResult("foo:bar", []storage.Tag{{Key: []byte("a-b"), Value: []byte("c")}}, []float64{1}, []int64{1000}),
+		newResult("foo:bar", []storage.Tag{{Key: []byte("a_1"), Value: []byte("c")}}, []float64{2}, []int64{1000}),
+	}, `foo:bar{a_1="c"} 2 1
+# EOF
+`)
+}
+
+func TestIsValidOpenMetricsName(t *testing.T) {
+	f := func(s string, isMetricName, resultExpected bool) {
+		t.Helper()
+		result := isValidOpenMetricsName([]byte(s), isMetricName)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for isValidOpenMetricsName(%q, %v); got %v; want %v", s, isMetricName, result, resultExpected)
+		}
+	}
+	f("", true, false)
+	f("", false, false)
+	f("foo", true, true)
+	f("foo", false, true)
+	f("_Foo_09", true, true)
+	f("foo:bar", true, true)
+	f(":foo", true, true)
+	f("foo:bar", false, false)
+	f("0foo", true, false)
+	f("0foo", false, false)
+	f("foo-bar", true, false)
+	f("foo.bar", false, false)
+	f("фу", true, false)
+}
+
+func TestIsOpenMetricsRequested(t *testing.T) {
+	f := func(url, accept string, resultExpected bool) {
+		t.Helper()
+		r, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		result := isOpenMetricsRequested(r)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for url=%q, accept=%q; got %v; want %v", url, accept, result, resultExpected)
+		}
+	}
+	f("http://foo/federate", "", false)
+	f("http://foo/federate?format=openmetrics", "", true)
+	f("http://foo/federate?format=prometheus", "", false)
+
+	// Prometheus sends this header by default, while it expects Prometheus text exposition format from /federate.
+	f("http://foo/federate", "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", false)
+}
+
+func TestLabelValueSuggestionsResponse(t *testing.T) {
+	f := func(tvss []storage.TagValueSuggestion, responseExpected string) {
+		t.Helper()
+		sortTagValueSuggestions(tvss)
+		response := LabelValueSuggestionsResponse(tvss)
+		if response != responseExpected {
+			t.Fatalf("unexpected response; got\n%s\nwant\n%s", response, responseExpected)
+		}
+	}
+
+	f(nil, `{"status":"success","data":[]}`)
+	f([]storage.TagValueSuggestion{
+		{Value: "foo", SeriesCount: 2},
+		{Value: "bar", SeriesCount: 10},
+		{Value: "baz", SeriesCount: 2},
+	}, `{"status":"success","data":[{"value":"bar","seriesCount":10},{"value":"baz","seriesCount":2},{"value":"foo","seriesCount":2}]}`)
+}
+
+func TestMatchLabelValueSuggestion(t *testing.T) {
+	f := func(labelValue, query string, substring, resultExpected bool) {
+		t.Helper()
+		result := matchLabelValueSuggestion(labelValue, query, strings.ToLower(query), substring)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for labelValue=%q, query=%q, substring=%v; got %v; want %v", labelValue, query, substring, result, resultExpected)
+		}
+	}
+
+	f("foobar", "", false, true)
+	f("foobar", "foo", false, true)
+	f("foobar", "bar", false, false)
+	f("foobar", "Foo", false, false)
+	f("foobar", "bar", true, true)
+	f("fooBar", "oba", true, true)
+	f("foobar", "baz", true, false)
+}
+
+func TestDeleteSeriesDryRunResponse(t *testing.T) {
+	f := func(seriesCount int, mns []storage.MetricName, responseExpected string) {
+		t.Helper()
+		response := DeleteSeriesDryRunResponse(seriesCount, mns)
+		if response != responseExpected {
+			t.Fatalf("unexpected response; got\n%s\nwant\n%s", response, responseExpected)
+		}
+	}
+
+	f(0, nil, `{"status":"success","data":{"seriesCount":0,"sample":[]}}`)
+	f(123, []storage.MetricName{
+		{
+			MetricGroup: []byte("foo"),
+			Tags: []storage.Tag{
+				{Key: []byte("job"), Value: []byte("bar")},
+			},
+		},
+		{
+			MetricGroup: []byte("baz"),
+		},
+	}, `{"status":"success","data":{"seriesCount":123,"sample":[{"__name__":"foo","job":"bar"},{"__name__":"baz"}]}}`)
+}
+
 func TestAdjustLastPoints(t *testing.T) {
 	f := func(tss []netstorage.Result, start, end int64, tssExpected []netstorage.Result) {
 		t.Helper()
@@ -268,3 +511,185 @@ func TestAdjustLastPoints(t *testing.T) {
 		},
 	})
 }
+
+func TestAddResultLabels(t *testing.T) {
+	resultLabelsOrig := resultLabels
+	defer func() {
+		resultLabels = resultLabelsOrig
+	}()
+	resultLabels = []prompbmarshal.Label{
+		{
+			Name:  "cluster",
+			Value: "eu1",
+		},
+		{
+			Name:  "dc",
+			Value: "dc1",
+		},
+	}
+	f := func(mn *storage.MetricName, resultExpected string) {
+		t.Helper()
+		addResultLabels(mn)
+		if result := mn.String(); result != resultExpected {
+			t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(&storage.MetricName{}, `MetricGroup="", tags=["dc"="dc1", "cluster"="eu1"]`)
+	f(&storage.MetricName{
+		MetricGroup: []byte("foo"),
+		Tags: []storage.Tag{
+			{
+				Key:   []byte("cluster"),
+				Value: []byte("us1"),
+			},
+		},
+	}, `MetricGroup="foo", tags=["dc"="dc1", "cluster"="us1"]`)
+}
+
+func TestSetQueryStatsHeaders(t *testing.T) {
+	f := func(qs *promql.QueryStats, headersExpected map[string]string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		setQueryStatsHeaders(w, qs)
+		for k, vExpected := range headersExpected {
+			if v := w.Header().Get(k); v != vExpected {
+				t.Fatalf("unexpected %s header value; got %q; want %q", k, v, vExpected)
+			}
+		}
+	}
+	f(&promql.QueryStats{}, map[string]string{
+		"X-VM-Series-Fetched":  "0",
+		"X-VM-Samples-Scanned": "0",
+		"X-VM-Blocks-Read":     "0",
+		"X-VM-Cache-Hit":       "false",
+	})
+	f(&promql.QueryStats{
+		SeriesFetched:  12,
+		SamplesScanned: 3456,
+		BlocksRead:     78,
+		CacheHits:      2,
+	}, map[string]string{
+		"X-VM-Series-Fetched":  "12",
+		"X-VM-Samples-Scanned": "3456",
+		"X-VM-Blocks-Read":     "78",
+		"X-VM-Cache-Hit":       "true",
+	})
+}
+
+func TestSetEffectiveRangeHeaders(t *testing.T) {
+	f := func(start, end int64, startExpected, endExpected string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		setEffectiveRangeHeaders(w, start, end)
+		if v := w.Header().Get("X-VM-Effective-Start"); v != startExpected {
+			t.Fatalf("unexpected X-VM-Effective-Start header value; got %q; want %q", v, startExpected)
+		}
+		if v := w.Header().Get("X-VM-Effective-End"); v != endExpected {
+			t.Fatalf("unexpected X-VM-Effective-End header value; got %q; want %q", v, endExpected)
+		}
+	}
+	f(0, 0, "0", "0")
+	f(1600000000000, 1600003600000, "1600000000", "1600003600")
+	f(1600000000123, 1600003600500, "1600000000.123", "1600003600.5")
+
+	// Aligned range
+	start, end := promql.AlignStartEnd(1600000012345, 1600003612345, 60000)
+	f(start, end, "1599999960", "1600003620")
+}
+
+func TestWriteExportChunk(t *testing.T) {
+	// Every bucket contains a row per second.
+	writeBucket := func(w io.Writer, start, end int64) (int, error) {
+		fmt.Fprintf(w, "[%d..%d]", start, end)
+		return int(end-start+1) / 1000, nil
+	}
+	firstTimestamp := func(start, end int64) (int64, bool, error) {
+		return start, true, nil
+	}
+	f := func(query string, resultExpected, cursorExpected string) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/api/v1/export?"+query, nil)
+		w := httptest.NewRecorder()
+		if err := writeExportChunk(w, r, 0, 10000-1, 3, "text/plain", nil, firstTimestamp, writeBucket); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := w.Body.String(); result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+		resp := w.Result()
+		if trailer := resp.Header.Get("Trailer"); trailer != "X-VM-Export-Cursor" {
+			t.Fatalf("unexpected Trailer header; got %q; want %q", trailer, "X-VM-Export-Cursor")
+		}
+		if cursor := resp.Trailer.Get("X-VM-Export-Cursor"); cursor != cursorExpected {
+			t.Fatalf("unexpected cursor; got %q; want %q", cursor, cursorExpected)
+		}
+	}
+	f("chunk_duration=2s", "[0..1999][2000..3999]", "4000")
+	f("chunk_duration=2s&cursor=4000", "[4000..5999][6000..7999]", "8000")
+	f("chunk_duration=2s&cursor=8000", "[8000..9999]", "")
+	f("chunk_duration=5s&cursor=3000", "[3000..4999][5000..9999]", "")
+	f("chunk_duration=1h", "[0..9999]", "")
+
+	// Invalid cursor
+	r := httptest.NewRequest("GET", "/api/v1/export?cursor=foo", nil)
+	if err := writeExportChunk(httptest.NewRecorder(), r, 0, 10000, 3, "text/plain", nil, firstTimestamp, writeBucket); err == nil {
+		t.Fatalf("expecting non-nil error for invalid cursor")
+	}
+	r = httptest.NewRequest("GET", "/api/v1/export?cursor=20000", nil)
+	if err := writeExportChunk(httptest.NewRecorder(), r, 0, 10000, 3, "text/plain", nil, firstTimestamp, writeBucket); err == nil {
+		t.Fatalf("expecting non-nil error for cursor outside the time range")
+	}
+}
+
+func TestWriteExportChunkSparseData(t *testing.T) {
+	// Rows exist only at the given timestamps.
+	dataTimestamps := []int64{5e3, 5e3 + 500, 36e5 * 24 * 365 * 50, 36e5*24*365*50 + 1e3}
+	var bucketsCount, seeksCount int
+	writeBucket := func(w io.Writer, start, end int64) (int, error) {
+		bucketsCount++
+		n := 0
+		for _, ts := range dataTimestamps {
+			if ts >= start && ts <= end {
+				n++
+			}
+		}
+		fmt.Fprintf(w, "[%d..%d:%d]", start, end, n)
+		return n, nil
+	}
+	firstTimestamp := func(start, end int64) (int64, bool, error) {
+		seeksCount++
+		for _, ts := range dataTimestamps {
+			if ts >= start && ts <= end {
+				return ts, true, nil
+			}
+		}
+		return 0, false, nil
+	}
+	f := func(query string, maxRowsPerChunk int, resultExpected, cursorExpected string) {
+		t.Helper()
+		bucketsCount = 0
+		seeksCount = 0
+		r := httptest.NewRequest("GET", "/api/v1/export?"+query, nil)
+		w := httptest.NewRecorder()
+		if err := writeExportChunk(w, r, 0, 36e5*24*365*100, maxRowsPerChunk, "text/plain", nil, firstTimestamp, writeBucket); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := w.Body.String(); result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+		if cursor := w.Result().Trailer.Get("X-VM-Export-Cursor"); cursor != cursorExpected {
+			t.Fatalf("unexpected cursor; got %q; want %q", cursor, cursorExpected)
+		}
+		// Empty buckets mustn't be queried one by one.
+		if bucketsCount > 5 || seeksCount > 100 {
+			t.Fatalf("too many queries; buckets: %d, seeks: %d", bucketsCount, seeksCount)
+		}
+	}
+	f("chunk_duration=1s", 1, "[5000..5999:2]", "6000")
+	f("chunk_duration=1s&cursor=6000", 1, "[1576800000000..1576800000999:1]", "1576800001000")
+	f("chunk_duration=1s&cursor=1576800001000", 1, "[1576800001000..1576800001999:1]", "1576800002000")
+	f("chunk_duration=1s&cursor=1576800002000", 1, "", "")
+
+	// Time ranges without data are skipped after the first empty bucket.
+	f("chunk_duration=1s", 10, "[5000..5999:2][6000..6999:0][1576800000000..1576800000999:1][1576800001000..1576800001999:1][1576800002000..1576800002999:0]", "")
+}
@@ -0,0 +1,54 @@
+package prometheus
+
+import (
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+var unparsedResultLabels = flagutil.NewArray("search.resultLabel", "Optional label in the form 'name=value' to add to every time series returned from /api/v1/query and /api/v1/query_range. "+
+	"The label isn't added if the time series already contains a label with the same name. This may be useful for distinguishing data sources in global dashboards. "+
+	"Pass multiple -search.resultLabel flags in order to add multiple labels")
+
+var resultLabels []prompbmarshal.Label
+
+// InitResultLabels must be called after parsing command-line flags.
+func InitResultLabels() {
+	resultLabels = nil
+	for _, s := range *unparsedResultLabels {
+		n := strings.IndexByte(s, '=')
+		if n <= 0 {
+			logger.Fatalf("missing label name in `-search.resultLabel`. It must contain label in the form `name=value`; got %q", s)
+		}
+		if s[:n] == "__name__" {
+			logger.Fatalf("`-search.resultLabel` cannot override metric names; got %q", s)
+		}
+		resultLabels = append(resultLabels, prompbmarshal.Label{
+			Name:  s[:n],
+			Value: s[n+1:],
+		})
+	}
+}
+
+// addResultLabels adds labels from -search.resultLabel to mn if they are missing in mn.
+func addResultLabels(mn *storage.MetricName) {
+	for _, label := range resultLabels {
+		if len(mn.GetTagValue(label.Name)) > 0 {
+			continue
+		}
+		mn.AddTag(label.Name, label.Value)
+	}
+}
+
+func addResultLabelsToResults(rs []netstorage.Result) {
+	if len(resultLabels) == 0 {
+		return
+	}
+	for i := range rs {
+		addResultLabels(&rs[i].MetricName)
+	}
+}
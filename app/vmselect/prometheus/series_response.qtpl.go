@@ -25,7 +25,7 @@ var (
 )
 
 //line app/vmselect/prometheus/series_response.qtpl:8
-func StreamSeriesResponse(qw422016 *qt422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
+func StreamSeriesResponse(qw422016 *qt422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer, nextPageToken string) {
 //line app/vmselect/prometheus/series_response.qtpl:8
 	qw422016.N().S(`{"status":"success","data":[`)
 //line app/vmselect/prometheus/series_response.qtpl:12
@@ -52,32 +52,42 @@ func StreamSeriesResponse(qw422016 *qt422016.Writer, resultsCh <-chan *quicktemp
 //line app/vmselect/prometheus/series_response.qtpl:20
 	}
 //line app/vmselect/prometheus/series_response.qtpl:20
-	qw422016.N().S(`]}`)
+	qw422016.N().S(`]`)
+//line app/vmselect/prometheus/series_response.qtpl:22
+	if nextPageToken != "" {
+//line app/vmselect/prometheus/series_response.qtpl:22
+		qw422016.N().S(`,"nextPageToken":`)
 //line app/vmselect/prometheus/series_response.qtpl:23
+		qw422016.N().Q(nextPageToken)
+//line app/vmselect/prometheus/series_response.qtpl:24
+	}
+//line app/vmselect/prometheus/series_response.qtpl:24
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/series_response.qtpl:26
 }
 
-//line app/vmselect/prometheus/series_response.qtpl:23
-func WriteSeriesResponse(qq422016 qtio422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
-//line app/vmselect/prometheus/series_response.qtpl:23
+//line app/vmselect/prometheus/series_response.qtpl:26
+func WriteSeriesResponse(qq422016 qtio422016.Writer, resultsCh <-chan *quicktemplate.ByteBuffer, nextPageToken string) {
+//line app/vmselect/prometheus/series_response.qtpl:26
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/series_response.qtpl:23
-	StreamSeriesResponse(qw422016, resultsCh)
-//line app/vmselect/prometheus/series_response.qtpl:23
+//line app/vmselect/prometheus/series_response.qtpl:26
+	StreamSeriesResponse(qw422016, resultsCh, nextPageToken)
+//line app/vmselect/prometheus/series_response.qtpl:26
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/series_response.qtpl:23
+//line app/vmselect/prometheus/series_response.qtpl:26
 }
 
-//line app/vmselect/prometheus/series_response.qtpl:23
-func SeriesResponse(resultsCh <-chan *quicktemplate.ByteBuffer) string {
-//line app/vmselect/prometheus/series_response.qtpl:23
+//line app/vmselect/prometheus/series_response.qtpl:26
+func SeriesResponse(resultsCh <-chan *quicktemplate.ByteBuffer, nextPageToken string) string {
+//line app/vmselect/prometheus/series_response.qtpl:26
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/series_response.qtpl:23
-	WriteSeriesResponse(qb422016, resultsCh)
-//line app/vmselect/prometheus/series_response.qtpl:23
+//line app/vmselect/prometheus/series_response.qtpl:26
+	WriteSeriesResponse(qb422016, resultsCh, nextPageToken)
+//line app/vmselect/prometheus/series_response.qtpl:26
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/series_response.qtpl:23
+//line app/vmselect/prometheus/series_response.qtpl:26
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/series_response.qtpl:23
+//line app/vmselect/prometheus/series_response.qtpl:26
 	return qs422016
-//line app/vmselect/prometheus/series_response.qtpl:23
+//line app/vmselect/prometheus/series_response.qtpl:26
 }
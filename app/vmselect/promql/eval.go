@@ -5,20 +5,24 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/VictoriaMetrics/metricsql"
 )
 
 var (
 	disableCache           = flag.Bool("search.disableCache", false, "Whether to disable response caching. This may be useful during data backfilling")
-	maxPointsPerTimeseries = flag.Int("search.maxPointsPerTimeseries", 30e3, "The maximum points per a single timeseries returned from the search")
+	maxPointsPerTimeseries = flagutil.NewReloadableInt("search.maxPointsPerTimeseries", 30e3, "The maximum points per a single timeseries returned from the search")
 )
 
 // The minimum number of points per timeseries for enabling time rounding.
@@ -32,9 +36,12 @@ const minTimeseriesPointsForTimeRounding = 50
 // The number mustn't exceed -search.maxPointsPerTimeseries.
 func ValidateMaxPointsPerTimeseries(start, end, step int64) error {
 	points := (end-start)/step + 1
-	if uint64(points) > uint64(*maxPointsPerTimeseries) {
-		return fmt.Errorf(`too many points for the given step=%d, start=%d and end=%d: %d; cannot exceed -search.maxPointsPerTimeseries=%d`,
-			step, start, end, uint64(points), *maxPointsPerTimeseries)
+	maxPoints := maxPointsPerTimeseries.Get()
+	if uint64(points) > uint64(maxPoints) {
+		return &netstorage.LimitExceededError{
+			Err: fmt.Errorf(`too many points for the given step=%d, start=%d and end=%d: %d; cannot exceed -search.maxPointsPerTimeseries=%d`,
+				step, start, end, uint64(points), maxPoints),
+		}
 	}
 	return nil
 }
@@ -68,6 +75,13 @@ func AdjustStartEnd(start, end, step int64) (int64, int64) {
 	return start, end
 }
 
+// AlignStartEnd aligns start and end to step boundaries regardless of the number of points.
+//
+// This allows serving repeated dashboard queries with raw "now" timestamps from the response cache.
+func AlignStartEnd(start, end, step int64) (int64, int64) {
+	return alignStartEnd(start, end, step)
+}
+
 func alignStartEnd(start, end, step int64) (int64, int64) {
 	// Round start to the nearest smaller value divisible by step.
 	start -= start % step
@@ -95,6 +109,17 @@ type EvalConfig struct {
 	// LookbackDelta is analog to `-query.lookback-delta` from Prometheus.
 	LookbackDelta int64
 
+	// CounterResetJitterRatio is the maximum ratio for counter decrease, which isn't considered as counter reset.
+	//
+	// Such decreases are usually caused by jitter between Prometheus HA pairs or by non-monotonic counters from exporters.
+	CounterResetJitterRatio float64
+
+	// Span is the tracing span for the query. It may be nil if the query isn't traced.
+	Span *tracing.Span
+
+	// QueryStats collects statistics for the query. It may be nil.
+	QueryStats *QueryStats
+
 	timestamps     []int64
 	timestampsOnce sync.Once
 }
@@ -108,6 +133,9 @@ func newEvalConfig(src *EvalConfig) *EvalConfig {
 	ec.Deadline = src.Deadline
 	ec.MayCache = src.MayCache
 	ec.LookbackDelta = src.LookbackDelta
+	ec.CounterResetJitterRatio = src.CounterResetJitterRatio
+	ec.Span = src.Span
+	ec.QueryStats = src.QueryStats
 
 	// do not copy src.timestamps - they must be generated again.
 	return &ec
@@ -265,6 +293,12 @@ func evalExpr(ec *EvalConfig, e metricsql.Expr) ([]*timeseries, error) {
 		if err != nil {
 			return nil, err
 		}
+		if len(left) == 0 && canSkipRightSide(be.Op) {
+			// `and` and `unless` always return empty result for empty left side,
+			// so there is no need in loading the right side from the storage.
+			// This is frequently the case for alerting rules such as `foo > 10 and bar`.
+			return nil, nil
+		}
 		right, err := evalExpr(ec, be.Right)
 		if err != nil {
 			return nil, err
@@ -288,6 +322,11 @@ func evalExpr(ec *EvalConfig, e metricsql.Expr) ([]*timeseries, error) {
 		rv := evalNumber(ec, ne.N)
 		return rv, nil
 	}
+	if de, ok := e.(*metricsql.DurationExpr); ok {
+		d := de.Duration(ec.Step)
+		rv := evalNumber(ec, float64(d)/1e3)
+		return rv, nil
+	}
 	if se, ok := e.(*metricsql.StringExpr); ok {
 		rv := evalString(ec, se.S)
 		return rv, nil
@@ -295,6 +334,29 @@ func evalExpr(ec *EvalConfig, e metricsql.Expr) ([]*timeseries, error) {
 	return nil, fmt.Errorf("unexpected expression %q", e.AppendString(nil))
 }
 
+func canSkipRightSide(op string) bool {
+	switch strings.ToLower(op) {
+	case "and", "unless":
+		return true
+	default:
+		return false
+	}
+}
+
+func setSearchSpanAttributes(span *tracing.Span, me *metricsql.MetricExpr, rss *netstorage.Results) {
+	if span == nil {
+		// Fast path - the query isn't traced.
+		return
+	}
+	ps := rss.PruneStats()
+	span.SetAttribute("series_selector", string(me.AppendString(nil)))
+	span.SetAttribute("series_found", strconv.Itoa(rss.Len()))
+	span.SetAttribute("partitions_searched", strconv.Itoa(ps.PartitionsSearched))
+	span.SetAttribute("partitions_skipped", strconv.Itoa(ps.PartitionsSkipped))
+	span.SetAttribute("parts_searched", strconv.Itoa(ps.PartsSearched))
+	span.SetAttribute("parts_skipped", strconv.Itoa(ps.PartsSkipped))
+}
+
 func tryGetArgRollupFuncWithMetricExpr(ae *metricsql.AggrFuncExpr) (*metricsql.FuncExpr, newRollupFunc) {
 	if len(ae.Args) != 1 {
 		return nil, nil
@@ -427,6 +489,45 @@ func getRollupExprArg(arg metricsql.Expr) *metricsql.RollupExpr {
 }
 
 func evalRollupFunc(ec *EvalConfig, name string, rf rollupFunc, expr metricsql.Expr, re *metricsql.RollupExpr, iafc *incrementalAggrFuncContext) ([]*timeseries, error) {
+	if re.At == nil {
+		return evalRollupFuncWithoutAt(ec, name, rf, expr, re, iafc)
+	}
+	tssAt, err := evalExpr(ec, re.At)
+	if err != nil {
+		return nil, fmt.Errorf("cannot evaluate `@` modifier: %w", err)
+	}
+	if len(tssAt) != 1 {
+		return nil, fmt.Errorf("`@` modifier must return a single series; it returns %d series instead", len(tssAt))
+	}
+	atSecs := tssAt[0].Values[0]
+	if math.IsNaN(atSecs) {
+		return nil, fmt.Errorf("`@` modifier must return a number; got NaN")
+	}
+	atTimestamp := int64(atSecs * 1e3)
+	ecNew := newEvalConfig(ec)
+	ecNew.Start = atTimestamp
+	ecNew.End = atTimestamp
+	// Do not cache results for a single point, since it is cheap to calculate them.
+	ecNew.MayCache = false
+	tss, err := evalRollupFuncWithoutAt(ecNew, name, rf, expr, re, iafc)
+	if err != nil {
+		return nil, err
+	}
+	// Expand single-point tss to the selected time range.
+	timestamps := ec.getSharedTimestamps()
+	for _, ts := range tss {
+		v := ts.Values[0]
+		values := make([]float64, len(timestamps))
+		for i := range values {
+			values[i] = v
+		}
+		ts.Values = values
+		ts.Timestamps = timestamps
+	}
+	return tss, nil
+}
+
+func evalRollupFuncWithoutAt(ec *EvalConfig, name string, rf rollupFunc, expr metricsql.Expr, re *metricsql.RollupExpr, iafc *incrementalAggrFuncContext) ([]*timeseries, error) {
 	ecNew := ec
 	var offset int64
 	if len(re.Offset) > 0 {
@@ -524,7 +625,7 @@ func evalRollupFuncWithSubquery(ec *EvalConfig, name string, rf rollupFunc, expr
 		return nil, nil
 	}
 	sharedTimestamps := getTimestamps(ec.Start, ec.End, ec.Step)
-	preFunc, rcs, err := getRollupConfigs(name, rf, expr, ec.Start, ec.End, ec.Step, window, ec.LookbackDelta, sharedTimestamps)
+	preFunc, rcs, err := getRollupConfigs(name, rf, expr, ec.Start, ec.End, ec.Step, window, ec.LookbackDelta, ec.CounterResetJitterRatio, sharedTimestamps)
 	if err != nil {
 		return nil, err
 	}
@@ -623,15 +724,20 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 		}
 	}
 
+	// Register the metric name as queried even if the result is fully cached.
+	metricUsageTrackerV.registerMetricExpr(me)
+
 	// Search for partial results in cache.
 	tssCached, start := rollupResultCacheV.Get(ec, expr, window)
 	if start > ec.End {
 		// The result is fully cached.
 		rollupResultCacheFullHits.Inc()
+		ec.QueryStats.addCacheHit()
 		return tssCached, nil
 	}
 	if start > ec.Start {
 		rollupResultCachePartialHits.Inc()
+		ec.QueryStats.addCacheHit()
 	} else {
 		rollupResultCacheMiss.Inc()
 	}
@@ -639,7 +745,7 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 	// Obtain rollup configs before fetching data from db,
 	// so type errors can be caught earlier.
 	sharedTimestamps := getTimestamps(start, ec.End, ec.Step)
-	preFunc, rcs, err := getRollupConfigs(name, rf, expr, start, ec.End, ec.Step, window, ec.LookbackDelta, sharedTimestamps)
+	preFunc, rcs, err := getRollupConfigs(name, rf, expr, start, ec.End, ec.Step, window, ec.LookbackDelta, ec.CounterResetJitterRatio, sharedTimestamps)
 	if err != nil {
 		return nil, err
 	}
@@ -657,11 +763,19 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 		MaxTimestamp: ec.End,
 		TagFilterss:  [][]storage.TagFilter{tfs},
 	}
+	span := ec.Span.StartChild("netstorage.ProcessSearchQuery")
 	rss, err := netstorage.ProcessSearchQuery(sq, true, ec.Deadline)
+	span.SetError(err)
+	if err == nil {
+		setSearchSpanAttributes(span, me, rss)
+	}
+	span.End()
 	if err != nil {
 		return nil, err
 	}
 	rssLen := rss.Len()
+	ec.QueryStats.addSeriesFetched(rssLen)
+	ec.QueryStats.addBlocksRead(rss.BlocksRead())
 	if rssLen == 0 {
 		rss.Cancel()
 		var tss []*timeseries
@@ -718,6 +832,7 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 	} else {
 		tss, err = evalRollupNoIncrementalAggregate(name, rss, rcs, preFunc, sharedTimestamps, removeMetricGroup)
 	}
+	ec.QueryStats.addSamplesScanned(rss.SamplesScanned())
 	if err != nil {
 		return nil, err
 	}
@@ -741,6 +856,7 @@ func getRollupMemoryLimiter() *memoryLimiter {
 func evalRollupWithIncrementalAggregate(name string, iafc *incrementalAggrFuncContext, rss *netstorage.Results, rcs []*rollupConfig,
 	preFunc func(values []float64, timestamps []int64), sharedTimestamps []int64, removeMetricGroup bool) ([]*timeseries, error) {
 	err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) {
+		metricUsageTrackerV.registerMetricName(rs.MetricName.MetricGroup)
 		preFunc(rs.Values, rs.Timestamps)
 		ts := getTimeseries()
 		defer putTimeseries(ts)
@@ -773,6 +889,7 @@ func evalRollupNoIncrementalAggregate(name string, rss *netstorage.Results, rcs
 	tss := make([]*timeseries, 0, rss.Len()*len(rcs))
 	var tssLock sync.Mutex
 	err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) {
+		metricUsageTrackerV.registerMetricName(rs.MetricName.MetricGroup)
 		preFunc(rs.Values, rs.Timestamps)
 		for _, rc := range rcs {
 			if tsm := newTimeseriesMap(name, sharedTimestamps, &rs.MetricName); tsm != nil {
@@ -22,6 +22,8 @@ func TestExecSuccess(t *testing.T) {
 			End:      end,
 			Step:     step,
 			Deadline: netstorage.NewDeadline(time.Now(), time.Minute, ""),
+
+			CounterResetJitterRatio: 0.125,
 		}
 		for i := 0; i < 5; i++ {
 			result, err := Exec(ec, q, false)
@@ -983,6 +985,94 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run(`label_uppercase`, func(t *testing.T) {
+		t.Parallel()
+		q := `label_uppercase(
+			label_set(time(), "foo", "bAr", "XXx", "yyy", "zzz", "abc"),
+			"foo", "XXx", "aaa"
+		)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1400, 1600, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{
+			{
+				Key:   []byte("XXx"),
+				Value: []byte("YYY"),
+			},
+			{
+				Key:   []byte("foo"),
+				Value: []byte("BAR"),
+			},
+			{
+				Key:   []byte("zzz"),
+				Value: []byte("abc"),
+			},
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`label_lowercase`, func(t *testing.T) {
+		t.Parallel()
+		q := `label_lowercase(
+			label_set(time(), "foo", "bAr", "XXx", "yyy", "zzz", "aBc"),
+			"foo", "XXx", "aaa"
+		)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1400, 1600, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{
+			{
+				Key:   []byte("XXx"),
+				Value: []byte("yyy"),
+			},
+			{
+				Key:   []byte("foo"),
+				Value: []byte("bar"),
+			},
+			{
+				Key:   []byte("zzz"),
+				Value: []byte("aBc"),
+			},
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`label_graphite_group`, func(t *testing.T) {
+		t.Parallel()
+		q := `sort(label_graphite_group((
+			alias(1, "foo.bar.baz"),
+			alias(2, "abc"),
+			label_set(alias(3, "a.xx.zz.asd"), "qwe", "rty"),
+		), 1, 3))`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.MetricGroup = []byte("bar.")
+		r2 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{2, 2, 2, 2, 2, 2},
+			Timestamps: timestampsExpected,
+		}
+		r2.MetricName.MetricGroup = []byte(".")
+		r3 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{3, 3, 3, 3, 3, 3},
+			Timestamps: timestampsExpected,
+		}
+		r3.MetricName.MetricGroup = []byte("xx.asd")
+		r3.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("qwe"),
+			Value: []byte("rty"),
+		}}
+		resultExpected := []netstorage.Result{r1, r2, r3}
+		f(q, resultExpected)
+	})
 	t.Run(`label_map(match)`, func(t *testing.T) {
 		t.Parallel()
 		q := `sort(label_map((
@@ -1918,6 +2008,19 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run(`empty and failing`, func(t *testing.T) {
+		t.Parallel()
+		// The right side mustn't be evaluated for empty left side.
+		q := `time() > 1e10 and sum_over_time(time()[200s:100s] @ NaN)`
+		resultExpected := []netstorage.Result{}
+		f(q, resultExpected)
+	})
+	t.Run(`empty unless failing`, func(t *testing.T) {
+		t.Parallel()
+		q := `time() > 1e10 unless sum_over_time(time()[200s:100s] @ NaN)`
+		resultExpected := []netstorage.Result{}
+		f(q, resultExpected)
+	})
 	t.Run(`scalar or scalar`, func(t *testing.T) {
 		t.Parallel()
 		q := `time() > 1400 or 123`
@@ -3278,6 +3381,25 @@ func TestExecSuccess(t *testing.T) {
 		resultsExpected := []netstorage.Result{r1}
 		f(q, resultsExpected)
 	})
+	t.Run(`histogram_quantile(vmrange)`, func(t *testing.T) {
+		t.Parallel()
+		q := `histogram_quantile(0.5, (
+			label_set(10, "foo", "bar", "vmrange", "0...1"),
+			label_set(20, "foo", "bar", "vmrange", "1...2"),
+			label_set(10, "foo", "bar", "vmrange", "2...4"),
+		))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1.5, 1.5, 1.5, 1.5, 1.5, 1.5},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("foo"),
+			Value: []byte("bar"),
+		}}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run(`prometheus_buckets(valid)`, func(t *testing.T) {
 		t.Parallel()
 		q := `sort(prometheus_buckets((
@@ -3997,6 +4119,28 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run(`count_eq_over_time`, func(t *testing.T) {
+		t.Parallel()
+		q := `count_eq_over_time(round(rand(0), 0.1)[200s:10s], 0.7)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 0, 1, 2, 3, 3},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`mad_over_time`, func(t *testing.T) {
+		t.Parallel()
+		q := `mad_over_time(time()[200s:10s])`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{50, 50, 50, 50, 50, 50},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run(`count_le_over_time`, func(t *testing.T) {
 		t.Parallel()
 		q := `count_le_over_time(rand(0)[200s:10s], 0.7)`
@@ -5482,6 +5626,83 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run(`@ number`, func(t *testing.T) {
+		t.Parallel()
+		q := `sum_over_time(time()[200s:100s] @ 1500)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{2900, 2900, 2900, 2900, 2900, 2900},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`@ start()`, func(t *testing.T) {
+		t.Parallel()
+		q := `sum_over_time(time()[200s:100s] @ start())`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1900, 1900, 1900, 1900, 1900, 1900},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`@ end() offset`, func(t *testing.T) {
+		t.Parallel()
+		q := `sum_over_time(time()[200s:100s] offset 100s @ end())`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{3700, 3700, 3700, 3700, 3700, 3700},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`duration-number`, func(t *testing.T) {
+		t.Parallel()
+		q := `time() / 1m + 2*1h`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{7216.666666666667, 7220, 7223.333333333333, 7226.666666666667, 7230, 7233.333333333333},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`duration-step`, func(t *testing.T) {
+		t.Parallel()
+		q := `step() + 2i`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{600, 600, 600, 600, 600, 600},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`$__interval`, func(t *testing.T) {
+		t.Parallel()
+		q := `sum_over_time(time()[$__interval:100s]) * $__interval`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{380000, 460000, 540000, 620000, 700000, 780000},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`duration-cmp`, func(t *testing.T) {
+		t.Parallel()
+		q := `30m < time()`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{nan, nan, nan, nan, nan, 2000},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run(`lag()`, func(t *testing.T) {
 		t.Parallel()
 		q := `lag(time()[60s:17s])`
@@ -6032,6 +6253,17 @@ func TestExecError(t *testing.T) {
 	f(`share_gt_over_time()`)
 	f(`count_le_over_time()`)
 	f(`count_gt_over_time()`)
+	f(`count_eq_over_time()`)
+	f(`foo @ bar @ baz`)
+	f(`foo @`)
+	f(`sum_over_time(time()[200s:100s] @ NaN)`)
+	f(`time() > 1e10 or sum_over_time(time()[200s:100s] @ NaN)`)
+	f(`sum_over_time(time()[200s:100s] @ (alias(1, "foo"), alias(2, "bar")))`)
+	f(`label_uppercase()`)
+	f(`label_lowercase()`)
+	f(`label_graphite_group()`)
+	f(`label_graphite_group(1, "foo")`)
+	f(`mad_over_time()`)
 
 	// Invalid argument type
 	f(`median_over_time({}, 2)`)
@@ -0,0 +1,141 @@
+package promql
+
+import (
+	"flag"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+var metricUsageWindow = flag.Duration("search.metricUsageWindow", 30*24*time.Hour, "The duration for tracking metric names referenced by queries. "+
+	"Metric names, which weren't queried during this duration, are reported as unused at /api/v1/status/metric_usage page. "+
+	"Metric names usage tracking is disabled if zero value is passed")
+
+// MetricUsage contains usage stats for a metric name.
+type MetricUsage struct {
+	// Name is the metric name.
+	Name string
+
+	// LastQueryTime is the last time in unix seconds when the metric has been queried.
+	//
+	// It is set to zero if the metric hasn't been queried during the tracking window.
+	LastQueryTime uint64
+}
+
+// GetMetricUsage returns usage stats for the given metricNames.
+//
+// It also returns the start time in unix seconds for the tracked usage stats.
+// The returned stats are sorted by LastQueryTime, so unused metrics go first.
+func GetMetricUsage(metricNames []string) ([]MetricUsage, uint64) {
+	mus := make([]MetricUsage, len(metricNames))
+	for i, name := range metricNames {
+		mus[i] = MetricUsage{
+			Name:          name,
+			LastQueryTime: metricUsageTrackerV.getLastQueryTime(name),
+		}
+	}
+	sort.Slice(mus, func(i, j int) bool {
+		if mus[i].LastQueryTime != mus[j].LastQueryTime {
+			return mus[i].LastQueryTime < mus[j].LastQueryTime
+		}
+		return mus[i].Name < mus[j].Name
+	})
+	return mus, metricUsageTrackerV.getStartTime()
+}
+
+var metricUsageTrackerV = newMetricUsageTracker()
+
+// metricUsageTracker tracks the last query time for metric names.
+//
+// The tracked data is kept in memory, so it is lost on restart.
+type metricUsageTracker struct {
+	startTime uint64
+
+	mu sync.RWMutex
+	m  map[string]*uint64
+}
+
+func newMetricUsageTracker() *metricUsageTracker {
+	mut := &metricUsageTracker{
+		startTime: fasttime.UnixTimestamp(),
+		m:         make(map[string]*uint64),
+	}
+	go mut.cleaner()
+	return mut
+}
+
+func (mut *metricUsageTracker) cleaner() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		mut.cleanExpired()
+	}
+}
+
+func (mut *metricUsageTracker) cleanExpired() {
+	window := uint64(metricUsageWindow.Seconds())
+	currentTime := fasttime.UnixTimestamp()
+	mut.mu.Lock()
+	for name, pt := range mut.m {
+		if currentTime-atomic.LoadUint64(pt) > window {
+			delete(mut.m, name)
+		}
+	}
+	mut.mu.Unlock()
+}
+
+// getStartTime returns the start time for the tracked usage stats.
+func (mut *metricUsageTracker) getStartTime() uint64 {
+	currentTime := fasttime.UnixTimestamp()
+	window := uint64(metricUsageWindow.Seconds())
+	if currentTime-mut.startTime > window {
+		return currentTime - window
+	}
+	return mut.startTime
+}
+
+// registerMetricName registers the given metric name as queried.
+func (mut *metricUsageTracker) registerMetricName(name []byte) {
+	if *metricUsageWindow <= 0 || len(name) == 0 {
+		return
+	}
+	currentTime := fasttime.UnixTimestamp()
+	mut.mu.RLock()
+	pt := mut.m[string(name)]
+	mut.mu.RUnlock()
+	if pt != nil {
+		if atomic.LoadUint64(pt) != currentTime {
+			atomic.StoreUint64(pt, currentTime)
+		}
+		return
+	}
+
+	mut.mu.Lock()
+	if mut.m[string(name)] == nil {
+		mut.m[string(name)] = &currentTime
+	}
+	mut.mu.Unlock()
+}
+
+// registerMetricExpr registers metric name from me as queried if me contains exact metric name filter.
+func (mut *metricUsageTracker) registerMetricExpr(me *metricsql.MetricExpr) {
+	for _, lf := range me.LabelFilters {
+		if lf.Label == "__name__" && !lf.IsRegexp && !lf.IsNegative {
+			mut.registerMetricName([]byte(lf.Value))
+		}
+	}
+}
+
+func (mut *metricUsageTracker) getLastQueryTime(name string) uint64 {
+	mut.mu.RLock()
+	pt := mut.m[name]
+	mut.mu.RUnlock()
+	if pt == nil {
+		return 0
+	}
+	return atomic.LoadUint64(pt)
+}
@@ -0,0 +1,65 @@
+package promql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+func TestMetricUsageTracker(t *testing.T) {
+	mut := &metricUsageTracker{
+		startTime: fasttime.UnixTimestamp(),
+		m:         make(map[string]*uint64),
+	}
+	mut.registerMetricName([]byte("foo"))
+	e, err := metricsql.Parse(`{__name__="bar", __name__=~"x.+", job="a"}`)
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+	mut.registerMetricExpr(e.(*metricsql.MetricExpr))
+
+	for _, name := range []string{"foo", "bar"} {
+		if mut.getLastQueryTime(name) == 0 {
+			t.Fatalf("expecting non-zero last query time for %q", name)
+		}
+	}
+	for _, name := range []string{"baz", "x.+"} {
+		if n := mut.getLastQueryTime(name); n != 0 {
+			t.Fatalf("unexpected last query time for %q; got %d; want 0", name, n)
+		}
+	}
+
+	// Entries within the tracking window mustn't be removed.
+	mut.cleanExpired()
+	if mut.getLastQueryTime("foo") == 0 {
+		t.Fatalf("the entry for foo mustn't be removed")
+	}
+
+	// Entries outside the tracking window must be removed.
+	*mut.m["foo"] -= uint64(metricUsageWindow.Seconds()) + 1
+	mut.cleanExpired()
+	if n := mut.getLastQueryTime("foo"); n != 0 {
+		t.Fatalf("the entry for foo must be removed; got last query time %d", n)
+	}
+}
+
+func TestGetMetricUsage(t *testing.T) {
+	metricUsageTrackerV.registerMetricName([]byte("TestGetMetricUsage_used"))
+	mus, startTime := GetMetricUsage([]string{"TestGetMetricUsage_used", "TestGetMetricUsage_unused_b", "TestGetMetricUsage_unused_a"})
+	if startTime == 0 {
+		t.Fatalf("expecting non-zero tracking start time")
+	}
+	var names []string
+	for _, mu := range mus {
+		names = append(names, mu.Name)
+	}
+	namesExpected := []string{"TestGetMetricUsage_unused_a", "TestGetMetricUsage_unused_b", "TestGetMetricUsage_used"}
+	if !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected metric names order; got %q; want %q", names, namesExpected)
+	}
+	if mus[2].LastQueryTime == 0 {
+		t.Fatalf("expecting non-zero last query time for the used metric")
+	}
+}
@@ -16,7 +16,7 @@ func IsRollup(s string) (childQuery string, window, step, offset string) {
 		return
 	}
 	re, ok := expr.(*metricsql.RollupExpr)
-	if !ok || len(re.Window) == 0 {
+	if !ok || len(re.Window) == 0 || re.At != nil {
 		return
 	}
 	wrappedQuery := re.Expr.AppendString(nil)
@@ -33,7 +33,7 @@ func IsMetricSelectorWithRollup(s string) (childQuery string, window, offset str
 		return
 	}
 	re, ok := expr.(*metricsql.RollupExpr)
-	if !ok || len(re.Window) == 0 || len(re.Step) > 0 {
+	if !ok || len(re.Window) == 0 || len(re.Step) > 0 || re.At != nil {
 		return
 	}
 	me, ok := re.Expr.(*metricsql.MetricExpr)
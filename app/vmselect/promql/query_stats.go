@@ -0,0 +1,50 @@
+package promql
+
+import (
+	"sync/atomic"
+)
+
+// QueryStats contains statistics for the query execution.
+//
+// It may be updated from concurrently running goroutines, so its fields must be read with atomic.LoadUint64.
+type QueryStats struct {
+	// SeriesFetched is the number of time series fetched from the storage.
+	SeriesFetched uint64
+
+	// SamplesScanned is the number of raw samples scanned during the query.
+	SamplesScanned uint64
+
+	// BlocksRead is the number of data blocks read from the storage.
+	BlocksRead uint64
+
+	// CacheHits is the number of series selectors, which were at least partially served from the rollup result cache.
+	CacheHits uint64
+}
+
+func (qs *QueryStats) addSeriesFetched(n int) {
+	if qs == nil {
+		return
+	}
+	atomic.AddUint64(&qs.SeriesFetched, uint64(n))
+}
+
+func (qs *QueryStats) addSamplesScanned(n uint64) {
+	if qs == nil {
+		return
+	}
+	atomic.AddUint64(&qs.SamplesScanned, n)
+}
+
+func (qs *QueryStats) addBlocksRead(n int) {
+	if qs == nil {
+		return
+	}
+	atomic.AddUint64(&qs.BlocksRead, uint64(n))
+}
+
+func (qs *QueryStats) addCacheHit() {
+	if qs == nil {
+		return
+	}
+	atomic.AddUint64(&qs.CacheHits, 1)
+}
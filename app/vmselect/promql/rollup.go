@@ -28,8 +28,9 @@ var rollupFuncs = map[string]newRollupFunc{
 	"deriv_fast":         newRollupFuncOneArg(rollupDerivFast),
 	"holt_winters":       newRollupHoltWinters,
 	"idelta":             newRollupFuncOneArg(rollupIdelta),
-	"increase":           newRollupFuncOneArg(rollupDelta),  // + rollupFuncsRemoveCounterResets
-	"irate":              newRollupFuncOneArg(rollupIderiv), // + rollupFuncsRemoveCounterResets
+	"increase":           newRollupFuncOneArg(rollupDelta),        // + rollupFuncsRemoveCounterResets
+	"increase_pure":      newRollupFuncOneArg(rollupIncreasePure), // + rollupFuncsRemoveCounterResets
+	"irate":              newRollupFuncOneArg(rollupIderiv),       // + rollupFuncsRemoveCounterResets
 	"predict_linear":     newRollupPredictLinear,
 	"rate":               newRollupFuncOneArg(rollupDerivFast), // + rollupFuncsRemoveCounterResets
 	"resets":             newRollupFuncOneArg(rollupResets),
@@ -64,6 +65,7 @@ var rollupFuncs = map[string]newRollupFunc{
 	"share_gt_over_time":    newRollupShareGT,
 	"count_le_over_time":    newRollupCountLE,
 	"count_gt_over_time":    newRollupCountGT,
+	"count_eq_over_time":    newRollupCountEQ,
 	"histogram_over_time":   newRollupFuncOneArg(rollupHistogram),
 	"rollup":                newRollupFuncOneArg(rollupFake),
 	"rollup_rate":           newRollupFuncOneArg(rollupFake), // + rollupFuncsRemoveCounterResets
@@ -77,6 +79,7 @@ var rollupFuncs = map[string]newRollupFunc{
 	"ascent_over_time":      newRollupFuncOneArg(rollupAscentOverTime),
 	"descent_over_time":     newRollupFuncOneArg(rollupDescentOverTime),
 	"zscore_over_time":      newRollupFuncOneArg(rollupZScoreOverTime),
+	"mad_over_time":         newRollupFuncOneArg(rollupMAD),
 
 	// `timestamp` function must return timestamp for the last datapoint on the current window
 	// in order to properly handle offset and timestamps unaligned to the current step.
@@ -97,9 +100,10 @@ var rollupAggrFuncs = map[string]rollupFunc{
 	"deriv":            rollupDerivSlow,
 	"deriv_fast":       rollupDerivFast,
 	"idelta":           rollupIdelta,
-	"increase":         rollupDelta,     // + rollupFuncsRemoveCounterResets
-	"irate":            rollupIderiv,    // + rollupFuncsRemoveCounterResets
-	"rate":             rollupDerivFast, // + rollupFuncsRemoveCounterResets
+	"increase":         rollupDelta,        // + rollupFuncsRemoveCounterResets
+	"increase_pure":    rollupIncreasePure, // + rollupFuncsRemoveCounterResets
+	"irate":            rollupIderiv,       // + rollupFuncsRemoveCounterResets
+	"rate":             rollupDerivFast,    // + rollupFuncsRemoveCounterResets
 	"resets":           rollupResets,
 	"avg_over_time":    rollupAvg,
 	"min_over_time":    rollupMin,
@@ -129,6 +133,7 @@ var rollupAggrFuncs = map[string]rollupFunc{
 	"ascent_over_time":    rollupAscentOverTime,
 	"descent_over_time":   rollupDescentOverTime,
 	"zscore_over_time":    rollupZScoreOverTime,
+	"mad_over_time":       rollupMAD,
 	"timestamp":           rollupTimestamp,
 	"mode_over_time":      rollupModeOverTime,
 	"rate_over_sum":       rollupRateOverSum,
@@ -140,6 +145,7 @@ var rollupFuncsCannotAdjustWindow = map[string]bool{
 	"holt_winters":        true,
 	"idelta":              true,
 	"increase":            true,
+	"increase_pure":       true,
 	"predict_linear":      true,
 	"resets":              true,
 	"avg_over_time":       true,
@@ -158,10 +164,12 @@ var rollupFuncsCannotAdjustWindow = map[string]bool{
 	"ascent_over_time":    true,
 	"descent_over_time":   true,
 	"zscore_over_time":    true,
+	"mad_over_time":       true,
 }
 
 var rollupFuncsRemoveCounterResets = map[string]bool{
 	"increase":        true,
+	"increase_pure":   true,
 	"irate":           true,
 	"rate":            true,
 	"rollup_rate":     true,
@@ -240,12 +248,12 @@ func getRollupArgIdx(funcName string) int {
 	}
 }
 
-func getRollupConfigs(name string, rf rollupFunc, expr metricsql.Expr, start, end, step, window int64, lookbackDelta int64, sharedTimestamps []int64) (
-	func(values []float64, timestamps []int64), []*rollupConfig, error) {
+func getRollupConfigs(name string, rf rollupFunc, expr metricsql.Expr, start, end, step, window int64, lookbackDelta int64,
+	counterResetJitterRatio float64, sharedTimestamps []int64) (func(values []float64, timestamps []int64), []*rollupConfig, error) {
 	preFunc := func(values []float64, timestamps []int64) {}
 	if rollupFuncsRemoveCounterResets[name] {
 		preFunc = func(values []float64, timestamps []int64) {
-			removeCounterResets(values)
+			removeCounterResets(values, counterResetJitterRatio)
 		}
 	}
 	newRollupConfig := func(rf rollupFunc, tagValue string) *rollupConfig {
@@ -299,7 +307,7 @@ func getRollupConfigs(name string, rf rollupFunc, expr metricsql.Expr, start, en
 			if rollupFuncsRemoveCounterResets[aggrFuncName] {
 				// There is no need to save the previous preFunc, since it is either empty or the same.
 				preFunc = func(values []float64, timestamps []int64) {
-					removeCounterResets(values)
+					removeCounterResets(values, counterResetJitterRatio)
 				}
 			}
 			rf := rollupAggrFuncs[aggrFuncName]
@@ -614,7 +622,11 @@ func getMaxPrevInterval(scrapeInterval int64) int64 {
 	return scrapeInterval + scrapeInterval/8
 }
 
-func removeCounterResets(values []float64) {
+// removeCounterResets removes counter resets from values.
+//
+// Decreases smaller than jitterRatio*prevValue aren't considered as counter resets.
+// Such decreases are substituted with the previous value instead.
+func removeCounterResets(values []float64, jitterRatio float64) {
 	// There is no need in handling NaNs here, since they are impossible
 	// on values from vmstorage.
 	if len(values) == 0 {
@@ -625,7 +637,7 @@ func removeCounterResets(values []float64) {
 	for i, v := range values {
 		d := v - prevValue
 		if d < 0 {
-			if (-d * 8) < prevValue {
+			if -d < jitterRatio*prevValue {
 				// This is likely jitter from `Prometheus HA pairs`.
 				// Just substitute v with prevValue.
 				v = prevValue
@@ -835,6 +847,16 @@ func countFilterGT(values []float64, gt float64) int {
 	return n
 }
 
+func countFilterEQ(values []float64, eq float64) int {
+	n := 0
+	for _, v := range values {
+		if v == eq {
+			n++
+		}
+	}
+	return n
+}
+
 func newRollupShareFilter(args []interface{}, countFilter func(values []float64, limit float64) int) (rollupFunc, error) {
 	rf, err := newRollupCountFilter(args, countFilter)
 	if err != nil {
@@ -854,6 +876,10 @@ func newRollupCountGT(args []interface{}) (rollupFunc, error) {
 	return newRollupCountFilter(args, countFilterGT)
 }
 
+func newRollupCountEQ(args []interface{}) (rollupFunc, error) {
+	return newRollupCountFilter(args, countFilterEQ)
+}
+
 func newRollupCountFilter(args []interface{}, countFilter func(values []float64, limit float64) int) (rollupFunc, error) {
 	if err := expectRollupArgsNum(args, 2); err != nil {
 		return nil, err
@@ -1203,6 +1229,26 @@ func rollupStdvar(rfa *rollupFuncArg) float64 {
 	return q / count
 }
 
+func rollupIncreasePure(rfa *rollupFuncArg) float64 {
+	// There is no need in handling NaNs here, since they must be cleaned up
+	// before calling rollup funcs.
+	values := rfa.values
+	prevValue := rfa.prevValue
+	if math.IsNaN(prevValue) {
+		if len(values) == 0 {
+			return nan
+		}
+		// Assume the counter starts from 0 in contrast to rollupDelta,
+		// which may ignore the first value if it is too big.
+		prevValue = 0
+	}
+	if len(values) == 0 {
+		// Assume that the value didn't change on the given interval.
+		return 0
+	}
+	return values[len(values)-1] - prevValue
+}
+
 func rollupDelta(rfa *rollupFuncArg) float64 {
 	// There is no need in handling NaNs here, since they must be cleaned up
 	// before calling rollup funcs.
@@ -1637,6 +1683,25 @@ func rollupZScoreOverTime(rfa *rollupFuncArg) float64 {
 	return d / rollupStddev(rfa)
 }
 
+func rollupMAD(rfa *rollupFuncArg) float64 {
+	// There is no need in handling NaNs here, since they must be cleaned up
+	// before calling rollup funcs.
+	//
+	// See https://en.wikipedia.org/wiki/Median_absolute_deviation
+	values := rfa.values
+	if len(values) == 0 {
+		return nan
+	}
+	median := medianValue(values)
+	hf := histogram.GetFast()
+	for _, v := range values {
+		hf.Update(math.Abs(v - median))
+	}
+	mad := hf.Quantile(0.5)
+	histogram.PutFast(hf)
+	return mad
+}
+
 func rollupFirst(rfa *rollupFuncArg) float64 {
 	// There is no need in handling NaNs here, since they must be cleaned up
 	// before calling rollup funcs.
@@ -86,26 +86,38 @@ func TestRollupIderivDuplicateTimestamps(t *testing.T) {
 }
 
 func TestRemoveCounterResets(t *testing.T) {
-	removeCounterResets(nil)
+	removeCounterResets(nil, 0.125)
 
 	values := append([]float64{}, testValues...)
-	removeCounterResets(values)
+	removeCounterResets(values, 0.125)
 	valuesExpected := []float64{123, 157, 167, 188, 221, 255, 320, 332, 364, 396, 398, 398}
 	testRowsEqual(t, values, testTimestamps, valuesExpected, testTimestamps)
 
 	// removeCounterResets doesn't expect negative values, so it doesn't work properly with them.
 	values = []float64{-100, -200, -300, -400}
-	removeCounterResets(values)
+	removeCounterResets(values, 0.125)
 	valuesExpected = []float64{-100, -300, -600, -1000}
 	timestampsExpected := []int64{0, 1, 2, 3}
 	testRowsEqual(t, values, timestampsExpected, valuesExpected, timestampsExpected)
 
 	// verify how jitter from `Prometheus HA pairs` is handled
 	values = []float64{100, 95, 120, 140, 137, 50}
-	removeCounterResets(values)
+	removeCounterResets(values, 0.125)
 	valuesExpected = []float64{100, 100, 120, 140, 140, 190}
 	timestampsExpected = []int64{0, 1, 2, 3, 4, 5}
 	testRowsEqual(t, values, timestampsExpected, valuesExpected, timestampsExpected)
+
+	// every decrease is a counter reset if jitterRatio is zero
+	values = []float64{100, 95, 120, 140, 137, 50}
+	removeCounterResets(values, 0)
+	valuesExpected = []float64{100, 195, 220, 240, 377, 427}
+	testRowsEqual(t, values, timestampsExpected, valuesExpected, timestampsExpected)
+
+	// only big decreases are counter resets if jitterRatio is high
+	values = []float64{100, 95, 120, 140, 137, 50}
+	removeCounterResets(values, 0.9)
+	valuesExpected = []float64{100, 100, 120, 140, 140, 140}
+	testRowsEqual(t, values, timestampsExpected, valuesExpected, timestampsExpected)
 }
 
 func TestDeltaValues(t *testing.T) {
@@ -123,7 +135,7 @@ func TestDeltaValues(t *testing.T) {
 
 	// remove counter resets
 	values = append([]float64{}, testValues...)
-	removeCounterResets(values)
+	removeCounterResets(values, 0.125)
 	deltaValues(values)
 	valuesExpected = []float64{34, 10, 21, 33, 34, 65, 12, 32, 32, 2, 0, 0}
 	testRowsEqual(t, values, testTimestamps, valuesExpected, testTimestamps)
@@ -145,7 +157,7 @@ func TestDerivValues(t *testing.T) {
 
 	// remove counter resets
 	values = append([]float64{}, testValues...)
-	removeCounterResets(values)
+	removeCounterResets(values, 0.125)
 	derivValues(values, testTimestamps)
 	valuesExpected = []float64{3400, 1111.111111111111, 1750, 2538.4615384615386, 3090.909090909091, 3611.1111111111113,
 		6000, 1882.3529411764705, 1777.7777777777778, 400, 0, 0}
@@ -176,7 +188,7 @@ func testRollupFunc(t *testing.T, funcName string, args []interface{}, meExpecte
 	rfa.timestamps = append(rfa.timestamps, testTimestamps...)
 	rfa.window = rfa.timestamps[len(rfa.timestamps)-1] - rfa.timestamps[0]
 	if rollupFuncsRemoveCounterResets[funcName] {
-		removeCounterResets(rfa.values)
+		removeCounterResets(rfa.values, 0.125)
 	}
 	for i := 0; i < 5; i++ {
 		v := rf(&rfa)
@@ -285,6 +297,26 @@ func TestRollupCountGTOverTime(t *testing.T) {
 	f(1000, 0)
 }
 
+func TestRollupCountEQOverTime(t *testing.T) {
+	f := func(eq, vExpected float64) {
+		t.Helper()
+		eqs := []*timeseries{{
+			Values:     []float64{eq},
+			Timestamps: []int64{123},
+		}}
+		var me metricsql.MetricExpr
+		args := []interface{}{&metricsql.RollupExpr{Expr: &me}, eqs}
+		testRollupFunc(t, "count_eq_over_time", args, &me, vExpected)
+	}
+
+	f(-123, 0)
+	f(0, 0)
+	f(34, 4)
+	f(44, 2)
+	f(123, 1)
+	f(1000, 0)
+}
+
 func TestRollupQuantileOverTime(t *testing.T) {
 	f := func(phi, vExpected float64) {
 		t.Helper()
@@ -414,6 +446,7 @@ func TestRollupNewRollupFuncSuccess(t *testing.T) {
 	f("deriv_fast", -712)
 	f("idelta", 0)
 	f("increase", 398)
+	f("increase_pure", 398)
 	f("irate", 0)
 	f("rate", 2200)
 	f("resets", 5)
@@ -439,6 +472,7 @@ func TestRollupNewRollupFuncSuccess(t *testing.T) {
 	f("ascent_over_time", 142)
 	f("descent_over_time", 231)
 	f("zscore_over_time", -0.4254336383156416)
+	f("mad_over_time", 10)
 	f("timestamp", 0.13)
 	f("mode_over_time", 34)
 	f("rate_over_sum", 4520)
@@ -1139,3 +1173,35 @@ func TestRollupDelta(t *testing.T) {
 	f(1, nil, 0)
 	f(100, nil, 0)
 }
+
+func TestRollupIncreasePure(t *testing.T) {
+	f := func(prevValue float64, values []float64, resultExpected float64) {
+		t.Helper()
+		rfa := &rollupFuncArg{
+			prevValue: prevValue,
+			values:    values,
+		}
+		result := rollupIncreasePure(rfa)
+		if math.IsNaN(result) {
+			if !math.IsNaN(resultExpected) {
+				t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+			}
+			return
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+		}
+	}
+	f(nan, nil, nan)
+	f(nan, []float64{1}, 1)
+	f(nan, []float64{1, 2, 3}, 3)
+	f(1, []float64{1, 2, 3}, 2)
+
+	// Big initial value isn't skipped in contrast to rollupDelta.
+	f(nan, []float64{1000}, 1000)
+	f(nan, []float64{1000, 1001, 1002}, 1002)
+
+	// Empty values
+	f(1, nil, 0)
+	f(100, nil, 0)
+}
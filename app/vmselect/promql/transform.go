@@ -1,6 +1,7 @@
 package promql
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"math/rand"
@@ -50,50 +51,53 @@ var transformFuncs = map[string]transformFunc{
 	"year":   newTransformFuncDateTime(transformYear),
 
 	// New funcs
-	"label_set":          transformLabelSet,
-	"label_map":          transformLabelMap,
-	"label_del":          transformLabelDel,
-	"label_keep":         transformLabelKeep,
-	"label_copy":         transformLabelCopy,
-	"label_move":         transformLabelMove,
-	"label_transform":    transformLabelTransform,
-	"label_value":        transformLabelValue,
-	"label_match":        transformLabelMatch,
-	"label_mismatch":     transformLabelMismatch,
-	"union":              transformUnion,
-	"":                   transformUnion, // empty func is a synonim to union
-	"keep_last_value":    transformKeepLastValue,
-	"keep_next_value":    transformKeepNextValue,
-	"interpolate":        transformInterpolate,
-	"start":              newTransformFuncZeroArgs(transformStart),
-	"end":                newTransformFuncZeroArgs(transformEnd),
-	"step":               newTransformFuncZeroArgs(transformStep),
-	"running_sum":        newTransformFuncRunning(runningSum),
-	"running_max":        newTransformFuncRunning(runningMax),
-	"running_min":        newTransformFuncRunning(runningMin),
-	"running_avg":        newTransformFuncRunning(runningAvg),
-	"range_sum":          newTransformFuncRange(runningSum),
-	"range_max":          newTransformFuncRange(runningMax),
-	"range_min":          newTransformFuncRange(runningMin),
-	"range_avg":          newTransformFuncRange(runningAvg),
-	"range_first":        transformRangeFirst,
-	"range_last":         transformRangeLast,
-	"range_quantile":     transformRangeQuantile,
-	"smooth_exponential": transformSmoothExponential,
-	"remove_resets":      transformRemoveResets,
-	"rand":               newTransformRand(newRandFloat64),
-	"rand_normal":        newTransformRand(newRandNormFloat64),
-	"rand_exponential":   newTransformRand(newRandExpFloat64),
-	"pi":                 transformPi,
-	"sin":                newTransformFuncOneArg(transformSin),
-	"cos":                newTransformFuncOneArg(transformCos),
-	"asin":               newTransformFuncOneArg(transformAsin),
-	"acos":               newTransformFuncOneArg(transformAcos),
-	"prometheus_buckets": transformPrometheusBuckets,
-	"buckets_limit":      transformBucketsLimit,
-	"histogram_share":    transformHistogramShare,
-	"sort_by_label":      newTransformFuncSortByLabel(false),
-	"sort_by_label_desc": newTransformFuncSortByLabel(true),
+	"label_set":            transformLabelSet,
+	"label_map":            transformLabelMap,
+	"label_uppercase":      newTransformFuncLabelCase(bytes.ToUpper),
+	"label_lowercase":      newTransformFuncLabelCase(bytes.ToLower),
+	"label_graphite_group": transformLabelGraphiteGroup,
+	"label_del":            transformLabelDel,
+	"label_keep":           transformLabelKeep,
+	"label_copy":           transformLabelCopy,
+	"label_move":           transformLabelMove,
+	"label_transform":      transformLabelTransform,
+	"label_value":          transformLabelValue,
+	"label_match":          transformLabelMatch,
+	"label_mismatch":       transformLabelMismatch,
+	"union":                transformUnion,
+	"":                     transformUnion, // empty func is a synonim to union
+	"keep_last_value":      transformKeepLastValue,
+	"keep_next_value":      transformKeepNextValue,
+	"interpolate":          transformInterpolate,
+	"start":                newTransformFuncZeroArgs(transformStart),
+	"end":                  newTransformFuncZeroArgs(transformEnd),
+	"step":                 newTransformFuncZeroArgs(transformStep),
+	"running_sum":          newTransformFuncRunning(runningSum),
+	"running_max":          newTransformFuncRunning(runningMax),
+	"running_min":          newTransformFuncRunning(runningMin),
+	"running_avg":          newTransformFuncRunning(runningAvg),
+	"range_sum":            newTransformFuncRange(runningSum),
+	"range_max":            newTransformFuncRange(runningMax),
+	"range_min":            newTransformFuncRange(runningMin),
+	"range_avg":            newTransformFuncRange(runningAvg),
+	"range_first":          transformRangeFirst,
+	"range_last":           transformRangeLast,
+	"range_quantile":       transformRangeQuantile,
+	"smooth_exponential":   transformSmoothExponential,
+	"remove_resets":        transformRemoveResets,
+	"rand":                 newTransformRand(newRandFloat64),
+	"rand_normal":          newTransformRand(newRandNormFloat64),
+	"rand_exponential":     newTransformRand(newRandExpFloat64),
+	"pi":                   transformPi,
+	"sin":                  newTransformFuncOneArg(transformSin),
+	"cos":                  newTransformFuncOneArg(transformCos),
+	"asin":                 newTransformFuncOneArg(transformAsin),
+	"acos":                 newTransformFuncOneArg(transformAcos),
+	"prometheus_buckets":   transformPrometheusBuckets,
+	"buckets_limit":        transformBucketsLimit,
+	"histogram_share":      transformHistogramShare,
+	"sort_by_label":        newTransformFuncSortByLabel(false),
+	"sort_by_label_desc":   newTransformFuncSortByLabel(true),
 }
 
 func getTransformFunc(s string) transformFunc {
@@ -1190,6 +1194,82 @@ func transformLabelMap(tfa *transformFuncArg) ([]*timeseries, error) {
 	return rvs, nil
 }
 
+func newTransformFuncLabelCase(caseFunc func(b []byte) []byte) transformFunc {
+	return func(tfa *transformFuncArg) ([]*timeseries, error) {
+		args := tfa.args
+		if len(args) < 2 {
+			return nil, fmt.Errorf(`not enough args; got %d; want at least %d`, len(args), 2)
+		}
+		var labels []string
+		for i := 1; i < len(args); i++ {
+			label, err := getString(args[i], i)
+			if err != nil {
+				return nil, err
+			}
+			labels = append(labels, label)
+		}
+		rvs := args[0]
+		for _, ts := range rvs {
+			mn := &ts.MetricName
+			for _, label := range labels {
+				if len(mn.GetTagValue(label)) == 0 {
+					continue
+				}
+				dstValue := getDstValue(mn, label)
+				*dstValue = caseFunc(*dstValue)
+			}
+		}
+		return rvs, nil
+	}
+}
+
+func transformLabelGraphiteGroup(tfa *transformFuncArg) ([]*timeseries, error) {
+	args := tfa.args
+	if len(args) < 2 {
+		return nil, fmt.Errorf(`not enough args; got %d; want at least %d`, len(args), 2)
+	}
+	var groupIDs []int
+	for i := 1; i < len(args); i++ {
+		groupID, err := getIntNumber(args[i], i)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read group number: %w", err)
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+	rvs := args[0]
+	var groupName []byte
+	for _, ts := range rvs {
+		mn := &ts.MetricName
+		groups := bytes.Split(mn.MetricGroup, []byte("."))
+		groupName = groupName[:0]
+		for j, groupID := range groupIDs {
+			if j > 0 {
+				groupName = append(groupName, '.')
+			}
+			if groupID >= 0 && groupID < len(groups) {
+				groupName = append(groupName, groups[groupID]...)
+			}
+		}
+		mn.MetricGroup = append(mn.MetricGroup[:0], groupName...)
+	}
+	return rvs, nil
+}
+
+func getIntNumber(arg interface{}, argNum int) (int, error) {
+	v, err := getScalar(arg, argNum)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	if len(v) > 0 {
+		if math.IsNaN(v[0]) {
+			return 0, fmt.Errorf(`arg #%d must be a number`, argNum+1)
+		}
+		n = int(v[0])
+	}
+	return n, nil
+}
+
 func transformLabelCopy(tfa *transformFuncArg) ([]*timeseries, error) {
 	return transformLabelCopyExt(tfa, false)
 }
@@ -1725,15 +1805,8 @@ func getDstValue(mn *storage.MetricName, dstLabel string) *[]byte {
 			return &tag.Value
 		}
 	}
-	if len(tags) < cap(tags) {
-		tags = tags[:len(tags)+1]
-	} else {
-		tags = append(tags, storage.Tag{})
-	}
-	mn.Tags = tags
-	tag := &tags[len(tags)-1]
-	tag.Key = append(tag.Key[:0], dstLabel...)
-	return &tag.Value
+	mn.AddTag(dstLabel, "")
+	return &mn.Tags[len(mn.Tags)-1].Value
 }
 
 func isLeapYear(y uint32) bool {
@@ -0,0 +1,205 @@
+package vmui
+
+// cardinalityHTML is a web UI for exploring series cardinality via /api/v1/status/tsdb.
+//
+// It allows drilling down from metric names to label names and label values by series count
+// and comparing the results with another date in order to find the sources of churn.
+const cardinalityHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>VictoriaMetrics cardinality explorer</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 0; color: #222; }
+header { background: #110f0f; color: #fff; padding: 8px 16px; font-weight: bold; }
+header a { color: #fff; margin-left: 16px; font-weight: normal; }
+#content { padding: 8px 16px; }
+.controls { margin: 6px 0; display: flex; gap: 8px; align-items: center; flex-wrap: wrap; }
+#match { width: 400px; font-family: monospace; }
+#error { color: #c00; white-space: pre-wrap; font-family: monospace; }
+#summary { color: #666; margin: 6px 0; }
+#tables { display: flex; flex-wrap: wrap; gap: 16px; }
+.panel { flex: 1; min-width: 420px; }
+.panel h3 { font-size: 14px; margin: 8px 0; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border-bottom: 1px solid #eee; text-align: left; padding: 3px 6px; font-family: monospace; }
+th { font-family: sans-serif; }
+td.num { text-align: right; }
+td.link { color: #36c; cursor: pointer; word-break: break-all; }
+.pos { color: #c00; }
+.neg { color: #090; }
+</style>
+</head>
+<body>
+<header>VictoriaMetrics <a href="./">Query</a><a href="cardinality">Cardinality</a></header>
+<div id="content">
+<div class="controls">
+<label>Series selector <input id="match" placeholder="e.g. {job=&quot;node&quot;}"></label>
+<label>Focus label <input id="focusLabel" size="16"></label>
+<label>Date <input id="date" type="date"></label>
+<label>Compare with <input id="prevDate" type="date"></label>
+<label>Top N <input id="topN" size="4" value="10"></label>
+<button id="exec">Show</button>
+<button id="reset">Reset</button>
+</div>
+<div id="error"></div>
+<div id="summary"></div>
+<div id="tables"></div>
+</div>
+<script>
+(function() {
+  "use strict";
+  var $ = function(id) { return document.getElementById(id); };
+
+  function escapeHTML(s) {
+    return String(s).replace(/[&<>"']/g, function(c) {
+      return {"&": "&amp;", "<": "&lt;", ">": "&gt;", "\"": "&quot;", "'": "&#39;"}[c];
+    });
+  }
+
+  function fetchStatus(date) {
+    var params = new URLSearchParams();
+    if ($("match").value.trim()) {
+      params.append("match[]", $("match").value.trim());
+    }
+    if ($("focusLabel").value.trim()) {
+      params.set("focusLabel", $("focusLabel").value.trim());
+    }
+    if (date) {
+      params.set("date", date);
+    }
+    params.set("topN", $("topN").value || "10");
+    return fetch("../api/v1/status/tsdb?" + params.toString()).then(function(resp) {
+      return resp.json();
+    }).then(function(data) {
+      if (data.status !== "success") {
+        throw new Error(data.error || "unexpected response");
+      }
+      return data.data;
+    });
+  }
+
+  // addFilter adds label=value filter to the series selector.
+  function addFilter(label, value) {
+    var filter = label + "=" + JSON.stringify(value);
+    var m = $("match").value.trim();
+    if (!m) {
+      m = "{" + filter + "}";
+    } else if (m.charAt(m.length - 1) === "}") {
+      var body = m.substring(0, m.length - 1).trim();
+      m = body + (body.charAt(body.length - 1) === "{" ? "" : ", ") + filter + "}";
+    } else {
+      m = m + "{" + filter + "}";
+    }
+    $("match").value = m;
+  }
+
+  function saveState() {
+    var params = new URLSearchParams();
+    ["match", "focusLabel", "date", "prevDate", "topN"].forEach(function(id) {
+      if ($(id).value) {
+        params.set(id, $(id).value);
+      }
+    });
+    history.replaceState(null, "", "#" + params.toString());
+  }
+
+  function loadState() {
+    var params = new URLSearchParams(location.hash.substr(1));
+    ["match", "focusLabel", "date", "prevDate", "topN"].forEach(function(id) {
+      if (params.get(id)) {
+        $(id).value = params.get(id);
+      }
+    });
+  }
+
+  function show() {
+    saveState();
+    $("error").textContent = "";
+    $("summary").textContent = "loading...";
+    var prevDate = $("prevDate").value;
+    var reqs = [fetchStatus($("date").value)];
+    if (prevDate) {
+      reqs.push(fetchStatus(prevDate));
+    }
+    Promise.all(reqs).then(function(results) {
+      render(results[0], results[1]);
+    }).catch(function(err) {
+      $("summary").textContent = "";
+      $("tables").innerHTML = "";
+      $("error").textContent = err.message;
+    });
+  }
+
+  function render(curr, prev) {
+    var summary = "Total series: " + curr.totalSeries;
+    if (prev) {
+      summary += "; total series at " + $("prevDate").value + ": " + prev.totalSeries + "; diff: " + (curr.totalSeries - prev.totalSeries);
+    }
+    $("summary").textContent = summary;
+    var panels = [
+      {title: "Series count by metric name", key: "seriesCountByMetricName", onClick: function(name) {
+        $("match").value = "";
+        addFilter("__name__", name);
+      }},
+      {title: "Values count by label name", key: "labelValueCountByLabelName", onClick: function(name) {
+        $("focusLabel").value = name;
+      }},
+      {title: "Series count by label=value pair", key: "seriesCountByLabelValuePair", onClick: function(name) {
+        var n = name.indexOf("=");
+        addFilter(name.substring(0, n), name.substring(n + 1));
+      }}
+    ];
+    if ($("focusLabel").value.trim()) {
+      var focusLabel = $("focusLabel").value.trim();
+      panels.splice(1, 0, {title: "Series count by " + focusLabel + " value", key: "seriesCountByFocusLabelValue", onClick: function(value) {
+        addFilter(focusLabel, value);
+      }});
+    }
+    var html = [];
+    panels.forEach(function(p, idx) {
+      var prevCounts = {};
+      if (prev) {
+        prev[p.key].forEach(function(e) { prevCounts[e.name] = e.value; });
+      }
+      var rows = curr[p.key].map(function(e) {
+        var row = "<tr><td class='link' data-panel='" + idx + "'>" + escapeHTML(e.name) + "</td><td class='num'>" + e.value + "</td>";
+        if (prev) {
+          // Entries missing in topN for the previous date are shown as new.
+          var diff = e.name in prevCounts ? e.value - prevCounts[e.name] : null;
+          var cls = diff > 0 ? "pos" : (diff < 0 ? "neg" : "");
+          row += "<td class='num " + (diff === null ? "pos" : cls) + "'>" + (diff === null ? "new" : (diff > 0 ? "+" : "") + diff) + "</td>";
+        }
+        return row + "</tr>";
+      });
+      html.push("<div class='panel'><h3>" + escapeHTML(p.title) + "</h3><table><tr><th>Name</th><th>Count</th>" +
+        (prev ? "<th>Diff</th>" : "") + "</tr>" + rows.join("") + "</table></div>");
+    });
+    $("tables").innerHTML = html.join("");
+    Array.prototype.forEach.call(document.querySelectorAll("td.link"), function(td) {
+      td.onclick = function() {
+        panels[+td.getAttribute("data-panel")].onClick(td.textContent);
+        show();
+      };
+    });
+  }
+
+  $("exec").onclick = show;
+  $("reset").onclick = function() {
+    ["match", "focusLabel", "date", "prevDate"].forEach(function(id) { $(id).value = ""; });
+    show();
+  };
+  Array.prototype.forEach.call(document.querySelectorAll(".controls input"), function(el) {
+    el.onkeydown = function(e) {
+      if (e.key === "Enter") {
+        show();
+      }
+    };
+  });
+  loadState();
+  show();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,386 @@
+package vmui
+
+// indexHTML is a single-page web UI for VictoriaMetrics.
+//
+// It doesn't depend on external resources, so it works in isolated environments.
+const indexHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>VictoriaMetrics UI</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 0; color: #222; }
+header { background: #110f0f; color: #fff; padding: 8px 16px; font-weight: bold; }
+header a { color: #fff; margin-left: 16px; font-weight: normal; }
+#main { display: flex; }
+#labels { width: 260px; min-width: 260px; border-right: 1px solid #ddd; height: calc(100vh - 34px); overflow: auto; padding: 8px; box-sizing: border-box; }
+#labels h3 { margin: 4px 0 8px; font-size: 14px; }
+#labels input { width: 100%; box-sizing: border-box; margin-bottom: 6px; }
+#labels .item { cursor: pointer; padding: 2px 4px; word-break: break-all; }
+#labels .item:hover { background: #eef; }
+#labels .back { color: #36c; cursor: pointer; margin-bottom: 6px; }
+#content { flex: 1; padding: 8px 16px; min-width: 0; }
+#query { width: 100%; box-sizing: border-box; font-family: monospace; font-size: 14px; height: 60px; }
+.controls { margin: 6px 0; display: flex; gap: 8px; align-items: center; flex-wrap: wrap; }
+.tabs span { cursor: pointer; padding: 4px 10px; border: 1px solid #ddd; border-bottom: none; display: inline-block; }
+.tabs span.active { background: #eef; font-weight: bold; }
+#error { color: #c00; white-space: pre-wrap; font-family: monospace; }
+#stats { color: #666; margin: 4px 0; }
+#result { border: 1px solid #ddd; padding: 8px; overflow: auto; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border-bottom: 1px solid #eee; text-align: left; padding: 3px 6px; font-family: monospace; vertical-align: top; }
+pre { margin: 0; }
+#legend div { font-family: monospace; font-size: 12px; cursor: pointer; }
+#legend div.hidden { opacity: 0.3; }
+#legend span.color { display: inline-block; width: 10px; height: 10px; margin-right: 6px; }
+</style>
+</head>
+<body>
+<header>VictoriaMetrics <a href="./">Query</a><a href="cardinality">Cardinality</a></header>
+<div id="main">
+<div id="labels"></div>
+<div id="content">
+<textarea id="query" placeholder="Enter MetricsQL or PromQL query. Press Ctrl+Enter to execute"></textarea>
+<div class="controls">
+<label><input type="radio" name="mode" value="range" checked> Range</label>
+<label><input type="radio" name="mode" value="instant"> Instant</label>
+<label>Range <select id="range">
+<option value="300">5m</option><option value="900">15m</option><option value="3600" selected>1h</option>
+<option value="10800">3h</option><option value="43200">12h</option><option value="86400">1d</option>
+<option value="604800">7d</option><option value="2592000">30d</option>
+</select></label>
+<label>End <input id="end" type="datetime-local" step="1"></label>
+<label>Step <input id="step" size="6" placeholder="auto"></label>
+<label><input id="nocache" type="checkbox"> Disable cache</label>
+<button id="exec">Execute</button>
+</div>
+<div id="error"></div>
+<div id="stats"></div>
+<div class="tabs"><span data-tab="graph" class="active">Graph</span><span data-tab="table">Table</span><span data-tab="json">JSON</span></div>
+<div id="result"></div>
+</div>
+</div>
+<script>
+(function() {
+  "use strict";
+  var $ = function(id) { return document.getElementById(id); };
+  var lastResponse = null;
+  var activeTab = "graph";
+  var hiddenSeries = {};
+  var colors = ["#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#46a0a0", "#f032e6", "#808000", "#9a6324", "#800000", "#000075", "#469990"];
+
+  function escapeHTML(s) {
+    return String(s).replace(/[&<>"']/g, function(c) {
+      return {"&": "&amp;", "<": "&lt;", ">": "&gt;", "\"": "&quot;", "'": "&#39;"}[c];
+    });
+  }
+
+  function metricName(m) {
+    var name = m.__name__ || "";
+    var labels = [];
+    Object.keys(m).sort().forEach(function(k) {
+      if (k !== "__name__") {
+        labels.push(k + "=" + JSON.stringify(m[k]));
+      }
+    });
+    return name + "{" + labels.join(", ") + "}";
+  }
+
+  // randomHex returns random hex string with the given number of bytes.
+  function randomHex(n) {
+    var b = new Uint8Array(n);
+    window.crypto.getRandomValues(b);
+    return Array.prototype.map.call(b, function(x) { return ("0" + x.toString(16)).slice(-2); }).join("");
+  }
+
+  function fetchJSON(url, headers) {
+    return fetch(url, {headers: headers || {}}).then(function(resp) {
+      return resp.json().then(function(data) {
+        if (data.status !== "success") {
+          throw new Error(data.error || ("unexpected response status " + resp.status));
+        }
+        return data;
+      });
+    });
+  }
+
+  function getEndTime() {
+    var v = $("end").value;
+    return v ? new Date(v).getTime() / 1000 : Date.now() / 1000;
+  }
+
+  function saveState() {
+    var params = new URLSearchParams();
+    params.set("query", $("query").value);
+    params.set("mode", document.querySelector("input[name=mode]:checked").value);
+    params.set("range", $("range").value);
+    if ($("end").value) {
+      params.set("end", $("end").value);
+    }
+    if ($("step").value) {
+      params.set("step", $("step").value);
+    }
+    params.set("tab", activeTab);
+    history.replaceState(null, "", "#" + params.toString());
+  }
+
+  function loadState() {
+    var params = new URLSearchParams(location.hash.substr(1));
+    $("query").value = params.get("query") || "";
+    var mode = params.get("mode");
+    if (mode) {
+      document.querySelector("input[name=mode][value=" + (mode === "instant" ? "instant" : "range") + "]").checked = true;
+    }
+    if (params.get("range")) {
+      $("range").value = params.get("range");
+    }
+    $("end").value = params.get("end") || "";
+    $("step").value = params.get("step") || "";
+    setTab(params.get("tab") || "graph");
+  }
+
+  function execute() {
+    var query = $("query").value.trim();
+    if (!query) {
+      return;
+    }
+    saveState();
+    $("error").textContent = "";
+    $("stats").textContent = "executing...";
+    var mode = document.querySelector("input[name=mode]:checked").value;
+    var end = getEndTime();
+    var params = new URLSearchParams();
+    params.set("query", query);
+    var path = "../api/v1/query";
+    if (mode === "range") {
+      var rangeSecs = +$("range").value;
+      var step = $("step").value || String(Math.max(1, Math.round(rangeSecs / 300)));
+      params.set("start", String(end - rangeSecs));
+      params.set("end", String(end));
+      params.set("step", step);
+      path = "../api/v1/query_range";
+    } else {
+      params.set("time", String(end));
+    }
+    if ($("nocache").checked) {
+      params.set("nocache", "1");
+    }
+    // Pass traceparent header, so the query can be found in tracing system if -tracing.otlpEndpoint is set.
+    var traceID = randomHex(16);
+    var headers = {"traceparent": "00-" + traceID + "-" + randomHex(8) + "-01"};
+    var startTime = Date.now();
+    fetchJSON(path + "?" + params.toString(), headers).then(function(data) {
+      lastResponse = data;
+      hiddenSeries = {};
+      var resultType = data.data.resultType;
+      var result = (resultType === "matrix" || resultType === "vector") ? data.data.result : [];
+      var points = 0;
+      if (resultType === "matrix") {
+        result.forEach(function(r) { points += r.values.length; });
+      } else {
+        points = result.length;
+      }
+      $("stats").textContent = "duration: " + (Date.now() - startTime) + "ms; series: " + result.length +
+        "; points: " + points + "; traceID: " + traceID;
+      render();
+    }).catch(function(err) {
+      lastResponse = null;
+      $("stats").textContent = "traceID: " + traceID;
+      $("error").textContent = err.message;
+      $("result").innerHTML = "";
+    });
+  }
+
+  function setTab(tab) {
+    activeTab = tab;
+    Array.prototype.forEach.call(document.querySelectorAll(".tabs span"), function(el) {
+      el.className = el.getAttribute("data-tab") === tab ? "active" : "";
+    });
+    render();
+  }
+
+  function render() {
+    var el = $("result");
+    if (!lastResponse) {
+      el.innerHTML = "";
+      return;
+    }
+    var data = lastResponse.data;
+    if (activeTab === "json") {
+      el.innerHTML = "<pre>" + escapeHTML(JSON.stringify(lastResponse, null, 2)) + "</pre>";
+      return;
+    }
+    if (activeTab === "table") {
+      renderTable(el, data);
+      return;
+    }
+    renderGraph(el, data);
+  }
+
+  function renderTable(el, data) {
+    var rows = [];
+    var result = data.result || [];
+    if (data.resultType === "scalar" || data.resultType === "string") {
+      rows.push("<tr><td>" + escapeHTML(data.result[1]) + "</td></tr>");
+    } else {
+      result.forEach(function(r) {
+        var v = r.value ? r.value[1] : r.values.map(function(p) {
+          return p[1] + " @" + p[0];
+        }).join("\n");
+        rows.push("<tr><td>" + escapeHTML(metricName(r.metric)) + "</td><td><pre>" + escapeHTML(v) + "</pre></td></tr>");
+      });
+    }
+    el.innerHTML = rows.length ? "<table>" + rows.join("") + "</table>" : "no data";
+  }
+
+  function renderGraph(el, data) {
+    if (data.resultType !== "matrix") {
+      el.innerHTML = "Graph is available only for range queries. See Table tab.";
+      return;
+    }
+    var result = data.result || [];
+    if (result.length === 0) {
+      el.innerHTML = "no data";
+      return;
+    }
+    var width = Math.max(300, el.clientWidth - 20), height = 360, padLeft = 70, padBottom = 24, padTop = 8;
+    var minX = Infinity, maxX = -Infinity, minY = Infinity, maxY = -Infinity;
+    result.forEach(function(r, i) {
+      if (hiddenSeries[i]) {
+        return;
+      }
+      r.values.forEach(function(p) {
+        var x = p[0], y = +p[1];
+        if (!isFinite(y)) {
+          return;
+        }
+        minX = Math.min(minX, x); maxX = Math.max(maxX, x);
+        minY = Math.min(minY, y); maxY = Math.max(maxY, y);
+      });
+    });
+    if (!isFinite(minX)) {
+      minX = maxX = getEndTime(); minY = 0; maxY = 1;
+    }
+    if (maxX === minX) { maxX = minX + 1; }
+    if (maxY === minY) { maxY = minY + 1; minY = minY - 1; }
+    var sx = function(x) { return padLeft + (x - minX) / (maxX - minX) * (width - padLeft - 10); };
+    var sy = function(y) { return padTop + (1 - (y - minY) / (maxY - minY)) * (height - padTop - padBottom); };
+    var svg = ["<svg width='" + width + "' height='" + height + "' xmlns='http://www.w3.org/2000/svg'>"];
+    for (var i = 0; i <= 4; i++) {
+      var y = minY + (maxY - minY) * i / 4, py = sy(y);
+      svg.push("<line x1='" + padLeft + "' x2='" + width + "' y1='" + py + "' y2='" + py + "' stroke='#eee'/>");
+      svg.push("<text x='" + (padLeft - 4) + "' y='" + (py + 4) + "' font-size='11' text-anchor='end'>" + formatValue(y) + "</text>");
+      var x = minX + (maxX - minX) * i / 4;
+      svg.push("<text x='" + sx(x) + "' y='" + (height - 6) + "' font-size='11' text-anchor='middle'>" +
+        escapeHTML(new Date(x * 1000).toLocaleTimeString()) + "</text>");
+    }
+    result.forEach(function(r, i) {
+      if (hiddenSeries[i]) {
+        return;
+      }
+      var d = [], prevX = null;
+      var step = r.values.length > 1 ? (r.values[r.values.length - 1][0] - r.values[0][0]) / (r.values.length - 1) : 0;
+      r.values.forEach(function(p) {
+        var y = +p[1];
+        if (!isFinite(y)) {
+          prevX = null;
+          return;
+        }
+        // Break the line on gaps, so missing data isn't hidden.
+        var cmd = (prevX === null || (step > 0 && p[0] - prevX > 2 * step)) ? "M" : "L";
+        d.push(cmd + sx(p[0]).toFixed(1) + "," + sy(y).toFixed(1));
+        prevX = p[0];
+      });
+      svg.push("<path d='" + d.join("") + "' fill='none' stroke-width='1.5' stroke='" + colors[i % colors.length] + "'>" +
+        "<title>" + escapeHTML(metricName(r.metric)) + "</title></path>");
+    });
+    svg.push("</svg>");
+    var legend = result.map(function(r, i) {
+      return "<div data-idx='" + i + "'" + (hiddenSeries[i] ? " class='hidden'" : "") + "><span class='color' style='background:" +
+        colors[i % colors.length] + "'></span>" + escapeHTML(metricName(r.metric)) + "</div>";
+    });
+    el.innerHTML = svg.join("") + "<div id='legend'>" + legend.join("") + "</div>";
+    Array.prototype.forEach.call(document.querySelectorAll("#legend div"), function(div) {
+      div.onclick = function() {
+        var idx = div.getAttribute("data-idx");
+        hiddenSeries[idx] = !hiddenSeries[idx];
+        render();
+      };
+    });
+  }
+
+  function formatValue(v) {
+    var a = Math.abs(v);
+    if (a >= 1e9) { return (v / 1e9).toFixed(2) + "G"; }
+    if (a >= 1e6) { return (v / 1e6).toFixed(2) + "M"; }
+    if (a >= 1e3) { return (v / 1e3).toFixed(2) + "K"; }
+    return +v.toFixed(3) + "";
+  }
+
+  // Labels explorer
+  function showLabels() {
+    var el = $("labels");
+    el.innerHTML = "<h3>Labels</h3><input id='labelFilter' placeholder='filter'><div id='labelList'>loading...</div>";
+    fetchJSON("../api/v1/labels").then(function(data) {
+      renderItems(data.data, function(label) { showLabelValues(label); });
+    }).catch(function(err) {
+      $("labelList").textContent = err.message;
+    });
+  }
+
+  function showLabelValues(label) {
+    var el = $("labels");
+    el.innerHTML = "<div class='back'>&larr; labels</div><h3>" + escapeHTML(label) + "</h3>" +
+      "<input id='labelFilter' placeholder='filter'><div id='labelList'>loading...</div>";
+    el.querySelector(".back").onclick = showLabels;
+    fetchJSON("../api/v1/label/" + encodeURIComponent(label) + "/values").then(function(data) {
+      renderItems(data.data, function(value) {
+        var q = label === "__name__" ? value : "{" + label + "=" + JSON.stringify(value) + "}";
+        $("query").value = q;
+        execute();
+      });
+    }).catch(function(err) {
+      $("labelList").textContent = err.message;
+    });
+  }
+
+  function renderItems(items, onClick) {
+    var list = $("labelList"), filter = $("labelFilter");
+    var draw = function() {
+      var f = filter.value.toLowerCase();
+      var shown = items.filter(function(s) { return s.toLowerCase().indexOf(f) >= 0; }).slice(0, 1000);
+      list.innerHTML = shown.map(function(s) {
+        return "<div class='item'>" + escapeHTML(s) + "</div>";
+      }).join("");
+      Array.prototype.forEach.call(list.children, function(div, i) {
+        div.onclick = function() { onClick(shown[i]); };
+      });
+    };
+    filter.oninput = draw;
+    draw();
+  }
+
+  $("exec").onclick = execute;
+  $("query").onkeydown = function(e) {
+    if (e.key === "Enter" && (e.ctrlKey || e.metaKey)) {
+      e.preventDefault();
+      execute();
+    }
+  };
+  Array.prototype.forEach.call(document.querySelectorAll(".tabs span"), function(el) {
+    el.onclick = function() {
+      setTab(el.getAttribute("data-tab"));
+      saveState();
+    };
+  });
+  window.onresize = render;
+  loadState();
+  showLabels();
+  if ($("query").value) {
+    execute();
+  }
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,45 @@
+package vmui
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// RequestHandler serves web UI for querying VictoriaMetrics at /vmui/ path.
+//
+// The UI uses relative paths for API requests, so it works behind -http.pathPrefix and proxies.
+func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
+	path := r.URL.Path
+	if path == "/vmui" {
+		// Redirect to /vmui/ with relative Location header, so it works with -http.pathPrefix.
+		vmuiRequests.Inc()
+		w.Header().Set("Location", "vmui/")
+		w.WriteHeader(http.StatusMovedPermanently)
+		return true
+	}
+	if !strings.HasPrefix(path, "/vmui/") {
+		return false
+	}
+	vmuiRequests.Inc()
+	switch path[len("/vmui/"):] {
+	case "", "index.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(indexHTML))
+	case "cardinality":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(cardinalityHTML))
+	default:
+		vmuiErrors.Inc()
+		http.Error(w, "unsupported path", http.StatusNotFound)
+	}
+	return true
+}
+
+var (
+	vmuiRequests = metrics.NewCounter(`vm_http_requests_total{path="/vmui"}`)
+	vmuiErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/vmui"}`)
+)
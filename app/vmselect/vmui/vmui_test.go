@@ -0,0 +1,39 @@
+package vmui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestHandler(t *testing.T) {
+	f := func(path string, handledExpected bool, statusCodeExpected int, locationExpected string) {
+		t.Helper()
+		r := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		handled := RequestHandler(w, r)
+		if handled != handledExpected {
+			t.Fatalf("unexpected handled result for %q; got %v; want %v", path, handled, handledExpected)
+		}
+		if !handled {
+			return
+		}
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %q; got %d; want %d", path, w.Code, statusCodeExpected)
+		}
+		if location := w.Header().Get("Location"); location != locationExpected {
+			t.Fatalf("unexpected Location header for %q; got %q; want %q", path, location, locationExpected)
+		}
+		if statusCodeExpected == http.StatusOK && !strings.Contains(w.Body.String(), "<title>VictoriaMetrics") {
+			t.Fatalf("unexpected response body for %q", path)
+		}
+	}
+	f("/api/v1/query", false, 0, "")
+	f("/vmuifoo", false, 0, "")
+	f("/vmui", true, http.StatusMovedPermanently, "vmui/")
+	f("/vmui/", true, http.StatusOK, "")
+	f("/vmui/index.html", true, http.StatusOK, "")
+	f("/vmui/cardinality", true, http.StatusOK, "")
+	f("/vmui/foo.js", true, http.StatusNotFound, "")
+}
@@ -3,13 +3,17 @@ package vmstorage
 import (
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auditlog"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
@@ -22,13 +26,69 @@ var (
 	retentionPeriod = flag.Int("retentionPeriod", 1, "Retention period in months")
 	snapshotAuthKey = flag.String("snapshotAuthKey", "", "authKey, which must be passed in query string to /snapshot* pages")
 
-	precisionBits = flag.Int("precisionBits", 64, "The number of precision bits to store per each value. Lower precision bits improves data compression at the cost of precision loss")
+	precisionBits     = flag.Int("precisionBits", 64, "The number of precision bits to store per each value. Lower precision bits improves data compression at the cost of precision loss")
+	deltaRunsEncoding = flag.Bool("storage.deltaRunsEncoding", false, "Whether to use run-length delta encoding for near-constant time series such as gauges and counters with occasional jumps. "+
+		"This reduces disk space usage and speeds up queries for such series. Note that previous releases cannot read the data stored with this encoding, "+
+		"so downgrading isn't supported after enabling it. This also applies to the data exported via /api/v1/export/native")
 
 	// DataPath is a path to storage data.
 	DataPath = flag.String("storageDataPath", "victoria-metrics-data", "Path to storage data")
 
-	bigMergeConcurrency   = flag.Int("bigMergeConcurrency", 0, "The maximum number of CPU cores to use for big merges. Default value is used if set to 0")
-	smallMergeConcurrency = flag.Int("smallMergeConcurrency", 0, "The maximum number of CPU cores to use for small merges. Default value is used if set to 0")
+	bigMergeConcurrency        = flag.Int("bigMergeConcurrency", 0, "The maximum number of CPU cores to use for big merges. Default value is used if set to 0")
+	smallMergeConcurrency      = flag.Int("smallMergeConcurrency", 0, "The maximum number of CPU cores to use for small merges. Default value is used if set to 0")
+	mergeMaxReadBytesPerSecond = flagutil.NewBytes("storage.mergeMaxReadBytesPerSecond", 0, "The maximum read bandwidth in bytes per second for each background merge of data parts and indexdb parts. "+
+		"This may be used for reducing the impact of background merges on query latency on shared disks. Flushes of in-memory parts to disk aren't limited. There is no limit if set to 0. "+
+		"See also -storage.mergeLowPriorityHours")
+	mergeMaxWriteBytesPerSecond = flagutil.NewBytes("storage.mergeMaxWriteBytesPerSecond", 0, "The maximum write bandwidth in bytes per second for each background merge of data parts and indexdb parts. "+
+		"This may be used for reducing the impact of background merges on query latency on shared disks. Flushes of in-memory parts to disk aren't limited. There is no limit if set to 0. "+
+		"See also -storage.mergeLowPriorityHours")
+	mergeLowPriorityHours = flag.String("storage.mergeLowPriorityHours", "", "Optional hours range in local time when -storage.mergeMaxReadBytesPerSecond and "+
+		"-storage.mergeMaxWriteBytesPerSecond limits are applied, for example '9-18' for business hours. Background merges run at full speed outside the range. "+
+		"The limits are applied all the time if the range isn't set")
+	dataBlocksCacheSize = flagutil.NewBytes("storage.cacheSizeDataBlocks", 0, "The maximum size in bytes of the cache for decompressed data blocks. "+
+		"The cache reduces disk reads and CPU usage for dashboards, which repeatedly query the same series over the same time ranges. "+
+		"The cache is disabled if set to 0")
+
+	dedupIntervalsByAge = flagutil.NewArray("dedup.minScrapeIntervalByAge", "Optional de-duplication intervals depending on samples age in the form `age:interval`. "+
+		"For example, -dedup.minScrapeIntervalByAge=14d:1m,90d:5m leaves a single sample per minute for samples older than 14 days "+
+		"and a single sample per 5 minutes for samples older than 90 days. De-duplication is performed during background merges and during queries. "+
+		"Monthly partitions are re-merged when all their samples become old enough for bigger interval, "+
+		"so it is a lightweight alternative to downsampling. See also -dedup.minScrapeInterval")
+
+	inmemoryPartsFlushInterval = flag.Duration("storage.inmemoryPartsFlushInterval", 5*time.Second, "The interval for flushing recently ingested samples from in-memory parts to disk. "+
+		"Bigger values reduce disk writes at the cost of higher memory usage and bigger amounts of samples, which may be lost on unclean shutdown. "+
+		"See also -storage.wal")
+	maxInmemoryPartRows = flag.Int("storage.maxInmemoryPartRows", 0, "The maximum number of samples per in-memory part. Bigger values result in bigger parts written to disk "+
+		"at the cost of higher memory usage. Default value depends on the available memory if set to 0")
+
+	addRowsMaxQueueSize = flag.Int("storage.maxAddRowsQueueSize", 0, "The maximum number of insert requests, which may wait for free CPU when the storage is busy. "+
+		"Requests exceeding this limit are rejected with '503 Service Unavailable'. Default value is 16*<cpu_cores> if set to 0")
+	addRowsMaxQueueDuration = flag.Duration("storage.maxAddRowsQueueDuration", 0, "The maximum duration for insert requests to wait for free CPU when the storage is busy. "+
+		"Requests exceeding this duration are rejected with '503 Service Unavailable'. Default value is 30s if set to 0")
+
+	deletedSeriesTTL = flag.Duration("storage.deletedSeriesTTL", 0, "How long to keep tombstones for time series deleted via /api/v1/admin/tsdb/delete_series. "+
+		"By default tombstones are dropped together with the indexdb they are stored in on indexdb rotation, which happens every -retentionPeriod. "+
+		"Tombstones younger than -storage.deletedSeriesTTL are carried over to the new indexdb, so the data for deleted time series "+
+		"continues to be dropped during background merges. Note that tombstones created with non-zero -storage.deletedSeriesTTL "+
+		"cannot be read by previous releases, so downgrading isn't supported after deleting time series with this flag set. "+
+		"See https://victoriametrics.github.io/#how-to-delete-time-series")
+
+	snapshotBeforeDelete = flag.Bool("snapshotBeforeDelete", false, "Whether to create a snapshot before deleting time series via /api/v1/admin/tsdb/delete_series. "+
+		"The snapshot may be used for restoring mistakenly deleted time series. The snapshot isn't created if there are no time series to delete. "+
+		"See https://victoriametrics.github.io/#how-to-delete-time-series")
+
+	enableWAL = flag.Bool("storage.wal", false, "Whether to write the ingested samples to write-ahead log before acknowledging them. "+
+		"This guarantees that the acknowledged samples aren't lost on unclean shutdown such as OOM or power loss at the cost of higher disk IO. "+
+		"See https://victoriametrics.github.io/#write-ahead-log")
+
+	maxIndexSearchMemory = flagutil.NewBytes("search.maxIndexSearchMemory", 0, "The maximum memory, which may be occupied by a single intermediate set of matching series ids "+
+		"during index search for a single query. Queries exceeding the limit fail with an error naming the offending tag filter instead of consuming all the available memory. "+
+		"There is no limit if set to 0")
+
+	readOnly = flag.Bool("readonly", false, "Whether to open the storage at -storageDataPath in read-only mode. In this mode queries are served, "+
+		"while data ingestion, series deletion and snapshot management are rejected. Background merges and retention-based data removal are disabled, "+
+		"so the data files aren't modified. This may be useful for querying a copy of the data restored from backup. "+
+		"See https://victoriametrics.github.io/#read-only-mode")
 
 	denyQueriesOutsideRetention = flag.Bool("denyQueriesOutsideRetention", false, "Whether to deny queries outside of the configured -retentionPeriod. "+
 		"When set, then /api/v1/query_range would return '503 Service Unavailable' error for queries with 'from' value outside -retentionPeriod. "+
@@ -52,6 +112,7 @@ func CheckTimeRange(tr storage.TimeRange) error {
 
 // Init initializes vmstorage.
 func Init() {
+	httpserver.RegisterReadinessCheck("storage", checkStorageReady)
 	InitWithoutMetrics()
 	registerStorageMetrics()
 }
@@ -63,10 +124,34 @@ func InitWithoutMetrics() {
 	if err := encoding.CheckPrecisionBits(uint8(*precisionBits)); err != nil {
 		logger.Fatalf("invalid `-precisionBits`: %s", err)
 	}
+	encoding.SetDeltaRunsEncoding(*deltaRunsEncoding)
 
 	storage.SetBigMergeWorkersCount(*bigMergeConcurrency)
 	storage.SetSmallMergeWorkersCount(*smallMergeConcurrency)
-
+	storage.SetMergeBandwidthLimits(mergeMaxReadBytesPerSecond.N, mergeMaxWriteBytesPerSecond.N)
+	if err := storage.SetMergeLowPriorityHours(*mergeLowPriorityHours); err != nil {
+		logger.Fatalf("invalid -storage.mergeLowPriorityHours: %s", err)
+	}
+	storage.SetDataBlocksCacheSize(dataBlocksCacheSize.N)
+	if err := storage.SetDedupIntervalsByAge(*dedupIntervalsByAge); err != nil {
+		logger.Fatalf("invalid -dedup.minScrapeIntervalByAge: %s", err)
+	}
+	storage.SetInmemoryPartsFlushInterval(*inmemoryPartsFlushInterval)
+	if *maxInmemoryPartRows != 0 {
+		if err := storage.SetMaxInmemoryPartRows(*maxInmemoryPartRows); err != nil {
+			logger.Fatalf("invalid -storage.maxInmemoryPartRows: %s", err)
+		}
+	}
+	storage.SetAddRowsQueueSize(*addRowsMaxQueueSize)
+	storage.SetAddRowsTimeout(*addRowsMaxQueueDuration)
+	storage.SetDeletedSeriesTTL(*deletedSeriesTTL)
+	storage.SetWALEnabled(*enableWAL)
+	storage.SetMaxIndexSearchMemory(maxIndexSearchMemory.N)
+	storage.SetReadOnly(*readOnly)
+
+	if *readOnly {
+		logger.Infof("-readonly is set, so data ingestion, series deletion and snapshot management are disabled")
+	}
 	logger.Infof("opening storage at %q with retention period %d months", *DataPath, *retentionPeriod)
 	startTime := time.Now()
 	WG = syncwg.WaitGroup{}
@@ -75,6 +160,7 @@ func InitWithoutMetrics() {
 		logger.Fatalf("cannot open a storage at %s with retention period %d months: %s", *DataPath, *retentionPeriod, err)
 	}
 	Storage = strg
+	atomic.StoreUint32(&storageState, storageStateOpened)
 
 	var m storage.Metrics
 	Storage.UpdateMetrics(&m)
@@ -87,6 +173,27 @@ func InitWithoutMetrics() {
 		*DataPath, time.Since(startTime).Seconds(), partsCount, blocksCount, rowsCount, sizeBytes)
 }
 
+// storageState is the current state of Storage. It is used for /ready checks.
+var storageState uint32
+
+const (
+	storageStateOpening = uint32(iota)
+	storageStateOpened
+	storageStateClosing
+)
+
+func checkStorageReady() error {
+	switch atomic.LoadUint32(&storageState) {
+	case storageStateOpened:
+		return nil
+	case storageStateClosing:
+		return fmt.Errorf("the storage at -storageDataPath=%q is being closed", *DataPath)
+	default:
+		// Storage caches are loaded while opening the storage, so they are ready when the storage is opened.
+		return fmt.Errorf("the storage at -storageDataPath=%q is being opened and its caches are being loaded", *DataPath)
+	}
+}
+
 // Storage is a storage.
 //
 // Every storage call must be wrapped into WG.Add(1) ... WG.Done()
@@ -106,14 +213,60 @@ func AddRows(mrs []storage.MetricRow) error {
 	return err
 }
 
+// RegisterMetricNames registers metric names from mrs in the storage without adding samples.
+func RegisterMetricNames(mrs []storage.MetricRow) error {
+	WG.Add(1)
+	err := Storage.RegisterMetricNames(mrs)
+	WG.Done()
+	return err
+}
+
 // DeleteMetrics deletes metrics matching tfss.
 //
 // Returns the number of deleted metrics.
 func DeleteMetrics(tfss []*storage.TagFilters) (int, error) {
 	WG.Add(1)
-	n, err := Storage.DeleteMetrics(tfss)
+	defer WG.Done()
+	if *snapshotBeforeDelete {
+		n, _, err := Storage.DeleteMetricsDryRun(tfss, 0)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, nil
+		}
+		snapshotName, err := Storage.CreateSnapshot()
+		if err != nil {
+			return 0, fmt.Errorf("cannot create snapshot before deleting %d time series: %w", n, err)
+		}
+		snapshotsBeforeDelete.Inc()
+		logger.Infof("created snapshot %q before deleting %d time series; it may be used for restoring the deleted time series", snapshotName, n)
+	}
+	return Storage.DeleteMetrics(tfss)
+}
+
+var snapshotsBeforeDelete = metrics.NewCounter(`vm_snapshots_before_delete_total`)
+
+// ResetTagFiltersCache resets the cache for tag filters -> metricIDs lookups.
+func ResetTagFiltersCache() {
+	WG.Add(1)
+	Storage.ResetTagFiltersCache()
 	WG.Done()
-	return n, err
+}
+
+// ResetMetricNameCache resets the cache for MetricID -> MetricName lookups.
+func ResetMetricNameCache() {
+	WG.Add(1)
+	Storage.ResetMetricNameCache()
+	WG.Done()
+}
+
+// DeleteMetricsDryRun returns the number of metrics matching tfss and up to maxMetricNames names of them without deleting anything.
+func DeleteMetricsDryRun(tfss []*storage.TagFilters, maxMetricNames int) (int, []storage.MetricName, error) {
+	WG.Add(1)
+	n, mns, err := Storage.DeleteMetricsDryRun(tfss, maxMetricNames)
+	WG.Done()
+	return n, mns, err
 }
 
 // SearchTagKeys searches for tag keys
@@ -132,6 +285,14 @@ func SearchTagValues(tagKey []byte, maxTagValues int, deadline uint64) ([]string
 	return values, err
 }
 
+// SearchTagValueSuggestions searches for tag values matching the given query for the given tagKey.
+func SearchTagValueSuggestions(tagKey, query []byte, substring bool, maxTagValues int, deadline uint64) ([]storage.TagValueSuggestion, error) {
+	WG.Add(1)
+	tvss, err := Storage.SearchTagValueSuggestions(tagKey, query, substring, maxTagValues, deadline)
+	WG.Done()
+	return tvss, err
+}
+
 // SearchTagEntries searches for tag entries.
 func SearchTagEntries(maxTagKeys, maxTagValues int, deadline uint64) ([]storage.TagEntry, error) {
 	WG.Add(1)
@@ -148,6 +309,14 @@ func GetTSDBStatusForDate(date uint64, topN int, deadline uint64) (*storage.TSDB
 	return status, err
 }
 
+// GetTSDBStatusWithFiltersForDate returns TSDB status for the given tfss, date and focusLabel.
+func GetTSDBStatusWithFiltersForDate(tfss []*storage.TagFilters, date uint64, topN int, focusLabel string, maxMetrics int, deadline uint64) (*storage.TSDBStatus, error) {
+	WG.Add(1)
+	status, err := Storage.GetTSDBStatusWithFiltersForDate(tfss, date, topN, focusLabel, maxMetrics, deadline)
+	WG.Done()
+	return status, err
+}
+
 // GetSeriesCount returns the number of time series in the storage.
 func GetSeriesCount(deadline uint64) (uint64, error) {
 	WG.Add(1)
@@ -156,10 +325,28 @@ func GetSeriesCount(deadline uint64) (uint64, error) {
 	return n, err
 }
 
+// GetSeriesCountWithFilters returns the number of time series matching tfss on the given tr.
+func GetSeriesCountWithFilters(tfss []*storage.TagFilters, tr storage.TimeRange, maxMetrics int, deadline uint64) (uint64, error) {
+	WG.Add(1)
+	n, err := Storage.GetSeriesCountWithFilters(tfss, tr, maxMetrics, deadline)
+	WG.Done()
+	return n, err
+}
+
+// SearchMetricNamesPage returns up to limit marshaled metric names matching tfss on the given tr,
+// which follow the series with afterMetricID, together with their metricIDs.
+func SearchMetricNamesPage(tfss []*storage.TagFilters, tr storage.TimeRange, afterMetricID uint64, limit, maxMetrics int, deadline uint64) ([]uint64, [][]byte, error) {
+	WG.Add(1)
+	metricIDs, metricNames, err := Storage.SearchMetricNamesPage(tfss, tr, afterMetricID, limit, maxMetrics, deadline)
+	WG.Done()
+	return metricIDs, metricNames, err
+}
+
 // Stop stops the vmstorage
 func Stop() {
 	logger.Infof("gracefully closing the storage at %s", *DataPath)
 	startTime := time.Now()
+	atomic.StoreUint32(&storageState, storageStateClosing)
 	WG.WaitAndBlock()
 	Storage.MustClose()
 	logger.Infof("successfully closed the storage in %.3f seconds", time.Since(startTime).Seconds())
@@ -170,6 +357,11 @@ func Stop() {
 // RequestHandler is a storage request handler.
 func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	path := r.URL.Path
+	if path == "/api/v1/admin/tsdb/partitions" {
+		w.Header().Set("Content-Type", "application/json")
+		writePartitionsResponse(w, Storage.ListPartitions())
+		return true
+	}
 	prometheusCompatibleResponse := false
 	if path == "/api/v1/admin/tsdb/snapshot" {
 		// Handle Prometheus API - https://prometheus.io/docs/prometheus/latest/querying/api/#snapshot .
@@ -181,6 +373,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 	authKey := r.FormValue("authKey")
 	if authKey != *snapshotAuthKey {
+		if action := getSnapshotAuditAction(path); action != "" {
+			auditlog.LogRequest(r, action, fmt.Errorf("invalid authKey"))
+		}
 		httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -snapshotAuthKey command line flag", authKey)
 		return true
 	}
@@ -190,6 +385,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	case "/create":
 		w.Header().Set("Content-Type", "application/json")
 		snapshotPath, err := Storage.CreateSnapshot()
+		auditlog.LogRequest(r, "snapshot_create", err)
 		if err != nil {
 			err = fmt.Errorf("cannot create snapshot: %w", err)
 			jsonResponseError(w, err)
@@ -221,7 +417,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	case "/delete":
 		w.Header().Set("Content-Type", "application/json")
 		snapshotName := r.FormValue("snapshot")
-		if err := Storage.DeleteSnapshot(snapshotName); err != nil {
+		err := Storage.DeleteSnapshot(snapshotName)
+		auditlog.LogRequest(r, "snapshot_delete", err)
+		if err != nil {
 			err = fmt.Errorf("cannot delete snapshot %q: %w", snapshotName, err)
 			jsonResponseError(w, err)
 			return true
@@ -233,16 +431,19 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		snapshots, err := Storage.ListSnapshots()
 		if err != nil {
 			err = fmt.Errorf("cannot list snapshots: %w", err)
+			auditlog.LogRequest(r, "snapshot_delete_all", err)
 			jsonResponseError(w, err)
 			return true
 		}
 		for _, snapshotName := range snapshots {
 			if err := Storage.DeleteSnapshot(snapshotName); err != nil {
 				err = fmt.Errorf("cannot delete snapshot %q: %w", snapshotName, err)
+				auditlog.LogRequest(r, "snapshot_delete_all", err)
 				jsonResponseError(w, err)
 				return true
 			}
 		}
+		auditlog.LogRequest(r, "snapshot_delete_all", nil)
 		fmt.Fprintf(w, `{"status":"ok"}`)
 		return true
 	default:
@@ -250,6 +451,35 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 }
 
+func writePartitionsResponse(w io.Writer, pss []storage.PartitionStats) {
+	fmt.Fprintf(w, `{"status":"success","data":[`)
+	for i := range pss {
+		ps := &pss[i]
+		if i > 0 {
+			fmt.Fprintf(w, `,`)
+		}
+		fmt.Fprintf(w, "\n"+`{"name":%q,"minTimestamp":%d,"maxTimestamp":%d,`+
+			`"smallParts":%d,"bigParts":%d,"smallRows":%d,"bigRows":%d,"smallSizeBytes":%d,"bigSizeBytes":%d,`+
+			`"pendingRows":%d,"activeSmallMerges":%d,"activeBigMerges":%d}`,
+			ps.Name, ps.MinTimestamp, ps.MaxTimestamp,
+			ps.SmallPartsCount, ps.BigPartsCount, ps.SmallRowsCount, ps.BigRowsCount, ps.SmallSizeBytes, ps.BigSizeBytes,
+			ps.PendingRows, ps.ActiveSmallMerges, ps.ActiveBigMerges)
+	}
+	fmt.Fprintf(w, "\n]}")
+}
+
+// getSnapshotAuditAction returns audit log action for the given snapshot path.
+//
+// An empty string is returned for read-only paths.
+func getSnapshotAuditAction(path string) string {
+	switch path {
+	case "/snapshot/create", "/snapshot/delete", "/snapshot/delete_all":
+		return "snapshot_" + path[len("/snapshot/"):]
+	default:
+		return ""
+	}
+}
+
 func registerStorageMetrics() {
 	mCache := &storage.Metrics{}
 	var mCacheLock sync.Mutex
@@ -279,6 +509,12 @@ func registerStorageMetrics() {
 	metrics.NewGauge(fmt.Sprintf(`vm_free_disk_space_bytes{path=%q}`, *DataPath), func() float64 {
 		return float64(fs.MustGetFreeSpace(*DataPath))
 	})
+	metrics.NewGauge(`vm_storage_is_read_only`, func() float64 {
+		if storage.IsReadOnly() {
+			return 1
+		}
+		return 0
+	})
 
 	metrics.NewGauge(`vm_active_merges{type="storage/big"}`, func() float64 {
 		return float64(tm().ActiveBigMerges)
@@ -316,6 +552,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_rows_deleted_total{type="storage/small"}`, func() float64 {
 		return float64(tm().SmallRowsDeleted)
 	})
+	metrics.NewGauge(`vm_rows_deleted_total{type="indexdb"}`, func() float64 {
+		return float64(idbm().ItemsDropped)
+	})
 
 	metrics.NewGauge(`vm_references{type="storage/big", name="parts"}`, func() float64 {
 		return float64(tm().BigPartsRefCount)
@@ -428,6 +667,15 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_concurrent_addrows_current`, func() float64 {
 		return float64(m().AddRowsConcurrencyCurrent)
 	})
+	metrics.NewGauge(`vm_concurrent_addrows_queue_full_total`, func() float64 {
+		return float64(m().AddRowsConcurrencyQueueFull)
+	})
+	metrics.NewGauge(`vm_concurrent_addrows_queue_capacity`, func() float64 {
+		return float64(m().AddRowsQueueCapacity)
+	})
+	metrics.NewGauge(`vm_concurrent_addrows_queue_current`, func() float64 {
+		return float64(m().AddRowsQueueCurrent)
+	})
 
 	metrics.NewGauge(`vm_concurrent_search_tsids_limit_reached_total`, func() float64 {
 		return float64(m().SearchTSIDsConcurrencyLimitReached)
@@ -445,6 +693,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_search_delays_total`, func() float64 {
 		return float64(m().SearchDelays)
 	})
+	metrics.NewGauge(`vm_merge_throttle_seconds_total`, func() float64 {
+		return float64(m().MergeThrottleDuration) / 1e9
+	})
 
 	metrics.NewGauge(`vm_slow_row_inserts_total`, func() float64 {
 		return float64(m().SlowRowInserts)
@@ -472,6 +723,18 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_date_range_hits_total`, func() float64 {
 		return float64(idbm().DateRangeSearchHits)
 	})
+	metrics.NewGauge(`vm_single_metric_name_search_calls_total`, func() float64 {
+		return float64(idbm().SingleMetricGroupSearchCalls)
+	})
+	metrics.NewGauge(`vm_single_metric_name_search_hits_total`, func() float64 {
+		return float64(idbm().SingleMetricGroupSearchHits)
+	})
+	metrics.NewGauge(`vm_index_search_memory_limit_exceeded_total`, func() float64 {
+		return float64(idbm().IndexSearchMemoryLimitExceeded)
+	})
+	metrics.NewGauge(`vm_too_many_timeseries_verdict_hits_total`, func() float64 {
+		return float64(idbm().TooManyMetricsVerdictHits)
+	})
 
 	metrics.NewGauge(`vm_missing_metric_names_for_metric_id_total`, func() float64 {
 		return float64(idbm().MissingMetricNamesForMetricID)
@@ -493,6 +756,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_entries{type="storage/metricName"}`, func() float64 {
 		return float64(m().MetricNameCacheSize)
 	})
+	metrics.NewGauge(`vm_cache_entries{type="storage/data_blocks"}`, func() float64 {
+		return float64(m().DataBlocksCacheSize)
+	})
 	metrics.NewGauge(`vm_cache_entries{type="storage/date_metricID"}`, func() float64 {
 		return float64(m().DateMetricIDCacheSize)
 	})
@@ -526,6 +792,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_entries{type="storage/prefetchedMetricIDs"}`, func() float64 {
 		return float64(m().PrefetchedMetricIDsSize)
 	})
+	metrics.NewGauge(`vm_cache_entries{type="indexdb/metricIDsPerDateTagFilter"}`, func() float64 {
+		return float64(idbm().MetricIDsPerDateTagFilterCacheSize)
+	})
 
 	metrics.NewGauge(`vm_cache_size_bytes{type="storage/tsid"}`, func() float64 {
 		return float64(m().TSIDCacheSizeBytes)
@@ -536,6 +805,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_size_bytes{type="storage/metricName"}`, func() float64 {
 		return float64(m().MetricNameCacheSizeBytes)
 	})
+	metrics.NewGauge(`vm_cache_size_bytes{type="storage/data_blocks"}`, func() float64 {
+		return float64(m().DataBlocksCacheSizeBytes)
+	})
 	metrics.NewGauge(`vm_cache_size_bytes{type="storage/date_metricID"}`, func() float64 {
 		return float64(m().DateMetricIDCacheSizeBytes)
 	})
@@ -554,6 +826,31 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_size_bytes{type="storage/prefetchedMetricIDs"}`, func() float64 {
 		return float64(m().PrefetchedMetricIDsSizeBytes)
 	})
+	metrics.NewGauge(`vm_cache_size_bytes{type="indexdb/metricIDsPerDateTagFilter"}`, func() float64 {
+		return float64(idbm().MetricIDsPerDateTagFilterCacheSizeBytes)
+	})
+
+	metrics.NewGauge(`vm_cache_size_max_bytes{type="storage/tsid"}`, func() float64 {
+		return float64(m().TSIDCacheSizeMaxBytes)
+	})
+	metrics.NewGauge(`vm_cache_size_max_bytes{type="storage/metricIDs"}`, func() float64 {
+		return float64(m().MetricIDCacheSizeMaxBytes)
+	})
+	metrics.NewGauge(`vm_cache_size_max_bytes{type="storage/metricName"}`, func() float64 {
+		return float64(m().MetricNameCacheSizeMaxBytes)
+	})
+	metrics.NewGauge(`vm_cache_size_max_bytes{type="storage/data_blocks"}`, func() float64 {
+		return float64(m().DataBlocksCacheSizeMaxBytes)
+	})
+	metrics.NewGauge(`vm_cache_size_max_bytes{type="indexdb/tagFilters"}`, func() float64 {
+		return float64(idbm().TagCacheSizeMaxBytes)
+	})
+	metrics.NewGauge(`vm_cache_size_max_bytes{type="indexdb/uselessTagFilters"}`, func() float64 {
+		return float64(idbm().UselessTagFiltersCacheSizeMaxBytes)
+	})
+	metrics.NewGauge(`vm_cache_size_max_bytes{type="indexdb/metricIDsPerDateTagFilter"}`, func() float64 {
+		return float64(idbm().MetricIDsPerDateTagFilterCacheSizeMaxBytes)
+	})
 
 	metrics.NewGauge(`vm_cache_requests_total{type="storage/tsid"}`, func() float64 {
 		return float64(m().TSIDCacheRequests)
@@ -564,6 +861,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_requests_total{type="storage/metricName"}`, func() float64 {
 		return float64(m().MetricNameCacheRequests)
 	})
+	metrics.NewGauge(`vm_cache_requests_total{type="storage/data_blocks"}`, func() float64 {
+		return float64(m().DataBlocksCacheRequests)
+	})
 	metrics.NewGauge(`vm_cache_requests_total{type="storage/bigIndexBlocks"}`, func() float64 {
 		return float64(tm().BigIndexBlocksCacheRequests)
 	})
@@ -582,6 +882,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_requests_total{type="indexdb/uselessTagFilters"}`, func() float64 {
 		return float64(idbm().UselessTagFiltersCacheRequests)
 	})
+	metrics.NewGauge(`vm_cache_requests_total{type="indexdb/metricIDsPerDateTagFilter"}`, func() float64 {
+		return float64(idbm().MetricIDsPerDateTagFilterCacheRequests)
+	})
 	metrics.NewGauge(`vm_cache_requests_total{type="storage/regexps"}`, func() float64 {
 		return float64(storage.RegexpCacheRequests())
 	})
@@ -595,6 +898,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_misses_total{type="storage/metricName"}`, func() float64 {
 		return float64(m().MetricNameCacheMisses)
 	})
+	metrics.NewGauge(`vm_cache_misses_total{type="storage/data_blocks"}`, func() float64 {
+		return float64(m().DataBlocksCacheMisses)
+	})
 	metrics.NewGauge(`vm_cache_misses_total{type="storage/bigIndexBlocks"}`, func() float64 {
 		return float64(tm().BigIndexBlocksCacheMisses)
 	})
@@ -613,6 +919,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_misses_total{type="indexdb/uselessTagFilters"}`, func() float64 {
 		return float64(idbm().UselessTagFiltersCacheMisses)
 	})
+	metrics.NewGauge(`vm_cache_misses_total{type="indexdb/metricIDsPerDateTagFilter"}`, func() float64 {
+		return float64(idbm().MetricIDsPerDateTagFilterCacheMisses)
+	})
 	metrics.NewGauge(`vm_cache_misses_total{type="storage/regexps"}`, func() float64 {
 		return float64(storage.RegexpCacheMisses())
 	})
@@ -620,6 +929,31 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_deleted_metrics_total{type="indexdb"}`, func() float64 {
 		return float64(idbm().DeletedMetricsCount)
 	})
+	metrics.NewGauge(`vm_deleted_metrics_carried_over_total{type="indexdb"}`, func() float64 {
+		return float64(m().DeletedMetricsCarriedOver)
+	})
+	metrics.NewGauge(`vm_deleted_metrics_expired_total{type="indexdb"}`, func() float64 {
+		return float64(m().DeletedMetricsExpired)
+	})
+	metrics.NewGauge(`vm_deleted_metrics_without_data_total{type="indexdb"}`, func() float64 {
+		return float64(m().DeletedMetricsWithoutData)
+	})
+
+	metrics.NewGauge(`vm_wal_writes_total`, func() float64 {
+		return float64(m().WALWrites)
+	})
+	metrics.NewGauge(`vm_wal_written_bytes_total`, func() float64 {
+		return float64(m().WALBytesWritten)
+	})
+	metrics.NewGauge(`vm_wal_syncs_total`, func() float64 {
+		return float64(m().WALSyncs)
+	})
+	metrics.NewGauge(`vm_wal_checkpoints_total`, func() float64 {
+		return float64(m().WALCheckpoints)
+	})
+	metrics.NewGauge(`vm_wal_replayed_rows_total`, func() float64 {
+		return float64(m().WALReplayedRows)
+	})
 
 	metrics.NewGauge(`vm_cache_collisions_total{type="storage/tsid"}`, func() float64 {
 		return float64(m().TSIDCacheCollisions)
@@ -627,6 +961,13 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_collisions_total{type="storage/metricName"}`, func() float64 {
 		return float64(m().MetricNameCacheCollisions)
 	})
+
+	metrics.NewGauge(`vm_cache_resets_total{type="storage/metricName"}`, func() float64 {
+		return float64(m().MetricNameCacheResets)
+	})
+	metrics.NewGauge(`vm_cache_resets_total{type="indexdb/tagFilters"}`, func() float64 {
+		return float64(m().TagFiltersCacheResets)
+	})
 }
 
 func jsonResponseError(w http.ResponseWriter, err error) {
@@ -28,4 +28,9 @@ require (
 	gopkg.in/yaml.v2 v2.3.0
 )
 
+// Use the fork of github.com/VictoriaMetrics/metricsql with support for MetricsQL extensions,
+// which aren't available in the upstream release yet. Drop the replacement after upgrading metricsql
+// to the upstream version containing these extensions.
+replace github.com/VictoriaMetrics/metricsql => ./third_party/metricsql
+
 go 1.13
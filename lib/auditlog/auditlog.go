@@ -0,0 +1,147 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var auditLogPath = flag.String("auditLog.path", "", "Path to file for audit log records about destructive and administrative calls such as "+
+	"series deletion, snapshot creation and deletion, cache reset and config reload. Records are written to stderr if empty")
+
+// Record is a single audit log record.
+type Record struct {
+	// Time is the time when the call has been finished.
+	Time string `json:"ts"`
+
+	// Action is the name of the performed action, e.g. delete_series.
+	Action string `json:"action"`
+
+	// Path is request path.
+	Path string `json:"path"`
+
+	// RemoteAddr is the address of the client, which initiated the action.
+	RemoteAddr string `json:"remoteAddr"`
+
+	// User is the username from Basic Auth request header if it is set.
+	User string `json:"user,omitempty"`
+
+	// Params contains request params. Secret params such as authKey are redacted.
+	Params url.Values `json:"params,omitempty"`
+
+	// Status is either ok or error.
+	Status string `json:"status"`
+
+	// Error is the error message for Status=error.
+	Error string `json:"error,omitempty"`
+}
+
+// LogRequest writes an audit log record for the given action performed by r.
+//
+// err must contain the error returned by the action if it failed.
+//
+// The record is written unconditionally, i.e. it cannot be disabled by request params.
+func LogRequest(r *http.Request, action string, err error) {
+	rec := &Record{
+		Time:       time.Now().UTC().Format(timeFormat),
+		Action:     action,
+		Path:       r.URL.Path,
+		RemoteAddr: getRemoteAddr(r),
+		Params:     getParams(r),
+		Status:     "ok",
+	}
+	if username, _, ok := r.BasicAuth(); ok {
+		rec.User = username
+	}
+	if err != nil {
+		rec.Status = "error"
+		rec.Error = err.Error()
+	}
+	writeRecord(rec)
+}
+
+const timeFormat = "2006-01-02T15:04:05.000Z0700"
+
+// secretParams contains param names, which must be redacted in audit log.
+var secretParams = map[string]bool{
+	"authKey": true,
+}
+
+func getParams(r *http.Request) url.Values {
+	// Do not call r.ParseForm here, since it may consume request body needed by the handler.
+	// The handlers parse the form before performing the action.
+	src := r.Form
+	if src == nil {
+		src = r.URL.Query()
+	}
+	if len(src) == 0 {
+		return nil
+	}
+	params := make(url.Values, len(src))
+	for k, vs := range src {
+		if secretParams[k] {
+			params[k] = []string{"***"}
+			continue
+		}
+		params[k] = append([]string{}, vs...)
+	}
+	return params
+}
+
+func getRemoteAddr(r *http.Request) string {
+	remoteAddr := r.RemoteAddr
+	if addr := r.Header.Get("X-Forwarded-For"); addr != "" {
+		remoteAddr += ", X-Forwarded-For: " + addr
+	}
+	return remoteAddr
+}
+
+func writeRecord(rec *Record) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal audit log record: %s", err)
+	}
+	data = append(data, '\n')
+
+	mu.Lock()
+	defer mu.Unlock()
+	if output == nil {
+		output = openOutput()
+	}
+	recordsWritten.Inc()
+	if _, err := output.Write(data); err != nil {
+		writeErrors.Inc()
+		logger.Errorf("cannot write audit log record %s to -auditLog.path=%q: %s", data, *auditLogPath, err)
+	}
+}
+
+func openOutput() io.Writer {
+	if len(*auditLogPath) == 0 {
+		return os.Stderr
+	}
+	f, err := os.OpenFile(*auditLogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		// Do not lose audit log records.
+		logger.Errorf("cannot open -auditLog.path=%q: %s; writing audit log records to stderr", *auditLogPath, err)
+		return os.Stderr
+	}
+	return f
+}
+
+var (
+	mu     sync.Mutex
+	output io.Writer
+)
+
+var (
+	recordsWritten = metrics.NewCounter(`vm_audit_log_records_total`)
+	writeErrors    = metrics.NewCounter(`vm_audit_log_write_errors_total`)
+)
@@ -0,0 +1,66 @@
+package auditlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestLogRequest(t *testing.T) {
+	var bb bytes.Buffer
+	mu.Lock()
+	output = &bb
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		output = nil
+		mu.Unlock()
+	}()
+
+	f := func(requestURI, action string, err error, recExpected *Record) {
+		t.Helper()
+		bb.Reset()
+		r := httptest.NewRequest("POST", requestURI, nil)
+		r.RemoteAddr = "1.2.3.4:5678"
+		r.SetBasicAuth("foo", "bar")
+		LogRequest(r, action, err)
+		var rec Record
+		if err := json.Unmarshal(bb.Bytes(), &rec); err != nil {
+			t.Fatalf("cannot unmarshal audit log record %q: %s", bb.Bytes(), err)
+		}
+		if rec.Time == "" {
+			t.Fatalf("missing ts in audit log record %q", bb.Bytes())
+		}
+		rec.Time = ""
+		if !reflect.DeepEqual(&rec, recExpected) {
+			t.Fatalf("unexpected audit log record\ngot\n%+v\nwant\n%+v", &rec, recExpected)
+		}
+	}
+
+	f("/api/v1/admin/tsdb/delete_series?match[]=foo&authKey=secret", "delete_series", nil, &Record{
+		Action:     "delete_series",
+		Path:       "/api/v1/admin/tsdb/delete_series",
+		RemoteAddr: "1.2.3.4:5678",
+		User:       "foo",
+		Params: url.Values{
+			"match[]": {"foo"},
+			"authKey": {"***"},
+		},
+		Status: "ok",
+	})
+	f("/snapshot/delete?snapshot=bar", "snapshot_delete", fmt.Errorf("cannot find snapshot"), &Record{
+		Action:     "snapshot_delete",
+		Path:       "/snapshot/delete",
+		RemoteAddr: "1.2.3.4:5678",
+		User:       "foo",
+		Params: url.Values{
+			"snapshot": {"bar"},
+		},
+		Status: "error",
+		Error:  "cannot find snapshot",
+	})
+}
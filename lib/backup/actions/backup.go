@@ -3,14 +3,18 @@ package actions
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/encryptedremote"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fsnil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/cespare/xxhash/v2"
 )
 
 // Backup performs backup according to the provided settings.
@@ -54,19 +58,140 @@ func (b *Backup) Run() error {
 		origin = &fsnil.FS{}
 	}
 
+	if _, ok := dst.(*encryptedremote.FS); !ok {
+		// Make sure encrypted backup at dst isn't replaced with unencrypted backup.
+		dstParts, err := dst.ListParts()
+		if err != nil {
+			return fmt.Errorf("cannot list dst parts: %w", err)
+		}
+		if err := checkEncryptedParts(dst, dstParts); err != nil {
+			return err
+		}
+	}
+
+	// Read checksums for parts from the previous backup at dst before deleting its manifest.
+	dstChecksums := readChecksums(dst)
+
 	if err := dst.DeleteFile(fscommon.BackupCompleteFilename); err != nil {
 		return fmt.Errorf("cannot delete `backup complete` file at %s: %w", dst, err)
 	}
-	if err := runBackup(src, dst, origin, concurrency); err != nil {
+	if err := dst.DeleteFile(fscommon.BackupManifestFilename); err != nil {
+		return fmt.Errorf("cannot delete manifest file at %s: %w", dst, err)
+	}
+	uploadedChecksums := &partChecksums{
+		pc: make(common.PartChecksums),
+	}
+	srcParts, err := runBackup(src, dst, origin, concurrency, uploadedChecksums)
+	if err != nil {
+		return err
+	}
+	var originChecksums common.PartChecksums
+	if originFS, ok := origin.(common.RemoteFS); ok {
+		originChecksums = readChecksums(originFS)
+	}
+	m, err := newManifest(src, srcParts, concurrency, uploadedChecksums.pc, dstChecksums, originChecksums)
+	if err != nil {
 		return err
 	}
+	if err := dst.CreateFile(fscommon.BackupManifestFilename, m.Marshal()); err != nil {
+		return fmt.Errorf("cannot create manifest file at %s: %w", dst, err)
+	}
 	if err := dst.CreateFile(fscommon.BackupCompleteFilename, []byte("ok")); err != nil {
 		return fmt.Errorf("cannot create `backup complete` file at %s: %w", dst, err)
 	}
 	return nil
 }
 
-func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, concurrency int) error {
+// readChecksums returns part checksums from the manifest of complete backup at fs.
+//
+// nil is returned if the manifest is missing or broken.
+func readChecksums(fs common.RemoteFS) common.PartChecksums {
+	for _, filename := range []string{fscommon.BackupCompleteFilename, fscommon.BackupManifestFilename} {
+		ok, err := fs.HasFile(filename)
+		if err != nil {
+			logger.Warnf("cannot check for %q at %s: %s; part checksums will be calculated from local data", filename, fs, err)
+			return nil
+		}
+		if !ok {
+			return nil
+		}
+	}
+	data, err := fs.ReadFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		logger.Warnf("cannot read manifest at %s: %s; part checksums will be calculated from local data", fs, err)
+		return nil
+	}
+	m, err := common.UnmarshalManifest(data)
+	if err != nil {
+		logger.Warnf("cannot unmarshal manifest at %s: %s; part checksums will be calculated from local data", fs, err)
+		return nil
+	}
+	return m.GetChecksums()
+}
+
+// newManifest returns manifest for srcParts.
+//
+// Part checksums are taken from the given checksums maps. Missing checksums are calculated from src.
+func newManifest(src *fslocal.FS, srcParts []common.Part, concurrency int, checksumss ...common.PartChecksums) (*common.Manifest, error) {
+	cs := &partChecksums{
+		pc: make(common.PartChecksums, len(srcParts)),
+	}
+	var partsToHash []common.Part
+	for _, p := range srcParts {
+		found := false
+		for _, checksums := range checksumss {
+			if checksum, ok := checksums.Get(p); ok {
+				cs.set(p, checksum)
+				found = true
+				break
+			}
+		}
+		if !found {
+			partsToHash = append(partsToHash, p)
+		}
+	}
+	if len(partsToHash) > 0 {
+		hashSize := getPartsSize(partsToHash)
+		logger.Infof("calculating checksums for %d parts with %d bytes at %s", len(partsToHash), hashSize, src)
+		bytesHashed := uint64(0)
+		err := runParallel(concurrency, partsToHash, func(p common.Part) error {
+			rc, err := src.NewReadCloser(p)
+			if err != nil {
+				return fmt.Errorf("cannot create reader for %s from %s: %w", &p, src, err)
+			}
+			cr := newChecksumReader(&statReader{
+				r:         rc,
+				bytesRead: &bytesHashed,
+			})
+			_, err = io.Copy(ioutil.Discard, cr)
+			if err1 := rc.Close(); err1 != nil && err == nil {
+				err = err1
+			}
+			if err != nil {
+				return fmt.Errorf("cannot read %s from %s: %w", &p, src, err)
+			}
+			cs.set(p, cr.Sum64())
+			return nil
+		}, func(elapsed time.Duration) {
+			n := atomic.LoadUint64(&bytesHashed)
+			logger.Infof("calculated checksums for %d out of %d bytes at %s in %s", n, hashSize, src, elapsed)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var m common.Manifest
+	for _, p := range srcParts {
+		checksum, ok := cs.pc.Get(p)
+		if !ok {
+			logger.Panicf("BUG: missing checksum for %s", &p)
+		}
+		m.AddPart(p, checksum)
+	}
+	return &m, nil
+}
+
+func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, concurrency int, uploadedChecksums *partChecksums) ([]common.Part, error) {
 	startTime := time.Now()
 
 	logger.Infof("starting backup from %s to %s using origin %s", src, dst, origin)
@@ -74,17 +199,17 @@ func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, con
 	logger.Infof("obtaining list of parts at %s", src)
 	srcParts, err := src.ListParts()
 	if err != nil {
-		return fmt.Errorf("cannot list src parts: %w", err)
+		return nil, fmt.Errorf("cannot list src parts: %w", err)
 	}
 	logger.Infof("obtaining list of parts at %s", dst)
 	dstParts, err := dst.ListParts()
 	if err != nil {
-		return fmt.Errorf("cannot list dst parts: %w", err)
+		return nil, fmt.Errorf("cannot list dst parts: %w", err)
 	}
 	logger.Infof("obtaining list of parts at %s", origin)
 	originParts, err := origin.ListParts()
 	if err != nil {
-		return fmt.Errorf("cannot list origin parts: %w", err)
+		return nil, fmt.Errorf("cannot list origin parts: %w", err)
 	}
 
 	backupSize := getPartsSize(srcParts)
@@ -106,10 +231,10 @@ func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, con
 			logger.Infof("deleted %d out of %d parts from %s in %s", n, len(partsToDelete), dst, elapsed)
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if err := dst.RemoveEmptyDirs(); err != nil {
-			return fmt.Errorf("cannot remove empty directories at %s: %w", dst, err)
+			return nil, fmt.Errorf("cannot remove empty directories at %s: %w", dst, err)
 		}
 	}
 
@@ -131,7 +256,7 @@ func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, con
 			logger.Infof("server-side copied %d out of %d parts from %s to %s in %s", n, len(originCopyParts), origin, dst, elapsed)
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -146,30 +271,31 @@ func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, con
 			if err != nil {
 				return fmt.Errorf("cannot create reader for %s from %s: %w", &p, src, err)
 			}
-			sr := &statReader{
+			cr := newChecksumReader(&statReader{
 				r:         rc,
 				bytesRead: &bytesUploaded,
-			}
-			if err := dst.UploadPart(p, sr); err != nil {
+			})
+			if err := dst.UploadPart(p, cr); err != nil {
 				return fmt.Errorf("cannot upload %s to %s: %w", &p, dst, err)
 			}
 			if err = rc.Close(); err != nil {
 				return fmt.Errorf("cannot close reader for %s from %s: %w", &p, src, err)
 			}
+			uploadedChecksums.set(p, cr.Sum64())
 			return nil
 		}, func(elapsed time.Duration) {
 			n := atomic.LoadUint64(&bytesUploaded)
 			logger.Infof("uploaded %d out of %d bytes from %s to %s in %s", n, uploadSize, src, dst, elapsed)
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	logger.Infof("backed up %d bytes in %.3f seconds; deleted %d bytes; server-side copied %d bytes; uploaded %d bytes",
 		backupSize, time.Since(startTime).Seconds(), deleteSize, copySize, uploadSize)
 
-	return nil
+	return srcParts, nil
 }
 
 type statReader struct {
@@ -182,3 +308,39 @@ func (sr *statReader) Read(p []byte) (int, error) {
 	atomic.AddUint64(sr.bytesRead, uint64(n))
 	return n, err
 }
+
+// checksumReader calculates checksum for the data read from r.
+type checksumReader struct {
+	r io.Reader
+	d *xxhash.Digest
+}
+
+func newChecksumReader(r io.Reader) *checksumReader {
+	return &checksumReader{
+		r: r,
+		d: xxhash.New(),
+	}
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	_, _ = cr.d.Write(p[:n])
+	return n, err
+}
+
+// Sum64 returns checksum for the data read from cr.
+func (cr *checksumReader) Sum64() uint64 {
+	return cr.d.Sum64()
+}
+
+// partChecksums holds part checksums, which may be set from concurrently running goroutines.
+type partChecksums struct {
+	mu sync.Mutex
+	pc common.PartChecksums
+}
+
+func (pcs *partChecksums) set(p common.Part, checksum uint64) {
+	pcs.mu.Lock()
+	pcs.pc.Set(p, checksum)
+	pcs.mu.Unlock()
+}
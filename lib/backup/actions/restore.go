@@ -3,6 +3,7 @@ package actions
 import (
 	"fmt"
 	"io"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -35,6 +36,12 @@ type Restore struct {
 	//
 	// This may be needed for restoring from old backups with missing `backup complete` file.
 	SkipBackupCompleteCheck bool
+
+	// Partitions may contain monthly partition names in the form YYYY_MM for restoring only the given partitions.
+	//
+	// All the partitions are restored if Partitions is empty.
+	// indexdb is always restored in full, since it is shared among all the partitions.
+	Partitions []string
 }
 
 // Run runs r with the provided settings.
@@ -73,6 +80,13 @@ func (r *Restore) Run() error {
 	if err != nil {
 		return fmt.Errorf("cannot list src parts: %w", err)
 	}
+	if err := checkEncryptedParts(src, srcParts); err != nil {
+		return err
+	}
+	if len(r.Partitions) > 0 {
+		srcParts = filterPartitionParts(srcParts, r.Partitions)
+		logger.Infof("restoring only %d parts for partitions %q from %s", len(srcParts), r.Partitions, src)
+	}
 	logger.Infof("obtaining list of parts at %s", dst)
 	dstParts, err := dst.ListParts()
 	if err != nil {
@@ -195,6 +209,42 @@ func (r *Restore) Run() error {
 	return nil
 }
 
+// filterPartitionParts returns parts, which belong to the given partitions.
+//
+// Parts outside data/small and data/big dirs are always returned, since they are shared among all the partitions.
+func filterPartitionParts(parts []common.Part, partitions []string) []common.Part {
+	m := make(map[string]bool, len(partitions))
+	for _, partition := range partitions {
+		m[partition] = true
+	}
+	var dst []common.Part
+	for _, p := range parts {
+		partition := getPartitionName(p.Path)
+		if partition == "" || m[partition] {
+			dst = append(dst, p)
+		}
+	}
+	return dst
+}
+
+// getPartitionName returns partition name for the given path.
+//
+// Empty string is returned if the path doesn't belong to data/small or data/big dirs.
+func getPartitionName(path string) string {
+	for _, prefix := range []string{"data/small/", "data/big/"} {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		tail := path[len(prefix):]
+		n := strings.IndexByte(tail, '/')
+		if n < 0 {
+			return ""
+		}
+		return tail[:n]
+	}
+	return ""
+}
+
 type statWriter struct {
 	w            io.Writer
 	bytesWritten *uint64
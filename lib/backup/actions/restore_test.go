@@ -0,0 +1,88 @@
+package actions
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+)
+
+func TestFilterPartitionParts(t *testing.T) {
+	f := func(paths, partitions, pathsExpected []string) {
+		t.Helper()
+		var parts []common.Part
+		for _, path := range paths {
+			parts = append(parts, common.Part{
+				Path: path,
+			})
+		}
+		var resultPaths []string
+		for _, p := range filterPartitionParts(parts, partitions) {
+			resultPaths = append(resultPaths, p.Path)
+		}
+		if !reflect.DeepEqual(resultPaths, pathsExpected) {
+			t.Fatalf("unexpected paths; got\n%q\nwant\n%q", resultPaths, pathsExpected)
+		}
+	}
+
+	// Empty parts
+	f(nil, []string{"2020_01"}, nil)
+
+	// Matching partitions
+	f([]string{
+		"data/small/2020_01/part1/index.bin",
+		"data/big/2020_01/part2/index.bin",
+		"data/small/2020_02/part3/index.bin",
+		"data/big/2020_03/part4/index.bin",
+	}, []string{"2020_01", "2020_03"}, []string{
+		"data/small/2020_01/part1/index.bin",
+		"data/big/2020_01/part2/index.bin",
+		"data/big/2020_03/part4/index.bin",
+	})
+
+	// Non-matching partitions
+	f([]string{
+		"data/small/2020_01/part1/index.bin",
+		"data/big/2020_02/part2/index.bin",
+	}, []string{"2020_03"}, nil)
+
+	// No partitions
+	f([]string{
+		"data/small/2020_01/part1/index.bin",
+	}, nil, nil)
+
+	// Partition names must match exactly
+	f([]string{
+		"data/small/2020_01/part1/index.bin",
+		"data/small/2020_011/part2/index.bin",
+	}, []string{"2020_0", "2020_01"}, []string{
+		"data/small/2020_01/part1/index.bin",
+	})
+
+	// Paths outside data/small and data/big are always restored
+	f([]string{
+		"indexdb/1234/part1/index.bin",
+		"snapshots/2020_01/part2/index.bin",
+		"data/2020_01/part3/index.bin",
+		"data/small/2020_02/part4/index.bin",
+	}, []string{"2020_01"}, []string{
+		"indexdb/1234/part1/index.bin",
+		"snapshots/2020_01/part2/index.bin",
+		"data/2020_01/part3/index.bin",
+	})
+
+	// Malformed paths without partition name are always restored
+	f([]string{
+		"data/small",
+		"data/small/",
+		"data/big/2020_02",
+		"data/big//part1/index.bin",
+		"data/smallest/2020_02/part2/index.bin",
+	}, []string{"2020_01"}, []string{
+		"data/small",
+		"data/small/",
+		"data/big/2020_02",
+		"data/big//part1/index.bin",
+		"data/smallest/2020_02/part2/index.bin",
+	})
+}
@@ -8,9 +8,11 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/encryptedremote"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fsremote"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/gcsremote"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/s3remote"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/swiftremote"
 )
 
 var (
@@ -21,6 +23,13 @@ var (
 	configProfile = flag.String("configProfile", "", "Profile name for S3 configs. If no set, the value of the environment variable will be loaded (AWS_PROFILE or AWS_DEFAULT_PROFILE), "+
 		"or if both not set, DefaultSharedConfigProfile is used")
 	customS3Endpoint = flag.String("customS3Endpoint", "", "Custom S3 endpoint for use with S3-compatible storages (e.g. MinIO). S3 is used if not set")
+	s3ForcePathStyle = flag.Bool("s3ForcePathStyle", true, "Whether to use path-style addressing (http://endpoint/bucket/key) for -customS3Endpoint. "+
+		"Set it to false for S3-compatible storages, which support only virtual-hosted-style addressing (http://bucket.endpoint/key)")
+	s3RoleARN = flag.String("s3RoleARN", "", "Optional ARN of the role to assume for accessing S3. The role is assumed with the credentials loaded from -credsFilePath "+
+		"or from default locations. See https://docs.aws.amazon.com/IAM/latest/UserGuide/id_roles_use.html")
+	encryptionKeyFile = flag.String("encryptionKeyFile", "", "Optional path to file with base64-encoded 32-byte keys for client-side AES-256-GCM encryption of backup parts, one key per line. "+
+		"The first key is used for encrypting new parts, while all the keys are used for decrypting parts, so keys can be rotated by adding a new key to the top of the file. "+
+		"Backup parts aren't encrypted if the flag isn't set")
 )
 
 func runParallel(concurrency int, parts []common.Part, f func(p common.Part) error, progress func(elapsed time.Duration)) error {
@@ -176,13 +185,46 @@ func getPartsSize(parts []common.Part) uint64 {
 }
 
 // NewRemoteFS returns new remote fs from the given path.
+//
+// The returned fs encrypts and decrypts backup parts if -encryptionKeyFile is set.
 func NewRemoteFS(path string) (common.RemoteFS, error) {
+	fs, err := newRemoteFS(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(*encryptionKeyFile) == 0 {
+		return fs, nil
+	}
+	efs := &encryptedremote.FS{
+		FS:          fs,
+		KeyFilePath: *encryptionKeyFile,
+	}
+	if err := efs.Init(); err != nil {
+		return nil, fmt.Errorf("cannot initialize encryption for %s: %w", fs, err)
+	}
+	return efs, nil
+}
+
+// checkEncryptedParts verifies that parts obtained from fs can be decrypted.
+func checkEncryptedParts(fs common.RemoteFS, parts []common.Part) error {
+	if _, ok := fs.(*encryptedremote.FS); ok {
+		return nil
+	}
+	for _, p := range parts {
+		if encryptedremote.IsEncryptedPart(p) {
+			return fmt.Errorf("%s contains encrypted %s; pass -encryptionKeyFile with the encryption keys", fs, &p)
+		}
+	}
+	return nil
+}
+
+func newRemoteFS(path string) (common.RemoteFS, error) {
 	if len(path) == 0 {
 		return nil, fmt.Errorf("path cannot be empty")
 	}
 	n := strings.Index(path, "://")
 	if n < 0 {
-		return nil, fmt.Errorf("Missing scheme in path %q. Supported schemes: `gcs://`, `s3://`, `fs://`", path)
+		return nil, fmt.Errorf("Missing scheme in path %q. Supported schemes: `gcs://`, `s3://`, `swift://`, `fs://`", path)
 	}
 	scheme := path[:n]
 	dir := path[n+len("://"):]
@@ -223,6 +265,8 @@ func NewRemoteFS(path string) (common.RemoteFS, error) {
 			ConfigFilePath: *configFilePath,
 			CustomEndpoint: *customS3Endpoint,
 			ProfileName:    *configProfile,
+			ForcePathStyle: *s3ForcePathStyle,
+			RoleARN:        *s3RoleARN,
 			Bucket:         bucket,
 			Dir:            dir,
 		}
@@ -230,6 +274,21 @@ func NewRemoteFS(path string) (common.RemoteFS, error) {
 			return nil, fmt.Errorf("cannot initialize connection to s3: %w", err)
 		}
 		return fs, nil
+	case "swift":
+		n := strings.Index(dir, "/")
+		if n < 0 {
+			return nil, fmt.Errorf("missing directory on the swift container %q", dir)
+		}
+		container := dir[:n]
+		dir = dir[n:]
+		fs := &swiftremote.FS{
+			Container: container,
+			Dir:       dir,
+		}
+		if err := fs.Init(); err != nil {
+			return nil, fmt.Errorf("cannot initialize connection to swift: %w", err)
+		}
+		return fs, nil
 	default:
 		return nil, fmt.Errorf("unsupported scheme %q", scheme)
 	}
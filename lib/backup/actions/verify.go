@@ -0,0 +1,257 @@
+package actions
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/cespare/xxhash/v2"
+)
+
+// Verify verifies backup consistency according to the provided settings.
+//
+// The backup parts are checked against the backup manifest using only remote storage listing,
+// so the backup data isn't downloaded except of parts selected for checksum verification.
+type Verify struct {
+	// Concurrency is the number of concurrent workers during checksum verification.
+	// Concurrency=1 by default.
+	Concurrency int
+
+	// Src is the backup to verify.
+	Src common.RemoteFS
+
+	// ChecksumPercent is the percentage of randomly selected parts to download for checksum verification.
+	//
+	// At least a single part is verified if ChecksumPercent is greater than 0.
+	ChecksumPercent float64
+}
+
+// Run runs v with the provided settings.
+func (v *Verify) Run() error {
+	startTime := time.Now()
+	src := v.Src
+
+	logger.Infof("starting verification of the backup at %s", src)
+	ok, err := src.HasFile(fscommon.BackupCompleteFilename)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot find %s file in %s; this means either incomplete backup or old backup; "+
+			"incomplete backups cannot be verified", fscommon.BackupCompleteFilename, src)
+	}
+	ok, err = src.HasFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot find %s file in %s; this means the backup was made by vmbackup without manifest support; "+
+			"make a new backup in order to be able to verify it", fscommon.BackupManifestFilename, src)
+	}
+	data, err := src.ReadFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		return fmt.Errorf("cannot read manifest at %s: %w", src, err)
+	}
+	m, err := common.UnmarshalManifest(data)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal manifest at %s: %w", src, err)
+	}
+
+	logger.Infof("obtaining list of parts at %s", src)
+	parts, err := src.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list src parts: %w", err)
+	}
+	if err := checkEncryptedParts(src, parts); err != nil {
+		return err
+	}
+	problems := checkManifest(m)
+	problems = append(problems, checkParts(m, parts)...)
+	for _, problem := range problems {
+		logger.Errorf("%s: %s", src, problem)
+	}
+
+	checksumParts := selectChecksumParts(m, parts, v.ChecksumPercent)
+	checksumProblems, err := verifyChecksums(src, checksumParts, v.Concurrency)
+	if err != nil {
+		return err
+	}
+	problems = append(problems, checksumProblems...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems in the backup at %s; see the log above for details", len(problems), src)
+	}
+	logger.Infof("verified the backup at %s with %d parts and %d bytes in %.3f seconds; checksums for %d parts with %d bytes are correct",
+		src, len(m.Parts), getPartsSize(parts), time.Since(startTime).Seconds(), len(checksumParts), getManifestPartsSize(checksumParts))
+	return nil
+}
+
+// checkManifest returns problems for inconsistent manifest m.
+func checkManifest(m *common.Manifest) []string {
+	var problems []string
+	if len(m.Parts) == 0 {
+		problems = append(problems, "manifest contains no parts")
+	}
+	perPath := make(map[string][]common.ManifestPart)
+	for _, mp := range m.Parts {
+		perPath[mp.Path] = append(perPath[mp.Path], mp)
+	}
+	paths := make([]string, 0, len(perPath))
+	for path := range perPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		mps := perPath[path]
+		sort.Slice(mps, func(i, j int) bool {
+			return mps[i].Offset < mps[j].Offset
+		})
+		fileSize := mps[0].FileSize
+		offset := uint64(0)
+		isConsistent := true
+		for _, mp := range mps {
+			if mp.FileSize != fileSize {
+				problems = append(problems, fmt.Sprintf("file %q has parts with distinct file sizes: %d and %d", path, fileSize, mp.FileSize))
+				isConsistent = false
+				break
+			}
+			if mp.Offset != offset {
+				problems = append(problems, fmt.Sprintf("file %q has a gap or an overlap at offset %d; the part starts at offset %d", path, offset, mp.Offset))
+				isConsistent = false
+				break
+			}
+			if mp.Size > common.MaxPartSize {
+				problems = append(problems, fmt.Sprintf("file %q has too big part at offset %d: %d bytes; the maximum part size is %d bytes",
+					path, mp.Offset, mp.Size, common.MaxPartSize))
+			}
+			offset += mp.Size
+		}
+		if isConsistent && offset != fileSize {
+			problems = append(problems, fmt.Sprintf("file %q parts cover %d bytes out of %d bytes", path, offset, fileSize))
+		}
+	}
+	return problems
+}
+
+// checkParts returns problems found when comparing parts obtained from remote storage with manifest m.
+func checkParts(m *common.Manifest, parts []common.Part) []string {
+	var problems []string
+	existing := make(common.PartChecksums, len(parts))
+	for _, p := range parts {
+		existing.Set(p, 0)
+	}
+	var missingParts []common.Part
+	for i := range m.Parts {
+		p := m.Parts[i].Part()
+		if _, ok := existing.Get(p); !ok {
+			missingParts = append(missingParts, p)
+		}
+	}
+	common.SortParts(missingParts)
+	for i := range missingParts {
+		problems = append(problems, fmt.Sprintf("missing %s", &missingParts[i]))
+	}
+	checksums := m.GetChecksums()
+	var unexpectedParts []common.Part
+	for _, p := range parts {
+		if _, ok := checksums.Get(p); !ok {
+			unexpectedParts = append(unexpectedParts, p)
+		} else if p.ActualSize != p.Size {
+			problems = append(problems, fmt.Sprintf("broken %s: its actual size is %d bytes", &p, p.ActualSize))
+		}
+	}
+	common.SortParts(unexpectedParts)
+	for i := range unexpectedParts {
+		problems = append(problems, fmt.Sprintf("unexpected %s, which is missing in manifest", &unexpectedParts[i]))
+	}
+	return problems
+}
+
+// selectChecksumParts returns randomly selected parts from m for checksum verification.
+//
+// Only parts, which exist in parts, are selected.
+func selectChecksumParts(m *common.Manifest, parts []common.Part, percent float64) []common.ManifestPart {
+	if percent <= 0 {
+		return nil
+	}
+	existing := make(common.PartChecksums, len(parts))
+	for _, p := range parts {
+		if p.ActualSize == p.Size {
+			existing.Set(p, 0)
+		}
+	}
+	var candidates []common.ManifestPart
+	for _, mp := range m.Parts {
+		if _, ok := existing.Get(mp.Part()); ok {
+			candidates = append(candidates, mp)
+		}
+	}
+	n := int(math.Ceil(float64(len(candidates)) * percent / 100))
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates[:n]
+}
+
+// verifyChecksums downloads mps from src and returns problems for parts with checksum mismatch.
+func verifyChecksums(src common.RemoteFS, mps []common.ManifestPart, concurrency int) ([]string, error) {
+	if len(mps) == 0 {
+		return nil, nil
+	}
+	parts := make([]common.Part, len(mps))
+	expectedChecksums := make(common.PartChecksums, len(mps))
+	for i := range mps {
+		parts[i] = mps[i].Part()
+		expectedChecksums.Set(parts[i], mps[i].Checksum)
+	}
+	downloadSize := getPartsSize(parts)
+	logger.Infof("verifying checksums for %d randomly selected parts with %d bytes at %s", len(parts), downloadSize, src)
+
+	var problemsLock sync.Mutex
+	var problems []string
+	bytesDownloaded := uint64(0)
+	err := runParallel(concurrency, parts, func(p common.Part) error {
+		d := xxhash.New()
+		sw := &statWriter{
+			w:            d,
+			bytesWritten: &bytesDownloaded,
+		}
+		if err := src.DownloadPart(p, sw); err != nil {
+			return fmt.Errorf("cannot download %s from %s: %w", &p, src, err)
+		}
+		checksumExpected, _ := expectedChecksums.Get(p)
+		if checksum := d.Sum64(); checksum != checksumExpected {
+			problem := fmt.Sprintf("checksum mismatch for %s: got %016X; want %016X", &p, checksum, checksumExpected)
+			logger.Errorf("%s: %s", src, problem)
+			problemsLock.Lock()
+			problems = append(problems, problem)
+			problemsLock.Unlock()
+		}
+		return nil
+	}, func(elapsed time.Duration) {
+		n := atomic.LoadUint64(&bytesDownloaded)
+		logger.Infof("verified checksums for %d out of %d bytes from %s in %s", n, downloadSize, src, elapsed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
+func getManifestPartsSize(mps []common.ManifestPart) uint64 {
+	n := uint64(0)
+	for _, mp := range mps {
+		n += mp.Size
+	}
+	return n
+}
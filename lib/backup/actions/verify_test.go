@@ -0,0 +1,81 @@
+package actions
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+)
+
+func TestCheckManifest(t *testing.T) {
+	f := func(mps []common.ManifestPart, problemsExpected []string) {
+		t.Helper()
+		m := &common.Manifest{
+			Parts: mps,
+		}
+		problems := checkManifest(m)
+		if !reflect.DeepEqual(problems, problemsExpected) {
+			t.Fatalf("unexpected problems; got\n%q\nwant\n%q", problems, problemsExpected)
+		}
+	}
+
+	// Empty manifest
+	f(nil, []string{"manifest contains no parts"})
+
+	// Consistent manifest
+	f([]common.ManifestPart{
+		{Path: "foo", FileSize: 10, Offset: 0, Size: 10},
+		{Path: "bar", FileSize: 20, Offset: 15, Size: 5},
+		{Path: "bar", FileSize: 20, Offset: 0, Size: 15},
+	}, nil)
+
+	// Gap between parts
+	f([]common.ManifestPart{
+		{Path: "bar", FileSize: 20, Offset: 0, Size: 10},
+		{Path: "bar", FileSize: 20, Offset: 15, Size: 5},
+	}, []string{`file "bar" has a gap or an overlap at offset 10; the part starts at offset 15`})
+
+	// Incomplete file
+	f([]common.ManifestPart{
+		{Path: "bar", FileSize: 20, Offset: 0, Size: 10},
+	}, []string{`file "bar" parts cover 10 bytes out of 20 bytes`})
+
+	// Distinct file sizes
+	f([]common.ManifestPart{
+		{Path: "bar", FileSize: 20, Offset: 0, Size: 10},
+		{Path: "bar", FileSize: 30, Offset: 10, Size: 10},
+	}, []string{`file "bar" has parts with distinct file sizes: 20 and 30`})
+}
+
+func TestCheckParts(t *testing.T) {
+	f := func(mps []common.ManifestPart, parts []common.Part, problemsExpected []string) {
+		t.Helper()
+		m := &common.Manifest{
+			Parts: mps,
+		}
+		problems := checkParts(m, parts)
+		if !reflect.DeepEqual(problems, problemsExpected) {
+			t.Fatalf("unexpected problems; got\n%q\nwant\n%q", problems, problemsExpected)
+		}
+	}
+	mps := []common.ManifestPart{
+		{Path: "foo", FileSize: 10, Offset: 0, Size: 10, Checksum: 123},
+		{Path: "bar", FileSize: 20, Offset: 0, Size: 20, Checksum: 456},
+	}
+
+	// All the parts exist
+	f(mps, []common.Part{
+		{Path: "bar", FileSize: 20, Offset: 0, Size: 20, ActualSize: 20},
+		{Path: "foo", FileSize: 10, Offset: 0, Size: 10, ActualSize: 10},
+	}, nil)
+
+	// Missing, broken and unexpected parts
+	f(mps, []common.Part{
+		{Path: "bar", FileSize: 20, Offset: 0, Size: 20, ActualSize: 15},
+		{Path: "baz", FileSize: 5, Offset: 0, Size: 5, ActualSize: 5},
+	}, []string{
+		`missing part{path: "foo", file_size: 10, offset: 0, size: 10}`,
+		`broken part{path: "bar", file_size: 20, offset: 0, size: 20}: its actual size is 15 bytes`,
+		`unexpected part{path: "baz", file_size: 5, offset: 0, size: 5}, which is missing in manifest`,
+	})
+}
@@ -45,6 +45,9 @@ type RemoteFS interface {
 	// CreateFile creates filePath at RemoteFS and puts data into it.
 	CreateFile(filePath string, data []byte) error
 
+	// ReadFile returns the contents of filePath at RemoteFS.
+	ReadFile(filePath string) ([]byte, error)
+
 	// HasFile returns true if filePath exists at RemoteFS.
 	HasFile(filePath string) (bool, error)
 }
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// Manifest describes all the parts of a complete backup.
+//
+// Manifest is stored together with the backup, so the backup can be verified
+// without downloading its data.
+type Manifest struct {
+	Parts []ManifestPart `json:"parts"`
+}
+
+// ManifestPart describes a single part in Manifest.
+type ManifestPart struct {
+	Path     string `json:"path"`
+	FileSize uint64 `json:"file_size"`
+	Offset   uint64 `json:"offset"`
+	Size     uint64 `json:"size"`
+
+	// Checksum is xxhash64 of the part contents.
+	Checksum uint64 `json:"checksum"`
+}
+
+// Part returns Part for mp.
+func (mp *ManifestPart) Part() Part {
+	return Part{
+		Path:       mp.Path,
+		FileSize:   mp.FileSize,
+		Offset:     mp.Offset,
+		Size:       mp.Size,
+		ActualSize: mp.Size,
+	}
+}
+
+// AddPart adds p with the given checksum to m.
+func (m *Manifest) AddPart(p Part, checksum uint64) {
+	m.Parts = append(m.Parts, ManifestPart{
+		Path:     p.Path,
+		FileSize: p.FileSize,
+		Offset:   p.Offset,
+		Size:     p.Size,
+		Checksum: checksum,
+	})
+}
+
+// GetChecksums returns part checksums from m.
+func (m *Manifest) GetChecksums() PartChecksums {
+	pc := make(PartChecksums, len(m.Parts))
+	for i := range m.Parts {
+		mp := &m.Parts[i]
+		pc.Set(mp.Part(), mp.Checksum)
+	}
+	return pc
+}
+
+// PartChecksums maps parts to their checksums.
+type PartChecksums map[string]uint64
+
+// Get returns checksum for p from pc.
+func (pc PartChecksums) Get(p Part) (uint64, bool) {
+	checksum, ok := pc[p.checksumKey()]
+	return checksum, ok
+}
+
+// Set sets checksum for p in pc.
+func (pc PartChecksums) Set(p Part, checksum uint64) {
+	pc[p.checksumKey()] = checksum
+}
+
+// checksumKey returns key for p, which doesn't depend on p.ActualSize.
+func (p *Part) checksumKey() string {
+	return fmt.Sprintf("%s%016X%016X%016X", p.Path, p.FileSize, p.Offset, p.Size)
+}
+
+// Marshal returns marshaled m.
+func (m *Manifest) Marshal() []byte {
+	data, err := json.Marshal(m)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal manifest: %s", err)
+	}
+	return data
+}
+
+// UnmarshalManifest unmarshals Manifest from data.
+func UnmarshalManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %w", err)
+	}
+	return &m, nil
+}
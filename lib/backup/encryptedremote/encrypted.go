@@ -0,0 +1,186 @@
+package encryptedremote
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// PathSuffix is the suffix for paths of encrypted parts at remote storage.
+const PathSuffix = ".vmenc"
+
+// IsEncryptedPart returns true if p is an encrypted part obtained from remote storage without decryption.
+func IsEncryptedPart(p common.Part) bool {
+	return strings.HasSuffix(p.Path, PathSuffix)
+}
+
+// FS encrypts parts uploaded to the underlying remote filesystem and decrypts parts downloaded from it.
+//
+// Parts are encrypted with AES-256-GCM using per-part data keys, which are encrypted with the master key from the key file.
+// Backup files such as manifest are stored without encryption, since they contain only part names, sizes and checksums.
+type FS struct {
+	// FS is the underlying remote filesystem.
+	FS common.RemoteFS
+
+	// KeyFilePath is the path to file with base64-encoded master keys, one per line.
+	//
+	// The first key is used for encrypting new parts, while all the keys are used for decrypting parts.
+	// This allows rotating keys without re-encrypting already existing backups.
+	KeyFilePath string
+
+	ks *keySet
+
+	// plainParts contains unencrypted parts found by ListParts.
+	plainPartsLock sync.Mutex
+	plainParts     map[string]bool
+}
+
+// Init initializes fs.
+func (fs *FS) Init() error {
+	if fs.ks != nil {
+		logger.Panicf("BUG: Init is already called")
+	}
+	ks, err := readKeyFile(fs.KeyFilePath)
+	if err != nil {
+		return err
+	}
+	fs.ks = ks
+	fs.plainParts = make(map[string]bool)
+	return nil
+}
+
+// String returns human-readable description for fs.
+func (fs *FS) String() string {
+	return fmt.Sprintf("encrypted %s", fs.FS)
+}
+
+// ListParts returns all the parts from fs.
+//
+// Unencrypted parts are returned as broken parts, so they are re-uploaded by backup and aren't restored.
+func (fs *FS) ListParts() ([]common.Part, error) {
+	parts, err := fs.FS.ListParts()
+	if err != nil {
+		return nil, err
+	}
+	fs.plainPartsLock.Lock()
+	defer fs.plainPartsLock.Unlock()
+	for i := range parts {
+		p := &parts[i]
+		if !IsEncryptedPart(*p) {
+			logger.Warnf("found unencrypted %s at %s; it is treated as broken part", p, fs.FS)
+			fs.plainParts[plainPartKey(*p)] = true
+			p.ActualSize = brokenPartSize
+			continue
+		}
+		size, ok := plainSize(p.Size)
+		if !ok {
+			return nil, fmt.Errorf("unexpected size for encrypted %s at %s", p, fs.FS)
+		}
+		actualSize := size
+		if p.ActualSize != p.Size {
+			actualSize, ok = plainSize(p.ActualSize)
+			if !ok {
+				actualSize = brokenPartSize
+			}
+		}
+		p.Path = p.Path[:len(p.Path)-len(PathSuffix)]
+		p.Size = size
+		p.ActualSize = actualSize
+	}
+	return parts, nil
+}
+
+// brokenPartSize is the actual size reported for broken parts with unknown plaintext size.
+const brokenPartSize = 1<<64 - 1
+
+func plainPartKey(p common.Part) string {
+	return fmt.Sprintf("%s/%016X_%016X_%016X", p.Path, p.FileSize, p.Offset, p.Size)
+}
+
+func (fs *FS) isPlainPart(p common.Part) bool {
+	fs.plainPartsLock.Lock()
+	ok := fs.plainParts[plainPartKey(p)]
+	fs.plainPartsLock.Unlock()
+	return ok
+}
+
+// encryptedPart returns part at the underlying fs for the given part p.
+func encryptedPart(p common.Part) common.Part {
+	size := encryptedSize(p.Size)
+	return common.Part{
+		Path:       p.Path + PathSuffix,
+		FileSize:   p.FileSize,
+		Offset:     p.Offset,
+		Size:       size,
+		ActualSize: size,
+	}
+}
+
+// DeletePart deletes the given part p from fs.
+func (fs *FS) DeletePart(p common.Part) error {
+	if fs.isPlainPart(p) {
+		return fs.FS.DeletePart(p)
+	}
+	return fs.FS.DeletePart(encryptedPart(p))
+}
+
+// RemoveEmptyDirs recursively removes empty dirs in fs.
+func (fs *FS) RemoveEmptyDirs() error {
+	return fs.FS.RemoveEmptyDirs()
+}
+
+// CopyPart copies p from srcFS to fs.
+//
+// The part is copied as is without re-encryption, so its master key must be present in the key file for fs.
+func (fs *FS) CopyPart(srcFS common.OriginFS, p common.Part) error {
+	src, ok := srcFS.(*FS)
+	if !ok {
+		return fmt.Errorf("cannot perform server-side copying from %s to %s: both of them must be encrypted", srcFS, fs)
+	}
+	return fs.FS.CopyPart(src.FS, encryptedPart(p))
+}
+
+// DownloadPart downloads part p from fs to w.
+func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
+	dw := newDecryptWriter(fs.ks, w, p.Size)
+	if err := fs.FS.DownloadPart(encryptedPart(p), dw); err != nil {
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return fmt.Errorf("cannot decrypt %s downloaded from %s: %w", &p, fs, err)
+	}
+	return nil
+}
+
+// UploadPart uploads part p from r to fs.
+func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
+	er, err := newEncryptReader(fs.ks, r, p.Size)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt %s: %w", &p, err)
+	}
+	return fs.FS.UploadPart(encryptedPart(p), er)
+}
+
+// DeleteFile deletes filePath from fs.
+func (fs *FS) DeleteFile(filePath string) error {
+	return fs.FS.DeleteFile(filePath)
+}
+
+// CreateFile creates filePath at fs and puts data into it.
+func (fs *FS) CreateFile(filePath string, data []byte) error {
+	return fs.FS.CreateFile(filePath, data)
+}
+
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	return fs.FS.ReadFile(filePath)
+}
+
+// HasFile returns true if filePath exists at fs.
+func (fs *FS) HasFile(filePath string) (bool, error) {
+	return fs.FS.HasFile(filePath)
+}
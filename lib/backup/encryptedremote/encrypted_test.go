@@ -0,0 +1,301 @@
+package encryptedremote
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fsremote"
+)
+
+func newTestKey(n byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{n}, keySize))
+}
+
+func newTestFS(t *testing.T, dir string, keys ...string) *FS {
+	t.Helper()
+	keyFilePath := filepath.Join(dir, "keys")
+	data := "# test keys\n"
+	for _, key := range keys {
+		data += key + "\n"
+	}
+	if err := ioutil.WriteFile(keyFilePath, []byte(data), 0600); err != nil {
+		t.Fatalf("cannot write key file: %s", err)
+	}
+	fs := &FS{
+		FS: &fsremote.FS{
+			Dir: filepath.Join(dir, "backup"),
+		},
+		KeyFilePath: keyFilePath,
+	}
+	if err := fs.Init(); err != nil {
+		t.Fatalf("cannot initialize fs: %s", err)
+	}
+	return fs
+}
+
+func newTestPart(path string, size uint64) (common.Part, []byte) {
+	data := make([]byte, size)
+	rand.Read(data)
+	p := common.Part{
+		Path:       path,
+		FileSize:   size,
+		Size:       size,
+		ActualSize: size,
+	}
+	return p, data
+}
+
+func downloadPart(fs *FS, p common.Part) ([]byte, error) {
+	var bb bytes.Buffer
+	if err := fs.DownloadPart(p, &bb); err != nil {
+		return nil, err
+	}
+	return bb.Bytes(), nil
+}
+
+func TestFSUploadDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encryptedremote")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	fs := newTestFS(t, dir, newTestKey(1))
+
+	sizes := []uint64{0, 1, 100, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 123}
+	want := make(map[string][]byte)
+	for _, size := range sizes {
+		p, data := newTestPart(fmt.Sprintf("data/part_%d", size), size)
+		if err := fs.UploadPart(p, bytes.NewReader(data)); err != nil {
+			t.Fatalf("cannot upload %s: %s", &p, err)
+		}
+		want[p.Path] = data
+	}
+
+	parts, err := fs.ListParts()
+	if err != nil {
+		t.Fatalf("cannot list parts: %s", err)
+	}
+	if len(parts) != len(sizes) {
+		t.Fatalf("unexpected number of parts; got %d; want %d", len(parts), len(sizes))
+	}
+	for _, p := range parts {
+		data, ok := want[p.Path]
+		if !ok {
+			t.Fatalf("unexpected part %s", &p)
+		}
+		if p.Size != uint64(len(data)) || p.ActualSize != p.Size {
+			t.Fatalf("unexpected sizes for %s; got size=%d, actualSize=%d; want %d", &p, p.Size, p.ActualSize, len(data))
+		}
+		got, err := downloadPart(fs, p)
+		if err != nil {
+			t.Fatalf("cannot download %s: %s", &p, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("unexpected data for %s", &p)
+		}
+	}
+
+	// The uploaded data mustn't contain plaintext.
+	p, _ := newTestPart("data/plaintext", 0)
+	data := bytes.Repeat([]byte("foobar"), 100)
+	p.FileSize, p.Size, p.ActualSize = uint64(len(data)), uint64(len(data)), uint64(len(data))
+	if err := fs.UploadPart(p, bytes.NewReader(data)); err != nil {
+		t.Fatalf("cannot upload %s: %s", &p, err)
+	}
+	ep := encryptedPart(p)
+	raw, err := ioutil.ReadFile(ep.RemotePath(filepath.Join(dir, "backup")))
+	if err != nil {
+		t.Fatalf("cannot read encrypted part: %s", err)
+	}
+	if uint64(len(raw)) != encryptedSize(p.Size) {
+		t.Fatalf("unexpected encrypted part size; got %d; want %d", len(raw), encryptedSize(p.Size))
+	}
+	if bytes.Contains(raw, []byte("foobar")) {
+		t.Fatalf("encrypted part contains plaintext data")
+	}
+
+	// Upload must fail on too short data.
+	p, data = newTestPart("data/short", 100)
+	if err := fs.UploadPart(p, bytes.NewReader(data[:50])); err == nil {
+		t.Fatalf("expecting non-nil error when uploading too short data")
+	}
+}
+
+func TestFSKeyRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encryptedremote")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	keyOld := newTestKey(1)
+	keyNew := newTestKey(2)
+
+	fsOld := newTestFS(t, dir, keyOld)
+	pOld, dataOld := newTestPart("data/old", 1000)
+	if err := fsOld.UploadPart(pOld, bytes.NewReader(dataOld)); err != nil {
+		t.Fatalf("cannot upload %s: %s", &pOld, err)
+	}
+
+	// Add the new key to the top of the key file.
+	fsNew := newTestFS(t, dir, keyNew, keyOld)
+	pNew, dataNew := newTestPart("data/new", 1000)
+	if err := fsNew.UploadPart(pNew, bytes.NewReader(dataNew)); err != nil {
+		t.Fatalf("cannot upload %s: %s", &pNew, err)
+	}
+	for _, p := range []common.Part{pOld, pNew} {
+		if _, err := downloadPart(fsNew, p); err != nil {
+			t.Fatalf("cannot download %s after key rotation: %s", &p, err)
+		}
+	}
+
+	// Parts encrypted with the removed key cannot be decrypted.
+	fsNewOnly := newTestFS(t, dir, keyNew)
+	if _, err := downloadPart(fsNewOnly, pNew); err != nil {
+		t.Fatalf("cannot download %s: %s", &pNew, err)
+	}
+	if _, err := downloadPart(fsNewOnly, pOld); err == nil {
+		t.Fatalf("expecting non-nil error when downloading part encrypted with unknown key")
+	}
+}
+
+func TestFSBrokenParts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encryptedremote")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	fs := newTestFS(t, dir, newTestKey(1))
+	backupDir := filepath.Join(dir, "backup")
+
+	pCorrupted, data := newTestPart("data/corrupted", 2*chunkSize)
+	if err := fs.UploadPart(pCorrupted, bytes.NewReader(data)); err != nil {
+		t.Fatalf("cannot upload %s: %s", &pCorrupted, err)
+	}
+	pTruncated, data := newTestPart("data/truncated", 2*chunkSize)
+	if err := fs.UploadPart(pTruncated, bytes.NewReader(data)); err != nil {
+		t.Fatalf("cannot upload %s: %s", &pTruncated, err)
+	}
+	pPlain, data := newTestPart("data/plain", 100)
+	if err := fs.FS.UploadPart(pPlain, bytes.NewReader(data)); err != nil {
+		t.Fatalf("cannot upload %s: %s", &pPlain, err)
+	}
+
+	// Corrupt a single byte in the last chunk.
+	ep := encryptedPart(pCorrupted)
+	path := ep.RemotePath(backupDir)
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read encrypted part: %s", err)
+	}
+	raw[len(raw)-tagSize-1] ^= 1
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		t.Fatalf("cannot write encrypted part: %s", err)
+	}
+	if _, err := downloadPart(fs, pCorrupted); err == nil {
+		t.Fatalf("expecting non-nil error when downloading corrupted part")
+	}
+
+	// Remove the last chunk.
+	ep = encryptedPart(pTruncated)
+	path = ep.RemotePath(backupDir)
+	if err := os.Truncate(path, int64(encryptedSize(chunkSize))); err != nil {
+		t.Fatalf("cannot truncate encrypted part: %s", err)
+	}
+
+	parts, err := fs.ListParts()
+	if err != nil {
+		t.Fatalf("cannot list parts: %s", err)
+	}
+	common.SortParts(parts)
+	want := []common.Part{
+		{Path: "data/corrupted", FileSize: 2 * chunkSize, Size: 2 * chunkSize, ActualSize: 2 * chunkSize},
+		{Path: "data/plain", FileSize: 100, Size: 100, ActualSize: brokenPartSize},
+		{Path: "data/truncated", FileSize: 2 * chunkSize, Size: 2 * chunkSize, ActualSize: chunkSize},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("unexpected number of parts; got %d; want %d", len(parts), len(want))
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Fatalf("unexpected part #%d; got %+v; want %+v", i, parts[i], want[i])
+		}
+	}
+
+	// Broken parts must be deleted from the underlying fs.
+	for _, p := range parts[1:] {
+		if err := fs.DeletePart(p); err != nil {
+			t.Fatalf("cannot delete %s: %s", &p, err)
+		}
+	}
+	parts, err = fs.FS.ListParts()
+	if err != nil {
+		t.Fatalf("cannot list parts: %s", err)
+	}
+	if len(parts) != 1 || parts[0].Path != "data/corrupted"+PathSuffix {
+		t.Fatalf("unexpected parts left after the deletion: %+v", parts)
+	}
+}
+
+func TestPlainSize(t *testing.T) {
+	f := func(size uint64) {
+		t.Helper()
+		encSize := encryptedSize(size)
+		n, ok := plainSize(encSize)
+		if !ok {
+			t.Fatalf("cannot obtain plaintext size for encrypted size %d", encSize)
+		}
+		if n != size {
+			t.Fatalf("unexpected plaintext size for encrypted size %d; got %d; want %d", encSize, n, size)
+		}
+	}
+	for _, size := range []uint64{0, 1, 2, chunkSize - 1, chunkSize, chunkSize + 1, 2*chunkSize - 1, 2 * chunkSize, 1 << 30} {
+		f(size)
+	}
+
+	// Invalid sizes
+	for _, encSize := range []uint64{0, uint64(headerSize), uint64(headerSize) + tagSize - 1, encryptedSize(chunkSize) + 1, encryptedSize(chunkSize) + tagSize} {
+		if _, ok := plainSize(encSize); ok {
+			t.Fatalf("expecting invalid encrypted size %d", encSize)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	f := func(s string, keysExpected int) {
+		t.Helper()
+		ks, err := parseKeys(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(ks.keys) != keysExpected {
+			t.Fatalf("unexpected number of keys; got %d; want %d", len(ks.keys), keysExpected)
+		}
+	}
+	f(newTestKey(1), 1)
+	f("# comment\n\n  "+newTestKey(1)+"  \n"+newTestKey(2)+"\n", 2)
+
+	fError := func(s string) {
+		t.Helper()
+		if _, err := parseKeys(s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+	fError("")
+	fError("# comment only")
+	fError("not base64")
+	fError(base64.StdEncoding.EncodeToString([]byte("too short key")))
+	fError(newTestKey(1) + "\n" + newTestKey(1))
+}
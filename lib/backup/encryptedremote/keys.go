@@ -0,0 +1,145 @@
+package encryptedremote
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// keySize is the size of master keys and data keys. AES-256 is used.
+	keySize = 32
+
+	// keyIDSize is the size of key id stored in the header of every encrypted part.
+	keyIDSize = 8
+)
+
+type keyID [keyIDSize]byte
+
+// masterKey is used for wrapping per-part data keys (aka envelope encryption).
+type masterKey struct {
+	id   keyID
+	aead cipher.AEAD
+}
+
+// keySet holds master keys loaded from the key file.
+type keySet struct {
+	// keys contains master keys in the order they are listed in the key file.
+	//
+	// The first key is used for encrypting new parts. All the keys are used for decrypting parts.
+	keys []*masterKey
+}
+
+// readKeyFile reads master keys from the file at path.
+func readKeyFile(path string) (*keySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key file: %w", err)
+	}
+	ks, err := parseKeys(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse key file %q: %w", path, err)
+	}
+	return ks, nil
+}
+
+// parseKeys parses base64-encoded master keys from s.
+//
+// Every non-empty line in s must contain a single key. Lines starting with `#` are ignored.
+func parseKeys(s string) (*keySet, error) {
+	var ks keySet
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode base64-encoded key at line %d: %w", i+1, err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("unexpected key size at line %d; got %d bytes; want %d bytes", i+1, len(key), keySize)
+		}
+		mk, err := newMasterKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot initialize key at line %d: %w", i+1, err)
+		}
+		if ks.getKey(mk.id) != nil {
+			return nil, fmt.Errorf("duplicate key at line %d", i+1)
+		}
+		ks.keys = append(ks.keys, mk)
+	}
+	if len(ks.keys) == 0 {
+		return nil, fmt.Errorf("missing keys")
+	}
+	return &ks, nil
+}
+
+func newMasterKey(key []byte) (*masterKey, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	var id keyID
+	h := sha256.Sum256(key)
+	copy(id[:], h[:])
+	return &masterKey{
+		id:   id,
+		aead: aead,
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
+
+// encryptionKey returns the key for encrypting new parts.
+func (ks *keySet) encryptionKey() *masterKey {
+	return ks.keys[0]
+}
+
+// getKey returns the key with the given id.
+//
+// nil is returned if ks doesn't contain such a key.
+func (ks *keySet) getKey(id keyID) *masterKey {
+	for _, mk := range ks.keys {
+		if mk.id == id {
+			return mk
+		}
+	}
+	return nil
+}
+
+// wrapKey encrypts dataKey with mk and appends the result to dst.
+//
+// additionalData is authenticated together with dataKey.
+func (mk *masterKey) wrapKey(dst, dataKey, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, mk.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return dst, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+	dst = append(dst, nonce...)
+	return mk.aead.Seal(dst, nonce, dataKey, additionalData), nil
+}
+
+// unwrapKey decrypts data key wrapped with wrapKey.
+func (mk *masterKey) unwrapKey(wrappedKey, additionalData []byte) ([]byte, error) {
+	nonceSize := mk.aead.NonceSize()
+	if len(wrappedKey) < nonceSize {
+		return nil, fmt.Errorf("too short wrapped key; got %d bytes; want at least %d bytes", len(wrappedKey), nonceSize)
+	}
+	dataKey, err := mk.aead.Open(nil, wrappedKey[:nonceSize], wrappedKey[nonceSize:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt data key: %w", err)
+	}
+	return dataKey, nil
+}
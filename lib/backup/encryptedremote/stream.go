@@ -0,0 +1,257 @@
+package encryptedremote
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Encrypted part layout:
+//
+//	header: magic | version | key id | wrapped data key
+//	chunks: AES-256-GCM encrypted chunks of up to chunkSize plaintext bytes each
+//
+// Every part is encrypted with a random data key, which is encrypted (wrapped) with the master key identified by key id.
+// Every chunk is authenticated together with the header. Chunk nonce contains chunk index and the flag for the last chunk,
+// so chunks cannot be reordered, removed or appended without detection.
+const (
+	chunkSize = 64 * 1024
+	tagSize   = 16
+	nonceSize = 12
+
+	headerPrefixSize = len(headerMagic) + 1 + keyIDSize
+	wrappedKeySize   = nonceSize + keySize + tagSize
+	headerSize       = headerPrefixSize + wrappedKeySize
+)
+
+const (
+	headerMagic   = "VMBE"
+	formatVersion = 1
+)
+
+// encryptedSize returns the size of encrypted part for the given plaintext size.
+func encryptedSize(plainSize uint64) uint64 {
+	chunks := (plainSize + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		// Empty part contains a single empty chunk.
+		chunks = 1
+	}
+	return uint64(headerSize) + plainSize + chunks*tagSize
+}
+
+// plainSize returns plaintext size for the given encrypted part size.
+//
+// false is returned if encSize cannot be obtained from encryptedSize.
+func plainSize(encSize uint64) (uint64, bool) {
+	if encSize < uint64(headerSize)+tagSize {
+		return 0, false
+	}
+	n := encSize - uint64(headerSize)
+	chunks := (n + chunkSize + tagSize - 1) / (chunkSize + tagSize)
+	n -= chunks * tagSize
+	if encryptedSize(n) != encSize {
+		return 0, false
+	}
+	return n, true
+}
+
+func marshalHeader(mk *masterKey, dataKey []byte) ([]byte, error) {
+	dst := make([]byte, 0, headerSize)
+	dst = append(dst, headerMagic...)
+	dst = append(dst, formatVersion)
+	dst = append(dst, mk.id[:]...)
+	dst, err := mk.wrapKey(dst, dataKey, dst[:headerPrefixSize])
+	if err != nil {
+		return nil, err
+	}
+	if len(dst) != headerSize {
+		return nil, fmt.Errorf("BUG: unexpected header size; got %d bytes; want %d bytes", len(dst), headerSize)
+	}
+	return dst, nil
+}
+
+// unmarshalHeader parses header and returns data key from it.
+func unmarshalHeader(ks *keySet, header []byte) ([]byte, error) {
+	if len(header) != headerSize {
+		return nil, fmt.Errorf("unexpected header size; got %d bytes; want %d bytes", len(header), headerSize)
+	}
+	if string(header[:len(headerMagic)]) != headerMagic {
+		return nil, fmt.Errorf("unexpected header magic %q; want %q", header[:len(headerMagic)], headerMagic)
+	}
+	if v := header[len(headerMagic)]; v != formatVersion {
+		return nil, fmt.Errorf("unsupported format version %d; want %d", v, formatVersion)
+	}
+	var id keyID
+	copy(id[:], header[len(headerMagic)+1:])
+	mk := ks.getKey(id)
+	if mk == nil {
+		return nil, fmt.Errorf("cannot find key with id %X in the key file; the part has been encrypted with unknown key", id[:])
+	}
+	return mk.unwrapKey(header[headerPrefixSize:], header[:headerPrefixSize])
+}
+
+func marshalChunkNonce(dst []byte, n uint64, isLast bool) []byte {
+	var buf [nonceSize]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	if isLast {
+		buf[nonceSize-1] = 1
+	}
+	return append(dst[:0], buf[:]...)
+}
+
+// encryptReader encrypts plaintext part with the given size read from r.
+type encryptReader struct {
+	r         io.Reader
+	remaining uint64
+	aead      cipher.AEAD
+	header    []byte
+
+	chunkN uint64
+	isLast bool
+	nonce  []byte
+	buf    []byte
+
+	// pending contains encrypted data, which wasn't read yet.
+	pending []byte
+}
+
+func newEncryptReader(ks *keySet, r io.Reader, size uint64) (*encryptReader, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("cannot generate data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header, err := marshalHeader(ks.encryptionKey(), dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptReader{
+		r:         r,
+		remaining: size,
+		aead:      aead,
+		header:    header,
+		pending:   header,
+	}, nil
+}
+
+// Read implements io.Reader.
+func (er *encryptReader) Read(p []byte) (int, error) {
+	if len(er.pending) == 0 {
+		if er.isLast {
+			return 0, io.EOF
+		}
+		if err := er.encryptChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, er.pending)
+	er.pending = er.pending[n:]
+	return n, nil
+}
+
+func (er *encryptReader) encryptChunk() error {
+	n := er.remaining
+	if n > chunkSize {
+		n = chunkSize
+	}
+	if cap(er.buf) < chunkSize+tagSize {
+		er.buf = make([]byte, chunkSize+tagSize)
+	}
+	plain := er.buf[:n]
+	if _, err := io.ReadFull(er.r, plain); err != nil {
+		return fmt.Errorf("cannot read %d bytes of plaintext data: %w", n, err)
+	}
+	er.remaining -= n
+	er.isLast = er.remaining == 0
+	er.nonce = marshalChunkNonce(er.nonce, er.chunkN, er.isLast)
+	er.chunkN++
+	er.pending = er.aead.Seal(plain[:0], er.nonce, plain, er.header)
+	return nil
+}
+
+// decryptWriter decrypts encrypted part with the given plaintext size and writes the plaintext to w.
+//
+// Close must be called after writing the whole encrypted part in order to verify it isn't truncated.
+type decryptWriter struct {
+	ks        *keySet
+	w         io.Writer
+	remaining uint64
+
+	aead   cipher.AEAD
+	header []byte
+
+	chunkN uint64
+	isLast bool
+	nonce  []byte
+	buf    []byte
+}
+
+func newDecryptWriter(ks *keySet, w io.Writer, size uint64) *decryptWriter {
+	return &decryptWriter{
+		ks:        ks,
+		w:         w,
+		remaining: size,
+	}
+}
+
+// Write implements io.Writer.
+func (dw *decryptWriter) Write(p []byte) (int, error) {
+	dw.buf = append(dw.buf, p...)
+	if dw.aead == nil {
+		if len(dw.buf) < headerSize {
+			return len(p), nil
+		}
+		dw.header = append(dw.header[:0], dw.buf[:headerSize]...)
+		dataKey, err := unmarshalHeader(dw.ks, dw.header)
+		if err != nil {
+			return 0, err
+		}
+		aead, err := newAEAD(dataKey)
+		if err != nil {
+			return 0, err
+		}
+		dw.aead = aead
+		dw.buf = append(dw.buf[:0], dw.buf[headerSize:]...)
+	}
+	data := dw.buf
+	for !dw.isLast {
+		n := dw.remaining
+		if n > chunkSize {
+			n = chunkSize
+		}
+		if uint64(len(data)) < n+tagSize {
+			break
+		}
+		isLast := dw.remaining == n
+		dw.nonce = marshalChunkNonce(dw.nonce, dw.chunkN, isLast)
+		plain, err := dw.aead.Open(data[:0], dw.nonce, data[:n+tagSize], dw.header)
+		if err != nil {
+			return 0, fmt.Errorf("cannot decrypt chunk #%d: %w", dw.chunkN, err)
+		}
+		if _, err := dw.w.Write(plain); err != nil {
+			return 0, err
+		}
+		data = data[n+tagSize:]
+		dw.remaining -= n
+		dw.isLast = isLast
+		dw.chunkN++
+	}
+	if dw.isLast && len(data) > 0 {
+		return 0, fmt.Errorf("unexpected %d bytes after the last chunk", len(data))
+	}
+	dw.buf = append(dw.buf[:0], data...)
+	return len(p), nil
+}
+
+// Close verifies that the whole encrypted part has been written to dw.
+func (dw *decryptWriter) Close() error {
+	if !dw.isLast {
+		return fmt.Errorf("unexpected end of encrypted data; %d bytes of plaintext data are missing", dw.remaining)
+	}
+	return nil
+}
@@ -268,3 +268,6 @@ func IgnorePath(path string) bool {
 
 // BackupCompleteFilename is a filename, which is created in the destination fs when backup is complete.
 const BackupCompleteFilename = "backup_complete.ignore"
+
+// BackupManifestFilename is a filename for common.Manifest, which is created in the destination fs when backup is complete.
+const BackupManifestFilename = "backup_manifest.ignore"
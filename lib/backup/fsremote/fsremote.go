@@ -219,6 +219,16 @@ func (fs *FS) CreateFile(filePath string, data []byte) error {
 	return nil
 }
 
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := filepath.Join(fs.Dir, filePath)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", path, err)
+	}
+	return data, nil
+}
+
 // HasFile returns true if filePath exists at fs.
 func (fs *FS) HasFile(filePath string) (bool, error) {
 	path := filepath.Join(fs.Dir, filePath)
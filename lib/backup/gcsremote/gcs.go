@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 
 	"cloud.google.com/go/storage"
@@ -230,6 +231,25 @@ func (fs *FS) CreateFile(filePath string, data []byte) error {
 	return nil
 }
 
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := fs.Dir + filePath
+	o := fs.bkt.Object(path)
+	ctx := context.Background()
+	r, err := o.NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open reader for %q at %s (remote path %q): %w", filePath, fs, o.ObjectName(), err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q at %s (remote path %q): %w", filePath, fs, o.ObjectName(), err)
+	}
+	return data, nil
+}
+
 // HasFile returns ture if filePath exists at fs.
 func (fs *FS) HasFile(filePath string) (bool, error) {
 	path := fs.Dir + filePath
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
@@ -13,6 +14,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -40,6 +42,15 @@ type FS struct {
 	// The name of S3 config profile to use.
 	ProfileName string
 
+	// Whether to use path-style addressing for CustomEndpoint, i.e. http://endpoint/bucket/key
+	// instead of virtual-hosted-style addressing http://bucket.endpoint/key .
+	ForcePathStyle bool
+
+	// ARN of the role to assume with the credentials loaded from the CredsFilePath or from default locations.
+	//
+	// The credentials are used as is if empty.
+	RoleARN string
+
 	s3       *s3.S3
 	uploader *s3manager.Uploader
 }
@@ -69,18 +80,31 @@ func (fs *FS) Init() error {
 	if err != nil {
 		return fmt.Errorf("cannot create S3 session: %w", err)
 	}
+	if len(fs.RoleARN) > 0 {
+		// Assume the role with the credentials from the session.
+		// The credentials for the role are refreshed automatically before their expiration.
+		logger.Infof("assuming role %q for accessing S3", fs.RoleARN)
+		sess.Config.WithCredentials(stscreds.NewCredentials(sess, fs.RoleARN))
+	}
 
 	if len(fs.CustomEndpoint) > 0 {
 		// Use provided custom endpoint for S3
 		logger.Infof("Using provided custom S3 endpoint: %q", fs.CustomEndpoint)
 		sess.Config.WithEndpoint(fs.CustomEndpoint)
 
-		// Disable prefixing endpoint with bucket name
-		sess.Config.WithS3ForcePathStyle(true)
+		// Disable prefixing endpoint with bucket name if needed.
+		// Some S3-compatible storages support only virtual-hosted-style addressing.
+		sess.Config.WithS3ForcePathStyle(fs.ForcePathStyle)
+
+		// S3-compatible storages such as MinIO usually ignore the region,
+		// but the region must be set for signing requests.
+		if aws.StringValue(sess.Config.Region) == "" {
+			sess.Config.WithRegion(defaultRegion)
+		}
 	} else {
 		// Determine bucket region.
 		ctx := context.Background()
-		region, err := s3manager.GetBucketRegion(ctx, sess, fs.Bucket, "us-west-2")
+		region, err := s3manager.GetBucketRegion(ctx, sess, fs.Bucket, defaultRegion)
 		if err != nil {
 			return fmt.Errorf("cannot determine region for bucket %q: %w", fs.Bucket, err)
 		}
@@ -96,6 +120,9 @@ func (fs *FS) Init() error {
 	return nil
 }
 
+// defaultRegion is the region used for requests if the region isn't configured.
+const defaultRegion = "us-west-2"
+
 // String returns human-readable description for fs.
 func (fs *FS) String() string {
 	return fmt.Sprintf("S3{bucket: %q, dir: %q}", fs.Bucket, fs.Dir)
@@ -279,6 +306,27 @@ func (fs *FS) CreateFile(filePath string, data []byte) error {
 	return nil
 }
 
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := fs.Dir + filePath
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(fs.Bucket),
+		Key:    aws.String(path),
+	}
+	o, err := fs.s3.GetObject(input)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	data, err := ioutil.ReadAll(o.Body)
+	if err1 := o.Body.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return data, nil
+}
+
 // HasFile returns true if filePath exists at fs.
 func (fs *FS) HasFile(filePath string) (bool, error) {
 	path := fs.Dir + filePath
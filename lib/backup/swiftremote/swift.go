@@ -0,0 +1,684 @@
+package swiftremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// FS represents filesystem for backups in OpenStack Swift.
+//
+// Init must be called before calling other FS methods.
+type FS struct {
+	// AuthURL is the URL for obtaining auth token.
+	//
+	// Keystone v3 auth is used if the URL ends with /v3. Otherwise v1 auth is used,
+	// which is supported by TempAuth, SwAuth and many Swift-compatible storages.
+	//
+	// OS_AUTH_URL or ST_AUTH env var is used if empty.
+	AuthURL string
+
+	// Username is the user name for authentication.
+	//
+	// OS_USERNAME or ST_USER env var is used if empty.
+	Username string
+
+	// Password is the password or the key for authentication.
+	//
+	// OS_PASSWORD or ST_KEY env var is used if empty.
+	Password string
+
+	// ProjectName is the name of the project to scope the token to. It is used only by Keystone v3 auth.
+	//
+	// OS_PROJECT_NAME or OS_TENANT_NAME env var is used if empty.
+	ProjectName string
+
+	// UserDomainName is the domain of the user. It is used only by Keystone v3 auth.
+	//
+	// OS_USER_DOMAIN_NAME env var is used if empty. `Default` domain is used if the env var is missing.
+	UserDomainName string
+
+	// ProjectDomainName is the domain of the project. It is used only by Keystone v3 auth.
+	//
+	// OS_PROJECT_DOMAIN_NAME env var is used if empty. `Default` domain is used if the env var is missing.
+	ProjectDomainName string
+
+	// Region is the region of object-store endpoint to use. It is used only by Keystone v3 auth.
+	//
+	// OS_REGION_NAME env var is used if empty. The first object-store endpoint is used if the env var is missing.
+	Region string
+
+	// Swift container to use.
+	Container string
+
+	// Directory in the container to write to.
+	Dir string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	storageURL  string
+	token       string
+	tokenExpiry time.Time
+}
+
+// Init initializes fs.
+func (fs *FS) Init() error {
+	if fs.client != nil {
+		logger.Panicf("BUG: Init is already called")
+	}
+	for strings.HasPrefix(fs.Dir, "/") {
+		fs.Dir = fs.Dir[1:]
+	}
+	if !strings.HasSuffix(fs.Dir, "/") {
+		fs.Dir += "/"
+	}
+	setFromEnv(&fs.AuthURL, "OS_AUTH_URL", "ST_AUTH")
+	setFromEnv(&fs.Username, "OS_USERNAME", "ST_USER")
+	setFromEnv(&fs.Password, "OS_PASSWORD", "ST_KEY")
+	setFromEnv(&fs.ProjectName, "OS_PROJECT_NAME", "OS_TENANT_NAME")
+	setFromEnv(&fs.UserDomainName, "OS_USER_DOMAIN_NAME")
+	setFromEnv(&fs.ProjectDomainName, "OS_PROJECT_DOMAIN_NAME")
+	setFromEnv(&fs.Region, "OS_REGION_NAME")
+	if len(fs.UserDomainName) == 0 {
+		fs.UserDomainName = "Default"
+	}
+	if len(fs.ProjectDomainName) == 0 {
+		fs.ProjectDomainName = "Default"
+	}
+	if len(fs.AuthURL) == 0 {
+		return fmt.Errorf("missing auth url; set it via OS_AUTH_URL or ST_AUTH env var")
+	}
+	fs.client = &http.Client{}
+	if err := fs.authenticate(); err != nil {
+		return err
+	}
+
+	// Verify whether the container exists.
+	resp, err := fs.do("HEAD", fs.containerURL(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("cannot check container %q: %w", fs.Container, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("missing container %q at %q", fs.Container, fs.getStorageURL())
+	}
+	if !isSuccessStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code when checking container %q at %q: %d", fs.Container, fs.getStorageURL(), resp.StatusCode)
+	}
+	return nil
+}
+
+func setFromEnv(dst *string, envNames ...string) {
+	if len(*dst) > 0 {
+		return
+	}
+	for _, name := range envNames {
+		if v := os.Getenv(name); len(v) > 0 {
+			*dst = v
+			return
+		}
+	}
+}
+
+// String returns human-readable description for fs.
+func (fs *FS) String() string {
+	return fmt.Sprintf("Swift{container: %q, dir: %q}", fs.Container, fs.Dir)
+}
+
+// swiftObject is an object returned from container listing.
+type swiftObject struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+// The maximum number of objects to request in a single listing.
+//
+// Swift may return less objects than requested if the limit exceeds its container_listing_limit setting.
+const listLimit = 10000
+
+// ListParts returns all the parts for fs.
+func (fs *FS) ListParts() ([]common.Part, error) {
+	dir := fs.Dir
+	var parts []common.Part
+	marker := ""
+	for {
+		args := url.Values{}
+		args.Set("format", "json")
+		args.Set("prefix", dir)
+		args.Set("limit", fmt.Sprintf("%d", listLimit))
+		if len(marker) > 0 {
+			args.Set("marker", marker)
+		}
+		data, err := fs.readURL(fs.containerURL() + "?" + args.Encode())
+		if err != nil {
+			return nil, fmt.Errorf("error when listing swift objects inside dir %q: %w", dir, err)
+		}
+		var objects []swiftObject
+		if err := json.Unmarshal(data, &objects); err != nil {
+			return nil, fmt.Errorf("cannot parse listing for swift objects inside dir %q: %w", dir, err)
+		}
+		for _, o := range objects {
+			file := o.Name
+			if !strings.HasPrefix(file, dir) {
+				return nil, fmt.Errorf("unexpected prefix for swift object %q; want %q", file, dir)
+			}
+			if fscommon.IgnorePath(file) {
+				continue
+			}
+			var p common.Part
+			if !p.ParseFromRemotePath(file[len(dir):]) {
+				logger.Infof("skipping unknown object %q", file)
+				continue
+			}
+			p.ActualSize = uint64(o.Bytes)
+			parts = append(parts, p)
+		}
+		if len(objects) == 0 {
+			// Swift may return less than listLimit objects per page, so stop only on empty page.
+			return parts, nil
+		}
+		marker = objects[len(objects)-1].Name
+	}
+}
+
+// DeletePart deletes part p from fs.
+func (fs *FS) DeletePart(p common.Part) error {
+	path := fs.path(p)
+	if err := fs.deleteObject(path); err != nil {
+		return fmt.Errorf("cannot delete %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	return nil
+}
+
+// RemoveEmptyDirs recursively removes empty dirs in fs.
+func (fs *FS) RemoveEmptyDirs() error {
+	// Swift has no directories, so nothing to remove.
+	return nil
+}
+
+// CopyPart copies p from srcFS to fs.
+func (fs *FS) CopyPart(srcFS common.OriginFS, p common.Part) error {
+	src, ok := srcFS.(*FS)
+	if !ok {
+		return fmt.Errorf("cannot perform server-side copying from %s to %s: both of them must be Swift", srcFS, fs)
+	}
+	if src.getStorageURL() != fs.getStorageURL() {
+		return fmt.Errorf("cannot perform server-side copying from %s to %s: both of them must be located at the same storage url", src, fs)
+	}
+	srcPath := src.path(p)
+	dstPath := fs.path(p)
+	copyFrom := "/" + url.PathEscape(src.Container) + "/" + escapePath(srcPath)
+	header := http.Header{}
+	header.Set("X-Copy-From", copyFrom)
+	resp, err := fs.do("PUT", fs.objectURL(dstPath), header, nil)
+	if err == nil {
+		err = checkResponse(resp)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot copy %q from %s to %s (copyFrom %q): %w", p.Path, src, fs, copyFrom, err)
+	}
+	return nil
+}
+
+// DownloadPart downloads part p from fs to w.
+func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
+	path := fs.path(p)
+	resp, err := fs.do("GET", fs.objectURL(path), nil, nil)
+	if err == nil && !isSuccessStatus(resp.StatusCode) {
+		err = checkResponse(resp)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err1 := resp.Body.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(n) != p.Size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s; got %d bytes; want %d bytes", p.Path, fs, n, p.Size)
+	}
+	return nil
+}
+
+// UploadPart uploads part p from r to fs.
+func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
+	path := fs.path(p)
+	sr := &statReader{
+		r: r,
+	}
+	if err := fs.putObject(path, sr, -1); err != nil {
+		return fmt.Errorf("cannot upload data to %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(sr.size) != p.Size {
+		return fmt.Errorf("wrong data size uploaded to %q at %s; got %d bytes; want %d bytes", p.Path, fs, sr.size, p.Size)
+	}
+	return nil
+}
+
+// DeleteFile deletes filePath from fs if it exists.
+//
+// The function does nothing if the file doesn't exist.
+func (fs *FS) DeleteFile(filePath string) error {
+	path := fs.Dir + filePath
+	if err := fs.deleteObject(path); err != nil {
+		return fmt.Errorf("cannot delete %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return nil
+}
+
+// CreateFile creates filePath at fs and puts data into it.
+//
+// The file is overwritten if it already exists.
+func (fs *FS) CreateFile(filePath string, data []byte) error {
+	path := fs.Dir + filePath
+	if err := fs.putObject(path, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("cannot upload data to %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return nil
+}
+
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := fs.Dir + filePath
+	data, err := fs.readURL(fs.objectURL(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return data, nil
+}
+
+// HasFile returns true if filePath exists at fs.
+func (fs *FS) HasFile(filePath string) (bool, error) {
+	path := fs.Dir + filePath
+	resp, err := fs.do("HEAD", fs.objectURL(path), nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("cannot check %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if !isSuccessStatus(resp.StatusCode) {
+		return false, fmt.Errorf("unexpected status code when checking %q at %s (remote path %q): %d", filePath, fs, path, resp.StatusCode)
+	}
+	return true, nil
+}
+
+func (fs *FS) path(p common.Part) string {
+	return p.RemotePath(fs.Dir)
+}
+
+func (fs *FS) deleteObject(path string) error {
+	resp, err := fs.do("DELETE", fs.objectURL(path), nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		// Missing object - nothing to delete.
+		_ = resp.Body.Close()
+		return nil
+	}
+	return checkResponse(resp)
+}
+
+// putObject uploads data from r to the object at path.
+//
+// size must be set to -1 if the data size is unknown. In this case the data is uploaded with chunked transfer encoding.
+//
+// The request is retried with a new token if Swift responds with 401 Unauthorized before reading the request body
+// or if r implements io.Seeker, so the body may be re-sent.
+func (fs *FS) putObject(path string, r io.Reader, size int64) error {
+	if err := fs.refreshTokenIfNeeded(); err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		sr := &statReader{
+			r: r,
+		}
+		req, err := http.NewRequest("PUT", fs.objectURL(path), sr)
+		if err != nil {
+			return fmt.Errorf("cannot create request: %w", err)
+		}
+		if size >= 0 {
+			req.ContentLength = size
+		}
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+		// Ask Swift to check the token before sending the request body,
+		// so the request could be retried with a new token without re-reading the body.
+		req.Header.Set("Expect", "100-continue")
+		req.Header.Set("X-Auth-Token", fs.getToken())
+		resp, err := fs.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return checkResponse(resp)
+		}
+		_ = resp.Body.Close()
+		if sr.size > 0 {
+			seeker, ok := r.(io.Seeker)
+			if !ok {
+				return fmt.Errorf("the auth token has been rejected after sending %d bytes of the request body, so the request cannot be retried", sr.size)
+			}
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("cannot rewind the request body for retrying the request: %w", err)
+			}
+		}
+		logger.Infof("the auth token for %s has been rejected; obtaining a new token", fs)
+		if err := fs.authenticate(); err != nil {
+			return err
+		}
+	}
+}
+
+func (fs *FS) readURL(u string) ([]byte, error) {
+	resp, err := fs.do("GET", u, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !isSuccessStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("unexpected status code: %d; response body: %q", resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// do performs the request with the given method to u.
+//
+// The request is retried with a new token if Swift responds with 401 Unauthorized.
+// The caller must close the response body.
+func (fs *FS) do(method, u string, header http.Header, body []byte) (*http.Response, error) {
+	if err := fs.refreshTokenIfNeeded(); err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("cannot create request: %w", err)
+		}
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		req.Header.Set("X-Auth-Token", fs.getToken())
+		resp, err := fs.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		logger.Infof("the auth token for %s has been rejected; obtaining a new token", fs)
+		if err := fs.authenticate(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func checkResponse(resp *http.Response) error {
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read response: %w", err)
+	}
+	if !isSuccessStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code: %d; response body: %q", resp.StatusCode, data)
+	}
+	return nil
+}
+
+func isSuccessStatus(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
+func (fs *FS) containerURL() string {
+	return fs.getStorageURL() + "/" + url.PathEscape(fs.Container)
+}
+
+func (fs *FS) objectURL(path string) string {
+	return fs.containerURL() + "/" + escapePath(path)
+}
+
+// escapePath escapes every segment of the path, while leaving slashes between segments as is.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (fs *FS) getStorageURL() string {
+	fs.mu.Lock()
+	s := fs.storageURL
+	fs.mu.Unlock()
+	return s
+}
+
+func (fs *FS) getToken() string {
+	fs.mu.Lock()
+	s := fs.token
+	fs.mu.Unlock()
+	return s
+}
+
+// tokenRefreshInterval is the interval before the token expiration when the token is refreshed.
+const tokenRefreshInterval = 5 * time.Minute
+
+func (fs *FS) refreshTokenIfNeeded() error {
+	fs.mu.Lock()
+	expiry := fs.tokenExpiry
+	fs.mu.Unlock()
+	if expiry.IsZero() || time.Until(expiry) > tokenRefreshInterval {
+		return nil
+	}
+	return fs.authenticate()
+}
+
+// authenticate obtains a new token and the storage url for fs.
+func (fs *FS) authenticate() error {
+	var ai *authInfo
+	var err error
+	if isKeystoneV3(fs.AuthURL) {
+		ai, err = fs.authenticateV3()
+	} else {
+		ai, err = fs.authenticateV1()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot authenticate at %q: %w", fs.AuthURL, err)
+	}
+	fs.mu.Lock()
+	fs.storageURL = strings.TrimSuffix(ai.storageURL, "/")
+	fs.token = ai.token
+	fs.tokenExpiry = ai.expiry
+	fs.mu.Unlock()
+	return nil
+}
+
+func isKeystoneV3(authURL string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(authURL, "/"), "/v3")
+}
+
+type authInfo struct {
+	storageURL string
+	token      string
+	expiry     time.Time
+}
+
+// authenticateV1 performs v1 auth.
+//
+// See https://docs.openstack.org/swift/latest/overview_auth.html
+func (fs *FS) authenticateV1() (*authInfo, error) {
+	req, err := http.NewRequest("GET", fs.AuthURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create auth request: %w", err)
+	}
+	req.Header.Set("X-Auth-User", fs.Username)
+	req.Header.Set("X-Auth-Key", fs.Password)
+	resp, err := fs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	ai := &authInfo{
+		storageURL: resp.Header.Get("X-Storage-Url"),
+		token:      resp.Header.Get("X-Auth-Token"),
+	}
+	if len(ai.storageURL) == 0 || len(ai.token) == 0 {
+		return nil, fmt.Errorf("missing X-Storage-Url or X-Auth-Token headers in auth response")
+	}
+	if s := resp.Header.Get("X-Auth-Token-Expires"); len(s) > 0 {
+		var secs int64
+		if _, err := fmt.Sscanf(s, "%d", &secs); err == nil {
+			ai.expiry = time.Now().Add(time.Duration(secs) * time.Second)
+		}
+	}
+	return ai, nil
+}
+
+// authenticateV3 performs Keystone v3 password auth.
+//
+// See https://docs.openstack.org/api-ref/identity/v3/#password-authentication-with-scoped-authorization
+func (fs *FS) authenticateV3() (*authInfo, error) {
+	var ar keystoneAuthRequest
+	ar.Auth.Identity.Methods = []string{"password"}
+	ar.Auth.Identity.Password.User.Name = fs.Username
+	ar.Auth.Identity.Password.User.Domain.Name = fs.UserDomainName
+	ar.Auth.Identity.Password.User.Password = fs.Password
+	ar.Auth.Scope.Project.Name = fs.ProjectName
+	ar.Auth.Scope.Project.Domain.Name = fs.ProjectDomainName
+	body, err := json.Marshal(&ar)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal auth request: %w", err)
+	}
+	tokensURL := strings.TrimSuffix(fs.AuthURL, "/") + "/auth/tokens"
+	req, err := http.NewRequest("POST", tokensURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create auth request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := fs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read auth response: %w", err)
+	}
+	if !isSuccessStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("unexpected status code: %d; response body: %q", resp.StatusCode, data)
+	}
+	token := resp.Header.Get("X-Subject-Token")
+	if len(token) == 0 {
+		return nil, fmt.Errorf("missing X-Subject-Token header in auth response")
+	}
+	var tr keystoneTokenResponse
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, fmt.Errorf("cannot parse auth response: %w", err)
+	}
+	storageURL, err := tr.getObjectStoreURL(fs.Region)
+	if err != nil {
+		return nil, err
+	}
+	return &authInfo{
+		storageURL: storageURL,
+		token:      token,
+		expiry:     tr.Token.ExpiresAt,
+	}, nil
+}
+
+type keystoneAuthRequest struct {
+	Auth struct {
+		Identity struct {
+			Methods  []string `json:"methods"`
+			Password struct {
+				User struct {
+					Name   string `json:"name"`
+					Domain struct {
+						Name string `json:"name"`
+					} `json:"domain"`
+					Password string `json:"password"`
+				} `json:"user"`
+			} `json:"password"`
+		} `json:"identity"`
+		Scope struct {
+			Project struct {
+				Name   string `json:"name"`
+				Domain struct {
+					Name string `json:"name"`
+				} `json:"domain"`
+			} `json:"project"`
+		} `json:"scope"`
+	} `json:"auth"`
+}
+
+type keystoneTokenResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Catalog   []struct {
+			Type      string `json:"type"`
+			Endpoints []struct {
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				URL       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+// getObjectStoreURL returns the url of public object-store endpoint at the given region from the service catalog.
+//
+// The first public object-store endpoint is returned if region is empty.
+func (tr *keystoneTokenResponse) getObjectStoreURL(region string) (string, error) {
+	for _, service := range tr.Token.Catalog {
+		if service.Type != "object-store" {
+			continue
+		}
+		for _, e := range service.Endpoints {
+			if e.Interface != "public" {
+				continue
+			}
+			if len(region) > 0 && e.Region != region {
+				continue
+			}
+			return e.URL, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find public object-store endpoint for region %q in the service catalog", region)
+}
+
+type statReader struct {
+	r    io.Reader
+	size int64
+}
+
+func (sr *statReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.size += int64(n)
+	return n, err
+}
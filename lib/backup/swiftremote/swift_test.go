@@ -0,0 +1,479 @@
+package swiftremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+)
+
+// fakeSwift is an in-memory Swift server supporting the subset of API used by FS.
+type fakeSwift struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	token   string
+	objects map[string][]byte
+	authN   int
+
+	// maxListingLimit limits the number of objects per listing page like container_listing_limit in Swift.
+	maxListingLimit int
+}
+
+const (
+	fakeAccountPath = "/v1/AUTH_test"
+	fakeContainer   = "backups"
+)
+
+func newFakeSwift(t *testing.T) (*fakeSwift, *httptest.Server) {
+	fs := &fakeSwift{
+		t:       t,
+		objects: make(map[string][]byte),
+	}
+	srv := httptest.NewServer(fs)
+	return fs, srv
+}
+
+func (fs *fakeSwift) newToken() string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.authN++
+	fs.token = fmt.Sprintf("token-%d", fs.authN)
+	return fs.token
+}
+
+func (fs *fakeSwift) expireToken() {
+	fs.mu.Lock()
+	fs.token = "expired"
+	fs.mu.Unlock()
+}
+
+func (fs *fakeSwift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	storageURL := "http://" + r.Host + fakeAccountPath
+	switch {
+	case r.URL.Path == "/auth/v1.0":
+		if r.Header.Get("X-Auth-User") != "test:tester" || r.Header.Get("X-Auth-Key") != "testing" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Storage-Url", storageURL)
+		w.Header().Set("X-Auth-Token", fs.newToken())
+		return
+	case r.URL.Path == "/v3/auth/tokens":
+		var ar keystoneAuthRequest
+		if err := json.NewDecoder(r.Body).Decode(&ar); err != nil {
+			fs.t.Errorf("cannot parse auth request: %s", err)
+		}
+		user := ar.Auth.Identity.Password.User
+		if user.Name != "tester" || user.Password != "testing" || user.Domain.Name != "Default" || ar.Auth.Scope.Project.Name != "test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Subject-Token", fs.newToken())
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":{"expires_at":"2100-01-01T00:00:00.000000Z","catalog":[
+{"type":"identity","endpoints":[{"interface":"public","region":"RegionOne","url":"http://identity"}]},
+{"type":"object-store","endpoints":[
+{"interface":"internal","region":"RegionTwo","url":"http://internal"},
+{"interface":"public","region":"RegionOne","url":"http://region-one"},
+{"interface":"public","region":"RegionTwo","url":%q}]}]}}`, storageURL)
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if r.Header.Get("X-Auth-Token") != fs.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, fakeAccountPath+"/")
+	if path == fakeContainer {
+		fs.serveContainer(w, r)
+		return
+	}
+	if !strings.HasPrefix(path, fakeContainer+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name := path[len(fakeContainer+"/"):]
+	switch r.Method {
+	case "HEAD", "GET":
+		data, ok := fs.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "GET" {
+			_, _ = w.Write(data)
+		}
+	case "PUT":
+		if copyFrom := r.Header.Get("X-Copy-From"); len(copyFrom) > 0 {
+			srcPath, err := url.PathUnescape(copyFrom)
+			if err != nil {
+				fs.t.Errorf("cannot unescape X-Copy-From=%q: %s", copyFrom, err)
+			}
+			data, ok := fs.objects[strings.TrimPrefix(srcPath, "/"+fakeContainer+"/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fs.objects[name] = data
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			fs.t.Errorf("cannot read request body: %s", err)
+		}
+		fs.objects[name] = data
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		if _, ok := fs.objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(fs.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (fs *fakeSwift) serveContainer(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "HEAD" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	prefix := r.FormValue("prefix")
+	marker := r.FormValue("marker")
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		fs.t.Errorf("cannot parse limit: %s", err)
+	}
+	var names []string
+	for name := range fs.objects {
+		if strings.HasPrefix(name, prefix) && name > marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if fs.maxListingLimit > 0 && limit > fs.maxListingLimit {
+		limit = fs.maxListingLimit
+	}
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	objects := []swiftObject{}
+	for _, name := range names {
+		objects = append(objects, swiftObject{
+			Name:  name,
+			Bytes: int64(len(fs.objects[name])),
+		})
+	}
+	if err := json.NewEncoder(w).Encode(objects); err != nil {
+		fs.t.Errorf("cannot send listing: %s", err)
+	}
+}
+
+func TestFSAuthV1(t *testing.T) {
+	fake, srv := newFakeSwift(t)
+	defer srv.Close()
+
+	fs := &FS{
+		AuthURL:   srv.URL + "/auth/v1.0",
+		Username:  "test:tester",
+		Password:  "testing",
+		Container: fakeContainer,
+		Dir:       "/foo/bar",
+	}
+	if err := fs.Init(); err != nil {
+		t.Fatalf("cannot init fs: %s", err)
+	}
+	if fs.Dir != "foo/bar/" {
+		t.Fatalf("unexpected dir; got %q; want %q", fs.Dir, "foo/bar/")
+	}
+	testFS(t, fs)
+
+	// Requests must be retried with a new token after the token expiration.
+	fake.expireToken()
+	if err := fs.CreateFile("after_expire", []byte("x")); err != nil {
+		t.Fatalf("unexpected error when creating file with expired token: %s", err)
+	}
+	data, err := fs.ReadFile("after_expire")
+	if err != nil {
+		t.Fatalf("cannot read file: %s", err)
+	}
+	if string(data) != "x" {
+		t.Fatalf("unexpected file contents; got %q; want %q", data, "x")
+	}
+	fake.expireToken()
+	ok, err := fs.HasFile("baz")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ok {
+		t.Fatalf("missing baz file")
+	}
+
+	// Streamed uploads must be retried with a new token, since Swift rejects the token before reading the request body.
+	fake.expireToken()
+	p := common.Part{Path: "streamed", FileSize: 3, Size: 3}
+	if err := fs.UploadPart(p, &onlyReader{r: strings.NewReader("abc")}); err != nil {
+		t.Fatalf("unexpected error when uploading part with expired token: %s", err)
+	}
+	var bb bytes.Buffer
+	if err := fs.DownloadPart(p, &bb); err != nil {
+		t.Fatalf("cannot download part: %s", err)
+	}
+	if bb.String() != "abc" {
+		t.Fatalf("unexpected part contents; got %q; want %q", bb.String(), "abc")
+	}
+	if err := fs.DeletePart(p); err != nil {
+		t.Fatalf("cannot delete part: %s", err)
+	}
+
+	// Invalid credentials
+	fs = &FS{
+		AuthURL:   srv.URL + "/auth/v1.0",
+		Username:  "test:tester",
+		Password:  "invalid",
+		Container: fakeContainer,
+	}
+	if err := fs.Init(); err == nil {
+		t.Fatalf("expecting non-nil error for invalid credentials")
+	}
+
+	// Missing container
+	fs = &FS{
+		AuthURL:   srv.URL + "/auth/v1.0",
+		Username:  "test:tester",
+		Password:  "testing",
+		Container: "missing",
+	}
+	if err := fs.Init(); err == nil {
+		t.Fatalf("expecting non-nil error for missing container")
+	}
+}
+
+func TestFSAuthV3(t *testing.T) {
+	_, srv := newFakeSwift(t)
+	defer srv.Close()
+
+	fs := &FS{
+		AuthURL:     srv.URL + "/v3",
+		Username:    "tester",
+		Password:    "testing",
+		ProjectName: "test",
+		Region:      "RegionTwo",
+		Container:   fakeContainer,
+		Dir:         "foo",
+	}
+	if err := fs.Init(); err != nil {
+		t.Fatalf("cannot init fs: %s", err)
+	}
+	if storageURL := fs.getStorageURL(); storageURL != srv.URL+fakeAccountPath {
+		t.Fatalf("unexpected storage url; got %q; want %q", storageURL, srv.URL+fakeAccountPath)
+	}
+	testFS(t, fs)
+}
+
+func TestFSListPartsPaging(t *testing.T) {
+	fake, srv := newFakeSwift(t)
+	defer srv.Close()
+
+	// Swift returns less objects than requested, so all the pages must be read.
+	fake.maxListingLimit = 3
+
+	fs := &FS{
+		AuthURL:   srv.URL + "/auth/v1.0",
+		Username:  "test:tester",
+		Password:  "testing",
+		Container: fakeContainer,
+		Dir:       "foo",
+	}
+	if err := fs.Init(); err != nil {
+		t.Fatalf("cannot init fs: %s", err)
+	}
+	var parts []common.Part
+	for i := 0; i < 10; i++ {
+		p := common.Part{
+			Path:       fmt.Sprintf("data/small/part%d/values.bin", i),
+			FileSize:   2,
+			Size:       2,
+			ActualSize: 2,
+		}
+		if err := fs.UploadPart(p, bytes.NewReader(make([]byte, p.Size))); err != nil {
+			t.Fatalf("cannot upload part %s: %s", &p, err)
+		}
+		parts = append(parts, p)
+	}
+	listedParts, err := fs.ListParts()
+	if err != nil {
+		t.Fatalf("cannot list parts: %s", err)
+	}
+	if !reflect.DeepEqual(listedParts, parts) {
+		t.Fatalf("unexpected parts;\ngot\n%+v\nwant\n%+v", listedParts, parts)
+	}
+}
+
+// onlyReader hides all the methods of r except of Read, so the request body cannot be rewound.
+type onlyReader struct {
+	r io.Reader
+}
+
+func (or *onlyReader) Read(p []byte) (int, error) {
+	return or.r.Read(p)
+}
+
+func TestGetObjectStoreURL(t *testing.T) {
+	var tr keystoneTokenResponse
+	data := `{"token":{"catalog":[{"type":"object-store","endpoints":[
+{"interface":"admin","region":"RegionOne","url":"http://admin"},
+{"interface":"public","region":"RegionOne","url":"http://one"},
+{"interface":"public","region":"RegionTwo","url":"http://two"}]}]}}`
+	if err := json.Unmarshal([]byte(data), &tr); err != nil {
+		t.Fatalf("cannot parse token response: %s", err)
+	}
+	f := func(region, urlExpected string) {
+		t.Helper()
+		u, err := tr.getObjectStoreURL(region)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if u != urlExpected {
+			t.Fatalf("unexpected url for region %q; got %q; want %q", region, u, urlExpected)
+		}
+	}
+	f("", "http://one")
+	f("RegionOne", "http://one")
+	f("RegionTwo", "http://two")
+	if _, err := tr.getObjectStoreURL("RegionThree"); err == nil {
+		t.Fatalf("expecting non-nil error for missing region")
+	}
+}
+
+func testFS(t *testing.T, fs *FS) {
+	t.Helper()
+
+	// Files
+	ok, err := fs.HasFile("baz")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ok {
+		t.Fatalf("unexpected baz file")
+	}
+	if err := fs.CreateFile("baz", []byte("hello")); err != nil {
+		t.Fatalf("cannot create file: %s", err)
+	}
+	ok, err = fs.HasFile("baz")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ok {
+		t.Fatalf("missing baz file")
+	}
+	data, err := fs.ReadFile("baz")
+	if err != nil {
+		t.Fatalf("cannot read file: %s", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("unexpected file contents; got %q; want %q", data, "hello")
+	}
+	if err := fs.DeleteFile("missing"); err != nil {
+		t.Fatalf("unexpected error when deleting missing file: %s", err)
+	}
+
+	// Parts
+	parts := []common.Part{
+		{
+			Path:     "data/small/part 1/timestamps.bin",
+			FileSize: 10,
+			Offset:   0,
+			Size:     10,
+		},
+		{
+			Path:     "data/small/part 1/values.bin",
+			FileSize: 3,
+			Offset:   0,
+			Size:     3,
+		},
+	}
+	for _, p := range parts {
+		if err := fs.UploadPart(p, bytes.NewReader(make([]byte, p.Size))); err != nil {
+			t.Fatalf("cannot upload part %s: %s", &p, err)
+		}
+	}
+	if err := fs.UploadPart(common.Part{Path: "broken", FileSize: 5, Size: 5}, bytes.NewReader(nil)); err == nil {
+		t.Fatalf("expecting non-nil error for part with unexpected size")
+	}
+	if err := fs.DeletePart(common.Part{Path: "broken", FileSize: 5, Size: 5}); err != nil {
+		t.Fatalf("cannot delete part: %s", err)
+	}
+	listedParts, err := fs.ListParts()
+	if err != nil {
+		t.Fatalf("cannot list parts: %s", err)
+	}
+	for i := range parts {
+		parts[i].ActualSize = parts[i].Size
+	}
+	if !reflect.DeepEqual(listedParts, parts) {
+		t.Fatalf("unexpected parts;\ngot\n%+v\nwant\n%+v", listedParts, parts)
+	}
+	var bb bytes.Buffer
+	if err := fs.DownloadPart(parts[0], &bb); err != nil {
+		t.Fatalf("cannot download part: %s", err)
+	}
+	if bb.Len() != int(parts[0].Size) {
+		t.Fatalf("unexpected downloaded part size; got %d; want %d", bb.Len(), parts[0].Size)
+	}
+
+	// Server-side copy
+	dstFS := &FS{
+		AuthURL:     fs.AuthURL,
+		Username:    fs.Username,
+		Password:    fs.Password,
+		ProjectName: fs.ProjectName,
+		Region:      fs.Region,
+		Container:   fs.Container,
+		Dir:         fs.Dir + "copy",
+	}
+	if err := dstFS.Init(); err != nil {
+		t.Fatalf("cannot init fs: %s", err)
+	}
+	if err := dstFS.CopyPart(fs, parts[1]); err != nil {
+		t.Fatalf("cannot copy part: %s", err)
+	}
+	bb.Reset()
+	if err := dstFS.DownloadPart(parts[1], &bb); err != nil {
+		t.Fatalf("cannot download copied part: %s", err)
+	}
+	if err := dstFS.DeletePart(parts[1]); err != nil {
+		t.Fatalf("cannot delete copied part: %s", err)
+	}
+
+	for _, p := range parts {
+		if err := fs.DeletePart(p); err != nil {
+			t.Fatalf("cannot delete part: %s", err)
+		}
+	}
+	listedParts, err = fs.ListParts()
+	if err != nil {
+		t.Fatalf("cannot list parts: %s", err)
+	}
+	if len(listedParts) != 0 {
+		t.Fatalf("unexpected parts after deletion: %+v", listedParts)
+	}
+}
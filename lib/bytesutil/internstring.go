@@ -0,0 +1,84 @@
+package bytesutil
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+)
+
+// InternBytes interns b as a string.
+//
+// See InternString for details.
+func InternBytes(b []byte) string {
+	s := ToUnsafeString(b)
+	return InternString(s)
+}
+
+// InternString returns interned s.
+//
+// Interned strings share backing memory, so this may be used for reducing the amounts of allocated memory
+// for frequently repeated strings such as label names and label values.
+//
+// Interned strings are removed from the internal cache if they aren't accessed during internStringExpireSeconds.
+func InternString(s string) string {
+	ct := fasttime.UnixTimestamp()
+	if v, ok := internStringsMap.Load(s); ok {
+		e := v.(*ismEntry)
+		if atomic.LoadUint64(&e.lastAccessTime)+10 < ct {
+			// Reduce the frequency of e.lastAccessTime update to once per 10 seconds
+			// in order to improve the fast path speed on systems with many CPU cores.
+			atomic.StoreUint64(&e.lastAccessTime, ct)
+		}
+		return e.s
+	}
+	// Make a new copy for s in order to remove references from possible bigger string s refers to.
+	sCopy := string(ToUnsafeBytes(s))
+	if len(sCopy) > maxInternStringLen {
+		// Do not intern long strings, since they are unlikely to be repeated.
+		return sCopy
+	}
+	e := &ismEntry{
+		lastAccessTime: ct,
+		s:              sCopy,
+	}
+	internStringsMap.Store(sCopy, e)
+
+	if needInternStringsCleanup(ct) {
+		// Perform a global cleanup for internStringsMap by removing items, which weren't accessed recently.
+		internStringsMap.Range(func(k, v interface{}) bool {
+			e := v.(*ismEntry)
+			if atomic.LoadUint64(&e.lastAccessTime)+internStringExpireSeconds < ct {
+				internStringsMap.Delete(k)
+			}
+			return true
+		})
+	}
+	return sCopy
+}
+
+const (
+	// maxInternStringLen is the maximum length of strings to intern.
+	maxInternStringLen = 500
+
+	// internStringExpireSeconds is the duration for interned strings to stay in the cache after the last access.
+	internStringExpireSeconds = 6 * 60
+)
+
+type ismEntry struct {
+	lastAccessTime uint64
+	s              string
+}
+
+var (
+	internStringsMap                sync.Map
+	internStringsMapLastCleanupTime uint64
+)
+
+func needInternStringsCleanup(ct uint64) bool {
+	lct := atomic.LoadUint64(&internStringsMapLastCleanupTime)
+	if ct < lct+internStringExpireSeconds/2 {
+		return false
+	}
+	return atomic.CompareAndSwapUint64(&internStringsMapLastCleanupTime, lct, ct)
+}
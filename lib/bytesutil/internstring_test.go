@@ -0,0 +1,61 @@
+package bytesutil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+func TestInternString(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		result := InternString(s)
+		if result != s {
+			t.Fatalf("unexpected string returned; got %q; want %q", result, s)
+		}
+		result = InternBytes([]byte(s))
+		if result != s {
+			t.Fatalf("unexpected string returned from InternBytes; got %q; want %q", result, s)
+		}
+	}
+	f("")
+	f("foo")
+	f("__name__")
+	f(strings.Repeat("a", maxInternStringLen+1))
+}
+
+func TestInternStringSharedMemory(t *testing.T) {
+	b := []byte("some_label_value")
+	s1 := InternBytes(b)
+	b[0] = 'x'
+	if s1 != "some_label_value" {
+		t.Fatalf("interned string mustn't refer to the source bytes; got %q", s1)
+	}
+	s2 := InternString(string([]byte("some_label_value")))
+	sh1 := (*reflect.StringHeader)(unsafe.Pointer(&s1))
+	sh2 := (*reflect.StringHeader)(unsafe.Pointer(&s2))
+	if sh1.Data != sh2.Data {
+		t.Fatalf("interned strings must share backing memory")
+	}
+}
+
+func TestInternStringConcurrent(t *testing.T) {
+	const concurrency = 5
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s := fmt.Sprintf("value_%d", j%100)
+				if result := InternString(s); result != s {
+					panic(fmt.Errorf("unexpected string returned; got %q; want %q", result, s))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
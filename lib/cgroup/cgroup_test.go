@@ -0,0 +1,57 @@
+package cgroup
+
+import (
+	"testing"
+)
+
+func TestParseCPUMax(t *testing.T) {
+	f := func(data string, quotaExpected float64) {
+		t.Helper()
+		quota := parseCPUMax(data)
+		if quota != quotaExpected {
+			t.Fatalf("unexpected quota for %q; got %f; want %f", data, quota, quotaExpected)
+		}
+	}
+	f("max 100000", 0)
+	f("200000 100000", 2)
+	f("50000 100000", 0.5)
+	f("", 0)
+	f("foo 100000", 0)
+	f("100000 0", 0)
+}
+
+func TestParseMemoryMax(t *testing.T) {
+	f := func(data string, limitExpected int64) {
+		t.Helper()
+		limit := parseMemoryMax(data)
+		if limit != limitExpected {
+			t.Fatalf("unexpected limit for %q; got %d; want %d", data, limit, limitExpected)
+		}
+	}
+	f("max", 0)
+	f("1073741824", 1073741824)
+	f("foo", 0)
+}
+
+func TestGetCgroupV2Path(t *testing.T) {
+	f := func(data, pathExpected string, isErrorExpected bool) {
+		t.Helper()
+		path, err := getCgroupV2Path(data)
+		if isErrorExpected {
+			if err == nil {
+				t.Fatalf("expecting non-nil error for %q", data)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", data, err)
+		}
+		if path != pathExpected {
+			t.Fatalf("unexpected path for %q; got %q; want %q", data, path, pathExpected)
+		}
+	}
+	f("0::/", "/", false)
+	f("0::/system.slice/docker-abc.scope\n", "/system.slice/docker-abc.scope", false)
+	f("4:memory:/foo\n1:cpu:/\n0::/bar", "/bar", false)
+	f("4:memory:/foo\n1:cpu:/", "", true)
+}
@@ -3,8 +3,12 @@ package cgroup
 import (
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 // UpdateGOMAXPROCSToCPUQuota updates GOMAXPROCS to cgroup CPU quota if GOMAXPROCS isn't set in environment var.
@@ -36,6 +40,21 @@ func UpdateGOMAXPROCSToCPUQuota() {
 }
 
 func getCPUQuota() float64 {
+	cpuQuotaOnce.Do(func() {
+		cpuQuota = getCPUQuotaV1()
+		if cpuQuota <= 0 {
+			cpuQuota = getCPUQuotaV2()
+		}
+	})
+	return cpuQuota
+}
+
+var (
+	cpuQuota     float64
+	cpuQuotaOnce sync.Once
+)
+
+func getCPUQuotaV1() float64 {
 	quotaUS, err := readInt64("/sys/fs/cgroup/cpu/cpu.cfs_quota_us", "cat /sys/fs/cgroup/cpu$(cat /proc/self/cgroup | grep cpu, | cut -d: -f3)/cpu.cfs_quota_us")
 	if err != nil {
 		return 0
@@ -46,3 +65,47 @@ func getCPUQuota() float64 {
 	}
 	return float64(quotaUS) / float64(periodUS)
 }
+
+// getCPUQuotaV2 returns CPU quota from cgroup v2.
+//
+// 0 is returned if the quota isn't set.
+func getCPUQuotaV2() float64 {
+	data, err := readCgroupV2File("cpu.max")
+	if err != nil {
+		return 0
+	}
+	return parseCPUMax(data)
+}
+
+// parseCPUMax parses the contents of cpu.max file from cgroup v2.
+//
+// The file contains `$MAX $PERIOD`, where `$MAX` may be `max` for unlimited quota.
+func parseCPUMax(data string) float64 {
+	fields := strings.Fields(data)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	quotaUS, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+	periodUS, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || periodUS <= 0 {
+		return 0
+	}
+	return float64(quotaUS) / float64(periodUS)
+}
+
+// Export the detected limits, so it is easier to understand why the app uses the given amounts of CPU and memory.
+var (
+	_ = metrics.NewGauge(`vm_cgroup_cpu_quota`, func() float64 {
+		q := getCPUQuota()
+		if q < 0 {
+			return 0
+		}
+		return q
+	})
+	_ = metrics.NewGauge(`vm_available_cpu_cores`, func() float64 {
+		return float64(runtime.GOMAXPROCS(0))
+	})
+)
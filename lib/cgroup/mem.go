@@ -1,5 +1,9 @@
 package cgroup
 
+import (
+	"strconv"
+)
+
 // GetMemoryLimit returns cgroup memory limit
 func GetMemoryLimit() int64 {
 	// Try determining the amount of memory inside docker container.
@@ -9,6 +13,30 @@ func GetMemoryLimit() int64 {
 	// This should properly determine the limit inside lxc container.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/84
 	n, err := readInt64("/sys/fs/cgroup/memory/memory.limit_in_bytes", "cat /sys/fs/cgroup/memory$(cat /proc/self/cgroup | grep memory | cut -d: -f3)/memory.limit_in_bytes")
+	if err != nil {
+		return getMemoryLimitV2()
+	}
+	return n
+}
+
+// getMemoryLimitV2 returns memory limit from cgroup v2.
+//
+// 0 is returned if the limit isn't set.
+func getMemoryLimitV2() int64 {
+	data, err := readCgroupV2File("memory.max")
+	if err != nil {
+		return 0
+	}
+	return parseMemoryMax(data)
+}
+
+// parseMemoryMax parses the contents of memory.max file from cgroup v2.
+func parseMemoryMax(data string) int64 {
+	if data == "max" {
+		// The memory is unlimited.
+		return 0
+	}
+	n, err := strconv.ParseInt(data, 10, 64)
 	if err != nil {
 		return 0
 	}
@@ -2,9 +2,12 @@ package cgroup
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os/exec"
+	"path"
 	"strconv"
+	"strings"
 )
 
 func readInt64(path, altCommand string) (int64, error) {
@@ -25,3 +28,38 @@ func readInt64FromCommand(command string) (int64, error) {
 	data = bytes.TrimSpace(data)
 	return strconv.ParseInt(string(data), 10, 64)
 }
+
+// readCgroupV2File reads the given file for the current process from cgroup v2 hierarchy.
+//
+// See https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html
+func readCgroupV2File(name string) (string, error) {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	cgroupPath, err := getCgroupV2Path(string(data))
+	if err != nil {
+		return "", err
+	}
+	// The cgroup path may be missing in /sys/fs/cgroup when the process runs in a container with private cgroup namespace.
+	// Fall back to the root of the mounted cgroup hierarchy in this case.
+	for _, p := range []string{path.Join("/sys/fs/cgroup", cgroupPath, name), path.Join("/sys/fs/cgroup", name)} {
+		data, err := ioutil.ReadFile(p)
+		if err == nil {
+			return string(bytes.TrimSpace(data)), nil
+		}
+	}
+	return "", fmt.Errorf("cannot find %q in cgroup v2 hierarchy for %q", name, cgroupPath)
+}
+
+// getCgroupV2Path returns cgroup v2 path from /proc/self/cgroup contents.
+//
+// cgroup v2 entry has the form `0::/path`.
+func getCgroupV2Path(data string) (string, error) {
+	for _, line := range strings.Split(data, "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return line[len("0::"):], nil
+		}
+	}
+	return "", fmt.Errorf("cannot find cgroup v2 entry in /proc/self/cgroup")
+}
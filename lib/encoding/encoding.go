@@ -40,12 +40,30 @@ const (
 	// MarshalTypeNearestDelta is used instead of MarshalTypeZSTDNearestDelta
 	// if compression doesn't help.
 	MarshalTypeNearestDelta = MarshalType(6)
+
+	// MarshalTypeDeltaRuns is used for marshaling time series with
+	// a small number of distinct delta runs, such as near-constant gauges
+	// and counters with occasional jumps.
+	//
+	// It is lossless and is cheaper to decode than nearest delta encodings.
+	// It is used only if enabled via SetDeltaRunsEncoding.
+	MarshalTypeDeltaRuns = MarshalType(7)
 )
 
+// SetDeltaRunsEncoding enables or disables MarshalTypeDeltaRuns for newly marshaled data.
+//
+// It is disabled by default, since previous releases cannot read data marshaled with MarshalTypeDeltaRuns.
+// Data marshaled with MarshalTypeDeltaRuns can be unmarshaled regardless of this setting.
+func SetDeltaRunsEncoding(enabled bool) {
+	deltaRunsEncodingEnabled = enabled
+}
+
+var deltaRunsEncodingEnabled bool
+
 // CheckMarshalType verifies whether the mt is valid.
 func CheckMarshalType(mt MarshalType) error {
-	if mt < 0 || mt > 6 {
-		return fmt.Errorf("MarshalType should be in range [0..6]; got %d", mt)
+	if mt < 0 || mt > 7 {
+		return fmt.Errorf("MarshalType should be in range [0..7]; got %d", mt)
 	}
 	return nil
 }
@@ -115,6 +133,11 @@ func marshalInt64Array(dst []byte, a []int64, precisionBits uint8) (result []byt
 		dst = MarshalVarInt64(dst, a[1]-a[0])
 		return dst, MarshalTypeDeltaConst, firstValue
 	}
+	if deltaRunsEncodingEnabled && isDeltaRuns(a) {
+		firstValue = a[0]
+		dst = marshalInt64DeltaRuns(dst, a)
+		return dst, MarshalTypeDeltaRuns, firstValue
+	}
 
 	bb := bbPool.Get()
 	if isGauge(a) {
@@ -230,6 +253,12 @@ func unmarshalInt64Array(dst []int64, src []byte, mt MarshalType, firstValue int
 			v += d
 		}
 		return dst, nil
+	case MarshalTypeDeltaRuns:
+		dst, err = unmarshalInt64DeltaRuns(dst, src, firstValue, itemsCount)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal delta runs data: %w", err)
+		}
+		return dst, nil
 	default:
 		return nil, fmt.Errorf("unknown MarshalType=%d", mt)
 	}
@@ -309,6 +338,88 @@ func isDeltaConst(a []int64) bool {
 	return true
 }
 
+// isDeltaRuns returns true if a contains a small number of runs
+// with equal deltas, so it is better to store it with MarshalTypeDeltaRuns.
+func isDeltaRuns(a []int64) bool {
+	if len(a) < minDeltaRunsItems {
+		return false
+	}
+	maxRuns := len(a) >> 3
+	runs := 1
+	d := a[1] - a[0]
+	prev := a[1]
+	for _, next := range a[2:] {
+		if next-prev != d {
+			runs++
+			if runs > maxRuns {
+				return false
+			}
+			d = next - prev
+		}
+		prev = next
+	}
+	return true
+}
+
+// minDeltaRunsItems is the minimum number of items for using MarshalTypeDeltaRuns.
+//
+// Shorter arrays are compressed well enough by other encodings.
+const minDeltaRunsItems = 16
+
+// marshalInt64DeltaRuns appends (delta, runLength) pairs for a[1:] to dst.
+func marshalInt64DeltaRuns(dst []byte, a []int64) []byte {
+	d := a[1] - a[0]
+	n := uint64(1)
+	prev := a[1]
+	for _, next := range a[2:] {
+		if next-prev == d {
+			n++
+		} else {
+			dst = MarshalVarInt64(dst, d)
+			dst = MarshalVarUint64(dst, n)
+			d = next - prev
+			n = 1
+		}
+		prev = next
+	}
+	dst = MarshalVarInt64(dst, d)
+	dst = MarshalVarUint64(dst, n)
+	return dst
+}
+
+func unmarshalInt64DeltaRuns(dst []int64, src []byte, firstValue int64, itemsCount int) ([]int64, error) {
+	if itemsCount < 1 {
+		return nil, fmt.Errorf("itemsCount must be greater than 0; got %d", itemsCount)
+	}
+	v := firstValue
+	dst = append(dst, v)
+	itemsLeft := uint64(itemsCount - 1)
+	for len(src) > 0 {
+		tail, d, err := UnmarshalVarInt64(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal delta: %w", err)
+		}
+		tail, n, err := UnmarshalVarUint64(tail)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal run length for delta=%d: %w", d, err)
+		}
+		if n == 0 || n > itemsLeft {
+			return nil, fmt.Errorf("unexpected run length for delta=%d: %d; must be in the range [1..%d]", d, n, itemsLeft)
+		}
+		itemsLeft -= n
+		for n > 0 {
+			v += d
+			dst = append(dst, v)
+			n--
+		}
+		src = tail
+	}
+	if itemsLeft > 0 {
+		return nil, fmt.Errorf("too few items unmarshaled; %d items are missing out of %d", itemsLeft, itemsCount)
+	}
+	return dst, nil
+}
+
 // isGauge returns true if a contains gauge values,
 // i.e. arbitrary changing values.
 //
@@ -42,6 +42,23 @@ func TestIsDeltaConst(t *testing.T) {
 	f([]int64{1, 2, 4}, false)
 }
 
+func TestIsDeltaRuns(t *testing.T) {
+	f := func(a []int64, okExpected bool) {
+		t.Helper()
+		ok := isDeltaRuns(a)
+		if ok != okExpected {
+			t.Fatalf("unexpected isDeltaRuns for a=%d; got %v; want %v", a, ok, okExpected)
+		}
+	}
+	f([]int64{}, false)
+	f([]int64{1, 2, 3}, false)
+	f([]int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 8, 8, 8, 8, 8, 8, 8}, true)
+	f([]int64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2}, true)
+	f([]int64{1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2}, false)
+	f([]int64{0, 10, 20, 30, 40, 50, 60, 70, 85, 100, 115, 130, 145, 160, 175, 190}, true)
+	f([]int64{0, 10, 20, 30, 40, 50, 60, 70, 81, 91, 101, 111, 121, 131, 141, 151}, false)
+}
+
 func TestIsGauge(t *testing.T) {
 	f := func(a []int64, okExpected bool) {
 		t.Helper()
@@ -206,6 +223,80 @@ func TestMarshalUnmarshalInt64ArrayGeneric(t *testing.T) {
 	testMarshalUnmarshalInt64Array(t, []int64{100, 100, 100, 100}, 4, MarshalTypeConst)
 }
 
+func TestMarshalUnmarshalInt64ArrayDeltaRuns(t *testing.T) {
+	var va []int64
+	for i := 0; i < 100; i++ {
+		va = append(va, 42)
+	}
+	for i := 0; i < 100; i++ {
+		va = append(va, 43)
+	}
+
+	// Delta runs encoding mustn't be used by default.
+	_, mt, _ := marshalInt64Array(nil, va, 64)
+	if mt == MarshalTypeDeltaRuns {
+		t.Fatalf("unexpected MarshalType=%d when delta runs encoding is disabled", mt)
+	}
+
+	SetDeltaRunsEncoding(true)
+	defer SetDeltaRunsEncoding(false)
+
+	va = va[:0]
+	for i := 0; i < 100; i++ {
+		va = append(va, 42)
+	}
+	for i := 0; i < 100; i++ {
+		va = append(va, 43)
+	}
+	testMarshalUnmarshalInt64Array(t, va, 4, MarshalTypeDeltaRuns)
+
+	va = va[:0]
+	v := int64(1600000000000)
+	for i := 0; i < 1000; i++ {
+		va = append(va, v)
+		v += 15000
+		if i%200 == 0 {
+			// Scrape jitter
+			v++
+		}
+	}
+	testMarshalUnmarshalInt64Array(t, va, 4, MarshalTypeDeltaRuns)
+
+	va = va[:0]
+	v = -1 << 62
+	for i := 0; i < 64; i++ {
+		va = append(va, v)
+		if i%16 == 0 {
+			v += 1 << 61
+		}
+	}
+	testMarshalUnmarshalInt64Array(t, va, 4, MarshalTypeDeltaRuns)
+}
+
+func TestUnmarshalInt64DeltaRunsFailure(t *testing.T) {
+	f := func(src []byte, itemsCount int) {
+		t.Helper()
+		if _, err := unmarshalInt64DeltaRuns(nil, src, 0, itemsCount); err == nil {
+			t.Fatalf("expecting non-nil error for src=%X, itemsCount=%d", src, itemsCount)
+		}
+	}
+	var src []byte
+	src = MarshalVarInt64(src, 5)
+	src = MarshalVarUint64(src, 10)
+
+	// Too many items in the run
+	f(src, 10)
+
+	// Too few items
+	f(src, 20)
+
+	// Zero run length
+	f(MarshalVarUint64(MarshalVarInt64(nil, 1), 0), 2)
+
+	// Truncated data
+	f(src[:1], 11)
+}
+
 func testMarshalInt64ArraySize(t *testing.T, va []int64, precisionBits uint8, minSizeExpected, maxSizeExpected int) {
 	t.Helper()
 
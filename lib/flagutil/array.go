@@ -16,6 +16,15 @@ func NewArray(name, description string) *Array {
 	return &a
 }
 
+// NewSelectorArray returns new SelectorArray with the given name and description.
+func NewSelectorArray(name, description string) *SelectorArray {
+	description += "\nSupports `array` of values separated by comma" +
+		" or specified via multiple flags. Commas inside curly braces aren't treated as delimiters."
+	var a SelectorArray
+	flag.Var(&a, name, description)
+	return &a
+}
+
 // Array is a flag that holds an array of values.
 //
 // It may be set either by specifying multiple flags with the given name
@@ -46,18 +55,42 @@ func (a *Array) String() string {
 
 // Set implements flag.Value interface
 func (a *Array) Set(value string) error {
-	values := parseArrayValues(value)
+	values := parseArrayValues(value, false)
+	*a = append(*a, values...)
+	return nil
+}
+
+// SelectorArray is an Array for series selectors.
+//
+// Unlike Array, commas inside curly braces aren't treated as delimiters,
+// so series selectors such as `{job="foo",env="bar"}` may be passed without quoting:
+//
+//     -foo='{job="foo",env="bar"},{job="baz"}'
+//
+type SelectorArray []string
+
+// String implements flag.Value interface
+func (a *SelectorArray) String() string {
+	return (*Array)(a).String()
+}
+
+// Set implements flag.Value interface
+func (a *SelectorArray) Set(value string) error {
+	values := parseArrayValues(value, true)
 	*a = append(*a, values...)
 	return nil
 }
 
-func parseArrayValues(s string) []string {
+// parseArrayValues parses comma-separated values from s.
+//
+// Commas inside curly braces aren't treated as delimiters if skipBraces is set.
+func parseArrayValues(s string, skipBraces bool) []string {
 	if len(s) == 0 {
 		return nil
 	}
 	var values []string
 	for {
-		v, tail := getNextArrayValue(s)
+		v, tail := getNextArrayValue(s, skipBraces)
 		values = append(values, v)
 		if len(tail) == 0 {
 			return values
@@ -69,13 +102,16 @@ func parseArrayValues(s string) []string {
 	}
 }
 
-func getNextArrayValue(s string) (string, string) {
+func getNextArrayValue(s string, skipBraces bool) (string, string) {
 	if len(s) == 0 {
 		return "", ""
 	}
 	if s[0] != '"' {
 		// Fast path - unquoted string
 		n := strings.IndexByte(s, ',')
+		if skipBraces {
+			n = indexUnquotedValueEnd(s)
+		}
 		if n < 0 {
 			// The last item
 			return s, ""
@@ -113,6 +149,34 @@ func getNextArrayValue(s string) (string, string) {
 	return v, s[end:]
 }
 
+// indexUnquotedValueEnd returns the index of comma after the unquoted value at s or -1 if the value ends at the end of s.
+//
+// Commas inside curly braces aren't treated as delimiters.
+func indexUnquotedValueEnd(s string) int {
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuote = false
+			}
+		case c == '"' && depth > 0:
+			inQuote = true
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
 // GetOptionalArg returns optional arg under the given argIdx.
 func (a *Array) GetOptionalArg(argIdx int) string {
 	x := *a
@@ -52,6 +52,10 @@ func TestArraySet(t *testing.T) {
 	f(`"foo,b\nar"`, []string{`foo,b` + "\n" + `ar`})
 	f(`"foo","bar",baz`, []string{`foo`, `bar`, `baz`})
 	f(`,fo,"\"b, a'\\",,r,`, []string{``, `fo`, `"b, a'\`, ``, `r`, ``})
+
+	// Commas inside curly braces are treated as delimiters
+	f(`{job="foo",env="bar"},baz`, []string{`{job="foo"`, `env="bar"}`, `baz`})
+	f(`foo{a="b",c="d"}`, []string{`foo{a="b"`, `c="d"}`})
 }
 
 func TestArrayGetOptionalArg(t *testing.T) {
@@ -91,3 +95,24 @@ func TestArrayString(t *testing.T) {
 	f(`", foo","b\"ar",`)
 	f(`,"\nfoo\\",bar`)
 }
+
+func TestSelectorArraySet(t *testing.T) {
+	f := func(s string, expectedValues []string) {
+		t.Helper()
+		var a SelectorArray
+		_ = a.Set(s)
+		if !reflect.DeepEqual([]string(a), expectedValues) {
+			t.Fatalf("unexpected values parsed;\ngot\n%q\nwant\n%q", a, expectedValues)
+		}
+	}
+	f("", nil)
+	f(`foo`, []string{`foo`})
+	f(`foo,b ar,baz`, []string{`foo`, `b ar`, `baz`})
+	f(`"foo","bar",baz`, []string{`foo`, `bar`, `baz`})
+
+	// Commas inside curly braces
+	f(`{job="foo",env="bar"},baz`, []string{`{job="foo",env="bar"}`, `baz`})
+	f(`{a="},{\"x,y"},{b=~"c|d"}`, []string{`{a="},{\"x,y"}`, `{b=~"c|d"}`})
+	f(`foo{a="b",c="d"}`, []string{`foo{a="b",c="d"}`})
+	f(`{a="b",c`, []string{`{a="b",c`})
+}
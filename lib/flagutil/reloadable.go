@@ -0,0 +1,270 @@
+package flagutil
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var reloadableFlagsFile = flag.String("reloadableFlagsFile", "", "Optional path to file with values for reloadable flags. "+
+	"The file must contain lines in the form '-flagName=value'. Lines starting with '#' are ignored. "+
+	"The file is re-read on SIGHUP signal or on /-/reload request, so the values for reloadable flags may be updated without restart. "+
+	"Reloadable flags missing in the file are reset to the values passed via command line")
+
+// reloadableValue is a flag value, which may be updated at runtime.
+type reloadableValue interface {
+	flag.Value
+
+	// check verifies whether s may be passed to Set.
+	check(s string) error
+}
+
+var (
+	reloadablesLock sync.Mutex
+	reloadables     = make(map[string]reloadableValue)
+
+	// initialValues contains values for reloadable flags obtained from command line.
+	initialValues map[string]string
+
+	// reloadCallbacks contains callbacks registered via OnReload.
+	reloadCallbacks []func()
+)
+
+// OnReload registers f to be called after the values for reloadable flags are updated from -reloadableFlagsFile.
+//
+// This may be used for applying the updated values, which are stored outside the flags.
+func OnReload(f func()) {
+	reloadablesLock.Lock()
+	reloadCallbacks = append(reloadCallbacks, f)
+	reloadablesLock.Unlock()
+}
+
+func registerReloadable(name string, v reloadableValue, description string) {
+	description += ". This flag may be updated without restart via -reloadableFlagsFile"
+	flag.Var(v, name, description)
+
+	reloadablesLock.Lock()
+	reloadables[name] = v
+	reloadablesLock.Unlock()
+}
+
+// InitReloadableFlags applies values from -reloadableFlagsFile and starts re-reading the file on SIGHUP.
+//
+// InitReloadableFlags must be called after flag.Parse.
+func InitReloadableFlags() {
+	reloadablesLock.Lock()
+	initialValues = make(map[string]string, len(reloadables))
+	for name, v := range reloadables {
+		initialValues[name] = v.String()
+	}
+	reloadablesLock.Unlock()
+
+	if len(*reloadableFlagsFile) == 0 {
+		return
+	}
+	if err := reloadFlags(*reloadableFlagsFile); err != nil {
+		logger.Fatalf("cannot apply -reloadableFlagsFile=%q: %s", *reloadableFlagsFile, err)
+	}
+	sighupCh := procutil.NewSighupChan()
+	go func() {
+		for range sighupCh {
+			logger.Infof("SIGHUP received; reloading -reloadableFlagsFile=%q", *reloadableFlagsFile)
+			if err := reloadFlags(*reloadableFlagsFile); err != nil {
+				flagsReloadErrors.Inc()
+				logger.Errorf("cannot apply -reloadableFlagsFile=%q: %s; preserving the previous flag values", *reloadableFlagsFile, err)
+				continue
+			}
+			flagsReloads.Inc()
+		}
+	}()
+}
+
+var (
+	flagsReloads      = metrics.NewCounter(`vm_reloadable_flags_reloads_total`)
+	flagsReloadErrors = metrics.NewCounter(`vm_reloadable_flags_reload_errors_total`)
+)
+
+func reloadFlags(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read file: %w", err)
+	}
+	values, err := parseFlagsFile(data)
+	if err != nil {
+		return err
+	}
+
+	if err := setReloadableValues(values); err != nil {
+		return err
+	}
+
+	reloadablesLock.Lock()
+	callbacks := append([]func(){}, reloadCallbacks...)
+	reloadablesLock.Unlock()
+	for _, f := range callbacks {
+		f()
+	}
+	return nil
+}
+
+func setReloadableValues(values map[string]string) error {
+	reloadablesLock.Lock()
+	defer reloadablesLock.Unlock()
+
+	// Verify all the values before applying them, so the flags aren't updated partially on error.
+	for name, value := range values {
+		v := reloadables[name]
+		if v == nil {
+			return fmt.Errorf("-%s isn't a reloadable flag; supported flags: %s", name, getReloadableNamesLocked())
+		}
+		if err := v.check(value); err != nil {
+			return fmt.Errorf("invalid value %q for -%s: %w", value, name, err)
+		}
+	}
+	for name, v := range reloadables {
+		value, ok := values[name]
+		if !ok {
+			value = initialValues[name]
+		}
+		prevValue := v.String()
+		if value == prevValue {
+			continue
+		}
+		if err := v.Set(value); err != nil {
+			logger.Panicf("BUG: cannot set verified value %q for -%s: %s", value, name, err)
+		}
+		logger.Infof("-%s has been changed from %q to %q", name, prevValue, value)
+	}
+	return nil
+}
+
+func getReloadableNamesLocked() string {
+	names := make([]string, 0, len(reloadables))
+	for name := range reloadables {
+		names = append(names, "-"+name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// parseFlagsFile parses data with lines in the form '-flagName=value'.
+func parseFlagsFile(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimLeft(line, "-")
+		n := strings.IndexByte(line, '=')
+		if n <= 0 {
+			return nil, fmt.Errorf("line %d: missing '=' in %q; the line must be in the form '-flagName=value'", lineNum, sc.Text())
+		}
+		name := line[:n]
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("line %d: duplicate value for -%s", lineNum, name)
+		}
+		values[name] = line[n+1:]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// NewReloadableInt returns new int flag with the given name, defaultValue and description.
+//
+// The flag value may be updated at runtime via -reloadableFlagsFile.
+func NewReloadableInt(name string, defaultValue int, description string) *ReloadableInt {
+	ri := &ReloadableInt{
+		n: int64(defaultValue),
+	}
+	registerReloadable(name, ri, description)
+	return ri
+}
+
+// ReloadableInt is int flag, which may be updated at runtime via -reloadableFlagsFile.
+type ReloadableInt struct {
+	n int64
+}
+
+// Get returns the current value for ri.
+func (ri *ReloadableInt) Get() int {
+	return int(atomic.LoadInt64(&ri.n))
+}
+
+// String implements flag.Value interface
+func (ri *ReloadableInt) String() string {
+	return strconv.Itoa(ri.Get())
+}
+
+// Set implements flag.Value interface
+func (ri *ReloadableInt) Set(value string) error {
+	n, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&ri.n, n)
+	return nil
+}
+
+func (ri *ReloadableInt) check(value string) error {
+	_, err := strconv.ParseInt(value, 0, 64)
+	return err
+}
+
+// NewReloadableDuration returns new duration flag with the given name, defaultValue and description.
+//
+// The flag value may be updated at runtime via -reloadableFlagsFile.
+func NewReloadableDuration(name string, defaultValue time.Duration, description string) *ReloadableDuration {
+	rd := &ReloadableDuration{
+		d: int64(defaultValue),
+	}
+	registerReloadable(name, rd, description)
+	return rd
+}
+
+// ReloadableDuration is duration flag, which may be updated at runtime via -reloadableFlagsFile.
+type ReloadableDuration struct {
+	d int64
+}
+
+// Get returns the current value for rd.
+func (rd *ReloadableDuration) Get() time.Duration {
+	return time.Duration(atomic.LoadInt64(&rd.d))
+}
+
+// String implements flag.Value interface
+func (rd *ReloadableDuration) String() string {
+	return rd.Get().String()
+}
+
+// Set implements flag.Value interface
+func (rd *ReloadableDuration) Set(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&rd.d, int64(d))
+	return nil
+}
+
+func (rd *ReloadableDuration) check(value string) error {
+	_, err := time.ParseDuration(value)
+	return err
+}
@@ -0,0 +1,103 @@
+package flagutil
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFlagsFileSuccess(t *testing.T) {
+	f := func(s string, valuesExpected map[string]string) {
+		t.Helper()
+		values, err := parseFlagsFile([]byte(s))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(values, valuesExpected) {
+			t.Fatalf("unexpected values; got %v; want %v", values, valuesExpected)
+		}
+	}
+	f("", map[string]string{})
+	f(`
+# comment
+-foo=bar
+
+  --baz=1s
+x=
+`, map[string]string{
+		"foo": "bar",
+		"baz": "1s",
+		"x":   "",
+	})
+}
+
+func TestParseFlagsFileFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		_, err := parseFlagsFile([]byte(s))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f("-foo")
+	f("-=bar")
+	f("-foo=bar\n-foo=baz")
+}
+
+func TestReloadFlags(t *testing.T) {
+	ri := NewReloadableInt("testReloadableInt", 123, "test int flag")
+	rd := NewReloadableDuration("testReloadableDuration", time.Second, "test duration flag")
+	if err := ri.Set("42"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	InitReloadableFlags()
+
+	f, err := ioutil.TempFile("", "reloadable_flags")
+	if err != nil {
+		t.Fatalf("cannot create temporary file: %s", err)
+	}
+	path := f.Name()
+	_ = f.Close()
+	defer func() {
+		_ = os.Remove(path)
+	}()
+	callbackN := 0
+	OnReload(func() {
+		callbackN = ri.Get()
+	})
+	reload := func(s string, isErrorExpected bool, nExpected int, dExpected time.Duration) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Fatalf("cannot write %q: %s", path, err)
+		}
+		err := reloadFlags(path)
+		if isErrorExpected && err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if !isErrorExpected && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n := ri.Get(); n != nExpected {
+			t.Fatalf("unexpected int value; got %d; want %d", n, nExpected)
+		}
+		if d := rd.Get(); d != dExpected {
+			t.Fatalf("unexpected duration value; got %s; want %s", d, dExpected)
+		}
+		if !isErrorExpected && callbackN != nExpected {
+			t.Fatalf("unexpected int value passed to OnReload callback; got %d; want %d", callbackN, nExpected)
+		}
+	}
+	reload("-testReloadableInt=10\n-testReloadableDuration=5m", false, 10, 5*time.Minute)
+
+	// Missing flags are reset to the values from command line
+	reload("-testReloadableDuration=1h", false, 42, time.Hour)
+
+	// Invalid values don't change flags
+	reload("-testReloadableInt=20\n-testReloadableDuration=foo", true, 42, time.Hour)
+	reload("-testReloadableInt=20\n-unknownFlag=1", true, 42, time.Hour)
+	reload("-testReloadableInt", true, 42, time.Hour)
+
+	reload("", false, 42, time.Second)
+}
@@ -0,0 +1,11 @@
+package fs
+
+func fadviseRandomRead(fd int) error {
+	// fadvise isn't supported on darwin, so rely on madvise only.
+	return nil
+}
+
+func fadviseSequentialRead(fd int) error {
+	// fadvise isn't supported on darwin, so rely on madvise only.
+	return nil
+}
@@ -0,0 +1,21 @@
+package fs
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+func fadviseRandomRead(fd int) error {
+	if err := unix.Fadvise(fd, 0, 0, unix.FADV_RANDOM); err != nil {
+		return fmt.Errorf("unix.Fadvise(FADV_RANDOM) error: %w", err)
+	}
+	return nil
+}
+
+func fadviseSequentialRead(fd int) error {
+	if err := unix.Fadvise(fd, 0, 0, unix.FADV_SEQUENTIAL); err != nil {
+		return fmt.Errorf("unix.Fadvise(FADV_SEQUENTIAL) error: %w", err)
+	}
+	return nil
+}
@@ -17,6 +17,11 @@ var disableMmap = flag.Bool("fs.disableMmap", is32BitPtr, "Whether to use pread(
 	"By default mmap() is used for 64-bit arches and pread() is used for 32-bit arches, since they cannot read data files bigger than 2^32 bytes in memory. "+
 	"mmap() is usually faster for reading small data chunks than pread()")
 
+var enableAccessHints = flag.Bool("fs.enableAccessHints", false, "Whether to pass access pattern hints to the OS for data files via madvise() and fadvise(). "+
+	"If enabled, random access is advised for index files and sequential access is advised for data files. "+
+	"This may reduce page cache thrashing on fast NVMe disks when data doesn't fit the page cache, "+
+	"while it may slow down queries on network disks with high latency, since read-ahead is disabled for index files. See also -fs.disableMmap")
+
 const is32BitPtr = (^uintptr(0) >> 32) == 0
 
 // MustReadAtCloser is rand-access read interface.
@@ -149,6 +154,36 @@ func (r *ReaderAt) MustClose() {
 	readersCount.Dec()
 }
 
+// MustAdviseRandomRead advises the OS that r is going to be read at random offsets.
+//
+// This disables read-ahead for r, so the page cache isn't polluted with unneeded data.
+// The advice is ignored if -fs.enableAccessHints isn't set.
+func (r *ReaderAt) MustAdviseRandomRead() {
+	r.mustAdvise(unix.MADV_RANDOM, fadviseRandomRead)
+}
+
+// MustAdviseSequentialRead advises the OS that r is going to be read sequentially.
+//
+// This enables aggressive read-ahead for r.
+// The advice is ignored if -fs.enableAccessHints isn't set.
+func (r *ReaderAt) MustAdviseSequentialRead() {
+	r.mustAdvise(unix.MADV_SEQUENTIAL, fadviseSequentialRead)
+}
+
+func (r *ReaderAt) mustAdvise(madviseAdvice int, fadvise func(fd int) error) {
+	if !*enableAccessHints {
+		return
+	}
+	if len(r.mmapData) > 0 {
+		if err := unix.Madvise(r.mmapData[:cap(r.mmapData)], madviseAdvice); err != nil {
+			logger.Panicf("FATAL: error in madvise() for file %q: %s", r.f.Name(), err)
+		}
+	}
+	if err := fadvise(int(r.f.Fd())); err != nil {
+		logger.Panicf("FATAL: error in fadvise() for file %q: %s", r.f.Name(), err)
+	}
+}
+
 // OpenReaderAt opens ReaderAt for reading from filename.
 //
 // MustClose must be called on the returned ReaderAt when it is no longer needed.
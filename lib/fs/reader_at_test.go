@@ -35,3 +35,32 @@ func testReaderAt(t *testing.T, bufSize int) {
 		r.MustReadAt(buf, offset)
 	}
 }
+
+func TestReaderAtAccessHints(t *testing.T) {
+	defer func(enableAccessHintsOrig, disableMmapOrig bool) {
+		*enableAccessHints = enableAccessHintsOrig
+		*disableMmap = disableMmapOrig
+	}(*enableAccessHints, *disableMmap)
+
+	*enableAccessHints = true
+	for _, mmapDisabled := range []bool{false, true} {
+		*disableMmap = mmapDisabled
+		for _, fileSize := range []int{0, 1, 4096, 1e5} {
+			path := "TestReaderAtAccessHints"
+			data := make([]byte, fileSize)
+			if err := ioutil.WriteFile(path, data, 0600); err != nil {
+				t.Fatalf("cannot create %q: %s", path, err)
+			}
+			r, err := OpenReaderAt(path)
+			if err != nil {
+				t.Fatalf("error in OpenReaderAt(%q): %s", path, err)
+			}
+			r.MustAdviseRandomRead()
+			r.MustAdviseSequentialRead()
+			buf := make([]byte, fileSize)
+			r.MustReadAt(buf, 0)
+			r.MustClose()
+			MustRemoveAll(path)
+		}
+	}
+}
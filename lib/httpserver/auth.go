@@ -0,0 +1,191 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"flag"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	httpAuthUsername    = flag.String("httpAuth.username", "", "Username for HTTP Basic Auth. The authentication is disabled if empty. See also -httpAuth.password")
+	httpAuthPassword    = flag.String("httpAuth.password", "", "Password for HTTP Basic Auth. The authentication is disabled if -httpAuth.username is empty")
+	httpAuthBearerToken = flag.String("httpAuth.bearerToken", "", "Bearer token, which must be passed in 'Authorization: Bearer <token>' request header. "+
+		"If -httpAuth.username is set too, then either valid Basic Auth credentials or valid bearer token is accepted. The authentication is disabled if empty")
+
+	metricsAuthUsername = flag.String("metricsAuth.username", "", "Username for HTTP Basic Auth at /metrics page. See also -metricsAuth.password and -metricsAuth.bearerToken. "+
+		"/metrics page isn't protected by -httpAuth.* flags")
+	metricsAuthPassword    = flag.String("metricsAuth.password", "", "Password for HTTP Basic Auth at /metrics page. Used only if -metricsAuth.username is set")
+	metricsAuthBearerToken = flag.String("metricsAuth.bearerToken", "", "Bearer token for /metrics page. See also -metricsAuth.username")
+
+	adminAuthUsername = flag.String("adminAuth.username", "", "Username for HTTP Basic Auth at admin endpoints such as /api/v1/admin/*, /snapshot/*, /internal/* and /debug/pprof/*. "+
+		"Admin endpoints are protected by -httpAuth.* flags if -adminAuth.username and -adminAuth.bearerToken aren't set. See also -adminAuth.password")
+	adminAuthPassword    = flag.String("adminAuth.password", "", "Password for HTTP Basic Auth at admin endpoints. Used only if -adminAuth.username is set")
+	adminAuthBearerToken = flag.String("adminAuth.bearerToken", "", "Bearer token for admin endpoints. See also -adminAuth.username")
+
+	disableDestructiveAPIs = flag.Bool("disableDestructiveAPIs", false, "Whether to reject requests to APIs, which delete data, manage snapshots or reset caches, "+
+		"such as /api/v1/admin/tsdb/delete_series, /api/v1/admin/tsdb/snapshot, /snapshot/create, /snapshot/delete, /snapshot/delete_all and /internal/reset*. "+
+		"This may be useful for query-facing instances exposed to untrusted users")
+)
+
+var (
+	httpAuth = &authConfig{
+		flagPrefix:  "httpAuth",
+		username:    httpAuthUsername,
+		password:    httpAuthPassword,
+		bearerToken: httpAuthBearerToken,
+	}
+	metricsAuth = &authConfig{
+		flagPrefix:  "metricsAuth",
+		username:    metricsAuthUsername,
+		password:    metricsAuthPassword,
+		bearerToken: metricsAuthBearerToken,
+	}
+	adminAuth = &authConfig{
+		flagPrefix:  "adminAuth",
+		username:    adminAuthUsername,
+		password:    adminAuthPassword,
+		bearerToken: adminAuthBearerToken,
+	}
+)
+
+// adminPathPrefixes contains path prefixes for admin endpoints, which are protected by -adminAuth.* flags.
+var adminPathPrefixes = []string{
+	"/api/v1/admin/",
+	"/snapshot/",
+	"/internal/",
+	"/debug/pprof/",
+}
+
+func isAdminPath(path string) bool {
+	path = normalizePath(path)
+	for _, prefix := range adminPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// destructivePaths contains paths for APIs, which are disabled by -disableDestructiveAPIs.
+var destructivePaths = []string{
+	"/api/v1/admin/tsdb/delete_series",
+	"/api/v1/admin/tsdb/snapshot",
+	"/snapshot/create",
+	"/snapshot/delete",
+	"/snapshot/delete_all",
+}
+
+// destructivePathPrefixes contains path prefixes for APIs, which are disabled by -disableDestructiveAPIs.
+var destructivePathPrefixes = []string{
+	"/internal/reset",
+}
+
+func isDestructivePath(path string) bool {
+	path = normalizePath(path)
+	for _, p := range destructivePaths {
+		if path == p {
+			return true
+		}
+	}
+	for _, prefix := range destructivePathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePath returns path in the form, which is used by request handlers for routing.
+func normalizePath(path string) string {
+	return strings.Replace(path, "//", "/", -1)
+}
+
+// checkDestructiveAPI verifies whether the request r to a destructive API is allowed.
+//
+// It sends 403 Forbidden response to w and returns false if -disableDestructiveAPIs is set and r.URL.Path points to a destructive API.
+func checkDestructiveAPI(w http.ResponseWriter, r *http.Request) bool {
+	if !*disableDestructiveAPIs || !isDestructivePath(r.URL.Path) {
+		return true
+	}
+	destructiveRequestErrors.Inc()
+	http.Error(w, "the requested API is disabled via -disableDestructiveAPIs command-line flag", http.StatusForbidden)
+	return false
+}
+
+// checkAuth verifies whether the request r is authorized to access r.URL.Path.
+//
+// It sends an error response to w and returns false if r isn't authorized.
+func checkAuth(w http.ResponseWriter, r *http.Request) bool {
+	path := r.URL.Path
+	if path == "/metrics" {
+		return metricsAuth.check(w, r)
+	}
+	if isAdminPath(path) && adminAuth.isEnabled() {
+		return adminAuth.check(w, r)
+	}
+	if strings.HasPrefix(path, "/debug/pprof/") {
+		// pprof handlers are protected only by -pprofAuthKey and -adminAuth.* flags for backwards compatibility.
+		return true
+	}
+	return httpAuth.check(w, r)
+}
+
+// authConfig holds credentials for HTTP Basic Auth and bearer token authentication.
+type authConfig struct {
+	flagPrefix  string
+	username    *string
+	password    *string
+	bearerToken *string
+}
+
+func (ac *authConfig) isEnabled() bool {
+	return len(*ac.username) > 0 || len(*ac.bearerToken) > 0
+}
+
+// check returns true if r contains valid credentials for ac.
+//
+// Otherwise it sends 401 Unauthorized response to w and returns false.
+func (ac *authConfig) check(w http.ResponseWriter, r *http.Request) bool {
+	if !ac.isEnabled() {
+		// The authentication is disabled.
+		return true
+	}
+	if len(*ac.bearerToken) > 0 {
+		if token, ok := getBearerToken(r); ok && secureCompare(token, *ac.bearerToken) {
+			return true
+		}
+	}
+	if len(*ac.username) > 0 {
+		username, password, ok := r.BasicAuth()
+		if ok && secureCompare(username, *ac.username) && secureCompare(password, *ac.password) {
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="VictoriaMetrics"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="VictoriaMetrics"`)
+	}
+	unauthorizedRequestErrors.Inc()
+	http.Error(w, "missing or invalid credentials; see -"+ac.flagPrefix+".* command-line flags", http.StatusUnauthorized)
+	return false
+}
+
+func getBearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
+
+// secureCompare compares a with b in constant time in order to prevent from timing attacks.
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+var unauthorizedRequestErrors = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="unauthorized"}`)
+
+var destructiveRequestErrors = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="destructive_api_disabled"}`)
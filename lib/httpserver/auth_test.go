@@ -0,0 +1,108 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthConfigCheck(t *testing.T) {
+	newAuthConfig := func(username, password, bearerToken string) *authConfig {
+		return &authConfig{
+			flagPrefix:  "test",
+			username:    &username,
+			password:    &password,
+			bearerToken: &bearerToken,
+		}
+	}
+	f := func(ac *authConfig, setAuth func(r *http.Request), resultExpected bool) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/api/v1/query", nil)
+		if setAuth != nil {
+			setAuth(r)
+		}
+		w := httptest.NewRecorder()
+		result := ac.check(w, r)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+		}
+		if !result && w.Code != http.StatusUnauthorized {
+			t.Fatalf("unexpected response code; got %d; want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+	basicAuth := func(username, password string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.SetBasicAuth(username, password)
+		}
+	}
+	bearerToken := func(token string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	// Disabled auth
+	f(newAuthConfig("", "", ""), nil, true)
+	f(newAuthConfig("", "", ""), basicAuth("foo", "bar"), true)
+
+	// Basic auth
+	ac := newAuthConfig("foo", "bar", "")
+	f(ac, nil, false)
+	f(ac, basicAuth("foo", "bar"), true)
+	f(ac, basicAuth("foo", "baz"), false)
+	f(ac, basicAuth("bar", "bar"), false)
+	f(ac, bearerToken("bar"), false)
+
+	// Bearer token
+	ac = newAuthConfig("", "", "secret")
+	f(ac, nil, false)
+	f(ac, bearerToken("secret"), true)
+	f(ac, bearerToken("secret1"), false)
+	f(ac, basicAuth("secret", "secret"), false)
+
+	// Either basic auth or bearer token
+	ac = newAuthConfig("foo", "bar", "secret")
+	f(ac, nil, false)
+	f(ac, basicAuth("foo", "bar"), true)
+	f(ac, bearerToken("secret"), true)
+	f(ac, bearerToken("bar"), false)
+}
+
+func TestIsAdminPath(t *testing.T) {
+	f := func(path string, resultExpected bool) {
+		t.Helper()
+		if result := isAdminPath(path); result != resultExpected {
+			t.Fatalf("unexpected result for isAdminPath(%q); got %v; want %v", path, result, resultExpected)
+		}
+	}
+	f("/api/v1/admin/tsdb/delete_series", true)
+	f("/snapshot/create", true)
+	f("/internal/resetRollupResultCache", true)
+	f("/debug/pprof/heap", true)
+	f("//internal/resetRollupResultCache", true)
+	f("/api/v1/query", false)
+	f("/metrics", false)
+	f("/snapshot", false)
+}
+
+func TestIsDestructivePath(t *testing.T) {
+	f := func(path string, resultExpected bool) {
+		t.Helper()
+		if result := isDestructivePath(path); result != resultExpected {
+			t.Fatalf("unexpected result for isDestructivePath(%q); got %v; want %v", path, result, resultExpected)
+		}
+	}
+	f("/api/v1/admin/tsdb/delete_series", true)
+	f("/api/v1/admin/tsdb/snapshot", true)
+	f("/snapshot/create", true)
+	f("/snapshot/delete", true)
+	f("/snapshot/delete_all", true)
+	f("/internal/resetRollupResultCache", true)
+	f("/internal/resetTagFiltersCache", true)
+	f("//internal//resetMetricNameCache", true)
+	f("//api/v1/admin/tsdb/delete_series", true)
+	f("/snapshot/list", false)
+	f("/api/v1/admin/tsdb/partitions", false)
+	f("/api/v1/query", false)
+	f("/metrics", false)
+}
@@ -0,0 +1,76 @@
+package httpserver
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+)
+
+var (
+	corsAllowedOrigins = flagutil.NewArray("http.corsAllowedOrigins", "Origins allowed to send cross-origin requests to APIs with CORS support such as /api/v1/query. "+
+		"By default requests from any origin are allowed. See https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS")
+	corsMaxAge = flag.Duration("http.corsMaxAge", 0, "How long browsers may cache responses to CORS preflight requests. Browser defaults are used if set to 0")
+)
+
+// EnableCORS enables https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS
+// on the response.
+//
+// The allowed origins may be limited with -http.corsAllowedOrigins command-line flag.
+func EnableCORS(w http.ResponseWriter, r *http.Request) {
+	origin := getCORSAllowedOrigin(r)
+	if origin == "" {
+		return
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	if origin != "*" {
+		// The response depends on Origin request header, so caching proxies must take it into account.
+		h.Add("Vary", "Origin")
+	}
+}
+
+// HandleCORSPreflight serves CORS preflight request r.
+//
+// It returns false if r isn't a CORS preflight request. In this case the caller must serve r.
+func HandleCORSPreflight(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get("Origin") == "" || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	EnableCORS(w, r)
+	h := w.Header()
+	h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if *corsMaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// getCORSAllowedOrigin returns the value for Access-Control-Allow-Origin response header for r.
+//
+// An empty string is returned if the origin of r isn't allowed.
+func getCORSAllowedOrigin(r *http.Request) string {
+	if len(*corsAllowedOrigins) == 0 {
+		return "*"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range *corsAllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
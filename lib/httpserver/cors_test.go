@@ -0,0 +1,83 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnableCORS(t *testing.T) {
+	originsOrig := *corsAllowedOrigins
+	defer func() {
+		*corsAllowedOrigins = originsOrig
+	}()
+
+	f := func(allowedOrigins []string, origin, expectedAllowOrigin string) {
+		t.Helper()
+		*corsAllowedOrigins = allowedOrigins
+		r := httptest.NewRequest("GET", "/api/v1/query", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		EnableCORS(w, r)
+		if v := w.Header().Get("Access-Control-Allow-Origin"); v != expectedAllowOrigin {
+			t.Fatalf("unexpected Access-Control-Allow-Origin; got %q; want %q", v, expectedAllowOrigin)
+		}
+	}
+
+	// Any origin is allowed by default
+	f(nil, "", "*")
+	f(nil, "https://grafana.example.com", "*")
+
+	// Limited origins
+	f([]string{"https://grafana.example.com"}, "https://grafana.example.com", "https://grafana.example.com")
+	f([]string{"https://foo.example.com", "https://grafana.example.com"}, "https://Grafana.example.com", "https://Grafana.example.com")
+	f([]string{"https://grafana.example.com"}, "https://evil.example.com", "")
+	f([]string{"https://grafana.example.com"}, "", "")
+	f([]string{"https://grafana.example.com", "*"}, "https://evil.example.com", "*")
+}
+
+func TestHandleCORSPreflight(t *testing.T) {
+	originsOrig := *corsAllowedOrigins
+	defer func() {
+		*corsAllowedOrigins = originsOrig
+	}()
+	*corsAllowedOrigins = []string{"https://grafana.example.com"}
+
+	// Non-preflight requests must be passed to the caller.
+	r := httptest.NewRequest("GET", "/api/v1/query", nil)
+	r.Header.Set("Origin", "https://grafana.example.com")
+	w := httptest.NewRecorder()
+	if HandleCORSPreflight(w, r) {
+		t.Fatalf("GET request mustn't be handled as CORS preflight request")
+	}
+	r = httptest.NewRequest("OPTIONS", "/api/v1/query", nil)
+	w = httptest.NewRecorder()
+	if HandleCORSPreflight(w, r) {
+		t.Fatalf("OPTIONS request without Origin mustn't be handled as CORS preflight request")
+	}
+
+	// Preflight request
+	r = httptest.NewRequest("OPTIONS", "/api/v1/query", nil)
+	r.Header.Set("Origin", "https://grafana.example.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	w = httptest.NewRecorder()
+	if !HandleCORSPreflight(w, r) {
+		t.Fatalf("expecting CORS preflight request to be handled")
+	}
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code; got %d; want %d", w.Code, http.StatusNoContent)
+	}
+	h := w.Header()
+	if v := h.Get("Access-Control-Allow-Origin"); v != "https://grafana.example.com" {
+		t.Fatalf("unexpected Access-Control-Allow-Origin: %q", v)
+	}
+	if v := h.Get("Access-Control-Allow-Methods"); v != "GET, POST, OPTIONS" {
+		t.Fatalf("unexpected Access-Control-Allow-Methods: %q", v)
+	}
+	if v := h.Get("Access-Control-Allow-Headers"); v != "Content-Type" {
+		t.Fatalf("unexpected Access-Control-Allow-Headers: %q", v)
+	}
+}
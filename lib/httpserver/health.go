@@ -0,0 +1,131 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// RegisterReadinessCheck registers readiness check with the given name.
+//
+// The check must return non-nil error if the service isn't ready for serving requests.
+// All the registered checks are evaluated on every /ready request.
+func RegisterReadinessCheck(name string, check func() error) {
+	readinessChecksLock.Lock()
+	defer readinessChecksLock.Unlock()
+	for _, rc := range readinessChecks {
+		if rc.name == name {
+			logger.Panicf("BUG: readiness check %q is already registered", name)
+		}
+	}
+	readinessChecks = append(readinessChecks, readinessCheck{
+		name:  name,
+		check: check,
+	})
+}
+
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+var (
+	readinessChecksLock sync.Mutex
+	readinessChecks     []readinessCheck
+)
+
+// healthResponse is the response for /health and /ready.
+type healthResponse struct {
+	Status        string        `json:"status"`
+	UptimeSeconds int64         `json:"uptimeSeconds"`
+	Error         string        `json:"error,omitempty"`
+	Checks        []checkResult `json:"checks,omitempty"`
+}
+
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleHealth returns non-OK response only if the server is in delayed shutdown mode.
+//
+// The response doesn't depend on readiness checks, since it is used for determining whether the process is alive.
+func handleHealth(w http.ResponseWriter, s *server) {
+	resp := &healthResponse{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+	}
+	if err := getShutdownError(s); err != nil {
+		resp.Status = "unavailable"
+		resp.Error = err.Error()
+	}
+	writeHealthResponse(w, resp)
+}
+
+// handleReady returns OK response only if all the registered readiness checks pass.
+func handleReady(w http.ResponseWriter, s *server) {
+	resp := &healthResponse{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+	}
+	if err := getShutdownError(s); err != nil {
+		resp.Status = "unavailable"
+		resp.Error = err.Error()
+	}
+	readinessChecksLock.Lock()
+	checks := append([]readinessCheck{}, readinessChecks...)
+	readinessChecksLock.Unlock()
+	for _, rc := range checks {
+		cr := checkResult{
+			Name:   rc.name,
+			Status: "ok",
+		}
+		if err := rc.check(); err != nil {
+			cr.Status = "unavailable"
+			cr.Error = err.Error()
+			resp.Status = "unavailable"
+		}
+		resp.Checks = append(resp.Checks, cr)
+	}
+	if resp.Status != "ok" {
+		readyFailures.Inc()
+	}
+	writeHealthResponse(w, resp)
+}
+
+func getShutdownError(s *server) error {
+	deadline := atomic.LoadInt64(&s.shutdownDelayDeadline)
+	if deadline <= 0 {
+		return nil
+	}
+	// Return non-OK response during grace period before shutting down the server.
+	// Load balancers must notify these responses and re-route new requests to other servers.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/463 .
+	d := time.Until(time.Unix(0, deadline))
+	if d < 0 {
+		d = 0
+	}
+	return fmt.Errorf("the server is in delayed shutdown mode, which will end in %.3fs", d.Seconds())
+}
+
+func writeHealthResponse(w http.ResponseWriter, resp *healthResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal health response: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	// Ignore the error, since it may occur only if the client closes the connection.
+	_, _ = w.Write(data)
+}
+
+var readyFailures = metrics.NewCounter(`vm_http_ready_failures_total`)
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandleReady(t *testing.T) {
+	readinessChecksLock.Lock()
+	prevChecks := readinessChecks
+	readinessChecks = nil
+	readinessChecksLock.Unlock()
+	defer func() {
+		readinessChecksLock.Lock()
+		readinessChecks = prevChecks
+		readinessChecksLock.Unlock()
+	}()
+
+	var storageErr error
+	RegisterReadinessCheck("foo", func() error { return nil })
+	RegisterReadinessCheck("storage", func() error { return storageErr })
+
+	f := func(s *server, statusCodeExpected int, statusExpected string, checksExpected []checkResult) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handleReady(w, s)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+		}
+		var resp healthResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot unmarshal response %q: %s", w.Body.Bytes(), err)
+		}
+		if resp.Status != statusExpected {
+			t.Fatalf("unexpected status; got %q; want %q", resp.Status, statusExpected)
+		}
+		if !reflect.DeepEqual(resp.Checks, checksExpected) {
+			t.Fatalf("unexpected checks\ngot\n%+v\nwant\n%+v", resp.Checks, checksExpected)
+		}
+	}
+
+	s := &server{}
+	f(s, http.StatusOK, "ok", []checkResult{
+		{Name: "foo", Status: "ok"},
+		{Name: "storage", Status: "ok"},
+	})
+
+	storageErr = fmt.Errorf("the storage is being opened")
+	f(s, http.StatusServiceUnavailable, "unavailable", []checkResult{
+		{Name: "foo", Status: "ok"},
+		{Name: "storage", Status: "unavailable", Error: "the storage is being opened"},
+	})
+
+	// Delayed shutdown must result in non-OK response even if all the checks pass.
+	storageErr = nil
+	atomic.StoreInt64(&s.shutdownDelayDeadline, time.Now().Add(time.Second).UnixNano())
+	f(s, http.StatusServiceUnavailable, "unavailable", []checkResult{
+		{Name: "foo", Status: "ok"},
+		{Name: "storage", Status: "ok"},
+	})
+}
+
+func TestHandleHealth(t *testing.T) {
+	f := func(s *server, statusCodeExpected int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handleHealth(w, s)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+		}
+		var resp healthResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot unmarshal response %q: %s", w.Body.Bytes(), err)
+		}
+		if len(resp.Checks) > 0 {
+			t.Fatalf("unexpected checks in /health response: %+v", resp.Checks)
+		}
+	}
+
+	s := &server{}
+	f(s, http.StatusOK)
+
+	atomic.StoreInt64(&s.shutdownDelayDeadline, time.Now().Add(time.Second).UnixNano())
+	f(s, http.StatusServiceUnavailable)
+}
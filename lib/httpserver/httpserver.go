@@ -21,6 +21,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/klauspost/compress/gzip"
 	"github.com/valyala/fastrand"
@@ -28,16 +29,15 @@ import (
 
 var (
 	tlsEnable   = flag.Bool("tls", false, "Whether to enable TLS (aka HTTPS) for incoming requests. -tlsCertFile and -tlsKeyFile must be set if -tls is set")
-	tlsCertFile = flag.String("tlsCertFile", "", "Path to file with TLS certificate. Used only if -tls is set. Prefer ECDSA certs instead of RSA certs, since RSA certs are slow")
-	tlsKeyFile  = flag.String("tlsKeyFile", "", "Path to file with TLS key. Used only if -tls is set")
+	tlsCertFile = flag.String("tlsCertFile", "", "Path to file with TLS certificate. Used only if -tls is set. Prefer ECDSA certs instead of RSA certs, since RSA certs are slow. "+
+		"The certificate is automatically reloaded when -tlsCertFile or -tlsKeyFile changes")
+	tlsKeyFile = flag.String("tlsKeyFile", "", "Path to file with TLS key. Used only if -tls is set. The key is automatically reloaded when -tlsCertFile or -tlsKeyFile changes")
 
 	pathPrefix = flag.String("http.pathPrefix", "", "An optional prefix to add to all the paths handled by http server. For example, if '-http.pathPrefix=/foo/bar' is set, "+
 		"then all the http requests will be handled on '/foo/bar/*' paths. This may be useful for proxied requests. "+
 		"See https://www.robustperception.io/using-external-urls-and-proxies-with-prometheus")
-	httpAuthUsername = flag.String("httpAuth.username", "", "Username for HTTP Basic Auth. The authentication is disabled if empty. See also -httpAuth.password")
-	httpAuthPassword = flag.String("httpAuth.password", "", "Password for HTTP Basic Auth. The authentication is disabled if -httpAuth.username is empty")
-	metricsAuthKey   = flag.String("metricsAuthKey", "", "Auth key for /metrics. It overrides httpAuth settings")
-	pprofAuthKey     = flag.String("pprofAuthKey", "", "Auth key for /debug/pprof. It overrides httpAuth settings")
+	metricsAuthKey = flag.String("metricsAuthKey", "", "Auth key for /metrics. It must be passed via authKey query arg. See also -metricsAuth.*")
+	pprofAuthKey   = flag.String("pprofAuthKey", "", "Auth key for /debug/pprof. It must be passed via authKey query arg. See also -adminAuth.*")
 
 	disableResponseCompression  = flag.Bool("http.disableResponseCompression", false, "Disable compression of HTTP responses for saving CPU resources. By default compression is enabled to save network bandwidth")
 	maxGracefulShutdownDuration = flag.Duration("http.maxGracefulShutdownDuration", 7*time.Second, "The maximum duration for graceful shutdown of HTTP server. "+
@@ -85,18 +85,7 @@ func Serve(addr string, rh RequestHandler) {
 	if err != nil {
 		logger.Fatalf("cannot start http server at %s: %s", addr, err)
 	}
-	ln := net.Listener(lnTmp)
-
-	if *tlsEnable {
-		cert, err := tls.LoadX509KeyPair(*tlsCertFile, *tlsKeyFile)
-		if err != nil {
-			logger.Fatalf("cannot load TLS cert from tlsCertFile=%q, tlsKeyFile=%q: %s", *tlsCertFile, *tlsKeyFile, err)
-		}
-		cfg := &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		}
-		ln = tls.NewListener(ln, cfg)
-	}
+	ln := MustWrapTLSListener(lnTmp)
 	serveWithListener(addr, ln, rh)
 }
 
@@ -208,21 +197,12 @@ func handlerWrapper(s *server, w http.ResponseWriter, r *http.Request, rh Reques
 	r.URL.Path = path
 	switch r.URL.Path {
 	case "/health":
-		w.Header().Set("Content-Type", "text/plain")
-		deadline := atomic.LoadInt64(&s.shutdownDelayDeadline)
-		if deadline <= 0 {
-			w.Write([]byte("OK"))
-			return
-		}
-		// Return non-OK response during grace period before shutting down the server.
-		// Load balancers must notify these responses and re-route new requests to other servers.
-		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/463 .
-		d := time.Until(time.Unix(0, deadline))
-		if d < 0 {
-			d = 0
-		}
-		errMsg := fmt.Sprintf("The server is in delayed shutdown mode, which will end in %.3fs", d.Seconds())
-		http.Error(w, errMsg, http.StatusServiceUnavailable)
+		healthRequests.Inc()
+		handleHealth(w, s)
+		return
+	case "/ready":
+		readyRequests.Inc()
+		handleReady(w, s)
 		return
 	case "/ping":
 		// This is needed for compatibility with Influx agents.
@@ -243,6 +223,9 @@ func handlerWrapper(s *server, w http.ResponseWriter, r *http.Request, rh Reques
 			http.Error(w, "The provided authKey doesn't match -metricsAuthKey", http.StatusUnauthorized)
 			return
 		}
+		if !checkAuth(w, r) {
+			return
+		}
 		startTime := time.Now()
 		w.Header().Set("Content-Type", "text/plain")
 		WritePrometheusMetrics(w)
@@ -255,14 +238,24 @@ func handlerWrapper(s *server, w http.ResponseWriter, r *http.Request, rh Reques
 				http.Error(w, "The provided authKey doesn't match -pprofAuthKey", http.StatusUnauthorized)
 				return
 			}
+			if !checkAuth(w, r) {
+				return
+			}
 			DisableResponseCompression(w)
 			pprofHandler(r.URL.Path[len("/debug/pprof/"):], w, r)
 			return
 		}
 
-		if !checkBasicAuth(w, r) {
+		if !checkAuth(w, r) {
+			return
+		}
+		if !checkDestructiveAPI(w, r) {
 			return
 		}
+		if span := tracing.StartSpanFromRequest(r, r.Method+" "+r.URL.Path); span != nil {
+			r = r.WithContext(tracing.ContextWithSpan(r.Context(), span))
+			defer span.End()
+		}
 		if rh(w, r) {
 			return
 		}
@@ -288,20 +281,6 @@ func getCanonicalPath(path string) (string, error) {
 	return path, nil
 }
 
-func checkBasicAuth(w http.ResponseWriter, r *http.Request) bool {
-	if len(*httpAuthUsername) == 0 {
-		// HTTP Basic Auth is disabled.
-		return true
-	}
-	username, password, ok := r.BasicAuth()
-	if ok && username == *httpAuthUsername && password == *httpAuthPassword {
-		return true
-	}
-	w.Header().Set("WWW-Authenticate", `Basic realm="VictoriaMetrics"`)
-	http.Error(w, "", http.StatusUnauthorized)
-	return false
-}
-
 func maybeGzipResponseWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
 	if *disableResponseCompression {
 		return w
@@ -341,12 +320,6 @@ func DisableResponseCompression(w http.ResponseWriter) {
 	zrw.disableCompression = true
 }
 
-// EnableCORS enables https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS
-// on the response.
-func EnableCORS(w http.ResponseWriter, _ *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-}
-
 func getGzipWriter(w io.Writer) *gzip.Writer {
 	v := gzipWriterPool.Get()
 	if v == nil {
@@ -504,6 +477,8 @@ var (
 	pprofMutexRequests   = metrics.NewCounter(`vm_http_requests_total{path="/debug/pprof/mutex"}`)
 	pprofDefaultRequests = metrics.NewCounter(`vm_http_requests_total{path="/debug/pprof/default"}`)
 	faviconRequests      = metrics.NewCounter(`vm_http_requests_total{path="/favicon.ico"}`)
+	healthRequests       = metrics.NewCounter(`vm_http_requests_total{path="/health"}`)
+	readyRequests        = metrics.NewCounter(`vm_http_requests_total{path="/ready"}`)
 
 	unsupportedRequestErrors = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="unsupported"}`)
 
@@ -525,6 +500,7 @@ func Errorf(w http.ResponseWriter, r *http.Request, format string, args ...inter
 	remoteAddr := GetQuotedRemoteAddr(r)
 	errStr = fmt.Sprintf("remoteAddr: %s; %s", remoteAddr, errStr)
 	logger.WarnfSkipframes(1, "%s", errStr)
+	tracing.SpanFromContext(r.Context()).SetError(errors.New(errStr))
 
 	// Extract statusCode from args
 	statusCode := http.StatusBadRequest
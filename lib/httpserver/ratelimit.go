@@ -0,0 +1,104 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IPRateLimiter limits the rate of requests per client IP with token bucket algorithm.
+//
+// Each client IP may perform up to burst requests at once, while the bucket
+// is refilled at rps requests per second.
+type IPRateLimiter struct {
+	rps   float64
+	burst float64
+
+	mu              sync.Mutex
+	buckets         map[string]*tokenBucket
+	lastCleanupTime time.Time
+}
+
+type tokenBucket struct {
+	tokens     float64
+	updateTime time.Time
+}
+
+// NewIPRateLimiter returns new IPRateLimiter for the given rps and burst.
+//
+// If burst is smaller than 1, then it is set to 1.
+func NewIPRateLimiter(rps float64, burst int) *IPRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &IPRateLimiter{
+		rps:     rps,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow returns true if r may be served according to the limit for the client IP of r.
+func (rl *IPRateLimiter) Allow(r *http.Request) bool {
+	return rl.allow(GetClientIP(r), time.Now())
+}
+
+func (rl *IPRateLimiter) allow(key string, currentTime time.Time) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if currentTime.Sub(rl.lastCleanupTime) > time.Minute {
+		rl.cleanupLocked(currentTime)
+		rl.lastCleanupTime = currentTime
+	}
+	tb := rl.buckets[key]
+	if tb == nil {
+		tb = &tokenBucket{
+			tokens:     rl.burst,
+			updateTime: currentTime,
+		}
+		rl.buckets[key] = tb
+	}
+	tb.refill(currentTime, rl.rps, rl.burst)
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+func (tb *tokenBucket) refill(currentTime time.Time, rps, burst float64) {
+	d := currentTime.Sub(tb.updateTime).Seconds()
+	if d <= 0 {
+		return
+	}
+	tb.tokens += d * rps
+	if tb.tokens > burst {
+		tb.tokens = burst
+	}
+	tb.updateTime = currentTime
+}
+
+// cleanupLocked removes full buckets, since they are equivalent to missing buckets.
+//
+// This prevents from unbounded memory growth when requests are sent from big number of distinct IPs.
+func (rl *IPRateLimiter) cleanupLocked(currentTime time.Time) {
+	for key, tb := range rl.buckets {
+		tb.refill(currentTime, rl.rps, rl.burst)
+		if tb.tokens >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// GetClientIP returns client IP for r.
+//
+// X-Forwarded-For header isn't taken into account, since it may be forged by the client.
+func GetClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
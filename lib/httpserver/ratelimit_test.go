@@ -0,0 +1,60 @@
+package httpserver
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIPRateLimiter(t *testing.T) {
+	rl := NewIPRateLimiter(2, 3)
+	startTime := time.Unix(1600000000, 0)
+	f := func(key string, offset time.Duration, resultExpected bool) {
+		t.Helper()
+		if result := rl.allow(key, startTime.Add(offset)); result != resultExpected {
+			t.Fatalf("unexpected result for key=%q at offset=%s; got %v; want %v", key, offset, result, resultExpected)
+		}
+	}
+
+	// Burst requests
+	f("1.2.3.4", 0, true)
+	f("1.2.3.4", 0, true)
+	f("1.2.3.4", 0, true)
+	f("1.2.3.4", 0, false)
+
+	// Other IPs aren't affected
+	f("5.6.7.8", 0, true)
+
+	// The bucket is refilled at 2 requests per second
+	f("1.2.3.4", 100*time.Millisecond, false)
+	f("1.2.3.4", 500*time.Millisecond, true)
+	f("1.2.3.4", 500*time.Millisecond, false)
+	f("1.2.3.4", time.Second, true)
+
+	// The bucket cannot contain more than burst tokens
+	f("1.2.3.4", time.Hour, true)
+	f("1.2.3.4", time.Hour, true)
+	f("1.2.3.4", time.Hour, true)
+	f("1.2.3.4", time.Hour, false)
+
+	// Full buckets are removed during cleanup
+	rl.allow("9.9.9.9", startTime.Add(3*time.Hour))
+	if n := len(rl.buckets); n != 1 {
+		t.Fatalf("unexpected number of buckets after cleanup; got %d; want 1", n)
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	f := func(remoteAddr, ipExpected string) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/api/v1/query", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", "10.0.0.1")
+		if ip := GetClientIP(r); ip != ipExpected {
+			t.Fatalf("unexpected client ip; got %q; want %q", ip, ipExpected)
+		}
+	}
+	f("1.2.3.4:5678", "1.2.3.4")
+	f("[::1]:5678", "::1")
+	f("foobar", "foobar")
+}
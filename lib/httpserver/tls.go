@@ -0,0 +1,147 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// MustWrapTLSListener returns ln wrapped into TLS listener if -tls command-line flag is set.
+//
+// Otherwise ln is returned as is.
+func MustWrapTLSListener(ln net.Listener) net.Listener {
+	if !*tlsEnable {
+		return ln
+	}
+	cl, err := newCertLoader(*tlsCertFile, *tlsKeyFile)
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	cfg := &tls.Config{
+		GetCertificate: cl.GetCertificate,
+	}
+	return tls.NewListener(ln, cfg)
+}
+
+// certLoader holds TLS certificate loaded from certFile and keyFile.
+//
+// The certificate is automatically reloaded when certFile or keyFile changes,
+// so certificates may be rotated without restarting the server.
+type certLoader struct {
+	certFile string
+	keyFile  string
+
+	mu              sync.Mutex
+	cert            *tls.Certificate
+	certFileState   fileState
+	keyFileState    fileState
+	lastCheckTime   uint64
+	reloadErrLogged bool
+}
+
+// fileState is used for detecting file changes.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func newCertLoader(certFile, keyFile string) (*certLoader, error) {
+	cl := &certLoader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := cl.load(); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// GetCertificate returns the loaded certificate. It is intended for use in tls.Config.GetCertificate.
+//
+// Cert files are checked for changes at most once per second. The previously loaded certificate
+// is returned if the changed files cannot be loaded, e.g. when only one of the files has been updated yet.
+func (cl *certLoader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	ct := fasttime.UnixTimestamp()
+	if ct == cl.lastCheckTime {
+		return cl.cert, nil
+	}
+	cl.lastCheckTime = ct
+	certFileState, err := getFileState(cl.certFile)
+	if err != nil {
+		cl.logReloadError(err)
+		return cl.cert, nil
+	}
+	keyFileState, err := getFileState(cl.keyFile)
+	if err != nil {
+		cl.logReloadError(err)
+		return cl.cert, nil
+	}
+	if certFileState == cl.certFileState && keyFileState == cl.keyFileState {
+		return cl.cert, nil
+	}
+	if err := cl.load(); err != nil {
+		cl.logReloadError(err)
+		return cl.cert, nil
+	}
+	tlsCertReloads.Inc()
+	cl.reloadErrLogged = false
+	logger.Infof("reloaded TLS cert from tlsCertFile=%q, tlsKeyFile=%q", cl.certFile, cl.keyFile)
+	return cl.cert, nil
+}
+
+func (cl *certLoader) logReloadError(err error) {
+	tlsCertReloadErrors.Inc()
+	if cl.reloadErrLogged {
+		// Do not flood logs with the same error every second.
+		return
+	}
+	cl.reloadErrLogged = true
+	logger.Errorf("cannot reload TLS cert; continuing using the previously loaded cert: %s", err)
+}
+
+func (cl *certLoader) load() error {
+	// Obtain file states before loading the cert, so the next change is detected
+	// even if the files are modified during the load.
+	certFileState, err := getFileState(cl.certFile)
+	if err != nil {
+		return err
+	}
+	keyFileState, err := getFileState(cl.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cl.certFile, cl.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS cert from tlsCertFile=%q, tlsKeyFile=%q: %w", cl.certFile, cl.keyFile, err)
+	}
+	cl.cert = &cert
+	cl.certFileState = certFileState
+	cl.keyFileState = keyFileState
+	return nil
+}
+
+func getFileState(path string) (fileState, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileState{}, fmt.Errorf("cannot stat %q: %w", path, err)
+	}
+	return fileState{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+	}, nil
+}
+
+var (
+	tlsCertReloads      = metrics.NewCounter(`vm_tls_cert_reloads_total`)
+	tlsCertReloadErrors = metrics.NewCounter(`vm_tls_cert_reload_errors_total`)
+)
@@ -0,0 +1,113 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert_loader_test")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	mustWriteCert(t, certFile, keyFile, "foo", time.Now().Add(-time.Minute))
+	cl, err := newCertLoader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("cannot create cert loader: %s", err)
+	}
+	mustCheckCertCommonName(t, cl, "foo")
+
+	// The cert must be reloaded after the cert files change.
+	mustWriteCert(t, certFile, keyFile, "bar", time.Now())
+	cl.lastCheckTime = 0
+	mustCheckCertCommonName(t, cl, "bar")
+
+	// The previous cert must be used if the cert files cannot be loaded.
+	if err := ioutil.WriteFile(keyFile, []byte("invalid key"), 0600); err != nil {
+		t.Fatalf("cannot write key file: %s", err)
+	}
+	cl.lastCheckTime = 0
+	mustCheckCertCommonName(t, cl, "bar")
+	if err := os.Remove(certFile); err != nil {
+		t.Fatalf("cannot remove cert file: %s", err)
+	}
+	cl.lastCheckTime = 0
+	mustCheckCertCommonName(t, cl, "bar")
+
+	// The cert must be reloaded after the cert files are fixed.
+	mustWriteCert(t, certFile, keyFile, "baz", time.Now().Add(time.Minute))
+	cl.lastCheckTime = 0
+	mustCheckCertCommonName(t, cl, "baz")
+}
+
+func mustCheckCertCommonName(t *testing.T, cl *certLoader, commonNameExpected string) {
+	t.Helper()
+	cert, err := cl.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("cannot parse cert: %s", err)
+	}
+	if c.Subject.CommonName != commonNameExpected {
+		t.Fatalf("unexpected cert common name; got %q; want %q", c.Subject.CommonName, commonNameExpected)
+	}
+}
+
+func mustWriteCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create cert: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %s", err)
+	}
+	var certBuf, keyBuf bytes.Buffer
+	if err := pem.Encode(&certBuf, &pem.Block{Type: "CERTIFICATE", Bytes: certDER}); err != nil {
+		t.Fatalf("cannot encode cert: %s", err)
+	}
+	if err := pem.Encode(&keyBuf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}); err != nil {
+		t.Fatalf("cannot encode key: %s", err)
+	}
+	for path, data := range map[string][]byte{certFile: certBuf.Bytes(), keyFile: keyBuf.Bytes()} {
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("cannot write %q: %s", path, err)
+		}
+		// Set distinct modification time, since the file size may remain unchanged.
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("cannot set modification time for %q: %s", path, err)
+		}
+	}
+}
@@ -34,7 +34,8 @@ func MustStart(addr string, insertHandler func(r *http.Request) error) *Server {
 	if err != nil {
 		logger.Fatalf("cannot start HTTP OpenTSDB collector at %q: %s", addr, err)
 	}
-	return MustServe(lnTCP, insertHandler)
+	ln := httpserver.MustWrapTLSListener(lnTCP)
+	return MustServe(ln, insertHandler)
 }
 
 // MustServe serves OpenTSDB HTTP put requests from ln.
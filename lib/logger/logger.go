@@ -24,6 +24,9 @@ var (
 
 	errorsPerSecondLimit = flag.Int("loggerErrorsPerSecondLimit", 10, "Per-second limit on the number of ERROR messages. If more than the given number of errors "+
 		"are emitted per second, then the remaining errors are suppressed. Zero value disables the rate limit")
+	dedupInterval = flag.Duration("loggerDedupInterval", 0, "Interval for collapsing repeated identical WARN and ERROR messages. "+
+		"Only the first message is logged during the interval, while the remaining identical messages are summarized "+
+		"in a single 'message repeated N times' line at the end of the interval. The deduplication is disabled by default")
 )
 
 // Init initializes the logger.
@@ -36,6 +39,10 @@ func Init() {
 	validateLoggerLevel()
 	validateLoggerFormat()
 	go errorsLoggedCleaner()
+	if *dedupInterval > 0 {
+		dedupEnabled = true
+		go dedupFlusher()
+	}
 	logAllFlags()
 }
 
@@ -142,15 +149,6 @@ func (lw *logWriter) Write(p []byte) (int, error) {
 }
 
 func logMessage(level, msg string, skipframes int) {
-	// rate limit ERROR log messages
-	if level == "ERROR" {
-		if n := atomic.AddUint64(&errorsLogged, 1); *errorsPerSecondLimit > 0 && n > uint64(*errorsPerSecondLimit) {
-			return
-		}
-	}
-
-	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
-	levelLowercase := strings.ToLower(level)
 	_, file, line, ok := runtime.Caller(skipframes)
 	if !ok {
 		file = "???"
@@ -163,6 +161,39 @@ func logMessage(level, msg string, skipframes int) {
 	for len(msg) > 0 && msg[len(msg)-1] == '\n' {
 		msg = msg[:len(msg)-1]
 	}
+
+	// rate limit ERROR log messages
+	if level == "ERROR" {
+		if n := atomic.AddUint64(&errorsLogged, 1); *errorsPerSecondLimit > 0 && n > uint64(*errorsPerSecondLimit) {
+			return
+		}
+	}
+
+	// Collapse repeated WARN and ERROR messages.
+	// This is performed after the rate limiting, so rate-limited messages aren't registered in dedupMessages.
+	if level == "WARN" || level == "ERROR" {
+		if isDuplicateMessage(level, file, line, msg) {
+			return
+		}
+	}
+
+	writeMessage(level, file, line, msg)
+
+	switch level {
+	case "PANIC":
+		if *loggerFormat == "json" {
+			// Do not clutter `json` output with panic stack trace
+			os.Exit(-1)
+		}
+		panic(errors.New(msg))
+	case "FATAL":
+		os.Exit(-1)
+	}
+}
+
+func writeMessage(level, file string, line int, msg string) {
+	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	levelLowercase := strings.ToLower(level)
 	var logMsg string
 	switch *loggerFormat {
 	case "json":
@@ -181,16 +212,78 @@ func logMessage(level, msg string, skipframes int) {
 	location := fmt.Sprintf("%s:%d", file, line)
 	counterName := fmt.Sprintf(`vm_log_messages_total{app_version=%q, level=%q, location=%q}`, buildinfo.Version, levelLowercase, location)
 	metrics.GetOrCreateCounter(counterName).Inc()
+}
 
-	switch level {
-	case "PANIC":
-		if *loggerFormat == "json" {
-			// Do not clutter `json` output with panic stack trace
-			os.Exit(-1)
+// dedupKey identifies identical log messages.
+type dedupKey struct {
+	level string
+	file  string
+	line  int
+	msg   string
+}
+
+var (
+	dedupEnabled bool
+
+	dedupLock sync.Mutex
+
+	// dedupMessages contains the number of suppressed duplicates per each message logged during the current -loggerDedupInterval.
+	dedupMessages = make(map[dedupKey]uint64)
+
+	// maxDedupMessages limits the number of distinct messages tracked during the current -loggerDedupInterval,
+	// so messages with unique contents cannot exhaust memory. The remaining messages are logged without deduplication.
+	maxDedupMessages = 10000
+)
+
+// isDuplicateMessage returns true if the given message has been already logged during the current -loggerDedupInterval.
+func isDuplicateMessage(level, file string, line int, msg string) bool {
+	if !dedupEnabled {
+		return false
+	}
+	k := dedupKey{
+		level: level,
+		file:  file,
+		line:  line,
+		msg:   msg,
+	}
+	dedupLock.Lock()
+	n, ok := dedupMessages[k]
+	if ok {
+		n++
+		dedupMessages[k] = n
+	} else if len(dedupMessages) < maxDedupMessages {
+		dedupMessages[k] = 0
+	}
+	dedupLock.Unlock()
+	if ok {
+		suppressedMessages.Inc()
+	}
+	return ok
+}
+
+var suppressedMessages = metrics.NewCounter(`vm_log_messages_suppressed_total`)
+
+func dedupFlusher() {
+	for {
+		time.Sleep(*dedupInterval)
+		flushDedupMessages()
+	}
+}
+
+// flushDedupMessages logs summaries for messages with suppressed duplicates and starts new deduplication interval.
+func flushDedupMessages() {
+	dedupLock.Lock()
+	m := dedupMessages
+	dedupMessages = make(map[dedupKey]uint64, len(m))
+	dedupLock.Unlock()
+
+	for k, n := range m {
+		if n == 0 {
+			// The message had no duplicates.
+			continue
 		}
-		panic(errors.New(msg))
-	case "FATAL":
-		os.Exit(-1)
+		msg := fmt.Sprintf("message repeated %d times during the last %s: %s", n, *dedupInterval, k.msg)
+		writeMessage(k.level, k.file, k.line, msg)
 	}
 }
 
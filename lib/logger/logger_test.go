@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDedupMessages(t *testing.T) {
+	var bb bytes.Buffer
+	outputOrig := output
+	output = &bb
+	dedupEnabled = true
+	defer func() {
+		output = outputOrig
+		dedupEnabled = false
+	}()
+
+	for i := 0; i < 5; i++ {
+		Warnf("cannot parse line %q", "foo")
+	}
+	Warnf("cannot parse line %q", "bar")
+	Infof("info message")
+	Infof("info message")
+
+	lines := strings.Split(strings.TrimSpace(bb.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected number of lines before flush; got %d; want 4\n%s", len(lines), bb.String())
+	}
+	bb.Reset()
+	flushDedupMessages()
+	s := bb.String()
+	if strings.Count(s, "\n") != 1 || !strings.Contains(s, `message repeated 4 times during the last`) || !strings.Contains(s, `cannot parse line "foo"`) {
+		t.Fatalf("unexpected output after flush:\n%s", s)
+	}
+
+	// The message must be logged again after the flush.
+	bb.Reset()
+	Warnf("cannot parse line %q", "foo")
+	flushDedupMessages()
+	if n := strings.Count(bb.String(), "\n"); n != 1 {
+		t.Fatalf("unexpected number of lines after the second flush; got %d; want 1\n%s", n, bb.String())
+	}
+}
+
+func TestDedupMessagesRateLimited(t *testing.T) {
+	var bb bytes.Buffer
+	outputOrig := output
+	output = &bb
+	dedupEnabled = true
+	errorsLoggedOrig := atomic.LoadUint64(&errorsLogged)
+	atomic.StoreUint64(&errorsLogged, uint64(*errorsPerSecondLimit))
+	defer func() {
+		output = outputOrig
+		dedupEnabled = false
+		atomic.StoreUint64(&errorsLogged, errorsLoggedOrig)
+	}()
+
+	Errorf("cannot process request")
+	if bb.Len() > 0 {
+		t.Fatalf("unexpected output for rate-limited message:\n%s", bb.String())
+	}
+	dedupLock.Lock()
+	n := len(dedupMessages)
+	dedupLock.Unlock()
+	if n != 0 {
+		t.Fatalf("rate-limited messages mustn't be registered for deduplication; got %d messages", n)
+	}
+}
+
+func TestDedupMessagesLimit(t *testing.T) {
+	var bb bytes.Buffer
+	outputOrig := output
+	output = &bb
+	dedupEnabled = true
+	maxDedupMessagesOrig := maxDedupMessages
+	maxDedupMessages = 2
+	defer func() {
+		flushDedupMessages()
+		output = outputOrig
+		dedupEnabled = false
+		maxDedupMessages = maxDedupMessagesOrig
+	}()
+
+	for i := 0; i < 3; i++ {
+		Warnf("message foo")
+		Warnf("message bar")
+		Warnf("message baz")
+	}
+	dedupLock.Lock()
+	n := len(dedupMessages)
+	dedupLock.Unlock()
+	if n != maxDedupMessages {
+		t.Fatalf("unexpected number of tracked messages; got %d; want %d", n, maxDedupMessages)
+	}
+
+	// Messages exceeding the limit are logged directly.
+	s := bb.String()
+	if k := strings.Count(s, "message foo"); k != 1 {
+		t.Fatalf("unexpected number of deduplicated messages; got %d; want 1\n%s", k, s)
+	}
+	if k := strings.Count(s, "message baz"); k != 3 {
+		t.Fatalf("unexpected number of messages exceeding the limit; got %d; want 3\n%s", k, s)
+	}
+}
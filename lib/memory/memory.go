@@ -7,6 +7,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 var (
@@ -48,6 +49,10 @@ func initOnce() {
 	}
 }
 
+var _ = metrics.NewGauge(`vm_available_memory_bytes`, func() float64 {
+	return float64(Allowed() + Remaining())
+})
+
 // Allowed returns the amount of system memory allowed to use by the app.
 //
 // The function must be called only after flag.Parse is called.
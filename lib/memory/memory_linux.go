@@ -27,5 +27,6 @@ func sysTotalMemory() int {
 			return totalMem
 		}
 	}
+	logger.Infof("using cgroup memory limit=%d bytes instead of system memory=%d bytes", mem, totalMem)
 	return int(mem)
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/filestream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
 )
 
 type blockStreamReader struct {
@@ -174,6 +175,13 @@ func (bsr *blockStreamReader) InitFromFilePart(path string) error {
 	return nil
 }
 
+// throttle limits the read bandwidth for bsr initialized via InitFromFilePart with l.
+func (bsr *blockStreamReader) throttle(l *mergethrottle.Limiter) {
+	bsr.indexReader = l.NewReader(bsr.indexReader)
+	bsr.itemsReader = l.NewReader(bsr.itemsReader)
+	bsr.lensReader = l.NewReader(bsr.lensReader)
+}
+
 // MustClose closes the bsr.
 //
 // It closes *Reader files passed to Init.
@@ -8,6 +8,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/filestream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
 )
 
 type blockStreamWriter struct {
@@ -137,6 +138,13 @@ func (bsw *blockStreamWriter) InitFromFilePart(path string, nocache bool, compre
 	return nil
 }
 
+// throttle limits the write bandwidth for bsw initialized via InitFromFilePart with l.
+func (bsw *blockStreamWriter) throttle(l *mergethrottle.Limiter) {
+	bsw.indexWriter = l.NewWriter(bsw.indexWriter)
+	bsw.itemsWriter = l.NewWriter(bsw.itemsWriter)
+	bsw.lensWriter = l.NewWriter(bsw.lensWriter)
+}
+
 // MustClose closes the bsw.
 //
 // It closes *Writer files passed to Init*.
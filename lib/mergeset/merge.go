@@ -18,22 +18,35 @@ import (
 // The callback can re-use data and items for storing the result.
 type PrepareBlockCallback func(data []byte, items [][]byte) ([]byte, [][]byte)
 
+// TransformItemCallback can filter or transform the given item during merge.
+//
+// The callback must append the transformed item to dst and return the result with true.
+// The callback must return false if the item must be dropped from the merged part.
+// prevItem contains the previous item returned by the callback during the current merge.
+// It is empty for the first item.
+//
+// The callback is called for items in sorted order. It must return items in sorted order too,
+// i.e. the returned item mustn't be smaller than prevItem. The returned item mustn't exceed
+// the maximum item size.
+type TransformItemCallback func(dst, prevItem, item []byte) ([]byte, bool)
+
 // mergeBlockStreams merges bsrs and writes result to bsw.
 //
 // It also fills ph.
 //
-// prepareBlock is optional.
+// prepareBlock and transformItem are optional.
 //
 // The function immediately returns when stopCh is closed.
 //
-// It also atomically adds the number of items merged to itemsMerged.
-func mergeBlockStreams(ph *partHeader, bsw *blockStreamWriter, bsrs []*blockStreamReader, prepareBlock PrepareBlockCallback, stopCh <-chan struct{},
-	itemsMerged *uint64) error {
+// It also atomically adds the number of items merged to itemsMerged
+// and the number of items dropped by transformItem to itemsDropped.
+func mergeBlockStreams(ph *partHeader, bsw *blockStreamWriter, bsrs []*blockStreamReader, prepareBlock PrepareBlockCallback, transformItem TransformItemCallback,
+	stopCh <-chan struct{}, itemsMerged, itemsDropped *uint64) error {
 	bsm := bsmPool.Get().(*blockStreamMerger)
-	if err := bsm.Init(bsrs, prepareBlock); err != nil {
+	if err := bsm.Init(bsrs, prepareBlock, transformItem); err != nil {
 		return fmt.Errorf("cannot initialize blockStreamMerger: %w", err)
 	}
-	err := bsm.Merge(bsw, ph, stopCh, itemsMerged)
+	err := bsm.Merge(bsw, ph, stopCh, itemsMerged, itemsDropped)
 	bsm.reset()
 	bsmPool.Put(bsm)
 	bsw.MustClose()
@@ -55,6 +68,8 @@ var bsmPool = &sync.Pool{
 type blockStreamMerger struct {
 	prepareBlock PrepareBlockCallback
 
+	transformItem TransformItemCallback
+
 	bsrHeap bsrHeap
 
 	// ib is a scratch block with pending items.
@@ -66,10 +81,16 @@ type blockStreamMerger struct {
 	// for consistency checks after prepareBlock call.
 	firstItem []byte
 	lastItem  []byte
+
+	// These are auxiliary buffers used in Merge for transformItem call.
+	itemBuf  []byte
+	prevItem []byte
 }
 
 func (bsm *blockStreamMerger) reset() {
 	bsm.prepareBlock = nil
+	bsm.transformItem = nil
+	bsm.prevItem = bsm.prevItem[:0]
 
 	for i := range bsm.bsrHeap {
 		bsm.bsrHeap[i] = nil
@@ -80,9 +101,10 @@ func (bsm *blockStreamMerger) reset() {
 	bsm.phFirstItemCaught = false
 }
 
-func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, prepareBlock PrepareBlockCallback) error {
+func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, prepareBlock PrepareBlockCallback, transformItem TransformItemCallback) error {
 	bsm.reset()
 	bsm.prepareBlock = prepareBlock
+	bsm.transformItem = transformItem
 	for _, bsr := range bsrs {
 		if bsr.Next() {
 			bsm.bsrHeap = append(bsm.bsrHeap, bsr)
@@ -103,7 +125,7 @@ func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, prepareBlock Prepa
 
 var errForciblyStopped = fmt.Errorf("forcibly stopped")
 
-func (bsm *blockStreamMerger) Merge(bsw *blockStreamWriter, ph *partHeader, stopCh <-chan struct{}, itemsMerged *uint64) error {
+func (bsm *blockStreamMerger) Merge(bsw *blockStreamWriter, ph *partHeader, stopCh <-chan struct{}, itemsMerged, itemsDropped *uint64) error {
 again:
 	if len(bsm.bsrHeap) == 0 {
 		// Write the last (maybe incomplete) inmemoryBlock to bsw.
@@ -130,6 +152,13 @@ again:
 		if hasNextItem && string(item) > string(nextItem) {
 			break
 		}
+		if bsm.transformItem != nil {
+			if !bsm.addTransformedItem(bsw, ph, item, itemsMerged, itemsDropped) {
+				return fmt.Errorf("cannot add too long transformed item with length %d", len(bsm.itemBuf))
+			}
+			bsr.blockItemIdx++
+			continue
+		}
 		if !bsm.ib.Add(item) {
 			// The bsm.ib is full. Flush it to bsw and continue.
 			bsm.flushIB(bsw, ph, itemsMerged)
@@ -156,6 +185,31 @@ again:
 	goto again
 }
 
+// addTransformedItem adds item transformed with bsm.transformItem to bsm.ib.
+//
+// The item is transformed only once, since transformItem may be stateful.
+// false is returned if the transformed item cannot be added to an empty bsm.ib.
+func (bsm *blockStreamMerger) addTransformedItem(bsw *blockStreamWriter, ph *partHeader, item []byte, itemsMerged, itemsDropped *uint64) bool {
+	var ok bool
+	bsm.itemBuf, ok = bsm.transformItem(bsm.itemBuf[:0], bsm.prevItem, item)
+	if !ok {
+		atomic.AddUint64(itemsDropped, 1)
+		return true
+	}
+	item = bsm.itemBuf
+	// Verify whether the items are sorted only in tests, since this can be expensive check in prod.
+	if isInTest && string(item) < string(bsm.prevItem) {
+		logger.Panicf("BUG: transformItem must return sorted items; got\n%X\nafter\n%X", item, bsm.prevItem)
+	}
+	bsm.prevItem = append(bsm.prevItem[:0], item...)
+	if bsm.ib.Add(item) {
+		return true
+	}
+	// The bsm.ib is full. Flush it to bsw and add the item to the empty bsm.ib.
+	bsm.flushIB(bsw, ph, itemsMerged)
+	return bsm.ib.Add(item)
+}
+
 func (bsm *blockStreamMerger) flushIB(bsw *blockStreamWriter, ph *partHeader, itemsMerged *uint64) {
 	if len(bsm.ib.items) == 0 {
 		// Nothing to flush.
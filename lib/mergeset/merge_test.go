@@ -24,20 +24,20 @@ func TestMergeBlockStreams(t *testing.T) {
 func TestMultilevelMerge(t *testing.T) {
 	// Prepare blocks to merge.
 	bsrs, items := newTestInmemoryBlockStreamReaders(10, 4000)
-	var itemsMerged uint64
+	var itemsMerged, itemsDropped uint64
 
 	// First level merge
 	var dstIP1 inmemoryPart
 	var bsw1 blockStreamWriter
 	bsw1.InitFromInmemoryPart(&dstIP1)
-	if err := mergeBlockStreams(&dstIP1.ph, &bsw1, bsrs[:5], nil, nil, &itemsMerged); err != nil {
+	if err := mergeBlockStreams(&dstIP1.ph, &bsw1, bsrs[:5], nil, nil, nil, &itemsMerged, &itemsDropped); err != nil {
 		t.Fatalf("cannot merge first level part 1: %s", err)
 	}
 
 	var dstIP2 inmemoryPart
 	var bsw2 blockStreamWriter
 	bsw2.InitFromInmemoryPart(&dstIP2)
-	if err := mergeBlockStreams(&dstIP2.ph, &bsw2, bsrs[5:], nil, nil, &itemsMerged); err != nil {
+	if err := mergeBlockStreams(&dstIP2.ph, &bsw2, bsrs[5:], nil, nil, nil, &itemsMerged, &itemsDropped); err != nil {
 		t.Fatalf("cannot merge first level part 2: %s", err)
 	}
 
@@ -54,7 +54,7 @@ func TestMultilevelMerge(t *testing.T) {
 		newTestBlockStreamReader(&dstIP2),
 	}
 	bsw.InitFromInmemoryPart(&dstIP)
-	if err := mergeBlockStreams(&dstIP.ph, &bsw, bsrsTop, nil, nil, &itemsMerged); err != nil {
+	if err := mergeBlockStreams(&dstIP.ph, &bsw, bsrsTop, nil, nil, nil, &itemsMerged, &itemsDropped); err != nil {
 		t.Fatalf("cannot merge second level: %s", err)
 	}
 	if itemsMerged != uint64(len(items)) {
@@ -68,15 +68,74 @@ func TestMultilevelMerge(t *testing.T) {
 	}
 }
 
+func TestMergeBlockStreamsTransformItem(t *testing.T) {
+	f := func(transformItem TransformItemCallback, itemsExpected []string) {
+		t.Helper()
+		bsrs, _ := newTestInmemoryBlockStreamReadersFromItems([][]string{
+			{"a1", "a2", "b1", "c1"},
+			{"a3", "b2", "d1"},
+			{"b3", "c2"},
+		})
+		var itemsMerged, itemsDropped uint64
+		var dstIP inmemoryPart
+		var bsw blockStreamWriter
+		bsw.InitFromInmemoryPart(&dstIP)
+		if err := mergeBlockStreams(&dstIP.ph, &bsw, bsrs, nil, transformItem, nil, &itemsMerged, &itemsDropped); err != nil {
+			t.Fatalf("cannot merge block streams: %s", err)
+		}
+		if itemsMerged != uint64(len(itemsExpected)) {
+			t.Fatalf("unexpected itemsMerged; got %d; want %d", itemsMerged, len(itemsExpected))
+		}
+		if itemsDropped != uint64(9-len(itemsExpected)) {
+			t.Fatalf("unexpected itemsDropped; got %d; want %d", itemsDropped, 9-len(itemsExpected))
+		}
+		if len(itemsExpected) == 0 {
+			if dstIP.ph.itemsCount != 0 {
+				t.Fatalf("unexpected number of items in the part; got %d; want 0", dstIP.ph.itemsCount)
+			}
+			return
+		}
+		if err := testCheckItems(&dstIP, itemsExpected); err != nil {
+			t.Fatalf("error checking items: %s", err)
+		}
+	}
+
+	// Keep all the items
+	f(func(dst, prevItem, item []byte) ([]byte, bool) {
+		return append(dst, item...), true
+	}, []string{"a1", "a2", "a3", "b1", "b2", "b3", "c1", "c2", "d1"})
+
+	// Drop items with the given prefix
+	f(func(dst, prevItem, item []byte) ([]byte, bool) {
+		if item[0] == 'b' {
+			return dst, false
+		}
+		return append(dst, item...), true
+	}, []string{"a1", "a2", "a3", "c1", "c2", "d1"})
+
+	// Deduplicate items by the first byte
+	f(func(dst, prevItem, item []byte) ([]byte, bool) {
+		if len(prevItem) > 0 && prevItem[0] == item[0] {
+			return dst, false
+		}
+		return append(dst, item[0]), true
+	}, []string{"a", "b", "c", "d"})
+
+	// Drop all the items
+	f(func(dst, prevItem, item []byte) ([]byte, bool) {
+		return dst, false
+	}, nil)
+}
+
 func TestMergeForciblyStop(t *testing.T) {
 	bsrs, _ := newTestInmemoryBlockStreamReaders(20, 4000)
 	var dstIP inmemoryPart
 	var bsw blockStreamWriter
 	bsw.InitFromInmemoryPart(&dstIP)
 	ch := make(chan struct{})
-	var itemsMerged uint64
+	var itemsMerged, itemsDropped uint64
 	close(ch)
-	if err := mergeBlockStreams(&dstIP.ph, &bsw, bsrs, nil, ch, &itemsMerged); err != errForciblyStopped {
+	if err := mergeBlockStreams(&dstIP.ph, &bsw, bsrs, nil, nil, ch, &itemsMerged, &itemsDropped); err != errForciblyStopped {
 		t.Fatalf("unexpected error during merge: got %v; want %v", err, errForciblyStopped)
 	}
 	if itemsMerged != 0 {
@@ -116,11 +175,11 @@ func testMergeBlockStreamsSerial(blocksToMerge, maxItemsPerBlock int) error {
 	bsrs, items := newTestInmemoryBlockStreamReaders(blocksToMerge, maxItemsPerBlock)
 
 	// Merge blocks.
-	var itemsMerged uint64
+	var itemsMerged, itemsDropped uint64
 	var dstIP inmemoryPart
 	var bsw blockStreamWriter
 	bsw.InitFromInmemoryPart(&dstIP)
-	if err := mergeBlockStreams(&dstIP.ph, &bsw, bsrs, nil, nil, &itemsMerged); err != nil {
+	if err := mergeBlockStreams(&dstIP.ph, &bsw, bsrs, nil, nil, nil, &itemsMerged, &itemsDropped); err != nil {
 		return fmt.Errorf("cannot merge block streams: %w", err)
 	}
 	if itemsMerged != uint64(len(items)) {
@@ -194,6 +253,25 @@ func newTestInmemoryBlockStreamReaders(blocksCount, maxItemsPerBlock int) ([]*bl
 	return bsrs, items
 }
 
+func newTestInmemoryBlockStreamReadersFromItems(blocks [][]string) ([]*blockStreamReader, []string) {
+	var items []string
+	var bsrs []*blockStreamReader
+	for _, blockItems := range blocks {
+		var ib inmemoryBlock
+		for _, item := range blockItems {
+			if !ib.Add([]byte(item)) {
+				panic(fmt.Errorf("BUG: cannot add item %q to inmemoryBlock", item))
+			}
+			items = append(items, item)
+		}
+		var ip inmemoryPart
+		ip.Init(&ib)
+		bsrs = append(bsrs, newTestBlockStreamReader(&ip))
+	}
+	sort.Strings(items)
+	return bsrs, items
+}
+
 func newTestBlockStreamReader(ip *inmemoryPart) *blockStreamReader {
 	var bsr blockStreamReader
 	bsr.InitFromInmemoryPart(ip)
@@ -83,6 +83,7 @@ func openFilePart(path string) (*part, error) {
 		metaindexFile.MustClose()
 		return nil, fmt.Errorf("cannot open %q: %w", indexPath, err)
 	}
+	indexFile.MustAdviseRandomRead()
 	indexSize := fs.MustFileSize(indexPath)
 
 	itemsPath := path + "/items.bin"
@@ -92,6 +93,8 @@ func openFilePart(path string) (*part, error) {
 		indexFile.MustClose()
 		return nil, fmt.Errorf("cannot open %q: %w", itemsPath, err)
 	}
+	// Items are read at random offsets during searches in indexdb.
+	itemsFile.MustAdviseRandomRead()
 	itemsSize := fs.MustFileSize(itemsPath)
 
 	lensPath := path + "/lens.bin"
@@ -102,6 +105,7 @@ func openFilePart(path string) (*part, error) {
 		itemsFile.MustClose()
 		return nil, fmt.Errorf("cannot open %q: %w", lensPath, err)
 	}
+	lensFile.MustAdviseRandomRead()
 	lensSize := fs.MustFileSize(lensPath)
 
 	size := metaindexSize + indexSize + itemsSize + lensSize
@@ -146,11 +146,11 @@ func testPartSearchSerial(p *part, items []string) error {
 func newTestPart(blocksCount, maxItemsPerBlock int) (*part, []string, error) {
 	bsrs, items := newTestInmemoryBlockStreamReaders(blocksCount, maxItemsPerBlock)
 
-	var itemsMerged uint64
+	var itemsMerged, itemsDropped uint64
 	var ip inmemoryPart
 	var bsw blockStreamWriter
 	bsw.InitFromInmemoryPart(&ip)
-	if err := mergeBlockStreams(&ip.ph, &bsw, bsrs, nil, nil, &itemsMerged); err != nil {
+	if err := mergeBlockStreams(&ip.ph, &bsw, bsrs, nil, nil, nil, &itemsMerged, &itemsDropped); err != nil {
 		return nil, nil, fmt.Errorf("cannot merge blocks: %w", err)
 	}
 	if itemsMerged != uint64(len(items)) {
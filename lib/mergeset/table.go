@@ -17,6 +17,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storagepacelimiter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/syncwg"
 )
@@ -80,6 +81,16 @@ func maxItemsPerCachedPart() uint64 {
 // so they become visible to search.
 const rawItemsFlushInterval = time.Second
 
+// The number of shards for raw items per table.
+//
+// Higher number of shards reduces CPU contention and increases the max bandwidth on multi-core systems.
+var rawItemsShardsPerTable = runtime.GOMAXPROCS(-1)
+
+// The maximum number of inmemoryBlock items per raw items shard.
+//
+// Raw items are converted into parts after the shard reaches this number of blocks.
+const maxBlocksPerShard = 256
+
 // Table represents mergeset table.
 type Table struct {
 	// Atomically updated counters must go first in the struct, so they are properly
@@ -89,6 +100,7 @@ type Table struct {
 	activeMerges   uint64
 	mergesCount    uint64
 	itemsMerged    uint64
+	itemsDropped   uint64
 	assistedMerges uint64
 
 	mergeIdx uint64
@@ -99,12 +111,13 @@ type Table struct {
 
 	prepareBlock PrepareBlockCallback
 
+	// transformItem contains transformItemCallbackWrapper set via SetTransformItemCallback.
+	transformItem atomic.Value
+
 	partsLock sync.Mutex
 	parts     []*partWrapper
 
-	rawItemsBlocks        []*inmemoryBlock
-	rawItemsLock          sync.Mutex
-	rawItemsLastFlushTime uint64
+	rawItems rawItemsShards
 
 	snapshotLock sync.RWMutex
 
@@ -194,7 +207,7 @@ func OpenTable(path string, flushCallback func(), prepareBlock PrepareBlockCallb
 		flockF:        flockF,
 		stopCh:        make(chan struct{}),
 	}
-	tb.startPartMergers()
+	tb.rawItems.init()
 	tb.startRawItemsFlusher()
 
 	var m TableMetrics
@@ -202,6 +215,10 @@ func OpenTable(path string, flushCallback func(), prepareBlock PrepareBlockCallb
 	logger.Infof("table %q has been opened in %.3f seconds; partsCount: %d; blocksCount: %d, itemsCount: %d; sizeBytes: %d",
 		path, time.Since(startTime).Seconds(), m.PartsCount, m.BlocksCount, m.ItemsCount, m.SizeBytes)
 
+	if isReadOnly {
+		return tb, nil
+	}
+	tb.startPartMergers()
 	tb.convertersWG.Add(1)
 	go func() {
 		tb.convertToV1280()
@@ -283,6 +300,7 @@ type TableMetrics struct {
 	ActiveMerges   uint64
 	MergesCount    uint64
 	ItemsMerged    uint64
+	ItemsDropped   uint64
 	AssistedMerges uint64
 
 	PendingItems uint64
@@ -309,13 +327,10 @@ func (tb *Table) UpdateMetrics(m *TableMetrics) {
 	m.ActiveMerges += atomic.LoadUint64(&tb.activeMerges)
 	m.MergesCount += atomic.LoadUint64(&tb.mergesCount)
 	m.ItemsMerged += atomic.LoadUint64(&tb.itemsMerged)
+	m.ItemsDropped += atomic.LoadUint64(&tb.itemsDropped)
 	m.AssistedMerges += atomic.LoadUint64(&tb.assistedMerges)
 
-	tb.rawItemsLock.Lock()
-	for _, ib := range tb.rawItemsBlocks {
-		m.PendingItems += uint64(len(ib.items))
-	}
-	tb.rawItemsLock.Unlock()
+	m.PendingItems += uint64(tb.rawItems.Len())
 
 	tb.partsLock.Lock()
 	m.PartsCount += uint64(len(tb.parts))
@@ -347,15 +362,63 @@ func (tb *Table) UpdateMetrics(m *TableMetrics) {
 
 // AddItems adds the given items to the tb.
 func (tb *Table) AddItems(items [][]byte) error {
+	if isReadOnly {
+		return fmt.Errorf("cannot add %d items to read-only table %q", len(items), tb.path)
+	}
+	return tb.rawItems.addItems(tb, items)
+}
+
+type rawItemsShards struct {
+	shardIdx uint32
+
+	// Shards reduce lock contention when adding items on multi-CPU systems.
+	shards []rawItemsShard
+}
+
+func (riss *rawItemsShards) init() {
+	riss.shards = make([]rawItemsShard, rawItemsShardsPerTable)
+}
+
+func (riss *rawItemsShards) addItems(tb *Table, items [][]byte) error {
+	n := atomic.AddUint32(&riss.shardIdx, 1)
+	shard := &riss.shards[n%uint32(len(riss.shards))]
+	return shard.addItems(tb, items)
+}
+
+func (riss *rawItemsShards) Len() int {
+	n := 0
+	for i := range riss.shards {
+		n += riss.shards[i].Len()
+	}
+	return n
+}
+
+type rawItemsShard struct {
+	mu            sync.Mutex
+	ibs           []*inmemoryBlock
+	lastFlushTime uint64
+}
+
+func (ris *rawItemsShard) Len() int {
+	ris.mu.Lock()
+	n := 0
+	for _, ib := range ris.ibs {
+		n += len(ib.items)
+	}
+	ris.mu.Unlock()
+	return n
+}
+
+func (ris *rawItemsShard) addItems(tb *Table, items [][]byte) error {
 	var err error
 	var blocksToMerge []*inmemoryBlock
 
-	tb.rawItemsLock.Lock()
-	if len(tb.rawItemsBlocks) == 0 {
+	ris.mu.Lock()
+	if len(ris.ibs) == 0 {
 		ib := getInmemoryBlock()
-		tb.rawItemsBlocks = append(tb.rawItemsBlocks, ib)
+		ris.ibs = append(ris.ibs, ib)
 	}
-	ib := tb.rawItemsBlocks[len(tb.rawItemsBlocks)-1]
+	ib := ris.ibs[len(ris.ibs)-1]
 	for _, item := range items {
 		if !ib.Add(item) {
 			ib = getInmemoryBlock()
@@ -365,15 +428,15 @@ func (tb *Table) AddItems(items [][]byte) error {
 					item, tb.path, len(item))
 				break
 			}
-			tb.rawItemsBlocks = append(tb.rawItemsBlocks, ib)
+			ris.ibs = append(ris.ibs, ib)
 		}
 	}
-	if len(tb.rawItemsBlocks) >= 1024 {
-		blocksToMerge = tb.rawItemsBlocks
-		tb.rawItemsBlocks = nil
-		tb.rawItemsLastFlushTime = fasttime.UnixTimestamp()
+	if len(ris.ibs) >= maxBlocksPerShard {
+		blocksToMerge = ris.ibs
+		ris.ibs = nil
+		ris.lastFlushTime = fasttime.UnixTimestamp()
 	}
-	tb.rawItemsLock.Unlock()
+	ris.mu.Unlock()
 
 	if blocksToMerge == nil {
 		// Fast path.
@@ -385,6 +448,18 @@ func (tb *Table) AddItems(items [][]byte) error {
 	return err
 }
 
+// appendBlocksToFlush appends blocks from ris, which must be flushed, to dst and returns the result.
+func (ris *rawItemsShard) appendBlocksToFlush(dst []*inmemoryBlock, currentTime uint64, flushSeconds int64, isFinal bool) []*inmemoryBlock {
+	ris.mu.Lock()
+	if isFinal || currentTime-ris.lastFlushTime > uint64(flushSeconds) {
+		dst = append(dst, ris.ibs...)
+		ris.ibs = nil
+		ris.lastFlushTime = currentTime
+	}
+	ris.mu.Unlock()
+	return dst
+}
+
 // getParts appends parts snapshot to dst and returns it.
 //
 // The appended parts must be released with putParts.
@@ -479,6 +554,30 @@ func (tb *Table) convertToV1280() {
 	}
 }
 
+// SetTransformItemCallback sets the callback for filtering and transforming items during background merges of table parts.
+//
+// This allows implementing compaction policies such as dropping obsolete items
+// without rewriting the whole table. The callback is applied to the merges started after the call.
+// Pass nil in order to disable the callback.
+func (tb *Table) SetTransformItemCallback(transformItem TransformItemCallback) {
+	tb.transformItem.Store(&transformItemCallbackWrapper{
+		transformItem: transformItem,
+	})
+}
+
+func (tb *Table) getTransformItemCallback() TransformItemCallback {
+	v := tb.transformItem.Load()
+	if v == nil {
+		return nil
+	}
+	return v.(*transformItemCallbackWrapper).transformItem
+}
+
+// transformItemCallbackWrapper allows storing nil TransformItemCallback in atomic.Value.
+type transformItemCallbackWrapper struct {
+	transformItem TransformItemCallback
+}
+
 func (tb *Table) mergePartsOptimal(pws []*partWrapper, stopCh <-chan struct{}) error {
 	for len(pws) > defaultPartsToMerge {
 		if err := tb.mergeParts(pws[:defaultPartsToMerge], stopCh, false); err != nil {
@@ -499,6 +598,12 @@ func (tb *Table) mergePartsOptimal(pws []*partWrapper, stopCh <-chan struct{}) e
 //
 // This function is only for debugging and testing.
 func (tb *Table) DebugFlush() {
+	tb.FlushPendingItems()
+}
+
+// FlushPendingItems flushes all the items added to tb before the call to parts on disk,
+// so they survive process crash.
+func (tb *Table) FlushPendingItems() {
 	tb.flushRawItems(true)
 
 	// Wait for background flushers to finish.
@@ -509,26 +614,19 @@ func (tb *Table) flushRawItems(isFinal bool) {
 	tb.rawItemsPendingFlushesWG.Add(1)
 	defer tb.rawItemsPendingFlushesWG.Done()
 
-	mustFlush := false
 	currentTime := fasttime.UnixTimestamp()
 	flushSeconds := int64(rawItemsFlushInterval.Seconds())
 	if flushSeconds <= 0 {
 		flushSeconds = 1
 	}
-	var blocksToMerge []*inmemoryBlock
-
-	tb.rawItemsLock.Lock()
-	if isFinal || currentTime-tb.rawItemsLastFlushTime > uint64(flushSeconds) {
-		mustFlush = true
-		blocksToMerge = tb.rawItemsBlocks
-		tb.rawItemsBlocks = nil
-		tb.rawItemsLastFlushTime = currentTime
-	}
-	tb.rawItemsLock.Unlock()
 
-	if mustFlush {
-		tb.mergeRawItemsBlocks(blocksToMerge)
+	// Collect blocks from all the shards, so they are merged in a batch.
+	var blocksToMerge []*inmemoryBlock
+	shards := tb.rawItems.shards
+	for i := range shards {
+		blocksToMerge = shards[i].appendBlocksToFlush(blocksToMerge, currentTime, flushSeconds, isFinal)
 	}
+	tb.mergeRawItemsBlocks(blocksToMerge)
 }
 
 func (tb *Table) mergeRawItemsBlocks(blocksToMerge []*inmemoryBlock) {
@@ -635,7 +733,8 @@ func (tb *Table) mergeInmemoryBlocks(blocksToMerge []*inmemoryBlock) *partWrappe
 	// Merge parts.
 	// The merge shouldn't be interrupted by stopCh,
 	// since it may be final after stopCh is closed.
-	err := mergeBlockStreams(&mpDst.ph, bsw, bsrs, tb.prepareBlock, nil, &tb.itemsMerged)
+	// Items aren't transformed here, since inmemory parts are merged into file parts soon.
+	err := mergeBlockStreams(&mpDst.ph, bsw, bsrs, tb.prepareBlock, nil, nil, &tb.itemsMerged, &tb.itemsDropped)
 	if err != nil {
 		logger.Panicf("FATAL: cannot merge inmemoryBlocks: %s", err)
 	}
@@ -758,6 +857,12 @@ func (tb *Table) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isOuterP
 			putBlockStreamReader(bsr)
 		}
 	}()
+	// Throttle only background merges, which may be stopped via stopCh.
+	// Flushes of inmemory parts are performed at full speed.
+	var readLimiter *mergethrottle.Limiter
+	if stopCh != nil {
+		readLimiter = mergethrottle.NewReadLimiter(stopCh)
+	}
 	for _, pw := range pws {
 		bsr := getBlockStreamReader()
 		if pw.mp != nil {
@@ -769,6 +874,9 @@ func (tb *Table) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isOuterP
 			if err := bsr.InitFromFilePart(pw.p.path); err != nil {
 				return fmt.Errorf("cannot open source part for merging: %w", err)
 			}
+			if readLimiter != nil {
+				bsr.throttle(readLimiter)
+			}
 		}
 		bsrs = append(bsrs, bsr)
 	}
@@ -794,10 +902,13 @@ func (tb *Table) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isOuterP
 	if err := bsw.InitFromFilePart(tmpPartPath, nocache, compressLevel); err != nil {
 		return fmt.Errorf("cannot create destination part %q: %w", tmpPartPath, err)
 	}
+	if stopCh != nil {
+		bsw.throttle(mergethrottle.NewWriteLimiter(stopCh))
+	}
 
 	// Merge parts into a temporary location.
 	var ph partHeader
-	err := mergeBlockStreams(&ph, bsw, bsrs, tb.prepareBlock, stopCh, &tb.itemsMerged)
+	err := mergeBlockStreams(&ph, bsw, bsrs, tb.prepareBlock, tb.getTransformItemCallback(), stopCh, &tb.itemsMerged, &tb.itemsDropped)
 	putBlockStreamWriter(bsw)
 	if err != nil {
 		if err == errForciblyStopped {
@@ -823,7 +934,12 @@ func (tb *Table) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isOuterP
 			fmt.Fprintf(&bb, "%s\n", pw.p.path)
 		}
 	}
-	dstPartPath := ph.Path(tb.path, mergeIdx)
+	dstPartPath := ""
+	if ph.itemsCount > 0 {
+		// The destination part may have no items if they are dropped
+		// during the merge by transformItem callback.
+		dstPartPath = ph.Path(tb.path, mergeIdx)
+	}
 	fmt.Fprintf(&bb, "%s -> %s\n", tmpPartPath, dstPartPath)
 	txnPath := fmt.Sprintf("%s/txn/%016X", tb.path, mergeIdx)
 	if err := fs.WriteFileAtomically(txnPath, bb.B); err != nil {
@@ -835,15 +951,19 @@ func (tb *Table) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isOuterP
 		return fmt.Errorf("cannot execute transaction %q: %w", txnPath, err)
 	}
 
-	// Open the merged part.
-	newP, err := openFilePart(dstPartPath)
-	if err != nil {
-		return fmt.Errorf("cannot open merged part %q: %w", dstPartPath, err)
-	}
-	newPSize := newP.size
-	newPW := &partWrapper{
-		p:        newP,
-		refCount: 1,
+	var newPW *partWrapper
+	var newPSize uint64
+	if len(dstPartPath) > 0 {
+		// Open the merged part if it is non-empty.
+		newP, err := openFilePart(dstPartPath)
+		if err != nil {
+			return fmt.Errorf("cannot open merged part %q: %w", dstPartPath, err)
+		}
+		newPSize = newP.size
+		newPW = &partWrapper{
+			p:        newP,
+			refCount: 1,
+		}
 	}
 
 	// Atomically remove old parts and add new part.
@@ -857,7 +977,9 @@ func (tb *Table) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isOuterP
 	removedParts := 0
 	tb.partsLock.Lock()
 	tb.parts, removedParts = removeParts(tb.parts, m)
-	tb.parts = append(tb.parts, newPW)
+	if newPW != nil {
+		tb.parts = append(tb.parts, newPW)
+	}
 	tb.partsLock.Unlock()
 	if removedParts != len(m) {
 		if !isOuterParts {
@@ -947,6 +1069,16 @@ func (tb *Table) maxOutPartItemsSlow() uint64 {
 
 var mergeWorkersCount = runtime.GOMAXPROCS(-1)
 
+// SetReadOnly enables read-only mode for the tables opened after the call.
+//
+// Read-only tables don't merge parts in background and reject AddItems calls,
+// so their files remain unmodified.
+func SetReadOnly(readOnly bool) {
+	isReadOnly = readOnly
+}
+
+var isReadOnly bool
+
 func openParts(path string) ([]*partWrapper, error) {
 	// The path can be missing after restoring from backup, so create it if needed.
 	if err := fs.MkdirAllIfNotExist(path); err != nil {
@@ -1181,20 +1313,26 @@ func runTransaction(txnLock *sync.RWMutex, pathPrefix, txnPath string) error {
 	if err != nil {
 		return fmt.Errorf("invalid source path to rename: %w", err)
 	}
-	dstPath, err = validatePath(pathPrefix, dstPath)
-	if err != nil {
-		return fmt.Errorf("invalid destination path to rename: %w", err)
-	}
-	if fs.IsPathExist(srcPath) {
-		if err := os.Rename(srcPath, dstPath); err != nil {
-			return fmt.Errorf("cannot rename %q to %q: %w", srcPath, dstPath, err)
+	if len(dstPath) > 0 {
+		// Move srcPath to dstPath.
+		dstPath, err = validatePath(pathPrefix, dstPath)
+		if err != nil {
+			return fmt.Errorf("invalid destination path to rename: %w", err)
+		}
+		if fs.IsPathExist(srcPath) {
+			if err := os.Rename(srcPath, dstPath); err != nil {
+				return fmt.Errorf("cannot rename %q to %q: %w", srcPath, dstPath, err)
+			}
+		} else if !fs.IsPathExist(dstPath) {
+			// Emit info message for the expected condition after unclean shutdown on NFS disk.
+			// The dstPath part may be missing because it could be already merged into bigger part
+			// while old source parts for the current txn weren't still deleted due to NFS locks.
+			logger.Infof("cannot find both source and destination paths: %q -> %q; this may be the case after unclean shutdown (OOM, `kill -9`, hard reset) on NFS disk",
+				srcPath, dstPath)
 		}
-	} else if !fs.IsPathExist(dstPath) {
-		// Emit info message for the expected condition after unclean shutdown on NFS disk.
-		// The dstPath part may be missing because it could be already merged into bigger part
-		// while old source parts for the current txn weren't still deleted due to NFS locks.
-		logger.Infof("cannot find both source and destination paths: %q -> %q; this may be the case after unclean shutdown (OOM, `kill -9`, hard reset) on NFS disk",
-			srcPath, dstPath)
+	} else {
+		// Just remove srcPath.
+		fs.MustRemoveAll(srcPath)
 	}
 
 	// Flush pathPrefix directory metadata to the underying storage.
@@ -7,8 +7,10 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
 )
 
 func TestTableOpenClose(t *testing.T) {
@@ -111,6 +113,45 @@ func TestTableAddItemSerial(t *testing.T) {
 	testReopenTable(t, path, itemsCount+moreItemsCount)
 }
 
+func TestTableMergeThrottling(t *testing.T) {
+	const path = "TestTableMergeThrottling"
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	// Set too low bandwidth limits, so throttled merges cannot finish during the test.
+	mergethrottle.SetBandwidthLimits(1, 1)
+	defer mergethrottle.SetBandwidthLimits(0, 0)
+
+	tb, err := OpenTable(path, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open %q: %s", path, err)
+	}
+	startTime := time.Now()
+
+	// Flushes of inmemory parts mustn't be throttled.
+	const itemsCount = 1e4
+	for i := 0; i < 3; i++ {
+		testAddItemsSerial(tb, itemsCount)
+		tb.DebugFlush()
+	}
+	var m TableMetrics
+	tb.UpdateMetrics(&m)
+	if m.ItemsCount != 3*itemsCount {
+		t.Fatalf("unexpected itemsCount; got %d; want %v", m.ItemsCount, 3*itemsCount)
+	}
+
+	// Throttled background merges mustn't delay the shutdown.
+	tb.MustClose()
+	if d := time.Since(startTime); d > 10*time.Second {
+		t.Fatalf("too long duration for flushes and shutdown with throttled merges: %s", d)
+	}
+	testReopenTable(t, path, 3*itemsCount)
+}
+
 func testAddItemsSerial(tb *Table, itemsCount int) {
 	for i := 0; i < itemsCount; i++ {
 		item := getRandomBytes()
@@ -264,6 +305,78 @@ func TestTableAddItemsConcurrent(t *testing.T) {
 	testReopenTable(t, path, itemsCount+moreItemsCount)
 }
 
+func TestTableTransformItemCallback(t *testing.T) {
+	const path = "TestTableTransformItemCallback"
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	tb, err := OpenTable(path, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open %q: %s", path, err)
+	}
+
+	// Drop all the items during merges.
+	tb.SetTransformItemCallback(func(dst, prevItem, item []byte) ([]byte, bool) {
+		return dst, false
+	})
+	const itemsCount = 1e4
+	testAddItemsConcurrent(tb, itemsCount)
+	tb.DebugFlush()
+	var m TableMetrics
+	tb.UpdateMetrics(&m)
+	if m.ItemsCount != 0 {
+		t.Fatalf("unexpected itemsCount; got %d; want 0", m.ItemsCount)
+	}
+	if m.PartsCount != 0 {
+		t.Fatalf("unexpected partsCount; got %d; want 0", m.PartsCount)
+	}
+	if m.ItemsDropped != itemsCount {
+		t.Fatalf("unexpected itemsDropped; got %d; want %v", m.ItemsDropped, itemsCount)
+	}
+
+	// Keep only items starting with even byte.
+	tb.SetTransformItemCallback(func(dst, prevItem, item []byte) ([]byte, bool) {
+		if len(item) == 0 || item[0]%2 != 0 {
+			return dst, false
+		}
+		return append(dst, item...), true
+	})
+	testAddItemsConcurrent(tb, itemsCount)
+	tb.DebugFlush()
+	m = TableMetrics{}
+	tb.UpdateMetrics(&m)
+	if m.ItemsCount == 0 || m.ItemsCount >= itemsCount {
+		t.Fatalf("unexpected itemsCount; got %d; want (0...%v)", m.ItemsCount, itemsCount)
+	}
+	if m.ItemsCount+m.ItemsDropped != 2*itemsCount {
+		t.Fatalf("unexpected itemsCount+itemsDropped; got %d; want %v", m.ItemsCount+m.ItemsDropped, 2*itemsCount)
+	}
+	itemsKept := m.ItemsCount
+	var ts TableSearch
+	ts.Init(tb, nil)
+	ts.Seek(nil)
+	for ts.NextItem() {
+		if len(ts.Item) == 0 || ts.Item[0]%2 != 0 {
+			t.Fatalf("unexpected item found: %X", ts.Item)
+		}
+	}
+	if err := ts.Error(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts.MustClose()
+
+	// Disable the callback and verify that all the items are kept.
+	tb.SetTransformItemCallback(nil)
+	testAddItemsConcurrent(tb, itemsCount)
+	tb.MustClose()
+
+	testReopenTable(t, path, int(itemsKept)+itemsCount)
+}
+
 func testAddItemsConcurrent(tb *Table, itemsCount int) {
 	const goroutinesCount = 6
 	workCh := make(chan int, itemsCount)
@@ -0,0 +1,190 @@
+package mergethrottle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/filestream"
+)
+
+var (
+	maxReadBytesPerSecond  int64
+	maxWriteBytesPerSecond int64
+
+	// Merges are throttled only during [lowPriorityStartHour ... lowPriorityEndHour) hours
+	// if lowPriorityStartHour != lowPriorityEndHour.
+	lowPriorityStartHour int32
+	lowPriorityEndHour   int32
+
+	throttleDuration uint64
+)
+
+// SetBandwidthLimits sets the maximum read and write bandwidth in bytes per second for each background merge of file parts.
+//
+// The limits apply to merges of both data parts and indexdb parts.
+// There is no limit if the corresponding value is <= 0.
+func SetBandwidthLimits(readBytesPerSecond, writeBytesPerSecond int) {
+	atomic.StoreInt64(&maxReadBytesPerSecond, int64(readBytesPerSecond))
+	atomic.StoreInt64(&maxWriteBytesPerSecond, int64(writeBytesPerSecond))
+}
+
+// SetLowPriorityHours limits merge bandwidth set via SetBandwidthLimits only to the given hours range in local time.
+//
+// The hours range must have `startHour-endHour` format, for example `9-18`. The end hour isn't included in the range.
+// The range may span midnight, for example `22-6`. Merge bandwidth is limited all the time if the range is empty.
+func SetLowPriorityHours(hoursRange string) error {
+	startHour, endHour, err := parseHoursRange(hoursRange)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&lowPriorityStartHour, int32(startHour))
+	atomic.StoreInt32(&lowPriorityEndHour, int32(endHour))
+	return nil
+}
+
+// Duration returns the total time spent by merges on throttling in nanoseconds.
+func Duration() uint64 {
+	return atomic.LoadUint64(&throttleDuration)
+}
+
+func parseHoursRange(s string) (int, int, error) {
+	if len(s) == 0 {
+		return 0, 0, nil
+	}
+	n := strings.IndexByte(s, '-')
+	if n < 0 {
+		return 0, 0, fmt.Errorf("missing '-' in hours range %q; it must have `startHour-endHour` format, for example `9-18`", s)
+	}
+	startHour, err := strconv.Atoi(s[:n])
+	if err != nil || startHour < 0 || startHour > 23 {
+		return 0, 0, fmt.Errorf("invalid start hour in hours range %q; it must be an integer in the range [0...23]", s)
+	}
+	endHour, err := strconv.Atoi(s[n+1:])
+	if err != nil || endHour < 0 || endHour > 24 {
+		return 0, 0, fmt.Errorf("invalid end hour in hours range %q; it must be an integer in the range [0...24]", s)
+	}
+	if startHour == endHour%24 {
+		return 0, 0, fmt.Errorf("start hour cannot match end hour in hours range %q", s)
+	}
+	return startHour, endHour % 24, nil
+}
+
+func isThrottlingActive(t time.Time) bool {
+	startHour := int(atomic.LoadInt32(&lowPriorityStartHour))
+	endHour := int(atomic.LoadInt32(&lowPriorityEndHour))
+	if startHour == endHour {
+		return true
+	}
+	hour := t.Hour()
+	if startHour < endHour {
+		return hour >= startHour && hour < endHour
+	}
+	return hour >= startHour || hour < endHour
+}
+
+// Limiter limits the bandwidth for a single merge.
+//
+// It mustn't be used from concurrently running goroutines.
+type Limiter struct {
+	maxBytesPerSecond *int64
+	stopCh            <-chan struct{}
+
+	startTime time.Time
+	bytes     int64
+}
+
+// NewReadLimiter returns a limiter for reading source parts during the merge, which may be stopped via stopCh.
+//
+// Throttling is interrupted when stopCh is closed.
+func NewReadLimiter(stopCh <-chan struct{}) *Limiter {
+	return newLimiter(&maxReadBytesPerSecond, stopCh)
+}
+
+// NewWriteLimiter returns a limiter for writing the destination part during the merge, which may be stopped via stopCh.
+//
+// Throttling is interrupted when stopCh is closed.
+func NewWriteLimiter(stopCh <-chan struct{}) *Limiter {
+	return newLimiter(&maxWriteBytesPerSecond, stopCh)
+}
+
+func newLimiter(maxBytesPerSecond *int64, stopCh <-chan struct{}) *Limiter {
+	return &Limiter{
+		maxBytesPerSecond: maxBytesPerSecond,
+		stopCh:            stopCh,
+		startTime:         time.Now(),
+	}
+}
+
+// register registers n bytes read or written and sleeps if the bandwidth limit is exceeded.
+func (l *Limiter) register(n int) {
+	limit := atomic.LoadInt64(l.maxBytesPerSecond)
+	ct := time.Now()
+	if limit <= 0 || !isThrottlingActive(ct) {
+		// Restart accounting, so the merge isn't throttled for the time spent without throttling.
+		l.startTime = ct
+		l.bytes = 0
+		return
+	}
+	l.bytes += int64(n)
+	expectedDuration := time.Duration(float64(l.bytes) / float64(limit) * float64(time.Second))
+	d := expectedDuration - ct.Sub(l.startTime)
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	select {
+	case <-l.stopCh:
+		t.Stop()
+	case <-t.C:
+	}
+	atomic.AddUint64(&throttleDuration, uint64(time.Since(ct)))
+}
+
+// NewReader returns a reader, which reads from r with the bandwidth limited by l.
+func (l *Limiter) NewReader(r filestream.ReadCloser) filestream.ReadCloser {
+	return &reader{
+		r: r,
+		l: l,
+	}
+}
+
+// NewWriter returns a writer, which writes to w with the bandwidth limited by l.
+func (l *Limiter) NewWriter(w filestream.WriteCloser) filestream.WriteCloser {
+	return &writer{
+		w: w,
+		l: l,
+	}
+}
+
+type reader struct {
+	r filestream.ReadCloser
+	l *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.l.register(n)
+	return n, err
+}
+
+func (r *reader) MustClose() {
+	r.r.MustClose()
+}
+
+type writer struct {
+	w filestream.WriteCloser
+	l *Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.l.register(n)
+	return n, err
+}
+
+func (w *writer) MustClose() {
+	w.w.MustClose()
+}
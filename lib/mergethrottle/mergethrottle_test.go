@@ -0,0 +1,103 @@
+package mergethrottle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHoursRangeSuccess(t *testing.T) {
+	f := func(s string, startHourExpected, endHourExpected int) {
+		t.Helper()
+		startHour, endHour, err := parseHoursRange(s)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", s, err)
+		}
+		if startHour != startHourExpected || endHour != endHourExpected {
+			t.Fatalf("unexpected hours for %q; got %d-%d; want %d-%d", s, startHour, endHour, startHourExpected, endHourExpected)
+		}
+	}
+
+	f("", 0, 0)
+	f("9-18", 9, 18)
+	f("22-6", 22, 6)
+	f("12-24", 12, 0)
+}
+
+func TestParseHoursRangeFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, _, err := parseHoursRange(s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+
+	f("9")
+	f("foo-18")
+	f("9-bar")
+	f("-1-18")
+	f("24-1")
+	f("9-25")
+	f("9-9")
+	f("0-24")
+}
+
+func TestIsThrottlingActive(t *testing.T) {
+	defer func() {
+		if err := SetLowPriorityHours(""); err != nil {
+			t.Fatalf("cannot reset low priority hours: %s", err)
+		}
+	}()
+	f := func(hoursRange string, hour int, resultExpected bool) {
+		t.Helper()
+		if err := SetLowPriorityHours(hoursRange); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		ts := time.Date(2021, 3, 1, hour, 30, 0, 0, time.Local)
+		result := isThrottlingActive(ts)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for hoursRange=%q, hour=%d; got %v; want %v", hoursRange, hour, result, resultExpected)
+		}
+	}
+
+	f("", 0, true)
+	f("", 12, true)
+	f("9-18", 8, false)
+	f("9-18", 9, true)
+	f("9-18", 17, true)
+	f("9-18", 18, false)
+	f("22-6", 23, true)
+	f("22-6", 2, true)
+	f("22-6", 6, false)
+	f("22-6", 12, false)
+}
+
+func TestLimiter(t *testing.T) {
+	maxBytesPerSecond := int64(1000)
+	l := newLimiter(&maxBytesPerSecond, nil)
+	startTime := time.Now()
+	for i := 0; i < 10; i++ {
+		l.register(20)
+	}
+	if d := time.Since(startTime); d < 150*time.Millisecond {
+		t.Fatalf("too small duration for reading 200 bytes at 1000 bytes/sec; got %s; want at least 150ms", d)
+	}
+
+	// Stopped limiter mustn't sleep.
+	stopCh := make(chan struct{})
+	close(stopCh)
+	l = newLimiter(&maxBytesPerSecond, stopCh)
+	startTime = time.Now()
+	l.register(1e6)
+	if d := time.Since(startTime); d > time.Second {
+		t.Fatalf("stopped limiter mustn't sleep; slept for %s", d)
+	}
+
+	// Zero limit means no limit.
+	maxBytesPerSecond = 0
+	l = newLimiter(&maxBytesPerSecond, nil)
+	startTime = time.Now()
+	l.register(1e9)
+	if d := time.Since(startTime); d > time.Second {
+		t.Fatalf("unlimited limiter mustn't sleep; slept for %s", d)
+	}
+}
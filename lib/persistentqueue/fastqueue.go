@@ -47,6 +47,17 @@ func MustOpenFastQueue(path, name string, maxInmemoryBlocks, maxPendingBytes int
 	return fq
 }
 
+// UnblockAllReaders unblocks all the readers, so they return false from MustReadBlock.
+//
+// Writers may continue writing to fq after the call, so readers could put back the blocks they couldn't process.
+func (fq *FastQueue) UnblockAllReaders() {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	fq.mustStop = true
+	fq.cond.Broadcast()
+}
+
 // MustClose unblocks all the readers.
 //
 // It is expected no new writers during and after the call.
@@ -150,6 +150,45 @@ func TestFastQueueReadUnblockByClose(t *testing.T) {
 	mustDeleteDir(path)
 }
 
+func TestFastQueueUnblockAllReaders(t *testing.T) {
+	path := "fast-queue-unblock-all-readers"
+	mustDeleteDir(path)
+
+	fq := MustOpenFastQueue(path, "foobar", 123, 0)
+	resultCh := make(chan error)
+	go func() {
+		_, ok := fq.MustReadBlock(nil)
+		if ok {
+			resultCh <- fmt.Errorf("unexpected ok=true")
+			return
+		}
+		resultCh <- nil
+	}()
+	fq.UnblockAllReaders()
+	select {
+	case err := <-resultCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+
+	// Blocks written after UnblockAllReaders call must be persisted.
+	fq.MustWriteBlock([]byte("foo"))
+	fq.MustClose()
+	fq = MustOpenFastQueue(path, "foobar", 123, 0)
+	data, ok := fq.MustReadBlock(nil)
+	if !ok {
+		t.Fatalf("unexpected ok=false")
+	}
+	if string(data) != "foo" {
+		t.Fatalf("unexpected data read; got %q; want %q", data, "foo")
+	}
+	fq.MustClose()
+	mustDeleteDir(path)
+}
+
 func TestFastQueueReadUnblockByWrite(t *testing.T) {
 	path := "fast-queue-read-unblock-by-write"
 	mustDeleteDir(path)
@@ -54,6 +54,9 @@ type Queue struct {
 
 	mustStop bool
 
+	// mustStopReaders is set by UnblockAllReaders.
+	mustStopReaders bool
+
 	blocksDropped *metrics.Counter
 	bytesDropped  *metrics.Counter
 
@@ -309,6 +312,17 @@ func tryOpeningQueue(path, name string, chunkFileSize, maxBlockSize, maxPendingB
 	return &q, nil
 }
 
+// UnblockAllReaders unblocks all the MustReadBlock calls, so they return false.
+//
+// MustWriteBlock may be called after the call, so readers could put back the blocks they couldn't process.
+func (q *Queue) UnblockAllReaders() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.mustStopReaders = true
+	q.cond.Broadcast()
+}
+
 // MustClose closes q.
 //
 // It unblocks all the MustReadBlock calls.
@@ -440,7 +454,7 @@ func (q *Queue) writeBlockLocked(block []byte) error {
 
 // MustReadBlock appends the next block from q to dst and returns the result.
 //
-// false is returned after MustClose call.
+// false is returned after MustClose or UnblockAllReaders call.
 //
 // It is safe calling this function from concurrent goroutines.
 func (q *Queue) MustReadBlock(dst []byte) ([]byte, bool) {
@@ -448,7 +462,7 @@ func (q *Queue) MustReadBlock(dst []byte) ([]byte, bool) {
 	defer q.mu.Unlock()
 
 	for {
-		if q.mustStop {
+		if q.mustStop || q.mustStopReaders {
 			return dst, false
 		}
 		if q.readerOffset > q.writerOffset {
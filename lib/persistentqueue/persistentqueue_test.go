@@ -274,6 +274,45 @@ func TestQueueReadEmpty(t *testing.T) {
 	}
 }
 
+func TestQueueUnblockAllReaders(t *testing.T) {
+	path := "queue-unblock-all-readers"
+	mustDeleteDir(path)
+	q := MustOpen(path, "foobar", 0)
+	defer mustDeleteDir(path)
+
+	resultCh := make(chan error)
+	go func() {
+		_, ok := q.MustReadBlock(nil)
+		var err error
+		if ok {
+			err = fmt.Errorf("unexpected ok=%v returned from MustReadBlock; want false", ok)
+		}
+		resultCh <- err
+	}()
+	q.UnblockAllReaders()
+	select {
+	case err := <-resultCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+
+	// Blocks written after UnblockAllReaders call must be persisted.
+	q.MustWriteBlock([]byte("foo"))
+	q.MustClose()
+	q = MustOpen(path, "foobar", 0)
+	data, ok := q.MustReadBlock(nil)
+	if !ok {
+		t.Fatalf("unexpected ok=false")
+	}
+	if string(data) != "foo" {
+		t.Fatalf("unexpected data read; got %q; want %q", data, "foo")
+	}
+	q.MustClose()
+}
+
 func TestQueueReadWriteConcurrent(t *testing.T) {
 	path := "queue-read-write-concurrent"
 	mustDeleteDir(path)
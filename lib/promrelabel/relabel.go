@@ -206,7 +206,7 @@ func applyRelabelConfig(labels []prompbmarshal.Label, labelsOffset int, prc *Par
 			}
 			value := relabelBufPool.Get()
 			value.B = prc.Regex.ExpandString(value.B[:0], prc.Replacement, label.Name, match)
-			label.Name = string(value.B)
+			label.Name = bytesutil.InternBytes(value.B)
 			relabelBufPool.Put(value)
 		}
 		return labels
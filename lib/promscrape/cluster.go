@@ -0,0 +1,206 @@
+package promscrape
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+var (
+	clusterMemberURLs = flagutil.NewArray("promscrape.cluster.memberURLs", "Optional URLs of all the vmagent replicas in the cluster, including the current replica. "+
+		"For example, http://vmagent-0:8429,http://vmagent-1:8429 . If set, then scrape targets are sharded among alive replicas, "+
+		"so every target is scraped by a single replica. See also -promscrape.cluster.memberNum")
+	clusterMemberNum           = flag.Int("promscrape.cluster.memberNum", 0, "The index of the current vmagent replica in -promscrape.cluster.memberURLs starting from 0")
+	clusterHealthCheckInterval = flag.Duration("promscrape.cluster.healthCheckInterval", 10*time.Second, "Interval for checking the health of -promscrape.cluster.memberURLs. "+
+		"Targets of unhealthy replicas are automatically re-sharded among the remaining replicas")
+)
+
+// clusterMembersGlobal is non-nil if -promscrape.cluster.memberURLs is set.
+var clusterMembersGlobal *clusterMembers
+
+func initClusterMembers() {
+	if len(*clusterMemberURLs) == 0 {
+		return
+	}
+	cm, err := newClusterMembers(*clusterMemberURLs, *clusterMemberNum)
+	if err != nil {
+		logger.Fatalf("cannot initialize vmagent cluster: %s", err)
+	}
+	clusterMembersGlobal = cm
+	clusterMembersGlobal.startHealthChecks(*clusterHealthCheckInterval)
+	logger.Infof("sharding scrape targets among %d vmagent replicas; the current replica index is %d", len(cm.urls), cm.memberNum)
+}
+
+func stopClusterMembers() {
+	if clusterMembersGlobal == nil {
+		return
+	}
+	clusterMembersGlobal.stopHealthChecks()
+}
+
+// clusterMembers tracks alive vmagent replicas and decides which scrape targets belong to the current replica.
+type clusterMembers struct {
+	urls      []string
+	memberNum int
+
+	mu       sync.Mutex
+	alive    []bool
+	changeCh chan struct{}
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newClusterMembers(urls []string, memberNum int) (*clusterMembers, error) {
+	if memberNum < 0 || memberNum >= len(urls) {
+		return nil, fmt.Errorf("-promscrape.cluster.memberNum=%d must be in the range [0..%d]", memberNum, len(urls)-1)
+	}
+	alive := make([]bool, len(urls))
+	for i := range alive {
+		// Consider all the replicas alive until the first health check in order to avoid scraping all the targets at startup.
+		alive[i] = true
+	}
+	return &clusterMembers{
+		urls:      urls,
+		memberNum: memberNum,
+		alive:     alive,
+		changeCh:  make(chan struct{}),
+		stopCh:    make(chan struct{}),
+	}, nil
+}
+
+// isOwnTarget returns true if the target with the given key must be scraped by the current replica.
+//
+// Targets are assigned to alive replicas with rendezvous hashing, so only targets of dead replicas
+// are moved to other replicas when a replica dies.
+func (cm *clusterMembers) isOwnTarget(key string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	ownerIdx := -1
+	var ownerHash uint64
+	b := make([]byte, 0, len(key)+8)
+	for i, ok := range cm.alive {
+		if !ok {
+			continue
+		}
+		b = append(b[:0], key...)
+		b = append(b, 0)
+		b = strconv.AppendInt(b, int64(i), 10)
+		h := xxhash.Sum64(b)
+		if ownerIdx < 0 || h > ownerHash {
+			ownerIdx = i
+			ownerHash = h
+		}
+	}
+	return ownerIdx == cm.memberNum
+}
+
+// getChangeCh returns a channel, which is closed when the set of alive replicas changes.
+func (cm *clusterMembers) getChangeCh() <-chan struct{} {
+	cm.mu.Lock()
+	ch := cm.changeCh
+	cm.mu.Unlock()
+	return ch
+}
+
+// setAlive updates the set of alive replicas. It returns true if the set has been changed.
+func (cm *clusterMembers) setAlive(alive []bool) bool {
+	// The current replica is always alive from its own point of view.
+	alive[cm.memberNum] = true
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	changed := false
+	for i := range alive {
+		if alive[i] != cm.alive[i] {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false
+	}
+	copy(cm.alive, alive)
+	close(cm.changeCh)
+	cm.changeCh = make(chan struct{})
+	return true
+}
+
+func (cm *clusterMembers) aliveCount() int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	n := 0
+	for _, ok := range cm.alive {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+func (cm *clusterMembers) startHealthChecks(interval time.Duration) {
+	client := &http.Client{
+		Timeout: interval,
+	}
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			alive := make([]bool, len(cm.urls))
+			for i, u := range cm.urls {
+				if i == cm.memberNum {
+					continue
+				}
+				alive[i] = isClusterMemberHealthy(client, u)
+			}
+			if cm.setAlive(alive) {
+				clusterReshards.Inc()
+				logger.Infof("the number of alive vmagent replicas changed to %d; re-sharding scrape targets", cm.aliveCount())
+			}
+			select {
+			case <-cm.stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (cm *clusterMembers) stopHealthChecks() {
+	close(cm.stopCh)
+	cm.wg.Wait()
+}
+
+func isClusterMemberHealthy(client *http.Client, memberURL string) bool {
+	healthURL := strings.TrimSuffix(memberURL, "/") + "/health"
+	resp, err := client.Get(healthURL)
+	if err != nil {
+		return false
+	}
+	_, _ = ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+var clusterReshards = metrics.NewCounter(`vm_promscrape_cluster_reshards_total`)
+
+var _ = metrics.NewGauge(`vm_promscrape_cluster_members_alive`, func() float64 {
+	cm := clusterMembersGlobal
+	if cm == nil {
+		return 0
+	}
+	return float64(cm.aliveCount())
+})
@@ -0,0 +1,167 @@
+package promscrape
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestClusterMembersIsOwnTarget(t *testing.T) {
+	urls := []string{"http://vmagent-0:8429", "http://vmagent-1:8429", "http://vmagent-2:8429"}
+	var cms []*clusterMembers
+	for i := range urls {
+		cm, err := newClusterMembers(urls, i)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		cms = append(cms, cm)
+	}
+	getOwners := func() []int {
+		var owners []int
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("ScrapeURL=http://host-%d:9100/metrics", i)
+			owner := -1
+			for j, cm := range cms {
+				if !cm.isOwnTarget(key) {
+					continue
+				}
+				if owner >= 0 {
+					t.Fatalf("target %q is owned by multiple replicas: %d and %d", key, owner, j)
+				}
+				owner = j
+			}
+			owners = append(owners, owner)
+		}
+		return owners
+	}
+
+	// All the replicas are alive.
+	owners := getOwners()
+	counts := make([]int, len(urls))
+	for i, owner := range owners {
+		if owner < 0 {
+			t.Fatalf("target #%d isn't owned by any replica", i)
+		}
+		counts[owner]++
+	}
+	for i, n := range counts {
+		if n < 200 {
+			t.Fatalf("too small number of targets for replica #%d: %d", i, n)
+		}
+	}
+
+	// The replica #1 dies. Its targets must be moved to other replicas, while other targets must stay at their replicas.
+	for _, cm := range cms {
+		alive := []bool{true, false, true}
+		if cm.memberNum == 1 {
+			continue
+		}
+		changeCh := cm.getChangeCh()
+		if !cm.setAlive(alive) {
+			t.Fatalf("expecting changed set of alive replicas")
+		}
+		select {
+		case <-changeCh:
+		default:
+			t.Fatalf("expecting closed change channel")
+		}
+		if cm.setAlive(alive) {
+			t.Fatalf("unexpected change for the same set of alive replicas")
+		}
+	}
+	cms = []*clusterMembers{cms[0], cms[2]}
+	ownersNew := getOwners()
+	for i, owner := range owners {
+		if ownersNew[i] < 0 {
+			t.Fatalf("target #%d isn't owned by any replica after re-sharding", i)
+		}
+		// Convert the index in cms to the replica number.
+		ownerNew := cms[ownersNew[i]].memberNum
+		if owner != 1 && owner != ownerNew {
+			t.Fatalf("target #%d unexpectedly moved from replica %d to replica %d", i, owner, ownerNew)
+		}
+	}
+}
+
+func TestNewClusterMembersFailure(t *testing.T) {
+	f := func(urls []string, memberNum int) {
+		t.Helper()
+		if _, err := newClusterMembers(urls, memberNum); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f([]string{"http://foo"}, -1)
+	f([]string{"http://foo"}, 1)
+	f([]string{"http://foo", "http://bar"}, 2)
+}
+
+func TestScraperGroupUpdateClusterMembersChange(t *testing.T) {
+	urls := []string{"http://vmagent-0:8429", "http://vmagent-1:8429", "http://vmagent-2:8429"}
+	cm, err := newClusterMembers(urls, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	clusterMembersGlobal = cm
+	defer func() {
+		clusterMembersGlobal = nil
+	}()
+
+	var sws []ScrapeWork
+	for i := 0; i < 300; i++ {
+		sws = append(sws, ScrapeWork{
+			ScrapeURL: fmt.Sprintf("http://host-%d:9100/metrics", i),
+			// Use big scrape interval in order to prevent from scraping the targets during the test.
+			ScrapeInterval: time.Hour,
+			ScrapeTimeout:  time.Second,
+			AuthConfig:     &promauth.Config{},
+		})
+	}
+	sg := newScraperGroup("test_cluster_members_change", func(wr *prompbmarshal.WriteRequest) {})
+	defer sg.stop()
+
+	checkScrapers := func() {
+		t.Helper()
+		ownedCount := 0
+		for i := range sws {
+			key := sws[i].key()
+			isOwn := cm.isOwnTarget(key)
+			if isOwn {
+				ownedCount++
+			}
+			if hasScraper := sg.m[key] != nil; hasScraper != isOwn {
+				t.Fatalf("unexpected scraper state for target %q; got hasScraper=%v; want %v", sws[i].ScrapeURL, hasScraper, isOwn)
+			}
+		}
+		if len(sg.m) != ownedCount {
+			t.Fatalf("unexpected number of scrapers; got %d; want %d", len(sg.m), ownedCount)
+		}
+	}
+
+	// All the replicas are alive.
+	sg.update(sws)
+	checkScrapers()
+	ownedInitial := len(sg.m)
+
+	// The replica #1 dies, so the current replica must take a part of its targets.
+	if !cm.setAlive([]bool{true, false, true}) {
+		t.Fatalf("expecting changed set of alive replicas")
+	}
+	sg.update(sws)
+	checkScrapers()
+	if len(sg.m) <= ownedInitial {
+		t.Fatalf("expecting more than %d scrapers after replica #1 death; got %d", ownedInitial, len(sg.m))
+	}
+
+	// The replica #1 revives, so the current replica must stop scraping the targets moved back to it.
+	if !cm.setAlive([]bool{true, true, true}) {
+		t.Fatalf("expecting changed set of alive replicas")
+	}
+	sg.update(sws)
+	checkScrapers()
+	if len(sg.m) != ownedInitial {
+		t.Fatalf("unexpected number of scrapers after replica #1 revival; got %d; want %d", len(sg.m), ownedInitial)
+	}
+}
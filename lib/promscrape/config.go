@@ -154,6 +154,19 @@ func (cfg *Config) parse(data []byte, path string) error {
 	return nil
 }
 
+// getExternalLabels returns sorted labels from `global -> external_labels` section of cfg.
+func (cfg *Config) getExternalLabels() []prompbmarshal.Label {
+	var labels []prompbmarshal.Label
+	for k, v := range cfg.Global.ExternalLabels {
+		labels = append(labels, prompbmarshal.Label{
+			Name:  k,
+			Value: v,
+		})
+	}
+	promrelabel.SortLabels(labels)
+	return labels
+}
+
 func unmarshalMaybeStrict(data []byte, dst interface{}) error {
 	data = envtemplate.Replace(data)
 	var err error
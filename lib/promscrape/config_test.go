@@ -69,6 +69,39 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestGetExternalLabels(t *testing.T) {
+	f := func(data string, labelsExpected []prompbmarshal.Label) {
+		t.Helper()
+		var cfg Config
+		if err := cfg.parse([]byte(data), "sss"); err != nil {
+			t.Fatalf("cannot parse data: %s", err)
+		}
+		labels := cfg.getExternalLabels()
+		if !reflect.DeepEqual(labels, labelsExpected) {
+			t.Fatalf("unexpected labels;\ngot\n%+v\nwant\n%+v", labels, labelsExpected)
+		}
+	}
+	f(`
+scrape_configs:
+- job_name: foo
+`, nil)
+	f(`
+global:
+  external_labels:
+    region: eu
+    datacenter: foobar
+`, []prompbmarshal.Label{
+		{
+			Name:  "datacenter",
+			Value: "foobar",
+		},
+		{
+			Name:  "region",
+			Value: "eu",
+		},
+	})
+}
+
 func TestBlackboxExporter(t *testing.T) {
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/684
 	data := `
@@ -46,11 +46,26 @@ func CheckConfig() error {
 	return err
 }
 
+// GetExternalLabels returns labels from `global -> external_labels` section of -promscrape.config.
+//
+// Nil labels are returned if -promscrape.config isn't set.
+func GetExternalLabels() ([]prompbmarshal.Label, error) {
+	if *promscrapeConfigFile == "" {
+		return nil, nil
+	}
+	cfg, _, err := loadConfig(*promscrapeConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.getExternalLabels(), nil
+}
+
 // Init initializes Prometheus scraper with config from the `-promscrape.config`.
 //
 // Scraped data is passed to pushData.
 func Init(pushData func(wr *prompbmarshal.WriteRequest)) {
 	globalStopCh = make(chan struct{})
+	initClusterMembers()
 	scraperWG.Add(1)
 	go func() {
 		defer scraperWG.Done()
@@ -62,6 +77,7 @@ func Init(pushData func(wr *prompbmarshal.WriteRequest)) {
 func Stop() {
 	close(globalStopCh)
 	scraperWG.Wait()
+	stopClusterMembers()
 }
 
 var (
@@ -211,11 +227,20 @@ func (scfg *scrapeConfig) run() {
 		sg.update(sws)
 		swsPrev = sws
 
+	waitForChans:
+		var clusterChangeCh <-chan struct{}
+		if clusterMembersGlobal != nil {
+			clusterChangeCh = clusterMembersGlobal.getChangeCh()
+		}
 		select {
 		case <-scfg.stopCh:
 			return
 		case cfg = <-scfg.cfgCh:
 		case <-tickerCh:
+		case <-clusterChangeCh:
+			// Re-shard the previously discovered targets among alive vmagent replicas.
+			sg.update(swsPrev)
+			goto waitForChans
 		}
 	}
 }
@@ -261,15 +286,22 @@ func (sg *scraperGroup) update(sws []ScrapeWork) {
 
 	additionsCount := 0
 	deletionsCount := 0
+	keysSeen := make(map[string]bool, len(sws))
 	swsMap := make(map[string]bool, len(sws))
 	for i := range sws {
 		sw := &sws[i]
 		key := sw.key()
-		if swsMap[key] {
+		if keysSeen[key] {
 			logger.Errorf("skipping duplicate scrape target with identical labels; endpoint=%s, labels=%s; make sure service discovery and relabeling is set up properly",
 				sw.ScrapeURL, sw.LabelsString())
 			continue
 		}
+		keysSeen[key] = true
+		if clusterMembersGlobal != nil && !clusterMembersGlobal.isOwnTarget(key) {
+			// The target must be scraped by another vmagent replica.
+			// Do not put it into swsMap, so the existing scraper for it is stopped below.
+			continue
+		}
 		swsMap[key] = true
 		if sg.m[key] != nil {
 			// The scraper for the given key already exists.
@@ -289,7 +321,7 @@ func (sg *scraperGroup) update(sws []ScrapeWork) {
 		additionsCount++
 	}
 
-	// Stop deleted scrapers, which are missing in sws.
+	// Stop deleted scrapers, which are missing in sws or are owned by another vmagent replica.
 	for key, sc := range sg.m {
 		if !swsMap[key] {
 			close(sc.stopCh)
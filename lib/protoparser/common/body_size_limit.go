@@ -0,0 +1,82 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+var (
+	maxImportRequestSize = flagutil.NewBytes("import.maxRequestSize", 0, "The maximum size in bytes of a single request body accepted by /api/v1/import, "+
+		"/api/v1/import/csv, /api/v1/import/native and /api/v1/import/prometheus. Requests exceeding the limit are rejected with '413 Request Entity Too Large'. "+
+		"The size is checked before decompression. There is no limit if set to 0")
+	maxInfluxRequestSize = flagutil.NewBytes("influx.maxRequestSize", 0, "The maximum size in bytes of a single request body accepted by Influx /write and /api/v2/write. "+
+		"Requests exceeding the limit are rejected with '413 Request Entity Too Large'. The size is checked before decompression. There is no limit if set to 0")
+)
+
+// LimitImportRequestBody returns a reader for the request body r sent to /api/v1/import* handlers.
+//
+// The returned reader fails after reading more than -import.maxRequestSize bytes from r.
+func LimitImportRequestBody(r io.Reader) io.Reader {
+	return NewBodySizeLimitReader(r, maxImportRequestSize.N, "import.maxRequestSize")
+}
+
+// LimitInfluxRequestBody returns a reader for the request body r sent to Influx write handlers.
+//
+// The returned reader fails after reading more than -influx.maxRequestSize bytes from r.
+func LimitInfluxRequestBody(r io.Reader) io.Reader {
+	return NewBodySizeLimitReader(r, maxInfluxRequestSize.N, "influx.maxRequestSize")
+}
+
+// NewBodySizeLimitReader returns a reader, which returns an error after reading more than maxSize bytes from r.
+//
+// flagName must contain the name of the command-line flag for maxSize. It is mentioned in the returned error.
+// r is returned as is if maxSize <= 0.
+func NewBodySizeLimitReader(r io.Reader, maxSize int, flagName string) io.Reader {
+	if maxSize <= 0 {
+		return r
+	}
+	return &bodySizeLimitReader{
+		r:        r,
+		maxSize:  maxSize,
+		flagName: flagName,
+	}
+}
+
+type bodySizeLimitReader struct {
+	r        io.Reader
+	maxSize  int
+	flagName string
+	n        int
+}
+
+func (lr *bodySizeLimitReader) Read(p []byte) (int, error) {
+	if lr.n > lr.maxSize {
+		return 0, NewBodyTooBigError(lr.maxSize, lr.flagName)
+	}
+	// Allow reading a single byte above maxSize in order to detect too big body.
+	if remaining := lr.maxSize + 1 - lr.n; len(p) > remaining {
+		p = p[:remaining]
+	}
+	n, err := lr.r.Read(p)
+	lr.n += n
+	if lr.n > lr.maxSize {
+		// Drop the byte exceeding the limit.
+		return n - 1, NewBodyTooBigError(lr.maxSize, lr.flagName)
+	}
+	return n, err
+}
+
+// NewBodyTooBigError returns an error for request body exceeding maxSize bytes set via flagName command-line flag.
+//
+// The error is sent to client with '413 Request Entity Too Large' status code.
+func NewBodyTooBigError(maxSize int, flagName string) error {
+	return &httpserver.ErrorWithStatusCode{
+		Err: fmt.Errorf("too big request body; it mustn't exceed -%s=%d bytes; split the data into smaller requests or increase -%s",
+			flagName, maxSize, flagName),
+		StatusCode: http.StatusRequestEntityTooLarge,
+	}
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+func TestBodySizeLimitReaderSuccess(t *testing.T) {
+	f := func(s string, maxSize int) {
+		t.Helper()
+		r := NewBodySizeLimitReader(bytes.NewBufferString(s), maxSize, "foo")
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(data) != s {
+			t.Fatalf("unexpected data read; got %q; want %q", data, s)
+		}
+	}
+
+	f("", 0)
+	f("foobar", 0)
+	f("foobar", -1)
+	f("", 1)
+	f("foobar", 6)
+	f("foobar", 100)
+}
+
+func TestBodySizeLimitReaderFailure(t *testing.T) {
+	f := func(s string, maxSize int) {
+		t.Helper()
+		r := NewBodySizeLimitReader(bytes.NewBufferString(s), maxSize, "foo")
+		data, err := ioutil.ReadAll(r)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		var esc *httpserver.ErrorWithStatusCode
+		if !errors.As(err, &esc) {
+			t.Fatalf("expecting httpserver.ErrorWithStatusCode; got %T", err)
+		}
+		if esc.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("unexpected status code; got %d; want %d", esc.StatusCode, http.StatusRequestEntityTooLarge)
+		}
+		if len(data) > maxSize {
+			t.Fatalf("too much data read; got %d bytes; want up to %d bytes", len(data), maxSize)
+		}
+
+		// Subsequent reads must fail too.
+		if _, err := r.Read(make([]byte, 10)); err == nil {
+			t.Fatalf("expecting non-nil error on subsequent read")
+		}
+	}
+
+	f("foobar", 1)
+	f("foobar", 5)
+
+	// Lines reader must fail too.
+	r := NewBodySizeLimitReader(bytes.NewBufferString("foo\nbar\nbaz\n"), 5, "foo")
+	var err error
+	for err == nil {
+		_, _, err = ReadLinesBlock(r, nil, nil)
+	}
+	var esc *httpserver.ErrorWithStatusCode
+	if !errors.As(err, &esc) {
+		t.Fatalf("expecting httpserver.ErrorWithStatusCode from ReadLinesBlock; got %v", err)
+	}
+}
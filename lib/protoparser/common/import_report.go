@@ -0,0 +1,138 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var maxReportedErrors = flag.Int("import.maxReportedErrors", 10, "The maximum number of parse errors to return in the response for import requests with `report=1` query arg")
+
+// IsImportReportRequested returns true if req contains `report=1` query arg.
+func IsImportReportRequested(req *http.Request) bool {
+	return req.URL.Query().Get("report") == "1"
+}
+
+// ImportReport tracks the progress of a single import request.
+//
+// It generates a JSON line with accepted/rejected line counts for each processed chunk
+// and a final JSON line with the totals and the first parse errors.
+//
+// The report is sent to the client by Finish call, since the request body cannot be read
+// after the response is started.
+type ImportReport struct {
+	w io.Writer
+
+	maxErrors int
+
+	linesRead     int
+	acceptedLines int
+	rejectedLines int
+	chunks        int
+
+	chunkRejectedLines int
+
+	errors []importError
+
+	buf []byte
+}
+
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// NewImportReport returns new ImportReport, which writes the report to w.
+func NewImportReport(w io.Writer) *ImportReport {
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rw.Header().Set("Content-Type", "application/json")
+	}
+	return &ImportReport{
+		w:         w,
+		maxErrors: *maxReportedErrors,
+	}
+}
+
+// LogError registers parse error s for the line with the given 1-based number inside the current chunk.
+func (ir *ImportReport) LogError(line int, s string) {
+	ir.chunkRejectedLines++
+	if len(ir.errors) >= ir.maxErrors {
+		return
+	}
+	ir.errors = append(ir.errors, importError{
+		Line:  ir.linesRead + line,
+		Error: s,
+	})
+}
+
+// FinishChunk must be called after the chunk data is successfully ingested.
+//
+// data must contain the chunk lines without the trailing newline.
+func (ir *ImportReport) FinishChunk(data []byte) {
+	lines := 0
+	if len(data) > 0 {
+		lines = bytes.Count(data, []byte("\n")) + 1
+	}
+	accepted := lines - ir.chunkRejectedLines
+	ir.chunks++
+	ir.write(&importChunkStatus{
+		Chunk:     ir.chunks,
+		FirstLine: ir.linesRead + 1,
+		Accepted:  accepted,
+		Rejected:  ir.chunkRejectedLines,
+	})
+	ir.linesRead += lines
+	ir.acceptedLines += accepted
+	ir.rejectedLines += ir.chunkRejectedLines
+	ir.chunkRejectedLines = 0
+}
+
+// Finish writes the final status line for the import request, which finished with the given err.
+func (ir *ImportReport) Finish(err error) {
+	fs := &importFinalStatus{
+		Status:   "success",
+		Accepted: ir.acceptedLines,
+		Rejected: ir.rejectedLines + ir.chunkRejectedLines,
+		Errors:   ir.errors,
+	}
+	if err != nil {
+		fs.Status = "error"
+		fs.Error = err.Error()
+	}
+	if fs.Errors == nil {
+		fs.Errors = []importError{}
+	}
+	ir.write(fs)
+	if _, err := ir.w.Write(ir.buf); err != nil {
+		// The client closed the connection. There is no need in logging this error.
+		return
+	}
+}
+
+type importChunkStatus struct {
+	Chunk     int `json:"chunk"`
+	FirstLine int `json:"firstLine"`
+	Accepted  int `json:"accepted"`
+	Rejected  int `json:"rejected"`
+}
+
+type importFinalStatus struct {
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   []importError `json:"errors"`
+}
+
+func (ir *ImportReport) write(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal import status: %s", err)
+	}
+	ir.buf = append(ir.buf, data...)
+	ir.buf = append(ir.buf, '\n')
+}
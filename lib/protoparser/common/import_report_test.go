@@ -0,0 +1,44 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestImportReport(t *testing.T) {
+	var bb bytes.Buffer
+	ir := NewImportReport(&bb)
+	ir.maxErrors = 2
+
+	// The first chunk with a single invalid line
+	ir.LogError(2, "error 1")
+	ir.FinishChunk([]byte("foo\nbar\nbaz"))
+
+	// The second chunk with two invalid lines
+	ir.LogError(1, "error 2")
+	ir.LogError(2, "error 3")
+	ir.FinishChunk([]byte("foo\nbar"))
+
+	ir.Finish(fmt.Errorf("cannot store \"data\""))
+
+	resultExpected := `{"chunk":1,"firstLine":1,"accepted":2,"rejected":1}
+{"chunk":2,"firstLine":4,"accepted":0,"rejected":2}
+{"status":"error","error":"cannot store \"data\"","accepted":2,"rejected":3,"errors":[{"line":2,"error":"error 1"},{"line":4,"error":"error 2"}]}
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected report;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// Successful import without errors
+	bb.Reset()
+	ir = NewImportReport(&bb)
+	ir.FinishChunk([]byte("foo"))
+	ir.Finish(nil)
+	resultExpected = `{"chunk":1,"firstLine":1,"accepted":1,"rejected":0}
+{"status":"success","accepted":1,"rejected":0,"errors":[]}
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected report;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
@@ -70,11 +70,22 @@ type metric struct {
 
 // Unmarshal unmarshal csv lines from s according to the given cds.
 func (rs *Rows) Unmarshal(s string, cds []ColumnDescriptor) {
+	rs.UnmarshalWithErrLogger(s, cds, stdErrLogger)
+}
+
+func stdErrLogger(line int, s string) {
+	logger.ErrorfSkipframes(1, "%s", s)
+}
+
+// UnmarshalWithErrLogger unmarshals csv lines from s according to the given cds.
+//
+// It calls errLogger for each invalid line. line is 1-based line number in s.
+func (rs *Rows) UnmarshalWithErrLogger(s string, cds []ColumnDescriptor, errLogger func(line int, s string)) {
 	rs.sc.Init(s)
-	rs.Rows, rs.tagsPool, rs.metricsPool = parseRows(&rs.sc, rs.Rows[:0], rs.tagsPool[:0], rs.metricsPool[:0], cds)
+	rs.Rows, rs.tagsPool, rs.metricsPool = parseRows(&rs.sc, rs.Rows[:0], rs.tagsPool[:0], rs.metricsPool[:0], cds, errLogger)
 }
 
-func parseRows(sc *scanner, dst []Row, tags []Tag, metrics []metric, cds []ColumnDescriptor) ([]Row, []Tag, []metric) {
+func parseRows(sc *scanner, dst []Row, tags []Tag, metrics []metric, cds []ColumnDescriptor, errLogger func(line int, s string)) ([]Row, []Tag, []metric) {
 	for sc.NextLine() {
 		line := sc.Line
 		var r Row
@@ -119,7 +130,7 @@ func parseRows(sc *scanner, dst []Row, tags []Tag, metrics []metric, cds []Colum
 			sc.Error = fmt.Errorf("missing columns in the csv line %q; got %d columns; want at least %d columns", line, col, len(cds))
 		}
 		if sc.Error != nil {
-			logger.Errorf("error when parsing csv line %q: %s; skipping this line", line, sc.Error)
+			errLogger(sc.LineNum, fmt.Sprintf("error when parsing csv line %q: %s; skipping this line", line, sc.Error))
 			invalidLines.Inc()
 			continue
 		}
@@ -25,6 +25,30 @@ func TestRowsUnmarshalFailure(t *testing.T) {
 	f("3:metric:aaa", "123,456")
 }
 
+func TestRowsUnmarshalWithErrLogger(t *testing.T) {
+	f := func(format, s string, linesExpected []int, rowsExpected int) {
+		t.Helper()
+		cds, err := ParseColumnDescriptors(format)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", format, err)
+		}
+		var lines []int
+		var rs Rows
+		rs.UnmarshalWithErrLogger(s, cds, func(line int, s string) {
+			lines = append(lines, line)
+		})
+		if !reflect.DeepEqual(lines, linesExpected) {
+			t.Fatalf("unexpected invalid lines; got %v; want %v", lines, linesExpected)
+		}
+		if len(rs.Rows) != rowsExpected {
+			t.Fatalf("unexpected number of rows; got %d; want %d", len(rs.Rows), rowsExpected)
+		}
+	}
+	f("1:metric:foo", "123", nil, 1)
+	f("1:metric:foo,2:time:rfc3339", "123,foobar", []int{1}, 0)
+	f("1:metric:foo,2:time:unix_s", "123,456\n\n123\n1,2\n3", []int{3, 5}, 2)
+}
+
 func TestRowsUnmarshalSuccess(t *testing.T) {
 	f := func(format, s string, rowsExpected []Row) {
 		t.Helper()
@@ -10,6 +10,9 @@ type scanner struct {
 	// The line value read after the call to NextLine()
 	Line string
 
+	// LineNum is 1-based number of Line in the scanned string.
+	LineNum int
+
 	// The column value read after the call to NextColumn()
 	Column string
 
@@ -23,6 +26,7 @@ type scanner struct {
 // Init initializes sc with s
 func (sc *scanner) Init(s string) {
 	sc.Line = ""
+	sc.LineNum = 0
 	sc.Column = ""
 	sc.Error = nil
 	sc.s = s
@@ -47,6 +51,7 @@ func (sc *scanner) NextLine() bool {
 			s = ""
 		}
 		sc.Line = line
+		sc.LineNum++
 		sc.s = s
 		if len(line) > 0 {
 			return true
@@ -25,13 +25,20 @@ var (
 //
 // callback shouldn't hold rows after returning.
 func ParseStream(req *http.Request, callback func(rows []Row) error) error {
+	return ParseStreamWithReport(req, callback, nil)
+}
+
+// ParseStreamWithReport is like ParseStream, but registers parse errors and per-chunk stats in ir.
+//
+// ir may be nil.
+func ParseStreamWithReport(req *http.Request, callback func(rows []Row) error, ir *common.ImportReport) error {
 	q := req.URL.Query()
 	format := q.Get("format")
 	cds, err := ParseColumnDescriptors(format)
 	if err != nil {
 		return fmt.Errorf("cannot parse the provided csv format: %w", err)
 	}
-	r := req.Body
+	r := common.LimitImportRequestBody(req.Body)
 	if req.Header.Get("Content-Encoding") == "gzip" {
 		zr, err := common.GetGzipReader(r)
 		if err != nil {
@@ -43,15 +50,18 @@ func ParseStream(req *http.Request, callback func(rows []Row) error) error {
 
 	ctx := getStreamContext()
 	defer putStreamContext(ctx)
-	for ctx.Read(r, cds) {
+	for ctx.Read(r, cds, ir) {
 		if err := callback(ctx.Rows.Rows); err != nil {
 			return err
 		}
+		if ir != nil {
+			ir.FinishChunk(ctx.reqBuf)
+		}
 	}
 	return ctx.Error()
 }
 
-func (ctx *streamContext) Read(r io.Reader, cds []ColumnDescriptor) bool {
+func (ctx *streamContext) Read(r io.Reader, cds []ColumnDescriptor, ir *common.ImportReport) bool {
 	readCalls.Inc()
 	if ctx.err != nil {
 		return false
@@ -64,7 +74,11 @@ func (ctx *streamContext) Read(r io.Reader, cds []ColumnDescriptor) bool {
 		}
 		return false
 	}
-	ctx.Rows.Unmarshal(bytesutil.ToUnsafeString(ctx.reqBuf), cds)
+	if ir != nil {
+		ctx.Rows.UnmarshalWithErrLogger(bytesutil.ToUnsafeString(ctx.reqBuf), cds, ir.LogError)
+	} else {
+		ctx.Rows.Unmarshal(bytesutil.ToUnsafeString(ctx.reqBuf), cds)
+	}
 	rowsRead.Add(len(ctx.Rows.Rows))
 
 	rows := ctx.Rows.Rows
@@ -0,0 +1,153 @@
+package native
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	// maxMetricNameSize is the maximum size of a marshaled metricName in native block.
+	maxMetricNameSize = 1024 * 1024
+
+	// maxBlockSize is the maximum size of a marshaled native block.
+	maxBlockSize = 16 * 1024 * 1024
+)
+
+// ParseStream parses /api/v1/import/native blocks from req and calls callback for the parsed blocks.
+//
+// The callback can be called multiple times for streamed data from req.
+//
+// callback shouldn't hold block after returning.
+func ParseStream(req *http.Request, callback func(block *Block) error) error {
+	r := common.LimitImportRequestBody(req.Body)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := common.GetGzipReader(r)
+		if err != nil {
+			return fmt.Errorf("cannot read gzipped native data: %w", err)
+		}
+		defer common.PutGzipReader(zr)
+		r = zr
+	}
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	// Read time range (tr)
+	trBuf := make([]byte, 16)
+	if _, err := io.ReadFull(br, trBuf); err != nil {
+		readErrors.Inc()
+		return fmt.Errorf("cannot read time range: %w", err)
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: encoding.UnmarshalInt64(trBuf),
+		MaxTimestamp: encoding.UnmarshalInt64(trBuf[8:]),
+	}
+
+	// Read native blocks.
+	var block Block
+	var tmpBlock storage.Block
+	var buf []byte
+	sizeBuf := make([]byte, 4)
+	for {
+		readCalls.Inc()
+
+		// Read metricName
+		if _, err := io.ReadFull(br, sizeBuf); err != nil {
+			if err == io.EOF {
+				// End of stream
+				return nil
+			}
+			readErrors.Inc()
+			return fmt.Errorf("cannot read metricName size: %w", err)
+		}
+		bufSize := encoding.UnmarshalUint32(sizeBuf)
+		if bufSize > maxMetricNameSize {
+			parseErrors.Inc()
+			return fmt.Errorf("too big metricName size; got %d; shouldn't exceed %d", bufSize, maxMetricNameSize)
+		}
+		buf = bytesutil.Resize(buf, int(bufSize))
+		if _, err := io.ReadFull(br, buf); err != nil {
+			readErrors.Inc()
+			return fmt.Errorf("cannot read metricName with size %d bytes: %w", bufSize, err)
+		}
+		if err := block.MetricName.Unmarshal(buf); err != nil {
+			parseErrors.Inc()
+			return fmt.Errorf("cannot unmarshal metricName from %d bytes: %w", bufSize, err)
+		}
+
+		// Read block
+		if _, err := io.ReadFull(br, sizeBuf); err != nil {
+			readErrors.Inc()
+			return fmt.Errorf("cannot read native block size: %w", err)
+		}
+		bufSize = encoding.UnmarshalUint32(sizeBuf)
+		if bufSize > maxBlockSize {
+			parseErrors.Inc()
+			return fmt.Errorf("too big native block size; got %d; shouldn't exceed %d", bufSize, maxBlockSize)
+		}
+		buf = bytesutil.Resize(buf, int(bufSize))
+		if _, err := io.ReadFull(br, buf); err != nil {
+			readErrors.Inc()
+			return fmt.Errorf("cannot read native block with size %d bytes: %w", bufSize, err)
+		}
+		tail, err := tmpBlock.UnmarshalPortable(buf)
+		if err != nil {
+			parseErrors.Inc()
+			return fmt.Errorf("cannot unmarshal native block from %d bytes: %w", bufSize, err)
+		}
+		if len(tail) > 0 {
+			parseErrors.Inc()
+			return fmt.Errorf("unexpected non-empty tail left after unmarshaling native block from %d bytes; len(tail)=%d bytes", bufSize, len(tail))
+		}
+		block.initFrom(&tmpBlock, tr)
+		blocksRead.Inc()
+		rowsRead.Add(len(block.Timestamps))
+		if len(block.Timestamps) == 0 {
+			// Skip blocks without rows on the given time range.
+			continue
+		}
+		if err := callback(&block); err != nil {
+			return err
+		}
+	}
+}
+
+// Block is a single block from `/api/v1/import/native` request.
+type Block struct {
+	MetricName storage.MetricName
+	Values     []float64
+	Timestamps []int64
+}
+
+func (b *Block) initFrom(src *storage.Block, tr storage.TimeRange) {
+	timestamps := src.Timestamps()
+	values := src.Values()
+
+	// Skip rows outside the time range, since the exported block may contain them.
+	i := 0
+	for i < len(timestamps) && timestamps[i] < tr.MinTimestamp {
+		i++
+	}
+	j := len(timestamps)
+	for j > i && timestamps[j-1] > tr.MaxTimestamp {
+		j--
+	}
+
+	b.Timestamps = append(b.Timestamps[:0], timestamps[i:j]...)
+	b.Values = decimal.AppendDecimalToFloat(b.Values[:0], values[i:j], src.Scale())
+}
+
+var (
+	readCalls   = metrics.NewCounter(`vm_protoparser_read_calls_total{type="native"}`)
+	readErrors  = metrics.NewCounter(`vm_protoparser_read_errors_total{type="native"}`)
+	rowsRead    = metrics.NewCounter(`vm_protoparser_rows_read_total{type="native"}`)
+	blocksRead  = metrics.NewCounter(`vm_protoparser_blocks_read_total{type="native"}`)
+	parseErrors = metrics.NewCounter(`vm_protoparser_parse_errors_total{type="native"}`)
+)
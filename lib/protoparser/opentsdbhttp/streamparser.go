@@ -52,7 +52,7 @@ func ParseStream(req *http.Request, callback func(rows []Row) error) error {
 	}
 	if reqLen > int64(maxInsertRequestSize.N) {
 		readErrors.Inc()
-		return fmt.Errorf("too big HTTP OpenTSDB request; mustn't exceed `-opentsdbhttp.maxInsertRequestSize=%d` bytes", maxInsertRequestSize.N)
+		return fmt.Errorf("too big HTTP OpenTSDB request: %w", common.NewBodyTooBigError(maxInsertRequestSize.N, "opentsdbhttp.maxInsertRequestSize"))
 	}
 
 	// Unmarshal the request to ctx.Rows
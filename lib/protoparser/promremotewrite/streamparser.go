@@ -10,6 +10,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/golang/snappy"
 )
@@ -101,7 +102,7 @@ func readSnappy(dst []byte, r io.Reader) ([]byte, error) {
 		return dst, fmt.Errorf("cannot read compressed request: %w", err)
 	}
 	if reqLen > int64(maxInsertRequestSize.N) {
-		return dst, fmt.Errorf("too big packed request; mustn't exceed `-maxInsertRequestSize=%d` bytes", maxInsertRequestSize.N)
+		return dst, fmt.Errorf("too big packed request: %w", common.NewBodyTooBigError(maxInsertRequestSize.N, "maxInsertRequestSize"))
 	}
 
 	buf := dst[len(dst):cap(dst)]
@@ -112,7 +113,7 @@ func readSnappy(dst []byte, r io.Reader) ([]byte, error) {
 		return dst, err
 	}
 	if len(buf) > maxInsertRequestSize.N {
-		return dst, fmt.Errorf("too big unpacked request; mustn't exceed `-maxInsertRequestSize=%d` bytes; got %d bytes", maxInsertRequestSize.N, len(buf))
+		return dst, fmt.Errorf("too big unpacked request with %d bytes: %w", len(buf), common.NewBodyTooBigError(maxInsertRequestSize.N, "maxInsertRequestSize"))
 	}
 	if len(buf) > 0 && len(dst) < cap(dst) && &buf[0] == &dst[len(dst):cap(dst)][0] {
 		dst = dst[:len(dst)+len(buf)]
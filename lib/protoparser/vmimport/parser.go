@@ -32,8 +32,21 @@ func (rs *Rows) Reset() {
 //
 // s shouldn't be modified when rs is in use.
 func (rs *Rows) Unmarshal(s string) {
+	rs.UnmarshalWithErrLogger(s, stdErrLogger)
+}
+
+func stdErrLogger(line int, s string) {
+	logger.ErrorfSkipframes(1, "%s", s)
+}
+
+// UnmarshalWithErrLogger unmarshals rows from s.
+//
+// It calls errLogger for each invalid line. line is 1-based line number in s.
+//
+// s shouldn't be modified when rs is in use.
+func (rs *Rows) UnmarshalWithErrLogger(s string, errLogger func(line int, s string)) {
 	rs.tu.reset()
-	rs.Rows = unmarshalRows(rs.Rows[:0], s, &rs.tu)
+	rs.Rows = unmarshalRows(rs.Rows[:0], s, &rs.tu, errLogger)
 }
 
 // Row is a single row from `/api/v1/import` request.
@@ -165,20 +178,22 @@ func (tu *tagsUnmarshaler) unmarshalTags(o *fastjson.Object) error {
 	return tu.err
 }
 
-func unmarshalRows(dst []Row, s string, tu *tagsUnmarshaler) []Row {
+func unmarshalRows(dst []Row, s string, tu *tagsUnmarshaler, errLogger func(line int, s string)) []Row {
+	line := 1
 	for len(s) > 0 {
 		n := strings.IndexByte(s, '\n')
 		if n < 0 {
 			// The last line.
-			return unmarshalRow(dst, s, tu)
+			return unmarshalRow(dst, s, tu, line, errLogger)
 		}
-		dst = unmarshalRow(dst, s[:n], tu)
+		dst = unmarshalRow(dst, s[:n], tu, line, errLogger)
 		s = s[n+1:]
+		line++
 	}
 	return dst
 }
 
-func unmarshalRow(dst []Row, s string, tu *tagsUnmarshaler) []Row {
+func unmarshalRow(dst []Row, s string, tu *tagsUnmarshaler, line int, errLogger func(line int, s string)) []Row {
 	if len(s) > 0 && s[len(s)-1] == '\r' {
 		s = s[:len(s)-1]
 	}
@@ -193,7 +208,7 @@ func unmarshalRow(dst []Row, s string, tu *tagsUnmarshaler) []Row {
 	r := &dst[len(dst)-1]
 	if err := r.unmarshal(s, tu); err != nil {
 		dst = dst[:len(dst)-1]
-		logger.Errorf("cannot unmarshal json line %q: %s; skipping it", s, err)
+		errLogger(line, fmt.Sprintf("cannot unmarshal json line %q: %s; skipping it", s, err))
 		invalidLines.Inc()
 	}
 	return dst
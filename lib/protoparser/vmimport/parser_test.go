@@ -227,3 +227,27 @@ garbage here
 		},
 	})
 }
+
+func TestRowsUnmarshalWithErrLogger(t *testing.T) {
+	f := func(s string, linesExpected []int, rowsExpected int) {
+		t.Helper()
+		var lines []int
+		var rows Rows
+		rows.UnmarshalWithErrLogger(s, func(line int, s string) {
+			lines = append(lines, line)
+		})
+		if !reflect.DeepEqual(lines, linesExpected) {
+			t.Fatalf("unexpected invalid lines; got %v; want %v", lines, linesExpected)
+		}
+		if len(rows.Rows) != rowsExpected {
+			t.Fatalf("unexpected number of rows; got %d; want %d", len(rows.Rows), rowsExpected)
+		}
+	}
+	f(`{"metric":{"__name__":"foo"},"values":[1],"timestamps":[2]}`, nil, 1)
+	f("foo", []int{1}, 0)
+	f(`{"metric":{"__name__":"foo"},"values":[1],"timestamps":[2]}
+
+bar
+{"metric":{"__name__":"foo"},"values":[1],"timestamps":[2]}
+{"metric":{"__name__":"foo"},"values":[1,2],"timestamps":[2]}`, []int{3, 5}, 2)
+}
@@ -21,7 +21,14 @@ var maxLineLen = flagutil.NewBytes("import.maxLineLen", 100*1024*1024, "The maxi
 //
 // callback shouldn't hold rows after returning.
 func ParseStream(req *http.Request, callback func(rows []Row) error) error {
-	r := req.Body
+	return ParseStreamWithReport(req, callback, nil)
+}
+
+// ParseStreamWithReport is like ParseStream, but registers parse errors and per-chunk stats in ir.
+//
+// ir may be nil.
+func ParseStreamWithReport(req *http.Request, callback func(rows []Row) error, ir *common.ImportReport) error {
+	r := common.LimitImportRequestBody(req.Body)
 	if req.Header.Get("Content-Encoding") == "gzip" {
 		zr, err := common.GetGzipReader(r)
 		if err != nil {
@@ -33,15 +40,18 @@ func ParseStream(req *http.Request, callback func(rows []Row) error) error {
 
 	ctx := getStreamContext()
 	defer putStreamContext(ctx)
-	for ctx.Read(r) {
+	for ctx.Read(r, ir) {
 		if err := callback(ctx.Rows.Rows); err != nil {
 			return err
 		}
+		if ir != nil {
+			ir.FinishChunk(ctx.reqBuf)
+		}
 	}
 	return ctx.Error()
 }
 
-func (ctx *streamContext) Read(r io.Reader) bool {
+func (ctx *streamContext) Read(r io.Reader, ir *common.ImportReport) bool {
 	readCalls.Inc()
 	if ctx.err != nil {
 		return false
@@ -54,7 +64,11 @@ func (ctx *streamContext) Read(r io.Reader) bool {
 		}
 		return false
 	}
-	ctx.Rows.Unmarshal(bytesutil.ToUnsafeString(ctx.reqBuf))
+	if ir != nil {
+		ctx.Rows.UnmarshalWithErrLogger(bytesutil.ToUnsafeString(ctx.reqBuf), ir.LogError)
+	} else {
+		ctx.Rows.Unmarshal(bytesutil.ToUnsafeString(ctx.reqBuf))
+	}
 	rowsRead.Add(len(ctx.Rows.Rows))
 	return true
 }
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"fmt"
+	"math"
 	"sync"
 	"sync/atomic"
 
@@ -288,3 +290,123 @@ func (b *Block) UnmarshalData() error {
 
 	return nil
 }
+
+// MarshalPortable marshals b to dst, so it could be portably migrated to other VictoriaMetrics instance.
+//
+// The marshaled value must be unmarshaled with UnmarshalPortable function.
+func (b *Block) MarshalPortable(dst []byte) []byte {
+	b.MarshalData(0, 0)
+
+	dst = encoding.MarshalVarInt64(dst, b.bh.MinTimestamp)
+	dst = encoding.MarshalVarInt64(dst, b.bh.MaxTimestamp)
+	dst = encoding.MarshalVarInt64(dst, b.bh.FirstValue)
+	dst = encoding.MarshalVarUint64(dst, uint64(b.bh.RowsCount))
+	dst = encoding.MarshalVarInt64(dst, int64(b.bh.Scale))
+	dst = append(dst, byte(b.bh.TimestampsMarshalType), byte(b.bh.ValuesMarshalType), b.bh.PrecisionBits)
+	dst = encoding.MarshalBytes(dst, b.timestampsData)
+	dst = encoding.MarshalBytes(dst, b.valuesData)
+
+	return dst
+}
+
+// UnmarshalPortable unmarshals block from src to b and returns the remaining tail.
+//
+// It is assumed that the block has been marshaled with MarshalPortable.
+// The returned block is unmarshaled, i.e. its Timestamps and Values may be read.
+func (b *Block) UnmarshalPortable(src []byte) ([]byte, error) {
+	b.Reset()
+
+	// Read header
+	src, minTimestamp, err := encoding.UnmarshalVarInt64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal minTimestamp: %w", err)
+	}
+	b.bh.MinTimestamp = minTimestamp
+	src, maxTimestamp, err := encoding.UnmarshalVarInt64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal maxTimestamp: %w", err)
+	}
+	b.bh.MaxTimestamp = maxTimestamp
+	src, firstValue, err := encoding.UnmarshalVarInt64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal firstValue: %w", err)
+	}
+	b.bh.FirstValue = firstValue
+	src, rowsCount, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal rowsCount: %w", err)
+	}
+	if rowsCount == 0 || rowsCount > maxRowsPerBlock {
+		return src, fmt.Errorf("rowsCount must be in the range [1...%d]; got %d", maxRowsPerBlock, rowsCount)
+	}
+	b.bh.RowsCount = uint32(rowsCount)
+	src, scale, err := encoding.UnmarshalVarInt64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal scale: %w", err)
+	}
+	if scale < math.MinInt16 || scale > math.MaxInt16 {
+		return src, fmt.Errorf("scale must be in the range [%d...%d]; got %d", math.MinInt16, math.MaxInt16, scale)
+	}
+	b.bh.Scale = int16(scale)
+	if len(src) < 3 {
+		return src, fmt.Errorf("cannot unmarshal marshal types and precisionBits from %d bytes; need at least 3 bytes", len(src))
+	}
+	b.bh.TimestampsMarshalType = encoding.MarshalType(src[0])
+	b.bh.ValuesMarshalType = encoding.MarshalType(src[1])
+	b.bh.PrecisionBits = src[2]
+	src = src[3:]
+	if err := encoding.CheckMarshalType(b.bh.TimestampsMarshalType); err != nil {
+		return src, fmt.Errorf("unsupported timestampsMarshalType: %w", err)
+	}
+	if err := encoding.CheckMarshalType(b.bh.ValuesMarshalType); err != nil {
+		return src, fmt.Errorf("unsupported valuesMarshalType: %w", err)
+	}
+	if err := encoding.CheckPrecisionBits(b.bh.PrecisionBits); err != nil {
+		return src, err
+	}
+
+	// Read data
+	src, timestampsData, err := encoding.UnmarshalBytes(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot read timestampsData: %w", err)
+	}
+	b.timestampsData = append(b.timestampsData[:0], timestampsData...)
+	b.bh.TimestampsBlockSize = uint32(len(b.timestampsData))
+	src, valuesData, err := encoding.UnmarshalBytes(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot read valuesData: %w", err)
+	}
+	b.valuesData = append(b.valuesData[:0], valuesData...)
+	b.bh.ValuesBlockSize = uint32(len(b.valuesData))
+
+	if err := b.UnmarshalData(); err != nil {
+		return src, fmt.Errorf("cannot unmarshal block data: %w", err)
+	}
+	return src, nil
+}
+
+// KeepRowsInTimeRange leaves only rows on the given tr in b.
+//
+// It returns the number of remaining rows. b mustn't be marshaled if zero is returned.
+func (b *Block) KeepRowsInTimeRange(tr TimeRange) (int, error) {
+	if len(b.values) == 0 && b.bh.MinTimestamp >= tr.MinTimestamp && b.bh.MaxTimestamp <= tr.MaxTimestamp {
+		// Fast path - all the rows are on the tr.
+		return int(b.bh.RowsCount), nil
+	}
+	if err := b.UnmarshalData(); err != nil {
+		return 0, err
+	}
+	timestamps := b.timestamps[b.nextIdx:]
+	i := 0
+	for i < len(timestamps) && timestamps[i] < tr.MinTimestamp {
+		i++
+	}
+	j := len(timestamps)
+	for j > i && timestamps[j-1] > tr.MaxTimestamp {
+		j--
+	}
+	b.timestamps = append(b.timestamps[:0], timestamps[i:j]...)
+	b.values = append(b.values[:0], b.values[b.nextIdx+i:b.nextIdx+j]...)
+	b.nextIdx = 0
+	return len(b.values), nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/filestream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
 )
 
 // blockStreamReader represents block stream reader.
@@ -183,6 +184,13 @@ func (bsr *blockStreamReader) InitFromFilePart(path string) error {
 	return nil
 }
 
+// throttle limits the read bandwidth for bsr initialized via InitFromFilePart with l.
+func (bsr *blockStreamReader) throttle(l *mergethrottle.Limiter) {
+	bsr.timestampsReader = l.NewReader(bsr.timestampsReader.(filestream.ReadCloser))
+	bsr.valuesReader = l.NewReader(bsr.valuesReader.(filestream.ReadCloser))
+	bsr.indexReader = l.NewReader(bsr.indexReader)
+}
+
 // MustClose closes the bsr.
 //
 // It closes *Reader files passed to Init.
@@ -11,6 +11,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/filestream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
 )
 
 // blockStreamWriter represents block stream writer.
@@ -38,6 +39,10 @@ type blockStreamWriter struct {
 
 	metaindexData           []byte
 	compressedMetaindexData []byte
+
+	// unpackBlocksForDedup is set if all the written blocks must be de-duplicated,
+	// including blocks, which weren't unpacked during the merge.
+	unpackBlocksForDedup bool
 }
 
 func (bsw *blockStreamWriter) assertWriteClosers() {
@@ -66,6 +71,8 @@ func (bsw *blockStreamWriter) reset() {
 
 	bsw.metaindexData = bsw.metaindexData[:0]
 	bsw.compressedMetaindexData = bsw.compressedMetaindexData[:0]
+
+	bsw.unpackBlocksForDedup = false
 }
 
 // InitFromInmemoryPart initialzes bsw from inmemory part.
@@ -146,6 +153,20 @@ func (bsw *blockStreamWriter) InitFromFilePart(path string, nocache bool, compre
 	return nil
 }
 
+// throttle limits the write bandwidth for bsw initialized via InitFromFilePart with l.
+func (bsw *blockStreamWriter) throttle(l *mergethrottle.Limiter) {
+	bsw.timestampsWriter = l.NewWriter(bsw.timestampsWriter.(filestream.WriteCloser))
+	bsw.valuesWriter = l.NewWriter(bsw.valuesWriter.(filestream.WriteCloser))
+	bsw.indexWriter = l.NewWriter(bsw.indexWriter)
+}
+
+// unpackForDedup makes bsw to unpack and de-duplicate all the written blocks.
+//
+// By default only blocks unpacked during the merge are de-duplicated.
+func (bsw *blockStreamWriter) unpackForDedup() {
+	bsw.unpackBlocksForDedup = true
+}
+
 // MustClose closes the bsw.
 //
 // It closes *Writer files passed to Init*.
@@ -175,6 +196,11 @@ func (bsw *blockStreamWriter) MustClose() {
 // WriteExternalBlock writes b to bsw and updates ph and rowsMerged.
 func (bsw *blockStreamWriter) WriteExternalBlock(b *Block, ph *partHeader, rowsMerged *uint64) {
 	atomic.AddUint64(rowsMerged, uint64(b.rowsCount()))
+	if bsw.unpackBlocksForDedup && len(b.values) == 0 {
+		if err := b.UnmarshalData(); err != nil {
+			logger.Panicf("FATAL: cannot unmarshal block for de-duplication in %q: %s", bsw.path, err)
+		}
+	}
 	b.deduplicateSamplesDuringMerge()
 	headerData, timestampsData, valuesData := b.MarshalData(bsw.timestampsBlockOffset, bsw.valuesBlockOffset)
 
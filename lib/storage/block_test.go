@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestBlockMarshalUnmarshalPortable(t *testing.T) {
+	var b Block
+	for i := 0; i < 1000; i++ {
+		b.Reset()
+		rowsCount := rand.Intn(maxRowsPerBlock) + 1
+		b.timestamps = getRandTimestamps(rowsCount)
+		b.values = getRandValues(rowsCount)
+		b.bh.Scale = int16(rand.Intn(30) - 15)
+		b.bh.PrecisionBits = 64
+		testBlockMarshalUnmarshalPortable(t, &b)
+	}
+}
+
+func testBlockMarshalUnmarshalPortable(t *testing.T, b *Block) {
+	t.Helper()
+
+	var b1, b2 Block
+	b1.CopyFrom(b)
+	rowsCount := len(b.values)
+	data := b1.MarshalPortable(nil)
+	if b1.bh.RowsCount != uint32(rowsCount) {
+		t.Fatalf("unexpected number of rows marshaled; got %d; want %d", b1.bh.RowsCount, rowsCount)
+	}
+	tail, err := b2.UnmarshalPortable(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tail) > 0 {
+		t.Fatalf("unexpected non-empty tail: %X", tail)
+	}
+	if !reflect.DeepEqual(b.timestamps, b2.timestamps) {
+		t.Fatalf("unexpected timestamps; got\n%v\nwant\n%v", b2.timestamps, b.timestamps)
+	}
+	if !reflect.DeepEqual(b.values, b2.values) {
+		t.Fatalf("unexpected values; got\n%v\nwant\n%v", b2.values, b.values)
+	}
+	if b.bh.Scale != b2.bh.Scale {
+		t.Fatalf("unexpected scale; got %d; want %d", b2.bh.Scale, b.bh.Scale)
+	}
+
+	// Verify that the marshaled data can be appended to the existing prefix.
+	prefix := []byte("prefix")
+	b1.CopyFrom(b)
+	dataWithPrefix := b1.MarshalPortable(prefix)
+	if string(dataWithPrefix[:len(prefix)]) != string(prefix) {
+		t.Fatalf("unexpected prefix; got %q; want %q", dataWithPrefix[:len(prefix)], prefix)
+	}
+	if string(dataWithPrefix[len(prefix):]) != string(data) {
+		t.Fatalf("unexpected data after the prefix; got %X; want %X", dataWithPrefix[len(prefix):], data)
+	}
+}
+
+func getRandTimestamps(n int) []int64 {
+	timestamps := make([]int64, n)
+	ts := int64(rand.Intn(1e12))
+	for i := 0; i < n; i++ {
+		timestamps[i] = ts
+		ts += int64(rand.Intn(1e5))
+	}
+	return timestamps
+}
+
+func getRandValues(n int) []int64 {
+	values := make([]int64, n)
+	for i := 0; i < n; i++ {
+		values[i] = int64(rand.Intn(1e6))
+	}
+	return values
+}
+
+func TestBlockKeepRowsInTimeRange(t *testing.T) {
+	f := func(tr TimeRange, timestampsExpected []int64) {
+		t.Helper()
+		var b Block
+		b.Init(&TSID{}, []int64{10, 20, 30, 40}, []int64{1, 2, 3, 4}, 0, 64)
+		b.MarshalData(0, 0)
+		n, err := b.KeepRowsInTimeRange(tr)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n != len(timestampsExpected) {
+			t.Fatalf("unexpected number of rows; got %d; want %d", n, len(timestampsExpected))
+		}
+		if n == 0 {
+			return
+		}
+		var b2 Block
+		if _, err := b2.UnmarshalPortable(b.MarshalPortable(nil)); err != nil {
+			t.Fatalf("cannot unmarshal block: %s", err)
+		}
+		if !reflect.DeepEqual(b2.Timestamps(), timestampsExpected) {
+			t.Fatalf("unexpected timestamps; got %v; want %v", b2.Timestamps(), timestampsExpected)
+		}
+	}
+	f(TimeRange{MinTimestamp: 0, MaxTimestamp: 100}, []int64{10, 20, 30, 40})
+	f(TimeRange{MinTimestamp: 20, MaxTimestamp: 30}, []int64{20, 30})
+	f(TimeRange{MinTimestamp: 15, MaxTimestamp: 100}, []int64{20, 30, 40})
+	f(TimeRange{MinTimestamp: 0, MaxTimestamp: 10}, []int64{10})
+	f(TimeRange{MinTimestamp: 41, MaxTimestamp: 100}, nil)
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+)
+
+var maxDataBlocksCacheSize int64
+
+// SetDataBlocksCacheSize sets the maximum size in bytes for the cache of decompressed data blocks.
+//
+// The cache is disabled if maxSize <= 0.
+func SetDataBlocksCacheSize(maxSize int) {
+	atomic.StoreInt64(&maxDataBlocksCacheSize, int64(maxSize))
+}
+
+// partIDCounter is used for generating unique part ids, which are used as a part of dataBlockCache keys.
+//
+// Ids of closed parts are never re-used, so cache entries for merged parts cannot be returned for newly created parts.
+var partIDCounter uint64
+
+func nextPartID() uint64 {
+	return atomic.AddUint64(&partIDCounter, 1)
+}
+
+// dbc caches decompressed data blocks, so frequently executed queries
+// over the same time series don't read and decompress the same blocks again.
+var dbc = newDataBlockCache()
+
+type dataBlockCacheKey struct {
+	partID                uint64
+	timestampsBlockOffset uint64
+}
+
+type dataBlockCache struct {
+	// Put atomic counters to the top of struct in order to align them to 8 bytes on 32-bit architectures.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212
+	requests  uint64
+	misses    uint64
+	sizeBytes uint64
+
+	m  map[dataBlockCacheKey]*dataBlockCacheEntry
+	mu sync.RWMutex
+}
+
+type dataBlockCacheEntry struct {
+	// Atomically updated counters must go first in the struct, so they are properly
+	// aligned to 8 bytes on 32-bit architectures.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212
+	lastAccessTime uint64
+
+	// timestamps and values mustn't be modified, since they may be used by concurrent goroutines.
+	timestamps []int64
+	values     []int64
+}
+
+func (dbe *dataBlockCacheEntry) SizeBytes() uint64 {
+	return uint64(8*(len(dbe.timestamps)+len(dbe.values))) + 64
+}
+
+func newDataBlockCache() *dataBlockCache {
+	var c dataBlockCache
+	c.m = make(map[dataBlockCacheKey]*dataBlockCacheEntry)
+	go c.cleaner()
+	return &c
+}
+
+// cleaner periodically cleans least recently used items.
+//
+// Entries for closed parts are never accessed, so they are removed by the cleaner.
+func (c *dataBlockCache) cleaner() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.cleanByTimeout()
+	}
+}
+
+func (c *dataBlockCache) cleanByTimeout() {
+	currentTime := fasttime.UnixTimestamp()
+	c.mu.Lock()
+	for k, dbe := range c.m {
+		// Delete items accessed more than 5 minutes ago.
+		if currentTime-atomic.LoadUint64(&dbe.lastAccessTime) > 5*60 {
+			c.deleteLocked(k, dbe)
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *dataBlockCache) deleteLocked(k dataBlockCacheKey, dbe *dataBlockCacheEntry) {
+	delete(c.m, k)
+	atomic.AddUint64(&c.sizeBytes, ^(dbe.SizeBytes() - 1))
+}
+
+// Get returns the cached entry for k.
+//
+// nil is returned if the cache is disabled or if it doesn't contain k.
+func (c *dataBlockCache) Get(k dataBlockCacheKey) *dataBlockCacheEntry {
+	if atomic.LoadInt64(&maxDataBlocksCacheSize) <= 0 {
+		return nil
+	}
+	atomic.AddUint64(&c.requests, 1)
+
+	c.mu.RLock()
+	dbe := c.m[k]
+	c.mu.RUnlock()
+
+	if dbe != nil {
+		currentTime := fasttime.UnixTimestamp()
+		if atomic.LoadUint64(&dbe.lastAccessTime) != currentTime {
+			atomic.StoreUint64(&dbe.lastAccessTime, currentTime)
+		}
+		return dbe
+	}
+	atomic.AddUint64(&c.misses, 1)
+	return nil
+}
+
+// Put stores copies of timestamps and values under k in the cache.
+func (c *dataBlockCache) Put(k dataBlockCacheKey, timestamps, values []int64) {
+	maxSize := atomic.LoadInt64(&maxDataBlocksCacheSize)
+	if maxSize <= 0 {
+		return
+	}
+	dbe := &dataBlockCacheEntry{
+		lastAccessTime: fasttime.UnixTimestamp(),
+		timestamps:     append([]int64{}, timestamps...),
+		values:         append([]int64{}, values...),
+	}
+	entrySize := dbe.SizeBytes()
+	if entrySize > uint64(maxSize)/16 {
+		// Do not cache too big blocks, since they would evict many smaller blocks.
+		return
+	}
+
+	c.mu.Lock()
+	if prev := c.m[k]; prev != nil {
+		// The block has been already cached by concurrent goroutine.
+		c.mu.Unlock()
+		return
+	}
+	if atomic.LoadUint64(&c.sizeBytes)+entrySize > uint64(maxSize) {
+		// Remove 10% of the cache size in order to amortize the cost of cleaning.
+		bytesToRemove := uint64(maxSize) / 10
+		for k, dbe := range c.m {
+			n := dbe.SizeBytes()
+			c.deleteLocked(k, dbe)
+			if n >= bytesToRemove {
+				break
+			}
+			bytesToRemove -= n
+		}
+	}
+	c.m[k] = dbe
+	atomic.AddUint64(&c.sizeBytes, entrySize)
+	c.mu.Unlock()
+}
+
+func (c *dataBlockCache) Requests() uint64 {
+	return atomic.LoadUint64(&c.requests)
+}
+
+func (c *dataBlockCache) Misses() uint64 {
+	return atomic.LoadUint64(&c.misses)
+}
+
+func (c *dataBlockCache) SizeBytes() uint64 {
+	return atomic.LoadUint64(&c.sizeBytes)
+}
+
+func (c *dataBlockCache) Len() uint64 {
+	c.mu.RLock()
+	n := uint64(len(c.m))
+	c.mu.RUnlock()
+	return n
+}
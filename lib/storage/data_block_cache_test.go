@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDataBlockCache(t *testing.T) {
+	SetDataBlocksCacheSize(1024 * 1024)
+	defer SetDataBlocksCacheSize(0)
+
+	c := newDataBlockCache()
+	k := dataBlockCacheKey{
+		partID:                nextPartID(),
+		timestampsBlockOffset: 123,
+	}
+	if dbe := c.Get(k); dbe != nil {
+		t.Fatalf("unexpected entry found in empty cache: %+v", dbe)
+	}
+	timestamps := []int64{1, 2, 3}
+	values := []int64{4, 5, 6}
+	c.Put(k, timestamps, values)
+
+	// Modifications of the original slices mustn't affect the cached entry.
+	timestamps[0] = 10
+	values[0] = 40
+	dbe := c.Get(k)
+	if dbe == nil {
+		t.Fatalf("cannot find the entry in the cache")
+	}
+	if !reflect.DeepEqual(dbe.timestamps, []int64{1, 2, 3}) {
+		t.Fatalf("unexpected timestamps; got %v; want %v", dbe.timestamps, []int64{1, 2, 3})
+	}
+	if !reflect.DeepEqual(dbe.values, []int64{4, 5, 6}) {
+		t.Fatalf("unexpected values; got %v; want %v", dbe.values, []int64{4, 5, 6})
+	}
+	if n := c.Requests(); n != 2 {
+		t.Fatalf("unexpected number of requests; got %d; want 2", n)
+	}
+	if n := c.Misses(); n != 1 {
+		t.Fatalf("unexpected number of misses; got %d; want 1", n)
+	}
+
+	// The cache must be disabled after setting zero size.
+	SetDataBlocksCacheSize(0)
+	if dbe := c.Get(k); dbe != nil {
+		t.Fatalf("unexpected entry returned from disabled cache: %+v", dbe)
+	}
+	SetDataBlocksCacheSize(1024 * 1024)
+
+	// The cache size mustn't exceed the limit.
+	bigValues := make([]int64, 4000)
+	for i := 0; i < 1000; i++ {
+		k.timestampsBlockOffset = uint64(i)
+		c.Put(k, bigValues, bigValues)
+	}
+	if n := c.SizeBytes(); n > 1024*1024 {
+		t.Fatalf("cache size exceeds the limit; got %d bytes", n)
+	}
+	if n := c.Len(); n == 0 {
+		t.Fatalf("the cache mustn't be empty")
+	}
+}
+
+func TestPartSearchWithDataBlocksCache(t *testing.T) {
+	SetDataBlocksCacheSize(64 * 1024 * 1024)
+	defer SetDataBlocksCacheSize(0)
+
+	var rows []rawRow
+	var r rawRow
+	r.PrecisionBits = 24
+	for i := 0; i < 1e4; i++ {
+		r.TSID.MetricID = uint64(i % 10)
+		r.Timestamp = int64(rand.NormFloat64() * 1e6)
+		r.Value = float64(int(rand.NormFloat64() * 1e5))
+		rows = append(rows, r)
+	}
+	tsids := []TSID{{MetricID: 1}, {MetricID: 3}, {MetricID: 7}}
+	tr := TimeRange{
+		MinTimestamp: -1e6,
+		MaxTimestamp: 1e6,
+	}
+	expectedRawBlocks := getTestExpectedRawBlocks(rows, tsids, tr)
+	p := newTestPart(rows)
+
+	// The first search fills the cache, while the subsequent searches must return the same results from the cache.
+	for i := 0; i < 3; i++ {
+		misses := dbc.Misses()
+		if err := testPartSearchSerial(p, tsids, tr, expectedRawBlocks); err != nil {
+			t.Fatalf("unexpected error on search #%d: %s", i, err)
+		}
+		if i > 0 && dbc.Misses() != misses {
+			t.Fatalf("unexpected cache misses on search #%d; got %d; want %d", i, dbc.Misses(), misses)
+		}
+	}
+}
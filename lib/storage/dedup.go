@@ -1,7 +1,13 @@
 package storage
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/metricsql"
 )
 
 // SetMinScrapeIntervalForDeduplication sets the minimum interval for data points during de-duplication.
@@ -15,18 +21,46 @@ func SetMinScrapeIntervalForDeduplication(interval time.Duration) {
 
 var minScrapeInterval = int64(0)
 
-// DeduplicateSamples removes samples from src* if they are closer to each other than minScrapeInterval.
+// DeduplicateSamples removes samples from src* if they are closer to each other than the de-duplication interval.
+//
+// The interval depends on samples age if it is configured via SetDedupIntervalsByAge,
+// so query results match the data de-duplicated during background merges.
 func DeduplicateSamples(srcTimestamps []int64, srcValues []float64) ([]int64, []float64) {
-	if minScrapeInterval <= 0 {
+	if len(dedupIntervalsByAge) == 0 {
+		return deduplicateSamplesInternal(srcTimestamps, srcValues, minScrapeInterval)
+	}
+
+	// Split samples into ranges with distinct de-duplication intervals depending on their age
+	// and de-duplicate every range independently.
+	now := int64(fasttime.UnixTimestamp() * 1000)
+	dstTimestamps := srcTimestamps[:0]
+	dstValues := srcValues[:0]
+	for len(srcTimestamps) > 0 {
+		interval := getDedupIntervalForTimestamp(srcTimestamps[0], now)
+		n := 1
+		for n < len(srcTimestamps) && getDedupIntervalForTimestamp(srcTimestamps[n], now) == interval {
+			n++
+		}
+		timestamps, values := deduplicateSamplesInternal(srcTimestamps[:n], srcValues[:n], interval)
+		dstTimestamps = append(dstTimestamps, timestamps...)
+		dstValues = append(dstValues, values...)
+		srcTimestamps = srcTimestamps[n:]
+		srcValues = srcValues[n:]
+	}
+	return dstTimestamps, dstValues
+}
+
+func deduplicateSamplesInternal(srcTimestamps []int64, srcValues []float64, interval int64) ([]int64, []float64) {
+	if interval <= 0 {
 		return srcTimestamps, srcValues
 	}
-	if !needsDedup(srcTimestamps, minScrapeInterval) {
+	if !needsDedup(srcTimestamps, interval) {
 		// Fast path - nothing to deduplicate
 		return srcTimestamps, srcValues
 	}
 
 	// Slow path - dedup data points.
-	tsNext := (srcTimestamps[0] - srcTimestamps[0]%minScrapeInterval) + minScrapeInterval
+	tsNext := (srcTimestamps[0] - srcTimestamps[0]%interval) + interval
 	dstTimestamps := srcTimestamps[:1]
 	dstValues := srcValues[:1]
 	for i := 1; i < len(srcTimestamps); i++ {
@@ -38,26 +72,125 @@ func DeduplicateSamples(srcTimestamps []int64, srcValues []float64) ([]int64, []
 		dstValues = append(dstValues, srcValues[i])
 
 		// Update tsNext
-		tsNext += minScrapeInterval
+		tsNext += interval
 		if ts >= tsNext {
 			// Slow path for updating ts.
-			tsNext = (ts - ts%minScrapeInterval) + minScrapeInterval
+			tsNext = (ts - ts%interval) + interval
 		}
 	}
 	return dstTimestamps, dstValues
 }
 
+// SetDedupIntervalsByAge sets de-duplication intervals, which are applied during background merges to samples depending on their age.
+//
+// Every item in a must have `age:interval` format, for example `14d:1m`. This means that samples older than 14 days
+// are de-duplicated with 1 minute interval. The interval set via SetMinScrapeIntervalForDeduplication is used for samples
+// not covered by a.
+//
+// This function must be called before initializing the storage.
+func SetDedupIntervalsByAge(a []string) error {
+	dias, err := parseDedupIntervalsByAge(a)
+	if err != nil {
+		return err
+	}
+	dedupIntervalsByAge = dias
+	return nil
+}
+
+// dedupIntervalByAge contains de-duplication interval for samples older than age.
+type dedupIntervalByAge struct {
+	age      int64
+	interval int64
+}
+
+// dedupIntervalsByAge is sorted by age.
+var dedupIntervalsByAge []dedupIntervalByAge
+
+func parseDedupIntervalsByAge(a []string) ([]dedupIntervalByAge, error) {
+	var dias []dedupIntervalByAge
+	for _, s := range a {
+		n := strings.IndexByte(s, ':')
+		if n < 0 {
+			return nil, fmt.Errorf("missing ':' in %q; it must have `age:interval` format, for example `14d:1m`", s)
+		}
+		age, err := metricsql.PositiveDurationValue(s[:n], 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse age in %q: %w", s, err)
+		}
+		interval, err := metricsql.PositiveDurationValue(s[n+1:], 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse interval in %q: %w", s, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval in %q must be positive", s)
+		}
+		dias = append(dias, dedupIntervalByAge{
+			age:      age,
+			interval: interval,
+		})
+	}
+	sort.Slice(dias, func(i, j int) bool {
+		return dias[i].age < dias[j].age
+	})
+	for i := 1; i < len(dias); i++ {
+		if dias[i].age == dias[i-1].age {
+			return nil, fmt.Errorf("duplicate de-duplication intervals for the age %dms", dias[i].age)
+		}
+	}
+	return dias, nil
+}
+
+// getDedupIntervalForTimestamp returns de-duplication interval for the sample with the given timestamp.
+func getDedupIntervalForTimestamp(timestamp, now int64) int64 {
+	interval := minScrapeInterval
+	age := now - timestamp
+	for _, dia := range dedupIntervalsByAge {
+		if age < dia.age {
+			break
+		}
+		if dia.interval > interval {
+			interval = dia.interval
+		}
+	}
+	return interval
+}
+
 func deduplicateSamplesDuringMerge(srcTimestamps, srcValues []int64) ([]int64, []int64) {
-	if minScrapeInterval <= 0 {
+	if len(dedupIntervalsByAge) == 0 {
+		return deduplicateSamplesDuringMergeInternal(srcTimestamps, srcValues, minScrapeInterval)
+	}
+
+	// Split samples into ranges with distinct de-duplication intervals depending on their age
+	// and de-duplicate every range independently.
+	now := int64(fasttime.UnixTimestamp() * 1000)
+	dstTimestamps := srcTimestamps[:0]
+	dstValues := srcValues[:0]
+	for len(srcTimestamps) > 0 {
+		interval := getDedupIntervalForTimestamp(srcTimestamps[0], now)
+		n := 1
+		for n < len(srcTimestamps) && getDedupIntervalForTimestamp(srcTimestamps[n], now) == interval {
+			n++
+		}
+		timestamps, values := deduplicateSamplesDuringMergeInternal(srcTimestamps[:n], srcValues[:n], interval)
+		dstTimestamps = append(dstTimestamps, timestamps...)
+		dstValues = append(dstValues, values...)
+		srcTimestamps = srcTimestamps[n:]
+		srcValues = srcValues[n:]
+	}
+	return dstTimestamps, dstValues
+}
+
+func deduplicateSamplesDuringMergeInternal(srcTimestamps, srcValues []int64, interval int64) ([]int64, []int64) {
+	if interval <= 0 {
 		return srcTimestamps, srcValues
 	}
-	if !needsDedup(srcTimestamps, minScrapeInterval) {
+	if !needsDedup(srcTimestamps, interval) {
 		// Fast path - nothing to deduplicate
 		return srcTimestamps, srcValues
 	}
 
 	// Slow path - dedup data points.
-	tsNext := (srcTimestamps[0] - srcTimestamps[0]%minScrapeInterval) + minScrapeInterval
+	tsNext := (srcTimestamps[0] - srcTimestamps[0]%interval) + interval
 	dstTimestamps := srcTimestamps[:1]
 	dstValues := srcValues[:1]
 	for i := 1; i < len(srcTimestamps); i++ {
@@ -69,10 +202,10 @@ func deduplicateSamplesDuringMerge(srcTimestamps, srcValues []int64) ([]int64, [
 		dstValues = append(dstValues, srcValues[i])
 
 		// Update tsNext
-		tsNext += minScrapeInterval
+		tsNext += interval
 		if ts >= tsNext {
 			// Slow path for updating ts.
-			tsNext = (ts - ts%minScrapeInterval) + minScrapeInterval
+			tsNext = (ts - ts%interval) + interval
 		}
 	}
 	return dstTimestamps, dstValues
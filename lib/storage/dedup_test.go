@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 )
 
 func TestDeduplicateSamples(t *testing.T) {
@@ -115,3 +117,116 @@ func TestDeduplicateSamplesDuringMerge(t *testing.T) {
 	f(time.Second, timestamps, timestamps)
 	f(2*time.Second, timestamps, timestampsExpected)
 }
+
+func TestParseDedupIntervalsByAge(t *testing.T) {
+	f := func(a []string, diasExpected []dedupIntervalByAge) {
+		t.Helper()
+		dias, err := parseDedupIntervalsByAge(a)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(dias, diasExpected) {
+			t.Fatalf("unexpected result for %q;\ngot\n%v\nwant\n%v", a, dias, diasExpected)
+		}
+	}
+	f(nil, nil)
+	f([]string{"90d:5m", "14d:1m"}, []dedupIntervalByAge{
+		{age: 14 * 24 * 3600 * 1000, interval: 60 * 1000},
+		{age: 90 * 24 * 3600 * 1000, interval: 5 * 60 * 1000},
+	})
+
+	fError := func(a []string) {
+		t.Helper()
+		if _, err := parseDedupIntervalsByAge(a); err == nil {
+			t.Fatalf("expecting non-nil error for %q", a)
+		}
+	}
+	fError([]string{"14d"})
+	fError([]string{"foo:1m"})
+	fError([]string{"14d:bar"})
+	fError([]string{"14d:0s"})
+	fError([]string{"14d:1m", "14d:5m"})
+}
+
+func TestDeduplicateSamplesDuringMergeByAge(t *testing.T) {
+	defer func() {
+		dedupIntervalsByAge = nil
+	}()
+	if err := SetDedupIntervalsByAge([]string{"1d:1m", "10d:5m"}); err != nil {
+		t.Fatalf("cannot set dedup intervals: %s", err)
+	}
+
+	// Generate samples with 10s interval for the last 20 days.
+	now := int64(fasttime.UnixTimestamp() * 1000)
+	start := now - 20*24*3600*1000
+	start -= start % (5 * 60 * 1000)
+	var timestamps, values []int64
+	for ts := start; ts < now; ts += 10 * 1000 {
+		timestamps = append(timestamps, ts)
+		values = append(values, ts)
+	}
+	timestamps, values = deduplicateSamplesDuringMerge(timestamps, values)
+	if !reflect.DeepEqual(timestamps, values) {
+		t.Fatalf("timestamps and values mismatch after de-duplication")
+	}
+	for i := 1; i < len(timestamps); i++ {
+		ts := timestamps[i]
+		delta := ts - timestamps[i-1]
+		var minDelta int64
+		switch age := now - ts; {
+		case age > 10*24*3600*1000+5*60*1000:
+			minDelta = 5 * 60 * 1000
+		case age > 24*3600*1000+60*1000 && age < 10*24*3600*1000-60*1000:
+			minDelta = 60 * 1000
+		case age < 24*3600*1000-10*1000:
+			minDelta = 10 * 1000
+		default:
+			// Skip samples at the age boundaries.
+			continue
+		}
+		if delta != minDelta {
+			t.Fatalf("unexpected interval between samples at age %dms; got %dms; want %dms", now-ts, delta, minDelta)
+		}
+	}
+}
+
+func TestDeduplicateSamplesByAge(t *testing.T) {
+	defer func() {
+		dedupIntervalsByAge = nil
+	}()
+	if err := SetDedupIntervalsByAge([]string{"1d:1m"}); err != nil {
+		t.Fatalf("cannot set dedup intervals: %s", err)
+	}
+
+	// Generate samples with 10s interval for the last 2 days.
+	now := int64(fasttime.UnixTimestamp() * 1000)
+	start := now - 2*24*3600*1000
+	start -= start % (60 * 1000)
+	var timestamps []int64
+	var values []float64
+	for ts := start; ts < now; ts += 10 * 1000 {
+		timestamps = append(timestamps, ts)
+		values = append(values, float64(ts))
+	}
+	timestamps, values = DeduplicateSamples(timestamps, values)
+	for i := 1; i < len(timestamps); i++ {
+		ts := timestamps[i]
+		if values[i] != float64(ts) {
+			t.Fatalf("timestamps and values mismatch after de-duplication")
+		}
+		delta := ts - timestamps[i-1]
+		var minDelta int64
+		switch age := now - ts; {
+		case age > 24*3600*1000+60*1000:
+			minDelta = 60 * 1000
+		case age < 24*3600*1000-10*1000:
+			minDelta = 10 * 1000
+		default:
+			// Skip samples at the age boundary.
+			continue
+		}
+		if delta != minDelta {
+			t.Fatalf("unexpected interval between samples at age %dms; got %dms; want %dms", now-ts, delta, minDelta)
+		}
+	}
+}
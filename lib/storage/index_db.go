@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"path/filepath"
 	"sort"
 	"sync"
@@ -103,6 +104,18 @@ type indexDB struct {
 	// The number of hits for date range searches.
 	dateRangeSearchHits uint64
 
+	// The number of calls for searches by a single metric name.
+	singleMetricGroupSearchCalls uint64
+
+	// The number of hits for searches by a single metric name.
+	singleMetricGroupSearchHits uint64
+
+	// The number of searches rejected because of exceeded -search.maxIndexSearchMemory.
+	indexSearchMemoryLimitExceeded uint64
+
+	// The number of searches rejected because of the cached verdict that tag filters match too many time series.
+	tooManyMetricsVerdictHits uint64
+
 	// missingMetricNamesForMetricID is a counter of missing MetricID -> MetricName entries.
 	// High rate may mean corrupted indexDB due to unclean shutdown.
 	// The db must be automatically recovered after that.
@@ -224,15 +237,23 @@ const noDeadline = 1<<64 - 1
 
 // IndexDBMetrics contains essential metrics for indexDB.
 type IndexDBMetrics struct {
-	TagCacheSize      uint64
-	TagCacheSizeBytes uint64
-	TagCacheRequests  uint64
-	TagCacheMisses    uint64
-
-	UselessTagFiltersCacheSize      uint64
-	UselessTagFiltersCacheSizeBytes uint64
-	UselessTagFiltersCacheRequests  uint64
-	UselessTagFiltersCacheMisses    uint64
+	TagCacheSize         uint64
+	TagCacheSizeBytes    uint64
+	TagCacheSizeMaxBytes uint64
+	TagCacheRequests     uint64
+	TagCacheMisses       uint64
+
+	UselessTagFiltersCacheSize         uint64
+	UselessTagFiltersCacheSizeBytes    uint64
+	UselessTagFiltersCacheSizeMaxBytes uint64
+	UselessTagFiltersCacheRequests     uint64
+	UselessTagFiltersCacheMisses       uint64
+
+	MetricIDsPerDateTagFilterCacheSize         uint64
+	MetricIDsPerDateTagFilterCacheSizeBytes    uint64
+	MetricIDsPerDateTagFilterCacheSizeMaxBytes uint64
+	MetricIDsPerDateTagFilterCacheRequests     uint64
+	MetricIDsPerDateTagFilterCacheMisses       uint64
 
 	DeletedMetricsCount uint64
 
@@ -249,6 +270,12 @@ type IndexDBMetrics struct {
 	DateRangeSearchCalls uint64
 	DateRangeSearchHits  uint64
 
+	SingleMetricGroupSearchCalls uint64
+	SingleMetricGroupSearchHits  uint64
+
+	IndexSearchMemoryLimitExceeded uint64
+	TooManyMetricsVerdictHits      uint64
+
 	MissingMetricNamesForMetricID uint64
 
 	IndexBlocksWithMetricIDsProcessed      uint64
@@ -269,6 +296,7 @@ func (db *indexDB) UpdateMetrics(m *IndexDBMetrics) {
 	db.tagCache.UpdateStats(&cs)
 	m.TagCacheSize += cs.EntriesCount
 	m.TagCacheSizeBytes += cs.BytesSize
+	m.TagCacheSizeMaxBytes += db.tagCache.MaxBytesSize()
 	m.TagCacheRequests += cs.GetBigCalls
 	m.TagCacheMisses += cs.Misses
 
@@ -278,6 +306,15 @@ func (db *indexDB) UpdateMetrics(m *IndexDBMetrics) {
 	m.UselessTagFiltersCacheSizeBytes += cs.BytesSize
 	m.UselessTagFiltersCacheRequests += cs.GetCalls
 	m.UselessTagFiltersCacheMisses += cs.Misses
+	m.UselessTagFiltersCacheSizeMaxBytes += db.uselessTagFiltersCache.MaxBytesSize()
+
+	cs.Reset()
+	db.metricIDsPerDateTagFilterCache.UpdateStats(&cs)
+	m.MetricIDsPerDateTagFilterCacheSize += cs.EntriesCount
+	m.MetricIDsPerDateTagFilterCacheSizeBytes += cs.BytesSize
+	m.MetricIDsPerDateTagFilterCacheSizeMaxBytes += db.metricIDsPerDateTagFilterCache.MaxBytesSize()
+	m.MetricIDsPerDateTagFilterCacheRequests += cs.GetCalls
+	m.MetricIDsPerDateTagFilterCacheMisses += cs.Misses
 
 	m.DeletedMetricsCount += uint64(db.getDeletedMetricIDs().Len())
 
@@ -292,6 +329,12 @@ func (db *indexDB) UpdateMetrics(m *IndexDBMetrics) {
 	m.DateRangeSearchCalls += atomic.LoadUint64(&db.dateRangeSearchCalls)
 	m.DateRangeSearchHits += atomic.LoadUint64(&db.dateRangeSearchHits)
 
+	m.SingleMetricGroupSearchCalls += atomic.LoadUint64(&db.singleMetricGroupSearchCalls)
+	m.SingleMetricGroupSearchHits += atomic.LoadUint64(&db.singleMetricGroupSearchHits)
+
+	m.IndexSearchMemoryLimitExceeded += atomic.LoadUint64(&db.indexSearchMemoryLimitExceeded)
+	m.TooManyMetricsVerdictHits += atomic.LoadUint64(&db.tooManyMetricsVerdictHits)
+
 	m.MissingMetricNamesForMetricID += atomic.LoadUint64(&db.missingMetricNamesForMetricID)
 
 	m.IndexBlocksWithMetricIDsProcessed = atomic.LoadUint64(&indexBlocksWithMetricIDsProcessed)
@@ -539,6 +582,15 @@ type indexSearch struct {
 	// deadline in unix timestamp seconds for the given search.
 	deadline uint64
 
+	// stopCh is closed when the search must be canceled, for instance, because the client closed the connection.
+	// It is nil if the search cannot be canceled.
+	stopCh <-chan struct{}
+
+	// setBytesUsed points to the peak memory occupied by a single intermediate metricIDs set for the current search.
+	// It is shared among indexSearch instances used for searching the same query in parallel.
+	// It is nil if the memory isn't tracked.
+	setBytesUsed *uint64
+
 	// tsidByNameMisses and tsidByNameSkips is used for a performance
 	// hack in GetOrCreateTSIDByName. See the comment there.
 	tsidByNameMisses int
@@ -595,6 +647,8 @@ func (db *indexDB) putIndexSearch(is *indexSearch) {
 	is.kb.Reset()
 	is.mp.Reset()
 	is.deadline = 0
+	is.stopCh = nil
+	is.setBytesUsed = nil
 
 	// Do not reset tsidByNameMisses and tsidByNameSkips,
 	// since they are used in GetOrCreateTSIDByName across call boundaries.
@@ -781,7 +835,7 @@ func (is *indexSearch) searchTagKeys(tks map[string]struct{}, maxTagKeys int) er
 	ts.Seek(prefix)
 	for len(tks) < maxTagKeys && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return err
 			}
 		}
@@ -798,7 +852,8 @@ func (is *indexSearch) searchTagKeys(tks map[string]struct{}, maxTagKeys int) er
 		}
 
 		// Store tag key.
-		tks[string(mp.Tag.Key)] = struct{}{}
+		// Tag keys are interned, since they are usually repeated across calls.
+		tks[bytesutil.InternBytes(mp.Tag.Key)] = struct{}{}
 
 		// Search for the next tag key.
 		// The last char in kb.B must be tagSeparatorChar.
@@ -861,7 +916,7 @@ func (is *indexSearch) searchTagValues(tvs map[string]struct{}, tagKey []byte, m
 	ts.Seek(prefix)
 	for len(tvs) < maxTagValues && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return err
 			}
 		}
@@ -901,6 +956,113 @@ func (is *indexSearch) searchTagValues(tvs map[string]struct{}, tagKey []byte, m
 	return nil
 }
 
+// TagValueSuggestion contains tag value with the number of time series containing it.
+type TagValueSuggestion struct {
+	Value       string
+	SeriesCount uint64
+}
+
+// SearchTagValueSuggestions returns up to maxTagValues values for the given tagKey, which match the given query.
+//
+// If substring is false, then values starting with query are returned. Otherwise values containing query
+// in case-insensitive manner are returned.
+//
+// SeriesCount in the returned suggestions is approximate, since it may count the same series
+// up to two times - in db and extDB.
+func (db *indexDB) SearchTagValueSuggestions(tagKey, query []byte, substring bool, maxTagValues int, deadline uint64) ([]TagValueSuggestion, error) {
+	m := make(map[string]uint64)
+	is := db.getIndexSearch(deadline)
+	err := is.searchTagValueSuggestions(m, tagKey, query, substring, maxTagValues)
+	db.putIndexSearch(is)
+	if err != nil {
+		return nil, err
+	}
+	ok := db.doExtDB(func(extDB *indexDB) {
+		is := extDB.getIndexSearch(deadline)
+		err = is.searchTagValueSuggestions(m, tagKey, query, substring, maxTagValues)
+		extDB.putIndexSearch(is)
+	})
+	if ok && err != nil {
+		return nil, err
+	}
+
+	tvss := make([]TagValueSuggestion, 0, len(m))
+	for tv, n := range m {
+		if len(tv) == 0 {
+			// Skip empty values, since they have no any meaning.
+			continue
+		}
+		tvss = append(tvss, TagValueSuggestion{
+			Value:       tv,
+			SeriesCount: n,
+		})
+	}
+
+	// Do not sort tvss, since they must be sorted by vmselect.
+	return tvss, nil
+}
+
+func (is *indexSearch) searchTagValueSuggestions(m map[string]uint64, tagKey, query []byte, substring bool, maxTagValues int) error {
+	ts := &is.ts
+	kb := &is.kb
+	mp := &is.mp
+	mp.Reset()
+	dmis := is.db.getDeletedMetricIDs()
+	loopsPaceLimiter := 0
+	kb.B = is.marshalCommonPrefix(kb.B[:0], nsPrefixTagToMetricIDs)
+	kb.B = marshalTagValue(kb.B, tagKey)
+	if !substring {
+		// Tag values are escaped char by char, so the escaped query is a prefix for escaped tag values starting with query.
+		kb.B = marshalTagValueNoTrailingTagSeparator(kb.B, query)
+	}
+	prefix := append([]byte{}, kb.B...)
+	queryLower := bytes.ToLower(query)
+	ts.Seek(prefix)
+	for ts.NextItem() {
+		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
+				return err
+			}
+		}
+		loopsPaceLimiter++
+		item := ts.Item
+		if !bytes.HasPrefix(item, prefix) {
+			break
+		}
+		if err := mp.Init(item, nsPrefixTagToMetricIDs); err != nil {
+			return err
+		}
+		if !substring || bytes.Contains(bytes.ToLower(mp.Tag.Value), queryLower) {
+			if _, ok := m[string(mp.Tag.Value)]; !ok && len(m) >= maxTagValues {
+				break
+			}
+			mp.ParseMetricIDs()
+			n := uint64(0)
+			for _, metricID := range mp.MetricIDs {
+				if !dmis.Has(metricID) {
+					n++
+				}
+			}
+			if n > 0 {
+				m[string(mp.Tag.Value)] += n
+			}
+			continue
+		}
+		// The tag value doesn't match the query. Jump to the next tag value.
+		// The last char in kb.B must be tagSeparatorChar.
+		// Just increment it in order to jump to the next tag value.
+		kb.B = is.marshalCommonPrefix(kb.B[:0], nsPrefixTagToMetricIDs)
+		kb.B = marshalTagValue(kb.B, mp.Tag.Key)
+		kb.B = marshalTagValue(kb.B, mp.Tag.Value)
+		kb.B[len(kb.B)-1]++
+		ts.Seek(kb.B)
+	}
+	if err := ts.Error(); err != nil {
+		return fmt.Errorf("error when searching for tag value suggestions with prefix %q: %w", prefix, err)
+	}
+	return nil
+}
+
 // GetSeriesCount returns the approximate number of unique timeseries in the db.
 //
 // It includes the deleted series too and may count the same series
@@ -925,6 +1087,92 @@ func (db *indexDB) GetSeriesCount(deadline uint64) (uint64, error) {
 	return n + nExt, nil
 }
 
+// GetSeriesCountWithFilters returns the number of unique time series matching tfss on the given tr.
+//
+// The series are counted inside the index without fetching metric names.
+// Deleted series aren't counted. The result may include series without samples on tr,
+// since the index has per-day granularity.
+func (db *indexDB) GetSeriesCountWithFilters(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) (uint64, error) {
+	metricIDs := &uint64set.Set{}
+	is := db.getIndexSearch(deadline)
+	err := is.updateMetricIDsForCount(metricIDs, tfss, tr, maxMetrics)
+	db.putIndexSearch(is)
+	if err != nil {
+		return 0, err
+	}
+	ok := db.doExtDB(func(extDB *indexDB) {
+		is := extDB.getIndexSearch(deadline)
+		err = is.updateMetricIDsForCount(metricIDs, tfss, tr, maxMetrics)
+		extDB.putIndexSearch(is)
+	})
+	if ok && err != nil {
+		return 0, fmt.Errorf("error when searching in extDB: %w", err)
+	}
+	return uint64(metricIDs.Len()), nil
+}
+
+// SearchMetricNamesPage returns up to limit marshaled metric names matching tfss on the given tr,
+// which follow the series with afterMetricID, together with their metricIDs.
+//
+// Series are returned in the ascending order of their metricIDs. Pass zero afterMetricID for obtaining the first page.
+// The matching series are obtained with searchTSIDs, so their number is limited by maxMetrics
+// and subsequent pages for the same tfss and tr are served from the tag cache.
+// The result may include series without samples on tr, since the index has per-day granularity.
+func (db *indexDB) SearchMetricNamesPage(tfss []*TagFilters, tr TimeRange, afterMetricID uint64, limit, maxMetrics int, deadline uint64) ([]uint64, [][]byte, error) {
+	tsids, err := db.searchTSIDs(tfss, tr, maxMetrics, deadline, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	metricIDs := make([]uint64, len(tsids))
+	for i := range tsids {
+		metricIDs[i] = tsids[i].MetricID
+	}
+	sort.Slice(metricIDs, func(i, j int) bool { return metricIDs[i] < metricIDs[j] })
+	n := sort.Search(len(metricIDs), func(i int) bool { return metricIDs[i] > afterMetricID })
+	metricIDs = metricIDs[n:]
+
+	var pageMetricIDs []uint64
+	var metricNames [][]byte
+	for i, metricID := range metricIDs {
+		if len(metricNames) >= limit {
+			break
+		}
+		if i&paceLimiterSlowIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(deadline, nil); err != nil {
+				return nil, nil, err
+			}
+		}
+		metricName, err := db.searchMetricName(nil, metricID)
+		if err != nil {
+			if err == io.EOF {
+				// Skip missing metricName for the given metricID.
+				continue
+			}
+			return nil, nil, fmt.Errorf("cannot find metricName for metricID=%d: %w", metricID, err)
+		}
+		pageMetricIDs = append(pageMetricIDs, metricID)
+		metricNames = append(metricNames, metricName)
+	}
+	return pageMetricIDs, metricNames, nil
+}
+
+func (is *indexSearch) updateMetricIDsForCount(metricIDs *uint64set.Set, tfss []*TagFilters, tr TimeRange, maxMetrics int) error {
+	ok, err := is.containsTimeRange(tr)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Fast path - the index doesn't contain data for the given tr.
+		return nil
+	}
+	localMetricIDs, err := is.searchMetricIDs(tfss, tr, maxMetrics)
+	if err != nil {
+		return err
+	}
+	metricIDs.AddMulti(localMetricIDs)
+	return nil
+}
+
 func (is *indexSearch) getSeriesCount() (uint64, error) {
 	ts := &is.ts
 	kb := &is.kb
@@ -937,7 +1185,7 @@ func (is *indexSearch) getSeriesCount() (uint64, error) {
 	ts.Seek(kb.B)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return 0, err
 			}
 		}
@@ -968,8 +1216,16 @@ func (is *indexSearch) getSeriesCount() (uint64, error) {
 
 // GetTSDBStatusForDate returns topN entries for tsdb status for the given date.
 func (db *indexDB) GetTSDBStatusForDate(date uint64, topN int, deadline uint64) (*TSDBStatus, error) {
+	return db.GetTSDBStatusWithFiltersForDate(nil, date, topN, "", 0, deadline)
+}
+
+// GetTSDBStatusWithFiltersForDate returns topN entries for tsdb status for the given tfss, date and focusLabel.
+//
+// Only series matching tfss are taken into account if tfss isn't empty. maxMetrics limits the number of such series.
+// Series counts by values for focusLabel are returned in TSDBStatus.SeriesCountByFocusLabelValue if focusLabel isn't empty.
+func (db *indexDB) GetTSDBStatusWithFiltersForDate(tfss []*TagFilters, date uint64, topN int, focusLabel string, maxMetrics int, deadline uint64) (*TSDBStatus, error) {
 	is := db.getIndexSearch(deadline)
-	status, err := is.getTSDBStatusForDate(date, topN)
+	status, err := is.getTSDBStatusWithFiltersForDate(tfss, date, topN, focusLabel, maxMetrics)
 	db.putIndexSearch(is)
 	if err != nil {
 		return nil, err
@@ -982,7 +1238,7 @@ func (db *indexDB) GetTSDBStatusForDate(date uint64, topN int, deadline uint64)
 	// The entries weren't found in the db. Try searching them in extDB.
 	ok := db.doExtDB(func(extDB *indexDB) {
 		is := extDB.getIndexSearch(deadline)
-		status, err = is.getTSDBStatusForDate(date, topN)
+		status, err = is.getTSDBStatusWithFiltersForDate(tfss, date, topN, focusLabel, maxMetrics)
 		extDB.putIndexSearch(is)
 	})
 	if ok && err != nil {
@@ -991,16 +1247,59 @@ func (db *indexDB) GetTSDBStatusForDate(date uint64, topN int, deadline uint64)
 	return status, nil
 }
 
-func (is *indexSearch) getTSDBStatusForDate(date uint64, topN int) (*TSDBStatus, error) {
+func (is *indexSearch) getTSDBStatusWithFiltersForDate(tfss []*TagFilters, date uint64, topN int, focusLabel string, maxMetrics int) (*TSDBStatus, error) {
+	var filter *uint64set.Set
+	if len(tfss) > 0 {
+		tr := TimeRange{
+			MinTimestamp: int64(date) * msecPerDay,
+			MaxTimestamp: int64(date+1)*msecPerDay - 1,
+		}
+		metricIDs, err := is.searchMetricIDs(tfss, tr, maxMetrics)
+		if err != nil {
+			return nil, err
+		}
+		if len(metricIDs) == 0 {
+			// Nothing found.
+			return &TSDBStatus{}, nil
+		}
+		filter = &uint64set.Set{}
+		filter.AddMulti(metricIDs)
+	}
+	return is.getTSDBStatusForDate(filter, date, topN, focusLabel)
+}
+
+// getTSDBStatusForDate returns tsdb status for the given date.
+//
+// Only metricIDs from filter are counted if filter isn't nil.
+func (is *indexSearch) getTSDBStatusForDate(filter *uint64set.Set, date uint64, topN int, focusLabel string) (*TSDBStatus, error) {
 	ts := &is.ts
 	kb := &is.kb
 	mp := &is.mp
 	thLabelValueCountByLabelName := newTopHeap(topN)
 	thSeriesCountByLabelValuePair := newTopHeap(topN)
 	thSeriesCountByMetricName := newTopHeap(topN)
+	thSeriesCountByFocusLabelValue := newTopHeap(topN)
 	var tmp, labelName, labelNameValue []byte
-	var labelValueCountByLabelName, seriesCountByLabelValuePair uint64
+	var labelValueCountByLabelName, seriesCountByLabelValuePair, totalSeries uint64
 	nameEqualBytes := []byte("__name__=")
+	focusLabelEqualBytes := []byte(focusLabel + "=")
+
+	// flushLabelNameValue registers the collected stats for labelNameValue.
+	flushLabelNameValue := func() {
+		if seriesCountByLabelValuePair == 0 {
+			// Skip label-value pairs without matching series.
+			return
+		}
+		labelValueCountByLabelName++
+		thSeriesCountByLabelValuePair.pushIfNonEmpty(labelNameValue, seriesCountByLabelValuePair)
+		if bytes.HasPrefix(labelNameValue, nameEqualBytes) {
+			thSeriesCountByMetricName.pushIfNonEmpty(labelNameValue[len(nameEqualBytes):], seriesCountByLabelValuePair)
+			totalSeries += seriesCountByLabelValuePair
+		}
+		if len(focusLabel) > 0 && bytes.HasPrefix(labelNameValue, focusLabelEqualBytes) {
+			thSeriesCountByFocusLabelValue.pushIfNonEmpty(labelNameValue[len(focusLabelEqualBytes):], seriesCountByLabelValuePair)
+		}
+	}
 
 	loopsPaceLimiter := 0
 	kb.B = is.marshalCommonPrefix(kb.B[:0], nsPrefixDateTagToMetricIDs)
@@ -1009,7 +1308,7 @@ func (is *indexSearch) getTSDBStatusForDate(date uint64, topN int) (*TSDBStatus,
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return nil, err
 			}
 		}
@@ -1027,45 +1326,50 @@ func (is *indexSearch) getTSDBStatusForDate(date uint64, topN int) (*TSDBStatus,
 		if len(tmp) == 0 {
 			tmp = append(tmp, "__name__"...)
 		}
-		if !bytes.Equal(tmp, labelName) {
-			thLabelValueCountByLabelName.pushIfNonEmpty(labelName, labelValueCountByLabelName)
-			labelValueCountByLabelName = 0
-			labelName = append(labelName[:0], tmp...)
-		}
 		tmp = append(tmp, '=')
+		labelNameLen := len(tmp) - 1
 		tail, tmp, err = unmarshalTagValue(tmp, tail)
 		if err != nil {
 			return nil, fmt.Errorf("cannot unmarshal tag value from line %q: %w", item, err)
 		}
 		if !bytes.Equal(tmp, labelNameValue) {
-			thSeriesCountByLabelValuePair.pushIfNonEmpty(labelNameValue, seriesCountByLabelValuePair)
-			if bytes.HasPrefix(labelNameValue, nameEqualBytes) {
-				thSeriesCountByMetricName.pushIfNonEmpty(labelNameValue[len(nameEqualBytes):], seriesCountByLabelValuePair)
-			}
+			flushLabelNameValue()
 			seriesCountByLabelValuePair = 0
-			labelValueCountByLabelName++
 			labelNameValue = append(labelNameValue[:0], tmp...)
 		}
+		if !bytes.Equal(tmp[:labelNameLen], labelName) {
+			thLabelValueCountByLabelName.pushIfNonEmpty(labelName, labelValueCountByLabelName)
+			labelValueCountByLabelName = 0
+			labelName = append(labelName[:0], tmp[:labelNameLen]...)
+		}
 		if err := mp.InitOnlyTail(item, tail); err != nil {
 			return nil, err
 		}
 		// Take into account deleted timeseries too.
 		// It is OK if series can be counted multiple times in rare cases -
 		// the returned number is an estimation.
-		seriesCountByLabelValuePair += uint64(mp.MetricIDsLen())
+		if filter == nil {
+			seriesCountByLabelValuePair += uint64(mp.MetricIDsLen())
+			continue
+		}
+		mp.ParseMetricIDs()
+		for _, metricID := range mp.MetricIDs {
+			if filter.Has(metricID) {
+				seriesCountByLabelValuePair++
+			}
+		}
 	}
 	if err := ts.Error(); err != nil {
 		return nil, fmt.Errorf("error when counting time series by metric names: %w", err)
 	}
+	flushLabelNameValue()
 	thLabelValueCountByLabelName.pushIfNonEmpty(labelName, labelValueCountByLabelName)
-	thSeriesCountByLabelValuePair.pushIfNonEmpty(labelNameValue, seriesCountByLabelValuePair)
-	if bytes.HasPrefix(labelNameValue, nameEqualBytes) {
-		thSeriesCountByMetricName.pushIfNonEmpty(labelNameValue[len(nameEqualBytes):], seriesCountByLabelValuePair)
-	}
 	status := &TSDBStatus{
-		SeriesCountByMetricName:     thSeriesCountByMetricName.getSortedResult(),
-		LabelValueCountByLabelName:  thLabelValueCountByLabelName.getSortedResult(),
-		SeriesCountByLabelValuePair: thSeriesCountByLabelValuePair.getSortedResult(),
+		TotalSeries:                  totalSeries,
+		SeriesCountByMetricName:      thSeriesCountByMetricName.getSortedResult(),
+		LabelValueCountByLabelName:   thLabelValueCountByLabelName.getSortedResult(),
+		SeriesCountByLabelValuePair:  thSeriesCountByLabelValuePair.getSortedResult(),
+		SeriesCountByFocusLabelValue: thSeriesCountByFocusLabelValue.getSortedResult(),
 	}
 	return status, nil
 }
@@ -1074,9 +1378,15 @@ func (is *indexSearch) getTSDBStatusForDate(date uint64, topN int) (*TSDBStatus,
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#tsdb-stats
 type TSDBStatus struct {
+	// TotalSeries is the estimated number of series for the given date.
+	TotalSeries uint64
+
 	SeriesCountByMetricName     []TopHeapEntry
 	LabelValueCountByLabelName  []TopHeapEntry
 	SeriesCountByLabelValuePair []TopHeapEntry
+
+	// SeriesCountByFocusLabelValue contains series counts for values of the requested focus label.
+	SeriesCountByFocusLabelValue []TopHeapEntry
 }
 
 func (status *TSDBStatus) hasEntries() bool {
@@ -1184,6 +1494,9 @@ func (db *indexDB) searchMetricName(dst []byte, metricID uint64) ([]byte, error)
 	// when indexDB contains incomplete set of metricID -> metricName entries
 	// after a snapshot or due to unflushed entries.
 	atomic.AddUint64(&db.missingMetricNamesForMetricID, 1)
+	if isReadOnly {
+		return dst, io.EOF
+	}
 
 	// Mark the metricID as deleted, so it will be created again when new data point
 	// for the given time series will arrive.
@@ -1232,6 +1545,63 @@ func (db *indexDB) DeleteTSIDs(tfss []*TagFilters) (int, error) {
 	return deletedCount, nil
 }
 
+// DeleteTSIDsDryRun returns the number of series, which would be deleted by DeleteTSIDs(tfss),
+// together with up to maxMetricNames names of these series.
+//
+// Nothing is deleted.
+func (db *indexDB) DeleteTSIDsDryRun(tfss []*TagFilters, maxMetricNames int) (int, []MetricName, error) {
+	if len(tfss) == 0 {
+		return 0, nil, nil
+	}
+
+	// Obtain metricIDs the same way as DeleteTSIDs does.
+	tr := TimeRange{
+		MinTimestamp: 0,
+		MaxTimestamp: (1 << 63) - 1,
+	}
+	is := db.getIndexSearch(noDeadline)
+	defer db.putIndexSearch(is)
+	metricIDs, err := is.searchMetricIDs(tfss, tr, 2e9)
+	if err != nil {
+		return 0, nil, err
+	}
+	var mns []MetricName
+	var buf []byte
+	for _, metricID := range metricIDs {
+		if len(mns) >= maxMetricNames {
+			break
+		}
+		buf, err = is.searchMetricName(buf[:0], metricID)
+		if err != nil {
+			if err == io.EOF {
+				// The metric name may be missing after unclean shutdown. Skip it.
+				continue
+			}
+			return 0, nil, fmt.Errorf("cannot find metric name for metricID=%d: %w", metricID, err)
+		}
+		mns = append(mns, MetricName{})
+		mn := &mns[len(mns)-1]
+		if err := mn.Unmarshal(buf); err != nil {
+			return 0, nil, fmt.Errorf("cannot unmarshal metric name for metricID=%d: %w", metricID, err)
+		}
+	}
+
+	// Count TSIDs in the extDB.
+	count := len(metricIDs)
+	if db.doExtDB(func(extDB *indexDB) {
+		var n int
+		var extMNs []MetricName
+		n, extMNs, err = extDB.DeleteTSIDsDryRun(tfss, maxMetricNames-len(mns))
+		count += n
+		mns = append(mns, extMNs...)
+	}) {
+		if err != nil {
+			return count, mns, fmt.Errorf("cannot count tsids in extDB: %w", err)
+		}
+	}
+	return count, mns, nil
+}
+
 func (db *indexDB) deleteMetricIDs(metricIDs []uint64) error {
 	if len(metricIDs) == 0 {
 		// Nothing to delete
@@ -1239,10 +1609,15 @@ func (db *indexDB) deleteMetricIDs(metricIDs []uint64) error {
 	}
 
 	// Mark the found metricIDs as deleted.
+	// Store the deletion time only if tombstones must be carried over on indexDB rotation,
+	// since previous releases cannot read tombstones with the deletion time.
+	deletedAt := uint64(0)
+	if deletedSeriesTTL > 0 {
+		deletedAt = fasttime.UnixTimestamp()
+	}
 	items := getIndexItems()
 	for _, metricID := range metricIDs {
-		items.B = append(items.B, nsPrefixDeletedMetricID)
-		items.B = encoding.MarshalUint64(items.B, metricID)
+		items.B = marshalDeletedMetricID(items.B, metricID, deletedAt)
 		items.Next()
 	}
 	err := db.tb.AddItems(items.Items)
@@ -1267,6 +1642,103 @@ func (db *indexDB) deleteMetricIDs(metricIDs []uint64) error {
 	return nil
 }
 
+// dateMetricIDCursor points to (date, metricID) entry in the per-day inverted index.
+type dateMetricIDCursor struct {
+	date     uint64
+	metricID uint64
+
+	// done is set when there are no more entries to scan.
+	done bool
+}
+
+// addMetricIDsBeforeDate adds metricIDs from (date, metricID) entries with date < minDate to metricIDs
+// starting from the entry pointed by c until metricIDs contains at least maxMetricIDs items.
+//
+// c is updated to point to the next entry to scan.
+// errForciblyStopped is returned if stopCh is closed during the scan.
+func (is *indexSearch) addMetricIDsBeforeDate(metricIDs *uint64set.Set, c *dateMetricIDCursor, minDate uint64, maxMetricIDs int, stopCh <-chan struct{}) error {
+	ts := &is.ts
+	kb := &is.kb
+	kb.B = is.marshalCommonPrefix(kb.B[:0], nsPrefixDateToMetricID)
+	prefixLen := len(kb.B)
+	kb.B = encoding.MarshalUint64(kb.B, c.date)
+	kb.B = encoding.MarshalUint64(kb.B, c.metricID)
+	prefix := kb.B[:prefixLen]
+	ts.Seek(kb.B)
+	loops := 0
+	for ts.NextItem() {
+		item := ts.Item
+		if !bytes.HasPrefix(item, prefix) {
+			break
+		}
+		tail := item[len(prefix):]
+		if len(tail) != 16 {
+			return fmt.Errorf("unexpected (date, metricID) entry length; got %d bytes; want 16 bytes", len(tail))
+		}
+		date := encoding.UnmarshalUint64(tail)
+		if date >= minDate {
+			break
+		}
+		if metricIDs.Len() >= maxMetricIDs {
+			c.date = date
+			c.metricID = encoding.UnmarshalUint64(tail[8:])
+			return nil
+		}
+		metricIDs.Add(encoding.UnmarshalUint64(tail[8:]))
+		loops++
+		if loops&(1<<16-1) == 0 && isStopped(stopCh) {
+			return errForciblyStopped
+		}
+	}
+	if err := ts.Error(); err != nil {
+		return fmt.Errorf("error when searching for (date, metricID) entries: %w", err)
+	}
+	c.done = true
+	return nil
+}
+
+// removeMetricIDsWithDataSince removes metricIDs with (date, metricID) entries for date >= minDate from metricIDs.
+//
+// errForciblyStopped is returned if stopCh is closed during the scan.
+func (is *indexSearch) removeMetricIDsWithDataSince(metricIDs *uint64set.Set, minDate uint64, stopCh <-chan struct{}) error {
+	ts := &is.ts
+	kb := &is.kb
+	kb.B = is.marshalCommonPrefix(kb.B[:0], nsPrefixDateToMetricID)
+	prefixLen := len(kb.B)
+	kb.B = encoding.MarshalUint64(kb.B, minDate)
+	prefix := kb.B[:prefixLen]
+	ts.Seek(kb.B)
+	loops := 0
+	for ts.NextItem() && metricIDs.Len() > 0 {
+		item := ts.Item
+		if !bytes.HasPrefix(item, prefix) {
+			break
+		}
+		tail := item[len(prefix):]
+		if len(tail) != 16 {
+			return fmt.Errorf("unexpected (date, metricID) entry length; got %d bytes; want 16 bytes", len(tail))
+		}
+		metricIDs.Del(encoding.UnmarshalUint64(tail[8:]))
+		loops++
+		if loops&(1<<16-1) == 0 && isStopped(stopCh) {
+			return errForciblyStopped
+		}
+	}
+	if err := ts.Error(); err != nil {
+		return fmt.Errorf("error when searching for (date, metricID) entries: %w", err)
+	}
+	return nil
+}
+
+func isStopped(stopCh <-chan struct{}) bool {
+	select {
+	case <-stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
 func (db *indexDB) getDeletedMetricIDs() *uint64set.Set {
 	return db.deletedMetricIDs.Load().(*uint64set.Set)
 }
@@ -1315,6 +1787,21 @@ func (is *indexSearch) getStartDateForPerDayInvertedIndex() (uint64, error) {
 
 func (is *indexSearch) loadDeletedMetricIDs() (*uint64set.Set, error) {
 	dmis := &uint64set.Set{}
+	err := is.iterateDeletedMetricIDs(func(metricID, deletedAt uint64) {
+		dmis.Add(metricID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dmis, nil
+}
+
+// iterateDeletedMetricIDs calls f for each tombstone record stored in is.
+//
+// deletedAt is the unix timestamp in seconds for the deletion time.
+// It is set to 0 for tombstone records created by older versions of VictoriaMetrics,
+// which didn't store the deletion time.
+func (is *indexSearch) iterateDeletedMetricIDs(f func(metricID, deletedAt uint64)) error {
 	ts := &is.ts
 	kb := &is.kb
 	kb.B = append(kb.B[:0], nsPrefixDeletedMetricID)
@@ -1325,20 +1812,69 @@ func (is *indexSearch) loadDeletedMetricIDs() (*uint64set.Set, error) {
 			break
 		}
 		item = item[len(kb.B):]
-		if len(item) != 8 {
-			return nil, fmt.Errorf("unexpected item len; got %d bytes; want %d bytes", len(item), 8)
+		var deletedAt uint64
+		switch len(item) {
+		case 8:
+		case 16:
+			deletedAt = encoding.UnmarshalUint64(item[8:])
+		default:
+			return fmt.Errorf("unexpected item len; got %d bytes; want %d or %d bytes", len(item), 8, 16)
 		}
 		metricID := encoding.UnmarshalUint64(item)
-		dmis.Add(metricID)
+		f(metricID, deletedAt)
 	}
-	if err := ts.Error(); err != nil {
-		return nil, err
+	return ts.Error()
+}
+
+// carryOverDeletedMetricIDs persists tombstone records from prevDB, which aren't older than ttl, in db.
+//
+// This allows dropping data for deleted metricIDs during background merges after prevDB is dropped.
+// Returns the number of tombstone records carried over and the number of expired tombstone records.
+func (db *indexDB) carryOverDeletedMetricIDs(prevDB *indexDB, ttl time.Duration) (int, int, error) {
+	minDeletedAt := uint64(0)
+	if ct := fasttime.UnixTimestamp(); uint64(ttl.Seconds()) < ct {
+		minDeletedAt = ct - uint64(ttl.Seconds())
 	}
-	return dmis, nil
+	items := getIndexItems()
+	defer putIndexItems(items)
+	carriedOver := 0
+	expired := 0
+	is := prevDB.getIndexSearch(noDeadline)
+	err := is.iterateDeletedMetricIDs(func(metricID, deletedAt uint64) {
+		if ttl <= 0 || deletedAt < minDeletedAt {
+			expired++
+			return
+		}
+		items.B = marshalDeletedMetricID(items.B, metricID, deletedAt)
+		items.Next()
+		carriedOver++
+	})
+	prevDB.putIndexSearch(is)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot read deleted metricIDs: %w", err)
+	}
+	if err := db.tb.AddItems(items.Items); err != nil {
+		return 0, 0, fmt.Errorf("cannot store deleted metricIDs: %w", err)
+	}
+	return carriedOver, expired, nil
+}
+
+// marshalDeletedMetricID appends tombstone record for the given metricID deleted at deletedAt unix timestamp to dst.
+//
+// The tombstone record is stored in the old format without the deletion time if deletedAt is 0.
+func marshalDeletedMetricID(dst []byte, metricID, deletedAt uint64) []byte {
+	dst = append(dst, nsPrefixDeletedMetricID)
+	dst = encoding.MarshalUint64(dst, metricID)
+	if deletedAt == 0 {
+		return dst
+	}
+	return encoding.MarshalUint64(dst, deletedAt)
 }
 
 // searchTSIDs returns sorted tsids matching the given tfss over the given tr.
-func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+//
+// The search is canceled with ErrSearchCanceled error when stopCh is closed.
+func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, stopCh <-chan struct{}) ([]TSID, error) {
 	if len(tfss) == 0 {
 		return nil, nil
 	}
@@ -1355,6 +1891,7 @@ func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 
 	// Slow path - search for tsids in the db and extDB.
 	is := db.getIndexSearch(deadline)
+	is.stopCh = stopCh
 	localTSIDs, err := is.searchTSIDs(tfss, tr, maxMetrics)
 	db.putIndexSearch(is)
 	if err != nil {
@@ -1374,6 +1911,7 @@ func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 			return
 		}
 		is := extDB.getIndexSearch(deadline)
+		is.stopCh = stopCh
 		extTSIDs, err = is.searchTSIDs(tfss, tr, maxMetrics)
 		extDB.putIndexSearch(is)
 
@@ -1533,7 +2071,7 @@ func (is *indexSearch) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics
 	i := 0
 	for loopsPaceLimiter, metricID := range metricIDs {
 		if loopsPaceLimiter&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return nil, err
 			}
 		}
@@ -1605,7 +2143,7 @@ func (is *indexSearch) updateMetricIDsByMetricNameMatch(metricIDs, srcMetricIDs
 	defer PutMetricName(mn)
 	for loopsPaceLimiter, metricID := range sortedMetricIDs {
 		if loopsPaceLimiter&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return err
 			}
 		}
@@ -1667,7 +2205,7 @@ func (is *indexSearch) getTagFilterWithMinMetricIDsCountOptimized(tfs *TagFilter
 		if err != errTooManyMetrics {
 			return nil, nil, err
 		}
-		return nil, nil, fmt.Errorf("cannot find tag filter matching less than %d time series; "+
+		return nil, nil, newTooManyTimeseriesError("cannot find tag filter matching less than %d time series; "+
 			"either increase -search.maxUniqueTimeseries or use more specific tag filters", maxMetrics)
 	}
 	if err != nil {
@@ -1685,7 +2223,7 @@ func (is *indexSearch) getTagFilterWithMinMetricIDsCountOptimized(tfs *TagFilter
 	if err != errTooManyMetrics {
 		return nil, nil, err
 	}
-	return nil, nil, fmt.Errorf("more than %d time series found on the time range %s; either increase -search.maxUniqueTimeseries or shrink the time range",
+	return nil, nil, newTooManyTimeseriesError("more than %d time series found on the time range %s; either increase -search.maxUniqueTimeseries or shrink the time range",
 		maxMetrics, tr.String())
 }
 
@@ -1782,6 +2320,10 @@ func (is *indexSearch) getTagFilterWithMinMetricIDsCount(tfs *TagFilters, maxMet
 		}
 
 		metricIDs, err := is.getMetricIDsForTagFilter(tf, maxMetrics)
+		is.storeTagFilterSelectivity(tf, metricIDs, maxMetrics, err)
+		if err == nil {
+			err = is.accountSetMemory(tf, metricIDs)
+		}
 		if err != nil {
 			if err == errFallbackToMetricNameMatch {
 				// Skip tag filters requiring to scan for too many metrics.
@@ -1865,6 +2407,11 @@ func matchTagFilters(mn *MetricName, tfs []*tagFilter, kb *bytesutil.ByteBuffer)
 			}
 			continue
 		}
+		if bytes.Equal(tf.key, graphiteReverseTagKey) {
+			// Skip artificial tag filter for Graphite-like metric names with dots,
+			// since mn doesn't contain the corresponding tag.
+			continue
+		}
 
 		// Search for matching tag name.
 		tagMatched := false
@@ -1933,7 +2480,55 @@ func matchTagFilter(b []byte, tf *tagFilter) (bool, error) {
 	return !tf.isNegative, nil
 }
 
+// SetMaxIndexSearchMemory sets the maximum memory in bytes, which may be occupied
+// by intermediate metricIDs sets during a single search.
+//
+// There is no limit if maxBytes <= 0.
+func SetMaxIndexSearchMemory(maxBytes int) {
+	maxIndexSearchMemory = maxBytes
+}
+
+var maxIndexSearchMemory int
+
+// errIndexSearchMemoryLimitExceeded is returned when intermediate metricIDs sets
+// for a single search occupy more than maxIndexSearchMemory bytes.
+var errIndexSearchMemoryLimitExceeded = errors.New("the search requires too much memory for intermediate results")
+
+// accountSetMemory updates the peak memory for the current search with the memory occupied by metricIDs obtained for tf.
+//
+// Intermediate sets are released after being intersected or merged, so their sizes aren't summed up.
+//
+// It returns an error naming tf if the memory limit for the current search is exceeded.
+func (is *indexSearch) accountSetMemory(tf *tagFilter, metricIDs *uint64set.Set) error {
+	if is.setBytesUsed == nil || maxIndexSearchMemory <= 0 || metricIDs == nil {
+		return nil
+	}
+	n := metricIDs.SizeBytes()
+	for {
+		prev := atomic.LoadUint64(is.setBytesUsed)
+		if n <= prev || atomic.CompareAndSwapUint64(is.setBytesUsed, prev, n) {
+			break
+		}
+	}
+	if n <= uint64(maxIndexSearchMemory) {
+		return nil
+	}
+	atomic.AddUint64(&is.db.indexSearchMemoryLimitExceeded, 1)
+	filter := "{}"
+	if tf != nil {
+		filter = tf.String()
+	}
+	return fmt.Errorf("%w: intermediate metricIDs occupy more than -search.maxIndexSearchMemory=%d bytes after applying the filter %s; "+
+		"either use more specific filters or increase -search.maxIndexSearchMemory", errIndexSearchMemoryLimitExceeded, maxIndexSearchMemory, filter)
+}
+
 func (is *indexSearch) searchMetricIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int) ([]uint64, error) {
+	var setBytesUsed uint64
+	is.setBytesUsed = &setBytesUsed
+	defer func() {
+		is.setBytesUsed = nil
+	}()
+
 	metricIDs := &uint64set.Set{}
 	for _, tfs := range tfss {
 		if len(tfs.tfs) == 0 {
@@ -1942,16 +2537,28 @@ func (is *indexSearch) searchMetricIDs(tfss []*TagFilters, tr TimeRange, maxMetr
 				return nil, err
 			}
 			if metricIDs.Len() > maxMetrics {
-				return nil, fmt.Errorf("the number of unique timeseries exceeds %d; either narrow down the search or increase -search.maxUniqueTimeseries", maxMetrics)
+				return nil, newTooManyTimeseriesError("the number of unique timeseries exceeds %d; either narrow down the search or increase -search.maxUniqueTimeseries", maxMetrics)
 			}
 			// Stop the iteration, since we cannot find more metric ids with the remaining tfss.
 			break
 		}
-		if err := is.updateMetricIDsForTagFilters(metricIDs, tfs, tr, maxMetrics+1); err != nil {
+		if err := is.getTooManyMetricsVerdict(tfs, tr, maxMetrics); err != nil {
+			// Fast path - tfs matched too many time series during the recent search with the same args.
+			atomic.AddUint64(&is.db.tooManyMetricsVerdictHits, 1)
 			return nil, err
 		}
-		if metricIDs.Len() > maxMetrics {
-			return nil, fmt.Errorf("the number of matching unique timeseries exceeds %d; either narrow down the search or increase -search.maxUniqueTimeseries", maxMetrics)
+		metricIDsLen := metricIDs.Len()
+		err := is.updateMetricIDsForTagFilters(metricIDs, tfs, tr, maxMetrics+1)
+		if err == nil && metricIDs.Len() > maxMetrics {
+			err = newTooManyTimeseriesError("the number of matching unique timeseries exceeds %d; either narrow down the search or increase -search.maxUniqueTimeseries", maxMetrics)
+		}
+		if err != nil {
+			var e *tooManyTimeseriesError
+			if errors.As(err, &e) && metricIDsLen == 0 {
+				// tfs alone matches too many time series. Remember this, so repeated searches fail fast.
+				is.storeTooManyMetricsVerdict(tfs, tr, maxMetrics, e)
+			}
+			return nil, err
 		}
 	}
 	if metricIDs.Len() == 0 {
@@ -1976,7 +2583,82 @@ func (is *indexSearch) searchMetricIDs(tfss []*TagFilters, tr TimeRange, maxMetr
 	return sortedMetricIDs, nil
 }
 
+// tooManyMetricsVerdictTTL is the duration for caching the verdict that tag filters match too many time series.
+//
+// The verdict is cached for short duration only, since the number of matching time series
+// may decrease after old series go out of the searched time range.
+const tooManyMetricsVerdictTTL = time.Minute
+
+func (is *indexSearch) marshalTooManyMetricsVerdictKey(dst []byte, tfs *TagFilters, tr TimeRange, maxMetrics int) []byte {
+	// Use dates instead of exact timestamps for the time range, since the per-day inverted index
+	// returns the same time series for the time ranges covering the same dates.
+	// This allows caching the verdict for dashboards with relative time ranges.
+	dst = append(dst, uselessTooManyMetricsKeyPrefix)
+	dst = encoding.MarshalUint64(dst, uint64(maxMetrics))
+	dst = encoding.MarshalUint64(dst, uint64(tr.MinTimestamp)/msecPerDay)
+	dst = encoding.MarshalUint64(dst, uint64(tr.MaxTimestamp)/msecPerDay)
+	dst = tfs.marshal(dst)
+	return dst
+}
+
+// getTooManyMetricsVerdict returns the cached error for tfs, tr and maxMetrics if tfs matched too many time series recently.
+func (is *indexSearch) getTooManyMetricsVerdict(tfs *TagFilters, tr TimeRange, maxMetrics int) error {
+	kb := kbPool.Get()
+	defer kbPool.Put(kb)
+	kb.B = is.marshalTooManyMetricsVerdictKey(kb.B[:0], tfs, tr, maxMetrics)
+	buf := is.db.uselessTagFiltersCache.Get(nil, kb.B)
+	if len(buf) < 8 {
+		return nil
+	}
+	deadline := encoding.UnmarshalUint64(buf)
+	if fasttime.UnixTimestamp() >= deadline {
+		return nil
+	}
+	return &tooManyTimeseriesError{
+		msg: string(buf[8:]),
+	}
+}
+
+func (is *indexSearch) storeTooManyMetricsVerdict(tfs *TagFilters, tr TimeRange, maxMetrics int, e *tooManyTimeseriesError) {
+	kb := kbPool.Get()
+	defer kbPool.Put(kb)
+	kb.B = is.marshalTooManyMetricsVerdictKey(kb.B[:0], tfs, tr, maxMetrics)
+	deadline := fasttime.UnixTimestamp() + uint64(tooManyMetricsVerdictTTL.Seconds())
+	buf := encoding.MarshalUint64(nil, deadline)
+	buf = append(buf, e.msg...)
+	is.db.uselessTagFiltersCache.Set(kb.B, buf)
+}
+
+// tooManyTimeseriesError is returned when tag filters match more than maxMetrics time series.
+type tooManyTimeseriesError struct {
+	msg string
+}
+
+func newTooManyTimeseriesError(format string, args ...interface{}) error {
+	return &tooManyTimeseriesError{
+		msg: fmt.Sprintf(format, args...),
+	}
+}
+
+// Error implements error interface.
+func (e *tooManyTimeseriesError) Error() string {
+	return e.msg
+}
+
+// IsLimitExceededError returns true if err is caused by exceeding -search.maxUniqueTimeseries or -search.maxIndexSearchMemory limits.
+func IsLimitExceededError(err error) bool {
+	var e *tooManyTimeseriesError
+	return errors.As(err, &e) || errors.Is(err, errIndexSearchMemoryLimitExceeded)
+}
+
 func (is *indexSearch) updateMetricIDsForTagFilters(metricIDs *uint64set.Set, tfs *TagFilters, tr TimeRange, maxMetrics int) error {
+	if tf := tfs.getSingleMetricGroupFilter(); tf != nil {
+		// Fast path for the most common `metric_name{}` query.
+		err := is.tryUpdatingMetricIDsForSingleMetricGroup(metricIDs, tf, tr, maxMetrics)
+		if err != errFallbackToMetricNameMatch {
+			return err
+		}
+	}
 	err := is.tryUpdatingMetricIDsForDateRange(metricIDs, tfs, tr, maxMetrics)
 	if err == nil {
 		// Fast path: found metricIDs by date range.
@@ -1988,10 +2670,9 @@ func (is *indexSearch) updateMetricIDsForTagFilters(metricIDs *uint64set.Set, tf
 
 	// Slow path - try searching over the whole inverted index.
 
-	// Sort tag filters for faster ts.Seek below.
-	sort.Slice(tfs.tfs, func(i, j int) bool {
-		return tfs.tfs[i].Less(&tfs.tfs[j])
-	})
+	// Sort tag filters by the number of matching metricIDs from previous queries,
+	// so the most selective filters are applied first regardless of their order in the query.
+	is.sortTagFiltersBySelectivity(tfs)
 	minTf, minMetricIDs, err := is.getTagFilterWithMinMetricIDsCountOptimized(tfs, tr, maxMetrics)
 	if err != nil {
 		return err
@@ -2040,6 +2721,7 @@ const (
 	uselessMultiTagFiltersKeyPrefix   = 1
 	uselessNegativeTagFilterKeyPrefix = 2
 	uselessTagIntersectKeyPrefix      = 3
+	uselessTooManyMetricsKeyPrefix    = 4
 )
 
 var uselessTagFilterCacheValue = []byte("1")
@@ -2093,7 +2775,7 @@ func (is *indexSearch) getMetricIDsForTagFilterSlow(tf *tagFilter, maxLoops int,
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterMediumIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return err
 			}
 		}
@@ -2217,7 +2899,7 @@ func (is *indexSearch) updateMetricIDsForOrSuffixNoFilter(prefix []byte, maxMetr
 	ts.Seek(prefix)
 	for metricIDs.Len() < maxMetrics && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return err
 			}
 		}
@@ -2259,7 +2941,7 @@ func (is *indexSearch) updateMetricIDsForOrSuffixWithFilter(prefix []byte, metri
 	var metricID uint64
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterMediumIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return err
 			}
 		}
@@ -2373,6 +3055,7 @@ func (is *indexSearch) getMetricIDsForTimeRange(tr TimeRange, maxMetrics int) (*
 			defer wg.Done()
 			isLocal := is.db.getIndexSearch(is.deadline)
 			defer is.db.putIndexSearch(isLocal)
+			isLocal.stopCh = is.stopCh
 			m, err := isLocal.getMetricIDsForDate(date, maxMetrics)
 			mu.Lock()
 			defer mu.Unlock()
@@ -2397,6 +3080,42 @@ func (is *indexSearch) getMetricIDsForTimeRange(tr TimeRange, maxMetrics int) (*
 	return metricIDs, nil
 }
 
+// tryUpdatingMetricIDsForSingleMetricGroup adds metricIDs for the metric name from tf, which were active on the given tr.
+//
+// It scans (date, __name__=value) -> metricIDs rows in the per-day inverted index directly without the overhead
+// of generic tag filters search such as sorting, intersecting and postponing tag filters.
+//
+// errFallbackToMetricNameMatch is returned if the per-day inverted index cannot be used for the search.
+func (is *indexSearch) tryUpdatingMetricIDsForSingleMetricGroup(metricIDs *uint64set.Set, tf *tagFilter, tr TimeRange, maxMetrics int) error {
+	minDate := uint64(tr.MinTimestamp) / msecPerDay
+	maxDate := uint64(tr.MaxTimestamp) / msecPerDay
+	if minDate < is.db.startDateForPerDayInvertedIndex || maxDate < minDate || maxDate-minDate > maxDaysForDateMetricIDs {
+		return errFallbackToMetricNameMatch
+	}
+	atomic.AddUint64(&is.db.singleMetricGroupSearchCalls, 1)
+	kb := kbPool.Get()
+	defer kbPool.Put(kb)
+	m := &uint64set.Set{}
+	for date := minDate; date <= maxDate; date++ {
+		kb.B = is.marshalCommonPrefix(kb.B[:0], nsPrefixDateTagToMetricIDs)
+		kb.B = encoding.MarshalUint64(kb.B, date)
+		kb.B = append(kb.B, tf.prefix[commonPrefixLen:]...)
+		kb.B = append(kb.B, tagSeparatorChar)
+		if err := is.updateMetricIDsForOrSuffixNoFilter(kb.B, maxMetrics, m); err != nil {
+			return err
+		}
+		if m.Len() >= maxMetrics {
+			break
+		}
+	}
+	if err := is.accountSetMemory(tf, m); err != nil {
+		return err
+	}
+	metricIDs.UnionMayOwn(m)
+	atomic.AddUint64(&is.db.singleMetricGroupSearchHits, 1)
+	return nil
+}
+
 func (is *indexSearch) tryUpdatingMetricIDsForDateRange(metricIDs *uint64set.Set, tfs *TagFilters, tr TimeRange, maxMetrics int) error {
 	atomic.AddUint64(&is.db.dateRangeSearchCalls, 1)
 	minDate := uint64(tr.MinTimestamp) / msecPerDay
@@ -2430,6 +3149,8 @@ func (is *indexSearch) tryUpdatingMetricIDsForDateRange(metricIDs *uint64set.Set
 			defer wg.Done()
 			isLocal := is.db.getIndexSearch(is.deadline)
 			defer is.db.putIndexSearch(isLocal)
+			isLocal.stopCh = is.stopCh
+			isLocal.setBytesUsed = is.setBytesUsed
 			m, err := isLocal.getMetricIDsForDateAndFilters(date, tfs, maxMetrics)
 			mu.Lock()
 			defer mu.Unlock()
@@ -2534,6 +3255,9 @@ func (is *indexSearch) getMetricIDsForDateAndFilters(date uint64, tfs *TagFilter
 			}
 			return nil, fmt.Errorf("cannot obtain all the metricIDs: %w", err)
 		}
+		if err := is.accountSetMemory(nil, m); err != nil {
+			return nil, err
+		}
 		if m.Len() >= maxDateMetrics {
 			// Too many time series found for the given (date). Fall back to global search.
 			return nil, errFallbackToMetricNameMatch
@@ -2756,7 +3480,13 @@ func (is *indexSearch) getMetricIDsForDateTagFilter(tf *tagFilter, date uint64,
 	}
 	kb.B = encoding.MarshalUint64(kb.B[:0], metricIDsLen)
 	is.db.metricIDsPerDateTagFilterCache.Set(is.kb.B, kb.B)
-	return metricIDs, err
+	if err != nil {
+		return nil, err
+	}
+	if err := is.accountSetMemory(tf, metricIDs); err != nil {
+		return nil, err
+	}
+	return metricIDs, nil
 }
 
 func appendDateTagFilterCacheKey(dst []byte, date uint64, tf *tagFilter) []byte {
@@ -2765,6 +3495,81 @@ func appendDateTagFilterCacheKey(dst []byte, date uint64, tf *tagFilter) []byte
 	return dst
 }
 
+// globalTagFilterCacheDate is the date used in metricIDsPerDateTagFilterCache keys
+// for the number of metricIDs matching tag filters in the global inverted index.
+//
+// It cannot clash with real dates, since they are limited by int64 timestamps in milliseconds.
+const globalTagFilterCacheDate = math.MaxUint64
+
+// storeTagFilterSelectivity stores the number of metricIDs matching tf in the global inverted index,
+// so sortTagFiltersBySelectivity could order tag filters by selectivity on the next search.
+//
+// metricIDs and err must be obtained from getMetricIDsForTagFilter called with maxMetrics.
+func (is *indexSearch) storeTagFilterSelectivity(tf *tagFilter, metricIDs *uint64set.Set, maxMetrics int, err error) {
+	var count uint64
+	switch {
+	case err == nil && metricIDs.Len() < maxMetrics:
+		count = uint64(metricIDs.Len())
+	case err == nil || err == errFallbackToMetricNameMatch:
+		// The tf matches at least maxMetrics metricIDs.
+		count = uint64(maxMetrics)
+	default:
+		return
+	}
+	kb := kbPool.Get()
+	kb.B = appendDateTagFilterCacheKey(kb.B[:0], globalTagFilterCacheDate, tf)
+	var buf [8]byte
+	is.db.metricIDsPerDateTagFilterCache.Set(kb.B, encoding.MarshalUint64(buf[:0], count))
+	kbPool.Put(kb)
+}
+
+// sortTagFiltersBySelectivity sorts tfs by the number of matching metricIDs stored via storeTagFilterSelectivity.
+//
+// Positive tag filters without stored stats go first, so the stats for them are collected during the current search.
+// Negative tag filters go last. Tag filters with equal stats are sorted with tagFilter.Less for faster ts.Seek.
+func (is *indexSearch) sortTagFiltersBySelectivity(tfs *TagFilters) {
+	tfsc := &tagFiltersWithCounts{
+		tfs:    tfs.tfs,
+		counts: make([]uint64, len(tfs.tfs)),
+	}
+	kb := &is.kb
+	var buf []byte
+	for i := range tfs.tfs {
+		kb.B = appendDateTagFilterCacheKey(kb.B[:0], globalTagFilterCacheDate, &tfs.tfs[i])
+		buf = is.db.metricIDsPerDateTagFilterCache.Get(buf[:0], kb.B)
+		if len(buf) == 8 {
+			tfsc.counts[i] = encoding.UnmarshalUint64(buf)
+		}
+	}
+	sort.Sort(tfsc)
+}
+
+type tagFiltersWithCounts struct {
+	tfs    []tagFilter
+	counts []uint64
+}
+
+func (tfsc *tagFiltersWithCounts) Len() int {
+	return len(tfsc.tfs)
+}
+
+func (tfsc *tagFiltersWithCounts) Less(i, j int) bool {
+	a, b := &tfsc.tfs[i], &tfsc.tfs[j]
+	if a.isNegative != b.isNegative {
+		// Negative filters have no stats, since they are applied only via intersection. Move them to the end.
+		return !a.isNegative
+	}
+	if tfsc.counts[i] != tfsc.counts[j] {
+		return tfsc.counts[i] < tfsc.counts[j]
+	}
+	return a.Less(b)
+}
+
+func (tfsc *tagFiltersWithCounts) Swap(i, j int) {
+	tfsc.tfs[i], tfsc.tfs[j] = tfsc.tfs[j], tfsc.tfs[i]
+	tfsc.counts[i], tfsc.counts[j] = tfsc.counts[j], tfsc.counts[i]
+}
+
 func (is *indexSearch) getMetricIDsForDate(date uint64, maxMetrics int) (*uint64set.Set, error) {
 	// Extract all the metricIDs from (date, __name__=value)->metricIDs entries.
 	kb := kbPool.Get()
@@ -2800,7 +3605,7 @@ func (is *indexSearch) updateMetricIDsForPrefix(prefix []byte, metricIDs *uint64
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return err
 			}
 		}
@@ -2,12 +2,14 @@ package storage
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"os"
 	"reflect"
 	"regexp"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -406,6 +408,49 @@ func TestRemoveDuplicateMetricIDs(t *testing.T) {
 	f([]uint64{0, 1, 2, 2}, []uint64{0, 1, 2})
 }
 
+func TestIndexSearchAccountSetMemory(t *testing.T) {
+	defer SetMaxIndexSearchMemory(0)
+
+	newSet := func(n int) *uint64set.Set {
+		var s uint64set.Set
+		for i := 0; i < n; i++ {
+			s.Add(uint64(i) << 20)
+		}
+		return &s
+	}
+	small := newSet(10)
+	big := newSet(1000)
+	limit := big.SizeBytes()
+	SetMaxIndexSearchMemory(int(limit))
+
+	var setBytesUsed uint64
+	is := &indexSearch{
+		db:           &indexDB{},
+		setBytesUsed: &setBytesUsed,
+	}
+
+	// The peak memory must be tracked instead of the sum of all the sets.
+	for i := 0; i < 10; i++ {
+		if err := is.accountSetMemory(nil, big); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := is.accountSetMemory(nil, small); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if setBytesUsed != limit {
+		t.Fatalf("unexpected peak memory; got %d; want %d", setBytesUsed, limit)
+	}
+
+	// The limit is exceeded by a set bigger than the limit.
+	if err := is.accountSetMemory(nil, newSet(1e5)); !errors.Is(err, errIndexSearchMemoryLimitExceeded) {
+		t.Fatalf("expecting errIndexSearchMemoryLimitExceeded; got %v", err)
+	}
+	if n := atomic.LoadUint64(&is.db.indexSearchMemoryLimitExceeded); n != 1 {
+		t.Fatalf("unexpected number of searches exceeding the limit; got %d; want 1", n)
+	}
+}
+
 func TestMarshalUnmarshalTSIDs(t *testing.T) {
 	f := func(tsids []TSID) {
 		t.Helper()
@@ -472,6 +517,93 @@ func TestIndexDBOpenClose(t *testing.T) {
 	}
 }
 
+func TestIndexDBSortTagFiltersBySelectivity(t *testing.T) {
+	metricIDCache := workingsetcache.New(1234, time.Hour)
+	metricNameCache := workingsetcache.New(1234, time.Hour)
+	tsidCache := workingsetcache.New(1234, time.Hour)
+	defer metricIDCache.Stop()
+	defer metricNameCache.Stop()
+	defer tsidCache.Stop()
+
+	var hmCurr atomic.Value
+	hmCurr.Store(&hourMetricIDs{})
+	var hmPrev atomic.Value
+	hmPrev.Store(&hourMetricIDs{})
+
+	dbName := "test-index-db-sort-tag-filters-by-selectivity"
+	db, err := openIndexDB(dbName, metricIDCache, metricNameCache, tsidCache, &hmCurr, &hmPrev)
+	if err != nil {
+		t.Fatalf("cannot open indexDB: %s", err)
+	}
+	defer func() {
+		db.MustClose()
+		if err := os.RemoveAll(dbName); err != nil {
+			t.Fatalf("cannot remove indexDB: %s", err)
+		}
+	}()
+
+	// Create series with a common `j` label and a unique `n` label.
+	is := db.getIndexSearch(noDeadline)
+	date := uint64(timestampFromTime(time.Now())) / msecPerDay
+	var metricNameBuf []byte
+	for i := 0; i < 100; i++ {
+		var mn MetricName
+		mn.MetricGroup = []byte("testMetric")
+		mn.AddTag("j", "foo")
+		mn.AddTag("n", fmt.Sprintf("%d", i))
+		mn.sortTags()
+		metricNameBuf = mn.Marshal(metricNameBuf[:0])
+		var tsid TSID
+		if err := is.GetOrCreateTSIDByName(&tsid, metricNameBuf); err != nil {
+			t.Fatalf("unexpected error when creating tsid for mn:\n%s: %s", &mn, err)
+		}
+		if err := is.storeDateMetricID(date, tsid.MetricID); err != nil {
+			t.Fatalf("error in storeDateMetricID(%d, %d): %s", date, tsid.MetricID, err)
+		}
+	}
+	db.putIndexSearch(is)
+	db.tb.DebugFlush()
+
+	newTagFilters := func(labels ...string) *TagFilters {
+		t.Helper()
+		tfs := NewTagFilters()
+		for i := 0; i < len(labels); i += 2 {
+			if err := tfs.Add([]byte(labels[i]), []byte(labels[i+1]), false, false); err != nil {
+				t.Fatalf("cannot add tag filter: %s", err)
+			}
+		}
+		return tfs
+	}
+	search := func(tfs *TagFilters) []TSID {
+		t.Helper()
+		tsids, err := db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
+		if err != nil {
+			t.Fatalf("unexpected error in searchTSIDs: %s", err)
+		}
+		return tsids
+	}
+
+	// The results mustn't depend on the order of tag filters.
+	tsids1 := search(newTagFilters("j", "foo", "n", "1"))
+	tsids2 := search(newTagFilters("n", "1", "j", "foo"))
+	if len(tsids1) != 1 {
+		t.Fatalf("unexpected number of tsids found; got %d; want 1", len(tsids1))
+	}
+	if !reflect.DeepEqual(tsids1, tsids2) {
+		t.Fatalf("unexpected tsids for reordered tag filters;\ngot\n%+v\nwant\n%+v", tsids2, tsids1)
+	}
+
+	// The most selective tag filter must go first regardless of its position in the query.
+	for _, tfs := range []*TagFilters{newTagFilters("j", "foo", "n", "1"), newTagFilters("n", "1", "j", "foo")} {
+		is := db.getIndexSearch(noDeadline)
+		is.sortTagFiltersBySelectivity(tfs)
+		db.putIndexSearch(is)
+		if key := string(tfs.tfs[0].key); key != "n" {
+			t.Fatalf("unexpected first tag filter after sorting %s; got key %q; want %q", tfs, key, "n")
+		}
+	}
+}
+
 func TestIndexDB(t *testing.T) {
 	const metricGroups = 10
 
@@ -842,7 +974,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		if err := tfs.Add(nil, nil, true, false); err != nil {
 			return fmt.Errorf("cannot add no-op negative filter: %w", err)
 		}
-		tsidsFound, err := db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err := db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search by exact tag filter: %w", err)
 		}
@@ -851,7 +983,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		}
 
 		// Verify tag cache.
-		tsidsCached, err := db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsCached, err := db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search by exact tag filter: %w", err)
 		}
@@ -863,7 +995,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		if err := tfs.Add(nil, mn.MetricGroup, true, false); err != nil {
 			return fmt.Errorf("cannot add negative filter for zeroing search results: %w", err)
 		}
-		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search by exact tag filter with full negative: %w", err)
 		}
@@ -884,7 +1016,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		if tfsNew := tfs.Finalize(); len(tfsNew) > 0 {
 			return fmt.Errorf("unexpected non-empty tag filters returned by TagFilters.Finalize: %v", tfsNew)
 		}
-		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search by regexp tag filter for Graphite wildcard: %w", err)
 		}
@@ -912,7 +1044,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		if err := tfs.Add(nil, nil, true, true); err != nil {
 			return fmt.Errorf("cannot add no-op negative filter with regexp: %w", err)
 		}
-		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search by regexp tag filter: %w", err)
 		}
@@ -922,7 +1054,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		if err := tfs.Add(nil, mn.MetricGroup, true, true); err != nil {
 			return fmt.Errorf("cannot add negative filter for zeroing search results: %w", err)
 		}
-		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search by regexp tag filter with full negative: %w", err)
 		}
@@ -938,7 +1070,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		if err := tfs.Add(nil, mn.MetricGroup, false, true); err != nil {
 			return fmt.Errorf("cannot create tag filter for MetricGroup matching zero results: %w", err)
 		}
-		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search by non-existing tag filter: %w", err)
 		}
@@ -954,7 +1086,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 
 		// Search with empty filter. It should match all the results.
 		tfs.Reset()
-		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search for common prefix: %w", err)
 		}
@@ -967,7 +1099,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		if err := tfs.Add(nil, nil, false, false); err != nil {
 			return fmt.Errorf("cannot create tag filter for empty metricGroup: %w", err)
 		}
-		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search for empty metricGroup: %w", err)
 		}
@@ -984,7 +1116,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		if err := tfs2.Add(nil, mn.MetricGroup, false, false); err != nil {
 			return fmt.Errorf("cannot create tag filter for MetricGroup: %w", err)
 		}
-		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs1, tfs2}, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs([]*TagFilters{tfs1, tfs2}, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search for empty metricGroup: %w", err)
 		}
@@ -993,7 +1125,7 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 		}
 
 		// Verify empty tfss
-		tsidsFound, err = db.searchTSIDs(nil, TimeRange{}, 1e5, noDeadline)
+		tsidsFound, err = db.searchTSIDs(nil, TimeRange{}, 1e5, noDeadline, nil)
 		if err != nil {
 			return fmt.Errorf("cannot search for nil tfss: %w", err)
 		}
@@ -1037,6 +1169,25 @@ func TestMatchTagFilters(t *testing.T) {
 		t.Fatalf("should match")
 	}
 
+	// Graphite-like metric names must match regexp filters with dotted suffix,
+	// which add artificial reverse tag filter.
+	var mnGraphite MetricName
+	mnGraphite.MetricGroup = append(mnGraphite.MetricGroup, "foo.bar.baz"...)
+	tfs.Reset()
+	if err := tfs.Add([]byte("__graphite__"), []byte("foo.*.baz"), false, false); err != nil {
+		t.Fatalf("cannot add filter: %s", err)
+	}
+	if len(tfs.tfs) != 2 {
+		t.Fatalf("expecting reverse tag filter for Graphite wildcard; got %s", &tfs)
+	}
+	ok, err = matchTagFilters(&mnGraphite, toTFPointers(tfs.tfs), &bb)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ok {
+		t.Fatalf("should match")
+	}
+
 	// Empty tag filters should match.
 	tfs.Reset()
 	ok, err = matchTagFilters(&mn, toTFPointers(tfs.tfs), &bb)
@@ -1573,7 +1724,7 @@ func TestSearchTSIDWithTimeRange(t *testing.T) {
 		MinTimestamp: int64(now - msecPerHour + 1),
 		MaxTimestamp: int64(now),
 	}
-	matchedTSIDs, err := db.searchTSIDs([]*TagFilters{tfs}, tr, 10000, noDeadline)
+	matchedTSIDs, err := db.searchTSIDs([]*TagFilters{tfs}, tr, 10000, noDeadline, nil)
 	if err != nil {
 		t.Fatalf("error searching tsids: %v", err)
 	}
@@ -1587,7 +1738,7 @@ func TestSearchTSIDWithTimeRange(t *testing.T) {
 		MinTimestamp: int64(now - 2*msecPerHour - 1),
 		MaxTimestamp: int64(now),
 	}
-	matchedTSIDs, err = db.searchTSIDs([]*TagFilters{tfs}, tr, 10000, noDeadline)
+	matchedTSIDs, err = db.searchTSIDs([]*TagFilters{tfs}, tr, 10000, noDeadline, nil)
 	if err != nil {
 		t.Fatalf("error searching tsids: %v", err)
 	}
@@ -1601,7 +1752,7 @@ func TestSearchTSIDWithTimeRange(t *testing.T) {
 		MaxTimestamp: int64(now),
 	}
 
-	matchedTSIDs, err = db.searchTSIDs([]*TagFilters{tfs}, tr, 10000, noDeadline)
+	matchedTSIDs, err = db.searchTSIDs([]*TagFilters{tfs}, tr, 10000, noDeadline, nil)
 	if err != nil {
 		t.Fatalf("error searching tsids: %v", err)
 	}
@@ -1609,6 +1760,60 @@ func TestSearchTSIDWithTimeRange(t *testing.T) {
 		t.Fatal("Expected time series for all days, got", len(matchedTSIDs))
 	}
 
+	// Perform a search by a single metric name within the current day via per-day inverted index.
+	// This should return the metrics for the day
+	startDateForPerDayInvertedIndex := db.startDateForPerDayInvertedIndex
+	db.startDateForPerDayInvertedIndex = 0
+	tfsMetricName := NewTagFilters()
+	if err := tfsMetricName.Add(nil, []byte("testMetric"), false, false); err != nil {
+		t.Fatalf("cannot add filter: %s", err)
+	}
+	trDay := TimeRange{
+		MinTimestamp: int64(now - 2*msecPerHour - 1),
+		MaxTimestamp: int64(now),
+	}
+	matchedTSIDs, err = db.searchTSIDs([]*TagFilters{tfsMetricName}, trDay, 10000, noDeadline, nil)
+	db.startDateForPerDayInvertedIndex = startDateForPerDayInvertedIndex
+	if err != nil {
+		t.Fatalf("error searching tsids: %v", err)
+	}
+	if len(matchedTSIDs) != metricsPerDay {
+		t.Fatal("Expected time series for current day by metric name, got", len(matchedTSIDs))
+	}
+	if n := atomic.LoadUint64(&db.singleMetricGroupSearchHits); n != 1 {
+		t.Fatalf("unexpected number of singleMetricGroupSearchHits; got %d; want 1", n)
+	}
+
+	// The search must fail if tfs match more than maxMetrics time series.
+	// The repeated search must fail fast because of the cached verdict.
+	for i := 0; i < 2; i++ {
+		isLocal := db.getIndexSearch(noDeadline)
+		_, err := isLocal.searchMetricIDs([]*TagFilters{tfs}, tr, 100)
+		db.putIndexSearch(isLocal)
+		if err == nil {
+			t.Fatalf("expecting non-nil error when searching for more than 100 time series")
+		}
+	}
+	if n := atomic.LoadUint64(&db.tooManyMetricsVerdictHits); n != 1 {
+		t.Fatalf("unexpected number of tooManyMetricsVerdictHits; got %d; want 1", n)
+	}
+
+	// The search must fail if intermediate metricIDs exceed the memory limit.
+	// Use distinct filter in order to avoid hitting the tag cache.
+	tfsLimited := NewTagFilters()
+	if err := tfsLimited.Add([]byte("constant"), []byte("co.+"), false, true); err != nil {
+		t.Fatalf("cannot add filter: %s", err)
+	}
+	SetMaxIndexSearchMemory(100)
+	_, err = db.searchTSIDs([]*TagFilters{tfsLimited}, tr, 10000, noDeadline, nil)
+	SetMaxIndexSearchMemory(0)
+	if !errors.Is(err, errIndexSearchMemoryLimitExceeded) {
+		t.Fatalf("expecting errIndexSearchMemoryLimitExceeded; got %v", err)
+	}
+	if !strings.Contains(err.Error(), `constant=~"co.+"`) {
+		t.Fatalf("the error must contain the offending filter; got %v", err)
+	}
+
 	// Check GetTSDBStatusForDate
 	status, err := db.GetTSDBStatusForDate(baseDate, 5, noDeadline)
 	if err != nil {
@@ -1672,6 +1877,69 @@ func TestSearchTSIDWithTimeRange(t *testing.T) {
 	if !reflect.DeepEqual(status.SeriesCountByLabelValuePair, expectedSeriesCountByLabelValuePair) {
 		t.Fatalf("unexpected SeriesCountByLabelValuePair;\ngot\n%v\nwant\n%v", status.SeriesCountByLabelValuePair, expectedSeriesCountByLabelValuePair)
 	}
+	if status.TotalSeries != metricsPerDay {
+		t.Fatalf("unexpected TotalSeries; got %d; want %d", status.TotalSeries, metricsPerDay)
+	}
+
+	// Check GetTSDBStatusWithFiltersForDate
+	tfs = NewTagFilters()
+	if err := tfs.Add([]byte("uniqueid"), []byte("1|2|3"), false, true); err != nil {
+		t.Fatalf("cannot add filter: %s", err)
+	}
+	status, err = db.GetTSDBStatusWithFiltersForDate([]*TagFilters{tfs}, baseDate, 5, "uniqueid", 10000, noDeadline)
+	if err != nil {
+		t.Fatalf("error in GetTSDBStatusWithFiltersForDate: %s", err)
+	}
+	if status.TotalSeries != 3 {
+		t.Fatalf("unexpected TotalSeries; got %d; want 3", status.TotalSeries)
+	}
+	expectedSeriesCountByMetricName = []TopHeapEntry{
+		{
+			Name:  "testMetric",
+			Count: 3,
+		},
+	}
+	if !reflect.DeepEqual(status.SeriesCountByMetricName, expectedSeriesCountByMetricName) {
+		t.Fatalf("unexpected SeriesCountByMetricName;\ngot\n%v\nwant\n%v", status.SeriesCountByMetricName, expectedSeriesCountByMetricName)
+	}
+	expectedLabelValueCountByLabelName = []TopHeapEntry{
+		{
+			Name:  "uniqueid",
+			Count: 3,
+		},
+		{
+			Name:  "__name__",
+			Count: 1,
+		},
+		{
+			Name:  "constant",
+			Count: 1,
+		},
+		{
+			Name:  "day",
+			Count: 1,
+		},
+	}
+	if !reflect.DeepEqual(status.LabelValueCountByLabelName, expectedLabelValueCountByLabelName) {
+		t.Fatalf("unexpected LabelValueCountByLabelName;\ngot\n%v\nwant\n%v", status.LabelValueCountByLabelName, expectedLabelValueCountByLabelName)
+	}
+	expectedSeriesCountByFocusLabelValue := []TopHeapEntry{
+		{
+			Name:  "1",
+			Count: 1,
+		},
+		{
+			Name:  "2",
+			Count: 1,
+		},
+		{
+			Name:  "3",
+			Count: 1,
+		},
+	}
+	if !reflect.DeepEqual(status.SeriesCountByFocusLabelValue, expectedSeriesCountByFocusLabelValue) {
+		t.Fatalf("unexpected SeriesCountByFocusLabelValue;\ngot\n%v\nwant\n%v", status.SeriesCountByFocusLabelValue, expectedSeriesCountByFocusLabelValue)
+	}
 }
 
 func toTFPointers(tfs []tagFilter) []*tagFilter {
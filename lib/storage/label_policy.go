@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Policies for labels with invalid names or values.
+const (
+	// labelPolicyAccept stores invalid labels as is.
+	labelPolicyAccept = iota
+
+	// labelPolicySanitize fixes invalid labels before storing them.
+	labelPolicySanitize
+
+	// labelPolicyReject drops rows with invalid labels.
+	labelPolicyReject
+)
+
+var (
+	invalidLabelNamePolicy      = labelPolicyAccept
+	invalidUTF8LabelValuePolicy = labelPolicyAccept
+)
+
+// SetInvalidLabelNamePolicy sets the policy for label names, which don't match Prometheus charset `[a-zA-Z_][a-zA-Z0-9_]*`.
+//
+// Supported policies: `accept` stores label names as is, `sanitize` replaces invalid chars in label names with `_`,
+// `reject` drops rows containing invalid label names.
+//
+// Metric names aren't checked, since they may contain arbitrary chars such as dots in Graphite metric names.
+func SetInvalidLabelNamePolicy(policy string) error {
+	n, err := parseLabelPolicy(policy)
+	if err != nil {
+		return err
+	}
+	invalidLabelNamePolicy = n
+	return nil
+}
+
+// SetInvalidUTF8LabelValuePolicy sets the policy for metric names and label values with invalid UTF-8.
+//
+// Supported policies: `accept` stores label values as is, `sanitize` replaces invalid UTF-8 sequences with U+FFFD char,
+// `reject` drops rows containing invalid UTF-8 in metric names or label values.
+func SetInvalidUTF8LabelValuePolicy(policy string) error {
+	n, err := parseLabelPolicy(policy)
+	if err != nil {
+		return err
+	}
+	invalidUTF8LabelValuePolicy = n
+	return nil
+}
+
+func parseLabelPolicy(policy string) (int, error) {
+	switch policy {
+	case "accept":
+		return labelPolicyAccept, nil
+	case "sanitize":
+		return labelPolicySanitize, nil
+	case "reject":
+		return labelPolicyReject, nil
+	default:
+		return 0, fmt.Errorf("unsupported policy %q; supported policies: accept, sanitize, reject", policy)
+	}
+}
+
+var (
+	// InvalidLabelNames is the number of label names, which don't match Prometheus charset.
+	InvalidLabelNames uint64
+
+	// InvalidUTF8LabelValues is the number of metric names and label values with invalid UTF-8.
+	InvalidUTF8LabelValues uint64
+)
+
+// applyInvalidLabelPolicies applies policies set via SetInvalidLabelNamePolicy and SetInvalidUTF8LabelValuePolicy to mn.
+//
+// It returns true if mn has been sanitized. An error is returned if mn must be rejected.
+func (mn *MetricName) applyInvalidLabelPolicies() (bool, error) {
+	if !hasInvalidLabelPolicies() {
+		// Fast path - nothing to check.
+		return false, nil
+	}
+	sanitized := false
+	if invalidUTF8LabelValuePolicy != labelPolicyAccept && !utf8.Valid(mn.MetricGroup) {
+		atomic.AddUint64(&InvalidUTF8LabelValues, 1)
+		if invalidUTF8LabelValuePolicy == labelPolicyReject {
+			return false, fmt.Errorf("metric name %q contains invalid UTF-8", mn.MetricGroup)
+		}
+		mn.MetricGroup = sanitizeUTF8(mn.MetricGroup)
+		sanitized = true
+	}
+	var sanitizedKeys []int
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		if invalidLabelNamePolicy != labelPolicyAccept && !isValidLabelName(tag.Key) {
+			atomic.AddUint64(&InvalidLabelNames, 1)
+			if invalidLabelNamePolicy == labelPolicyReject {
+				return false, fmt.Errorf("label name %q doesn't match Prometheus charset [a-zA-Z_][a-zA-Z0-9_]*", tag.Key)
+			}
+			tag.Key = sanitizeLabelName(tag.Key)
+			sanitizedKeys = append(sanitizedKeys, i)
+			sanitized = true
+		}
+		if invalidUTF8LabelValuePolicy != labelPolicyAccept && !utf8.Valid(tag.Value) {
+			atomic.AddUint64(&InvalidUTF8LabelValues, 1)
+			if invalidUTF8LabelValuePolicy == labelPolicyReject {
+				return false, fmt.Errorf("value for label %q contains invalid UTF-8: %q", tag.Key, tag.Value)
+			}
+			tag.Value = sanitizeUTF8(tag.Value)
+			sanitized = true
+		}
+	}
+	if len(sanitizedKeys) > 0 {
+		mn.removeDuplicateSanitizedKeys(sanitizedKeys)
+	}
+	return sanitized, nil
+}
+
+// removeDuplicateSanitizedKeys removes tags with sanitized keys, which clash with other tags in mn.
+//
+// For example, `a.b` and `a_b` labels have the same `a_b` name after sanitizing. Tags with originally valid keys are preserved,
+// while only the first tag is preserved among tags with sanitized keys.
+func (mn *MetricName) removeDuplicateSanitizedKeys(sanitizedKeys []int) {
+	isSanitized := func(i int) bool {
+		for _, n := range sanitizedKeys {
+			if n == i {
+				return true
+			}
+		}
+		return false
+	}
+	isDuplicate := func(i int) bool {
+		key := mn.Tags[i].Key
+		for j := range mn.Tags {
+			if j == i || string(mn.Tags[j].Key) != string(key) {
+				continue
+			}
+			if !isSanitized(j) || j < i {
+				return true
+			}
+		}
+		return false
+	}
+	var duplicates []int
+	for _, i := range sanitizedKeys {
+		if isDuplicate(i) {
+			duplicates = append(duplicates, i)
+		}
+	}
+	if len(duplicates) == 0 {
+		return
+	}
+	tags := mn.Tags[:0]
+	for i := range mn.Tags {
+		isDup := false
+		for _, n := range duplicates {
+			if n == i {
+				isDup = true
+				break
+			}
+		}
+		if !isDup {
+			tags = append(tags, mn.Tags[i])
+		}
+	}
+	for i := len(tags); i < len(mn.Tags); i++ {
+		mn.Tags[i] = Tag{}
+	}
+	mn.Tags = tags
+}
+
+func hasInvalidLabelPolicies() bool {
+	return invalidLabelNamePolicy != labelPolicyAccept || invalidUTF8LabelValuePolicy != labelPolicyAccept
+}
+
+// labelPolicyApplier applies invalid label policies to raw metric names before the tsidCache lookup.
+//
+// tsidCache may contain entries for invalid metric names registered before the policies were set,
+// so the policies must be applied to raw metric names before the lookup.
+type labelPolicyApplier struct {
+	mn MetricName
+
+	lastMetricNameRaw []byte
+	lastResult        []byte
+	lastErr           error
+}
+
+// applyToRow applies invalid label policies to mr.MetricNameRaw.
+//
+// It returns a copy of mr with the sanitized raw metric name if mr needs sanitizing, since mr may be shared with the caller.
+// Otherwise mr is returned. An error is returned if mr must be rejected.
+func (lpa *labelPolicyApplier) applyToRow(mr *MetricRow) (*MetricRow, error) {
+	metricNameRawSanitized, err := lpa.apply(mr.MetricNameRaw)
+	if err != nil {
+		return nil, err
+	}
+	if metricNameRawSanitized == nil {
+		return mr, nil
+	}
+	mrSanitized := *mr
+	mrSanitized.MetricNameRaw = metricNameRawSanitized
+	return &mrSanitized, nil
+}
+
+// apply applies invalid label policies to metricNameRaw.
+//
+// It returns the sanitized raw metric name or nil if metricNameRaw doesn't need sanitizing. An error is returned if metricNameRaw must be rejected.
+func (lpa *labelPolicyApplier) apply(metricNameRaw []byte) ([]byte, error) {
+	if string(metricNameRaw) == string(lpa.lastMetricNameRaw) {
+		// Fast path - bulk import of many rows for the same metric.
+		return lpa.lastResult, lpa.lastErr
+	}
+	result, err := lpa.applyInternal(metricNameRaw)
+	lpa.lastMetricNameRaw = metricNameRaw
+	lpa.lastResult = result
+	lpa.lastErr = err
+	return result, err
+}
+
+func (lpa *labelPolicyApplier) applyInternal(metricNameRaw []byte) ([]byte, error) {
+	mn := &lpa.mn
+	if err := mn.unmarshalRaw(metricNameRaw); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal MetricNameRaw %q: %w", metricNameRaw, err)
+	}
+	sanitized, err := mn.applyInvalidLabelPolicies()
+	if err != nil {
+		return nil, fmt.Errorf("cannot add row for MetricNameRaw %q: %w", metricNameRaw, err)
+	}
+	if !sanitized {
+		return nil, nil
+	}
+	// Allocate new buffer for the sanitized metric name, since it may be referred by pending rows.
+	return mn.marshalRaw(nil), nil
+}
+
+func isValidLabelName(name []byte) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i, c := range name {
+		if !isLabelNameChar(c, i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func sanitizeLabelName(name []byte) []byte {
+	dst := make([]byte, 0, len(name))
+	for _, r := range string(name) {
+		if r < utf8.RuneSelf && isLabelNameChar(byte(r), len(dst) == 0) {
+			dst = append(dst, byte(r))
+		} else {
+			dst = append(dst, '_')
+		}
+	}
+	return dst
+}
+
+func isLabelNameChar(c byte, isFirst bool) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || !isFirst && c >= '0' && c <= '9'
+}
+
+func sanitizeUTF8(s []byte) []byte {
+	return []byte(strings.ToValidUTF8(string(s), "\uFFFD"))
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApplyInvalidLabelPolicies(t *testing.T) {
+	f := func(namePolicy, valuePolicy string, mn *MetricName, resultExpected string) {
+		t.Helper()
+		if err := SetInvalidLabelNamePolicy(namePolicy); err != nil {
+			t.Fatalf("cannot set label name policy: %s", err)
+		}
+		if err := SetInvalidUTF8LabelValuePolicy(valuePolicy); err != nil {
+			t.Fatalf("cannot set label value policy: %s", err)
+		}
+		defer func() {
+			invalidLabelNamePolicy = labelPolicyAccept
+			invalidUTF8LabelValuePolicy = labelPolicyAccept
+		}()
+		_, err := mn.applyInvalidLabelPolicies()
+		if resultExpected == "" {
+			if err == nil {
+				t.Fatalf("expecting non-nil error")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := mn.String(); result != resultExpected {
+			t.Fatalf("unexpected result; got %s; want %s", result, resultExpected)
+		}
+	}
+	newMetricName := func(name string, kvs ...string) *MetricName {
+		var mn MetricName
+		mn.MetricGroup = []byte(name)
+		for i := 0; i < len(kvs); i += 2 {
+			mn.AddTag(kvs[i], kvs[i+1])
+		}
+		return &mn
+	}
+
+	// accept policy
+	f("accept", "accept", newMetricName("foo.bar", "a-b", "c\xff"), `MetricGroup="foo.bar", tags=["a-b"="c\xff"]`)
+
+	// valid labels
+	f("reject", "reject", newMetricName("foo.bar", "_a1", "ок", "B", "x"), `MetricGroup="foo.bar", tags=["B"="x", "_a1"="ок"]`)
+
+	// sanitize policy
+	f("sanitize", "sanitize", newMetricName("foo\xff", "1a-bц", "c\xffd", "e", "f"), `MetricGroup="foo�", tags=["_a_b_"="c�d", "e"="f"]`)
+	f("sanitize", "accept", newMetricName("foo", "a.b", "c\xff"), `MetricGroup="foo", tags=["a_b"="c\xff"]`)
+	f("accept", "sanitize", newMetricName("foo", "a.b", "c\xff"), `MetricGroup="foo", tags=["a.b"="c�"]`)
+
+	// sanitized label names clashing with other labels
+	f("sanitize", "accept", newMetricName("foo", "a.b", "x", "a_b", "y"), `MetricGroup="foo", tags=["a_b"="y"]`)
+	f("sanitize", "accept", newMetricName("foo", "a_b", "y", "a.b", "x"), `MetricGroup="foo", tags=["a_b"="y"]`)
+	f("sanitize", "accept", newMetricName("foo", "a.b", "x", "a-b", "y", "c", "z"), `MetricGroup="foo", tags=["a_b"="x", "c"="z"]`)
+
+	// reject policy
+	f("reject", "accept", newMetricName("foo", "a.b", "c"), "")
+	f("accept", "reject", newMetricName("foo", "a", "c\xff"), "")
+	f("accept", "reject", newMetricName("foo\xff", "a", "c"), "")
+	f("reject", "sanitize", newMetricName("foo", "a", "c\xff", "b:c", "d"), "")
+
+	// invalid policy
+	if err := SetInvalidLabelNamePolicy("foo"); err == nil {
+		t.Fatalf("expecting non-nil error for invalid policy")
+	}
+	if err := SetInvalidUTF8LabelValuePolicy(""); err == nil {
+		t.Fatalf("expecting non-nil error for invalid policy")
+	}
+}
+
+func TestStorageInvalidLabelPoliciesWithTSIDCache(t *testing.T) {
+	path := "TestStorageInvalidLabelPoliciesWithTSIDCache"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+	defer func() {
+		invalidLabelNamePolicy = labelPolicyAccept
+		invalidUTF8LabelValuePolicy = labelPolicyAccept
+	}()
+
+	ts := time.Now().UnixNano() / 1e6
+	var mn MetricName
+	mn.MetricGroup = []byte("foo")
+	mn.AddTag("a.b", "c")
+	mr := MetricRow{
+		MetricNameRaw: mn.marshalRaw(nil),
+		Timestamp:     ts,
+		Value:         1,
+	}
+	tr := TimeRange{
+		MinTimestamp: ts - 3600*1000,
+		MaxTimestamp: ts + 3600*1000,
+	}
+	getSeriesCount := func(key string) uint64 {
+		t.Helper()
+		s.debugFlush()
+		tfs := NewTagFilters()
+		if err := tfs.Add([]byte(key), []byte("c"), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		n, err := s.GetSeriesCountWithFilters([]*TagFilters{tfs}, tr, 1e6, noDeadline)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return n
+	}
+
+	// Register the invalid metric name in tsidCache.
+	if err := s.AddRows([]MetricRow{mr}, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	if n := getSeriesCount("a.b"); n != 1 {
+		t.Fatalf("unexpected number of series with the invalid label; got %d; want 1", n)
+	}
+
+	// The sanitize policy must be applied to the cached metric name.
+	if err := SetInvalidLabelNamePolicy("sanitize"); err != nil {
+		t.Fatalf("cannot set label name policy: %s", err)
+	}
+	mr.Timestamp++
+	if err := s.AddRows([]MetricRow{mr}, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	if n := getSeriesCount("a_b"); n != 1 {
+		t.Fatalf("unexpected number of series with the sanitized label; got %d; want 1", n)
+	}
+	if string(mr.MetricNameRaw) != string(mn.marshalRaw(nil)) {
+		t.Fatalf("the caller's MetricNameRaw mustn't be modified")
+	}
+
+	// The reject policy must be applied to the cached metric name.
+	if err := SetInvalidLabelNamePolicy("reject"); err != nil {
+		t.Fatalf("cannot set label name policy: %s", err)
+	}
+	invalidLabelNamesBefore := atomic.LoadUint64(&InvalidLabelNames)
+	mr.Timestamp++
+	if err := s.AddRows([]MetricRow{mr}, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	if n := atomic.LoadUint64(&InvalidLabelNames) - invalidLabelNamesBefore; n != 1 {
+		t.Fatalf("unexpected number of rejected label names; got %d; want 1", n)
+	}
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
+)
+
+// SetMergeBandwidthLimits sets the maximum read and write bandwidth in bytes per second for each background merge of file parts.
+//
+// The limits apply to merges of both data parts and indexdb parts.
+// There is no limit if the corresponding value is <= 0.
+func SetMergeBandwidthLimits(maxReadBytesPerSecond, maxWriteBytesPerSecond int) {
+	mergethrottle.SetBandwidthLimits(maxReadBytesPerSecond, maxWriteBytesPerSecond)
+}
+
+// SetMergeLowPriorityHours limits merge bandwidth set via SetMergeBandwidthLimits only to the given hours range in local time.
+//
+// The hours range must have `startHour-endHour` format, for example `9-18`. The end hour isn't included in the range.
+// The range may span midnight, for example `22-6`. Merge bandwidth is limited all the time if the range is empty.
+func SetMergeLowPriorityHours(hoursRange string) error {
+	return mergethrottle.SetLowPriorityHours(hoursRange)
+}
@@ -59,10 +59,27 @@ func (tag *Tag) Unmarshal(src []byte) ([]byte, error) {
 }
 
 func (tag *Tag) copyFrom(src *Tag) {
-	tag.Key = append(tag.Key[:0], src.Key...)
+	tag.Key = copyTagKey(tag.Key, src.Key)
 	tag.Value = append(tag.Value[:0], src.Value...)
 }
 
+// copyTagKey copies src to the tag key dst and returns the result.
+//
+// dst may refer to an interned string shared among MetricName instances (see MetricName.Unmarshal),
+// so it is overwritten only if it has spare capacity. Interned keys have no spare capacity.
+// The returned key always has spare capacity, so it may be overwritten on the next call.
+func copyTagKey(dst, src []byte) []byte {
+	if len(src) < cap(dst) && len(dst) < cap(dst) {
+		return append(dst[:0], src...)
+	}
+	if len(src) == 0 {
+		return nil
+	}
+	dst = make([]byte, len(src), len(src)+1)
+	copy(dst, src)
+	return dst
+}
+
 func marshalTagValueNoTrailingTagSeparator(dst, src []byte) []byte {
 	dst = marshalTagValue(dst, src)
 	// Remove trailing tagSeparatorChar
@@ -98,6 +115,36 @@ func marshalTagValue(dst, src []byte) []byte {
 	return dst
 }
 
+// unmarshalInternedTagValue unmarshals interned tag value from src.
+//
+// The returned value has no spare capacity, so it mustn't be modified in place.
+func unmarshalInternedTagValue(src []byte) ([]byte, []byte, error) {
+	n := bytes.IndexByte(src, tagSeparatorChar)
+	if n < 0 {
+		return src, nil, fmt.Errorf("cannot find the end of tag value")
+	}
+	b := src[:n]
+	if n == 0 {
+		return src[1:], nil, nil
+	}
+	if bytes.IndexByte(b, escapeChar) < 0 {
+		// Fast path - intern b as is.
+		return src[n+1:], bytesutil.ToUnsafeBytes(bytesutil.InternBytes(b)), nil
+	}
+	bb := tagValueBufPool.Get()
+	tail, value, err := unmarshalTagValue(bb.B[:0], src)
+	bb.B = value
+	if err != nil {
+		tagValueBufPool.Put(bb)
+		return tail, nil, err
+	}
+	value = bytesutil.ToUnsafeBytes(bytesutil.InternBytes(value))
+	tagValueBufPool.Put(bb)
+	return tail, value, nil
+}
+
+var tagValueBufPool bytesutil.ByteBufferPool
+
 func unmarshalTagValue(dst, src []byte) ([]byte, []byte, error) {
 	n := bytes.IndexByte(src, tagSeparatorChar)
 	if n < 0 {
@@ -197,14 +244,14 @@ func (mn *MetricName) CopyFrom(src *MetricName) {
 // AddTag adds new tag to mn with the given key and value.
 func (mn *MetricName) AddTag(key, value string) {
 	tag := mn.addNextTag()
-	tag.Key = append(tag.Key[:0], key...)
+	tag.Key = copyTagKey(tag.Key, bytesutil.ToUnsafeBytes(key))
 	tag.Value = append(tag.Value[:0], value...)
 }
 
 // AddTagBytes adds new tag to mn with the given key and value.
 func (mn *MetricName) AddTagBytes(key, value []byte) {
 	tag := mn.addNextTag()
-	tag.Key = append(tag.Key[:0], key...)
+	tag.Key = copyTagKey(tag.Key, key)
 	tag.Value = append(tag.Value[:0], value...)
 }
 
@@ -371,6 +418,9 @@ func (mn *MetricName) Marshal(dst []byte) []byte {
 }
 
 // Unmarshal unmarshals mn from src.
+//
+// Tag keys are interned, since they are frequently repeated across time series.
+// Tag values and MetricGroup aren't interned, since they may have high cardinality.
 func (mn *MetricName) Unmarshal(src []byte) error {
 	// Unmarshal MetricGroup.
 	var err error
@@ -383,9 +433,13 @@ func (mn *MetricName) Unmarshal(src []byte) error {
 	for len(src) > 0 {
 		tag := mn.addNextTag()
 		var err error
-		src, err = tag.Unmarshal(src)
+		src, tag.Key, err = unmarshalInternedTagValue(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal tag key: %w", err)
+		}
+		src, tag.Value, err = unmarshalTagValue(tag.Value[:0], src)
 		if err != nil {
-			return fmt.Errorf("cannot unmarshal tag: %w", err)
+			return fmt.Errorf("cannot unmarshal tag value: %w", err)
 		}
 	}
 
@@ -406,7 +460,9 @@ const maxLabelNameLen = 256
 const maxLabelValueLen = 16 * 1024
 
 // The maximum number of labels per each timeseries.
-var maxLabelsPerTimeseries = 30
+//
+// It is accessed atomically, since it may be updated at runtime.
+var maxLabelsPerTimeseries int64 = 30
 
 // SetMaxLabelsPerTimeseries sets the limit on the number of labels
 // per each time series.
@@ -416,18 +472,20 @@ func SetMaxLabelsPerTimeseries(maxLabels int) {
 	if maxLabels <= 0 {
 		logger.Panicf("BUG: maxLabels must be positive; got %d", maxLabels)
 	}
-	maxLabelsPerTimeseries = maxLabels
+	atomic.StoreInt64(&maxLabelsPerTimeseries, int64(maxLabels))
 }
 
 // MarshalMetricNameRaw marshals labels to dst and returns the result.
 //
 // The result must be unmarshaled with MetricName.unmarshalRaw
 func MarshalMetricNameRaw(dst []byte, labels []prompb.Label) []byte {
+	maxLabels := int(atomic.LoadInt64(&maxLabelsPerTimeseries))
+
 	// Calculate the required space for dst.
 	dstLen := len(dst)
 	dstSize := dstLen
 	for i := range labels {
-		if i >= maxLabelsPerTimeseries {
+		if i >= maxLabels {
 			atomic.AddUint64(&MetricsWithDroppedLabels, 1)
 			break
 		}
@@ -455,7 +513,7 @@ func MarshalMetricNameRaw(dst []byte, labels []prompb.Label) []byte {
 
 	// Marshal labels to dst.
 	for i := range labels {
-		if i >= maxLabelsPerTimeseries {
+		if i >= maxLabels {
 			break
 		}
 		label := &labels[i]
@@ -484,8 +542,7 @@ var (
 //
 // The results may be unmarshaled with MetricName.unmarshalRaw.
 //
-// This function is for testing purposes. MarshalMetricNameRaw must be used
-// in prod instead.
+// MarshalMetricNameRaw must be used for marshaling labels obtained from clients.
 func (mn *MetricName) marshalRaw(dst []byte) []byte {
 	dst = marshalBytesFast(dst, nil)
 	dst = marshalBytesFast(dst, mn.MetricGroup)
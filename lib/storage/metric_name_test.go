@@ -221,3 +221,41 @@ func TestMetricNameRemoveTagsIgnoring(t *testing.T) {
 		t.Fatalf("expecitng %s got %s", &expMN, &mn)
 	}
 }
+
+func TestMetricNameUnmarshalInternedKeys(t *testing.T) {
+	var mn MetricName
+	mn.MetricGroup = []byte("metric")
+	mn.AddTag("foo", "bar")
+	mn.AddTag("esc\x00aped", "baz")
+	mn.sortTags()
+	data := mn.Marshal(nil)
+
+	var mn1, mn2 MetricName
+	if err := mn1.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal mn1: %s", err)
+	}
+	if err := mn2.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal mn2: %s", err)
+	}
+	for i := range mn1.Tags {
+		if &mn1.Tags[i].Key[0] != &mn2.Tags[i].Key[0] {
+			t.Fatalf("tag key %q must be shared between unmarshaled metric names", mn1.Tags[i].Key)
+		}
+	}
+
+	// Modifications of mn1 mustn't affect the shared tag keys in mn2.
+	mn1.Reset()
+	mn1.AddTag("x", "y")
+	mn1.AddTagBytes([]byte("a"), []byte("b"))
+	if !reflect.DeepEqual(&mn, &mn2) {
+		t.Fatalf("unexpected mn2 after modifying mn1;\ngot\n%+v\nwant\n%+v", &mn2, &mn)
+	}
+	mn1.Reset()
+	if err := mn1.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal mn1: %s", err)
+	}
+	mn1.Tags[1].copyFrom(&Tag{Key: []byte("f")})
+	if !reflect.DeepEqual(&mn, &mn2) {
+		t.Fatalf("unexpected mn2 after modifying tag key in mn1;\ngot\n%+v\nwant\n%+v", &mn2, &mn)
+	}
+}
@@ -33,6 +33,9 @@ var (
 type part struct {
 	ph partHeader
 
+	// Unique id of the part. It is used as a part of the key in the cache for data blocks.
+	id uint64
+
 	// Filesystem path to the part.
 	//
 	// Empty for in-memory part.
@@ -64,6 +67,7 @@ func openFilePart(path string) (*part, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot open timestamps file: %w", err)
 	}
+	timestampsFile.MustAdviseSequentialRead()
 	timestampsSize := fs.MustFileSize(timestampsPath)
 
 	valuesPath := path + "/values.bin"
@@ -72,6 +76,7 @@ func openFilePart(path string) (*part, error) {
 		timestampsFile.MustClose()
 		return nil, fmt.Errorf("cannot open values file: %w", err)
 	}
+	valuesFile.MustAdviseSequentialRead()
 	valuesSize := fs.MustFileSize(valuesPath)
 
 	indexPath := path + "/index.bin"
@@ -81,6 +86,7 @@ func openFilePart(path string) (*part, error) {
 		valuesFile.MustClose()
 		return nil, fmt.Errorf("cannot open index file: %w", err)
 	}
+	indexFile.MustAdviseRandomRead()
 	indexSize := fs.MustFileSize(indexPath)
 
 	metaindexPath := path + "/metaindex.bin"
@@ -111,6 +117,7 @@ func newPart(ph *partHeader, path string, size uint64, metaindexReader filestrea
 
 	var p part
 	p.ph = *ph
+	p.id = nextPartID()
 	p.path = path
 	p.size = size
 	p.timestampsFile = timestampsFile
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -20,6 +21,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storagepacelimiter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/syncwg"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
@@ -79,8 +81,14 @@ const finalPartsToMerge = 3
 var rawRowsShardsPerPartition = (runtime.GOMAXPROCS(-1) + 7) / 8
 
 // getMaxRowsPerPartition returns the maximum number of rows that haven't been converted into parts yet.
+//
+// This is also the maximum number of rows per inmemory part created from raw rows.
 func getMaxRawRowsPerPartition() int {
 	maxRawRowsPerPartitionOnce.Do(func() {
+		if maxInmemoryPartRows > 0 {
+			maxRawRowsPerPartition = maxInmemoryPartRows
+			return
+		}
 		n := memory.Allowed() / 256 / int(unsafe.Sizeof(rawRow{}))
 		if n < 1e4 {
 			n = 1e4
@@ -98,13 +106,42 @@ var (
 	maxRawRowsPerPartitionOnce sync.Once
 )
 
+// SetMaxInmemoryPartRows sets the maximum number of rows per inmemory part.
+//
+// By default the limit depends on the available memory. n must be positive.
+//
+// The function must be called before opening or creating any storage.
+func SetMaxInmemoryPartRows(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("the maximum number of rows per inmemory part must be positive; got %d", n)
+	}
+	maxInmemoryPartRows = n
+	return nil
+}
+
+var maxInmemoryPartRows int
+
 // The interval for flushing (converting) recent raw rows into parts,
 // so they become visible to search.
 const rawRowsFlushInterval = time.Second
 
 // The interval for flushing inmemory parts to persistent storage,
 // so they survive process crash.
-const inmemoryPartsFlushInterval = 5 * time.Second
+var inmemoryPartsFlushInterval = 5 * time.Second
+
+// SetInmemoryPartsFlushInterval sets the interval for flushing inmemory parts to persistent storage.
+//
+// Bigger intervals reduce disk writes at the cost of higher memory usage
+// and bigger amounts of data, which may be lost on process crash.
+//
+// The function must be called before opening or creating any storage.
+func SetInmemoryPartsFlushInterval(d time.Duration) {
+	if d <= 0 {
+		// Do nothing
+		return
+	}
+	inmemoryPartsFlushInterval = d
+}
 
 // partition represents a partition.
 type partition struct {
@@ -124,6 +161,11 @@ type partition struct {
 
 	mergeIdx uint64
 
+	// appliedDedupInterval is the de-duplication interval applied to all the data in the partition by dedupWatcher.
+	//
+	// It is set to -1 while dedupWatcher merges the partition parts, and it is reset to 0 when new rows are added to the partition.
+	appliedDedupInterval int64
+
 	smallPartsPath string
 	bigPartsPath   string
 
@@ -153,12 +195,16 @@ type partition struct {
 
 	snapshotLock sync.RWMutex
 
+	// dedupLock serializes updates of appliedDedupInterval together with the file it is persisted to.
+	dedupLock sync.Mutex
+
 	stopCh chan struct{}
 
 	smallPartsMergerWG     sync.WaitGroup
 	bigPartsMergerWG       sync.WaitGroup
 	rawRowsFlusherWG       sync.WaitGroup
 	inmemoryPartsFlusherWG sync.WaitGroup
+	dedupWatcherWG         sync.WaitGroup
 }
 
 // partWrapper is a wrapper for the part.
@@ -220,6 +266,7 @@ func createPartition(timestamp int64, smallPartitionsPath, bigPartitionsPath str
 	pt.startMergeWorkers()
 	pt.startRawRowsFlusher()
 	pt.startInmemoryPartsFlusher()
+	pt.startDedupWatcher()
 
 	logger.Infof("partition %q has been created", name)
 
@@ -264,12 +311,14 @@ func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func
 	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs)
 	pt.smallParts = smallParts
 	pt.bigParts = bigParts
+	pt.appliedDedupInterval = readAppliedDedupInterval(bigPartsPath)
 	if err := pt.tr.fromPartitionName(name); err != nil {
 		return nil, fmt.Errorf("cannot obtain partition time range from smallPartsPath %q: %w", smallPartsPath, err)
 	}
 	pt.startMergeWorkers()
 	pt.startRawRowsFlusher()
 	pt.startInmemoryPartsFlusher()
+	pt.startDedupWatcher()
 
 	return pt, nil
 }
@@ -409,6 +458,11 @@ func (pt *partition) AddRows(rows []rawRow) {
 		}
 	}
 
+	if atomic.LoadInt64(&pt.appliedDedupInterval) != 0 {
+		// The added rows aren't de-duplicated with the interval applied by dedupWatcher.
+		pt.resetAppliedDedupInterval()
+	}
+
 	pt.rawRows.addRows(pt, rows)
 }
 
@@ -626,8 +680,13 @@ func (pt *partition) PutParts(pws []*partWrapper) {
 func (pt *partition) MustClose() {
 	close(pt.stopCh)
 
-	logger.Infof("waiting for inmemory parts flusher to stop on %q...", pt.smallPartsPath)
+	logger.Infof("waiting for de-duplication watcher to stop on %q...", pt.bigPartsPath)
 	startTime := time.Now()
+	pt.dedupWatcherWG.Wait()
+	logger.Infof("de-duplication watcher stopped in %.3f seconds on %q", time.Since(startTime).Seconds(), pt.bigPartsPath)
+
+	logger.Infof("waiting for inmemory parts flusher to stop on %q...", pt.smallPartsPath)
+	startTime = time.Now()
 	pt.inmemoryPartsFlusherWG.Wait()
 	logger.Infof("inmemory parts flusher stopped in %.3f seconds on %q", time.Since(startTime).Seconds(), pt.smallPartsPath)
 
@@ -799,6 +858,37 @@ func (pt *partition) flushInmemoryParts(dstPws []*partWrapper, force bool) ([]*p
 	return dstPws, nil
 }
 
+// flushToDisk makes sure all the rows added to pt before the call are stored in file parts.
+func (pt *partition) flushToDisk() error {
+	pt.flushRawRows(true)
+	deadline := fasttime.UnixTimestamp()
+	var pwsBuf []*partWrapper
+	for {
+		var err error
+		pwsBuf, err = pt.flushInmemoryParts(pwsBuf[:0], true)
+		if err != nil {
+			return fmt.Errorf("cannot flush inmemory parts: %w", err)
+		}
+		if !pt.hasInmemoryPartsCreatedBefore(deadline) {
+			return nil
+		}
+		// Some inmemory parts are merged by concurrent goroutines. Wait until the merge is finished.
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (pt *partition) hasInmemoryPartsCreatedBefore(deadline uint64) bool {
+	pt.partsLock.Lock()
+	defer pt.partsLock.Unlock()
+
+	for _, pw := range pt.smallParts {
+		if pw.mp != nil && pw.mp.creationTime <= deadline {
+			return true
+		}
+	}
+	return false
+}
+
 func (pt *partition) mergePartsOptimal(pws []*partWrapper) error {
 	for len(pws) > defaultPartsToMerge {
 		if err := pt.mergeParts(pws[:defaultPartsToMerge], nil); err != nil {
@@ -842,6 +932,10 @@ func SetSmallMergeWorkersCount(n int) {
 }
 
 func (pt *partition) startMergeWorkers() {
+	if isReadOnly {
+		// Merges modify data files, so they are disabled in read-only mode.
+		return
+	}
 	for i := 0; i < smallMergeWorkersCount; i++ {
 		pt.smallPartsMergerWG.Add(1)
 		go func() {
@@ -918,6 +1012,135 @@ func (pt *partition) partsMerger(mergerFunc func(isFinal bool) error) error {
 	}
 }
 
+func (pt *partition) startDedupWatcher() {
+	if isReadOnly {
+		// De-duplication modifies data files, so it is disabled in read-only mode.
+		return
+	}
+	pt.dedupWatcherWG.Add(1)
+	go func() {
+		pt.dedupWatcher()
+		pt.dedupWatcherWG.Done()
+	}()
+}
+
+func (pt *partition) dedupWatcher() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pt.stopCh:
+			return
+		case <-ticker.C:
+		}
+		if err := pt.dedupIfNeeded(); err != nil {
+			if err == errForciblyStopped {
+				return
+			}
+			logger.Panicf("FATAL: unrecoverable error when de-duplicating samples in the partition %q: %s", pt.bigPartsPath, err)
+		}
+	}
+}
+
+// dedupIfNeeded merges all the parts in pt into a single part with de-duplication
+// if all the samples in pt became old enough for bigger de-duplication interval than the interval already applied to pt.
+//
+// This is needed because background merges de-duplicate samples only in blocks unpacked during the merge,
+// while big parts may be never merged again after the partition stops receiving new data.
+func (pt *partition) dedupIfNeeded() error {
+	if isReadOnly {
+		return nil
+	}
+	now := int64(fasttime.UnixTimestamp() * 1000)
+	interval := getDedupIntervalForTimestamp(pt.tr.MaxTimestamp, now)
+	if interval <= minScrapeInterval || interval <= atomic.LoadInt64(&pt.appliedDedupInterval) {
+		// Nothing to de-duplicate.
+		return nil
+	}
+
+	pt.partsLock.Lock()
+	pws := make([]*partWrapper, 0, len(pt.smallParts)+len(pt.bigParts))
+	pws = append(pws, pt.smallParts...)
+	pws = append(pws, pt.bigParts...)
+	rowsCount := uint64(0)
+	for _, pw := range pws {
+		if pw.isInMerge {
+			// Try again later, when concurrent merges are finished.
+			pt.partsLock.Unlock()
+			return nil
+		}
+		rowsCount += pw.p.ph.RowsCount
+	}
+	if maxRows := maxRowsByPath(pt.bigPartsPath); rowsCount > maxRows {
+		pt.partsLock.Unlock()
+		logger.Warnf("cannot de-duplicate samples in the partition %q: not enough free disk space for merging %d rows; the maximum number of rows to merge is %d",
+			pt.bigPartsPath, rowsCount, maxRows)
+		return nil
+	}
+	for _, pw := range pws {
+		pw.isInMerge = true
+	}
+	pt.partsLock.Unlock()
+
+	// Mark the partition as being de-duplicated, so rows added during the merge reset appliedDedupInterval.
+	atomic.StoreInt64(&pt.appliedDedupInterval, -1)
+	startTime := time.Now()
+	if len(pws) > 0 {
+		if err := pt.mergePartsInternal(pws, pt.stopCh, true); err != nil {
+			return fmt.Errorf("cannot merge %d parts: %w", len(pws), err)
+		}
+	}
+	pt.setAppliedDedupInterval(interval)
+	logger.Infof("de-duplicated %d rows with %dms interval in the partition %q in %.3f seconds",
+		rowsCount, interval, pt.bigPartsPath, time.Since(startTime).Seconds())
+	return nil
+}
+
+// appliedDedupIntervalFilename is the name of the file at bigPartsPath, which contains appliedDedupInterval.
+const appliedDedupIntervalFilename = "dedup_interval"
+
+func (pt *partition) setAppliedDedupInterval(interval int64) {
+	pt.dedupLock.Lock()
+	defer pt.dedupLock.Unlock()
+
+	if !atomic.CompareAndSwapInt64(&pt.appliedDedupInterval, -1, interval) {
+		// New rows have been added to pt during the merge. They will be de-duplicated on the next run.
+		return
+	}
+	path := pt.bigPartsPath + "/" + appliedDedupIntervalFilename
+	fs.MustRemoveAll(path)
+	if err := fs.WriteFileAtomically(path, []byte(strconv.FormatInt(interval, 10))); err != nil {
+		logger.Panicf("FATAL: cannot store applied de-duplication interval: %s", err)
+	}
+}
+
+func (pt *partition) resetAppliedDedupInterval() {
+	pt.dedupLock.Lock()
+	defer pt.dedupLock.Unlock()
+
+	if atomic.SwapInt64(&pt.appliedDedupInterval, 0) > 0 {
+		fs.MustRemoveAll(pt.bigPartsPath + "/" + appliedDedupIntervalFilename)
+	}
+}
+
+// readAppliedDedupInterval returns de-duplication interval applied to the partition at bigPartsPath by dedupWatcher.
+func readAppliedDedupInterval(bigPartsPath string) int64 {
+	path := bigPartsPath + "/" + appliedDedupIntervalFilename
+	if !fs.IsPathExist(path) {
+		return 0
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read applied de-duplication interval: %s", err)
+	}
+	interval, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || interval < 0 {
+		logger.Warnf("ignoring invalid de-duplication interval %q in %q; samples in the partition will be de-duplicated again", data, path)
+		return 0
+	}
+	return interval
+}
+
 func maxRowsByPath(path string) uint64 {
 	freeSpace := fs.MustGetFreeSpace(path)
 
@@ -970,6 +1193,14 @@ func (pt *partition) mergeSmallParts(isFinal bool) error {
 var errNothingToMerge = fmt.Errorf("nothing to merge")
 
 func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) error {
+	return pt.mergePartsInternal(pws, stopCh, false)
+}
+
+// mergePartsInternal merges pws into a single part.
+//
+// All the blocks are unpacked and de-duplicated if unpackForDedup is set.
+// Otherwise only blocks unpacked during the merge are de-duplicated.
+func (pt *partition) mergePartsInternal(pws []*partWrapper, stopCh <-chan struct{}, unpackForDedup bool) error {
 	if len(pws) == 0 {
 		// Nothing to merge.
 		return errNothingToMerge
@@ -991,6 +1222,12 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 
 	// Prepare BlockStreamReaders for source parts.
 	bsrs := make([]*blockStreamReader, 0, len(pws))
+	// Throttle only background merges, which may be stopped via stopCh.
+	// Flushes of in-memory parts and final merges on shutdown are performed at full speed.
+	var readLimiter *mergethrottle.Limiter
+	if stopCh != nil {
+		readLimiter = mergethrottle.NewReadLimiter(stopCh)
+	}
 	defer func() {
 		for _, bsr := range bsrs {
 			putBlockStreamReader(bsr)
@@ -1004,6 +1241,9 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 			if err := bsr.InitFromFilePart(pw.p.path); err != nil {
 				return fmt.Errorf("cannot open source part for merging: %w", err)
 			}
+			if readLimiter != nil {
+				bsr.throttle(readLimiter)
+			}
 		}
 		bsrs = append(bsrs, bsr)
 	}
@@ -1030,6 +1270,12 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 	if err := bsw.InitFromFilePart(tmpPartPath, nocache, compressLevel); err != nil {
 		return fmt.Errorf("cannot create destination part %q: %w", tmpPartPath, err)
 	}
+	if stopCh != nil {
+		bsw.throttle(mergethrottle.NewWriteLimiter(stopCh))
+	}
+	if unpackForDedup {
+		bsw.unpackForDedup()
+	}
 
 	// Merge parts.
 	dmis := pt.getDeletedMetricIDs()
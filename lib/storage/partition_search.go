@@ -23,6 +23,9 @@ type partitionSearch struct {
 	psPool []partSearch
 	psHeap partSearchHeap
 
+	// partsSkipped is the number of parts skipped during Init, since they don't overlap the search time range.
+	partsSkipped int
+
 	err error
 
 	nextBlockNoop bool
@@ -48,6 +51,7 @@ func (pts *partitionSearch) reset() {
 	}
 	pts.psHeap = pts.psHeap[:0]
 
+	pts.partsSkipped = 0
 	pts.err = nil
 	pts.nextBlockNoop = false
 	pts.needClosing = false
@@ -82,13 +86,19 @@ func (pts *partitionSearch) Init(pt *partition, tsids []TSID, tr TimeRange) {
 
 	pts.pws = pt.GetParts(pts.pws[:0])
 
-	// Initialize psPool.
+	// Initialize psPool only for parts overlapping tr, so the remaining parts aren't touched during the search.
 	if n := len(pts.pws) - cap(pts.psPool); n > 0 {
 		pts.psPool = append(pts.psPool[:cap(pts.psPool)], make([]partSearch, n)...)
 	}
-	pts.psPool = pts.psPool[:len(pts.pws)]
-	for i, pw := range pts.pws {
-		pts.psPool[i].Init(pw.p, tsids, tr)
+	pts.psPool = pts.psPool[:0]
+	for _, pw := range pts.pws {
+		ph := &pw.p.ph
+		if ph.MinTimestamp > tr.MaxTimestamp || ph.MaxTimestamp < tr.MinTimestamp {
+			pts.partsSkipped++
+			continue
+		}
+		pts.psPool = pts.psPool[:len(pts.psPool)+1]
+		pts.psPool[len(pts.psPool)-1].Init(pw.p, tsids, tr)
 	}
 
 	// Initialize the psHeap.
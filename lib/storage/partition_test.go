@@ -13,6 +13,36 @@ func TestPartitionMaxRowsByPath(t *testing.T) {
 	}
 }
 
+func TestSetMaxInmemoryPartRows(t *testing.T) {
+	origMaxInmemoryPartRows := maxInmemoryPartRows
+	defer func() {
+		maxInmemoryPartRows = origMaxInmemoryPartRows
+	}()
+	f := func(n int, isErrorExpected bool, nExpected int) {
+		t.Helper()
+		maxInmemoryPartRows = 123
+		err := SetMaxInmemoryPartRows(n)
+		if isErrorExpected && err == nil {
+			t.Fatalf("expecting non-nil error for n=%d", n)
+		}
+		if !isErrorExpected && err != nil {
+			t.Fatalf("unexpected error for n=%d: %s", n, err)
+		}
+		if maxInmemoryPartRows != nExpected {
+			t.Fatalf("unexpected maxInmemoryPartRows for n=%d; got %d; want %d", n, maxInmemoryPartRows, nExpected)
+		}
+	}
+
+	// Invalid values don't change the limit
+	f(0, true, 123)
+	f(-1, true, 123)
+	f(-1e6, true, 123)
+
+	// Valid values
+	f(1, false, 1)
+	f(1e6, false, 1e6)
+}
+
 func TestAppendPartsToMerge(t *testing.T) {
 	testAppendPartsToMerge(t, 2, []uint64{}, nil)
 	testAppendPartsToMerge(t, 2, []uint64{123}, nil)
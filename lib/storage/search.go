@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"io"
+	"sync/atomic"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
@@ -40,6 +41,33 @@ func (br *BlockRef) MustReadBlock(dst *Block, fetchData bool) {
 		return
 	}
 
+	k := dataBlockCacheKey{
+		partID:                br.p.id,
+		timestampsBlockOffset: br.bh.TimestampsBlockOffset,
+	}
+	if dbe := dbc.Get(k); dbe != nil {
+		// Fast path - the block is already decompressed, so Block.UnmarshalData becomes no-op.
+		dst.timestamps = append(dst.timestamps[:0], dbe.timestamps...)
+		dst.values = append(dst.values[:0], dbe.values...)
+		return
+	}
+
+	// Slow path - read the block from the part.
+	br.readBlockData(dst)
+	if atomic.LoadInt64(&maxDataBlocksCacheSize) <= 0 {
+		return
+	}
+	if err := dst.UnmarshalData(); err != nil {
+		// Leave the block in the compressed form, so the caller gets the error from Block.UnmarshalData.
+		dst.Reset()
+		dst.bh = br.bh
+		br.readBlockData(dst)
+		return
+	}
+	dbc.Put(k, dst.timestamps, dst.values)
+}
+
+func (br *BlockRef) readBlockData(dst *Block) {
 	dst.timestampsData = bytesutil.Resize(dst.timestampsData[:0], int(br.bh.TimestampsBlockSize))
 	br.p.timestampsFile.MustReadAt(dst.timestampsData, int64(br.bh.TimestampsBlockOffset))
 
@@ -47,6 +75,13 @@ func (br *BlockRef) MustReadBlock(dst *Block, fetchData bool) {
 	br.p.valuesFile.MustReadAt(dst.valuesData, int64(br.bh.ValuesBlockOffset))
 }
 
+// MinTimestamp returns the minimum timestamp for the block referred by br.
+//
+// The block isn't read from disk.
+func (br *BlockRef) MinTimestamp() int64 {
+	return br.bh.MinTimestamp
+}
+
 // MetricBlockRef contains reference to time series block for a single metric.
 type MetricBlockRef struct {
 	// The metric name
@@ -74,6 +109,9 @@ type Search struct {
 	// deadline in unix timestamp seconds for the current search.
 	deadline uint64
 
+	// stopCh is closed when the search must be canceled.
+	stopCh <-chan struct{}
+
 	err error
 
 	needClosing bool
@@ -90,6 +128,7 @@ func (s *Search) reset() {
 	s.tr = TimeRange{}
 	s.tfss = nil
 	s.deadline = 0
+	s.stopCh = nil
 	s.err = nil
 	s.needClosing = false
 	s.loops = 0
@@ -99,8 +138,12 @@ func (s *Search) reset() {
 //
 // MustClose must be called when the search is done.
 //
+// The search is canceled with ErrSearchCanceled error when stopCh is closed.
+// This allows freeing resources occupied by the search when the client closes the connection.
+// stopCh may be nil.
+//
 // Init returns the upper bound on the number of found time series.
-func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) int {
+func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, stopCh <-chan struct{}) int {
 	if s.needClosing {
 		logger.Panicf("BUG: missing MustClose call before the next call to Init")
 	}
@@ -109,11 +152,12 @@ func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMet
 	s.tr = tr
 	s.tfss = tfss
 	s.deadline = deadline
+	s.stopCh = stopCh
 	s.needClosing = true
 
-	tsids, err := storage.searchTSIDs(tfss, tr, maxMetrics, deadline)
+	tsids, err := storage.searchTSIDs(tfss, tr, maxMetrics, deadline, stopCh)
 	if err == nil {
-		err = storage.prefetchMetricNames(tsids, deadline)
+		err = storage.prefetchMetricNames(tsids, deadline, stopCh)
 	}
 	// It is ok to call Init on error from storage.searchTSIDs.
 	// Init must be called before returning because it will fail
@@ -138,6 +182,13 @@ func (s *Search) MustClose() {
 	s.reset()
 }
 
+// PruneStats returns statistics on partitions and parts pruned by the time range during the search.
+//
+// It must be called before MustClose.
+func (s *Search) PruneStats() PruneStats {
+	return s.ts.pruneStats
+}
+
 // Error returns the last error from s.
 func (s *Search) Error() error {
 	if s.err == io.EOF || s.err == nil {
@@ -153,7 +204,7 @@ func (s *Search) NextMetricBlock() bool {
 	}
 	for s.ts.NextBlock() {
 		if s.loops&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(s.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(s.deadline, s.stopCh); err != nil {
 				s.err = err
 				return false
 			}
@@ -343,10 +394,15 @@ func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 	return src, nil
 }
 
-func checkSearchDeadlineAndPace(deadline uint64) error {
+func checkSearchDeadlineAndPace(deadline uint64, stopCh <-chan struct{}) error {
 	if fasttime.UnixTimestamp() > deadline {
 		return ErrDeadlineExceeded
 	}
+	select {
+	case <-stopCh:
+		return ErrSearchCanceled
+	default:
+	}
 	storagepacelimiter.Search.WaitIfNeeded()
 	return nil
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -218,7 +219,7 @@ func testSearchInternal(st *Storage, tr TimeRange, mrs []MetricRow, accountsCoun
 		}
 
 		// Search
-		s.Init(st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		s.Init(st, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
 		var mbs []metricBlock
 		for s.NextMetricBlock() {
 			var b Block
@@ -291,3 +292,42 @@ func mrsToString(mrs []MetricRow) string {
 	}
 	return bb.String()
 }
+
+func TestSearchCanceled(t *testing.T) {
+	path := "TestSearchCanceled"
+	st, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage %q: %s", path, err)
+	}
+	defer func() {
+		st.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove storage %q: %s", path, err)
+		}
+	}()
+	if err := testStorageAddMetrics(st, 0); err != nil {
+		t.Fatalf("cannot add metrics: %s", err)
+	}
+	st.debugFlush()
+
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("job"), []byte("webservice_0"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: 0,
+		MaxTimestamp: 2e10,
+	}
+
+	stopCh := make(chan struct{})
+	close(stopCh)
+	var s Search
+	s.Init(st, []*TagFilters{tfs}, tr, 1e5, noDeadline, stopCh)
+	for s.NextMetricBlock() {
+		t.Fatalf("unexpected block returned from canceled search")
+	}
+	if err := s.Error(); !errors.Is(err, ErrSearchCanceled) {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrSearchCanceled)
+	}
+	s.MustClose()
+}
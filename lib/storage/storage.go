@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -20,6 +21,8 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergethrottle"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storagepacelimiter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
@@ -39,6 +42,11 @@ type Storage struct {
 	addRowsConcurrencyLimitReached uint64
 	addRowsConcurrencyLimitTimeout uint64
 	addRowsConcurrencyDroppedRows  uint64
+	addRowsConcurrencyQueueFull    uint64
+
+	deletedMetricsCarriedOver uint64
+	deletedMetricsExpired     uint64
+	deletedMetricsWithoutData uint64
 
 	searchTSIDsConcurrencyLimitReached uint64
 	searchTSIDsConcurrencyLimitTimeout uint64
@@ -47,6 +55,9 @@ type Storage struct {
 	slowPerDayIndexInserts uint64
 	slowMetricNameLoads    uint64
 
+	tagFiltersCacheResets uint64
+	metricNameCacheResets uint64
+
 	path            string
 	cachePath       string
 	retentionMonths int
@@ -58,6 +69,9 @@ type Storage struct {
 
 	tb *table
 
+	// wal is non-nil if write-ahead log is enabled via SetWALEnabled.
+	wal *wal
+
 	// tsidCache is MetricName -> TSID cache.
 	tsidCache *workingsetcache.Cache
 
@@ -98,6 +112,8 @@ type Storage struct {
 	currHourMetricIDsUpdaterWG sync.WaitGroup
 	nextDayMetricIDsUpdaterWG  sync.WaitGroup
 	retentionWatcherWG         sync.WaitGroup
+	walCheckpointerWG          sync.WaitGroup
+	droppedPartitionsWatcherWG sync.WaitGroup
 
 	// The snapshotLock prevents from concurrent creation of snapshots,
 	// since this may result in snapshots without recently added data,
@@ -185,9 +201,20 @@ func OpenStorage(path string, retentionMonths int) (*Storage, error) {
 	}
 	s.tb = tb
 
+	if walEnabled {
+		if isReadOnly {
+			logger.Warnf("write-ahead log is disabled, since the storage at %q is opened in read-only mode", path)
+		} else {
+			s.mustOpenWAL()
+		}
+	}
+
 	s.startCurrHourMetricIDsUpdater()
 	s.startNextDayMetricIDsUpdater()
-	s.startRetentionWatcher()
+	if !isReadOnly {
+		s.startRetentionWatcher()
+		s.startDroppedPartitionsWatcher()
+	}
 
 	return s, nil
 }
@@ -204,6 +231,9 @@ func (s *Storage) getDeletedMetricIDs() *uint64set.Set {
 
 // CreateSnapshot creates snapshot for s and returns the snapshot name.
 func (s *Storage) CreateSnapshot() (string, error) {
+	if isReadOnly {
+		return "", fmt.Errorf("cannot create snapshot: %w", ErrReadOnly)
+	}
 	logger.Infof("creating Storage snapshot for %q...", s.path)
 	startTime := time.Now()
 
@@ -262,6 +292,11 @@ func (s *Storage) CreateSnapshot() (string, error) {
 
 var snapshotNameRegexp = regexp.MustCompile("^[0-9]{14}-[0-9A-Fa-f]+$")
 
+// ListPartitions returns stats for per-month partitions in s sorted by time.
+func (s *Storage) ListPartitions() []PartitionStats {
+	return s.tb.ListPartitions(nil)
+}
+
 // ListSnapshots returns sorted list of existing snapshots for s.
 func (s *Storage) ListSnapshots() ([]string, error) {
 	snapshotsPath := s.path + "/snapshots"
@@ -288,6 +323,9 @@ func (s *Storage) ListSnapshots() ([]string, error) {
 
 // DeleteSnapshot deletes the given snapshot.
 func (s *Storage) DeleteSnapshot(snapshotName string) error {
+	if isReadOnly {
+		return fmt.Errorf("cannot delete snapshot %q: %w", snapshotName, ErrReadOnly)
+	}
 	if !snapshotNameRegexp.MatchString(snapshotName) {
 		return fmt.Errorf("invalid snapshotName %q", snapshotName)
 	}
@@ -328,6 +366,19 @@ type Metrics struct {
 	AddRowsConcurrencyDroppedRows  uint64
 	AddRowsConcurrencyCapacity     uint64
 	AddRowsConcurrencyCurrent      uint64
+	AddRowsConcurrencyQueueFull    uint64
+	AddRowsQueueCapacity           uint64
+	AddRowsQueueCurrent            uint64
+
+	DeletedMetricsCarriedOver uint64
+	DeletedMetricsExpired     uint64
+	DeletedMetricsWithoutData uint64
+
+	WALWrites       uint64
+	WALBytesWritten uint64
+	WALSyncs        uint64
+	WALCheckpoints  uint64
+	WALReplayedRows uint64
 
 	SearchTSIDsConcurrencyLimitReached uint64
 	SearchTSIDsConcurrencyLimitTimeout uint64
@@ -336,27 +387,35 @@ type Metrics struct {
 
 	SearchDelays uint64
 
+	MergeThrottleDuration uint64
+
 	SlowRowInserts         uint64
 	SlowPerDayIndexInserts uint64
 	SlowMetricNameLoads    uint64
 
-	TSIDCacheSize       uint64
-	TSIDCacheSizeBytes  uint64
-	TSIDCacheRequests   uint64
-	TSIDCacheMisses     uint64
-	TSIDCacheCollisions uint64
-
-	MetricIDCacheSize       uint64
-	MetricIDCacheSizeBytes  uint64
-	MetricIDCacheRequests   uint64
-	MetricIDCacheMisses     uint64
-	MetricIDCacheCollisions uint64
-
-	MetricNameCacheSize       uint64
-	MetricNameCacheSizeBytes  uint64
-	MetricNameCacheRequests   uint64
-	MetricNameCacheMisses     uint64
-	MetricNameCacheCollisions uint64
+	TSIDCacheSize         uint64
+	TSIDCacheSizeBytes    uint64
+	TSIDCacheSizeMaxBytes uint64
+	TSIDCacheRequests     uint64
+	TSIDCacheMisses       uint64
+	TSIDCacheCollisions   uint64
+
+	MetricIDCacheSize         uint64
+	MetricIDCacheSizeBytes    uint64
+	MetricIDCacheSizeMaxBytes uint64
+	MetricIDCacheRequests     uint64
+	MetricIDCacheMisses       uint64
+	MetricIDCacheCollisions   uint64
+
+	MetricNameCacheSize         uint64
+	MetricNameCacheSizeBytes    uint64
+	MetricNameCacheSizeMaxBytes uint64
+	MetricNameCacheRequests     uint64
+	MetricNameCacheMisses       uint64
+	MetricNameCacheCollisions   uint64
+	MetricNameCacheResets       uint64
+
+	TagFiltersCacheResets uint64
 
 	DateMetricIDCacheSize        uint64
 	DateMetricIDCacheSizeBytes   uint64
@@ -372,6 +431,12 @@ type Metrics struct {
 	PrefetchedMetricIDsSize      uint64
 	PrefetchedMetricIDsSizeBytes uint64
 
+	DataBlocksCacheSize         uint64
+	DataBlocksCacheSizeBytes    uint64
+	DataBlocksCacheSizeMaxBytes uint64
+	DataBlocksCacheRequests     uint64
+	DataBlocksCacheMisses       uint64
+
 	IndexDBMetrics IndexDBMetrics
 	TableMetrics   TableMetrics
 }
@@ -393,6 +458,17 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.AddRowsConcurrencyDroppedRows += atomic.LoadUint64(&s.addRowsConcurrencyDroppedRows)
 	m.AddRowsConcurrencyCapacity = uint64(cap(addRowsConcurrencyCh))
 	m.AddRowsConcurrencyCurrent = uint64(len(addRowsConcurrencyCh))
+	m.AddRowsConcurrencyQueueFull += atomic.LoadUint64(&s.addRowsConcurrencyQueueFull)
+	m.AddRowsQueueCapacity = uint64(cap(addRowsQueueCh))
+	m.AddRowsQueueCurrent = uint64(len(addRowsQueueCh))
+
+	m.DeletedMetricsCarriedOver += atomic.LoadUint64(&s.deletedMetricsCarriedOver)
+	m.DeletedMetricsExpired += atomic.LoadUint64(&s.deletedMetricsExpired)
+	m.DeletedMetricsWithoutData += atomic.LoadUint64(&s.deletedMetricsWithoutData)
+
+	if s.wal != nil {
+		s.wal.updateMetrics(m)
+	}
 
 	m.SearchTSIDsConcurrencyLimitReached += atomic.LoadUint64(&s.searchTSIDsConcurrencyLimitReached)
 	m.SearchTSIDsConcurrencyLimitTimeout += atomic.LoadUint64(&s.searchTSIDsConcurrencyLimitTimeout)
@@ -401,6 +477,8 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 
 	m.SearchDelays = storagepacelimiter.Search.DelaysTotal()
 
+	m.MergeThrottleDuration = mergethrottle.Duration()
+
 	m.SlowRowInserts += atomic.LoadUint64(&s.slowRowInserts)
 	m.SlowPerDayIndexInserts += atomic.LoadUint64(&s.slowPerDayIndexInserts)
 	m.SlowMetricNameLoads += atomic.LoadUint64(&s.slowMetricNameLoads)
@@ -409,6 +487,7 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	s.tsidCache.UpdateStats(&cs)
 	m.TSIDCacheSize += cs.EntriesCount
 	m.TSIDCacheSizeBytes += cs.BytesSize
+	m.TSIDCacheSizeMaxBytes += s.tsidCache.MaxBytesSize()
 	m.TSIDCacheRequests += cs.GetCalls
 	m.TSIDCacheMisses += cs.Misses
 	m.TSIDCacheCollisions += cs.Collisions
@@ -417,6 +496,7 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	s.metricIDCache.UpdateStats(&cs)
 	m.MetricIDCacheSize += cs.EntriesCount
 	m.MetricIDCacheSizeBytes += cs.BytesSize
+	m.MetricIDCacheSizeMaxBytes += s.metricIDCache.MaxBytesSize()
 	m.MetricIDCacheRequests += cs.GetCalls
 	m.MetricIDCacheMisses += cs.Misses
 	m.MetricIDCacheCollisions += cs.Collisions
@@ -425,9 +505,13 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	s.metricNameCache.UpdateStats(&cs)
 	m.MetricNameCacheSize += cs.EntriesCount
 	m.MetricNameCacheSizeBytes += cs.BytesSize
+	m.MetricNameCacheSizeMaxBytes += s.metricNameCache.MaxBytesSize()
 	m.MetricNameCacheRequests += cs.GetCalls
 	m.MetricNameCacheMisses += cs.Misses
 	m.MetricNameCacheCollisions += cs.Collisions
+	m.MetricNameCacheResets += atomic.LoadUint64(&s.metricNameCacheResets)
+
+	m.TagFiltersCacheResets += atomic.LoadUint64(&s.tagFiltersCacheResets)
 
 	m.DateMetricIDCacheSize += uint64(s.dateMetricIDCache.EntriesCount())
 	m.DateMetricIDCacheSizeBytes += uint64(s.dateMetricIDCache.SizeBytes())
@@ -452,6 +536,14 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.PrefetchedMetricIDsSize += uint64(prefetchedMetricIDs.Len())
 	m.PrefetchedMetricIDsSizeBytes += uint64(prefetchedMetricIDs.SizeBytes())
 
+	m.DataBlocksCacheSize += dbc.Len()
+	m.DataBlocksCacheSizeBytes += dbc.SizeBytes()
+	if n := atomic.LoadInt64(&maxDataBlocksCacheSize); n > 0 {
+		m.DataBlocksCacheSizeMaxBytes += uint64(n)
+	}
+	m.DataBlocksCacheRequests += dbc.Requests()
+	m.DataBlocksCacheMisses += dbc.Misses()
+
 	s.idb().UpdateMetrics(&m.IndexDBMetrics)
 	s.tb.UpdateMetrics(&m.TableMetrics)
 }
@@ -476,6 +568,130 @@ func (s *Storage) retentionWatcher() {
 	}
 }
 
+func (s *Storage) startDroppedPartitionsWatcher() {
+	s.droppedPartitionsWatcherWG.Add(1)
+	go func() {
+		s.droppedPartitionsWatcher()
+		s.droppedPartitionsWatcherWG.Done()
+	}()
+}
+
+func (s *Storage) droppedPartitionsWatcher() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.tb.partitionsDroppedCh:
+			n, err := s.deleteMetricsWithoutData()
+			if err == errForciblyStopped {
+				return
+			}
+			if err != nil {
+				logger.Errorf("cannot delete metrics without data after dropping partitions outside the retention: %s", err)
+				continue
+			}
+			logger.Infof("deleted %d metrics without data after dropping partitions outside the retention", n)
+		}
+	}
+}
+
+// deleteMetricsWithoutData marks metrics without data in the remaining partitions as deleted,
+// so they are no longer returned from label APIs after the partitions outside the retention are dropped.
+//
+// Otherwise such metrics would be returned until the indexdb rotation.
+//
+// Metrics ingested before per-day index was introduced aren't deleted, since they have no (date, metricID) entries.
+func (s *Storage) deleteMetricsWithoutData() (int, error) {
+	minDate := uint64(s.tb.getMinTimestamp()) / msecPerDay
+	idb := s.idb()
+	n, err := s.deleteMetricsWithoutDataFromDB(idb, idb, minDate)
+	if err != nil {
+		return n, err
+	}
+	idb.doExtDB(func(extDB *indexDB) {
+		var nExt int
+		nExt, err = s.deleteMetricsWithoutDataFromDB(idb, extDB, minDate)
+		n += nExt
+	})
+	if err != nil {
+		return n, fmt.Errorf("error in extDB: %w", err)
+	}
+	return n, nil
+}
+
+// maxMetricIDsWithoutDataBatchSize is the maximum number of metricIDs, which are checked for data at once by deleteMetricsWithoutData.
+//
+// It limits memory usage when the storage contains big number of metrics.
+var maxMetricIDsWithoutDataBatchSize = 1024 * 1024
+
+// deleteMetricsWithoutDataFromDB deletes metrics, which have (date, metricID) entries in srcDB only for dates smaller than minDate.
+//
+// The metrics are checked for data and deleted in batches in both idb and its extDB.
+func (s *Storage) deleteMetricsWithoutDataFromDB(idb, srcDB *indexDB, minDate uint64) (int, error) {
+	deleted := 0
+	var c dateMetricIDCursor
+	for !c.done {
+		var metricIDs uint64set.Set
+		is := srcDB.getIndexSearch(noDeadline)
+		err := is.addMetricIDsBeforeDate(&metricIDs, &c, minDate, maxMetricIDsWithoutDataBatchSize, s.stop)
+		srcDB.putIndexSearch(is)
+		if err != nil {
+			return deleted, err
+		}
+		metricIDs.Subtract(idb.getDeletedMetricIDs())
+		if metricIDs.Len() == 0 {
+			continue
+		}
+
+		is = idb.getIndexSearch(noDeadline)
+		err = is.removeMetricIDsWithDataSince(&metricIDs, minDate, s.stop)
+		idb.putIndexSearch(is)
+		if err != nil {
+			return deleted, err
+		}
+		idb.doExtDB(func(extDB *indexDB) {
+			is := extDB.getIndexSearch(noDeadline)
+			err = is.removeMetricIDsWithDataSince(&metricIDs, minDate, s.stop)
+			extDB.putIndexSearch(is)
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		// Do not delete metrics, which are being ingested right now,
+		// since their (date, metricID) entries may be missing in the scanned indexdb yet.
+		// This must be checked right before the deletion in order to catch metrics resumed during the scan above.
+		s.subtractRecentMetricIDs(&metricIDs)
+		if metricIDs.Len() == 0 {
+			continue
+		}
+		a := metricIDs.AppendTo(nil)
+		if err := idb.deleteMetricIDs(a); err != nil {
+			return deleted, err
+		}
+		idb.doExtDB(func(extDB *indexDB) {
+			err = extDB.deleteMetricIDs(a)
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("cannot delete metricIDs in extDB: %w", err)
+		}
+		atomic.AddUint64(&s.deletedMetricsWithoutData, uint64(len(a)))
+		deleted += len(a)
+	}
+	return deleted, nil
+}
+
+// subtractRecentMetricIDs removes metricIDs ingested during the current and the previous hour from metricIDs.
+func (s *Storage) subtractRecentMetricIDs(metricIDs *uint64set.Set) {
+	hmCurr := s.currHourMetricIDs.Load().(*hourMetricIDs)
+	metricIDs.Subtract(hmCurr.m)
+	hmPrev := s.prevHourMetricIDs.Load().(*hourMetricIDs)
+	metricIDs.Subtract(hmPrev.m)
+	s.pendingHourEntriesLock.Lock()
+	metricIDs.Subtract(s.pendingHourEntries)
+	s.pendingHourEntriesLock.Unlock()
+}
+
 func (s *Storage) startCurrHourMetricIDsUpdater() {
 	s.currHourMetricIDsUpdaterWG.Add(1)
 	go func() {
@@ -533,8 +749,17 @@ func (s *Storage) mustRotateIndexDB() {
 		logger.Panicf("FATAL: cannot create new indexDB at %q: %s", idbNewPath, err)
 	}
 
-	// Drop extDB
+	// Carry over tombstones for recently deleted metricIDs to idbNew, so the data for these metricIDs
+	// continues to be dropped during background merges after idbCurr is dropped.
 	idbCurr := s.idb()
+	carriedOver, expired, err := idbNew.carryOverDeletedMetricIDs(idbCurr, deletedSeriesTTL)
+	if err != nil {
+		logger.Panicf("FATAL: cannot carry over deleted metricIDs to new indexDB at %q: %s", idbNewPath, err)
+	}
+	atomic.AddUint64(&s.deletedMetricsCarriedOver, uint64(carriedOver))
+	atomic.AddUint64(&s.deletedMetricsExpired, uint64(expired))
+
+	// Drop extDB
 	idbCurr.doExtDB(func(extDB *indexDB) {
 		extDB.scheduleToDrop()
 	})
@@ -564,11 +789,16 @@ func (s *Storage) MustClose() {
 	close(s.stop)
 
 	s.retentionWatcherWG.Wait()
+	s.droppedPartitionsWatcherWG.Wait()
 	s.currHourMetricIDsUpdaterWG.Wait()
 	s.nextDayMetricIDsUpdaterWG.Wait()
+	s.walCheckpointerWG.Wait()
 
 	s.tb.MustClose()
 	s.idb().MustClose()
+	if s.wal != nil {
+		s.wal.mustClose()
+	}
 
 	// Save caches.
 	s.mustSaveAndStopCache(s.tsidCache, "MetricName->TSID", "metricName_tsid")
@@ -789,7 +1019,7 @@ func nextRetentionDuration(retentionMonths int) time.Duration {
 }
 
 // searchTSIDs returns sorted TSIDs for the given tfss and the given tr.
-func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, stopCh <-chan struct{}) ([]TSID, error) {
 	// Do not cache tfss -> tsids here, since the caching is performed
 	// on idb level.
 
@@ -811,6 +1041,9 @@ func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 		select {
 		case searchTSIDsConcurrencyCh <- struct{}{}:
 			timerpool.Put(t)
+		case <-stopCh:
+			timerpool.Put(t)
+			return nil, ErrSearchCanceled
 		case <-t.C:
 			timerpool.Put(t)
 			atomic.AddUint64(&s.searchTSIDsConcurrencyLimitTimeout, 1)
@@ -818,7 +1051,7 @@ func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 				cap(searchTSIDsConcurrencyCh), timeout.Seconds())
 		}
 	}
-	tsids, err := s.idb().searchTSIDs(tfss, tr, maxMetrics, deadline)
+	tsids, err := s.idb().searchTSIDs(tfss, tr, maxMetrics, deadline, stopCh)
 	<-searchTSIDsConcurrencyCh
 	if err != nil {
 		return nil, fmt.Errorf("error when searching tsids: %w", err)
@@ -836,7 +1069,7 @@ var (
 // prefetchMetricNames pre-fetches metric names for the given tsids into metricID->metricName cache.
 //
 // This should speed-up further searchMetricName calls for metricIDs from tsids.
-func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
+func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64, stopCh <-chan struct{}) error {
 	if len(tsids) == 0 {
 		return nil
 	}
@@ -863,9 +1096,10 @@ func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
 	idb := s.idb()
 	is := idb.getIndexSearch(deadline)
 	defer idb.putIndexSearch(is)
+	is.stopCh = stopCh
 	for loops, metricID := range metricIDs {
 		if loops&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.stopCh); err != nil {
 				return err
 			}
 		}
@@ -890,10 +1124,37 @@ func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
 // ErrDeadlineExceeded is returned when the request times out.
 var ErrDeadlineExceeded = fmt.Errorf("deadline exceeded")
 
+// ErrSearchCanceled is returned when the search is canceled via stopCh passed to Search.Init.
+var ErrSearchCanceled = fmt.Errorf("search canceled")
+
+// ResetTagFiltersCache resets the cache for tag filters -> metricIDs lookups.
+//
+// This may be needed when the cache contains stale results, for example, after backfilling.
+func (s *Storage) ResetTagFiltersCache() {
+	atomic.AddUint64(&s.tagFiltersCacheResets, 1)
+	idb := s.idb()
+	idb.tagCache.Reset()
+	idb.doExtDB(func(extDB *indexDB) {
+		extDB.tagCache.Reset()
+	})
+	invalidateTagCache()
+	logger.Infof("tagFilters cache has been cleared")
+}
+
+// ResetMetricNameCache resets the cache for MetricID -> MetricName lookups.
+func (s *Storage) ResetMetricNameCache() {
+	atomic.AddUint64(&s.metricNameCacheResets, 1)
+	s.metricNameCache.Reset()
+	logger.Infof("metricName cache has been cleared")
+}
+
 // DeleteMetrics deletes all the metrics matching the given tfss.
 //
 // Returns the number of metrics deleted.
 func (s *Storage) DeleteMetrics(tfss []*TagFilters) (int, error) {
+	if isReadOnly {
+		return 0, fmt.Errorf("cannot delete metrics: %w", ErrReadOnly)
+	}
 	deletedCount, err := s.idb().DeleteTSIDs(tfss)
 	if err != nil {
 		return deletedCount, fmt.Errorf("cannot delete tsids: %w", err)
@@ -907,6 +1168,18 @@ func (s *Storage) DeleteMetrics(tfss []*TagFilters) (int, error) {
 	return deletedCount, nil
 }
 
+// DeleteMetricsDryRun returns the number of series, which would be deleted by DeleteMetrics(tfss),
+// together with up to maxMetricNames names of these series.
+//
+// Nothing is deleted.
+func (s *Storage) DeleteMetricsDryRun(tfss []*TagFilters, maxMetricNames int) (int, []MetricName, error) {
+	n, mns, err := s.idb().DeleteTSIDsDryRun(tfss, maxMetricNames)
+	if err != nil {
+		return n, mns, fmt.Errorf("cannot search tsids for deletion: %w", err)
+	}
+	return n, mns, nil
+}
+
 // searchMetricName appends metric name for the given metricID to dst
 // and returns the result.
 func (s *Storage) searchMetricName(dst []byte, metricID uint64) ([]byte, error) {
@@ -923,6 +1196,13 @@ func (s *Storage) SearchTagValues(tagKey []byte, maxTagValues int, deadline uint
 	return s.idb().SearchTagValues(tagKey, maxTagValues, deadline)
 }
 
+// SearchTagValueSuggestions searches for up to maxTagValues values for the given tagKey, which match the given query.
+//
+// See indexDB.SearchTagValueSuggestions for details.
+func (s *Storage) SearchTagValueSuggestions(tagKey, query []byte, substring bool, maxTagValues int, deadline uint64) ([]TagValueSuggestion, error) {
+	return s.idb().SearchTagValueSuggestions(tagKey, query, substring, maxTagValues, deadline)
+}
+
 // SearchTagEntries returns a list of (tagName -> tagValues)
 func (s *Storage) SearchTagEntries(maxTagKeys, maxTagValues int, deadline uint64) ([]TagEntry, error) {
 	idb := s.idb()
@@ -964,6 +1244,22 @@ func (s *Storage) GetSeriesCount(deadline uint64) (uint64, error) {
 	return s.idb().GetSeriesCount(deadline)
 }
 
+// GetSeriesCountWithFilters returns the number of unique time series matching tfss on the given tr.
+//
+// Only the index is used for counting, so the call is cheaper than searching for the matching series.
+func (s *Storage) GetSeriesCountWithFilters(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) (uint64, error) {
+	return s.idb().GetSeriesCountWithFilters(tfss, tr, maxMetrics, deadline)
+}
+
+// SearchMetricNamesPage returns up to limit marshaled metric names matching tfss on the given tr,
+// which follow the series with afterMetricID, together with their metricIDs.
+//
+// The returned metric names may be unmarshaled with MetricName.Unmarshal.
+// The last returned metricID may be passed in afterMetricID for obtaining the next page.
+func (s *Storage) SearchMetricNamesPage(tfss []*TagFilters, tr TimeRange, afterMetricID uint64, limit, maxMetrics int, deadline uint64) ([]uint64, [][]byte, error) {
+	return s.idb().SearchMetricNamesPage(tfss, tr, afterMetricID, limit, maxMetrics, deadline)
+}
+
 // GetTSDBStatusForDate returns TSDB status data for /api/v1/status/tsdb.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#tsdb-stats
@@ -971,6 +1267,13 @@ func (s *Storage) GetTSDBStatusForDate(date uint64, topN int, deadline uint64) (
 	return s.idb().GetTSDBStatusForDate(date, topN, deadline)
 }
 
+// GetTSDBStatusWithFiltersForDate returns TSDB status data for /api/v1/status/tsdb for series matching tfss.
+//
+// Series counts by values for focusLabel are returned if focusLabel isn't empty.
+func (s *Storage) GetTSDBStatusWithFiltersForDate(tfss []*TagFilters, date uint64, topN int, focusLabel string, maxMetrics int, deadline uint64) (*TSDBStatus, error) {
+	return s.idb().GetTSDBStatusWithFiltersForDate(tfss, date, topN, focusLabel, maxMetrics, deadline)
+}
+
 // MetricRow is a metric to insert into storage.
 type MetricRow struct {
 	// MetricNameRaw contains raw metric name, which must be decoded
@@ -1036,6 +1339,9 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 	if len(mrs) == 0 {
 		return nil
 	}
+	if isReadOnly {
+		return fmt.Errorf("cannot add %d rows to storage: %w", len(mrs), ErrReadOnly)
+	}
 
 	// Limit the number of concurrent goroutines that may add rows to the storage.
 	// This should prevent from out of memory errors and CPU trashing when too many
@@ -1043,8 +1349,18 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 	select {
 	case addRowsConcurrencyCh <- struct{}{}:
 	default:
-		// Sleep for a while until giving up
+		// All the workers are busy. Wait in the bounded queue until giving up.
 		atomic.AddUint64(&s.addRowsConcurrencyLimitReached, 1)
+		select {
+		case addRowsQueueCh <- struct{}{}:
+		default:
+			// The queue is full. Reject the rows immediately instead of accumulating
+			// an unbounded number of waiting goroutines with their rows in memory.
+			atomic.AddUint64(&s.addRowsConcurrencyQueueFull, 1)
+			atomic.AddUint64(&s.addRowsConcurrencyDroppedRows, uint64(len(mrs)))
+			return fmt.Errorf("cannot add %d rows to storage, since %d concurrent writers and %d queued writers are already in progress; add more CPUs or reduce load: %w",
+				len(mrs), cap(addRowsConcurrencyCh), cap(addRowsQueueCh), ErrOverloaded)
+		}
 		t := timerpool.Get(addRowsTimeout)
 
 		// Prioritize data ingestion over concurrent searches.
@@ -1054,20 +1370,26 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 		case addRowsConcurrencyCh <- struct{}{}:
 			timerpool.Put(t)
 			storagepacelimiter.Search.Dec()
+			<-addRowsQueueCh
 		case <-t.C:
 			timerpool.Put(t)
 			storagepacelimiter.Search.Dec()
+			<-addRowsQueueCh
 			atomic.AddUint64(&s.addRowsConcurrencyLimitTimeout, 1)
 			atomic.AddUint64(&s.addRowsConcurrencyDroppedRows, uint64(len(mrs)))
-			return fmt.Errorf("cannot add %d rows to storage in %s, since it is overloaded with %d concurrent writers; add more CPUs or reduce load",
-				len(mrs), addRowsTimeout, cap(addRowsConcurrencyCh))
+			return fmt.Errorf("cannot add %d rows to storage in %s, since it is overloaded with %d concurrent writers; add more CPUs or reduce load: %w",
+				len(mrs), addRowsTimeout, cap(addRowsConcurrencyCh), ErrOverloaded)
 		}
 	}
 
 	// Add rows to the storage.
 	var err error
 	rr := getRawRowsWithSize(len(mrs))
-	rr.rows, err = s.add(rr.rows, mrs, precisionBits)
+	if s.wal != nil {
+		rr.rows, err = s.addWithWAL(rr.rows, mrs, precisionBits)
+	} else {
+		rr.rows, err = s.add(rr.rows, mrs, precisionBits)
+	}
 	putRawRows(rr)
 
 	<-addRowsConcurrencyCh
@@ -1075,14 +1397,168 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 	return err
 }
 
+// RegisterMetricNames registers metric names from mrs in the indexdb without adding samples for them.
+//
+// This allows pre-creating TSIDs for the expected time series, so the first samples for these series
+// are added via AddRows without slow TSID creation.
+// MetricRow.Timestamp is used for registering the metric name in the per-day index. MetricRow.Value is ignored.
+func (s *Storage) RegisterMetricNames(mrs []MetricRow) error {
+	if len(mrs) == 0 {
+		return nil
+	}
+	if isReadOnly {
+		return fmt.Errorf("cannot register %d metric names in storage: %w", len(mrs), ErrReadOnly)
+	}
+
+	// Share the concurrency limit with AddRows, since series registration is CPU bound.
+	addRowsConcurrencyCh <- struct{}{}
+	defer func() {
+		<-addRowsConcurrencyCh
+	}()
+
+	var firstWarn error
+	var lpa *labelPolicyApplier
+	if hasInvalidLabelPolicies() {
+		lpa = &labelPolicyApplier{}
+	}
+	minTimestamp, maxTimestamp := s.tb.getMinMaxTimestamps()
+	pmrs := getPendingMetricRows()
+	defer putPendingMetricRows(pmrs)
+	for i := range mrs {
+		mr := &mrs[i]
+		if mr.Timestamp < minTimestamp || mr.Timestamp > maxTimestamp {
+			if firstWarn == nil {
+				firstWarn = fmt.Errorf("cannot register metric name with timestamp %d outside the allowed time range [%d..%d]", mr.Timestamp, minTimestamp, maxTimestamp)
+			}
+			continue
+		}
+		if lpa != nil {
+			var err error
+			if mr, err = lpa.applyToRow(mr); err != nil {
+				if firstWarn == nil {
+					firstWarn = err
+				}
+				continue
+			}
+		}
+		if err := pmrs.addRow(mr); err != nil {
+			if firstWarn == nil {
+				firstWarn = err
+			}
+			continue
+		}
+	}
+
+	// Sort pendingMetricRows by canonical metric name in order to speed up search via `is` in the loop below.
+	pendingMetricRows := pmrs.pmrs
+	sort.Slice(pendingMetricRows, func(i, j int) bool {
+		return string(pendingMetricRows[i].MetricName) < string(pendingMetricRows[j].MetricName)
+	})
+	rows := make([]rawRow, 0, len(pendingMetricRows))
+	idb := s.idb()
+	is := idb.getIndexSearch(noDeadline)
+	var tsid TSID
+	for i := range pendingMetricRows {
+		pmr := &pendingMetricRows[i]
+		mr := &pmr.mr
+		if !s.getTSIDFromCache(&tsid, mr.MetricNameRaw) {
+			if err := is.GetOrCreateTSIDByName(&tsid, pmr.MetricName); err != nil {
+				if firstWarn == nil {
+					firstWarn = fmt.Errorf("cannot obtain or create TSID for MetricName %q: %w", pmr.MetricName, err)
+				}
+				continue
+			}
+			s.putTSIDToCache(&tsid, mr.MetricNameRaw)
+		}
+		rows = append(rows, rawRow{
+			TSID:      tsid,
+			Timestamp: mr.Timestamp,
+		})
+	}
+	idb.putIndexSearch(is)
+	if firstWarn != nil {
+		logger.Errorf("warn occurred during metric names registration: %s", firstWarn)
+	}
+
+	if err := s.updatePerDateData(rows); err != nil {
+		return fmt.Errorf("cannot update per-date data: %w", err)
+	}
+	return nil
+}
+
 var (
 	// Limit the concurrency for data ingestion to GOMAXPROCS, since this operation
 	// is CPU bound, so there is no sense in running more than GOMAXPROCS concurrent
 	// goroutines on data ingestion path.
 	addRowsConcurrencyCh = make(chan struct{}, runtime.GOMAXPROCS(-1))
 	addRowsTimeout       = 30 * time.Second
+
+	// addRowsQueueCh limits the number of AddRows calls waiting for a free slot in addRowsConcurrencyCh.
+	addRowsQueueCh = make(chan struct{}, 16*runtime.GOMAXPROCS(-1))
 )
 
+// SetDeletedSeriesTTL sets the duration for keeping tombstones for deleted time series.
+//
+// Tombstones younger than d are carried over to the new indexDB on indexDB rotation.
+// By default tombstones are kept until the indexDB they are stored in is dropped.
+func SetDeletedSeriesTTL(d time.Duration) {
+	deletedSeriesTTL = d
+}
+
+var deletedSeriesTTL time.Duration
+
+// SetReadOnly enables read-only mode for the storage.
+//
+// Read-only storage serves queries, while data ingestion, series deletion and snapshot management
+// are rejected with ErrReadOnly. Background merges, retention-based data removal and indexdb rotation
+// are disabled, so the data files remain unmodified. This allows querying a copy of the data
+// restored from backup while the primary storage continues ingesting new data.
+//
+// The function must be called before opening or creating any storage.
+func SetReadOnly(readOnly bool) {
+	isReadOnly = readOnly
+	mergeset.SetReadOnly(readOnly)
+}
+
+var isReadOnly bool
+
+// IsReadOnly returns true if the storage is opened in read-only mode.
+func IsReadOnly() bool {
+	return isReadOnly
+}
+
+// ErrReadOnly is returned when trying to modify the storage in read-only mode.
+var ErrReadOnly = errors.New("the storage is in read-only mode")
+
+// ErrOverloaded is returned from Storage.AddRows when the storage cannot accept rows
+// in a timely manner because of too many concurrent writers.
+//
+// Callers may check for it with errors.Is and ask clients to retry later.
+var ErrOverloaded = errors.New("storage is overloaded")
+
+// SetAddRowsQueueSize sets the maximum number of AddRows calls, which may wait
+// for a free slot when all the concurrent writers are busy.
+//
+// The function must be called before opening or creating any storage.
+func SetAddRowsQueueSize(n int) {
+	if n <= 0 {
+		// Do nothing
+		return
+	}
+	addRowsQueueCh = make(chan struct{}, n)
+}
+
+// SetAddRowsTimeout sets the maximum duration for AddRows calls to wait in the queue.
+//
+// The function must be called before opening or creating any storage.
+func SetAddRowsTimeout(d time.Duration) {
+	if d <= 0 {
+		// Do nothing
+		return
+	}
+	addRowsTimeout = d
+}
+
 func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]rawRow, error) {
 	idb := s.idb()
 	rowsLen := len(rows)
@@ -1097,6 +1573,10 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 		prevMetricNameRaw []byte
 	)
 	var pmrs *pendingMetricRows
+	var lpa *labelPolicyApplier
+	if hasInvalidLabelPolicies() {
+		lpa = &labelPolicyApplier{}
+	}
 	minTimestamp, maxTimestamp := s.tb.getMinMaxTimestamps()
 	// Return only the first error, since it has no sense in returning all errors.
 	var firstWarn error
@@ -1127,6 +1607,17 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 			atomic.AddUint64(&s.tooBigTimestampRows, 1)
 			continue
 		}
+		if lpa != nil {
+			// Apply invalid label policies before the tsidCache lookup, since tsidCache may contain
+			// entries for invalid metric names registered before the policies were set.
+			var err error
+			if mr, err = lpa.applyToRow(mr); err != nil {
+				if firstWarn == nil {
+					firstWarn = err
+				}
+				continue
+			}
+		}
 		r := &rows[rowsLen+j]
 		j++
 		r.Timestamp = mr.Timestamp
@@ -1,11 +1,15 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"testing/quick"
 	"time"
@@ -585,7 +589,7 @@ func testStorageDeleteMetrics(s *Storage, workerNum int) error {
 	metricBlocksCount := func(tfs *TagFilters) int {
 		// Verify the number of blocks
 		n := 0
-		sr.Init(s, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		sr.Init(s, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
 		for sr.NextMetricBlock() {
 			n++
 		}
@@ -707,6 +711,75 @@ func TestStorageAddRowsConcurrent(t *testing.T) {
 	}
 }
 
+func TestStorageAddRowsOverloaded(t *testing.T) {
+	path := "TestStorageAddRowsOverloaded"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	concurrencyChOrig := addRowsConcurrencyCh
+	queueChOrig := addRowsQueueCh
+	timeoutOrig := addRowsTimeout
+	defer func() {
+		addRowsConcurrencyCh = concurrencyChOrig
+		addRowsQueueCh = queueChOrig
+		addRowsTimeout = timeoutOrig
+	}()
+
+	// Occupy all the writer slots.
+	addRowsConcurrencyCh = make(chan struct{}, 1)
+	addRowsConcurrencyCh <- struct{}{}
+	addRowsQueueCh = make(chan struct{}, 1)
+	addRowsTimeout = 10 * time.Millisecond
+
+	var mn MetricName
+	mn.MetricGroup = []byte("foo")
+	mrs := []MetricRow{{
+		MetricNameRaw: mn.marshalRaw(nil),
+		Timestamp:     time.Now().UnixNano() / 1e6,
+		Value:         123,
+	}}
+
+	// The queue has a free slot, so AddRows must fail after the timeout.
+	if err := s.AddRows(mrs, defaultPrecisionBits); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expecting ErrOverloaded after the timeout; got %v", err)
+	}
+	if n := len(addRowsQueueCh); n != 0 {
+		t.Fatalf("the queue slot must be released after the timeout; got %d occupied slots", n)
+	}
+
+	// The queue is full, so AddRows must fail immediately.
+	addRowsQueueCh <- struct{}{}
+	addRowsTimeout = time.Hour
+	if err := s.AddRows(mrs, defaultPrecisionBits); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expecting ErrOverloaded on full queue; got %v", err)
+	}
+	<-addRowsQueueCh
+
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.AddRowsConcurrencyLimitTimeout != 1 {
+		t.Fatalf("unexpected AddRowsConcurrencyLimitTimeout; got %d; want 1", m.AddRowsConcurrencyLimitTimeout)
+	}
+	if m.AddRowsConcurrencyQueueFull != 1 {
+		t.Fatalf("unexpected AddRowsConcurrencyQueueFull; got %d; want 1", m.AddRowsConcurrencyQueueFull)
+	}
+	if m.AddRowsConcurrencyDroppedRows != 2 {
+		t.Fatalf("unexpected AddRowsConcurrencyDroppedRows; got %d; want 2", m.AddRowsConcurrencyDroppedRows)
+	}
+
+	// Free the writer slot and verify AddRows succeeds.
+	<-addRowsConcurrencyCh
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
 func testStorageAddRows(s *Storage) error {
 	const rowsPerAdd = 1e3
 	const addsCount = 10
@@ -790,6 +863,626 @@ func testStorageAddRows(s *Storage) error {
 	return nil
 }
 
+func TestStorageRotateIndexDBDeletedMetricIDs(t *testing.T) {
+	path := "TestStorageRotateIndexDBDeletedMetricIDs"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		SetDeletedSeriesTTL(0)
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	// Register and delete a few metrics.
+	var mrs []MetricRow
+	var mn MetricName
+	for i := 0; i < 10; i++ {
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     time.Now().UnixNano() / 1e6,
+			Value:         float64(i),
+		})
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	s.debugFlush()
+
+	// getPersistedDeletedMetricIDs returns the number of persisted tombstones and the number of tombstones with the deletion time.
+	getPersistedDeletedMetricIDs := func() (int, int) {
+		t.Helper()
+		idb := s.idb()
+		idb.tb.DebugFlush()
+		is := idb.getIndexSearch(noDeadline)
+		n := 0
+		nWithDeletedAt := 0
+		err := is.iterateDeletedMetricIDs(func(metricID, deletedAt uint64) {
+			n++
+			if deletedAt > 0 {
+				nWithDeletedAt++
+			}
+		})
+		idb.putIndexSearch(is)
+		if err != nil {
+			t.Fatalf("cannot load deleted metricIDs: %s", err)
+		}
+		return n, nWithDeletedAt
+	}
+	deleteMetrics := func(re string, deletedCountExpected int) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte(re), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		deletedCount, err := s.DeleteMetrics([]*TagFilters{tfs})
+		if err != nil {
+			t.Fatalf("cannot delete metrics: %s", err)
+		}
+		if deletedCount != deletedCountExpected {
+			t.Fatalf("unexpected number of deleted metrics; got %d; want %d", deletedCount, deletedCountExpected)
+		}
+	}
+
+	// Tombstones must be stored in the old format without the deletion time if TTL is disabled,
+	// so downgrading to previous releases remains possible.
+	deleteMetrics("metric_[0-4]", len(mrs)/2)
+	if n, nWithDeletedAt := getPersistedDeletedMetricIDs(); n != len(mrs)/2 || nWithDeletedAt != 0 {
+		t.Fatalf("unexpected number of tombstones; got %d (%d with deletion time); want %d (0 with deletion time)", n, nWithDeletedAt, len(mrs)/2)
+	}
+
+	// Tombstones must contain the deletion time if TTL is enabled.
+	SetDeletedSeriesTTL(time.Hour)
+	deleteMetrics("metric_.*", len(mrs)/2)
+	if n, nWithDeletedAt := getPersistedDeletedMetricIDs(); n != len(mrs) || nWithDeletedAt != len(mrs)/2 {
+		t.Fatalf("unexpected number of tombstones; got %d (%d with deletion time); want %d (%d with deletion time)", n, nWithDeletedAt, len(mrs), len(mrs)/2)
+	}
+
+	// Tombstones must be carried over to the new indexDB if they are younger than TTL.
+	// Tombstones without the deletion time are dropped.
+	s.mustRotateIndexDB()
+	if n, _ := getPersistedDeletedMetricIDs(); n != len(mrs)/2 {
+		t.Fatalf("unexpected number of carried over tombstones; got %d; want %d", n, len(mrs)/2)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.DeletedMetricsCarriedOver != uint64(len(mrs)/2) {
+		t.Fatalf("unexpected DeletedMetricsCarriedOver; got %d; want %d", m.DeletedMetricsCarriedOver, len(mrs)/2)
+	}
+	if m.DeletedMetricsExpired != uint64(len(mrs)/2) {
+		t.Fatalf("unexpected DeletedMetricsExpired; got %d; want %d", m.DeletedMetricsExpired, len(mrs)/2)
+	}
+	if m.IndexDBMetrics.DeletedMetricsCount != uint64(len(mrs)) {
+		t.Fatalf("unexpected DeletedMetricsCount; got %d; want %d", m.IndexDBMetrics.DeletedMetricsCount, len(mrs))
+	}
+
+	// Tombstones mustn't be carried over if TTL is disabled.
+	SetDeletedSeriesTTL(0)
+	s.mustRotateIndexDB()
+	if n, _ := getPersistedDeletedMetricIDs(); n != 0 {
+		t.Fatalf("unexpected number of tombstones after the expiration; got %d; want 0", n)
+	}
+	m = Metrics{}
+	s.UpdateMetrics(&m)
+	if m.DeletedMetricsExpired != uint64(len(mrs)) {
+		t.Fatalf("unexpected DeletedMetricsExpired; got %d; want %d", m.DeletedMetricsExpired, len(mrs))
+	}
+}
+
+func TestStorageGetSeriesCountWithFilters(t *testing.T) {
+	path := "TestStorageGetSeriesCountWithFilters"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	const seriesCount = 100
+	ts := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	var mn MetricName
+	for i := 0; i < seriesCount; i++ {
+		mn.MetricGroup = []byte("metric")
+		mn.Tags = []Tag{
+			{[]byte("job"), []byte(fmt.Sprintf("job_%d", i%2))},
+			{[]byte("instance"), []byte(fmt.Sprintf("instance_%d", i))},
+		}
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     ts,
+			Value:         float64(i),
+		})
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	s.debugFlush()
+
+	tr := TimeRange{
+		MinTimestamp: ts - 3600*1000,
+		MaxTimestamp: ts + 3600*1000,
+	}
+	f := func(key, value string, nExpected uint64) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add([]byte(key), []byte(value), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		n, err := s.GetSeriesCountWithFilters([]*TagFilters{tfs}, tr, 1e6, noDeadline)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n != nExpected {
+			t.Fatalf("unexpected series count for %s=%q; got %d; want %d", key, value, n, nExpected)
+		}
+	}
+	f("", "metric", seriesCount)
+	f("job", "job_0", seriesCount/2)
+	f("instance", "instance_3", 1)
+	f("job", "non-existing", 0)
+
+	// Dry run mustn't delete series.
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("job"), []byte("job_1"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	n, mns, err := s.DeleteMetricsDryRun([]*TagFilters{tfs}, 3)
+	if err != nil {
+		t.Fatalf("unexpected error in DeleteMetricsDryRun: %s", err)
+	}
+	if n != seriesCount/2 {
+		t.Fatalf("unexpected number of series to delete; got %d; want %d", n, seriesCount/2)
+	}
+	if len(mns) != 3 {
+		t.Fatalf("unexpected number of metric names returned from dry run; got %d; want 3", len(mns))
+	}
+	for i := range mns {
+		if job := string(mns[i].GetTagValue("job")); job != "job_1" {
+			t.Fatalf("unexpected job in metric name returned from dry run; got %q; want %q", job, "job_1")
+		}
+	}
+	f("", "metric", seriesCount)
+
+	// Deleted series mustn't be counted.
+	if _, err := s.DeleteMetrics([]*TagFilters{tfs}); err != nil {
+		t.Fatalf("cannot delete metrics: %s", err)
+	}
+	f("", "metric", seriesCount/2)
+	n, mns, err = s.DeleteMetricsDryRun([]*TagFilters{tfs}, 3)
+	if err != nil {
+		t.Fatalf("unexpected error in DeleteMetricsDryRun: %s", err)
+	}
+	if n != 0 || len(mns) != 0 {
+		t.Fatalf("unexpected dry run result for deleted series; got n=%d, mns=%d; want zeros", n, len(mns))
+	}
+}
+
+func TestStorageSearchMetricNamesPage(t *testing.T) {
+	path := "TestStorageSearchMetricNamesPage"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	const seriesCount = 100
+	ts := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	var mn MetricName
+	for i := 0; i < seriesCount; i++ {
+		mn.MetricGroup = []byte("metric")
+		mn.Tags = []Tag{
+			{[]byte("job"), []byte(fmt.Sprintf("job_%d", i%2))},
+			{[]byte("instance"), []byte(fmt.Sprintf("instance_%d", i))},
+		}
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     ts,
+			Value:         float64(i),
+		})
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	s.debugFlush()
+
+	tr := TimeRange{
+		MinTimestamp: ts - 3600*1000,
+		MaxTimestamp: ts + 3600*1000,
+	}
+	f := func(value string, limit, nExpected int) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add([]byte("job"), []byte(value), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		afterMetricID := uint64(0)
+		m := make(map[string]bool)
+		n := 0
+		for {
+			metricIDs, metricNames, err := s.SearchMetricNamesPage([]*TagFilters{tfs}, tr, afterMetricID, limit, 1e6, noDeadline)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(metricNames) > limit {
+				t.Fatalf("too many metric names on the page; got %d; want up to %d", len(metricNames), limit)
+			}
+			if len(metricIDs) != len(metricNames) {
+				t.Fatalf("unexpected number of metricIDs; got %d; want %d", len(metricIDs), len(metricNames))
+			}
+			if len(metricNames) == 0 {
+				break
+			}
+			for i, metricName := range metricNames {
+				if metricIDs[i] <= afterMetricID {
+					t.Fatalf("metricIDs must be sorted without duplicates; got %d after %d", metricIDs[i], afterMetricID)
+				}
+				afterMetricID = metricIDs[i]
+				if m[string(metricName)] {
+					t.Fatalf("duplicate metric name %q", metricName)
+				}
+				m[string(metricName)] = true
+				if err := mn.Unmarshal(metricName); err != nil {
+					t.Fatalf("cannot unmarshal metric name: %s", err)
+				}
+				if job := string(mn.GetTagValue("job")); job != value {
+					t.Fatalf("unexpected job; got %q; want %q", job, value)
+				}
+			}
+			n += len(metricNames)
+		}
+		if n != nExpected {
+			t.Fatalf("unexpected number of series for job=%q with limit=%d; got %d; want %d", value, limit, n, nExpected)
+		}
+	}
+	f("job_0", 1, seriesCount/2)
+	f("job_0", 7, seriesCount/2)
+	f("job_1", seriesCount, seriesCount/2)
+	f("non-existing", 10, 0)
+
+	// The number of matching series is limited by maxMetrics.
+	// Use distinct filter in order to avoid hitting the tag cache.
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("job"), []byte("job_.+"), false, true); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	if _, _, err := s.SearchMetricNamesPage([]*TagFilters{tfs}, tr, 0, 1, seriesCount/4, noDeadline); err == nil {
+		t.Fatalf("expecting non-nil error when the number of matching series exceeds maxMetrics")
+	}
+}
+
+func TestStorageRegisterMetricNames(t *testing.T) {
+	path := "TestStorageRegisterMetricNames"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	const seriesCount = 100
+	ts := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	var mn MetricName
+	for i := 0; i < seriesCount; i++ {
+		mn.MetricGroup = []byte("metric")
+		mn.Tags = []Tag{
+			{[]byte("job"), []byte("job")},
+			{[]byte("instance"), []byte(fmt.Sprintf("instance_%d", i))},
+		}
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     ts,
+		})
+	}
+	if err := s.RegisterMetricNames(mrs); err != nil {
+		t.Fatalf("unexpected error when registering metric names: %s", err)
+	}
+	s.debugFlush()
+
+	// The registered series must be searchable without samples.
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("metric"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: ts - 3600*1000,
+		MaxTimestamp: ts + 3600*1000,
+	}
+	n, err := s.GetSeriesCountWithFilters([]*TagFilters{tfs}, tr, 1e6, noDeadline)
+	if err != nil {
+		t.Fatalf("unexpected error in GetSeriesCountWithFilters: %s", err)
+	}
+	if n != seriesCount {
+		t.Fatalf("unexpected number of registered series; got %d; want %d", n, seriesCount)
+	}
+
+	// Samples for the registered series must be added via the fast path.
+	for i := range mrs {
+		mrs[i].Value = float64(i)
+	}
+	slowRowInserts := atomic.LoadUint64(&s.slowRowInserts)
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	if n := atomic.LoadUint64(&s.slowRowInserts) - slowRowInserts; n != 0 {
+		t.Fatalf("unexpected number of slow inserts for registered series; got %d; want 0", n)
+	}
+}
+
+func TestStorageSearchTagValueSuggestions(t *testing.T) {
+	path := "TestStorageSearchTagValueSuggestions"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	jobs := map[string]int{
+		"api":         3,
+		"api-gateway": 5,
+		"apache":      1,
+		"web-API":     2,
+		"db":          4,
+	}
+	ts := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	var mn MetricName
+	for job, n := range jobs {
+		for i := 0; i < n; i++ {
+			mn.MetricGroup = []byte("metric")
+			mn.Tags = []Tag{
+				{[]byte("job"), []byte(job)},
+				{[]byte("instance"), []byte(fmt.Sprintf("instance_%d", i))},
+			}
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     ts,
+				Value:         float64(i),
+			})
+		}
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	s.debugFlush()
+
+	f := func(query string, substring bool, maxTagValues int, resultExpected map[string]uint64) {
+		t.Helper()
+		tvss, err := s.SearchTagValueSuggestions([]byte("job"), []byte(query), substring, maxTagValues, noDeadline)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := make(map[string]uint64)
+		for _, tvs := range tvss {
+			result[tvs.Value] = tvs.SeriesCount
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected suggestions for query=%q, substring=%v\ngot\n%v\nwant\n%v", query, substring, result, resultExpected)
+		}
+	}
+	f("ap", false, 1e5, map[string]uint64{
+		"api":         3,
+		"api-gateway": 5,
+		"apache":      1,
+	})
+	f("api", false, 1e5, map[string]uint64{
+		"api":         3,
+		"api-gateway": 5,
+	})
+	f("api", true, 1e5, map[string]uint64{
+		"api":         3,
+		"api-gateway": 5,
+		"web-API":     2,
+	})
+	f("", false, 1e5, map[string]uint64{
+		"api":         3,
+		"api-gateway": 5,
+		"apache":      1,
+		"web-API":     2,
+		"db":          4,
+	})
+	f("foo", true, 1e5, map[string]uint64{})
+	f("ap", false, 1, map[string]uint64{
+		"apache": 1,
+	})
+
+	// Deleted series mustn't be counted.
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("instance"), []byte("instance_0"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	if _, err := s.DeleteMetrics([]*TagFilters{tfs}); err != nil {
+		t.Fatalf("cannot delete metrics: %s", err)
+	}
+	f("ap", false, 1e5, map[string]uint64{
+		"api":         2,
+		"api-gateway": 4,
+	})
+}
+
+func TestStorageReadOnly(t *testing.T) {
+	path := "TestStorageReadOnly"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	const seriesCount = 10
+	ts := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	var mn MetricName
+	for i := 0; i < seriesCount; i++ {
+		mn.MetricGroup = []byte("metric")
+		mn.Tags = []Tag{
+			{[]byte("instance"), []byte(fmt.Sprintf("instance_%d", i))},
+		}
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     ts,
+			Value:         float64(i),
+		})
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	s.MustClose()
+
+	SetReadOnly(true)
+	defer SetReadOnly(false)
+	s, err = OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage in read-only mode: %s", err)
+	}
+	defer s.MustClose()
+
+	// Queries must work.
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("metric"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: ts - 3600*1000,
+		MaxTimestamp: ts + 3600*1000,
+	}
+	n, err := s.GetSeriesCountWithFilters([]*TagFilters{tfs}, tr, 1e6, noDeadline)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != seriesCount {
+		t.Fatalf("unexpected series count; got %d; want %d", n, seriesCount)
+	}
+
+	// Writes must be rejected.
+	if err := s.AddRows(mrs, defaultPrecisionBits); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("unexpected error when adding rows in read-only mode; got %v; want %v", err, ErrReadOnly)
+	}
+	if _, err := s.DeleteMetrics([]*TagFilters{tfs}); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("unexpected error when deleting metrics in read-only mode; got %v; want %v", err, ErrReadOnly)
+	}
+	if _, err := s.CreateSnapshot(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("unexpected error when creating snapshot in read-only mode; got %v; want %v", err, ErrReadOnly)
+	}
+}
+
+func TestStorageDedupByAgeReadOnly(t *testing.T) {
+	path := "TestStorageDedupByAgeReadOnly"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	// Add samples with 10s interval for an hour 60 days ago.
+	start := time.Now().UnixNano()/1e6 - 60*24*3600*1000
+	start -= start % (60 * 1000)
+	var mn MetricName
+	mn.MetricGroup = []byte("metric")
+	metricNameRaw := mn.marshalRaw(nil)
+	var mrs []MetricRow
+	for i := 0; i < 360; i++ {
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: metricNameRaw,
+			Timestamp:     start + int64(i)*10*1000,
+			Value:         float64(i),
+		})
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.MustClose()
+
+	getDataFiles := func() map[string]int64 {
+		t.Helper()
+		m := make(map[string]int64)
+		err := filepath.Walk(path+"/data", func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() {
+				m[p] = fi.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("cannot list data files: %s", err)
+		}
+		return m
+	}
+	filesExpected := getDataFiles()
+
+	// Open the storage in read-only mode with de-duplication by age enabled.
+	defer func() {
+		dedupIntervalsByAge = nil
+	}()
+	if err := SetDedupIntervalsByAge([]string{"1d:1m"}); err != nil {
+		t.Fatalf("cannot set dedup intervals: %s", err)
+	}
+	SetReadOnly(true)
+	defer SetReadOnly(false)
+	s, err = OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage in read-only mode: %s", err)
+	}
+
+	// De-duplicate the partition in the same way as dedupWatcher does.
+	ptws := s.tb.GetPartitions(nil)
+	if len(ptws) != 1 {
+		t.Fatalf("unexpected number of partitions; got %d; want 1", len(ptws))
+	}
+	pt := ptws[0].pt
+	if err := pt.dedupIfNeeded(); err != nil {
+		t.Fatalf("cannot de-duplicate partition: %s", err)
+	}
+	if n := atomic.LoadUint64(&pt.bigMergesCount) + atomic.LoadUint64(&pt.smallMergesCount); n != 0 {
+		t.Fatalf("unexpected merges in read-only mode; got %d; want 0", n)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if n := m.TableMetrics.SmallRowsCount + m.TableMetrics.BigRowsCount; n != uint64(len(mrs)) {
+		t.Fatalf("unexpected number of rows in read-only mode; got %d; want %d", n, len(mrs))
+	}
+	s.tb.PutPartitions(ptws)
+	s.MustClose()
+
+	// Parts must be left untouched.
+	if files := getDataFiles(); !reflect.DeepEqual(files, filesExpected) {
+		t.Fatalf("unexpected data files after opening the storage in read-only mode;\ngot\n%v\nwant\n%v", files, filesExpected)
+	}
+}
+
 func TestStorageRotateIndexDB(t *testing.T) {
 	path := "TestStorageRotateIndexDB"
 	s, err := OpenStorage(path, 0)
@@ -882,3 +1575,364 @@ func containsString(a []string, s string) bool {
 	}
 	return false
 }
+
+func TestStorageResetCaches(t *testing.T) {
+	path := "TestStorageResetCaches"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	if err := testStorageAddMetrics(s, 0); err != nil {
+		t.Fatalf("cannot add metrics: %s", err)
+	}
+
+	// Fill tagFilters cache.
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("job"), []byte("webservice_0"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: 0,
+		MaxTimestamp: 2e10,
+	}
+	if _, err := s.searchTSIDs([]*TagFilters{tfs}, tr, 1e5, noDeadline, nil); err != nil {
+		t.Fatalf("cannot search tsids: %s", err)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.IndexDBMetrics.TagCacheSize == 0 {
+		t.Fatalf("expecting non-empty tagFilters cache")
+	}
+	if m.MetricNameCacheSize == 0 {
+		t.Fatalf("expecting non-empty metricName cache")
+	}
+
+	s.ResetTagFiltersCache()
+	s.ResetMetricNameCache()
+	m = Metrics{}
+	s.UpdateMetrics(&m)
+	if m.IndexDBMetrics.TagCacheSize != 0 {
+		t.Fatalf("unexpected tagFilters cache size after reset; got %d; want 0", m.IndexDBMetrics.TagCacheSize)
+	}
+	if m.TagFiltersCacheResets != 1 {
+		t.Fatalf("unexpected number of tagFilters cache resets; got %d; want 1", m.TagFiltersCacheResets)
+	}
+	if m.MetricNameCacheSize != 0 {
+		t.Fatalf("unexpected metricName cache size after reset; got %d; want 0", m.MetricNameCacheSize)
+	}
+	if m.MetricNameCacheResets != 1 {
+		t.Fatalf("unexpected number of metricName cache resets; got %d; want 1", m.MetricNameCacheResets)
+	}
+
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
+func TestStorageDeleteMetricsWithoutData(t *testing.T) {
+	path := "TestStorageDeleteMetricsWithoutData"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	// Check metrics for data in small batches.
+	batchSizeOrig := maxMetricIDsWithoutDataBatchSize
+	maxMetricIDsWithoutDataBatchSize = 2
+	defer func() {
+		maxMetricIDsWithoutDataBatchSize = batchSizeOrig
+	}()
+
+	// Add old_metric_* to the partition, which is going to be dropped,
+	// and new_metric to both the old and the recent partitions.
+	oldTimestamp := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC).UnixNano() / 1e6
+	newTimestamp := time.Now().UnixNano()/1e6 - 2*3600*1000
+	var mrs []MetricRow
+	for _, r := range []struct {
+		name      string
+		timestamp int64
+	}{
+		{"old_metric_1", oldTimestamp},
+		{"old_metric_2", oldTimestamp},
+		{"old_metric_3", oldTimestamp},
+		{"old_metric_4", oldTimestamp},
+		{"old_metric_5", oldTimestamp},
+		{"new_metric", oldTimestamp},
+		{"new_metric", newTimestamp},
+	} {
+		var mn MetricName
+		mn.MetricGroup = []byte(r.name)
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     r.timestamp,
+			Value:         1,
+		})
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.debugFlush()
+
+	// Drop the old partition in the same way as the retention watcher does.
+	s.tb.ptwsLock.Lock()
+	dst := s.tb.ptws[:0]
+	var ptwsDrop []*partitionWrapper
+	for _, ptw := range s.tb.ptws {
+		if ptw.pt.tr.MaxTimestamp < newTimestamp-31*24*3600*1000 {
+			ptwsDrop = append(ptwsDrop, ptw)
+		} else {
+			dst = append(dst, ptw)
+		}
+	}
+	s.tb.ptws = dst
+	s.tb.ptwsLock.Unlock()
+	if len(ptwsDrop) != 1 {
+		t.Fatalf("unexpected number of partitions to drop; got %d; want 1", len(ptwsDrop))
+	}
+	for _, ptw := range ptwsDrop {
+		ptw.scheduleToDrop()
+		ptw.decRef()
+	}
+
+	// Simulate ingestion of a single old metric during the deletion.
+	// Its (date, metricID) entry for the current date may be missing in the indexdb yet,
+	// so it must be detected via pending hour entries.
+	var oldMetricIDs uint64set.Set
+	var c dateMetricIDCursor
+	is := s.idb().getIndexSearch(noDeadline)
+	minDate := uint64(newTimestamp) / msecPerDay
+	err = is.addMetricIDsBeforeDate(&oldMetricIDs, &c, minDate, 100, nil)
+	if err == nil {
+		err = is.removeMetricIDsWithDataSince(&oldMetricIDs, minDate, nil)
+	}
+	s.idb().putIndexSearch(is)
+	if err != nil {
+		t.Fatalf("cannot obtain old metricIDs: %s", err)
+	}
+	if oldMetricIDs.Len() != 5 {
+		t.Fatalf("unexpected number of old metricIDs; got %d; want 5", oldMetricIDs.Len())
+	}
+	resumedMetricID := oldMetricIDs.AppendTo(nil)[0]
+	s.pendingHourEntriesLock.Lock()
+	s.pendingHourEntries.Add(resumedMetricID)
+	s.pendingHourEntriesLock.Unlock()
+
+	n, err := s.deleteMetricsWithoutData()
+	if err != nil {
+		t.Fatalf("cannot delete metrics without data: %s", err)
+	}
+	if n != 4 {
+		t.Fatalf("unexpected number of deleted metrics; got %d; want 4", n)
+	}
+	names, err := s.SearchTagValues(nil, 100, noDeadline)
+	if err != nil {
+		t.Fatalf("cannot search metric names: %s", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "new_metric" || !strings.HasPrefix(names[1], "old_metric_") {
+		t.Fatalf("unexpected metric names; got %q; want an old metric and %q", names, "new_metric")
+	}
+
+	// The subsequent call mustn't delete anything.
+	n, err = s.deleteMetricsWithoutData()
+	if err != nil {
+		t.Fatalf("cannot delete metrics without data: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("unexpected number of deleted metrics on the second call; got %d; want 0", n)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.DeletedMetricsWithoutData != 4 {
+		t.Fatalf("unexpected DeletedMetricsWithoutData; got %d; want 4", m.DeletedMetricsWithoutData)
+	}
+
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
+func TestStorageListPartitions(t *testing.T) {
+	path := "TestStorageListPartitions"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	var mrs []MetricRow
+	var mn MetricName
+	mn.MetricGroup = []byte("metric")
+	for _, month := range []time.Month{time.March, time.January, time.February, time.January} {
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     time.Date(2020, month, 10, 0, 0, 0, 0, time.UTC).UnixNano() / 1e6,
+			Value:         1,
+		})
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.debugFlush()
+
+	pss := s.ListPartitions()
+	var names []string
+	var rowsCount uint64
+	for _, ps := range pss {
+		names = append(names, ps.Name)
+		rowsCount += ps.SmallRowsCount + ps.BigRowsCount
+		if ps.MinTimestamp > ps.MaxTimestamp {
+			t.Fatalf("invalid time range for partition %q: [%d..%d]", ps.Name, ps.MinTimestamp, ps.MaxTimestamp)
+		}
+		if ps.SmallPartsCount+ps.BigPartsCount == 0 {
+			t.Fatalf("expecting non-zero parts for partition %q", ps.Name)
+		}
+	}
+	namesExpected := []string{"2020_01", "2020_02", "2020_03"}
+	if !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected partitions; got %q; want %q", names, namesExpected)
+	}
+	if rowsCount != uint64(len(mrs)) {
+		t.Fatalf("unexpected rows count; got %d; want %d", rowsCount, len(mrs))
+	}
+
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
+func TestStorageDedupByAge(t *testing.T) {
+	path := "TestStorageDedupByAge"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	// Add samples with 10s interval for an hour 60 days ago, while de-duplication by age is disabled.
+	const seriesCount = 3
+	start := time.Now().UnixNano()/1e6 - 60*24*3600*1000
+	start -= start % (60 * 1000)
+	// All the samples go to a single part, so its blocks aren't unpacked by background merges.
+	var mrs []MetricRow
+	for i := 0; i < seriesCount; i++ {
+		var mn MetricName
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		metricNameRaw := mn.marshalRaw(nil)
+		for j := 0; j < 360; j++ {
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     start + int64(j)*10*1000,
+				Value:         float64(j),
+			})
+		}
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.debugFlush()
+	getRowsCount := func() uint64 {
+		t.Helper()
+		var m Metrics
+		s.UpdateMetrics(&m)
+		return m.TableMetrics.SmallRowsCount + m.TableMetrics.BigRowsCount
+	}
+	if n := getRowsCount(); n != seriesCount*360 {
+		t.Fatalf("unexpected number of rows before de-duplication; got %d; want %d", n, seriesCount*360)
+	}
+
+	// Enable de-duplication by age and de-duplicate the partition in the same way as dedupWatcher does.
+	defer func() {
+		dedupIntervalsByAge = nil
+	}()
+	if err := SetDedupIntervalsByAge([]string{"1d:1m"}); err != nil {
+		t.Fatalf("cannot set dedup intervals: %s", err)
+	}
+	ptws := s.tb.GetPartitions(nil)
+	if len(ptws) != 1 {
+		t.Fatalf("unexpected number of partitions; got %d; want 1", len(ptws))
+	}
+	pt := ptws[0].pt
+	if err := pt.dedupIfNeeded(); err != nil {
+		t.Fatalf("cannot de-duplicate partition: %s", err)
+	}
+	if n := getRowsCount(); n != seriesCount*60 {
+		t.Fatalf("unexpected number of rows after de-duplication; got %d; want %d", n, seriesCount*60)
+	}
+	if interval := atomic.LoadInt64(&pt.appliedDedupInterval); interval != 60*1000 {
+		t.Fatalf("unexpected applied de-duplication interval; got %d; want %d", interval, 60*1000)
+	}
+	if interval := readAppliedDedupInterval(pt.bigPartsPath); interval != 60*1000 {
+		t.Fatalf("unexpected persisted de-duplication interval; got %d; want %d", interval, 60*1000)
+	}
+
+	// Verify the remaining samples are at least 1m apart.
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("metric_.*"), false, true); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: start,
+		MaxTimestamp: start + 3600*1000,
+	}
+	var sr Search
+	sr.Init(s, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+	timestampsByMetric := make(map[string][]int64)
+	for sr.NextMetricBlock() {
+		var b Block
+		sr.MetricBlockRef.BlockRef.MustReadBlock(&b, true)
+		if err := b.UnmarshalData(); err != nil {
+			t.Fatalf("cannot unmarshal block: %s", err)
+		}
+		metricName := string(sr.MetricBlockRef.MetricName)
+		timestampsByMetric[metricName] = append(timestampsByMetric[metricName], b.Timestamps()...)
+	}
+	if err := sr.Error(); err != nil {
+		t.Fatalf("search error: %s", err)
+	}
+	sr.MustClose()
+	if len(timestampsByMetric) != seriesCount {
+		t.Fatalf("unexpected number of series found; got %d; want %d", len(timestampsByMetric), seriesCount)
+	}
+	for metricName, timestamps := range timestampsByMetric {
+		sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+		for i := 1; i < len(timestamps); i++ {
+			if d := timestamps[i] - timestamps[i-1]; d < 60*1000 {
+				t.Fatalf("unexpected interval between samples for %q; got %dms; want at least %dms", metricName, d, 60*1000)
+			}
+		}
+	}
+
+	// Subsequent calls mustn't merge the partition again.
+	mergesCount := atomic.LoadUint64(&pt.bigMergesCount) + atomic.LoadUint64(&pt.smallMergesCount)
+	if err := pt.dedupIfNeeded(); err != nil {
+		t.Fatalf("cannot de-duplicate partition: %s", err)
+	}
+	if n := atomic.LoadUint64(&pt.bigMergesCount) + atomic.LoadUint64(&pt.smallMergesCount); n != mergesCount {
+		t.Fatalf("unexpected merges after the partition has been de-duplicated; got %d; want %d", n-mergesCount, 0)
+	}
+
+	// New rows must reset the applied de-duplication interval.
+	var mn MetricName
+	mn.MetricGroup = []byte("metric_0")
+	mrs = []MetricRow{{
+		MetricNameRaw: mn.marshalRaw(nil),
+		Timestamp:     start + 3600*1000,
+		Value:         1,
+	}}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	if interval := atomic.LoadInt64(&pt.appliedDedupInterval); interval != 0 {
+		t.Fatalf("unexpected applied de-duplication interval after adding rows; got %d; want 0", interval)
+	}
+	if interval := readAppliedDedupInterval(pt.bigPartsPath); interval != 0 {
+		t.Fatalf("unexpected persisted de-duplication interval after adding rows; got %d; want 0", interval)
+	}
+	s.tb.PutPartitions(ptws)
+
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
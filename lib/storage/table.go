@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -31,6 +32,9 @@ type table struct {
 
 	retentionMilliseconds int64
 	retentionWatcherWG    sync.WaitGroup
+
+	// partitionsDroppedCh is notified when partitions outside the retention are dropped.
+	partitionsDroppedCh chan struct{}
 }
 
 // partitionWrapper provides refcounting mechanism for the partition.
@@ -128,6 +132,8 @@ func openTable(path string, retentionMonths int, getDeletedMetricIDs func() *uin
 		flockF: flockF,
 
 		stop: make(chan struct{}),
+
+		partitionsDroppedCh: make(chan struct{}, 1),
 	}
 	for _, pt := range pts {
 		tb.addPartitionNolock(pt)
@@ -137,7 +143,10 @@ func openTable(path string, retentionMonths int, getDeletedMetricIDs func() *uin
 	}
 	tb.retentionMilliseconds = int64(retentionMonths) * 31 * 24 * 3600 * 1e3
 
-	tb.startRetentionWatcher()
+	if !isReadOnly {
+		// Do not drop partitions outside the retention in read-only mode.
+		tb.startRetentionWatcher()
+	}
 	return tb, nil
 }
 
@@ -213,9 +222,7 @@ func (tb *table) MustClose() {
 	}
 }
 
-// flushRawRows flushes all the pending rows, so they become visible to search.
-//
-// This function is for debug purposes only.
+// flushRawRows converts all the pending rows into inmemory parts, so they become visible to search.
 func (tb *table) flushRawRows() {
 	ptws := tb.GetPartitions(nil)
 	defer tb.PutPartitions(ptws)
@@ -225,6 +232,34 @@ func (tb *table) flushRawRows() {
 	}
 }
 
+// flushToDisk makes sure all the rows added to tb before the call are stored in file parts.
+func (tb *table) flushToDisk() error {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	for _, ptw := range ptws {
+		if err := ptw.pt.flushToDisk(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasInmemoryPartsCreatedBefore returns true if tb contains inmemory parts created before the given deadline in seconds.
+//
+// Inmemory parts are flushed to disk every inmemoryPartsFlushInterval.
+func (tb *table) hasInmemoryPartsCreatedBefore(deadline uint64) bool {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	for _, ptw := range ptws {
+		if ptw.pt.hasInmemoryPartsCreatedBefore(deadline) {
+			return true
+		}
+	}
+	return false
+}
+
 // TableMetrics contains essential metrics for the table.
 type TableMetrics struct {
 	partitionMetrics
@@ -242,6 +277,66 @@ func (tb *table) UpdateMetrics(m *TableMetrics) {
 	tb.ptwsLock.Unlock()
 }
 
+// PartitionStats contains stats for a single per-month partition.
+type PartitionStats struct {
+	// Name is the partition name in the form YYYY_MM.
+	Name string
+
+	// MinTimestamp and MaxTimestamp contain the time range covered by the partition in milliseconds.
+	MinTimestamp int64
+	MaxTimestamp int64
+
+	SmallPartsCount uint64
+	BigPartsCount   uint64
+
+	SmallRowsCount uint64
+	BigRowsCount   uint64
+
+	SmallSizeBytes uint64
+	BigSizeBytes   uint64
+
+	// PendingRows is the number of rows, which aren't converted to searchable parts yet.
+	PendingRows uint64
+
+	// ActiveSmallMerges and ActiveBigMerges is the number of currently running merges for the partition.
+	ActiveSmallMerges uint64
+	ActiveBigMerges   uint64
+}
+
+// ListPartitions appends stats for tb partitions to dst and returns the result.
+//
+// Partitions are sorted by time.
+func (tb *table) ListPartitions(dst []PartitionStats) []PartitionStats {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	dstLen := len(dst)
+	for _, ptw := range ptws {
+		pt := ptw.pt
+		var m partitionMetrics
+		pt.UpdateMetrics(&m)
+		dst = append(dst, PartitionStats{
+			Name:              pt.name,
+			MinTimestamp:      pt.tr.MinTimestamp,
+			MaxTimestamp:      pt.tr.MaxTimestamp,
+			SmallPartsCount:   m.SmallPartsCount,
+			BigPartsCount:     m.BigPartsCount,
+			SmallRowsCount:    m.SmallRowsCount,
+			BigRowsCount:      m.BigRowsCount,
+			SmallSizeBytes:    m.SmallSizeBytes,
+			BigSizeBytes:      m.BigSizeBytes,
+			PendingRows:       m.PendingRows,
+			ActiveSmallMerges: m.ActiveSmallMerges,
+			ActiveBigMerges:   m.ActiveBigMerges,
+		})
+	}
+	a := dst[dstLen:]
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].MinTimestamp < a[j].MinTimestamp
+	})
+	return dst
+}
+
 // AddRows adds the given rows to the table tb.
 func (tb *table) AddRows(rows []rawRow) error {
 	if len(rows) == 0 {
@@ -411,7 +506,34 @@ func (tb *table) retentionWatcher() {
 			ptw.scheduleToDrop()
 			ptw.decRef()
 		}
+
+		// Notify the storage, so it could drop index entries for the series without data in the remaining partitions.
+		select {
+		case tb.partitionsDroppedCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// getMinTimestamp returns the minimum timestamp for the data, which may be stored in tb.
+func (tb *table) getMinTimestamp() int64 {
+	tb.ptwsLock.Lock()
+	defer tb.ptwsLock.Unlock()
+
+	if len(tb.ptws) == 0 {
+		minTimestamp, _ := tb.getMinMaxTimestamps()
+		return minTimestamp
+	}
+	minTimestamp := tb.ptws[0].pt.tr.MinTimestamp
+	for _, ptw := range tb.ptws[1:] {
+		if ptw.pt.tr.MinTimestamp < minTimestamp {
+			minTimestamp = ptw.pt.tr.MinTimestamp
+		}
+	}
+	if minTimestamp < 0 {
+		minTimestamp = 0
 	}
+	return minTimestamp
 }
 
 // GetPartitions appends tb's partitions snapshot to dst and returns the result.
@@ -22,6 +22,8 @@ type tableSearch struct {
 	ptsPool []partitionSearch
 	ptsHeap partitionSearchHeap
 
+	pruneStats PruneStats
+
 	err error
 
 	nextBlockNoop bool
@@ -47,6 +49,7 @@ func (ts *tableSearch) reset() {
 	}
 	ts.ptsHeap = ts.ptsHeap[:0]
 
+	ts.pruneStats = PruneStats{}
 	ts.err = nil
 	ts.nextBlockNoop = false
 	ts.needClosing = false
@@ -83,13 +86,23 @@ func (ts *tableSearch) Init(tb *table, tsids []TSID, tr TimeRange) {
 
 	ts.ptws = tb.GetPartitions(ts.ptws[:0])
 
-	// Initialize the ptsPool.
+	// Initialize the ptsPool only for partitions overlapping tr.
 	if n := len(ts.ptws) - cap(ts.ptsPool); n > 0 {
 		ts.ptsPool = append(ts.ptsPool[:cap(ts.ptsPool)], make([]partitionSearch, n)...)
 	}
-	ts.ptsPool = ts.ptsPool[:len(ts.ptws)]
-	for i, ptw := range ts.ptws {
-		ts.ptsPool[i].Init(ptw.pt, tsids, tr)
+	ts.ptsPool = ts.ptsPool[:0]
+	for _, ptw := range ts.ptws {
+		ptr := &ptw.pt.tr
+		if ptr.MinTimestamp > tr.MaxTimestamp || ptr.MaxTimestamp < tr.MinTimestamp {
+			ts.pruneStats.PartitionsSkipped++
+			continue
+		}
+		ts.ptsPool = ts.ptsPool[:len(ts.ptsPool)+1]
+		pts := &ts.ptsPool[len(ts.ptsPool)-1]
+		pts.Init(ptw.pt, tsids, tr)
+		ts.pruneStats.PartitionsSearched++
+		ts.pruneStats.PartsSearched += len(pts.psPool)
+		ts.pruneStats.PartsSkipped += pts.partsSkipped
 	}
 
 	// Initialize the ptsHeap.
@@ -119,6 +132,21 @@ func (ts *tableSearch) Init(tb *table, tsids []TSID, tr TimeRange) {
 	ts.nextBlockNoop = true
 }
 
+// PruneStats contains statistics on partitions and parts pruned by the search time range.
+type PruneStats struct {
+	// PartitionsSearched is the number of partitions overlapping the search time range.
+	PartitionsSearched int
+
+	// PartitionsSkipped is the number of partitions skipped, since they don't overlap the search time range.
+	PartitionsSkipped int
+
+	// PartsSearched is the number of parts overlapping the search time range.
+	PartsSearched int
+
+	// PartsSkipped is the number of parts skipped in the searched partitions, since they don't overlap the search time range.
+	PartsSkipped int
+}
+
 // NextBlock advances to the next block.
 //
 // The blocks are sorted by (TSID, MinTimestamp). Two subsequent blocks
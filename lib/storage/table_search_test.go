@@ -252,6 +252,10 @@ func testTableSearchSerial(tb *table, tsids []TSID, tr TimeRange, rbsExpected []
 	bs := []Block{}
 	var ts tableSearch
 	ts.Init(tb, tsids, tr)
+	if err := testVerifyPruneStats(tb, tr, ts.pruneStats); err != nil {
+		ts.MustClose()
+		return err
+	}
 	for ts.NextBlock() {
 		var b Block
 		ts.BlockRef.MustReadBlock(&b, true)
@@ -287,3 +291,29 @@ func testTableSearchSerial(tb *table, tsids []TSID, tr TimeRange, rbsExpected []
 
 	return nil
 }
+
+func testVerifyPruneStats(tb *table, tr TimeRange, ps PruneStats) error {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	// Verify only partition stats, since parts may be changed by background merges.
+	partitionsSearchedExpected := 0
+	partitionsSkippedExpected := 0
+	for _, ptw := range ptws {
+		if ptw.pt.tr.MinTimestamp > tr.MaxTimestamp || ptw.pt.tr.MaxTimestamp < tr.MinTimestamp {
+			partitionsSkippedExpected++
+		} else {
+			partitionsSearchedExpected++
+		}
+	}
+	if ps.PartitionsSearched != partitionsSearchedExpected {
+		return fmt.Errorf("unexpected PartitionsSearched; got %d; want %d", ps.PartitionsSearched, partitionsSearchedExpected)
+	}
+	if ps.PartitionsSkipped != partitionsSkippedExpected {
+		return fmt.Errorf("unexpected PartitionsSkipped; got %d; want %d", ps.PartitionsSkipped, partitionsSkippedExpected)
+	}
+	if ps.PartitionsSearched == 0 && ps.PartsSearched > 0 {
+		return fmt.Errorf("unexpected PartsSearched=%d for zero PartitionsSearched", ps.PartsSearched)
+	}
+	return nil
+}
@@ -36,6 +36,19 @@ func NewTagFilters() *TagFilters {
 //
 // Finalize must be called after tfs is constructed.
 func (tfs *TagFilters) Add(key, value []byte, isNegative, isRegexp bool) error {
+	if string(key) == graphiteFilterKey {
+		// Convert {__graphite__="foo.*.bar"} into {__name__=~"foo\\.[^.]*\\.bar"}.
+		if isRegexp {
+			return fmt.Errorf("%s filter doesn't support regexps; use Graphite wildcards with `=` or `!=` instead", graphiteFilterKey)
+		}
+		re, err := graphiteWildcardsToRegexp(string(value))
+		if err != nil {
+			return fmt.Errorf("cannot parse %s=%q: %w", graphiteFilterKey, value, err)
+		}
+		key = nil
+		value = []byte(re)
+		isRegexp = true
+	}
 	// Verify whether tag filter is empty.
 	if len(value) == 0 {
 		// Substitute an empty tag value with the negative match
@@ -79,6 +92,60 @@ func (tfs *TagFilters) Add(key, value []byte, isNegative, isRegexp bool) error {
 	return nil
 }
 
+// graphiteFilterKey is the pseudo-label for filtering metric names with Graphite wildcards.
+const graphiteFilterKey = "__graphite__"
+
+// graphiteWildcardsToRegexp converts Graphite wildcards from s into a regexp matching metric names.
+//
+// The following wildcards are supported: `*`, `{foo,bar}` and `[a-z]`.
+// `*` doesn't match dots, i.e. it matches a single path segment.
+func graphiteWildcardsToRegexp(s string) (string, error) {
+	var dst []byte
+	for len(s) > 0 {
+		switch s[0] {
+		case '*':
+			dst = append(dst, `[^.]*`...)
+			s = s[1:]
+		case '{':
+			n := strings.IndexByte(s, '}')
+			if n < 0 {
+				return "", fmt.Errorf("missing closing '}' in %q", s)
+			}
+			dst = append(dst, "(?:"...)
+			for i, alt := range strings.Split(s[1:n], ",") {
+				if i > 0 {
+					dst = append(dst, '|')
+				}
+				if strings.IndexByte(alt, '{') >= 0 {
+					return "", fmt.Errorf("nested '{' isn't supported in %q", s[:n+1])
+				}
+				re, err := graphiteWildcardsToRegexp(alt)
+				if err != nil {
+					return "", err
+				}
+				dst = append(dst, re...)
+			}
+			dst = append(dst, ')')
+			s = s[n+1:]
+		case '[':
+			n := strings.IndexByte(s, ']')
+			if n < 0 {
+				return "", fmt.Errorf("missing closing ']' in %q", s)
+			}
+			dst = append(dst, s[:n+1]...)
+			s = s[n+1:]
+		default:
+			n := strings.IndexAny(s, "*{[")
+			if n < 0 {
+				n = len(s)
+			}
+			dst = append(dst, regexp.QuoteMeta(s[:n])...)
+			s = s[n:]
+		}
+	}
+	return string(dst), nil
+}
+
 func (tfs *TagFilters) addTagFilter() *tagFilter {
 	if cap(tfs.tfs) > len(tfs.tfs) {
 		tfs.tfs = tfs.tfs[:len(tfs.tfs)+1]
@@ -120,6 +187,20 @@ func (tfs *TagFilters) cloneWithNegativeFilter(tfNegative *tagFilter) *TagFilter
 	return tfsNew
 }
 
+// getSingleMetricGroupFilter returns the tag filter for metric name if tfs contains only `{__name__="value"}` filter.
+//
+// Otherwise nil is returned.
+func (tfs *TagFilters) getSingleMetricGroupFilter() *tagFilter {
+	if len(tfs.tfs) != 1 {
+		return nil
+	}
+	tf := &tfs.tfs[0]
+	if len(tf.key) > 0 || tf.isNegative || tf.isRegexp || len(tf.value) == 0 {
+		return nil
+	}
+	return tf
+}
+
 // String returns human-readable value for tfs.
 func (tfs *TagFilters) String() string {
 	if len(tfs.tfs) == 0 {
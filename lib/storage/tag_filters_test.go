@@ -2,6 +2,7 @@ package storage
 
 import (
 	"reflect"
+	"regexp"
 	"testing"
 )
 
@@ -598,6 +599,31 @@ func TestTagFiltersString(t *testing.T) {
 	}
 }
 
+func TestTagFiltersGetSingleMetricGroupFilter(t *testing.T) {
+	f := func(filters [][]string, resultExpected bool) {
+		t.Helper()
+		tfs := NewTagFilters()
+		for _, filter := range filters {
+			key, value, op := filter[0], filter[1], filter[2]
+			if err := tfs.Add([]byte(key), []byte(value), op == "!=" || op == "!~", op == "=~" || op == "!~"); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		tf := tfs.getSingleMetricGroupFilter()
+		if result := tf != nil; result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %v; want %v", tfs, result, resultExpected)
+		}
+	}
+	f(nil, false)
+	f([][]string{{"", "metric_name", "="}}, true)
+	f([][]string{{"", "metric_name", "=~"}}, true)
+	f([][]string{{"", "metric_.+", "=~"}}, false)
+	f([][]string{{"", "metric_name", "!="}}, false)
+	f([][]string{{"", "", "="}}, false)
+	f([][]string{{"foo", "bar", "="}}, false)
+	f([][]string{{"", "metric_name", "="}, {"foo", "bar", "="}}, false)
+}
+
 func TestTagFiltersAddEmpty(t *testing.T) {
 	tfs := NewTagFilters()
 
@@ -666,3 +692,65 @@ func TestTagFiltersAddEmpty(t *testing.T) {
 		t.Fatalf("missing added filter")
 	}
 }
+
+func TestGraphiteWildcardsToRegexpSuccess(t *testing.T) {
+	f := func(s, reExpected string, matches, nonMatches []string) {
+		t.Helper()
+		re, err := graphiteWildcardsToRegexp(s)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", s, err)
+		}
+		if re != reExpected {
+			t.Fatalf("unexpected regexp for %q; got %q; want %q", s, re, reExpected)
+		}
+		r := regexp.MustCompile("^(?:" + re + ")$")
+		for _, m := range matches {
+			if !r.MatchString(m) {
+				t.Fatalf("%q must match %q", s, m)
+			}
+		}
+		for _, m := range nonMatches {
+			if r.MatchString(m) {
+				t.Fatalf("%q mustn't match %q", s, m)
+			}
+		}
+	}
+
+	f("", "", []string{""}, []string{"foo"})
+	f("foo.bar", `foo\.bar`, []string{"foo.bar"}, []string{"fooxbar", "foo.bar.baz"})
+	f("foo.*.bar", `foo\.[^.]*\.bar`, []string{"foo.x.bar", "foo..bar"}, []string{"foo.x.y.bar", "foo.bar"})
+	f("foo.*", `foo\.[^.]*`, []string{"foo.bar", "foo."}, []string{"foo.bar.baz", "foo"})
+	f("foo.{bar,baz*}.x", `foo\.(?:bar|baz[^.]*)\.x`, []string{"foo.bar.x", "foo.baz.x", "foo.bazz.x"}, []string{"foo.qux.x", "foo.bar"})
+	f("host[0-9].cpu", `host[0-9]\.cpu`, []string{"host1.cpu"}, []string{"hostx.cpu", "host10.cpu"})
+	f("a+b(c)", `a\+b\(c\)`, []string{"a+b(c)"}, []string{"aab(c)"})
+}
+
+func TestGraphiteWildcardsToRegexpFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, err := graphiteWildcardsToRegexp(s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+
+	f("foo.{bar")
+	f("foo.[a-z")
+	f("foo.{a,{b,c}}")
+}
+
+func TestTagFiltersAddGraphite(t *testing.T) {
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte(graphiteFilterKey), []byte("foo.*.bar"), true, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s := tfs.String()
+	sExpected := `{__name__!~"foo\\.[^.]*\\.bar"}`
+	if s != sExpected {
+		t.Fatalf("unexpected TagFilters.String(); got %q; want %q", s, sExpected)
+	}
+
+	// Regexp filters aren't supported for __graphite__
+	if err := tfs.Add([]byte(graphiteFilterKey), []byte("foo.*"), false, true); err == nil {
+		t.Fatalf("expecting non-nil error for regexp filter on %s", graphiteFilterKey)
+	}
+}
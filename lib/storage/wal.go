@@ -0,0 +1,396 @@
+package storage
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// SetWALEnabled enables write-ahead log for the recently added rows.
+//
+// Rows are written to the write-ahead log before being added to the storage,
+// so they are replayed on the next start after unclean shutdown.
+//
+// The function must be called before opening or creating any storage.
+func SetWALEnabled(enabled bool) {
+	walEnabled = enabled
+}
+
+var walEnabled bool
+
+// wal is a write-ahead log for rows added to the storage.
+//
+// It consists of segments with sequential numbers. New rows are appended to the last segment.
+// Older segments are removed after the rows from them are persisted to disk.
+type wal struct {
+	// Atomic counters must go at the top of the structure in order to properly align by 8 bytes on 32-bit archs.
+	writes       uint64
+	bytesWritten uint64
+	syncs        uint64
+	checkpoints  uint64
+	replayedRows uint64
+
+	path string
+
+	// rotationLock is held for reading while rows are written to the segment and added to the storage.
+	// It is held for writing while switching to a new segment, so all the rows from the previous segments
+	// are guaranteed to be added to the storage after the switch.
+	rotationLock sync.RWMutex
+
+	// mu protects the fields below.
+	mu   sync.Mutex
+	f    *os.File
+	seq  uint64
+	size int64
+	buf  []byte
+
+	// syncLock serializes fsync calls for the current segment.
+	// Concurrent writers wait on it, so a single fsync covers records from all of them.
+	syncLock sync.Mutex
+
+	// syncedSize is the size of the current segment already synced to disk. It is protected by syncLock.
+	syncedSize int64
+
+	// The fields below are used only by walCheckpointer.
+
+	// checkpointSeq is the last segment covered by the pending checkpoint. It is zero if there is no pending checkpoint.
+	checkpointSeq uint64
+
+	// checkpointDeadline is the time in seconds when the pending checkpoint has been started.
+	checkpointDeadline uint64
+}
+
+func (s *Storage) mustOpenWAL() {
+	walPath := s.path + "/wal"
+	if err := fs.MkdirAllIfNotExist(walPath); err != nil {
+		logger.Panicf("FATAL: cannot create directory for write-ahead log: %s", err)
+	}
+	seqs := mustReadWALSegmentSeqs(walPath)
+	w := &wal{
+		path: walPath,
+	}
+	if len(seqs) > 0 {
+		logger.Infof("replaying %d write-ahead log segments from %q...", len(seqs), walPath)
+		startTime := time.Now()
+		for _, seq := range seqs {
+			n, err := s.replayWALSegment(w.segmentPath(seq))
+			if err != nil {
+				logger.Panicf("FATAL: cannot replay write-ahead log segment: %s", err)
+			}
+			w.replayedRows += n
+		}
+		if err := s.tb.flushToDisk(); err != nil {
+			logger.Panicf("FATAL: cannot flush replayed rows to disk: %s", err)
+		}
+		s.idb().tb.FlushPendingItems()
+		w.mustRemoveSegmentsUpTo(seqs[len(seqs)-1])
+		w.seq = seqs[len(seqs)-1]
+		logger.Infof("replayed %d rows from write-ahead log at %q in %.3f seconds", w.replayedRows, walPath, time.Since(startTime).Seconds())
+	}
+	w.mustCreateSegment(w.seq + 1)
+	s.wal = w
+
+	s.startWALCheckpointer()
+}
+
+func mustReadWALSegmentSeqs(walPath string) []uint64 {
+	fis, err := ioutil.ReadDir(walPath)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read write-ahead log directory: %s", err)
+	}
+	var seqs []uint64
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		seq, err := strconv.ParseUint(fi.Name(), 16, 64)
+		if err != nil {
+			logger.Errorf("skipping unexpected file %q in write-ahead log directory %q", fi.Name(), walPath)
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+func (w *wal) segmentPath(seq uint64) string {
+	return fmt.Sprintf("%s/%016X", w.path, seq)
+}
+
+// mustCreateSegment closes the current segment and creates a new segment with the given seq.
+func (w *wal) mustCreateSegment(seq uint64) {
+	path := w.segmentPath(seq)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Panicf("FATAL: cannot create write-ahead log segment: %s", err)
+	}
+	fs.MustSyncPath(w.path)
+
+	w.mu.Lock()
+	prevF := w.f
+	w.f = f
+	w.seq = seq
+	w.size = 0
+	w.mu.Unlock()
+
+	// The segment is switched under rotationLock, so there are no concurrent writers waiting for fsync.
+	w.syncLock.Lock()
+	w.syncedSize = 0
+	w.syncLock.Unlock()
+
+	if prevF != nil {
+		fs.MustClose(prevF)
+	}
+}
+
+// mustRemoveSegmentsUpTo removes segments with sequence numbers up to maxSeq.
+func (w *wal) mustRemoveSegmentsUpTo(maxSeq uint64) {
+	for _, seq := range mustReadWALSegmentSeqs(w.path) {
+		if seq > maxSeq {
+			continue
+		}
+		path := w.segmentPath(seq)
+		if err := os.Remove(path); err != nil {
+			logger.Panicf("FATAL: cannot remove write-ahead log segment: %s", err)
+		}
+	}
+	fs.MustSyncPath(w.path)
+}
+
+// write appends mrs to the current segment and syncs it to disk.
+//
+// Concurrent calls are synced with a single fsync (group commit), so the fsync cost is shared among concurrent writers.
+// The caller must hold rotationLock for reading, so the segment cannot be switched until the record is synced.
+//
+// Each record has the following format:
+//
+//	<payloadLen:uint32> <crc32(payload):uint32> <precisionBits:uint8> <rowsCount:varuint64> <MetricRow>*rowsCount
+func (w *wal) write(mrs []MetricRow, precisionBits uint8) error {
+	w.mu.Lock()
+	b := w.buf[:0]
+	// Reserve space for payloadLen and checksum.
+	b = append(b, 0, 0, 0, 0, 0, 0, 0, 0)
+	b = append(b, precisionBits)
+	b = encoding.MarshalVarUint64(b, uint64(len(mrs)))
+	for i := range mrs {
+		b = mrs[i].Marshal(b)
+	}
+	payload := b[8:]
+	encoding.MarshalUint32(b[:0], uint32(len(payload)))
+	encoding.MarshalUint32(b[:4], crc32.ChecksumIEEE(payload))
+	w.buf = b
+
+	if _, err := w.f.Write(b); err != nil {
+		w.mustTruncate()
+		w.mu.Unlock()
+		return fmt.Errorf("cannot write %d rows to write-ahead log segment %q: %w", len(mrs), w.f.Name(), err)
+	}
+	w.size += int64(len(b))
+	recordEnd := w.size
+	w.mu.Unlock()
+
+	atomic.AddUint64(&w.writes, 1)
+	atomic.AddUint64(&w.bytesWritten, uint64(len(b)))
+	w.mustSync(recordEnd)
+	return nil
+}
+
+// mustSync makes sure the current segment is synced to disk up to the given size.
+func (w *wal) mustSync(size int64) {
+	w.syncLock.Lock()
+	defer w.syncLock.Unlock()
+
+	if w.syncedSize >= size {
+		// Fast path - the record has been synced by a concurrent writer.
+		return
+	}
+
+	// Sync all the records written so far, including records from writers waiting on syncLock.
+	w.mu.Lock()
+	f := w.f
+	size = w.size
+	w.mu.Unlock()
+
+	if err := f.Sync(); err != nil {
+		// It is unsafe to continue after failed fsync, since the OS may drop the unsynced data.
+		logger.Panicf("FATAL: cannot sync write-ahead log segment %q: %s", f.Name(), err)
+	}
+	w.syncedSize = size
+	atomic.AddUint64(&w.syncs, 1)
+}
+
+// mustTruncate removes the partially written record from the end of the current segment,
+// so the subsequent records could be replayed.
+func (w *wal) mustTruncate() {
+	if err := w.f.Truncate(w.size); err != nil {
+		logger.Panicf("FATAL: cannot truncate write-ahead log segment %q to %d bytes: %s", w.f.Name(), w.size, err)
+	}
+	if _, err := w.f.Seek(w.size, io.SeekStart); err != nil {
+		logger.Panicf("FATAL: cannot seek to %d bytes in write-ahead log segment %q: %s", w.size, w.f.Name(), err)
+	}
+}
+
+func (w *wal) mustClose() {
+	w.mu.Lock()
+	fs.MustClose(w.f)
+	w.f = nil
+	seq := w.seq
+	w.mu.Unlock()
+
+	// All the rows are already flushed to disk by Storage.MustClose, so the segments aren't needed anymore.
+	w.mustRemoveSegmentsUpTo(seq)
+}
+
+// replayWALSegment adds rows from the segment at path to s.
+//
+// It returns the number of replayed rows.
+func (s *Storage) replayWALSegment(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read %q: %w", path, err)
+	}
+	var mrs []MetricRow
+	var rows []rawRow
+	replayedRows := uint64(0)
+	for len(data) > 0 {
+		if len(data) < 8 {
+			logger.Warnf("skipping incomplete record header with size %d bytes at the end of write-ahead log segment %q", len(data), path)
+			break
+		}
+		payloadLen := encoding.UnmarshalUint32(data)
+		checksum := encoding.UnmarshalUint32(data[4:])
+		data = data[8:]
+		if uint64(len(data)) < uint64(payloadLen) {
+			logger.Warnf("skipping incomplete record with size %d bytes at the end of write-ahead log segment %q; want %d bytes", len(data), path, payloadLen)
+			break
+		}
+		payload := data[:payloadLen]
+		data = data[payloadLen:]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			// The record has been partially written before the crash.
+			// Subsequent records cannot be written to the segment after the crash, so stop here.
+			logger.Warnf("skipping corrupted record with size %d bytes in write-ahead log segment %q", len(payload), path)
+			break
+		}
+		if len(payload) < 1 {
+			return replayedRows, fmt.Errorf("missing precisionBits in the record from %q", path)
+		}
+		precisionBits := payload[0]
+		tail, rowsCount, err := encoding.UnmarshalVarUint64(payload[1:])
+		if err != nil {
+			return replayedRows, fmt.Errorf("cannot unmarshal rows count from %q: %w", path, err)
+		}
+		if uint64(cap(mrs)) < rowsCount {
+			mrs = make([]MetricRow, rowsCount)
+		}
+		mrs = mrs[:rowsCount]
+		for i := range mrs {
+			tail, err = mrs[i].Unmarshal(tail)
+			if err != nil {
+				return replayedRows, fmt.Errorf("cannot unmarshal row #%d from %q: %w", i, path, err)
+			}
+		}
+		if len(tail) > 0 {
+			return replayedRows, fmt.Errorf("unexpected non-empty tail left after unmarshaling %d rows from %q; len(tail)=%d", rowsCount, path, len(tail))
+		}
+		rows, err = s.add(rows[:0], mrs, precisionBits)
+		if err != nil {
+			return replayedRows, fmt.Errorf("cannot add rows from %q to the storage: %w", path, err)
+		}
+		replayedRows += rowsCount
+	}
+	return replayedRows, nil
+}
+
+// addWithWAL writes mrs to the write-ahead log and then adds them to s.
+func (s *Storage) addWithWAL(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]rawRow, error) {
+	w := s.wal
+	w.rotationLock.RLock()
+	defer w.rotationLock.RUnlock()
+
+	if err := w.write(mrs, precisionBits); err != nil {
+		return rows, err
+	}
+	return s.add(rows, mrs, precisionBits)
+}
+
+func (s *Storage) startWALCheckpointer() {
+	s.walCheckpointerWG.Add(1)
+	go func() {
+		s.walCheckpointer()
+		s.walCheckpointerWG.Done()
+	}()
+}
+
+func (s *Storage) walCheckpointer() {
+	ticker := time.NewTicker(inmemoryPartsFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mustCheckpointWAL()
+		}
+	}
+}
+
+// mustCheckpointWAL removes write-ahead log segments with rows already persisted to disk.
+//
+// The rows aren't flushed to disk here. Instead, the current segment is switched to a new one,
+// while the previous segments are removed on subsequent calls after inmemory parts containing their rows
+// are flushed to disk every inmemoryPartsFlushInterval. This prevents from creating small parts on every checkpoint.
+func (s *Storage) mustCheckpointWAL() {
+	w := s.wal
+	if w.checkpointSeq > 0 {
+		if s.tb.hasInmemoryPartsCreatedBefore(w.checkpointDeadline) {
+			// Rows from the previous segments aren't flushed to disk yet.
+			return
+		}
+		// Index entries for the rows are flushed to disk every second, so this flush is cheap.
+		s.idb().tb.FlushPendingItems()
+		w.mustRemoveSegmentsUpTo(w.checkpointSeq)
+		w.checkpointSeq = 0
+		atomic.AddUint64(&w.checkpoints, 1)
+	}
+
+	w.rotationLock.Lock()
+	w.mu.Lock()
+	prevSeq := w.seq
+	prevSize := w.size
+	w.mu.Unlock()
+	if prevSize == 0 {
+		// Nothing to checkpoint.
+		w.rotationLock.Unlock()
+		return
+	}
+	w.mustCreateSegment(prevSeq + 1)
+	w.rotationLock.Unlock()
+
+	// All the rows from the previous segments are already added to s.
+	// Convert them to inmemory parts, so they are flushed to disk by inmemory parts flusher.
+	s.tb.flushRawRows()
+	w.checkpointSeq = prevSeq
+	w.checkpointDeadline = fasttime.UnixTimestamp()
+}
+
+func (w *wal) updateMetrics(m *Metrics) {
+	m.WALWrites += atomic.LoadUint64(&w.writes)
+	m.WALBytesWritten += atomic.LoadUint64(&w.bytesWritten)
+	m.WALSyncs += atomic.LoadUint64(&w.syncs)
+	m.WALCheckpoints += atomic.LoadUint64(&w.checkpoints)
+	m.WALReplayedRows += atomic.LoadUint64(&w.replayedRows)
+}
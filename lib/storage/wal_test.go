@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageWALReplay(t *testing.T) {
+	path := "TestStorageWALReplay"
+	walPath := path + "/wal"
+	if err := fs.MkdirAllIfNotExist(walPath); err != nil {
+		t.Fatalf("cannot create %q: %s", walPath, err)
+	}
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+	walEnabledOrig := walEnabled
+	walEnabled = true
+	defer func() {
+		walEnabled = walEnabledOrig
+	}()
+
+	const seriesCount = 100
+	ts := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	var mn MetricName
+	for i := 0; i < seriesCount; i++ {
+		mn.MetricGroup = []byte("metric")
+		mn.Tags = []Tag{
+			{[]byte("instance"), []byte(fmt.Sprintf("instance_%d", i))},
+		}
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     ts,
+			Value:         float64(i),
+		})
+	}
+
+	// Simulate unclean shutdown: the segment contains two complete records and a partially written record.
+	w := &wal{
+		path: walPath,
+	}
+	w.mustCreateSegment(1)
+	if err := w.write(mrs[:seriesCount/2], defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot write rows to wal: %s", err)
+	}
+	if err := w.write(mrs[seriesCount/2:], defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot write rows to wal: %s", err)
+	}
+	if _, err := w.f.Write([]byte("foobar")); err != nil {
+		t.Fatalf("cannot write garbage to wal: %s", err)
+	}
+	fs.MustClose(w.f)
+
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.WALReplayedRows != seriesCount {
+		t.Fatalf("unexpected number of replayed rows; got %d; want %d", m.WALReplayedRows, seriesCount)
+	}
+	if seqs := mustReadWALSegmentSeqs(walPath); !reflect.DeepEqual(seqs, []uint64{2}) {
+		t.Fatalf("unexpected wal segments after replay; got %v; want [2]", seqs)
+	}
+	tr := TimeRange{
+		MinTimestamp: ts - 3600*1000,
+		MaxTimestamp: ts + 3600*1000,
+	}
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("metric"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	n, err := s.GetSeriesCountWithFilters([]*TagFilters{tfs}, tr, 1e6, noDeadline)
+	if err != nil {
+		t.Fatalf("cannot count series: %s", err)
+	}
+	if n != seriesCount {
+		t.Fatalf("unexpected number of series after replay; got %d; want %d", n, seriesCount)
+	}
+
+	// New rows are written to the current segment, which is replaced on checkpoint.
+	// The previous segments are removed only after the rows are flushed to disk.
+	if err := s.AddRows(mrs[:1], defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.mustCheckpointWAL()
+	m = Metrics{}
+	s.UpdateMetrics(&m)
+	if m.WALWrites != 1 {
+		t.Fatalf("unexpected number of wal writes; got %d; want 1", m.WALWrites)
+	}
+	if m.WALSyncs != 1 {
+		t.Fatalf("unexpected number of wal syncs; got %d; want 1", m.WALSyncs)
+	}
+	if m.WALCheckpoints != 0 {
+		t.Fatalf("unexpected number of wal checkpoints; got %d; want 0", m.WALCheckpoints)
+	}
+	if seqs := mustReadWALSegmentSeqs(walPath); !reflect.DeepEqual(seqs, []uint64{2, 3}) {
+		t.Fatalf("unexpected wal segments before flush; got %v; want [2 3]", seqs)
+	}
+	if err := s.tb.flushToDisk(); err != nil {
+		t.Fatalf("cannot flush rows to disk: %s", err)
+	}
+	s.mustCheckpointWAL()
+	m = Metrics{}
+	s.UpdateMetrics(&m)
+	if m.WALCheckpoints != 1 {
+		t.Fatalf("unexpected number of wal checkpoints; got %d; want 1", m.WALCheckpoints)
+	}
+	// The current segment is empty, so it isn't switched.
+	if seqs := mustReadWALSegmentSeqs(walPath); !reflect.DeepEqual(seqs, []uint64{3}) {
+		t.Fatalf("unexpected wal segments after checkpoint; got %v; want [3]", seqs)
+	}
+
+	// Clean shutdown removes all the segments.
+	s.MustClose()
+	if seqs := mustReadWALSegmentSeqs(walPath); len(seqs) != 0 {
+		t.Fatalf("unexpected wal segments after close; got %v", seqs)
+	}
+}
+
+func TestWALConcurrentWrites(t *testing.T) {
+	path := "TestWALConcurrentWrites"
+	if err := fs.MkdirAllIfNotExist(path); err != nil {
+		t.Fatalf("cannot create %q: %s", path, err)
+	}
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	w := &wal{
+		path: path,
+	}
+	w.mustCreateSegment(1)
+	mrs := []MetricRow{{
+		MetricNameRaw: []byte("foobar"),
+		Timestamp:     123,
+		Value:         456,
+	}}
+
+	const workers = 8
+	const writesPerWorker = 100
+	errCh := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := 0; j < writesPerWorker; j++ {
+				if err := w.write(mrs, defaultPrecisionBits); err != nil {
+					errCh <- err
+					return
+				}
+			}
+			errCh <- nil
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		if err := <-errCh; err != nil {
+			t.Fatalf("cannot write rows to wal: %s", err)
+		}
+	}
+	fs.MustClose(w.f)
+
+	var m Metrics
+	w.updateMetrics(&m)
+	if m.WALWrites != workers*writesPerWorker {
+		t.Fatalf("unexpected number of wal writes; got %d; want %d", m.WALWrites, workers*writesPerWorker)
+	}
+	if m.WALSyncs == 0 || m.WALSyncs > m.WALWrites {
+		t.Fatalf("unexpected number of wal syncs; got %d; want from 1 to %d", m.WALSyncs, m.WALWrites)
+	}
+	if w.syncedSize != w.size {
+		t.Fatalf("unexpected synced size; got %d; want %d", w.syncedSize, w.size)
+	}
+}
@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	maxQueueSize = flag.Int("tracing.maxQueueSize", 10000, "The maximum number of finished spans waiting for export to -tracing.otlpEndpoint. "+
+		"Spans are dropped when the queue is full")
+	flushInterval = flag.Duration("tracing.flushInterval", 5*time.Second, "The interval for exporting finished spans to -tracing.otlpEndpoint")
+)
+
+// maxBatchSize is the maximum number of spans to send in a single request to -tracing.otlpEndpoint.
+const maxBatchSize = 512
+
+var (
+	exporterOnce sync.Once
+	spansCh      chan *Span
+)
+
+func exportSpan(s *Span) {
+	exporterOnce.Do(startExporter)
+	select {
+	case spansCh <- s:
+	default:
+		spansDropped.Inc()
+	}
+}
+
+func startExporter() {
+	spansCh = make(chan *Span, *maxQueueSize)
+	name := *serviceName
+	if len(name) == 0 {
+		name = filepath.Base(os.Args[0])
+	}
+	e := &exporter{
+		endpoint:    *otlpEndpoint,
+		serviceName: name,
+		client: &http.Client{
+			Timeout: time.Minute,
+		},
+	}
+	go e.run()
+}
+
+type exporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(*flushInterval)
+	defer ticker.Stop()
+	var spans []*Span
+	for {
+		select {
+		case s := <-spansCh:
+			spans = append(spans, s)
+			if len(spans) < maxBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(spans) == 0 {
+				continue
+			}
+		}
+		if err := e.send(spans); err != nil {
+			exportErrors.Inc()
+			logger.Errorf("cannot export %d spans to -tracing.otlpEndpoint=%q: %s", len(spans), e.endpoint, err)
+		} else {
+			spansExported.Add(len(spans))
+		}
+		spans = spans[:0]
+	}
+}
+
+func (e *exporter) send(spans []*Span) error {
+	data := marshalSpans(e.serviceName, spans)
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response code %d; response body: %q", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// marshalSpans marshals spans into OTLP JSON.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#json-protobuf-encoding
+func marshalSpans(serviceName string, spans []*Span) []byte {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		otlpSpans = append(otlpSpans, s.toOTLP())
+	}
+	req := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{newOTLPAttribute("service.name", serviceName)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{
+					Name: "github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing",
+				},
+				Spans: otlpSpans,
+			}},
+		}},
+	}
+	data, err := json.Marshal(&req)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal spans: %s", err)
+	}
+	return data
+}
+
+func (s *Span) toOTLP() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              int(s.kind),
+		StartTimeUnixNano: strconv.FormatInt(s.startTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.endTime.UnixNano(), 10),
+	}
+	if s.parentSpanID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parentSpanID[:])
+	}
+	for _, a := range s.attributes {
+		span.Attributes = append(span.Attributes, newOTLPAttribute(a.key, a.value))
+	}
+	if s.isError {
+		span.Status = &otlpStatus{
+			Code:    otlpStatusCodeError,
+			Message: s.errMsg,
+		}
+	}
+	return span
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func newOTLPAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{
+		Key: key,
+		Value: otlpAnyValue{
+			StringValue: value,
+		},
+	}
+}
+
+// otlpStatusCodeError is STATUS_CODE_ERROR from OTLP.
+const otlpStatusCodeError = 2
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	spansExported = metrics.NewCounter(`vm_tracing_spans_exported_total`)
+	spansDropped  = metrics.NewCounter(`vm_tracing_spans_dropped_total`)
+	exportErrors  = metrics.NewCounter(`vm_tracing_export_errors_total`)
+)
@@ -0,0 +1,236 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	otlpEndpoint = flag.String("tracing.otlpEndpoint", "", "OTLP/HTTP endpoint for exporting OpenTelemetry traces for incoming requests, "+
+		"e.g. http://otel-collector:4318/v1/traces . Tracing is disabled if empty")
+	sampleRatio = flag.Float64("tracing.sampleRatio", 1, "The ratio of incoming requests without 'traceparent' header to trace. "+
+		"Requests with 'traceparent' header are traced according to the sampled flag from the header. Used only if -tracing.otlpEndpoint is set")
+	serviceName = flag.String("tracing.serviceName", "", "Service name for exported traces. The binary name is used if empty. "+
+		"Used only if -tracing.otlpEndpoint is set")
+)
+
+// SpanKind is the kind of span.
+//
+// See https://opentelemetry.io/docs/reference/specification/trace/api/#spankind
+type SpanKind int
+
+// Span kinds. Values match OTLP SpanKind enum.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+)
+
+// Span is a single traced operation.
+//
+// All the methods are safe to call on nil *Span, which is returned when tracing is disabled or the trace isn't sampled.
+// This allows avoiding nil checks at call sites.
+type Span struct {
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte
+
+	name      string
+	kind      SpanKind
+	startTime time.Time
+
+	mu         sync.Mutex
+	endTime    time.Time
+	attributes []attribute
+	errMsg     string
+	isError    bool
+}
+
+type attribute struct {
+	key   string
+	value string
+}
+
+// IsEnabled returns true if tracing is enabled via -tracing.otlpEndpoint.
+func IsEnabled() bool {
+	return len(*otlpEndpoint) > 0
+}
+
+// StartSpanFromRequest starts server span for r.
+//
+// The span becomes a child of the span from 'traceparent' request header if the header is set.
+// nil is returned if tracing is disabled or the request isn't sampled.
+func StartSpanFromRequest(r *http.Request, name string) *Span {
+	if !IsEnabled() {
+		return nil
+	}
+	s := &Span{
+		name:      name,
+		kind:      SpanKindServer,
+		startTime: time.Now(),
+	}
+	if traceID, parentSpanID, sampled, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		if !sampled {
+			return nil
+		}
+		s.traceID = traceID
+		s.parentSpanID = parentSpanID
+	} else {
+		if !shouldSample() {
+			return nil
+		}
+		mustReadRandom(s.traceID[:])
+	}
+	mustReadRandom(s.spanID[:])
+	s.SetAttribute("http.method", r.Method)
+	s.SetAttribute("http.target", r.URL.Path)
+	s.SetAttribute("net.peer.addr", r.RemoteAddr)
+	return s
+}
+
+// StartChildSpan starts internal span with the given name, which becomes a child for the span stored in ctx.
+//
+// nil is returned if ctx has no span.
+func StartChildSpan(ctx context.Context, name string) *Span {
+	return SpanFromContext(ctx).StartChild(name)
+}
+
+// StartChild starts internal span with the given name, which becomes a child for s.
+//
+// nil is returned if s is nil.
+func (s *Span) StartChild(name string) *Span {
+	parent := s
+	if parent == nil {
+		return nil
+	}
+	s = &Span{
+		traceID:      parent.traceID,
+		parentSpanID: parent.spanID,
+		name:         name,
+		kind:         SpanKindInternal,
+		startTime:    time.Now(),
+	}
+	mustReadRandom(s.spanID[:])
+	return s
+}
+
+// SetAttribute sets the attribute with the given key and value on s.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attributes = append(s.attributes, attribute{
+		key:   key,
+		value: value,
+	})
+	s.mu.Unlock()
+}
+
+// SetError marks s as failed with the given err.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.isError = true
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes s and queues it for export to -tracing.otlpEndpoint.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.endTime = time.Now()
+	s.mu.Unlock()
+	exportSpan(s)
+}
+
+// Traceparent returns W3C traceparent header value for s.
+//
+// See https://www.w3.org/TR/trace-context/#traceparent-header
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns ctx with the given s.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// SpanFromContext returns span from ctx.
+//
+// nil is returned if ctx doesn't contain span.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// parseTraceparent parses W3C traceparent header value.
+//
+// See https://www.w3.org/TR/trace-context/#traceparent-header
+func parseTraceparent(s string) (traceID [16]byte, parentSpanID [8]byte, sampled, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return traceID, parentSpanID, false, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return traceID, parentSpanID, false, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentSpanID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, parentSpanID, false, false
+	}
+	if _, err := hex.Decode(parentSpanID[:], []byte(parts[2])); err != nil || parentSpanID == [8]byte{} {
+		return traceID, parentSpanID, false, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return traceID, parentSpanID, false, false
+	}
+	return traceID, parentSpanID, flags[0]&1 != 0, true
+}
+
+func shouldSample() bool {
+	ratio := *sampleRatio
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	var b [8]byte
+	mustReadRandom(b[:])
+	n := uint64(0)
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return float64(n) < ratio*math.MaxUint64
+}
+
+func mustReadRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		logger.Panicf("FATAL: cannot read random data: %s", err)
+	}
+}
@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparentSuccess(t *testing.T) {
+	f := func(s, traceIDExpected, parentSpanIDExpected string, sampledExpected bool) {
+		t.Helper()
+		traceID, parentSpanID, sampled, ok := parseTraceparent(s)
+		if !ok {
+			t.Fatalf("cannot parse %q", s)
+		}
+		if id := hex.EncodeToString(traceID[:]); id != traceIDExpected {
+			t.Fatalf("unexpected traceID; got %q; want %q", id, traceIDExpected)
+		}
+		if id := hex.EncodeToString(parentSpanID[:]); id != parentSpanIDExpected {
+			t.Fatalf("unexpected parentSpanID; got %q; want %q", id, parentSpanIDExpected)
+		}
+		if sampled != sampledExpected {
+			t.Fatalf("unexpected sampled; got %v; want %v", sampled, sampledExpected)
+		}
+	}
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false)
+
+	// Future versions may contain additional fields
+	f("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03-foo", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+}
+
+func TestParseTraceparentFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, _, _, ok := parseTraceparent(s); ok {
+			t.Fatalf("expecting failure when parsing %q", s)
+		}
+	}
+	f("")
+	f("foobar")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo")
+	f("ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	f("00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01")
+	f("00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x")
+}
+
+func TestSpanNil(t *testing.T) {
+	// All the methods must work on nil span
+	var s *Span
+	s.SetAttribute("foo", "bar")
+	s.SetError(fmt.Errorf("error"))
+	s.End()
+	if tp := s.Traceparent(); tp != "" {
+		t.Fatalf("unexpected traceparent for nil span: %q", tp)
+	}
+	ctx := ContextWithSpan(context.Background(), s)
+	if SpanFromContext(ctx) != nil {
+		t.Fatalf("expecting nil span in context")
+	}
+	if StartChildSpan(ctx, "child") != nil {
+		t.Fatalf("expecting nil child span")
+	}
+	if s.StartChild("child") != nil {
+		t.Fatalf("expecting nil child span for nil parent")
+	}
+}
+
+func TestMarshalSpans(t *testing.T) {
+	parent := &Span{
+		name:      "GET /api/v1/query",
+		kind:      SpanKindServer,
+		startTime: time.Unix(1, 0),
+		endTime:   time.Unix(2, 0),
+	}
+	copy(parent.traceID[:], "0123456789abcdef")
+	copy(parent.spanID[:], "01234567")
+	parent.SetAttribute("http.method", "GET")
+
+	ctx := ContextWithSpan(context.Background(), parent)
+	child := StartChildSpan(ctx, "promql.Exec")
+	child.SetError(fmt.Errorf("cannot execute query"))
+	child.endTime = child.startTime
+
+	data := marshalSpans("test", []*Span{parent, child})
+	var req otlpRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatalf("cannot unmarshal %q: %s", data, err)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request structure: %s", data)
+	}
+	if a := req.ResourceSpans[0].Resource.Attributes; len(a) != 1 || a[0].Key != "service.name" || a[0].Value.StringValue != "test" {
+		t.Fatalf("unexpected resource attributes: %s", data)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("unexpected number of spans; got %d; want 2", len(spans))
+	}
+	p := spans[0]
+	if p.TraceID != hex.EncodeToString([]byte("0123456789abcdef")) || p.SpanID != hex.EncodeToString([]byte("01234567")) || p.ParentSpanID != "" {
+		t.Fatalf("unexpected ids for parent span: %+v", p)
+	}
+	if p.StartTimeUnixNano != "1000000000" || p.EndTimeUnixNano != "2000000000" || p.Kind != int(SpanKindServer) || p.Status != nil {
+		t.Fatalf("unexpected parent span: %+v", p)
+	}
+	if len(p.Attributes) != 1 || p.Attributes[0].Key != "http.method" || p.Attributes[0].Value.StringValue != "GET" {
+		t.Fatalf("unexpected parent span attributes: %+v", p.Attributes)
+	}
+	c := spans[1]
+	if c.TraceID != p.TraceID || c.ParentSpanID != p.SpanID || c.SpanID == p.SpanID || c.Kind != int(SpanKindInternal) {
+		t.Fatalf("unexpected child span: %+v", c)
+	}
+	if c.Status == nil || c.Status.Code != otlpStatusCodeError || c.Status.Message != "cannot execute query" {
+		t.Fatalf("unexpected child span status: %+v", c.Status)
+	}
+}
@@ -738,20 +738,36 @@ func (b *bucket32) appendTo(dst []uint64) []uint64 {
 const (
 	bitsPerBucket  = 1 << 16
 	wordsPerBucket = bitsPerBucket / 64
+
+	// maxArrLen is the maximum number of items in bucket16.arr.
+	//
+	// Sorted array with more items occupies more memory than bits.
+	maxArrLen = wordsPerBucket * 4
 )
 
+// bucket16 contains items with identical higher 48 bits.
+//
+// Items are stored in roaring bitmap-like containers, which are selected automatically depending on items' density:
+//
+//   - smallPool contains up to len(smallPool) unsorted items;
+//   - arr contains up to maxArrLen sorted items;
+//   - bits contains dense items.
 type bucket16 struct {
 	bits         *[wordsPerBucket]uint64
+	arr          []uint16
 	smallPoolLen int
-	smallPool    [56]uint16
+	smallPool    [44]uint16
 }
 
 func (b *bucket16) isZero() bool {
-	return b.bits == nil && b.smallPoolLen == 0
+	return b.bits == nil && len(b.arr) == 0 && b.smallPoolLen == 0
 }
 
 func (b *bucket16) getLen() int {
 	if b.bits == nil {
+		if b.arr != nil {
+			return len(b.arr)
+		}
 		return b.smallPoolLen
 	}
 	n := 0
@@ -776,6 +792,11 @@ func (b *bucket16) union(a *bucket16) {
 		}
 		return
 	}
+	if a.arr != nil && b.arr != nil {
+		// Fast path - merge sorted arrays.
+		b.unionArr(a.arr)
+		return
+	}
 
 	// Slow path
 	xbuf := partBufPool.Get().(*[]uint64)
@@ -789,6 +810,32 @@ func (b *bucket16) union(a *bucket16) {
 	partBufPool.Put(xbuf)
 }
 
+func (b *bucket16) unionArr(a []uint16) {
+	ba := b.arr
+	arr := make([]uint16, 0, len(ba)+len(a))
+	i, j := 0, 0
+	for i < len(ba) && j < len(a) {
+		switch {
+		case ba[i] < a[j]:
+			arr = append(arr, ba[i])
+			i++
+		case ba[i] > a[j]:
+			arr = append(arr, a[j])
+			j++
+		default:
+			arr = append(arr, ba[i])
+			i++
+			j++
+		}
+	}
+	arr = append(arr, ba[i:]...)
+	arr = append(arr, a[j:]...)
+	b.arr = arr
+	if len(arr) > maxArrLen {
+		b.convertToBits()
+	}
+}
+
 func (b *bucket16) intersect(a *bucket16) {
 	if a.bits != nil && b.bits != nil {
 		// Fast path - use bitwise ops
@@ -800,6 +847,57 @@ func (b *bucket16) intersect(a *bucket16) {
 			bx &= ax
 			bb[i] = bx
 		}
+		// The intersection may become sparse, so convert it to arr in order to save memory.
+		b.compactBits()
+		return
+	}
+	if b.arr != nil && a.arr != nil {
+		// Fast path - intersect sorted arrays in place.
+		ba := b.arr
+		arr := ba[:0]
+		i, j := 0, 0
+		for i < len(ba) && j < len(a.arr) {
+			switch {
+			case ba[i] < a.arr[j]:
+				i++
+			case ba[i] > a.arr[j]:
+				j++
+			default:
+				arr = append(arr, ba[i])
+				i++
+				j++
+			}
+		}
+		b.arr = arr
+		return
+	}
+	if b.arr != nil {
+		// Fast path - filter b.arr items in place.
+		arr := b.arr[:0]
+		for _, x := range b.arr {
+			if a.has(x) {
+				arr = append(arr, x)
+			}
+		}
+		b.arr = arr
+		return
+	}
+	if b.bits != nil {
+		// Fast path - a is sparse, so the intersection cannot contain more than a.getLen() items.
+		// Store it in arr.
+		xbuf := partBufPool.Get().(*[]uint64)
+		buf := a.appendTo((*xbuf)[:0], 0, 0)
+		arr := make([]uint16, 0, len(buf))
+		for _, x := range buf {
+			x16 := uint16(x)
+			if b.has(x16) {
+				arr = append(arr, x16)
+			}
+		}
+		*xbuf = buf
+		partBufPool.Put(xbuf)
+		b.bits = nil
+		b.arr = arr
 		return
 	}
 
@@ -818,22 +916,35 @@ func (b *bucket16) intersect(a *bucket16) {
 }
 
 func (b *bucket16) sizeBytes() uint64 {
-	return uint64(unsafe.Sizeof(*b)) + uint64(unsafe.Sizeof(*b.bits))
+	n := uint64(unsafe.Sizeof(*b))
+	if b.bits != nil {
+		n += uint64(unsafe.Sizeof(*b.bits))
+	}
+	n += 2 * uint64(cap(b.arr))
+	return n
 }
 
 func (b *bucket16) copyTo(dst *bucket16) {
-	// Do not reuse dst.bits, since it may be used in other places.
+	// Do not reuse dst.bits and dst.arr, since they may be used in other places.
 	dst.bits = nil
 	if b.bits != nil {
 		bits := *b.bits
 		dst.bits = &bits
 	}
+	dst.arr = nil
+	if b.arr != nil {
+		dst.arr = make([]uint16, len(b.arr))
+		copy(dst.arr, b.arr)
+	}
 	dst.smallPoolLen = b.smallPoolLen
 	dst.smallPool = b.smallPool
 }
 
 func (b *bucket16) add(x uint16) bool {
 	if b.bits == nil {
+		if b.arr != nil {
+			return b.addToArr(x)
+		}
 		return b.addToSmallPool(x)
 	}
 	wordNum, bitMask := getWordNumBitMask(x)
@@ -844,9 +955,20 @@ func (b *bucket16) add(x uint16) bool {
 }
 
 func (b *bucket16) addMulti(a []uint64) int {
+	if b.bits == nil && b.getLen()+len(a) > maxArrLen {
+		// Items in a are likely unique, so they won't fit arr.
+		b.convertToBits()
+	}
 	count := 0
 	if b.bits == nil {
 		// Slow path
+		if n := b.getLen() + len(a); n > len(b.smallPool) && cap(b.arr) < n {
+			// Pre-allocate memory for the added items.
+			if m := 2 * cap(b.arr); m > n {
+				n = m
+			}
+			b.convertToArr(n)
+		}
 		for _, x := range a {
 			if b.add(uint16(x)) {
 				count++
@@ -875,18 +997,98 @@ func (b *bucket16) addToSmallPool(x uint16) bool {
 		b.smallPoolLen++
 		return true
 	}
+	// The smallPool is full. Move its items to arr.
+	b.convertToArr(2 * len(b.smallPool))
+	return b.addToArr(x)
+}
+
+// convertToArr moves items from smallPool to arr with the given capacity.
+//
+// It re-allocates arr with the given capacity if items are already stored in arr.
+func (b *bucket16) convertToArr(capacity int) {
+	if b.arr != nil {
+		arr := make([]uint16, len(b.arr), capacity)
+		copy(arr, b.arr)
+		b.arr = arr
+		return
+	}
+	arr := make([]uint16, b.smallPoolLen, capacity)
+	copy(arr, b.smallPool[:b.smallPoolLen])
+	sort.Sort(uint16Sorter(arr))
 	b.smallPoolLen = 0
+	b.arr = arr
+}
+
+func (b *bucket16) addToArr(x uint16) bool {
+	arr := b.arr
+	n := len(arr)
+	if n > 0 && arr[n-1] < x {
+		// Fast path - items are usually added in ascending order.
+		if n >= maxArrLen {
+			b.convertToBits()
+			return b.add(x)
+		}
+		b.arr = append(arr, x)
+		return true
+	}
+	n = binarySearch16(arr, x)
+	if n < len(arr) && arr[n] == x {
+		return false
+	}
+	if len(arr) >= maxArrLen {
+		b.convertToBits()
+		return b.add(x)
+	}
+	arr = append(arr, 0)
+	copy(arr[n+1:], arr[n:])
+	arr[n] = x
+	b.arr = arr
+	return true
+}
+
+// convertToBits moves items from smallPool or arr to bits.
+func (b *bucket16) convertToBits() {
+	if b.bits != nil {
+		return
+	}
 	var bits [wordsPerBucket]uint64
+	items := b.arr
+	if items == nil {
+		items = b.smallPool[:b.smallPoolLen]
+	}
+	for _, x := range items {
+		wordNum, bitMask := getWordNumBitMask(x)
+		bits[wordNum] |= bitMask
+	}
 	b.bits = &bits
-	for _, v := range b.smallPool[:] {
-		b.add(v)
+	b.arr = nil
+	b.smallPoolLen = 0
+}
+
+// compactBits moves items from bits to arr if they occupy less memory there.
+func (b *bucket16) compactBits() {
+	n := b.getLen()
+	if n > maxArrLen {
+		return
 	}
-	b.add(x)
-	return true
+	xbuf := partBufPool.Get().(*[]uint64)
+	buf := b.appendTo((*xbuf)[:0], 0, 0)
+	arr := make([]uint16, len(buf))
+	for i, x := range buf {
+		arr[i] = uint16(x)
+	}
+	*xbuf = buf
+	partBufPool.Put(xbuf)
+	b.bits = nil
+	b.arr = arr
 }
 
 func (b *bucket16) has(x uint16) bool {
 	if b.bits == nil {
+		if b.arr != nil {
+			n := binarySearch16(b.arr, x)
+			return n < len(b.arr) && b.arr[n] == x
+		}
 		return b.hasInSmallPool(x)
 	}
 	wordNum, bitMask := getWordNumBitMask(x)
@@ -904,6 +1106,9 @@ func (b *bucket16) hasInSmallPool(x uint16) bool {
 
 func (b *bucket16) del(x uint16) bool {
 	if b.bits == nil {
+		if b.arr != nil {
+			return b.delFromArr(x)
+		}
 		return b.delFromSmallPool(x)
 	}
 	wordNum, bitMask := getWordNumBitMask(x)
@@ -913,6 +1118,17 @@ func (b *bucket16) del(x uint16) bool {
 	return ok
 }
 
+func (b *bucket16) delFromArr(x uint16) bool {
+	arr := b.arr
+	n := binarySearch16(arr, x)
+	if n >= len(arr) || arr[n] != x {
+		return false
+	}
+	copy(arr[n:], arr[n+1:])
+	b.arr = arr[:len(arr)-1]
+	return true
+}
+
 func (b *bucket16) delFromSmallPool(x uint16) bool {
 	for i, v := range b.smallPool[:b.smallPoolLen] {
 		if v == x {
@@ -927,6 +1143,13 @@ func (b *bucket16) delFromSmallPool(x uint16) bool {
 func (b *bucket16) appendTo(dst []uint64, hi uint32, hi16 uint16) []uint64 {
 	hi64 := uint64(hi)<<32 | uint64(hi16)<<16
 	if b.bits == nil {
+		if b.arr != nil {
+			for _, v := range b.arr {
+				x := hi64 | uint64(v)
+				dst = append(dst, x)
+			}
+			return dst
+		}
 		// Use uint16Sorter instead of sort.Slice here in order to reduce memory allocations.
 		a := uint16SorterPool.Get().(*uint16Sorter)
 		*a = uint16Sorter(b.smallPool[:b.smallPoolLen])
@@ -757,3 +757,111 @@ func TestAddMulti(t *testing.T) {
 	}
 	f(a)
 }
+
+func TestSetContainers(t *testing.T) {
+	for _, itemsCount := range []int{10, 44, 45, 100, maxArrLen, maxArrLen + 1, 2e4} {
+		for _, step := range []int{1, 3, 13} {
+			t.Run(fmt.Sprintf("items_%d_step_%d", itemsCount, step), func(t *testing.T) {
+				testSetContainers(t, itemsCount, step)
+			})
+		}
+	}
+}
+
+func testSetContainers(t *testing.T, itemsCount, step int) {
+	// Put all the items into a single bucket16 in random order.
+	const offset = 1<<32 + 5<<16
+	var s Set
+	m := make(map[uint64]bool)
+	for _, i := range rand.Perm(itemsCount) {
+		x := offset + uint64((i*step)%bitsPerBucket)
+		s.Add(x)
+		m[x] = true
+	}
+	if n := s.Len(); n != len(m) {
+		t.Fatalf("unexpected Len(); got %d; want %d", n, len(m))
+	}
+	if len(m) <= maxArrLen/2 {
+		// Sparse items must occupy less memory than bits.
+		if n := s.SizeBytes(); n >= wordsPerBucket*8 {
+			t.Fatalf("too big SizeBytes() for %d sparse items; got %d; want less than %d", len(m), n, wordsPerBucket*8)
+		}
+	}
+	for x := range m {
+		if !s.Has(x) {
+			t.Fatalf("missing item %d", x)
+		}
+		if s.Has(x + bitsPerBucket) {
+			t.Fatalf("unexpected item found %d", x+bitsPerBucket)
+		}
+	}
+	a := s.AppendTo(nil)
+	if len(a) != len(m) {
+		t.Fatalf("unexpected len for AppendTo result; got %d; want %d", len(a), len(m))
+	}
+	if !sort.SliceIsSorted(a, func(i, j int) bool { return a[i] < a[j] }) {
+		t.Fatalf("unsorted result returned from AppendTo: %d", a)
+	}
+
+	// Verify intersection and union with sets containing items in various containers.
+	for _, otherCount := range []int{10, 100, maxArrLen + 100} {
+		var other Set
+		mOther := make(map[uint64]bool)
+		for i := 0; i < otherCount; i++ {
+			x := offset + uint64((i*7)%bitsPerBucket)
+			other.Add(x)
+			mOther[x] = true
+		}
+		var mExpected []uint64
+		for x := range m {
+			if mOther[x] {
+				mExpected = append(mExpected, x)
+			}
+		}
+		sort.Slice(mExpected, func(i, j int) bool { return mExpected[i] < mExpected[j] })
+		sCopy := s.Clone()
+		sCopy.Intersect(&other)
+		if n := sCopy.Len(); n != len(mExpected) {
+			t.Fatalf("unexpected Len() after Intersect with %d items; got %d; want %d", otherCount, n, len(mExpected))
+		}
+		if a := sCopy.AppendTo(nil); len(mExpected) > 0 && !reflect.DeepEqual(a, mExpected) {
+			t.Fatalf("unexpected items after Intersect with %d items;\ngot\n%d\nwant\n%d", otherCount, a, mExpected)
+		}
+
+		sCopy = s.Clone()
+		sCopy.Union(&other)
+		mUnion := make(map[uint64]bool)
+		for x := range m {
+			mUnion[x] = true
+		}
+		for x := range mOther {
+			mUnion[x] = true
+		}
+		if n := sCopy.Len(); n != len(mUnion) {
+			t.Fatalf("unexpected Len() after Union with %d items; got %d; want %d", otherCount, n, len(mUnion))
+		}
+		for x := range mUnion {
+			if !sCopy.Has(x) {
+				t.Fatalf("missing item %d after Union with %d items", x, otherCount)
+			}
+		}
+	}
+
+	// Verify Del
+	for _, x := range a[:len(a)/2] {
+		s.Del(x)
+	}
+	if n := s.Len(); n != len(a)-len(a)/2 {
+		t.Fatalf("unexpected Len() after Del; got %d; want %d", n, len(a)-len(a)/2)
+	}
+	for _, x := range a[:len(a)/2] {
+		if s.Has(x) {
+			t.Fatalf("unexpected item found after Del: %d", x)
+		}
+	}
+	for _, x := range a[len(a)/2:] {
+		if !s.Has(x) {
+			t.Fatalf("missing item after Del: %d", x)
+		}
+	}
+}
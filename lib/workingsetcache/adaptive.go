@@ -0,0 +1,178 @@
+package workingsetcache
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var adaptiveResizeInterval = flag.Duration("cache.adaptiveResizeInterval", 0, "Interval for adaptive resizing of internal caches. "+
+	"If set to positive value, then caches with low hit rates are periodically shrunk in favor of full caches with high hit rates, "+
+	"while the summary size of caches remains unchanged. Adaptive resizing is disabled by default")
+
+const (
+	// minRequestsForResize is the minimum number of requests during the resize interval
+	// for taking into account cache hit rate.
+	minRequestsForResize = 1000
+
+	// maxGrowFactor limits the growth of cache size comparing to the original size.
+	maxGrowFactor = 4
+
+	// maxShrinkFactor limits the shrinking of cache size comparing to the original size.
+	maxShrinkFactor = 4
+)
+
+var (
+	cachesLock sync.Mutex
+	caches     = make(map[*Cache]struct{})
+
+	adaptiveResizerOnce sync.Once
+)
+
+// registerCache registers c for adaptive resizing if it is enabled via -cache.adaptiveResizeInterval.
+func registerCache(c *Cache) {
+	if *adaptiveResizeInterval <= 0 {
+		return
+	}
+	cachesLock.Lock()
+	caches[c] = struct{}{}
+	cachesLock.Unlock()
+
+	adaptiveResizerOnce.Do(func() {
+		go adaptiveResizer(*adaptiveResizeInterval)
+	})
+}
+
+func unregisterCache(c *Cache) {
+	cachesLock.Lock()
+	delete(caches, c)
+	cachesLock.Unlock()
+}
+
+func adaptiveResizer(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		resizeCaches()
+	}
+}
+
+func resizeCaches() {
+	cachesLock.Lock()
+	defer cachesLock.Unlock()
+
+	cs := make([]*Cache, 0, len(caches))
+	us := make([]cacheUsage, 0, len(caches))
+	for c := range caches {
+		var fcs fastcache.Stats
+		c.UpdateStats(&fcs)
+		u := cacheUsage{
+			maxBytes:     c.MaxBytesSize() / 2,
+			origMaxBytes: c.origMaxBytes,
+			bytesSize:    fcs.BytesSize,
+		}
+		if fcs.GetCalls >= c.prevRequests && fcs.Misses >= c.prevMisses {
+			u.requests = fcs.GetCalls - c.prevRequests
+			u.misses = fcs.Misses - c.prevMisses
+		}
+		us = append(us, u)
+		cs = append(cs, c)
+		c.prevRequests = fcs.GetCalls
+		c.prevMisses = fcs.Misses
+	}
+	sizes := getAdaptiveSizes(us)
+	for i, c := range cs {
+		if sizes[i] == us[i].maxBytes {
+			continue
+		}
+		logger.Infof("adaptively resizing cache from %d bytes to %d bytes; hit rate during the last %s: %.3f",
+			2*us[i].maxBytes, 2*sizes[i], *adaptiveResizeInterval, us[i].hitRate())
+		c.resize(sizes[i])
+		adaptiveResizes.Inc()
+	}
+}
+
+var adaptiveResizes = metrics.NewCounter(`vm_cache_adaptive_resizes_total`)
+
+// cacheUsage contains cache usage stats for the last resize interval.
+type cacheUsage struct {
+	maxBytes     uint64
+	origMaxBytes uint64
+	bytesSize    uint64
+	requests     uint64
+	misses       uint64
+}
+
+func (u *cacheUsage) hitRate() float64 {
+	if u.requests == 0 {
+		return 0
+	}
+	return 1 - float64(u.misses)/float64(u.requests)
+}
+
+// needsMoreMemory returns true if the cache is almost full and more memory may improve its hit rate.
+func (u *cacheUsage) needsMoreMemory() bool {
+	if u.requests < minRequestsForResize || u.maxBytes >= u.origMaxBytes*maxGrowFactor {
+		return false
+	}
+	hitRate := u.hitRate()
+	return u.bytesSize >= 2*u.maxBytes*8/10 && hitRate >= 0.5 && hitRate < 0.95
+}
+
+// canShrink returns true if the cache is idle or has low hit rate, so its memory may be given to other caches.
+func (u *cacheUsage) canShrink() bool {
+	if u.maxBytes <= u.origMaxBytes/maxShrinkFactor {
+		return false
+	}
+	return u.requests < minRequestsForResize || u.hitRate() < 0.5
+}
+
+// getAdaptiveSizes returns new maxBytes values for caches with the given usage stats.
+//
+// Caches with low hit rates are shrunk by 25% and the freed memory is evenly distributed among caches, which need more memory.
+// The summary size of caches never exceeds the summary size before the call.
+func getAdaptiveSizes(us []cacheUsage) []uint64 {
+	sizes := make([]uint64, len(us))
+	var needy []int
+	for i := range us {
+		u := &us[i]
+		sizes[i] = u.maxBytes
+		if u.needsMoreMemory() {
+			needy = append(needy, i)
+		}
+	}
+	if len(needy) == 0 {
+		// Nobody needs more memory.
+		return sizes
+	}
+	freed := uint64(0)
+	for i := range us {
+		u := &us[i]
+		if !u.canShrink() {
+			continue
+		}
+		n := u.maxBytes / 4
+		if minBytes := u.origMaxBytes / maxShrinkFactor; u.maxBytes-n < minBytes {
+			n = u.maxBytes - minBytes
+		}
+		sizes[i] -= n
+		freed += n
+	}
+	if freed == 0 {
+		return sizes
+	}
+	perCache := freed / uint64(len(needy))
+	for _, i := range needy {
+		u := &us[i]
+		n := perCache
+		if maxBytes := u.origMaxBytes * maxGrowFactor; sizes[i]+n > maxBytes {
+			n = maxBytes - sizes[i]
+		}
+		sizes[i] += n
+	}
+	return sizes
+}
@@ -0,0 +1,157 @@
+package workingsetcache
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+func TestGetAdaptiveSizes(t *testing.T) {
+	f := func(us []cacheUsage, sizesExpected []uint64) {
+		t.Helper()
+		sizes := getAdaptiveSizes(us)
+		if !reflect.DeepEqual(sizes, sizesExpected) {
+			t.Fatalf("unexpected sizes; got %v; want %v", sizes, sizesExpected)
+		}
+	}
+
+	// Nobody needs more memory
+	f([]cacheUsage{
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 100, requests: 1e6, misses: 9e5},
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 100, requests: 1e6, misses: 1e3},
+	}, []uint64{1000, 1000})
+
+	// Full cache with high hit rate takes memory from cache with low hit rate
+	f([]cacheUsage{
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 100, requests: 1e6, misses: 9e5},
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 1900, requests: 1e6, misses: 1e5},
+	}, []uint64{750, 1250})
+
+	// Idle cache gives memory to full caches
+	f([]cacheUsage{
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 100, requests: 10},
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 1900, requests: 1e6, misses: 1e5},
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 1900, requests: 1e6, misses: 2e5},
+	}, []uint64{750, 1125, 1125})
+
+	// Full cache with very high hit rate doesn't need more memory
+	f([]cacheUsage{
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 100, requests: 10},
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 1900, requests: 1e6, misses: 1e3},
+	}, []uint64{1000, 1000})
+
+	// Caches aren't shrunk below the limit
+	f([]cacheUsage{
+		{maxBytes: 300, origMaxBytes: 1000, bytesSize: 100, requests: 10},
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 1900, requests: 1e6, misses: 1e5},
+	}, []uint64{250, 1050})
+
+	// Caches aren't grown above the limit
+	f([]cacheUsage{
+		{maxBytes: 1000, origMaxBytes: 1000, bytesSize: 100, requests: 10},
+		{maxBytes: 3900, origMaxBytes: 1000, bytesSize: 7000, requests: 1e6, misses: 1e5},
+	}, []uint64{750, 4000})
+}
+
+func TestCacheResize(t *testing.T) {
+	newCache := func(mode uint64) *Cache {
+		t.Helper()
+		c := New(1024*1024, time.Hour)
+		if n := c.MaxBytesSize(); n != 1024*1024 {
+			t.Fatalf("unexpected MaxBytesSize; got %d; want %d", n, 1024*1024)
+		}
+		c.Set([]byte("foo"), []byte("bar"))
+		if mode != split {
+			// Move the entry to prev cache like cacheSizeWatcher does.
+			c.mu.Lock()
+			atomic.StoreUint64(&c.mode, switching)
+			c.replaceCurr(1024 * 1024)
+			c.mu.Unlock()
+			c.Set([]byte("baz"), []byte("qux"))
+		}
+		if mode == whole {
+			c.mu.Lock()
+			atomic.StoreUint64(&c.mode, whole)
+			c.prev.Store(fastcache.New(1024))
+			c.mu.Unlock()
+			c.Set([]byte("foo"), []byte("bar"))
+		}
+		return c
+	}
+	f := func(mode, modeExpected uint64) {
+		t.Helper()
+		c := newCache(mode)
+		defer c.Stop()
+		c.resize(2 * 1024 * 1024)
+		if n := c.MaxBytesSize(); n != 4*1024*1024 {
+			t.Fatalf("unexpected MaxBytesSize after resize; got %d; want %d", n, 4*1024*1024)
+		}
+		if mode := atomic.LoadUint64(&c.mode); mode != modeExpected {
+			t.Fatalf("unexpected mode after resize; got %d; want %d", mode, modeExpected)
+		}
+		if v := c.Get(nil, []byte("foo")); string(v) != "bar" {
+			t.Fatalf("unexpected value after resize; got %q; want %q", v, "bar")
+		}
+		if mode != split {
+			if v := c.Get(nil, []byte("baz")); string(v) != "qux" {
+				t.Fatalf("unexpected value after resize; got %q; want %q", v, "qux")
+			}
+		}
+	}
+
+	// The new size is applied on the next expiration in split mode.
+	f(split, split)
+
+	// The new size is applied after switching to whole mode.
+	f(switching, switching)
+
+	// The whole cache is migrated to the new curr cache without expiration.
+	f(whole, switching)
+}
+
+func TestCacheResizeWhole(t *testing.T) {
+	c := New(1024*1024, time.Hour)
+	defer c.Stop()
+
+	c.mu.Lock()
+	atomic.StoreUint64(&c.mode, switching)
+	c.replaceCurr(1024 * 1024)
+	c.mu.Unlock()
+	c.Set([]byte("foo"), []byte("bar"))
+	c.resize(2 * 1024 * 1024)
+
+	// Fill curr cache, so checkCacheSize switches to whole mode and then applies the pending resize.
+	value := make([]byte, 1024)
+	for i := 0; i < 1024; i++ {
+		c.Set([]byte(fmt.Sprintf("key_%d", i)), value)
+	}
+	c.checkCacheSize()
+	if mode := atomic.LoadUint64(&c.mode); mode != switching {
+		t.Fatalf("unexpected mode; got %d; want %d", mode, switching)
+	}
+	c.mu.Lock()
+	currMaxBytes := c.currMaxBytes
+	c.mu.Unlock()
+	if currMaxBytes != 4*1024*1024 {
+		t.Fatalf("unexpected curr cache size; got %d; want %d", currMaxBytes, 4*1024*1024)
+	}
+	if v := c.Get(nil, []byte("foo")); string(v) != "bar" {
+		t.Fatalf("unexpected value after resize; got %q; want %q", v, "bar")
+	}
+}
+
+func TestRegisterCache(t *testing.T) {
+	c := New(1024*1024, time.Hour)
+	defer c.Stop()
+
+	cachesLock.Lock()
+	_, ok := caches[c]
+	cachesLock.Unlock()
+	if ok {
+		t.Fatalf("the cache mustn't be registered when adaptive resizing is disabled")
+	}
+}
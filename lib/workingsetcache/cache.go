@@ -35,13 +35,31 @@ type Cache struct {
 	// After the process of switching, this flag will be set to whole.
 	mode uint64
 
-	// mu serializes access to curr, prev and mode
-	// in expirationWorker and cacheSizeWatcher.
+	// maxBytes is the size for curr cache in split mode.
+	//
+	// It may be changed by adaptive resizing. See -cache.adaptiveResizeInterval.
+	maxBytes uint64
+
+	// currMaxBytes is the size of curr cache.
+	//
+	// It differs from 2*maxBytes in whole mode after maxBytes is changed.
+	currMaxBytes uint64
+
+	// mu serializes access to curr, prev, mode and currMaxBytes
+	// in expirationWorker, cacheSizeWatcher and resize.
 	mu sync.Mutex
 
+	// sizeWatcherStarted is set to true after cacheSizeWatcher is started.
+	sizeWatcherStarted bool
+
 	wg     sync.WaitGroup
 	stopCh chan struct{}
 
+	// The following fields are used by adaptive resizing under cachesLock. See adaptive.go.
+	origMaxBytes uint64
+	prevRequests uint64
+	prevMisses   uint64
+
 	// historicalStats keeps historical counters from fastcache.Stats
 	historicalStats fastcache.Stats
 }
@@ -61,18 +79,13 @@ func Load(filePath string, maxBytes int, expireDuration time.Duration) *Cache {
 		// Try loading it again with maxBytes / 2 size.
 		maxBytes /= 2
 		curr = fastcache.LoadFromFileOrNew(filePath, maxBytes)
-		return newWorkingSetCache(curr, maxBytes, expireDuration)
+		return newWorkingSetCache(curr, maxBytes, expireDuration, split)
 	}
 
 	// The cache has been successfully loaded in full.
 	// Set its' mode to `whole`.
 	// There is no need in starting expirationWorker and cacheSizeWatcher.
-	var c Cache
-	c.curr.Store(curr)
-	c.prev.Store(fastcache.New(1024))
-	c.stopCh = make(chan struct{})
-	atomic.StoreUint64(&c.mode, whole)
-	return &c
+	return newWorkingSetCache(curr, maxBytes/2, expireDuration, whole)
 }
 
 // New creates new cache with the given maxBytes size and the given expireDuration
@@ -83,31 +96,50 @@ func New(maxBytes int, expireDuration time.Duration) *Cache {
 	// Split maxBytes between curr and prev caches.
 	maxBytes /= 2
 	curr := fastcache.New(maxBytes)
-	return newWorkingSetCache(curr, maxBytes, expireDuration)
+	return newWorkingSetCache(curr, maxBytes, expireDuration, split)
 }
 
-func newWorkingSetCache(curr *fastcache.Cache, maxBytes int, expireDuration time.Duration) *Cache {
+func newWorkingSetCache(curr *fastcache.Cache, maxBytes int, expireDuration time.Duration, mode uint64) *Cache {
 	prev := fastcache.New(1024)
 	var c Cache
 	c.curr.Store(curr)
 	c.prev.Store(prev)
 	c.stopCh = make(chan struct{})
-	atomic.StoreUint64(&c.mode, split)
+	atomic.StoreUint64(&c.mode, mode)
+	atomic.StoreUint64(&c.maxBytes, uint64(maxBytes))
+	c.currMaxBytes = uint64(maxBytes)
+	c.origMaxBytes = uint64(maxBytes)
+
+	if mode == split {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.expirationWorker(expireDuration)
+		}()
+		c.startCacheSizeWatcher()
+	} else {
+		c.currMaxBytes *= 2
+	}
+	registerCache(&c)
+	return &c
+}
 
+// startCacheSizeWatcher starts cacheSizeWatcher if it isn't started yet.
+//
+// It must be called under c.mu or before c is shared with other goroutines.
+func (c *Cache) startCacheSizeWatcher() {
+	if c.sizeWatcherStarted {
+		return
+	}
+	c.sizeWatcherStarted = true
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
-		c.expirationWorker(maxBytes, expireDuration)
-	}()
-	c.wg.Add(1)
-	go func() {
-		defer c.wg.Done()
-		c.cacheSizeWatcher(maxBytes)
+		c.cacheSizeWatcher()
 	}()
-	return &c
 }
 
-func (c *Cache) expirationWorker(maxBytes int, expireDuration time.Duration) {
+func (c *Cache) expirationWorker(expireDuration time.Duration) {
 	t := time.NewTicker(expireDuration / 2)
 	for {
 		select {
@@ -126,32 +158,20 @@ func (c *Cache) expirationWorker(maxBytes int, expireDuration time.Duration) {
 			curr := c.curr.Load().(*fastcache.Cache)
 			curr.UpdateStats(&c.historicalStats)
 			c.prev.Store(curr)
-			curr = fastcache.New(maxBytes)
+			maxBytes := atomic.LoadUint64(&c.maxBytes)
+			curr = fastcache.New(int(maxBytes))
 			c.curr.Store(curr)
+			c.currMaxBytes = maxBytes
 		}
 		c.mu.Unlock()
 	}
 }
 
-func (c *Cache) cacheSizeWatcher(maxBytes int) {
+func (c *Cache) cacheSizeWatcher() {
 	t := time.NewTicker(time.Minute)
 	defer t.Stop()
 
-	for {
-		select {
-		case <-c.stopCh:
-			return
-		case <-t.C:
-		}
-		var cs fastcache.Stats
-		curr := c.curr.Load().(*fastcache.Cache)
-		curr.UpdateStats(&cs)
-		if cs.BytesSize >= uint64(maxBytes)/2 {
-			break
-		}
-	}
-
-	// curr cache size exceeds 50% of its capacity. It is better
+	// When curr cache size exceeds 50% of its capacity in split mode, it is better
 	// to double the size of curr cache and stop using prev cache,
 	// since this will result in higher summary cache capacity.
 	//
@@ -162,37 +182,101 @@ func (c *Cache) cacheSizeWatcher(maxBytes int) {
 	// 4) wait until curr size exceeds maxBytes/2, i.e. it is populated with new data
 	// 5) switch to mode=whole
 	// 6) drop prev
-
-	c.mu.Lock()
-	atomic.StoreUint64(&c.mode, switching)
-	prev := c.prev.Load().(*fastcache.Cache)
-	prev.Reset()
-	curr := c.curr.Load().(*fastcache.Cache)
-	curr.UpdateStats(&c.historicalStats)
-	c.prev.Store(curr)
-	c.curr.Store(fastcache.New(maxBytes * 2))
-	c.mu.Unlock()
-
+	//
+	// The cache may return to switching mode after resize call.
 	for {
 		select {
 		case <-c.stopCh:
 			return
 		case <-t.C:
 		}
+		c.checkCacheSize()
+	}
+}
+
+func (c *Cache) checkCacheSize() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	maxBytes := atomic.LoadUint64(&c.maxBytes)
+	switch atomic.LoadUint64(&c.mode) {
+	case split:
+		var cs fastcache.Stats
+		curr := c.curr.Load().(*fastcache.Cache)
+		curr.UpdateStats(&cs)
+		if cs.BytesSize < maxBytes/2 {
+			return
+		}
+		atomic.StoreUint64(&c.mode, switching)
+		prev := c.prev.Load().(*fastcache.Cache)
+		prev.Reset()
+		c.replaceCurr(maxBytes * 2)
+	case switching:
 		var cs fastcache.Stats
 		curr := c.curr.Load().(*fastcache.Cache)
 		curr.UpdateStats(&cs)
-		if cs.BytesSize >= uint64(maxBytes)/2 {
-			break
+		if cs.BytesSize < maxBytes/2 {
+			return
+		}
+		atomic.StoreUint64(&c.mode, whole)
+		prev := c.prev.Load().(*fastcache.Cache)
+		prev.Reset()
+		c.prev.Store(fastcache.New(1024))
+		if c.currMaxBytes != 2*maxBytes {
+			// The cache has been resized while switching.
+			c.resizeWhole(maxBytes)
 		}
 	}
+}
+
+// replaceCurr moves curr cache to prev and creates new curr cache with the given size.
+//
+// Entries from the moved cache are migrated to the new curr cache on access.
+// It must be called under c.mu.
+func (c *Cache) replaceCurr(currMaxBytes uint64) {
+	curr := c.curr.Load().(*fastcache.Cache)
+	curr.UpdateStats(&c.historicalStats)
+	c.prev.Store(curr)
+	c.curr.Store(fastcache.New(int(currMaxBytes)))
+	c.currMaxBytes = currMaxBytes
+}
+
+// resizeWhole changes the size of curr cache in whole mode to maxBytes*2.
+//
+// It must be called under c.mu.
+func (c *Cache) resizeWhole(maxBytes uint64) {
+	// The size of curr cache cannot be changed in place, so switch to the new curr cache
+	// in the same way as cacheSizeWatcher does. prev cache is empty in whole mode,
+	// so all the entries remain available via prev until the switching is complete.
+	atomic.StoreUint64(&c.mode, switching)
+	c.replaceCurr(maxBytes * 2)
+	c.startCacheSizeWatcher()
+}
 
+// resize changes the size for c to maxBytes*2.
+//
+// The current entries remain available.
+func (c *Cache) resize(maxBytes uint64) {
 	c.mu.Lock()
-	atomic.StoreUint64(&c.mode, whole)
-	prev = c.prev.Load().(*fastcache.Cache)
-	prev.Reset()
-	c.prev.Store(fastcache.New(1024))
-	c.mu.Unlock()
+	defer c.mu.Unlock()
+
+	atomic.StoreUint64(&c.maxBytes, maxBytes)
+	switch atomic.LoadUint64(&c.mode) {
+	case split:
+		// The new size is applied when expirationWorker creates new curr cache.
+	case switching:
+		// Both prev and curr caches contain entries, so the new size is applied
+		// by cacheSizeWatcher after switching to whole mode.
+	case whole:
+		if c.currMaxBytes != 2*maxBytes {
+			c.resizeWhole(maxBytes)
+		}
+	}
+}
+
+// MaxBytesSize returns the maximum size in bytes for c.
+func (c *Cache) MaxBytesSize() uint64 {
+	return 2 * atomic.LoadUint64(&c.maxBytes)
 }
 
 // Save safes the cache to filePath.
@@ -206,6 +290,8 @@ func (c *Cache) Save(filePath string) error {
 //
 // The cache cannot be used after the Stop call.
 func (c *Cache) Stop() {
+	// Unregister the cache before stopping, so resize cannot start new workers after the stop.
+	unregisterCache(c)
 	close(c.stopCh)
 	c.wg.Wait()
 
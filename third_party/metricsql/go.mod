@@ -0,0 +1,5 @@
+module github.com/VictoriaMetrics/metricsql
+
+go 1.13
+
+require github.com/VictoriaMetrics/metrics v1.12.2